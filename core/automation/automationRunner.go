@@ -186,6 +186,9 @@ func AutomationRunnerFunc(id uint, automationCtx types.ExecutionContextAutomatio
 	// 	initiator = types.InitiatorAutomation
 	// }
 
+	// Link the resulting run in the execution history to this automation
+	automationCtx.Inner.AutomationID = &id
+
 	// NOTE: If the automation context includes a maximum runtime, kill the script if it exceeds this timeout
 	ctx, cancel := context.WithCancel(context.Background())
 	if automationCtx.Inner.MaximumHMSRuntime != nil {
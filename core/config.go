@@ -17,6 +17,7 @@ type Config struct {
 type ServerConfig struct {
 	Production bool   `json:"production"`
 	SessionKey string `json:"sessionKey"` // Can be used to specify a manual session key
+	SecretsKey string `json:"secretsKey"` // Base64-encoded key for encrypting Homescript secrets, a key file is generated if empty
 	Port       uint16 `json:"port"`
 }
 
@@ -6,7 +6,9 @@ import (
 	"github.com/smarthome-go/smarthome/core/event"
 	hardware "github.com/smarthome-go/smarthome/core/hardware_deprecated"
 	"github.com/smarthome-go/smarthome/core/homescript"
+	"github.com/smarthome-go/smarthome/core/mqttbroker"
 	"github.com/smarthome-go/smarthome/core/user"
+	"github.com/smarthome-go/smarthome/core/user/secret"
 )
 
 var log *logrus.Logger
@@ -20,5 +22,7 @@ func InitLoggers(logger *logrus.Logger) {
 	hardware.InitLogger(log)
 	event.InitLogger(log)
 	user.InitLogger(log)
+	secret.InitLogger(log)
+	mqttbroker.InitLogger(log)
 	log.Trace("Core loggers initialized")
 }
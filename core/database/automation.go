@@ -163,6 +163,7 @@ func CreateNewAutomation(automation Automation) (uint, error) {
 		log.Error("Failed to create new automation: retrieving last inserted id failed: ", err.Error())
 		return 0, err
 	}
+	dependenciesChanged()
 	return uint(newId), nil
 }
 
@@ -376,6 +377,7 @@ func ModifyAutomation(id uint, newItem AutomationData) error {
 		log.Error("Failed to modify automation: executing query failed: ", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
 
@@ -420,6 +422,7 @@ func DeleteAutomationById(id uint) error {
 		log.Error("Failed to delete automation by Id: executing query failed: ", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
 
@@ -441,5 +444,6 @@ func DeleteAllAutomationsFromUser(username string) error {
 		log.Error("Failed to delete all automations from user: executing query failed", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
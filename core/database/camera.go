@@ -249,6 +249,9 @@ func DeleteCamera(id string) error {
 	if err := RemoveCameraFromPermissions(id); err != nil {
 		return err
 	}
+	if err := DeleteCameraSnapshotsOfCamera(id); err != nil {
+		return err
+	}
 	query, err := db.Prepare(`
 	DELETE FROM camera
 	WHERE Id=?
@@ -0,0 +1,307 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// The amount of snapshots which are kept per user and camera, older snapshots are deleted automatically
+const CameraSnapshotsPerCamera = 50
+
+// A camera image saved by a Homescript
+// Snapshots can be attached to a notification of their owner
+type CameraSnapshot struct {
+	Id             uint      `json:"id"`
+	Owner          string    `json:"owner"`
+	CameraId       string    `json:"cameraId"`
+	NotificationId *uint     `json:"notificationId"`
+	ContentType    string    `json:"contentType"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// Is only loaded by `GetCameraSnapshot`
+	Data []byte `json:"-"`
+}
+
+// Creates the table containing the camera snapshot archive
+// If the database fails, this function returns an error
+func createCameraSnapshotTable() error {
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	cameraSnapshot(
+		Id					INT AUTO_INCREMENT,
+		Owner				VARCHAR(20) NOT NULL,
+		CameraId			VARCHAR(50) NOT NULL,
+		NotificationId		INT NULL,
+		ContentType			VARCHAR(30) NOT NULL,
+		CreatedAt			DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+		Data				MEDIUMBLOB NOT NULL,
+
+		PRIMARY KEY (Id),
+		INDEX (Owner, CameraId),
+		FOREIGN KEY (Owner)
+		REFERENCES user(Username)
+	)
+	`); err != nil {
+		log.Error("Failed to create camera snapshot table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Saves a new snapshot and returns its id
+// Afterwards, the oldest snapshots of the camera are deleted so that at most `CameraSnapshotsPerCamera` remain
+func InsertCameraSnapshot(owner string, cameraId string, notificationId *uint, contentType string, data []byte) (uint, error) {
+	query, err := db.Prepare(`
+	INSERT INTO
+	cameraSnapshot(
+		Owner,
+		CameraId,
+		NotificationId,
+		ContentType,
+		Data
+	)
+	VALUES(?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		log.Error("Could not insert camera snapshot: Preparing query failed: ", err.Error())
+		return 0, err
+	}
+	defer query.Close()
+
+	res, err := query.Exec(owner, cameraId, notificationId, contentType, data)
+	if err != nil {
+		log.Error("Could not insert camera snapshot: Executing query failed: ", err.Error())
+		return 0, err
+	}
+
+	newId, err := res.LastInsertId()
+	if err != nil {
+		log.Error("Could not insert camera snapshot: Retrieving last insert id failed: ", err.Error())
+		return 0, err
+	}
+
+	if err := pruneCameraSnapshots(owner, cameraId); err != nil {
+		return 0, err
+	}
+
+	return uint(newId), nil
+}
+
+func pruneCameraSnapshots(owner string, cameraId string) error {
+	// MariaDB does not support `LIMIT` in subqueries of `DELETE`, the derived table works around this
+	query, err := db.Prepare(`
+	DELETE FROM cameraSnapshot
+	WHERE Owner=? AND CameraId=?
+	AND Id NOT IN (
+		SELECT Id FROM (
+			SELECT Id
+			FROM cameraSnapshot
+			WHERE Owner=? AND CameraId=?
+			ORDER BY Id DESC
+			LIMIT ?
+		) AS newest
+	)
+	`)
+	if err != nil {
+		log.Error("Could not prune camera snapshots: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(owner, cameraId, owner, cameraId, CameraSnapshotsPerCamera); err != nil {
+		log.Error("Could not prune camera snapshots: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Lists the snapshots of a user without their image data, newest first
+// If `cameraId` is empty, the snapshots of all cameras are returned
+func ListCameraSnapshots(owner string, cameraId string) ([]CameraSnapshot, error) {
+	query, err := db.Prepare(`
+	SELECT
+		Id,
+		Owner,
+		CameraId,
+		NotificationId,
+		ContentType,
+		CreatedAt
+	FROM cameraSnapshot
+	WHERE Owner=?
+	AND (?='' OR CameraId=?)
+	ORDER BY Id DESC
+	`)
+	if err != nil {
+		log.Error("Could not list camera snapshots: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(owner, cameraId, cameraId)
+	if err != nil {
+		log.Error("Could not list camera snapshots: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	snapshots := make([]CameraSnapshot, 0)
+	for res.Next() {
+		var snapshot CameraSnapshot
+		var notificationId sql.NullInt64
+		if err := res.Scan(
+			&snapshot.Id,
+			&snapshot.Owner,
+			&snapshot.CameraId,
+			&notificationId,
+			&snapshot.ContentType,
+			&snapshot.CreatedAt,
+		); err != nil {
+			log.Error("Could not list camera snapshots: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		if notificationId.Valid {
+			id := uint(notificationId.Int64)
+			snapshot.NotificationId = &id
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// Returns a snapshot including its image data
+// Snapshots of other users are treated as if they did not exist
+func GetCameraSnapshot(owner string, id uint) (snapshot CameraSnapshot, found bool, err error) {
+	query, err := db.Prepare(`
+	SELECT
+		Id,
+		Owner,
+		CameraId,
+		NotificationId,
+		ContentType,
+		CreatedAt,
+		Data
+	FROM cameraSnapshot
+	WHERE Owner=? AND Id=?
+	`)
+	if err != nil {
+		log.Error("Could not get camera snapshot: Preparing query failed: ", err.Error())
+		return CameraSnapshot{}, false, err
+	}
+	defer query.Close()
+
+	var notificationId sql.NullInt64
+	if err := query.QueryRow(owner, id).Scan(
+		&snapshot.Id,
+		&snapshot.Owner,
+		&snapshot.CameraId,
+		&notificationId,
+		&snapshot.ContentType,
+		&snapshot.CreatedAt,
+		&snapshot.Data,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return CameraSnapshot{}, false, nil
+		}
+		log.Error("Could not get camera snapshot: Executing query failed: ", err.Error())
+		return CameraSnapshot{}, false, err
+	}
+	if notificationId.Valid {
+		id := uint(notificationId.Int64)
+		snapshot.NotificationId = &id
+	}
+
+	return snapshot, true, nil
+}
+
+// Returns the ids of the snapshots attached to the notifications of a user
+// The map is indexed by notification id
+func ListNotificationSnapshotIds(owner string) (map[uint]uint, error) {
+	query, err := db.Prepare(`
+	SELECT
+		NotificationId,
+		Id
+	FROM cameraSnapshot
+	WHERE Owner=? AND NotificationId IS NOT NULL
+	`)
+	if err != nil {
+		log.Error("Could not list notification snapshots: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(owner)
+	if err != nil {
+		log.Error("Could not list notification snapshots: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	snapshots := make(map[uint]uint)
+	for res.Next() {
+		var notificationId, snapshotId uint
+		if err := res.Scan(&notificationId, &snapshotId); err != nil {
+			log.Error("Could not list notification snapshots: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		snapshots[notificationId] = snapshotId
+	}
+
+	return snapshots, nil
+}
+
+// Deletes a snapshot of a user, returns `false` if it did not exist
+func DeleteCameraSnapshot(owner string, id uint) (bool, error) {
+	query, err := db.Prepare(`
+	DELETE FROM cameraSnapshot
+	WHERE Owner=? AND Id=?
+	`)
+	if err != nil {
+		log.Error("Could not delete camera snapshot: Preparing query failed: ", err.Error())
+		return false, err
+	}
+	defer query.Close()
+
+	res, err := query.Exec(owner, id)
+	if err != nil {
+		log.Error("Could not delete camera snapshot: Executing query failed: ", err.Error())
+		return false, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Error("Could not delete camera snapshot: Retrieving rows affected count failed: ", err.Error())
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func deleteCameraSnapshotsWhere(condition string, arg string) error {
+	query, err := db.Prepare(`
+	DELETE FROM cameraSnapshot
+	WHERE ` + condition)
+	if err != nil {
+		log.Error("Could not delete camera snapshots: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(arg); err != nil {
+		log.Error("Could not delete camera snapshots: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Deletes all snapshots of a camera, used when deleting a camera
+func DeleteCameraSnapshotsOfCamera(cameraId string) error {
+	return deleteCameraSnapshotsWhere("CameraId=?", cameraId)
+}
+
+// Deletes all snapshots of a user, used when deleting a user
+func DeleteCameraSnapshotsOfUser(username string) error {
+	return deleteCameraSnapshotsWhere("Owner=?", username)
+}
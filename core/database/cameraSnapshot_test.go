@@ -0,0 +1,79 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateCameraSnapshotTable(t *testing.T) {
+	assert.NoError(t, createCameraSnapshotTable())
+}
+
+func TestCameraSnapshots(t *testing.T) {
+	assert.NoError(t, DeleteCameraSnapshotsOfUser("admin"))
+
+	notificationId, err := AddNotification("admin", "Motion", "Motion at the front door", 2)
+	assert.NoError(t, err)
+
+	plainId, err := InsertCameraSnapshot("admin", "front_door", nil, "image/jpeg", []byte{0xFF, 0xD8})
+	assert.NoError(t, err)
+	attachedId, err := InsertCameraSnapshot("admin", "front_door", &notificationId, "image/png", []byte{0x89, 0x50})
+	assert.NoError(t, err)
+
+	snapshot, found, err := GetCameraSnapshot("admin", attachedId)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "image/png", snapshot.ContentType)
+	assert.Equal(t, []byte{0x89, 0x50}, snapshot.Data)
+	assert.Equal(t, notificationId, *snapshot.NotificationId)
+
+	// Snapshots of other users are invisible
+	_, found, err = GetCameraSnapshot("other", attachedId)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	snapshots, err := ListCameraSnapshots("admin", "front_door")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, attachedId, snapshots[0].Id)
+	assert.Nil(t, snapshots[0].Data)
+
+	snapshots, err = ListCameraSnapshots("admin", "garage")
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+
+	attached, err := ListNotificationSnapshotIds("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint]uint{notificationId: attachedId}, attached)
+
+	deleted, err := DeleteCameraSnapshot("admin", plainId)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = DeleteCameraSnapshot("admin", plainId)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	assert.NoError(t, DeleteCameraSnapshotsOfCamera("front_door"))
+	snapshots, err = ListCameraSnapshots("admin", "")
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+}
+
+func TestCameraSnapshotPruning(t *testing.T) {
+	assert.NoError(t, DeleteCameraSnapshotsOfUser("admin"))
+
+	var newest uint
+	for i := 0; i < CameraSnapshotsPerCamera+5; i++ {
+		id, err := InsertCameraSnapshot("admin", "garage", nil, "image/jpeg", []byte{byte(i)})
+		assert.NoError(t, err)
+		newest = id
+	}
+
+	snapshots, err := ListCameraSnapshots("admin", "garage")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, CameraSnapshotsPerCamera)
+	assert.Equal(t, newest, snapshots[0].Id)
+
+	assert.NoError(t, DeleteCameraSnapshotsOfUser("admin"))
+}
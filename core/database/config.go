@@ -24,6 +24,12 @@ type MqttConfig struct {
 	Port     uint16 `json:"port"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// The following fields are stored separately, see `MqttBrokerConfig` and `MqttBrokerConnection`
+	Broker MqttBrokerConfig `json:"broker"`
+	// TLS settings of the default broker, are ignored if the embedded broker is used
+	TLS MqttTLSConfig `json:"tls"`
+	// Additional, named brokers to which the server connects alongside the default broker
+	Connections []MqttBrokerConnection `json:"connections"`
 }
 
 // Creates the table that contains the server configuration
@@ -114,6 +120,21 @@ func GetServerConfiguration() (ServerConfig, bool, error) {
 		log.Error("Failed to retrieve server configuration: ", err.Error())
 		return ServerConfig{}, false, err
 	}
+	broker, err := GetMqttBrokerConfig()
+	if err != nil {
+		return ServerConfig{}, false, err
+	}
+	config.Mqtt.Broker = broker
+	tls, err := GetMqttTLSConfig()
+	if err != nil {
+		return ServerConfig{}, false, err
+	}
+	config.Mqtt.TLS = tls
+	connections, err := ListMqttConnections()
+	if err != nil {
+		return ServerConfig{}, false, err
+	}
+	config.Mqtt.Connections = connections
 	return config, true, nil
 }
 
@@ -155,7 +176,7 @@ func SetServerConfiguration(config ServerConfig) error {
 		log.Error("Failed to update the servers configuration: executing query failed: ", err.Error())
 		return err
 	}
-	return nil
+	return setMqttSeparateConfig(config.Mqtt)
 }
 
 // Changes the state of the lock-down mode
@@ -266,5 +287,16 @@ func UpdateMqttConfig(settings MqttConfig) error {
 		log.Error("Failed to update the servers MQTT config: executing query failed: ", err.Error())
 		return err
 	}
-	return nil
+	return setMqttSeparateConfig(settings)
+}
+
+// Saves the parts of the MQTT config which are not stored in the configuration table
+func setMqttSeparateConfig(settings MqttConfig) error {
+	if err := SetMqttBrokerConfig(settings.Broker); err != nil {
+		return err
+	}
+	if err := SetMqttTLSConfig(settings.TLS); err != nil {
+		return err
+	}
+	return SetMqttConnections(settings.Connections)
 }
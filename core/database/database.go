@@ -53,16 +53,37 @@ func DeleteTables() error {
 		"SET FOREIGN_KEY_CHECKS = 0",
 		"DROP TABLE IF EXISTS automation",
 		"DROP TABLE IF EXISTS camera",
+		"DROP TABLE IF EXISTS cameraSnapshot",
 		"DROP TABLE IF EXISTS configuration",
 		"DROP TABLE IF EXISTS device",
 		"DROP TABLE IF EXISTS deviceDriver",
+		"DROP TABLE IF EXISTS deviceDriverMeta",
+		"DROP TABLE IF EXISTS deviceDriverInvocationPolicy",
+		"DROP TABLE IF EXISTS deviceDriverNetworkHost",
+		"DROP TABLE IF EXISTS deviceDriverSnapshot",
+		"DROP TABLE IF EXISTS deviceInvocationTimeout",
 		"DROP TABLE IF EXISTS hasCameraPermission",
 		"DROP TABLE IF EXISTS hasDevicePermission",
 		"DROP TABLE IF EXISTS hasPermission",
+		"DROP TABLE IF EXISTS homeAssistantConfig",
 		"DROP TABLE IF EXISTS homescript",
 		"DROP TABLE IF EXISTS homescriptArg",
+		"DROP TABLE IF EXISTS homescriptLibrary",
+		"DROP TABLE IF EXISTS homescriptLibraryAccess",
+		"DROP TABLE IF EXISTS homescriptLibraryVersion",
+		"DROP TABLE IF EXISTS homescriptNetworkHost",
+		"DROP TABLE IF EXISTS homescriptQuota",
+		"DROP TABLE IF EXISTS homescriptRun",
+		"DROP TABLE IF EXISTS homescriptRunRetention",
+		"DROP TABLE IF EXISTS homescriptSecret",
 		"DROP TABLE IF EXISTS homescriptStorage",
+		"DROP TABLE IF EXISTS homescriptStorageEntry",
+		"DROP TABLE IF EXISTS homescriptWebhook",
 		"DROP TABLE IF EXISTS logs",
+		"DROP TABLE IF EXISTS mqttBridgeConfig",
+		"DROP TABLE IF EXISTS mqttBrokerConfig",
+		"DROP TABLE IF EXISTS mqttConnection",
+		"DROP TABLE IF EXISTS mqttTLSConfig",
 		"DROP TABLE IF EXISTS notifications",
 		"DROP TABLE IF EXISTS permission",
 		"DROP TABLE IF EXISTS powerUsage",
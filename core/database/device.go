@@ -176,6 +176,9 @@ func DeleteDevice(deviceId string) error {
 	if err := RemoveDeviceFromPermissions(deviceId); err != nil {
 		return err
 	}
+	if err := SetDeviceInvocationTimeout(deviceId, nil); err != nil {
+		return err
+	}
 
 	query, err := db.Prepare(`
 	DELETE FROM
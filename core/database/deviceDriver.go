@@ -99,6 +99,7 @@ func CreateNewDeviceDriver(driverData DeviceDriver) error {
 		return err
 	}
 
+	dependenciesChanged()
 	return nil
 }
 
@@ -133,6 +134,60 @@ func ModifyDeviceDriver(newData DeviceDriver) error {
 		return err
 	}
 
+	dependenciesChanged()
+	return nil
+}
+
+// Replaces the metadata, code and singleton of a driver together with the singletons of its devices
+// All changes are applied in a single transaction so that a failure cannot leave a partially migrated driver behind
+func ReplaceDeviceDriverState(newData DeviceDriver, deviceSingletonsJson map[string]string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error("Failed to replace device driver state: starting transaction failed: ", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+	UPDATE deviceDriver
+	SET
+		Name=?,
+		Version=?,
+		HomescriptCode=?,
+		SingletonJson=?,
+		Dirty=?
+	WHERE VendorId=? AND ModelId=?
+	`,
+		newData.Name,
+		newData.Version,
+		newData.HomescriptCode,
+		newData.SingletonJSON,
+		newData.Dirty,
+		newData.VendorID,
+		newData.ModelID,
+	); err != nil {
+		log.Error("Failed to replace device driver state: updating driver failed: ", err.Error())
+		return err
+	}
+
+	for deviceId, singletonJson := range deviceSingletonsJson {
+		if _, err := tx.Exec(`
+		UPDATE device
+		SET
+			SingletonJson=?
+		WHERE Id=?
+		`, singletonJson, deviceId); err != nil {
+			log.Error("Failed to replace device driver state: updating device singleton failed: ", err.Error())
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("Failed to replace device driver state: committing transaction failed: ", err.Error())
+		return err
+	}
+
+	dependenciesChanged()
 	return nil
 }
 
@@ -188,6 +243,7 @@ func ModifyDeviceDriverCode(vendorId string, modelId string, newCode string) err
 		return err
 	}
 
+	dependenciesChanged()
 	return nil
 }
 
@@ -343,6 +399,19 @@ func GetDeviceDriver(vendorId string, modelId string) (DeviceDriver, bool, error
 
 // Deletes a homescript by its Id, does not check if the user has access to the homescript
 func DeleteDeviceDriver(vendorId string, modelId string) error {
+	if err := RemoveAllNetworkHostsOfDriver(vendorId, modelId); err != nil {
+		return err
+	}
+	if err := DeleteDeviceDriverMeta(vendorId, modelId); err != nil {
+		return err
+	}
+	if err := DeleteDeviceDriverSnapshots(vendorId, modelId); err != nil {
+		return err
+	}
+	if err := DeleteDeviceDriverInvocationPolicy(vendorId, modelId); err != nil {
+		return err
+	}
+
 	query, err := db.Prepare(`
 	DELETE FROM deviceDriver
 	WHERE deviceDriver.VendorId=?
@@ -360,6 +429,7 @@ func DeleteDeviceDriver(vendorId string, modelId string) error {
 		return err
 	}
 
+	dependenciesChanged()
 	return nil
 }
 
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Descriptive metadata of a device driver which is only used for sharing drivers as packages
+// Drivers which were not imported from a package usually have no metadata
+type DeviceDriverMeta struct {
+	VendorID    string `json:"vendorId"`
+	ModelID     string `json:"modelId"`
+	Description string `json:"description"`
+	// An icon name or a data URL
+	Icon string `json:"icon"`
+}
+
+// Creates the table containing the package metadata of device drivers
+// If the database fails, this function returns an error
+func createDeviceDriverMetaTable() error {
+	if _, err := db.Exec(fmt.Sprintf(`
+	CREATE TABLE
+	IF NOT EXISTS
+	deviceDriverMeta(
+		VendorId		VARCHAR(%d),
+		ModelId			VARCHAR(%d),
+		Description		TEXT NOT NULL,
+		Icon			MEDIUMTEXT NOT NULL,
+		PRIMARY KEY (VendorId, ModelId)
+	)
+	`,
+		DEVICE_DRIVER_MODVEN_ID_LEN,
+		DEVICE_DRIVER_MODVEN_ID_LEN,
+	)); err != nil {
+		log.Error("Failed to create device driver meta table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Creates or replaces the metadata of a device driver
+func SetDeviceDriverMeta(meta DeviceDriverMeta) error {
+	query, err := db.Prepare(`
+	INSERT INTO
+	deviceDriverMeta(
+		VendorId,
+		ModelId,
+		Description,
+		Icon
+	)
+	VALUES(?, ?, ?, ?)
+	ON DUPLICATE KEY
+	UPDATE
+		Description=VALUES(Description),
+		Icon=VALUES(Icon)
+	`)
+	if err != nil {
+		log.Error("Could not set device driver meta: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(meta.VendorID, meta.ModelID, meta.Description, meta.Icon); err != nil {
+		log.Error("Could not set device driver meta: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the metadata of a device driver
+// If the driver has no metadata, empty metadata is returned
+func GetDeviceDriverMeta(vendorId string, modelId string) (DeviceDriverMeta, error) {
+	query, err := db.Prepare(`
+	SELECT
+		Description,
+		Icon
+	FROM deviceDriverMeta
+	WHERE VendorId=? AND ModelId=?
+	`)
+	if err != nil {
+		log.Error("Could not get device driver meta: Preparing query failed: ", err.Error())
+		return DeviceDriverMeta{}, err
+	}
+	defer query.Close()
+
+	meta := DeviceDriverMeta{
+		VendorID: vendorId,
+		ModelID:  modelId,
+	}
+	if err := query.QueryRow(vendorId, modelId).Scan(&meta.Description, &meta.Icon); err != nil && err != sql.ErrNoRows {
+		log.Error("Could not get device driver meta: Executing query failed: ", err.Error())
+		return DeviceDriverMeta{}, err
+	}
+
+	return meta, nil
+}
+
+// Deletes the metadata of a device driver, used when deleting a driver
+func DeleteDeviceDriverMeta(vendorId string, modelId string) error {
+	query, err := db.Prepare(`
+	DELETE FROM deviceDriverMeta
+	WHERE VendorId=? AND ModelId=?
+	`)
+	if err != nil {
+		log.Error("Could not delete device driver meta: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(vendorId, modelId); err != nil {
+		log.Error("Could not delete device driver meta: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
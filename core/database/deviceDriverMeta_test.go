@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateDeviceDriverMetaTable(t *testing.T) {
+	assert.NoError(t, createDeviceDriverMetaTable())
+}
+
+func TestDeviceDriverMeta(t *testing.T) {
+	// Drivers without metadata return empty metadata
+	meta, err := GetDeviceDriverMeta("meta_vendor", "meta_model")
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceDriverMeta{VendorID: "meta_vendor", ModelID: "meta_model"}, meta)
+
+	expected := DeviceDriverMeta{
+		VendorID:    "meta_vendor",
+		ModelID:     "meta_model",
+		Description: "A smart plug",
+		Icon:        "power_outlet",
+	}
+	assert.NoError(t, SetDeviceDriverMeta(expected))
+	meta, err = GetDeviceDriverMeta("meta_vendor", "meta_model")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, meta)
+
+	expected.Description = "A smart plug with power metering"
+	assert.NoError(t, SetDeviceDriverMeta(expected))
+	meta, err = GetDeviceDriverMeta("meta_vendor", "meta_model")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, meta)
+
+	assert.NoError(t, DeleteDeviceDriverMeta("meta_vendor", "meta_model"))
+	meta, err = GetDeviceDriverMeta("meta_vendor", "meta_model")
+	assert.NoError(t, err)
+	assert.Empty(t, meta.Description)
+}
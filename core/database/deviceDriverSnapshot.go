@@ -0,0 +1,250 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// The amount of snapshots which are kept per driver, older snapshots are deleted automatically
+const DeviceDriverSnapshotsPerDriver = 10
+
+// The state of a driver before a migration was applied to it
+// Is used in order to roll back a driver upgrade
+type DeviceDriverSnapshot struct {
+	Id             uint      `json:"id"`
+	VendorID       string    `json:"vendorId"`
+	ModelID        string    `json:"modelId"`
+	Version        string    `json:"version"`
+	HomescriptCode string    `json:"homescriptCode"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// The JSON-encoded driver singleton
+	DriverSingletonJSON string `json:"driverSingletonJson"`
+	// Maps the ID of every device of the driver to its JSON-encoded singleton
+	DeviceSingletonsJSON map[string]string `json:"deviceSingletonsJson"`
+}
+
+// Creates the table containing the driver snapshots which are taken before each migration
+// If the database fails, this function returns an error
+func createDeviceDriverSnapshotTable() error {
+	if _, err := db.Exec(fmt.Sprintf(`
+	CREATE TABLE
+	IF NOT EXISTS
+	deviceDriverSnapshot(
+		Id						INT AUTO_INCREMENT,
+		VendorId				VARCHAR(%d) NOT NULL,
+		ModelId					VARCHAR(%d) NOT NULL,
+		Version					VARCHAR(%d) NOT NULL,
+		HomescriptCode			LONGTEXT NOT NULL,
+		CreatedAt				DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+		DriverSingletonJson		LONGTEXT NOT NULL,
+		DeviceSingletonsJson	LONGTEXT NOT NULL,
+
+		PRIMARY KEY (Id),
+		INDEX (VendorId, ModelId)
+	)
+	`,
+		DEVICE_DRIVER_MODVEN_ID_LEN,
+		DEVICE_DRIVER_MODVEN_ID_LEN,
+		DEVICE_DRIVER_VERSION_LEN,
+	)); err != nil {
+		log.Error("Failed to create device driver snapshot table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Saves a new snapshot and returns its id
+// Afterwards, the oldest snapshots of the driver are deleted so that at most `DeviceDriverSnapshotsPerDriver` remain
+func InsertDeviceDriverSnapshot(snapshot DeviceDriverSnapshot) (uint, error) {
+	devices, err := json.Marshal(snapshot.DeviceSingletonsJSON)
+	if err != nil {
+		return 0, err
+	}
+
+	query, err := db.Prepare(`
+	INSERT INTO
+	deviceDriverSnapshot(
+		VendorId,
+		ModelId,
+		Version,
+		HomescriptCode,
+		DriverSingletonJson,
+		DeviceSingletonsJson
+	)
+	VALUES(?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		log.Error("Could not insert device driver snapshot: Preparing query failed: ", err.Error())
+		return 0, err
+	}
+	defer query.Close()
+
+	res, err := query.Exec(
+		snapshot.VendorID,
+		snapshot.ModelID,
+		snapshot.Version,
+		snapshot.HomescriptCode,
+		snapshot.DriverSingletonJSON,
+		string(devices),
+	)
+	if err != nil {
+		log.Error("Could not insert device driver snapshot: Executing query failed: ", err.Error())
+		return 0, err
+	}
+
+	newId, err := res.LastInsertId()
+	if err != nil {
+		log.Error("Could not insert device driver snapshot: Retrieving last insert id failed: ", err.Error())
+		return 0, err
+	}
+
+	if err := pruneDeviceDriverSnapshots(snapshot.VendorID, snapshot.ModelID); err != nil {
+		return 0, err
+	}
+
+	return uint(newId), nil
+}
+
+func pruneDeviceDriverSnapshots(vendorId string, modelId string) error {
+	// MariaDB does not support `LIMIT` in subqueries of `DELETE`, the derived table works around this
+	query, err := db.Prepare(`
+	DELETE FROM deviceDriverSnapshot
+	WHERE VendorId=? AND ModelId=?
+	AND Id NOT IN (
+		SELECT Id FROM (
+			SELECT Id
+			FROM deviceDriverSnapshot
+			WHERE VendorId=? AND ModelId=?
+			ORDER BY Id DESC
+			LIMIT ?
+		) AS newest
+	)
+	`)
+	if err != nil {
+		log.Error("Could not prune device driver snapshots: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(vendorId, modelId, vendorId, modelId, DeviceDriverSnapshotsPerDriver); err != nil {
+		log.Error("Could not prune device driver snapshots: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Lists the snapshots of a driver without their code and singletons, newest first
+func ListDeviceDriverSnapshots(vendorId string, modelId string) ([]DeviceDriverSnapshot, error) {
+	query, err := db.Prepare(`
+	SELECT
+		Id,
+		VendorId,
+		ModelId,
+		Version,
+		CreatedAt
+	FROM deviceDriverSnapshot
+	WHERE VendorId=? AND ModelId=?
+	ORDER BY Id DESC
+	`)
+	if err != nil {
+		log.Error("Could not list device driver snapshots: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(vendorId, modelId)
+	if err != nil {
+		log.Error("Could not list device driver snapshots: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	snapshots := make([]DeviceDriverSnapshot, 0)
+	for res.Next() {
+		var snapshot DeviceDriverSnapshot
+		if err := res.Scan(
+			&snapshot.Id,
+			&snapshot.VendorID,
+			&snapshot.ModelID,
+			&snapshot.Version,
+			&snapshot.CreatedAt,
+		); err != nil {
+			log.Error("Could not list device driver snapshots: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		snapshot.DeviceSingletonsJSON = make(map[string]string)
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// Returns a snapshot including its code and singletons
+func GetDeviceDriverSnapshot(id uint) (snapshot DeviceDriverSnapshot, found bool, err error) {
+	query, err := db.Prepare(`
+	SELECT
+		Id,
+		VendorId,
+		ModelId,
+		Version,
+		HomescriptCode,
+		CreatedAt,
+		DriverSingletonJson,
+		DeviceSingletonsJson
+	FROM deviceDriverSnapshot
+	WHERE Id=?
+	`)
+	if err != nil {
+		log.Error("Could not get device driver snapshot: Preparing query failed: ", err.Error())
+		return DeviceDriverSnapshot{}, false, err
+	}
+	defer query.Close()
+
+	var devices string
+	if err := query.QueryRow(id).Scan(
+		&snapshot.Id,
+		&snapshot.VendorID,
+		&snapshot.ModelID,
+		&snapshot.Version,
+		&snapshot.HomescriptCode,
+		&snapshot.CreatedAt,
+		&snapshot.DriverSingletonJSON,
+		&devices,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return DeviceDriverSnapshot{}, false, nil
+		}
+		log.Error("Could not get device driver snapshot: Executing query failed: ", err.Error())
+		return DeviceDriverSnapshot{}, false, err
+	}
+
+	if err := json.Unmarshal([]byte(devices), &snapshot.DeviceSingletonsJSON); err != nil {
+		log.Error("Could not get device driver snapshot: Decoding device singletons failed: ", err.Error())
+		return DeviceDriverSnapshot{}, false, err
+	}
+
+	return snapshot, true, nil
+}
+
+// Deletes all snapshots of a driver, used when deleting a driver
+func DeleteDeviceDriverSnapshots(vendorId string, modelId string) error {
+	query, err := db.Prepare(`
+	DELETE FROM deviceDriverSnapshot
+	WHERE VendorId=? AND ModelId=?
+	`)
+	if err != nil {
+		log.Error("Could not delete device driver snapshots: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(vendorId, modelId); err != nil {
+		log.Error("Could not delete device driver snapshots: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateDeviceDriverSnapshotTable(t *testing.T) {
+	assert.NoError(t, createDeviceDriverSnapshotTable())
+}
+
+func TestDeviceDriverSnapshots(t *testing.T) {
+	snapshot := DeviceDriverSnapshot{
+		VendorID:             "snapshot_vendor",
+		ModelID:              "snapshot_model",
+		Version:              "1.0.0",
+		HomescriptCode:       "fn main() {}",
+		DriverSingletonJSON:  `{"url":"http://plug"}`,
+		DeviceSingletonsJSON: map[string]string{"plug": `{"relay":1}`},
+	}
+
+	id, err := InsertDeviceDriverSnapshot(snapshot)
+	assert.NoError(t, err)
+
+	fetched, found, err := GetDeviceDriverSnapshot(id)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, snapshot.HomescriptCode, fetched.HomescriptCode)
+	assert.Equal(t, snapshot.DriverSingletonJSON, fetched.DriverSingletonJSON)
+	assert.Equal(t, snapshot.DeviceSingletonsJSON, fetched.DeviceSingletonsJSON)
+
+	// Only the newest snapshots are kept
+	for i := 0; i < DeviceDriverSnapshotsPerDriver; i++ {
+		_, err := InsertDeviceDriverSnapshot(snapshot)
+		assert.NoError(t, err)
+	}
+	snapshots, err := ListDeviceDriverSnapshots("snapshot_vendor", "snapshot_model")
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, DeviceDriverSnapshotsPerDriver)
+	_, found, err = GetDeviceDriverSnapshot(id)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, DeleteDeviceDriverSnapshots("snapshot_vendor", "snapshot_model"))
+	snapshots, err = ListDeviceDriverSnapshots("snapshot_vendor", "snapshot_model")
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+}
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Controls how the functions of a device driver are invoked
+// Drivers without a stored policy use `DefaultDeviceDriverInvocationPolicy`
+type DeviceDriverInvocationPolicy struct {
+	VendorID string `json:"vendorId"`
+	ModelID  string `json:"modelId"`
+	// How long a single invocation may run, can be overridden for each device
+	TimeoutMillis uint `json:"timeoutMillis"`
+	// How often failed invocations of idempotent report functions are retried
+	Retries uint `json:"retries"`
+	// After this many consecutive failures, the circuit breaker of a device opens
+	BreakerThreshold uint `json:"breakerThreshold"`
+	// How long an open circuit breaker skips its device
+	BreakerBackoffSeconds uint `json:"breakerBackoffSeconds"`
+}
+
+func DefaultDeviceDriverInvocationPolicy(vendorId string, modelId string) DeviceDriverInvocationPolicy {
+	return DeviceDriverInvocationPolicy{
+		VendorID:              vendorId,
+		ModelID:               modelId,
+		TimeoutMillis:         10_000,
+		Retries:               0,
+		BreakerThreshold:      3,
+		BreakerBackoffSeconds: 30,
+	}
+}
+
+// Creates the tables containing the invocation policies of drivers and the timeout overrides of devices
+// If the database fails, this function returns an error
+func createDeviceInvocationPolicyTables() error {
+	if _, err := db.Exec(fmt.Sprintf(`
+	CREATE TABLE
+	IF NOT EXISTS
+	deviceDriverInvocationPolicy(
+		VendorId				VARCHAR(%d),
+		ModelId					VARCHAR(%d),
+		TimeoutMillis			INT UNSIGNED NOT NULL,
+		Retries					INT UNSIGNED NOT NULL,
+		BreakerThreshold		INT UNSIGNED NOT NULL,
+		BreakerBackoffSeconds	INT UNSIGNED NOT NULL,
+		PRIMARY KEY (VendorId, ModelId)
+	)
+	`,
+		DEVICE_DRIVER_MODVEN_ID_LEN,
+		DEVICE_DRIVER_MODVEN_ID_LEN,
+	)); err != nil {
+		log.Error("Failed to create device driver invocation policy table: Executing query failed: ", err.Error())
+		return err
+	}
+
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	deviceInvocationTimeout(
+		DeviceId		VARCHAR(20),
+		TimeoutMillis	INT UNSIGNED NOT NULL,
+		PRIMARY KEY (DeviceId)
+	)
+	`); err != nil {
+		log.Error("Failed to create device invocation timeout table: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Creates or replaces the invocation policy of a device driver
+func SetDeviceDriverInvocationPolicy(policy DeviceDriverInvocationPolicy) error {
+	query, err := db.Prepare(`
+	INSERT INTO
+	deviceDriverInvocationPolicy(
+		VendorId,
+		ModelId,
+		TimeoutMillis,
+		Retries,
+		BreakerThreshold,
+		BreakerBackoffSeconds
+	)
+	VALUES(?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY
+	UPDATE
+		TimeoutMillis=VALUES(TimeoutMillis),
+		Retries=VALUES(Retries),
+		BreakerThreshold=VALUES(BreakerThreshold),
+		BreakerBackoffSeconds=VALUES(BreakerBackoffSeconds)
+	`)
+	if err != nil {
+		log.Error("Could not set device driver invocation policy: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(
+		policy.VendorID,
+		policy.ModelID,
+		policy.TimeoutMillis,
+		policy.Retries,
+		policy.BreakerThreshold,
+		policy.BreakerBackoffSeconds,
+	); err != nil {
+		log.Error("Could not set device driver invocation policy: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the invocation policy of a device driver
+// If the driver has no stored policy, the default policy is returned
+func GetDeviceDriverInvocationPolicy(vendorId string, modelId string) (DeviceDriverInvocationPolicy, error) {
+	query, err := db.Prepare(`
+	SELECT
+		TimeoutMillis,
+		Retries,
+		BreakerThreshold,
+		BreakerBackoffSeconds
+	FROM deviceDriverInvocationPolicy
+	WHERE VendorId=? AND ModelId=?
+	`)
+	if err != nil {
+		log.Error("Could not get device driver invocation policy: Preparing query failed: ", err.Error())
+		return DeviceDriverInvocationPolicy{}, err
+	}
+	defer query.Close()
+
+	policy := DefaultDeviceDriverInvocationPolicy(vendorId, modelId)
+	if err := query.QueryRow(vendorId, modelId).Scan(
+		&policy.TimeoutMillis,
+		&policy.Retries,
+		&policy.BreakerThreshold,
+		&policy.BreakerBackoffSeconds,
+	); err != nil && err != sql.ErrNoRows {
+		log.Error("Could not get device driver invocation policy: Executing query failed: ", err.Error())
+		return DeviceDriverInvocationPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+// Deletes the invocation policy of a device driver, used when deleting a driver
+func DeleteDeviceDriverInvocationPolicy(vendorId string, modelId string) error {
+	query, err := db.Prepare(`
+	DELETE FROM deviceDriverInvocationPolicy
+	WHERE VendorId=? AND ModelId=?
+	`)
+	if err != nil {
+		log.Error("Could not delete device driver invocation policy: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(vendorId, modelId); err != nil {
+		log.Error("Could not delete device driver invocation policy: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Overrides the invocation timeout of the driver for a single device
+// If `timeoutMillis` is `nil`, the override is removed
+func SetDeviceInvocationTimeout(deviceId string, timeoutMillis *uint) error {
+	if timeoutMillis == nil {
+		query, err := db.Prepare(`
+		DELETE FROM deviceInvocationTimeout
+		WHERE DeviceId=?
+		`)
+		if err != nil {
+			log.Error("Could not delete device invocation timeout: Preparing query failed: ", err.Error())
+			return err
+		}
+		defer query.Close()
+
+		if _, err := query.Exec(deviceId); err != nil {
+			log.Error("Could not delete device invocation timeout: Executing query failed: ", err.Error())
+			return err
+		}
+
+		return nil
+	}
+
+	query, err := db.Prepare(`
+	INSERT INTO
+	deviceInvocationTimeout(
+		DeviceId,
+		TimeoutMillis
+	)
+	VALUES(?, ?)
+	ON DUPLICATE KEY
+	UPDATE
+		TimeoutMillis=VALUES(TimeoutMillis)
+	`)
+	if err != nil {
+		log.Error("Could not set device invocation timeout: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(deviceId, *timeoutMillis); err != nil {
+		log.Error("Could not set device invocation timeout: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the timeout override of a device, `nil` if the device uses the timeout of its driver
+func GetDeviceInvocationTimeout(deviceId string) (*uint, error) {
+	query, err := db.Prepare(`
+	SELECT
+		TimeoutMillis
+	FROM deviceInvocationTimeout
+	WHERE DeviceId=?
+	`)
+	if err != nil {
+		log.Error("Could not get device invocation timeout: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	var timeoutMillis uint
+	if err := query.QueryRow(deviceId).Scan(&timeoutMillis); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Error("Could not get device invocation timeout: Executing query failed: ", err.Error())
+		return nil, err
+	}
+
+	return &timeoutMillis, nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateDeviceInvocationPolicyTables(t *testing.T) {
+	assert.NoError(t, createDeviceInvocationPolicyTables())
+}
+
+func TestDeviceDriverInvocationPolicy(t *testing.T) {
+	// Drivers without a stored policy use the default policy
+	policy, err := GetDeviceDriverInvocationPolicy("policy_vendor", "policy_model")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDeviceDriverInvocationPolicy("policy_vendor", "policy_model"), policy)
+
+	expected := DeviceDriverInvocationPolicy{
+		VendorID:              "policy_vendor",
+		ModelID:               "policy_model",
+		TimeoutMillis:         2_500,
+		Retries:               2,
+		BreakerThreshold:      5,
+		BreakerBackoffSeconds: 120,
+	}
+	assert.NoError(t, SetDeviceDriverInvocationPolicy(expected))
+	policy, err = GetDeviceDriverInvocationPolicy("policy_vendor", "policy_model")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, policy)
+
+	expected.Retries = 0
+	assert.NoError(t, SetDeviceDriverInvocationPolicy(expected))
+	policy, err = GetDeviceDriverInvocationPolicy("policy_vendor", "policy_model")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, policy)
+
+	assert.NoError(t, DeleteDeviceDriverInvocationPolicy("policy_vendor", "policy_model"))
+	policy, err = GetDeviceDriverInvocationPolicy("policy_vendor", "policy_model")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDeviceDriverInvocationPolicy("policy_vendor", "policy_model"), policy)
+}
+
+func TestDeviceInvocationTimeout(t *testing.T) {
+	timeout, err := GetDeviceInvocationTimeout("timeout_dev")
+	assert.NoError(t, err)
+	assert.Nil(t, timeout)
+
+	expected := uint(1_500)
+	assert.NoError(t, SetDeviceInvocationTimeout("timeout_dev", &expected))
+	timeout, err = GetDeviceInvocationTimeout("timeout_dev")
+	assert.NoError(t, err)
+	assert.Equal(t, &expected, timeout)
+
+	assert.NoError(t, SetDeviceInvocationTimeout("timeout_dev", nil))
+	timeout, err = GetDeviceInvocationTimeout("timeout_dev")
+	assert.NoError(t, err)
+	assert.Nil(t, timeout)
+}
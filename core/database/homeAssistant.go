@@ -0,0 +1,102 @@
+package database
+
+// Controls the export of devices to Home Assistant using its MQTT discovery protocol
+type HomeAssistantConfig struct {
+	Enabled bool `json:"enabled"`
+	// The topic prefix which Home Assistant uses for discovery messages, `homeassistant` by default
+	DiscoveryPrefix string `json:"discoveryPrefix"`
+	// The state and command topics of every device are located below this prefix
+	BaseTopic string `json:"baseTopic"`
+	// Commands from Home Assistant are executed as this user, only the devices of this user are exported
+	// The exporter cannot be enabled without a service user
+	ServiceUsername *string `json:"serviceUsername"`
+	// How often the state of every device is checked for changes
+	PollIntervalSeconds uint `json:"pollIntervalSeconds"`
+}
+
+// Creates the table containing the configuration of the Home Assistant exporter
+// If no configuration exists, a disabled default configuration is inserted
+func createHomeAssistantConfigTable() error {
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	homeAssistantConfig(
+		Id					INT PRIMARY KEY,
+		Enabled				BOOLEAN NOT NULL DEFAULT FALSE,
+		DiscoveryPrefix		VARCHAR(100) NOT NULL DEFAULT 'homeassistant',
+		BaseTopic			VARCHAR(100) NOT NULL DEFAULT 'smarthome',
+		ServiceUsername		VARCHAR(20) NULL,
+		PollIntervalSeconds	INT UNSIGNED NOT NULL DEFAULT 10
+	)
+	`); err != nil {
+		log.Error("Failed to create Home Assistant config table: Executing query failed: ", err.Error())
+		return err
+	}
+
+	if _, err := db.Exec(`
+	INSERT IGNORE INTO
+	homeAssistantConfig(Id)
+	VALUES(0)
+	`); err != nil {
+		log.Error("Failed to create Home Assistant config: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the configuration of the Home Assistant exporter
+func GetHomeAssistantConfig() (HomeAssistantConfig, error) {
+	var config HomeAssistantConfig
+	if err := db.QueryRow(`
+	SELECT
+		Enabled,
+		DiscoveryPrefix,
+		BaseTopic,
+		ServiceUsername,
+		PollIntervalSeconds
+	FROM homeAssistantConfig
+	WHERE Id=0
+	`).Scan(
+		&config.Enabled,
+		&config.DiscoveryPrefix,
+		&config.BaseTopic,
+		&config.ServiceUsername,
+		&config.PollIntervalSeconds,
+	); err != nil {
+		log.Error("Could not get Home Assistant config: Executing query failed: ", err.Error())
+		return HomeAssistantConfig{}, err
+	}
+	return config, nil
+}
+
+// Updates the configuration of the Home Assistant exporter
+func SetHomeAssistantConfig(config HomeAssistantConfig) error {
+	query, err := db.Prepare(`
+	UPDATE homeAssistantConfig
+	SET
+		Enabled=?,
+		DiscoveryPrefix=?,
+		BaseTopic=?,
+		ServiceUsername=?,
+		PollIntervalSeconds=?
+	WHERE Id=0
+	`)
+	if err != nil {
+		log.Error("Could not set Home Assistant config: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(
+		config.Enabled,
+		config.DiscoveryPrefix,
+		config.BaseTopic,
+		config.ServiceUsername,
+		config.PollIntervalSeconds,
+	); err != nil {
+		log.Error("Could not set Home Assistant config: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateHomeAssistantConfigTable(t *testing.T) {
+	assert.NoError(t, createHomeAssistantConfigTable())
+}
+
+func TestHomeAssistantConfig(t *testing.T) {
+	username := "admin"
+
+	table := []HomeAssistantConfig{
+		{
+			Enabled:             true,
+			DiscoveryPrefix:     "homeassistant",
+			BaseTopic:           "smarthome",
+			ServiceUsername:     &username,
+			PollIntervalSeconds: 5,
+		},
+		{
+			Enabled:             false,
+			DiscoveryPrefix:     "ha/discovery",
+			BaseTopic:           "home/devices",
+			ServiceUsername:     nil,
+			PollIntervalSeconds: 60,
+		},
+	}
+
+	for _, test := range table {
+		assert.NoError(t, SetHomeAssistantConfig(test))
+
+		stored, err := GetHomeAssistantConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, test, stored)
+	}
+}
@@ -110,6 +110,7 @@ func CreateNewHomescript(homescript Homescript) error {
 		log.Error("Failed to create new Homescript: executing query failed: ", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
 
@@ -154,6 +155,7 @@ func ModifyHomescriptById(id string, owner string, newData HomescriptData) error
 		log.Error("Failed to update Homescript: executing query failed: ", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
 
@@ -180,6 +182,7 @@ func ModifyHomescriptCode(id string, owner string, newCode string) error {
 		log.Error("Failed to update Homescript code: executing query failed: ", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
 
@@ -383,6 +386,16 @@ func DeleteHomescriptById(homescriptId string, owner string) error {
 	if err := DeleteAllHomescriptArgsFromScript(homescriptId); err != nil {
 		return err
 	}
+	if err := DeleteHomescriptWebhooksOfScript(homescriptId, owner); err != nil {
+		return err
+	}
+	if err := DeleteHomescriptLibrariesOfScript(homescriptId, owner); err != nil {
+		return err
+	}
+	// The default storage namespace of a script is its ID
+	if err := DeleteHomescriptStorageNamespace(owner, homescriptId); err != nil {
+		return err
+	}
 	query, err := db.Prepare(`
 	DELETE FROM
 	homescript
@@ -397,6 +410,7 @@ func DeleteHomescriptById(homescriptId string, owner string) error {
 		log.Error("Failed to delete Homescript by id: executing query failed: ", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
 
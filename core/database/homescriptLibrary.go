@@ -0,0 +1,576 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// A Homescript which is shared with other users so that they can import it by its name
+type HomescriptLibrary struct {
+	// The name under which the library is imported, it is unique across all users
+	Name         string `json:"name"`
+	Owner        string `json:"owner"`
+	HomescriptId string `json:"homescriptId"`
+	Description  string `json:"description"`
+	// The most recently published version, `0` if no version has been published yet
+	LatestVersion uint `json:"latestVersion"`
+}
+
+// Controls who is allowed to import a library
+// The owner of the library can always import it
+type HomescriptLibraryAccess struct {
+	Users []string `json:"users"`
+	// Every user who has one of these permissions can import the library
+	Permissions []PermissionType `json:"permissions"`
+}
+
+// An immutable snapshot of a library, dependents always import the latest version
+type HomescriptLibraryVersion struct {
+	LibraryName string    `json:"libraryName"`
+	Version     uint      `json:"version"`
+	Code        string    `json:"code"`
+	PublishedAt time.Time `json:"publishedAt"`
+	// JSON-encoded list of the public declarations of this version
+	Exports json.RawMessage `json:"exports"`
+	// JSON-encoded result of re-linting every dependent after this version was published
+	Report json.RawMessage `json:"report"`
+}
+
+// Creates the tables containing libraries, their versions and who is allowed to import them
+// If the database fails, this function returns an error
+func createHomescriptLibraryTables() error {
+	queries := []string{
+		fmt.Sprintf(`
+		CREATE TABLE
+		IF NOT EXISTS
+		homescriptLibrary(
+			Name			VARCHAR(30),
+			Owner			VARCHAR(20),
+			HomescriptId	VARCHAR(%d),
+			Description		TEXT,
+			LatestVersion	INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (Name),
+			FOREIGN KEY (HomescriptId, Owner)
+			REFERENCES homescript(Id, Owner)
+		)
+		`, HOMESCRIPT_ID_LEN),
+		`
+		CREATE TABLE
+		IF NOT EXISTS
+		homescriptLibraryVersion(
+			LibraryName		VARCHAR(30),
+			Version			INT NOT NULL,
+			Code			MEDIUMTEXT,
+			PublishedAt		DATETIME(3) NOT NULL,
+			Exports			JSON NOT NULL,
+			Report			JSON NULL,
+			PRIMARY KEY (LibraryName, Version),
+			FOREIGN KEY (LibraryName)
+			REFERENCES homescriptLibrary(Name)
+		)
+		`,
+		`
+		CREATE TABLE
+		IF NOT EXISTS
+		homescriptLibraryAccess(
+			LibraryName		VARCHAR(30),
+			Username		VARCHAR(20) NULL,
+			Permission		VARCHAR(30) NULL,
+			FOREIGN KEY (LibraryName)
+			REFERENCES homescriptLibrary(Name)
+		)
+		`,
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			log.Error("Failed to create Homescript library tables: Executing query failed: ", err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates a new library without any published version
+func CreateHomescriptLibrary(library HomescriptLibrary) error {
+	query, err := db.Prepare(`
+	INSERT INTO
+	homescriptLibrary(
+		Name,
+		Owner,
+		HomescriptId,
+		Description,
+		LatestVersion
+	)
+	VALUES(?, ?, ?, ?, 0)
+	`)
+	if err != nil {
+		log.Error("Could not create Homescript library: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(
+		library.Name,
+		library.Owner,
+		library.HomescriptId,
+		library.Description,
+	); err != nil {
+		log.Error("Could not create Homescript library: Executing query failed: ", err.Error())
+		return err
+	}
+
+	dependenciesChanged()
+	return nil
+}
+
+// Returns a library given its name
+func GetHomescriptLibrary(name string) (HomescriptLibrary, bool, error) {
+	query, err := db.Prepare(`
+	SELECT
+		Name,
+		Owner,
+		HomescriptId,
+		Description,
+		LatestVersion
+	FROM homescriptLibrary
+	WHERE Name=?
+	`)
+	if err != nil {
+		log.Error("Could not get Homescript library: Preparing query failed: ", err.Error())
+		return HomescriptLibrary{}, false, err
+	}
+	defer query.Close()
+
+	var library HomescriptLibrary
+	if err := query.QueryRow(name).Scan(
+		&library.Name,
+		&library.Owner,
+		&library.HomescriptId,
+		&library.Description,
+		&library.LatestVersion,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return HomescriptLibrary{}, false, nil
+		}
+		log.Error("Could not get Homescript library: Executing query failed: ", err.Error())
+		return HomescriptLibrary{}, false, err
+	}
+
+	return library, true, nil
+}
+
+// Returns a list of all libraries
+func ListHomescriptLibraries() ([]HomescriptLibrary, error) {
+	res, err := db.Query(`
+	SELECT
+		Name,
+		Owner,
+		HomescriptId,
+		Description,
+		LatestVersion
+	FROM homescriptLibrary
+	ORDER BY Name
+	`)
+	if err != nil {
+		log.Error("Could not list Homescript libraries: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	libraries := make([]HomescriptLibrary, 0)
+	for res.Next() {
+		var library HomescriptLibrary
+		if err := res.Scan(
+			&library.Name,
+			&library.Owner,
+			&library.HomescriptId,
+			&library.Description,
+			&library.LatestVersion,
+		); err != nil {
+			log.Error("Could not list Homescript libraries: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		libraries = append(libraries, library)
+	}
+
+	return libraries, nil
+}
+
+// Returns the users and permissions which are allowed to import a library
+func GetHomescriptLibraryAccess(name string) (HomescriptLibraryAccess, error) {
+	query, err := db.Prepare(`
+	SELECT
+		Username,
+		Permission
+	FROM homescriptLibraryAccess
+	WHERE LibraryName=?
+	`)
+	if err != nil {
+		log.Error("Could not get Homescript library access: Preparing query failed: ", err.Error())
+		return HomescriptLibraryAccess{}, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(name)
+	if err != nil {
+		log.Error("Could not get Homescript library access: Executing query failed: ", err.Error())
+		return HomescriptLibraryAccess{}, err
+	}
+	defer res.Close()
+
+	access := HomescriptLibraryAccess{
+		Users:       make([]string, 0),
+		Permissions: make([]PermissionType, 0),
+	}
+	for res.Next() {
+		var username, permission sql.NullString
+		if err := res.Scan(&username, &permission); err != nil {
+			log.Error("Could not get Homescript library access: Scanning results failed: ", err.Error())
+			return HomescriptLibraryAccess{}, err
+		}
+		if username.Valid {
+			access.Users = append(access.Users, username.String)
+		}
+		if permission.Valid {
+			access.Permissions = append(access.Permissions, PermissionType(permission.String))
+		}
+	}
+
+	return access, nil
+}
+
+// Replaces the users and permissions which are allowed to import a library
+func SetHomescriptLibraryAccess(name string, access HomescriptLibraryAccess) error {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error("Could not set Homescript library access: Starting transaction failed: ", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+	DELETE FROM homescriptLibraryAccess
+	WHERE LibraryName=?
+	`, name); err != nil {
+		log.Error("Could not set Homescript library access: Deleting previous access failed: ", err.Error())
+		return err
+	}
+
+	for _, username := range access.Users {
+		if _, err := tx.Exec(`
+		INSERT INTO homescriptLibraryAccess(LibraryName, Username, Permission)
+		VALUES(?, ?, NULL)
+		`, name, username); err != nil {
+			log.Error("Could not set Homescript library access: Inserting user failed: ", err.Error())
+			return err
+		}
+	}
+
+	for _, permission := range access.Permissions {
+		if _, err := tx.Exec(`
+		INSERT INTO homescriptLibraryAccess(LibraryName, Username, Permission)
+		VALUES(?, NULL, ?)
+		`, name, permission); err != nil {
+			log.Error("Could not set Homescript library access: Inserting permission failed: ", err.Error())
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("Could not set Homescript library access: Committing transaction failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Stores a new version of a library and marks it as the latest version
+func InsertHomescriptLibraryVersion(version HomescriptLibraryVersion) error {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error("Could not insert Homescript library version: Starting transaction failed: ", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+	INSERT INTO
+	homescriptLibraryVersion(
+		LibraryName,
+		Version,
+		Code,
+		PublishedAt,
+		Exports,
+		Report
+	)
+	VALUES(?, ?, ?, ?, ?, NULL)
+	`,
+		version.LibraryName,
+		version.Version,
+		version.Code,
+		version.PublishedAt,
+		string(version.Exports),
+	); err != nil {
+		log.Error("Could not insert Homescript library version: Executing query failed: ", err.Error())
+		return err
+	}
+
+	if _, err := tx.Exec(`
+	UPDATE homescriptLibrary
+	SET LatestVersion=?
+	WHERE Name=?
+	`, version.Version, version.LibraryName); err != nil {
+		log.Error("Could not insert Homescript library version: Updating latest version failed: ", err.Error())
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("Could not insert Homescript library version: Committing transaction failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Stores the dependent report of a library version
+func SetHomescriptLibraryVersionReport(name string, version uint, report json.RawMessage) error {
+	query, err := db.Prepare(`
+	UPDATE homescriptLibraryVersion
+	SET Report=?
+	WHERE LibraryName=? AND Version=?
+	`)
+	if err != nil {
+		log.Error("Could not set Homescript library report: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(string(report), name, version); err != nil {
+		log.Error("Could not set Homescript library report: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func scanHomescriptLibraryVersion(scanner interface{ Scan(...any) error }) (HomescriptLibraryVersion, error) {
+	var version HomescriptLibraryVersion
+	var exports string
+	var report sql.NullString
+
+	if err := scanner.Scan(
+		&version.LibraryName,
+		&version.Version,
+		&version.Code,
+		&version.PublishedAt,
+		&exports,
+		&report,
+	); err != nil {
+		return HomescriptLibraryVersion{}, err
+	}
+
+	version.Exports = json.RawMessage(exports)
+	version.Report = json.RawMessage("null")
+	if report.Valid {
+		version.Report = json.RawMessage(report.String)
+	}
+
+	return version, nil
+}
+
+// Returns a specific version of a library
+func GetHomescriptLibraryVersion(name string, version uint) (HomescriptLibraryVersion, bool, error) {
+	query, err := db.Prepare(`
+	SELECT
+		LibraryName,
+		Version,
+		Code,
+		PublishedAt,
+		Exports,
+		Report
+	FROM homescriptLibraryVersion
+	WHERE LibraryName=? AND Version=?
+	`)
+	if err != nil {
+		log.Error("Could not get Homescript library version: Preparing query failed: ", err.Error())
+		return HomescriptLibraryVersion{}, false, err
+	}
+	defer query.Close()
+
+	result, err := scanHomescriptLibraryVersion(query.QueryRow(name, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return HomescriptLibraryVersion{}, false, nil
+		}
+		log.Error("Could not get Homescript library version: Executing query failed: ", err.Error())
+		return HomescriptLibraryVersion{}, false, err
+	}
+
+	return result, true, nil
+}
+
+// Returns all versions of a library, the most recent version comes first
+func ListHomescriptLibraryVersions(name string) ([]HomescriptLibraryVersion, error) {
+	query, err := db.Prepare(`
+	SELECT
+		LibraryName,
+		Version,
+		Code,
+		PublishedAt,
+		Exports,
+		Report
+	FROM homescriptLibraryVersion
+	WHERE LibraryName=?
+	ORDER BY Version DESC
+	`)
+	if err != nil {
+		log.Error("Could not list Homescript library versions: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(name)
+	if err != nil {
+		log.Error("Could not list Homescript library versions: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	versions := make([]HomescriptLibraryVersion, 0)
+	for res.Next() {
+		version, err := scanHomescriptLibraryVersion(res)
+		if err != nil {
+			log.Error("Could not list Homescript library versions: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// Deletes a library including all of its versions
+func DeleteHomescriptLibrary(name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error("Could not delete Homescript library: Starting transaction failed: ", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM homescriptLibraryAccess WHERE LibraryName=?",
+		"DELETE FROM homescriptLibraryVersion WHERE LibraryName=?",
+		"DELETE FROM homescriptLibrary WHERE Name=?",
+	} {
+		if _, err := tx.Exec(query, name); err != nil {
+			log.Error("Could not delete Homescript library: Executing query failed: ", err.Error())
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("Could not delete Homescript library: Committing transaction failed: ", err.Error())
+		return err
+	}
+
+	dependenciesChanged()
+	return nil
+}
+
+// Deletes all libraries which are backed by the given Homescript
+func DeleteHomescriptLibrariesOfScript(homescriptId string, owner string) error {
+	libraries, err := ListHomescriptLibraries()
+	if err != nil {
+		return err
+	}
+	for _, library := range libraries {
+		if library.HomescriptId != homescriptId || library.Owner != owner {
+			continue
+		}
+		if err := DeleteHomescriptLibrary(library.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the access of a user to all libraries
+// The libraries owned by the user are deleted together with the user's Homescripts
+func DeleteHomescriptLibraryAccessOfUser(username string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptLibraryAccess
+	WHERE Username=?
+	`)
+	if err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript library access of user `%s`: Preparing query failed: %s", username, err.Error()))
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(username); err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript library access of user `%s`: Executing query failed: %s", username, err.Error()))
+		return err
+	}
+
+	return nil
+}
+
+// Reports whether a user is allowed to import the given library
+// Access is granted to the owner, to every user who was explicitly added and to every user who has one of the listed permissions
+func UserCanImportHomescriptLibrary(library HomescriptLibrary, username string) (bool, error) {
+	if library.Owner == username {
+		return true, nil
+	}
+
+	access, err := GetHomescriptLibraryAccess(library.Name)
+	if err != nil {
+		return false, err
+	}
+
+	for _, user := range access.Users {
+		if user == username {
+			return true, nil
+		}
+	}
+
+	for _, permission := range access.Permissions {
+		hasPermission, err := UserHasPermission(username, permission)
+		if err != nil {
+			return false, err
+		}
+		if hasPermission {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Returns the code of the latest version of a library if the user is allowed to import it
+// Imports only name the library, so there is no way to pin a version: dependents always resolve to the latest one
+// Libraries which the user cannot access or which have no published version are reported as not found
+func ResolveHomescriptLibraryCode(name string, username string) (code string, found bool, err error) {
+	library, found, err := GetHomescriptLibrary(name)
+	if err != nil || !found {
+		return "", false, err
+	}
+
+	if library.LatestVersion == 0 {
+		return "", false, nil
+	}
+
+	canImport, err := UserCanImportHomescriptLibrary(library, username)
+	if err != nil || !canImport {
+		return "", false, err
+	}
+
+	version, found, err := GetHomescriptLibraryVersion(name, library.LatestVersion)
+	if err != nil || !found {
+		return "", false, err
+	}
+
+	return version.Code, true, nil
+}
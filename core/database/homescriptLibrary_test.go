@@ -0,0 +1,95 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateHomescriptLibraryTables(t *testing.T) {
+	assert.NoError(t, createHomescriptLibraryTables())
+}
+
+func TestHomescriptLibraries(t *testing.T) {
+	assert.NoError(t, CreateNewHomescript(Homescript{
+		Owner: "admin",
+		Data: HomescriptData{
+			Id:   "library_test",
+			Name: "Library Test",
+		},
+	}))
+
+	library := HomescriptLibrary{
+		Name:          "shared_utils",
+		Owner:         "admin",
+		HomescriptId:  "library_test",
+		Description:   "Helpers used by the whole family",
+		LatestVersion: 0,
+	}
+	assert.NoError(t, CreateHomescriptLibrary(library))
+
+	stored, found, err := GetHomescriptLibrary(library.Name)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, library, stored)
+
+	// Libraries without a published version cannot be imported
+	_, found, err = ResolveHomescriptLibraryCode(library.Name, "admin")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	for version := uint(1); version <= 2; version++ {
+		assert.NoError(t, InsertHomescriptLibraryVersion(HomescriptLibraryVersion{
+			LibraryName: library.Name,
+			Version:     version,
+			Code:        fmt.Sprintf("pub fn helper() -> int { %d }", version),
+			PublishedAt: time.Now(),
+			Exports:     json.RawMessage("[]"),
+		}))
+	}
+	assert.NoError(t, SetHomescriptLibraryVersionReport(library.Name, 2, json.RawMessage(`{"dependents":[]}`)))
+
+	versions, err := ListHomescriptLibraryVersions(library.Name)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+	assert.Equal(t, uint(2), versions[0].Version)
+	assert.JSONEq(t, `{"dependents":[]}`, string(versions[0].Report))
+	assert.Equal(t, "null", string(versions[1].Report))
+
+	stored, _, err = GetHomescriptLibrary(library.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), stored.LatestVersion)
+
+	// The owner can always import the library, imports resolve to the latest version
+	code, found, err := ResolveHomescriptLibraryCode(library.Name, "admin")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "pub fn helper() -> int { 2 }", code)
+
+	// Other users require explicit access
+	_, found, err = ResolveHomescriptLibraryCode(library.Name, "library_user")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	access := HomescriptLibraryAccess{
+		Users:       []string{"library_user"},
+		Permissions: []PermissionType{PermissionHomescript},
+	}
+	assert.NoError(t, SetHomescriptLibraryAccess(library.Name, access))
+	storedAccess, err := GetHomescriptLibraryAccess(library.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, access, storedAccess)
+
+	canImport, err := UserCanImportHomescriptLibrary(stored, "library_user")
+	assert.NoError(t, err)
+	assert.True(t, canImport)
+
+	// Deleting the Homescript must also delete its libraries
+	assert.NoError(t, DeleteHomescriptById("library_test", "admin"))
+	_, found, err = GetHomescriptLibrary(library.Name)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
@@ -0,0 +1,176 @@
+package database
+
+import "fmt"
+
+// Homescripts may only open sockets to hosts on an allowlist.
+// User programs use the allowlist of their user, drivers use the allowlist of their driver.
+// Entries are validated and normalized by `stdlib.NormalizeHostPattern`.
+
+// Creates the table containing the network host allowlists of users
+func createHomescriptNetworkHostTable() error {
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	homescriptNetworkHost(
+		Username	VARCHAR(20),
+		Host		VARCHAR(255),
+		PRIMARY KEY (Username, Host),
+		FOREIGN KEY (Username)
+		REFERENCES user(Username)
+	)
+	`); err != nil {
+		log.Error("Failed to create Homescript network host table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Creates the table containing the network host allowlists of device drivers
+func createDeviceDriverNetworkHostTable() error {
+	if _, err := db.Exec(fmt.Sprintf(`
+	CREATE TABLE
+	IF NOT EXISTS
+	deviceDriverNetworkHost(
+		VendorId	VARCHAR(%d),
+		ModelId		VARCHAR(%d),
+		Host		VARCHAR(255),
+		PRIMARY KEY (VendorId, ModelId, Host)
+	)
+	`,
+		DEVICE_DRIVER_MODVEN_ID_LEN,
+		DEVICE_DRIVER_MODVEN_ID_LEN,
+	)); err != nil {
+		log.Error("Failed to create device driver network host table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+func listNetworkHosts(table string, condition string, args ...any) ([]string, error) {
+	query, err := db.Prepare(fmt.Sprintf(`
+	SELECT Host
+	FROM %s
+	WHERE %s
+	ORDER BY Host ASC
+	`, table, condition))
+	if err != nil {
+		log.Error("Could not list network hosts: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(args...)
+	if err != nil {
+		log.Error("Could not list network hosts: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	hosts := make([]string, 0)
+	for res.Next() {
+		var host string
+		if err := res.Scan(&host); err != nil {
+			log.Error("Could not list network hosts: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		hosts = append(hosts, host)
+	}
+
+	return hosts, nil
+}
+
+func modifyNetworkHosts(action string, queryStr string, args ...any) (modified bool, err error) {
+	query, err := db.Prepare(queryStr)
+	if err != nil {
+		log.Error(fmt.Sprintf("Could not %s network host: Preparing query failed: %s", action, err.Error()))
+		return false, err
+	}
+	defer query.Close()
+
+	res, err := query.Exec(args...)
+	if err != nil {
+		log.Error(fmt.Sprintf("Could not %s network host: Executing query failed: %s", action, err.Error()))
+		return false, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		log.Error(fmt.Sprintf("Could not %s network host: Retrieving rows affected count failed: %s", action, err.Error()))
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Returns the network host allowlist of a user
+func ListUserNetworkHosts(username string) ([]string, error) {
+	return listNetworkHosts("homescriptNetworkHost", "Username=?", username)
+}
+
+// Adds a host pattern to the allowlist of a user
+// Returns `false` if the pattern is already allowed
+func AddUserNetworkHost(username string, host string) (modified bool, err error) {
+	return modifyNetworkHosts("add", `
+	INSERT IGNORE INTO
+	homescriptNetworkHost(
+		Username,
+		Host
+	)
+	VALUES(?, ?)
+	`, username, host)
+}
+
+// Removes a host pattern from the allowlist of a user
+// Returns `false` if the pattern was not allowed
+func RemoveUserNetworkHost(username string, host string) (modified bool, err error) {
+	return modifyNetworkHosts("remove", `
+	DELETE FROM homescriptNetworkHost
+	WHERE Username=? AND Host=?
+	`, username, host)
+}
+
+// Removes all host patterns of a user, used when deleting a user
+func RemoveAllNetworkHostsOfUser(username string) error {
+	_, err := modifyNetworkHosts("remove", `
+	DELETE FROM homescriptNetworkHost
+	WHERE Username=?
+	`, username)
+	return err
+}
+
+// Returns the network host allowlist of a device driver
+func ListDriverNetworkHosts(vendorId string, modelId string) ([]string, error) {
+	return listNetworkHosts("deviceDriverNetworkHost", "VendorId=? AND ModelId=?", vendorId, modelId)
+}
+
+// Adds a host pattern to the allowlist of a device driver
+// Returns `false` if the pattern is already allowed
+func AddDriverNetworkHost(vendorId string, modelId string, host string) (modified bool, err error) {
+	return modifyNetworkHosts("add", `
+	INSERT IGNORE INTO
+	deviceDriverNetworkHost(
+		VendorId,
+		ModelId,
+		Host
+	)
+	VALUES(?, ?, ?)
+	`, vendorId, modelId, host)
+}
+
+// Removes a host pattern from the allowlist of a device driver
+// Returns `false` if the pattern was not allowed
+func RemoveDriverNetworkHost(vendorId string, modelId string, host string) (modified bool, err error) {
+	return modifyNetworkHosts("remove", `
+	DELETE FROM deviceDriverNetworkHost
+	WHERE VendorId=? AND ModelId=? AND Host=?
+	`, vendorId, modelId, host)
+}
+
+// Removes all host patterns of a device driver, used when deleting a driver
+func RemoveAllNetworkHostsOfDriver(vendorId string, modelId string) error {
+	_, err := modifyNetworkHosts("remove", `
+	DELETE FROM deviceDriverNetworkHost
+	WHERE VendorId=? AND ModelId=?
+	`, vendorId, modelId)
+	return err
+}
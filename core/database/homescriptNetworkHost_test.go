@@ -0,0 +1,61 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateNetworkHostTables(t *testing.T) {
+	assert.NoError(t, createHomescriptNetworkHostTable())
+	assert.NoError(t, createDeviceDriverNetworkHostTable())
+}
+
+func TestUserNetworkHosts(t *testing.T) {
+	for _, host := range []string{"receiver.lan", "192.168.1.0/24"} {
+		modified, err := AddUserNetworkHost("admin", host)
+		assert.NoError(t, err)
+		assert.True(t, modified)
+	}
+
+	// Adding a host twice does not modify the allowlist
+	modified, err := AddUserNetworkHost("admin", "receiver.lan")
+	assert.NoError(t, err)
+	assert.False(t, modified)
+
+	hosts, err := ListUserNetworkHosts("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.168.1.0/24", "receiver.lan"}, hosts)
+
+	modified, err = RemoveUserNetworkHost("admin", "receiver.lan")
+	assert.NoError(t, err)
+	assert.True(t, modified)
+
+	modified, err = RemoveUserNetworkHost("admin", "receiver.lan")
+	assert.NoError(t, err)
+	assert.False(t, modified)
+
+	assert.NoError(t, RemoveAllNetworkHostsOfUser("admin"))
+	hosts, err = ListUserNetworkHosts("admin")
+	assert.NoError(t, err)
+	assert.Empty(t, hosts)
+}
+
+func TestDriverNetworkHosts(t *testing.T) {
+	modified, err := AddDriverNetworkHost("vendor", "model", "*.iot.lan")
+	assert.NoError(t, err)
+	assert.True(t, modified)
+
+	hosts, err := ListDriverNetworkHosts("vendor", "model")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*.iot.lan"}, hosts)
+
+	hosts, err = ListDriverNetworkHosts("vendor", "other")
+	assert.NoError(t, err)
+	assert.Empty(t, hosts)
+
+	assert.NoError(t, RemoveAllNetworkHostsOfDriver("vendor", "model"))
+	hosts, err = ListDriverNetworkHosts("vendor", "model")
+	assert.NoError(t, err)
+	assert.Empty(t, hosts)
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type HomescriptQuotaContext string
+
+const (
+	HomescriptQuotaContextUser       HomescriptQuotaContext = "user"
+	HomescriptQuotaContextAutomation HomescriptQuotaContext = "automation"
+	HomescriptQuotaContextDriver     HomescriptQuotaContext = "driver"
+	HomescriptQuotaContextWebhook    HomescriptQuotaContext = "webhook"
+)
+
+// An empty username represents the default quota of a context
+// This default is applied to every user who does not have an individual quota
+const HomescriptQuotaDefaultUsername = ""
+
+type HomescriptQuota struct {
+	Username string                 `json:"username"`
+	Context  HomescriptQuotaContext `json:"context"`
+	Data     HomescriptQuotaData    `json:"data"`
+}
+
+// A value of `0` means that there is no limit
+type HomescriptQuotaData struct {
+	MaxConcurrentJobs uint `json:"maxConcurrentJobs"`
+	MaxRuntimeSeconds uint `json:"maxRuntimeSeconds"`
+	MaxCallStackSize  uint `json:"maxCallStackSize"`
+	MaxStackSize      uint `json:"maxStackSize"`
+	MaxInstructions   uint `json:"maxInstructions"`
+	MaxOutputBytes    uint `json:"maxOutputBytes"`
+}
+
+// Creates the table containing Homescript resource quotas
+// If the database fails, this function returns an error
+func createHomescriptQuotaTable() error {
+	query := `
+	CREATE TABLE
+	IF NOT EXISTS
+	homescriptQuota(
+		Username			VARCHAR(20) NOT NULL DEFAULT '',
+		Context				ENUM('user', 'automation', 'driver', 'webhook'),
+		MaxConcurrentJobs	INT NOT NULL DEFAULT 0,
+		MaxRuntimeSeconds	INT NOT NULL DEFAULT 0,
+		MaxCallStackSize	INT NOT NULL DEFAULT 0,
+		MaxStackSize		INT NOT NULL DEFAULT 0,
+		MaxInstructions		BIGINT NOT NULL DEFAULT 0,
+		MaxOutputBytes		INT NOT NULL DEFAULT 0,
+
+		PRIMARY KEY (Username, Context)
+	)
+	`
+	_, err := db.Exec(query)
+	if err != nil {
+		log.Error("Failed to create Homescript quota table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Creates or updates the quota of a user in a given context
+func SetHomescriptQuota(quota HomescriptQuota) error {
+	query, err := db.Prepare(`
+	INSERT INTO homescriptQuota(
+		Username,
+		Context,
+		MaxConcurrentJobs,
+		MaxRuntimeSeconds,
+		MaxCallStackSize,
+		MaxStackSize,
+		MaxInstructions,
+		MaxOutputBytes
+	)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY
+	UPDATE
+		MaxConcurrentJobs=VALUES(MaxConcurrentJobs),
+		MaxRuntimeSeconds=VALUES(MaxRuntimeSeconds),
+		MaxCallStackSize=VALUES(MaxCallStackSize),
+		MaxStackSize=VALUES(MaxStackSize),
+		MaxInstructions=VALUES(MaxInstructions),
+		MaxOutputBytes=VALUES(MaxOutputBytes)
+	`)
+	if err != nil {
+		log.Error("Could not set Homescript quota: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(
+		quota.Username,
+		quota.Context,
+		quota.Data.MaxConcurrentJobs,
+		quota.Data.MaxRuntimeSeconds,
+		quota.Data.MaxCallStackSize,
+		quota.Data.MaxStackSize,
+		quota.Data.MaxInstructions,
+		quota.Data.MaxOutputBytes,
+	); err != nil {
+		log.Error("Could not set Homescript quota: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the quota of a user in a given context
+// Use `HomescriptQuotaDefaultUsername` in order to retrieve the default quota of a context
+func GetHomescriptQuota(username string, context HomescriptQuotaContext) (HomescriptQuota, bool, error) {
+	query, err := db.Prepare(`
+	SELECT
+		Username,
+		Context,
+		MaxConcurrentJobs,
+		MaxRuntimeSeconds,
+		MaxCallStackSize,
+		MaxStackSize,
+		MaxInstructions,
+		MaxOutputBytes
+	FROM homescriptQuota
+	WHERE Username=? AND Context=?
+	`)
+	if err != nil {
+		log.Error("Could not get Homescript quota: Preparing query failed: ", err.Error())
+		return HomescriptQuota{}, false, err
+	}
+	defer query.Close()
+
+	var quota HomescriptQuota
+	if err := query.QueryRow(username, context).Scan(
+		&quota.Username,
+		&quota.Context,
+		&quota.Data.MaxConcurrentJobs,
+		&quota.Data.MaxRuntimeSeconds,
+		&quota.Data.MaxCallStackSize,
+		&quota.Data.MaxStackSize,
+		&quota.Data.MaxInstructions,
+		&quota.Data.MaxOutputBytes,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return HomescriptQuota{}, false, nil
+		}
+		log.Error("Could not get Homescript quota: Executing query failed: ", err.Error())
+		return HomescriptQuota{}, false, err
+	}
+
+	return quota, true, nil
+}
+
+// Returns a list of all quotas, including the defaults of each context
+func ListHomescriptQuotas() ([]HomescriptQuota, error) {
+	res, err := db.Query(`
+	SELECT
+		Username,
+		Context,
+		MaxConcurrentJobs,
+		MaxRuntimeSeconds,
+		MaxCallStackSize,
+		MaxStackSize,
+		MaxInstructions,
+		MaxOutputBytes
+	FROM homescriptQuota
+	ORDER BY Username, Context
+	`)
+	if err != nil {
+		log.Error("Could not list Homescript quotas: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	quotas := make([]HomescriptQuota, 0)
+	for res.Next() {
+		var quota HomescriptQuota
+		if err := res.Scan(
+			&quota.Username,
+			&quota.Context,
+			&quota.Data.MaxConcurrentJobs,
+			&quota.Data.MaxRuntimeSeconds,
+			&quota.Data.MaxCallStackSize,
+			&quota.Data.MaxStackSize,
+			&quota.Data.MaxInstructions,
+			&quota.Data.MaxOutputBytes,
+		); err != nil {
+			log.Error("Could not list Homescript quotas: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		quotas = append(quotas, quota)
+	}
+
+	return quotas, nil
+}
+
+// Deletes the quota of a user in a given context
+func DeleteHomescriptQuota(username string, context HomescriptQuotaContext) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptQuota
+	WHERE Username=? AND Context=?
+	`)
+	if err != nil {
+		log.Error("Could not delete Homescript quota: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(username, context); err != nil {
+		log.Error("Could not delete Homescript quota: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Deletes all individual quotas of a user
+func DeleteHomescriptQuotasOfUser(username string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptQuota
+	WHERE Username=?
+	`)
+	if err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript quotas of user `%s`: Preparing query failed: %s", username, err.Error()))
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(username); err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript quotas of user `%s`: Executing query failed: %s", username, err.Error()))
+		return err
+	}
+
+	return nil
+}
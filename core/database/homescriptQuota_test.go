@@ -0,0 +1,67 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateHomescriptQuotaTable(t *testing.T) {
+	assert.NoError(t, createHomescriptQuotaTable())
+}
+
+func TestHomescriptQuota(t *testing.T) {
+	table := []HomescriptQuota{
+		{
+			Username: HomescriptQuotaDefaultUsername,
+			Context:  HomescriptQuotaContextUser,
+			Data: HomescriptQuotaData{
+				MaxConcurrentJobs: 10,
+				MaxRuntimeSeconds: 60,
+			},
+		},
+		{
+			Username: "admin",
+			Context:  HomescriptQuotaContextAutomation,
+			Data: HomescriptQuotaData{
+				MaxConcurrentJobs: 2,
+				MaxRuntimeSeconds: 5,
+				MaxCallStackSize:  32,
+				MaxStackSize:      128,
+				MaxInstructions:   100000,
+				MaxOutputBytes:    1024,
+			},
+		},
+		{
+			// Modifies the previous entry
+			Username: "admin",
+			Context:  HomescriptQuotaContextAutomation,
+			Data: HomescriptQuotaData{
+				MaxConcurrentJobs: 3,
+			},
+		},
+	}
+
+	for _, test := range table {
+		assert.NoError(t, SetHomescriptQuota(test))
+
+		quota, found, err := GetHomescriptQuota(test.Username, test.Context)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, test, quota)
+	}
+
+	quotas, err := ListHomescriptQuotas()
+	assert.NoError(t, err)
+	assert.Len(t, quotas, 2)
+
+	assert.NoError(t, DeleteHomescriptQuotasOfUser("admin"))
+	_, found, err := GetHomescriptQuota("admin", HomescriptQuotaContextAutomation)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, DeleteHomescriptQuota(HomescriptQuotaDefaultUsername, HomescriptQuotaContextUser))
+	_, found, err = GetHomescriptQuota(HomescriptQuotaDefaultUsername, HomescriptQuotaContextUser)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
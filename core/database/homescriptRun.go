@@ -0,0 +1,514 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type HomescriptRunContext string
+
+const (
+	HomescriptRunContextUser       HomescriptRunContext = "user"
+	HomescriptRunContextAutomation HomescriptRunContext = "automation"
+	HomescriptRunContextDriver     HomescriptRunContext = "driver"
+	HomescriptRunContextWebhook    HomescriptRunContext = "webhook"
+)
+
+// The maximum amount of output which is stored for each run
+const HomescriptRunMaxOutputLen = 16384
+
+// A persisted record of a finished Homescript job
+type HomescriptRun struct {
+	Id        uint                 `json:"id"`
+	ProgramId string               `json:"programId"`
+	Context   HomescriptRunContext `json:"context"`
+	// The user on whose behalf the job was executed, `nil` for drivers
+	Username *string `json:"username"`
+	// Set if the job was caused by an automation or a schedule
+	AutomationId *uint `json:"automationId"`
+	ScheduleId   *uint `json:"scheduleId"`
+	// Set if the job was a driver invocation on behalf of a device
+	DeviceId   *string   `json:"deviceId"`
+	StartTime  time.Time `json:"startTime"`
+	EndTime    time.Time `json:"endTime"`
+	DurationMs uint      `json:"durationMs"`
+	ExitCode   int64     `json:"exitCode"`
+	Success    bool      `json:"success"`
+	Output     string    `json:"output"`
+	// Is true if the output exceeded `HomescriptRunMaxOutputLen`
+	OutputTruncated bool `json:"outputTruncated"`
+	// JSON-encoded list of the errors which occurred during the run
+	Errors json.RawMessage `json:"errors"`
+}
+
+// Specifies which runs should be returned, fields which are `nil` are ignored
+type HomescriptRunFilter struct {
+	ProgramId    *string    `json:"programId"`
+	AutomationId *uint      `json:"automationId"`
+	ScheduleId   *uint      `json:"scheduleId"`
+	Success      *bool      `json:"success"`
+	Since        *time.Time `json:"since"`
+	Until        *time.Time `json:"until"`
+	// Limits the number of returned runs, `0` means no limit
+	Limit uint `json:"limit"`
+}
+
+// Controls how long runs are kept, a value of `0` disables the respective limit
+type HomescriptRunRetention struct {
+	MaxAgeDays       uint `json:"maxAgeDays"`
+	MaxRunsPerScript uint `json:"maxRunsPerScript"`
+	// Driver invocations happen very frequently, therefore they are only recorded if explicitly enabled
+	RecordDrivers bool `json:"recordDrivers"`
+}
+
+// Creates the table containing the execution history of Homescript jobs
+// If the database fails, this function returns an error
+func createHomescriptRunTable() error {
+	_, err := db.Exec(fmt.Sprintf(`
+	CREATE TABLE
+	IF NOT EXISTS
+	homescriptRun(
+		Id					INT AUTO_INCREMENT,
+		ProgramId			VARCHAR(%d) NOT NULL,
+		Context				ENUM('user', 'automation', 'driver', 'webhook'),
+		Username			VARCHAR(20) NULL,
+		AutomationId		INT NULL,
+		ScheduleId			INT NULL,
+		DeviceId			VARCHAR(50) NULL,
+		StartTime			DATETIME(3) NOT NULL,
+		EndTime				DATETIME(3) NOT NULL,
+		DurationMs			INT NOT NULL,
+		ExitCode			BIGINT NOT NULL,
+		Success				BOOLEAN NOT NULL,
+		Output				TEXT,
+		OutputTruncated		BOOLEAN NOT NULL,
+		Errors				MEDIUMTEXT,
+
+		PRIMARY KEY (Id),
+		INDEX (ProgramId, Username),
+		INDEX (StartTime)
+	)
+	`, HOMESCRIPT_ID_LEN))
+	if err != nil {
+		log.Error("Failed to create Homescript run table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Creates the table containing the retention policy of the execution history
+// If no policy exists, a default policy is inserted
+func createHomescriptRunRetentionTable() error {
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	homescriptRunRetention(
+		Id					INT PRIMARY KEY,
+		MaxAgeDays			INT NOT NULL DEFAULT 30,
+		MaxRunsPerScript	INT NOT NULL DEFAULT 100,
+		RecordDrivers		BOOLEAN NOT NULL DEFAULT FALSE
+	)
+	`); err != nil {
+		log.Error("Failed to create Homescript run retention table: Executing query failed: ", err.Error())
+		return err
+	}
+
+	if _, err := db.Exec(`
+	INSERT IGNORE INTO
+	homescriptRunRetention(Id)
+	VALUES(0)
+	`); err != nil {
+		log.Error("Failed to create Homescript run retention policy: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the retention policy of the execution history
+func GetHomescriptRunRetention() (HomescriptRunRetention, error) {
+	var retention HomescriptRunRetention
+	if err := db.QueryRow(`
+	SELECT
+		MaxAgeDays,
+		MaxRunsPerScript,
+		RecordDrivers
+	FROM homescriptRunRetention
+	WHERE Id=0
+	`).Scan(
+		&retention.MaxAgeDays,
+		&retention.MaxRunsPerScript,
+		&retention.RecordDrivers,
+	); err != nil {
+		log.Error("Could not get Homescript run retention: Executing query failed: ", err.Error())
+		return HomescriptRunRetention{}, err
+	}
+	return retention, nil
+}
+
+// Updates the retention policy of the execution history
+func SetHomescriptRunRetention(retention HomescriptRunRetention) error {
+	query, err := db.Prepare(`
+	UPDATE homescriptRunRetention
+	SET
+		MaxAgeDays=?,
+		MaxRunsPerScript=?,
+		RecordDrivers=?
+	WHERE Id=0
+	`)
+	if err != nil {
+		log.Error("Could not set Homescript run retention: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(
+		retention.MaxAgeDays,
+		retention.MaxRunsPerScript,
+		retention.RecordDrivers,
+	); err != nil {
+		log.Error("Could not set Homescript run retention: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Inserts a finished run into the execution history and returns its ID
+func InsertHomescriptRun(run HomescriptRun) (uint, error) {
+	query, err := db.Prepare(`
+	INSERT INTO
+	homescriptRun(
+		Id,
+		ProgramId,
+		Context,
+		Username,
+		AutomationId,
+		ScheduleId,
+		DeviceId,
+		StartTime,
+		EndTime,
+		DurationMs,
+		ExitCode,
+		Success,
+		Output,
+		OutputTruncated,
+		Errors
+	)
+	VALUES(DEFAULT, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		log.Error("Could not insert Homescript run: Preparing query failed: ", err.Error())
+		return 0, err
+	}
+	defer query.Close()
+
+	errors := run.Errors
+	if errors == nil {
+		errors = json.RawMessage("[]")
+	}
+
+	res, err := query.Exec(
+		run.ProgramId,
+		run.Context,
+		run.Username,
+		run.AutomationId,
+		run.ScheduleId,
+		run.DeviceId,
+		run.StartTime,
+		run.EndTime,
+		run.DurationMs,
+		run.ExitCode,
+		run.Success,
+		run.Output,
+		run.OutputTruncated,
+		string(errors),
+	)
+	if err != nil {
+		log.Error("Could not insert Homescript run: Executing query failed: ", err.Error())
+		return 0, err
+	}
+
+	newId, err := res.LastInsertId()
+	if err != nil {
+		log.Error("Could not insert Homescript run: Retrieving last insert id failed: ", err.Error())
+		return 0, err
+	}
+
+	return uint(newId), nil
+}
+
+func scanHomescriptRun(scanner interface{ Scan(...any) error }) (HomescriptRun, error) {
+	var run HomescriptRun
+	var username sql.NullString
+	var automationId sql.NullInt64
+	var scheduleId sql.NullInt64
+	var deviceId sql.NullString
+	var errors string
+
+	if err := scanner.Scan(
+		&run.Id,
+		&run.ProgramId,
+		&run.Context,
+		&username,
+		&automationId,
+		&scheduleId,
+		&deviceId,
+		&run.StartTime,
+		&run.EndTime,
+		&run.DurationMs,
+		&run.ExitCode,
+		&run.Success,
+		&run.Output,
+		&run.OutputTruncated,
+		&errors,
+	); err != nil {
+		return HomescriptRun{}, err
+	}
+
+	if username.Valid {
+		run.Username = &username.String
+	}
+	if automationId.Valid {
+		id := uint(automationId.Int64)
+		run.AutomationId = &id
+	}
+	if scheduleId.Valid {
+		id := uint(scheduleId.Int64)
+		run.ScheduleId = &id
+	}
+	if deviceId.Valid {
+		run.DeviceId = &deviceId.String
+	}
+	run.Errors = json.RawMessage(errors)
+
+	return run, nil
+}
+
+const homescriptRunColumns = `
+	Id,
+	ProgramId,
+	Context,
+	Username,
+	AutomationId,
+	ScheduleId,
+	DeviceId,
+	StartTime,
+	EndTime,
+	DurationMs,
+	ExitCode,
+	Success,
+	Output,
+	OutputTruncated,
+	Errors
+`
+
+// Returns a run given its ID, only runs executed on behalf of the given user are considered
+func GetHomescriptRunById(id uint, username string) (HomescriptRun, bool, error) {
+	query, err := db.Prepare(fmt.Sprintf(`
+	SELECT %s
+	FROM homescriptRun
+	WHERE Id=? AND Username=?
+	`, homescriptRunColumns))
+	if err != nil {
+		log.Error("Could not get Homescript run: Preparing query failed: ", err.Error())
+		return HomescriptRun{}, false, err
+	}
+	defer query.Close()
+
+	run, err := scanHomescriptRun(query.QueryRow(id, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return HomescriptRun{}, false, nil
+		}
+		log.Error("Could not get Homescript run: Executing query failed: ", err.Error())
+		return HomescriptRun{}, false, err
+	}
+
+	return run, true, nil
+}
+
+// Returns the runs of a user which match the given filter, the most recent runs are returned first
+func ListHomescriptRuns(username string, filter HomescriptRunFilter) ([]HomescriptRun, error) {
+	conditions := []string{"Username=?"}
+	args := []any{username}
+
+	if filter.ProgramId != nil {
+		conditions = append(conditions, "ProgramId=?")
+		args = append(args, *filter.ProgramId)
+	}
+	if filter.AutomationId != nil {
+		conditions = append(conditions, "AutomationId=?")
+		args = append(args, *filter.AutomationId)
+	}
+	if filter.ScheduleId != nil {
+		conditions = append(conditions, "ScheduleId=?")
+		args = append(args, *filter.ScheduleId)
+	}
+	if filter.Success != nil {
+		conditions = append(conditions, "Success=?")
+		args = append(args, *filter.Success)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "StartTime>=?")
+		args = append(args, *filter.Since)
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "StartTime<=?")
+		args = append(args, *filter.Until)
+	}
+
+	limit := ""
+	if filter.Limit != 0 {
+		limit = "LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	query, err := db.Prepare(fmt.Sprintf(`
+	SELECT %s
+	FROM homescriptRun
+	WHERE %s
+	ORDER BY Id DESC
+	%s
+	`, homescriptRunColumns, strings.Join(conditions, " AND "), limit))
+	if err != nil {
+		log.Error("Could not list Homescript runs: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(args...)
+	if err != nil {
+		log.Error("Could not list Homescript runs: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	runs := make([]HomescriptRun, 0)
+	for res.Next() {
+		run, err := scanHomescriptRun(res)
+		if err != nil {
+			log.Error("Could not list Homescript runs: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// Deletes runs which violate the retention policy
+// Only the runs of the given program are limited by count in order to keep this operation cheap
+func PurgeHomescriptRuns(programId string, retention HomescriptRunRetention) error {
+	if err := purgeExpiredHomescriptRuns(retention); err != nil {
+		return err
+	}
+
+	return purgeExcessHomescriptRuns(programId, retention)
+}
+
+// Deletes the runs of all programs which violate the retention policy
+func PurgeAllHomescriptRuns(retention HomescriptRunRetention) error {
+	if err := purgeExpiredHomescriptRuns(retention); err != nil {
+		return err
+	}
+
+	if retention.MaxRunsPerScript == 0 {
+		return nil
+	}
+
+	// Only programs which exceed the limit are purged
+	res, err := db.Query(`
+	SELECT ProgramId
+	FROM homescriptRun
+	GROUP BY ProgramId
+	HAVING COUNT(*) > ?
+	`, retention.MaxRunsPerScript)
+	if err != nil {
+		log.Error("Could not purge excess Homescript runs: Executing query failed: ", err.Error())
+		return err
+	}
+	defer res.Close()
+
+	programIds := make([]string, 0)
+	for res.Next() {
+		var programId string
+		if err := res.Scan(&programId); err != nil {
+			log.Error("Could not purge excess Homescript runs: Scanning results failed: ", err.Error())
+			return err
+		}
+		programIds = append(programIds, programId)
+	}
+
+	for _, programId := range programIds {
+		if err := purgeExcessHomescriptRuns(programId, retention); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func purgeExpiredHomescriptRuns(retention HomescriptRunRetention) error {
+	if retention.MaxAgeDays == 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(`
+	DELETE FROM homescriptRun
+	WHERE StartTime < NOW() - INTERVAL ? DAY
+	`, retention.MaxAgeDays); err != nil {
+		log.Error("Could not purge old Homescript runs: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func purgeExcessHomescriptRuns(programId string, retention HomescriptRunRetention) error {
+	if retention.MaxRunsPerScript == 0 {
+		return nil
+	}
+
+	// The inner query is wrapped in a derived table as MySQL does not allow `LIMIT` in `IN` subqueries.
+	if _, err := db.Exec(`
+	DELETE FROM homescriptRun
+	WHERE ProgramId=? AND Id < (
+		SELECT Id FROM (
+			SELECT Id
+			FROM homescriptRun
+			WHERE ProgramId=?
+			ORDER BY Id DESC
+			LIMIT 1 OFFSET ?
+		) AS newest
+	)
+	`, programId, programId, retention.MaxRunsPerScript-1); err != nil {
+		log.Error("Could not purge excess Homescript runs: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Deletes all runs which were executed on behalf of a user
+func DeleteHomescriptRunsOfUser(username string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptRun
+	WHERE Username=?
+	`)
+	if err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript runs of user `%s`: Preparing query failed: %s", username, err.Error()))
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(username); err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript runs of user `%s`: Executing query failed: %s", username, err.Error()))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateHomescriptRunTable(t *testing.T) {
+	assert.NoError(t, createHomescriptRunTable())
+	assert.NoError(t, createHomescriptRunRetentionTable())
+}
+
+func TestHomescriptRunRetention(t *testing.T) {
+	retention := HomescriptRunRetention{
+		MaxAgeDays:       7,
+		MaxRunsPerScript: 2,
+		RecordDrivers:    true,
+	}
+	assert.NoError(t, SetHomescriptRunRetention(retention))
+
+	stored, err := GetHomescriptRunRetention()
+	assert.NoError(t, err)
+	assert.Equal(t, retention, stored)
+}
+
+func TestHomescriptRuns(t *testing.T) {
+	username := "admin"
+	automationId := uint(42)
+	start := time.Now().Truncate(time.Millisecond)
+
+	table := []struct {
+		Run     HomescriptRun
+		Success bool
+	}{
+		{
+			Run: HomescriptRun{
+				ProgramId: "history_test",
+				Context:   HomescriptRunContextUser,
+				Username:  &username,
+				Output:    "hello",
+				Errors:    json.RawMessage("[]"),
+			},
+			Success: true,
+		},
+		{
+			Run: HomescriptRun{
+				ProgramId:    "history_test",
+				Context:      HomescriptRunContextAutomation,
+				Username:     &username,
+				AutomationId: &automationId,
+				ExitCode:     1,
+				Errors:       json.RawMessage(`[{"runtimeError":{"kind":"Exit","message":"failed"}}]`),
+			},
+			Success: false,
+		},
+	}
+
+	for _, test := range table {
+		test.Run.StartTime = start
+		test.Run.EndTime = start.Add(time.Second)
+		test.Run.DurationMs = 1000
+		test.Run.Success = test.Success
+
+		id, err := InsertHomescriptRun(test.Run)
+		assert.NoError(t, err)
+
+		run, found, err := GetHomescriptRunById(id, username)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, test.Run.ProgramId, run.ProgramId)
+		assert.Equal(t, test.Run.AutomationId, run.AutomationId)
+		assert.Equal(t, test.Success, run.Success)
+		assert.JSONEq(t, string(test.Run.Errors), string(run.Errors))
+	}
+
+	programId := "history_test"
+	runs, err := ListHomescriptRuns(username, HomescriptRunFilter{ProgramId: &programId})
+	assert.NoError(t, err)
+	assert.Len(t, runs, 2)
+
+	failed := false
+	runs, err = ListHomescriptRuns(username, HomescriptRunFilter{Success: &failed})
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+
+	runs, err = ListHomescriptRuns(username, HomescriptRunFilter{AutomationId: &automationId})
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+
+	// Programs within the limit are not affected
+	assert.NoError(t, PurgeAllHomescriptRuns(HomescriptRunRetention{MaxRunsPerScript: 2}))
+	runs, err = ListHomescriptRuns(username, HomescriptRunFilter{ProgramId: &programId})
+	assert.NoError(t, err)
+	assert.Len(t, runs, 2)
+
+	// Only the most recent run should be kept
+	assert.NoError(t, PurgeHomescriptRuns(programId, HomescriptRunRetention{MaxRunsPerScript: 1}))
+	runs, err = ListHomescriptRuns(username, HomescriptRunFilter{ProgramId: &programId})
+	assert.NoError(t, err)
+	assert.Len(t, runs, 1)
+
+	assert.NoError(t, DeleteHomescriptRunsOfUser(username))
+	runs, err = ListHomescriptRuns(username, HomescriptRunFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, runs, 0)
+}
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// A secret value (for instance an API key) which can be read by Homescripts
+// Only the encrypted value is stored, it is never returned by the API
+type HomescriptSecret struct {
+	Owner       string `json:"owner"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Shared secrets can be read by the Homescripts of every user
+	Shared    bool      `json:"shared"`
+	CreatedAt time.Time `json:"createdAt"`
+	// The encrypted value including its nonce
+	Ciphertext []byte `json:"-"`
+}
+
+// Creates the table containing encrypted Homescript secrets
+// If the database fails, this function returns an error
+func createHomescriptSecretTable() error {
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	homescriptSecret(
+		Owner					VARCHAR(20),
+		Name					VARCHAR(50),
+		Description				TEXT,
+		Shared					BOOLEAN NOT NULL DEFAULT FALSE,
+		CreatedAt				DATETIME NOT NULL,
+		Ciphertext				BLOB NOT NULL,
+
+		PRIMARY KEY (Owner, Name),
+		FOREIGN KEY (Owner)
+		REFERENCES user(Username)
+	)
+	`); err != nil {
+		log.Error("Failed to create Homescript secret table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Creates a new secret or replaces an existing secret of the same owner and name
+func InsertHomescriptSecret(secret HomescriptSecret) error {
+	query, err := db.Prepare(`
+	INSERT INTO
+	homescriptSecret(
+		Owner,
+		Name,
+		Description,
+		Shared,
+		CreatedAt,
+		Ciphertext
+	)
+	VALUES(?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY
+	UPDATE
+		Description=VALUES(Description),
+		Shared=VALUES(Shared),
+		Ciphertext=VALUES(Ciphertext)
+	`)
+	if err != nil {
+		log.Error("Could not insert Homescript secret: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(
+		secret.Owner,
+		secret.Name,
+		secret.Description,
+		secret.Shared,
+		secret.CreatedAt,
+		secret.Ciphertext,
+	); err != nil {
+		log.Error("Could not insert Homescript secret: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Changes the description of a secret and optionally its encrypted value
+func ModifyHomescriptSecret(owner string, name string, description string, ciphertext []byte) error {
+	query, err := db.Prepare(`
+	UPDATE homescriptSecret
+	SET
+		Description=?,
+		Ciphertext=COALESCE(?, Ciphertext)
+	WHERE Owner=? AND Name=?
+	`)
+	if err != nil {
+		log.Error("Could not modify Homescript secret: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(description, ciphertext, owner, name); err != nil {
+		log.Error("Could not modify Homescript secret: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+const homescriptSecretColumns = `
+	Owner,
+	Name,
+	Description,
+	Shared,
+	CreatedAt,
+	Ciphertext
+`
+
+func listHomescriptSecrets(condition string, args ...any) ([]HomescriptSecret, error) {
+	query, err := db.Prepare(fmt.Sprintf(`
+	SELECT %s
+	FROM homescriptSecret
+	WHERE %s
+	ORDER BY Name
+	`, homescriptSecretColumns, condition))
+	if err != nil {
+		log.Error("Could not list Homescript secrets: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(args...)
+	if err != nil {
+		log.Error("Could not list Homescript secrets: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	secrets := make([]HomescriptSecret, 0)
+	for res.Next() {
+		var secret HomescriptSecret
+		if err := res.Scan(
+			&secret.Owner,
+			&secret.Name,
+			&secret.Description,
+			&secret.Shared,
+			&secret.CreatedAt,
+			&secret.Ciphertext,
+		); err != nil {
+			log.Error("Could not list Homescript secrets: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, nil
+}
+
+// Returns all secrets owned by the given user
+func ListHomescriptSecretsOfUser(owner string) ([]HomescriptSecret, error) {
+	return listHomescriptSecrets("Owner=?", owner)
+}
+
+// Returns all secrets which are shared with every user
+func ListSharedHomescriptSecrets() ([]HomescriptSecret, error) {
+	return listHomescriptSecrets("Shared=TRUE")
+}
+
+// Returns a secret given its owner and name
+func GetHomescriptSecret(owner string, name string) (HomescriptSecret, bool, error) {
+	query, err := db.Prepare(fmt.Sprintf(`
+	SELECT %s
+	FROM homescriptSecret
+	WHERE Owner=? AND Name=?
+	`, homescriptSecretColumns))
+	if err != nil {
+		log.Error("Could not get Homescript secret: Preparing query failed: ", err.Error())
+		return HomescriptSecret{}, false, err
+	}
+	defer query.Close()
+
+	var secret HomescriptSecret
+	if err := query.QueryRow(owner, name).Scan(
+		&secret.Owner,
+		&secret.Name,
+		&secret.Description,
+		&secret.Shared,
+		&secret.CreatedAt,
+		&secret.Ciphertext,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return HomescriptSecret{}, false, nil
+		}
+		log.Error("Could not get Homescript secret: Executing query failed: ", err.Error())
+		return HomescriptSecret{}, false, err
+	}
+
+	return secret, true, nil
+}
+
+// Deletes a secret of the given user
+func DeleteHomescriptSecret(owner string, name string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptSecret
+	WHERE Owner=? AND Name=?
+	`)
+	if err != nil {
+		log.Error("Could not delete Homescript secret: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(owner, name); err != nil {
+		log.Error("Could not delete Homescript secret: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Deletes all secrets of the given user, including the ones which are shared
+func DeleteHomescriptSecretsOfUser(username string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptSecret
+	WHERE Owner=?
+	`)
+	if err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript secrets of user `%s`: Preparing query failed: %s", username, err.Error()))
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(username); err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript secrets of user `%s`: Executing query failed: %s", username, err.Error()))
+		return err
+	}
+
+	return nil
+}
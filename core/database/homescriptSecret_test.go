@@ -0,0 +1,74 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateHomescriptSecretTable(t *testing.T) {
+	assert.NoError(t, createHomescriptSecretTable())
+}
+
+func TestHomescriptSecrets(t *testing.T) {
+	table := []HomescriptSecret{
+		{
+			Owner:       "admin",
+			Name:        "weather_api_key",
+			Description: "Personal key",
+			Shared:      false,
+			CreatedAt:   time.Now().Truncate(time.Second),
+			Ciphertext:  []byte{0x01, 0x02, 0x03},
+		},
+		{
+			Owner:       "admin",
+			Name:        "router_password",
+			Description: "Used by every family member",
+			Shared:      true,
+			CreatedAt:   time.Now().Truncate(time.Second),
+			Ciphertext:  []byte{0x04, 0x05, 0x06},
+		},
+	}
+
+	for _, secret := range table {
+		assert.NoError(t, InsertHomescriptSecret(secret))
+
+		stored, found, err := GetHomescriptSecret(secret.Owner, secret.Name)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, secret.Ciphertext, stored.Ciphertext)
+		assert.Equal(t, secret.Shared, stored.Shared)
+	}
+
+	secrets, err := ListHomescriptSecretsOfUser("admin")
+	assert.NoError(t, err)
+	assert.Len(t, secrets, len(table))
+
+	shared, err := ListSharedHomescriptSecrets()
+	assert.NoError(t, err)
+	assert.Len(t, shared, 1)
+	assert.Equal(t, "router_password", shared[0].Name)
+
+	// Modifying only the description keeps the value
+	assert.NoError(t, ModifyHomescriptSecret("admin", "weather_api_key", "Changed", nil))
+	stored, _, err := GetHomescriptSecret("admin", "weather_api_key")
+	assert.NoError(t, err)
+	assert.Equal(t, "Changed", stored.Description)
+	assert.Equal(t, table[0].Ciphertext, stored.Ciphertext)
+
+	assert.NoError(t, ModifyHomescriptSecret("admin", "weather_api_key", "Changed", []byte{0x07}))
+	stored, _, err = GetHomescriptSecret("admin", "weather_api_key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x07}, stored.Ciphertext)
+
+	assert.NoError(t, DeleteHomescriptSecret("admin", "weather_api_key"))
+	_, found, err := GetHomescriptSecret("admin", "weather_api_key")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, DeleteHomescriptSecretsOfUser("admin"))
+	secrets, err = ListHomescriptSecretsOfUser("admin")
+	assert.NoError(t, err)
+	assert.Empty(t, secrets)
+}
@@ -0,0 +1,429 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Namespaces are either the ID of the Homescript which owns the entries
+// or the name of a shared store prefixed with its owner (see `HomescriptStoreNamespace`)
+const HomescriptStorageStoreNameMaxLen = HOMESCRIPT_ID_LEN
+
+// The owner prefix is at most 20 characters long (see the `user` table)
+const HomescriptStorageNamespaceMaxLen = 20 + 1 + HomescriptStorageStoreNameMaxLen
+const HomescriptStorageKeyMaxLen = 255
+
+// MySQL aborts one of the transactions involved in a deadlock, the aborted transaction can be retried
+const mysqlErrDeadlock = 1213
+const homescriptStorageUpdateAttempts = 5
+
+// A typed entry of the namespaced Homescript storage
+// The legacy `homescriptStorage` table only holds untyped, global entries
+type HomescriptStorageEntry struct {
+	Owner     string `json:"owner"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	// The value encoded as tagged JSON (see `types.StoredValue`)
+	Value     string     `json:"value"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// Creates the table containing the typed, namespaced Homescript storage
+// If the database fails, this function returns an error
+func createHomescriptStorageEntryTable() error {
+	if _, err := db.Exec(fmt.Sprintf(`
+	CREATE TABLE
+	IF NOT EXISTS
+	homescriptStorageEntry(
+		Owner					VARCHAR(20),
+		Namespace				VARCHAR(%d),
+		VarKey					VARCHAR(%d),
+		VarValue				MEDIUMTEXT NOT NULL,
+		ExpiresAt				DATETIME(3) NULL,
+		UpdatedAt				DATETIME(3) NOT NULL,
+
+		PRIMARY KEY (Owner, Namespace, VarKey),
+		INDEX (ExpiresAt),
+		FOREIGN KEY (Owner)
+		REFERENCES user(Username)
+	)
+	`, HomescriptStorageNamespaceMaxLen, HomescriptStorageKeyMaxLen)); err != nil {
+		log.Error("Failed to create Homescript storage entry table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Returns the namespace of a store which is shared between the Homescripts of a user
+// The owner prefix separates shared stores from the namespaces of individual Homescripts
+func HomescriptStoreNamespace(owner string, name string) string {
+	return owner + ":" + name
+}
+
+// Entries whose TTL has elapsed are treated as if they did not exist
+const homescriptStorageNotExpired = "(ExpiresAt IS NULL OR ExpiresAt > NOW(3))"
+
+// Creates or replaces an entry, a `nil` TTL keeps the entry forever
+// The expiry is computed by the database so that it is not affected by differing time zones
+func SetHomescriptStorageEntry(owner string, namespace string, key string, value string, ttlSeconds *int64) error {
+	if err := DeleteExpiredHomescriptStorageEntries(owner); err != nil {
+		return err
+	}
+
+	query, err := db.Prepare(`
+	INSERT INTO
+	homescriptStorageEntry(
+		Owner,
+		Namespace,
+		VarKey,
+		VarValue,
+		ExpiresAt,
+		UpdatedAt
+	)
+	VALUES(?, ?, ?, ?, IF(? IS NULL, NULL, NOW(3) + INTERVAL ? SECOND), NOW(3))
+	ON DUPLICATE KEY
+	UPDATE
+		VarValue=VALUES(VarValue),
+		ExpiresAt=VALUES(ExpiresAt),
+		UpdatedAt=VALUES(UpdatedAt)
+	`)
+	if err != nil {
+		log.Error("Could not set Homescript storage entry: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(owner, namespace, key, value, ttlSeconds, ttlSeconds); err != nil {
+		log.Error("Could not set Homescript storage entry: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns an entry unless it does not exist or has expired
+func GetHomescriptStorageEntry(owner string, namespace string, key string) (HomescriptStorageEntry, bool, error) {
+	query, err := db.Prepare(fmt.Sprintf(`
+	SELECT
+		Owner,
+		Namespace,
+		VarKey,
+		VarValue,
+		ExpiresAt,
+		UpdatedAt
+	FROM homescriptStorageEntry
+	WHERE Owner=? AND Namespace=? AND VarKey=? AND %s
+	`, homescriptStorageNotExpired))
+	if err != nil {
+		log.Error("Could not get Homescript storage entry: Preparing query failed: ", err.Error())
+		return HomescriptStorageEntry{}, false, err
+	}
+	defer query.Close()
+
+	entry, err := scanHomescriptStorageEntry(query.QueryRow(owner, namespace, key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return HomescriptStorageEntry{}, false, nil
+		}
+		log.Error("Could not get Homescript storage entry: Executing query failed: ", err.Error())
+		return HomescriptStorageEntry{}, false, err
+	}
+
+	return entry, true, nil
+}
+
+func scanHomescriptStorageEntry(scanner interface{ Scan(...any) error }) (HomescriptStorageEntry, error) {
+	var entry HomescriptStorageEntry
+	var expiresAt sql.NullTime
+
+	if err := scanner.Scan(
+		&entry.Owner,
+		&entry.Namespace,
+		&entry.Key,
+		&entry.Value,
+		&expiresAt,
+		&entry.UpdatedAt,
+	); err != nil {
+		return HomescriptStorageEntry{}, err
+	}
+
+	if expiresAt.Valid {
+		entry.ExpiresAt = &expiresAt.Time
+	}
+
+	return entry, nil
+}
+
+// Returns all entries of a namespace whose key starts with the given prefix, sorted by key
+// An empty namespace returns the entries of all namespaces
+func ListHomescriptStorageEntries(owner string, namespace string, prefix string) ([]HomescriptStorageEntry, error) {
+	query, err := db.Prepare(fmt.Sprintf(`
+	SELECT
+		Owner,
+		Namespace,
+		VarKey,
+		VarValue,
+		ExpiresAt,
+		UpdatedAt
+	FROM homescriptStorageEntry
+	WHERE Owner=?
+		AND (?='' OR Namespace=?)
+		AND LEFT(VarKey, CHAR_LENGTH(?))=?
+		AND %s
+	ORDER BY Namespace, VarKey
+	`, homescriptStorageNotExpired))
+	if err != nil {
+		log.Error("Could not list Homescript storage entries: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(owner, namespace, namespace, prefix, prefix)
+	if err != nil {
+		log.Error("Could not list Homescript storage entries: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	entries := make([]HomescriptStorageEntry, 0)
+	for res.Next() {
+		entry, err := scanHomescriptStorageEntry(res)
+		if err != nil {
+			log.Error("Could not list Homescript storage entries: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Deletes an entry, returns whether an (unexpired) entry existed
+func DeleteHomescriptStorageEntry(owner string, namespace string, key string) (bool, error) {
+	query, err := db.Prepare(fmt.Sprintf(`
+	DELETE FROM homescriptStorageEntry
+	WHERE Owner=? AND Namespace=? AND VarKey=? AND %s
+	`, homescriptStorageNotExpired))
+	if err != nil {
+		log.Error("Could not delete Homescript storage entry: Preparing query failed: ", err.Error())
+		return false, err
+	}
+	defer query.Close()
+
+	res, err := query.Exec(owner, namespace, key)
+	if err != nil {
+		log.Error("Could not delete Homescript storage entry: Executing query failed: ", err.Error())
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// Atomically replaces the value of an entry
+// The `update` callback receives the current value (`nil` if the entry does not exist) and returns the new value
+// If `update` returns `nil`, the entry is left unchanged
+// Concurrent updates of the same entry are serialized using a row lock
+// Concurrent inserts of a missing entry can deadlock on the gap lock, the aborted update is retried
+// Therefore, `update` may be called more than once and must not have side effects
+func UpdateHomescriptStorageEntry(
+	owner string,
+	namespace string,
+	key string,
+	update func(current *string) (newValue *string, err error),
+) error {
+	for attempt := 1; ; attempt++ {
+		updateErr, dbErr := updateHomescriptStorageEntryTx(owner, namespace, key, update)
+		if updateErr != nil {
+			return updateErr
+		}
+		if dbErr == nil {
+			return nil
+		}
+
+		var mysqlErr *mysql.MySQLError
+		if errors.As(dbErr, &mysqlErr) && mysqlErr.Number == mysqlErrDeadlock && attempt < homescriptStorageUpdateAttempts {
+			log.Debug(fmt.Sprintf("Update of Homescript storage entry `%s` deadlocked, retrying (attempt %d)...", key, attempt))
+			continue
+		}
+
+		log.Error("Could not update Homescript storage entry: ", dbErr.Error())
+		return dbErr
+	}
+}
+
+func updateHomescriptStorageEntryTx(
+	owner string,
+	namespace string,
+	key string,
+	update func(current *string) (newValue *string, err error),
+) (updateErr error, dbErr error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("Starting transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Expired entries would otherwise be locked and passed to `update`
+	if _, err := tx.Exec(`
+	DELETE FROM homescriptStorageEntry
+	WHERE Owner=? AND Namespace=? AND VarKey=? AND ExpiresAt <= NOW(3)
+	`, owner, namespace, key); err != nil {
+		return nil, fmt.Errorf("Deleting expired entry failed: %w", err)
+	}
+
+	var current *string
+	var value string
+	if err := tx.QueryRow(`
+	SELECT VarValue
+	FROM homescriptStorageEntry
+	WHERE Owner=? AND Namespace=? AND VarKey=?
+	FOR UPDATE
+	`, owner, namespace, key).Scan(&value); err != nil {
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("Locking entry failed: %w", err)
+		}
+	} else {
+		current = &value
+	}
+
+	newValue, err := update(current)
+	if err != nil {
+		return err, nil
+	}
+	if newValue == nil {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("Committing transaction failed: %w", err)
+		}
+		return nil, nil
+	}
+
+	// The expiry of existing entries is kept
+	if _, err := tx.Exec(`
+	INSERT INTO
+	homescriptStorageEntry(
+		Owner,
+		Namespace,
+		VarKey,
+		VarValue,
+		ExpiresAt,
+		UpdatedAt
+	)
+	VALUES(?, ?, ?, ?, NULL, NOW(3))
+	ON DUPLICATE KEY
+	UPDATE
+		VarValue=VALUES(VarValue),
+		UpdatedAt=VALUES(UpdatedAt)
+	`, owner, namespace, key, *newValue); err != nil {
+		return nil, fmt.Errorf("Writing entry failed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("Committing transaction failed: %w", err)
+	}
+
+	return nil, nil
+}
+
+// Removes all entries of a user whose TTL has elapsed
+func DeleteExpiredHomescriptStorageEntries(owner string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptStorageEntry
+	WHERE Owner=? AND ExpiresAt <= NOW(3)
+	`)
+	if err != nil {
+		log.Error("Could not delete expired Homescript storage entries: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(owner); err != nil {
+		log.Error("Could not delete expired Homescript storage entries: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Deletes all entries of a namespace
+func DeleteHomescriptStorageNamespace(owner string, namespace string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptStorageEntry
+	WHERE Owner=? AND Namespace=?
+	`)
+	if err != nil {
+		log.Error("Could not delete Homescript storage namespace: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(owner, namespace); err != nil {
+		log.Error("Could not delete Homescript storage namespace: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the names of all namespaces of a user which contain at least one entry
+func ListHomescriptStorageNamespaces(owner string) ([]string, error) {
+	query, err := db.Prepare(fmt.Sprintf(`
+	SELECT DISTINCT Namespace
+	FROM homescriptStorageEntry
+	WHERE Owner=? AND %s
+	ORDER BY Namespace
+	`, homescriptStorageNotExpired))
+	if err != nil {
+		log.Error("Could not list Homescript storage namespaces: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(owner)
+	if err != nil {
+		log.Error("Could not list Homescript storage namespaces: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	namespaces := make([]string, 0)
+	for res.Next() {
+		var namespace string
+		if err := res.Scan(&namespace); err != nil {
+			log.Error("Could not list Homescript storage namespaces: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		namespaces = append(namespaces, namespace)
+	}
+
+	return namespaces, nil
+}
+
+// Deletes all typed storage entries of the given user
+func DeleteHomescriptStorageEntriesOfUser(username string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptStorageEntry
+	WHERE Owner=?
+	`)
+	if err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript storage entries of user `%s`: Preparing query failed: %s", username, err.Error()))
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(username); err != nil {
+		log.Error(fmt.Sprintf("Could not delete Homescript storage entries of user `%s`: Executing query failed: %s", username, err.Error()))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateHomescriptStorageEntryTable(t *testing.T) {
+	assert.NoError(t, createHomescriptStorageEntryTable())
+}
+
+func TestHomescriptStorageEntries(t *testing.T) {
+	assert.NoError(t, SetHomescriptStorageEntry("admin", "script_a", "counter", `{"k":"int","v":1}`, nil))
+	assert.NoError(t, SetHomescriptStorageEntry("admin", "script_a", "config.mode", `{"k":"string","v":"eco"}`, nil))
+	assert.NoError(t, SetHomescriptStorageEntry("admin", "script_a", "config.level", `{"k":"int","v":3}`, nil))
+	assert.NoError(t, SetHomescriptStorageEntry("admin", "script_b", "counter", `{"k":"int","v":42}`, nil))
+
+	entry, found, err := GetHomescriptStorageEntry("admin", "script_a", "counter")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, `{"k":"int","v":1}`, entry.Value)
+	assert.Nil(t, entry.ExpiresAt)
+
+	// Namespaces are isolated from each other
+	entry, found, err = GetHomescriptStorageEntry("admin", "script_b", "counter")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, `{"k":"int","v":42}`, entry.Value)
+
+	entries, err := ListHomescriptStorageEntries("admin", "script_a", "config.")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "config.level", entries[0].Key)
+	assert.Equal(t, "config.mode", entries[1].Key)
+
+	namespaces, err := ListHomescriptStorageNamespaces("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"script_a", "script_b"}, namespaces)
+
+	// Atomic updates receive the current value
+	assert.NoError(t, UpdateHomescriptStorageEntry("admin", "script_a", "counter", func(current *string) (*string, error) {
+		assert.NotNil(t, current)
+		assert.Equal(t, `{"k":"int","v":1}`, *current)
+		newValue := `{"k":"int","v":2}`
+		return &newValue, nil
+	}))
+	entry, _, err = GetHomescriptStorageEntry("admin", "script_a", "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":"int","v":2}`, entry.Value)
+
+	// Returning `nil` leaves the entry unchanged
+	assert.NoError(t, UpdateHomescriptStorageEntry("admin", "script_a", "missing", func(current *string) (*string, error) {
+		assert.Nil(t, current)
+		return nil, nil
+	}))
+	_, found, err = GetHomescriptStorageEntry("admin", "script_a", "missing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// Expired entries are invisible
+	ttl := int64(-1)
+	assert.NoError(t, SetHomescriptStorageEntry("admin", "script_a", "expired", `{"k":"bool","v":true}`, &ttl))
+	_, found, err = GetHomescriptStorageEntry("admin", "script_a", "expired")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	ttl = 3600
+	assert.NoError(t, SetHomescriptStorageEntry("admin", "script_a", "session", `{"k":"bool","v":true}`, &ttl))
+	entry, found, err = GetHomescriptStorageEntry("admin", "script_a", "session")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.NotNil(t, entry.ExpiresAt)
+
+	deleted, err := DeleteHomescriptStorageEntry("admin", "script_a", "session")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = DeleteHomescriptStorageEntry("admin", "script_a", "session")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	assert.NoError(t, DeleteHomescriptStorageNamespace("admin", "script_b"))
+	namespaces, err = ListHomescriptStorageNamespaces("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"script_a"}, namespaces)
+
+	// Concurrent updates of a missing entry must neither deadlock nor lose increments
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, UpdateHomescriptStorageEntry("admin", "script_a", "concurrent", func(current *string) (*string, error) {
+				count := 0
+				if current != nil {
+					parsed, err := strconv.Atoi(*current)
+					if err != nil {
+						return nil, err
+					}
+					count = parsed
+				}
+				newValue := fmt.Sprint(count + 1)
+				return &newValue, nil
+			}))
+		}()
+	}
+	wg.Wait()
+	entry, found, err = GetHomescriptStorageEntry("admin", "script_a", "concurrent")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "10", entry.Value)
+
+	assert.NoError(t, DeleteHomescriptStorageEntriesOfUser("admin"))
+	entries, err = ListHomescriptStorageEntries("admin", "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// The length of the randomly generated (secret) id of a webhook
+const HomescriptWebhookIdLen = 32
+
+// An inbound webhook which runs a Homescript on behalf of its owner
+type HomescriptWebhook struct {
+	// Is part of the webhook URL and therefore acts as a secret
+	Id           string `json:"id"`
+	Owner        string `json:"owner"`
+	HomescriptId string `json:"homescriptId"`
+	Name         string `json:"name"`
+	// The HTTP methods which are accepted by the webhook, an empty list allows every method
+	Methods []string `json:"methods"`
+	// If set, each request must be signed using HMAC-SHA256 with this secret
+	HmacSecret *string `json:"-"`
+}
+
+// Creates the table containing the webhooks of Homescripts
+// If the database fails, this function returns an error
+func createHomescriptWebhookTable() error {
+	_, err := db.Exec(fmt.Sprintf(`
+	CREATE TABLE
+	IF NOT EXISTS
+	homescriptWebhook(
+		Id				VARCHAR(%d),
+		Owner			VARCHAR(20),
+		HomescriptId	VARCHAR(%d),
+		Name			VARCHAR(30),
+		Methods			VARCHAR(100),
+		HmacSecret		TEXT NULL,
+		PRIMARY KEY (Id),
+		FOREIGN KEY (HomescriptId, Owner)
+		REFERENCES homescript(Id, Owner)
+	)
+	`, HomescriptWebhookIdLen, HOMESCRIPT_ID_LEN))
+	if err != nil {
+		log.Error("Failed to create Homescript webhook table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Inserts a new webhook, the id must be generated beforehand
+func CreateHomescriptWebhook(webhook HomescriptWebhook) error {
+	query, err := db.Prepare(`
+	INSERT INTO
+	homescriptWebhook(
+		Id,
+		Owner,
+		HomescriptId,
+		Name,
+		Methods,
+		HmacSecret
+	)
+	VALUES(?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		log.Error("Could not create Homescript webhook: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(
+		webhook.Id,
+		webhook.Owner,
+		webhook.HomescriptId,
+		webhook.Name,
+		strings.Join(webhook.Methods, ","),
+		webhook.HmacSecret,
+	); err != nil {
+		log.Error("Could not create Homescript webhook: Executing query failed: ", err.Error())
+		return err
+	}
+
+	dependenciesChanged()
+	return nil
+}
+
+func scanHomescriptWebhook(scanner interface{ Scan(...any) error }) (HomescriptWebhook, error) {
+	var webhook HomescriptWebhook
+	var methods string
+	var hmacSecret sql.NullString
+
+	if err := scanner.Scan(
+		&webhook.Id,
+		&webhook.Owner,
+		&webhook.HomescriptId,
+		&webhook.Name,
+		&methods,
+		&hmacSecret,
+	); err != nil {
+		return HomescriptWebhook{}, err
+	}
+
+	webhook.Methods = make([]string, 0)
+	if methods != "" {
+		webhook.Methods = strings.Split(methods, ",")
+	}
+
+	if hmacSecret.Valid {
+		webhook.HmacSecret = &hmacSecret.String
+	}
+
+	return webhook, nil
+}
+
+// Returns a webhook given its id, does not check the owner as the id itself is the secret
+func GetHomescriptWebhookById(id string) (HomescriptWebhook, bool, error) {
+	query, err := db.Prepare(`
+	SELECT
+		Id,
+		Owner,
+		HomescriptId,
+		Name,
+		Methods,
+		HmacSecret
+	FROM homescriptWebhook
+	WHERE Id=?
+	`)
+	if err != nil {
+		log.Error("Could not get Homescript webhook: Preparing query failed: ", err.Error())
+		return HomescriptWebhook{}, false, err
+	}
+	defer query.Close()
+
+	webhook, err := scanHomescriptWebhook(query.QueryRow(id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return HomescriptWebhook{}, false, nil
+		}
+		log.Error("Could not get Homescript webhook: Executing query failed: ", err.Error())
+		return HomescriptWebhook{}, false, err
+	}
+
+	return webhook, true, nil
+}
+
+// Returns a list of all webhooks owned by the given user
+func ListHomescriptWebhooksOfUser(username string) ([]HomescriptWebhook, error) {
+	query, err := db.Prepare(`
+	SELECT
+		Id,
+		Owner,
+		HomescriptId,
+		Name,
+		Methods,
+		HmacSecret
+	FROM homescriptWebhook
+	WHERE Owner=?
+	ORDER BY HomescriptId, Name
+	`)
+	if err != nil {
+		log.Error("Could not list Homescript webhooks: Preparing query failed: ", err.Error())
+		return nil, err
+	}
+	defer query.Close()
+
+	res, err := query.Query(username)
+	if err != nil {
+		log.Error("Could not list Homescript webhooks: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	webhooks := make([]HomescriptWebhook, 0)
+	for res.Next() {
+		webhook, err := scanHomescriptWebhook(res)
+		if err != nil {
+			log.Error("Could not list Homescript webhooks: Scanning results failed: ", err.Error())
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, nil
+}
+
+// Deletes a webhook of the given user
+func DeleteHomescriptWebhook(id string, owner string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptWebhook
+	WHERE Id=? AND Owner=?
+	`)
+	if err != nil {
+		log.Error("Could not delete Homescript webhook: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(id, owner); err != nil {
+		log.Error("Could not delete Homescript webhook: Executing query failed: ", err.Error())
+		return err
+	}
+
+	dependenciesChanged()
+	return nil
+}
+
+// Deletes all webhooks which target the given Homescript
+func DeleteHomescriptWebhooksOfScript(homescriptId string, owner string) error {
+	query, err := db.Prepare(`
+	DELETE FROM homescriptWebhook
+	WHERE HomescriptId=? AND Owner=?
+	`)
+	if err != nil {
+		log.Error(fmt.Sprintf("Could not delete webhooks of Homescript `%s`: Preparing query failed: %s", homescriptId, err.Error()))
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(homescriptId, owner); err != nil {
+		log.Error(fmt.Sprintf("Could not delete webhooks of Homescript `%s`: Executing query failed: %s", homescriptId, err.Error()))
+		return err
+	}
+
+	dependenciesChanged()
+	return nil
+}
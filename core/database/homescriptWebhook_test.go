@@ -0,0 +1,65 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateHomescriptWebhookTable(t *testing.T) {
+	assert.NoError(t, createHomescriptWebhookTable())
+}
+
+func TestHomescriptWebhooks(t *testing.T) {
+	assert.NoError(t, CreateNewHomescript(Homescript{
+		Owner: "admin",
+		Data: HomescriptData{
+			Id:   "webhook_test",
+			Name: "Webhook Test",
+		},
+	}))
+
+	secret := "top_secret"
+	table := []HomescriptWebhook{
+		{
+			Id:           "00000000000000000000000000000001",
+			Owner:        "admin",
+			HomescriptId: "webhook_test",
+			Name:         "nas",
+			Methods:      []string{"POST", "PUT"},
+			HmacSecret:   &secret,
+		},
+		{
+			Id:           "00000000000000000000000000000002",
+			Owner:        "admin",
+			HomescriptId: "webhook_test",
+			Name:         "doorbell",
+			Methods:      []string{},
+			HmacSecret:   nil,
+		},
+	}
+
+	for _, webhook := range table {
+		assert.NoError(t, CreateHomescriptWebhook(webhook))
+
+		stored, found, err := GetHomescriptWebhookById(webhook.Id)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, webhook, stored)
+	}
+
+	webhooks, err := ListHomescriptWebhooksOfUser("admin")
+	assert.NoError(t, err)
+	assert.Len(t, webhooks, len(table))
+
+	assert.NoError(t, DeleteHomescriptWebhook(table[0].Id, "admin"))
+	_, found, err := GetHomescriptWebhookById(table[0].Id)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// Deleting the Homescript must also delete its webhooks
+	assert.NoError(t, DeleteHomescriptById("webhook_test", "admin"))
+	webhooks, err = ListHomescriptWebhooksOfUser("admin")
+	assert.NoError(t, err)
+	assert.Len(t, webhooks, 0)
+}
@@ -23,6 +23,16 @@ func Init(databaseConfig DatabaseConfig, adminPassword string) error {
 	}
 	log.Trace("Initializing database schema...")
 	db = dbTemp
+	// Are part of the server configuration and must therefore exist beforehand
+	if err := createMqttBrokerConfigTable(); err != nil {
+		return err
+	}
+	if err := createMqttTLSConfigTable(); err != nil {
+		return err
+	}
+	if err := createMqttConnectionTable(); err != nil {
+		return err
+	}
 	if err := createConfigTable(); err != nil {
 		return err
 	}
@@ -62,6 +72,9 @@ func Init(databaseConfig DatabaseConfig, adminPassword string) error {
 	if err := createHasCameraPermissionsTable(); err != nil {
 		return err
 	}
+	if err := createCameraSnapshotTable(); err != nil {
+		return err
+	}
 	// if err := createHardwareNodeTable(); err != nil {
 	// 	return err
 	// }
@@ -101,6 +114,48 @@ func Init(databaseConfig DatabaseConfig, adminPassword string) error {
 	if err := createWeatherTable(); err != nil {
 		return err
 	}
+	if err := createHomescriptQuotaTable(); err != nil {
+		return err
+	}
+	if err := createHomescriptRunTable(); err != nil {
+		return err
+	}
+	if err := createHomescriptRunRetentionTable(); err != nil {
+		return err
+	}
+	if err := createHomescriptWebhookTable(); err != nil {
+		return err
+	}
+	if err := createHomescriptLibraryTables(); err != nil {
+		return err
+	}
+	if err := createHomescriptSecretTable(); err != nil {
+		return err
+	}
+	if err := createHomescriptStorageEntryTable(); err != nil {
+		return err
+	}
+	if err := createHomescriptNetworkHostTable(); err != nil {
+		return err
+	}
+	if err := createDeviceDriverNetworkHostTable(); err != nil {
+		return err
+	}
+	if err := createDeviceDriverMetaTable(); err != nil {
+		return err
+	}
+	if err := createDeviceDriverSnapshotTable(); err != nil {
+		return err
+	}
+	if err := createDeviceInvocationPolicyTables(); err != nil {
+		return err
+	}
+	if err := createHomeAssistantConfigTable(); err != nil {
+		return err
+	}
+	if err := createMqttBridgeConfigTable(); err != nil {
+		return err
+	}
 	log.Info(fmt.Sprintf("Successfully initialized database `%s`", databaseConfig.Database))
 	return nil
 }
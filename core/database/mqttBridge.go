@@ -0,0 +1,88 @@
+package database
+
+// Controls the bridge which publishes the state of devices to MQTT and accepts commands
+type MqttBridgeConfig struct {
+	Enabled bool `json:"enabled"`
+	// Commands are executed as this user, only the devices of this user are bridged
+	// The bridge cannot be enabled without a user
+	Username *string `json:"username"`
+	// How often the state of every device is checked for changes which did not originate from actions
+	PollIntervalSeconds uint `json:"pollIntervalSeconds"`
+}
+
+// Creates the table containing the configuration of the MQTT bridge
+// If no configuration exists, a disabled default configuration is inserted
+func createMqttBridgeConfigTable() error {
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	mqttBridgeConfig(
+		Id					INT PRIMARY KEY,
+		Enabled				BOOLEAN NOT NULL DEFAULT FALSE,
+		Username			VARCHAR(20) NULL,
+		PollIntervalSeconds	INT UNSIGNED NOT NULL DEFAULT 30
+	)
+	`); err != nil {
+		log.Error("Failed to create MQTT bridge config table: Executing query failed: ", err.Error())
+		return err
+	}
+
+	if _, err := db.Exec(`
+	INSERT IGNORE INTO
+	mqttBridgeConfig(Id)
+	VALUES(0)
+	`); err != nil {
+		log.Error("Failed to create MQTT bridge config: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the configuration of the MQTT bridge
+func GetMqttBridgeConfig() (MqttBridgeConfig, error) {
+	var config MqttBridgeConfig
+	if err := db.QueryRow(`
+	SELECT
+		Enabled,
+		Username,
+		PollIntervalSeconds
+	FROM mqttBridgeConfig
+	WHERE Id=0
+	`).Scan(
+		&config.Enabled,
+		&config.Username,
+		&config.PollIntervalSeconds,
+	); err != nil {
+		log.Error("Could not get MQTT bridge config: Executing query failed: ", err.Error())
+		return MqttBridgeConfig{}, err
+	}
+	return config, nil
+}
+
+// Updates the configuration of the MQTT bridge
+func SetMqttBridgeConfig(config MqttBridgeConfig) error {
+	query, err := db.Prepare(`
+	UPDATE mqttBridgeConfig
+	SET
+		Enabled=?,
+		Username=?,
+		PollIntervalSeconds=?
+	WHERE Id=0
+	`)
+	if err != nil {
+		log.Error("Could not set MQTT bridge config: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+
+	if _, err := query.Exec(
+		config.Enabled,
+		config.Username,
+		config.PollIntervalSeconds,
+	); err != nil {
+		log.Error("Could not set MQTT bridge config: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
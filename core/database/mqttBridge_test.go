@@ -0,0 +1,36 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMqttBridgeConfigTable(t *testing.T) {
+	assert.NoError(t, createMqttBridgeConfigTable())
+}
+
+func TestMqttBridgeConfig(t *testing.T) {
+	username := "admin"
+
+	table := []MqttBridgeConfig{
+		{
+			Enabled:             true,
+			Username:            &username,
+			PollIntervalSeconds: 15,
+		},
+		{
+			Enabled:             false,
+			Username:            nil,
+			PollIntervalSeconds: 30,
+		},
+	}
+
+	for _, test := range table {
+		assert.NoError(t, SetMqttBridgeConfig(test))
+
+		stored, err := GetMqttBridgeConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, test, stored)
+	}
+}
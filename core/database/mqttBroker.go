@@ -0,0 +1,103 @@
+package database
+
+// Controls the embedded MQTT broker which can be used instead of an external broker
+// If enabled, the server's MQTT subsystem connects to the embedded broker, the external broker settings are ignored
+type MqttBrokerConfig struct {
+	Enabled bool `json:"enabled"`
+	// The IP address on which the embedded broker listens, `0.0.0.0` exposes it on all interfaces
+	Address string `json:"address"`
+	Port    uint16 `json:"port"`
+	// PEM encoded certificate and key, if both are set, clients have to connect using TLS
+	TLSCertificate string `json:"tlsCertificate"`
+	TLSKey         string `json:"tlsKey"`
+}
+
+// Creates the table containing the configuration of the embedded MQTT broker
+// If no configuration exists, a disabled default configuration is inserted
+func createMqttBrokerConfigTable() error {
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	mqttBrokerConfig(
+		Id				INT PRIMARY KEY,
+		Enabled			BOOLEAN NOT NULL DEFAULT FALSE,
+		Address			VARCHAR(45) NOT NULL DEFAULT '127.0.0.1',
+		Port			SMALLINT UNSIGNED NOT NULL DEFAULT 1883,
+		TLSCertificate	MEDIUMTEXT NOT NULL,
+		TLSKey			MEDIUMTEXT NOT NULL
+	)
+	`); err != nil {
+		log.Error("Failed to create MQTT broker config table: Executing query failed: ", err.Error())
+		return err
+	}
+
+	if _, err := db.Exec(`
+	INSERT IGNORE INTO
+	mqttBrokerConfig(
+		Id,
+		TLSCertificate,
+		TLSKey
+	)
+	VALUES(0, "", "")
+	`); err != nil {
+		log.Error("Failed to create MQTT broker config: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the configuration of the embedded MQTT broker
+func GetMqttBrokerConfig() (MqttBrokerConfig, error) {
+	var config MqttBrokerConfig
+	if err := db.QueryRow(`
+	SELECT
+		Enabled,
+		Address,
+		Port,
+		TLSCertificate,
+		TLSKey
+	FROM mqttBrokerConfig
+	WHERE Id=0
+	`).Scan(
+		&config.Enabled,
+		&config.Address,
+		&config.Port,
+		&config.TLSCertificate,
+		&config.TLSKey,
+	); err != nil {
+		log.Error("Could not get MQTT broker config: Executing query failed: ", err.Error())
+		return MqttBrokerConfig{}, err
+	}
+	return config, nil
+}
+
+// Updates the configuration of the embedded MQTT broker
+func SetMqttBrokerConfig(config MqttBrokerConfig) error {
+	query, err := db.Prepare(`
+	UPDATE mqttBrokerConfig
+	SET
+		Enabled=?,
+		Address=?,
+		Port=?,
+		TLSCertificate=?,
+		TLSKey=?
+	WHERE Id=0
+	`)
+	if err != nil {
+		log.Error("Could not set MQTT broker config: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+	if _, err := query.Exec(
+		config.Enabled,
+		config.Address,
+		config.Port,
+		config.TLSCertificate,
+		config.TLSKey,
+	); err != nil {
+		log.Error("Could not set MQTT broker config: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateMqttBrokerConfigTable(t *testing.T) {
+	assert.NoError(t, createMqttBrokerConfigTable())
+}
+
+func TestMqttBrokerConfig(t *testing.T) {
+	table := []MqttBrokerConfig{
+		{
+			Enabled:        true,
+			Address:        "0.0.0.0",
+			Port:           1884,
+			TLSCertificate: "certificate",
+			TLSKey:         "key",
+		},
+		{
+			Enabled:        false,
+			Address:        "127.0.0.1",
+			Port:           1883,
+			TLSCertificate: "",
+			TLSKey:         "",
+		},
+	}
+
+	for _, test := range table {
+		assert.NoError(t, SetMqttBrokerConfig(test))
+		stored, err := GetMqttBrokerConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, test, stored)
+	}
+}
+
+func TestServerConfigContainsMqttBrokerConfig(t *testing.T) {
+	mqttConfig := MqttConfig{
+		Enabled:  true,
+		Host:     "localhost",
+		Port:     1883,
+		Username: "smarthome",
+		Password: "",
+		Broker: MqttBrokerConfig{
+			Enabled:        true,
+			Address:        "127.0.0.1",
+			Port:           1885,
+			TLSCertificate: "",
+			TLSKey:         "",
+		},
+		Connections: []MqttBrokerConnection{},
+	}
+
+	assert.NoError(t, UpdateMqttConfig(mqttConfig))
+
+	config, found, err := GetServerConfiguration()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, mqttConfig, config.Mqtt)
+
+	mqttConfig.Enabled = false
+	mqttConfig.Broker = MqttBrokerConfig{Enabled: false, Address: "127.0.0.1", Port: 1883}
+	assert.NoError(t, UpdateMqttConfig(mqttConfig))
+}
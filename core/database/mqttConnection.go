@@ -0,0 +1,249 @@
+package database
+
+// TLS settings of a connection to an MQTT broker
+type MqttTLSConfig struct {
+	Enabled bool `json:"enabled"`
+	// PEM encoded certificates which are used to verify the broker
+	// If empty, the system's root certificates are used
+	CaBundle string `json:"caBundle"`
+	// PEM encoded client certificate and its key, both are optional but must be specified together
+	ClientCertificate string `json:"clientCertificate"`
+	ClientKey         string `json:"clientKey"`
+	// Disables the verification of the broker's certificate, should only be used for testing
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+}
+
+// An additional, named MQTT broker to which the server connects alongside the default broker
+type MqttBrokerConnection struct {
+	// Is used to select the broker in Homescript, `default` is reserved for the default broker
+	Name     string        `json:"name"`
+	Enabled  bool          `json:"enabled"`
+	Host     string        `json:"host"`
+	Port     uint16        `json:"port"`
+	Username string        `json:"username"`
+	Password string        `json:"password"`
+	TLS      MqttTLSConfig `json:"tls"`
+}
+
+// Creates the table containing the TLS settings of the default MQTT broker
+// If no settings exist, TLS is disabled
+func createMqttTLSConfigTable() error {
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	mqttTLSConfig(
+		Id					INT PRIMARY KEY,
+		Enabled				BOOLEAN NOT NULL DEFAULT FALSE,
+		CaBundle			MEDIUMTEXT NOT NULL,
+		ClientCertificate	MEDIUMTEXT NOT NULL,
+		ClientKey			MEDIUMTEXT NOT NULL,
+		InsecureSkipVerify	BOOLEAN NOT NULL DEFAULT FALSE
+	)
+	`); err != nil {
+		log.Error("Failed to create MQTT TLS config table: Executing query failed: ", err.Error())
+		return err
+	}
+
+	if _, err := db.Exec(`
+	INSERT IGNORE INTO
+	mqttTLSConfig(
+		Id,
+		Enabled,
+		CaBundle,
+		ClientCertificate,
+		ClientKey,
+		InsecureSkipVerify
+	)
+	VALUES(0, FALSE, "", "", "", FALSE)
+	`); err != nil {
+		log.Error("Failed to create MQTT TLS config: Executing query failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// Returns the TLS settings of the default MQTT broker
+func GetMqttTLSConfig() (MqttTLSConfig, error) {
+	var config MqttTLSConfig
+	if err := db.QueryRow(`
+	SELECT
+		Enabled,
+		CaBundle,
+		ClientCertificate,
+		ClientKey,
+		InsecureSkipVerify
+	FROM mqttTLSConfig
+	WHERE Id=0
+	`).Scan(
+		&config.Enabled,
+		&config.CaBundle,
+		&config.ClientCertificate,
+		&config.ClientKey,
+		&config.InsecureSkipVerify,
+	); err != nil {
+		log.Error("Could not get MQTT TLS config: Executing query failed: ", err.Error())
+		return MqttTLSConfig{}, err
+	}
+	return config, nil
+}
+
+// Updates the TLS settings of the default MQTT broker
+func SetMqttTLSConfig(config MqttTLSConfig) error {
+	query, err := db.Prepare(`
+	UPDATE mqttTLSConfig
+	SET
+		Enabled=?,
+		CaBundle=?,
+		ClientCertificate=?,
+		ClientKey=?,
+		InsecureSkipVerify=?
+	WHERE Id=0
+	`)
+	if err != nil {
+		log.Error("Could not set MQTT TLS config: Preparing query failed: ", err.Error())
+		return err
+	}
+	defer query.Close()
+	if _, err := query.Exec(
+		config.Enabled,
+		config.CaBundle,
+		config.ClientCertificate,
+		config.ClientKey,
+		config.InsecureSkipVerify,
+	); err != nil {
+		log.Error("Could not set MQTT TLS config: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Creates the table containing the additional, named MQTT brokers
+func createMqttConnectionTable() error {
+	if _, err := db.Exec(`
+	CREATE TABLE
+	IF NOT EXISTS
+	mqttConnection(
+		Name				VARCHAR(30) PRIMARY KEY,
+		Enabled				BOOLEAN NOT NULL,
+		Host				TEXT NOT NULL,
+		Port				SMALLINT UNSIGNED NOT NULL,
+		Username			TEXT NOT NULL,
+		Password			TEXT NOT NULL,
+		TLSEnabled			BOOLEAN NOT NULL,
+		CaBundle			MEDIUMTEXT NOT NULL,
+		ClientCertificate	MEDIUMTEXT NOT NULL,
+		ClientKey			MEDIUMTEXT NOT NULL,
+		InsecureSkipVerify	BOOLEAN NOT NULL
+	)
+	`); err != nil {
+		log.Error("Failed to create MQTT connection table: Executing query failed: ", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Returns the additional, named MQTT brokers ordered by their name
+func ListMqttConnections() ([]MqttBrokerConnection, error) {
+	res, err := db.Query(`
+	SELECT
+		Name,
+		Enabled,
+		Host,
+		Port,
+		Username,
+		Password,
+		TLSEnabled,
+		CaBundle,
+		ClientCertificate,
+		ClientKey,
+		InsecureSkipVerify
+	FROM mqttConnection
+	ORDER BY Name ASC
+	`)
+	if err != nil {
+		log.Error("Could not list MQTT connections: Executing query failed: ", err.Error())
+		return nil, err
+	}
+	defer res.Close()
+
+	connections := make([]MqttBrokerConnection, 0)
+	for res.Next() {
+		var connection MqttBrokerConnection
+		if err := res.Scan(
+			&connection.Name,
+			&connection.Enabled,
+			&connection.Host,
+			&connection.Port,
+			&connection.Username,
+			&connection.Password,
+			&connection.TLS.Enabled,
+			&connection.TLS.CaBundle,
+			&connection.TLS.ClientCertificate,
+			&connection.TLS.ClientKey,
+			&connection.TLS.InsecureSkipVerify,
+		); err != nil {
+			log.Error("Could not list MQTT connections: Failed to scan results: ", err.Error())
+			return nil, err
+		}
+		connections = append(connections, connection)
+	}
+	return connections, nil
+}
+
+// Replaces all additional, named MQTT brokers
+func SetMqttConnections(connections []MqttBrokerConnection) error {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error("Could not set MQTT connections: Starting transaction failed: ", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mqttConnection`); err != nil {
+		log.Error("Could not set MQTT connections: Deleting old connections failed: ", err.Error())
+		return err
+	}
+
+	for _, connection := range connections {
+		if _, err := tx.Exec(`
+		INSERT INTO
+		mqttConnection(
+			Name,
+			Enabled,
+			Host,
+			Port,
+			Username,
+			Password,
+			TLSEnabled,
+			CaBundle,
+			ClientCertificate,
+			ClientKey,
+			InsecureSkipVerify
+		)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			connection.Name,
+			connection.Enabled,
+			connection.Host,
+			connection.Port,
+			connection.Username,
+			connection.Password,
+			connection.TLS.Enabled,
+			connection.TLS.CaBundle,
+			connection.TLS.ClientCertificate,
+			connection.TLS.ClientKey,
+			connection.TLS.InsecureSkipVerify,
+		); err != nil {
+			log.Error("Could not set MQTT connections: Executing query failed: ", err.Error())
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error("Could not set MQTT connections: Committing transaction failed: ", err.Error())
+		return err
+	}
+
+	return nil
+}
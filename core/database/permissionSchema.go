@@ -24,6 +24,7 @@ const (
 	PermissionModifyRooms       PermissionType = "modifyRooms"
 	PermissionHomescript        PermissionType = "homescript"
 	PermissionHomescriptNetwork PermissionType = "hmsNetwork"
+	PermissionMqttBroker        PermissionType = "mqttBroker"
 	PermissionWildCard          PermissionType = "*"
 )
 
@@ -95,6 +96,12 @@ var (
 			Name:        "View Cameras",
 			Description: "View camera image feeds (depends on camera-permissions)",
 		},
+		{
+			// User is allowed to connect to the embedded MQTT broker using their password or an API token
+			Permission:  PermissionMqttBroker,
+			Name:        "MQTT Broker",
+			Description: "Connect to the embedded MQTT broker",
+		},
 		{
 			// (Admin) is allowed to change global config parameters
 			Permission:  PermissionSystemConfig,
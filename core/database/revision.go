@@ -0,0 +1,17 @@
+package database
+
+import "sync/atomic"
+
+// Is incremented after Homescripts, schedules, automations, webhooks, libraries or drivers were modified.
+// Caches which are derived from these resources (like the dependency index) compare it in order to detect that they are stale.
+var dependencyRevision atomic.Uint64
+
+func dependenciesChanged() {
+	dependencyRevision.Add(1)
+}
+
+// Returns the current revision of the resources which Homescript dependencies are derived from.
+// The revision must be read before the resources so that concurrent modifications are never missed.
+func DependencyRevision() uint64 {
+	return dependencyRevision.Load()
+}
@@ -111,6 +111,7 @@ func CreateNewSchedule(
 			return 0, err
 		}
 	}
+	dependenciesChanged()
 	return uint(newId), nil
 }
 
@@ -346,6 +347,7 @@ func ModifySchedule(id uint, newData ScheduleData) error {
 			return err
 		}
 	}
+	dependenciesChanged()
 	return nil
 }
 
@@ -412,6 +414,7 @@ func DeleteScheduleById(id uint) error {
 		log.Error("Failed to delete schedule by id: executing query failed: ", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
 
@@ -168,6 +168,7 @@ func CreateNewScheduleDeviceJob(
 		log.Error("Failed to create new schedule device job: failed to obtain inserted Id: ", err.Error())
 		return 0, err
 	}
+	dependenciesChanged()
 	return uint(newId), nil
 }
 
@@ -187,6 +188,7 @@ func DeleteAllDeviceJobsFromSchedule(scheduleId uint) error {
 		log.Error("Failed to delete all device jobs from schedule: executing query failed: ", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
 
@@ -213,5 +215,6 @@ func DeleteDeviceJobFromSchedule(
 		log.Error(`Failed to delete device job from schedule: executing query failed: `, err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
@@ -173,6 +173,24 @@ func DeleteUser(username string) error {
 	if err := DeleteHomescriptStorageOfUser(username); err != nil {
 		return err
 	}
+	if err := DeleteHomescriptQuotasOfUser(username); err != nil {
+		return err
+	}
+	if err := DeleteHomescriptRunsOfUser(username); err != nil {
+		return err
+	}
+	if err := DeleteHomescriptLibraryAccessOfUser(username); err != nil {
+		return err
+	}
+	if err := DeleteHomescriptSecretsOfUser(username); err != nil {
+		return err
+	}
+	if err := DeleteHomescriptStorageEntriesOfUser(username); err != nil {
+		return err
+	}
+	if err := RemoveAllNetworkHostsOfUser(username); err != nil {
+		return err
+	}
 	if err := DeleteAllHomescriptsOfUser(username); err != nil {
 		return err
 	}
@@ -182,6 +200,9 @@ func DeleteUser(username string) error {
 	if err := RemoveAllCameraPermissionsOfUser(username); err != nil {
 		return err
 	}
+	if err := DeleteCameraSnapshotsOfUser(username); err != nil {
+		return err
+	}
 	if err := RemoveAllTokensOfUser(username); err != nil {
 		return err
 	}
@@ -199,6 +220,7 @@ func DeleteUser(username string) error {
 		log.Error("Could not delete user. Failed to execute query: ", err.Error())
 		return err
 	}
+	dependenciesChanged()
 	return nil
 }
 
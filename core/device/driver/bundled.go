@@ -0,0 +1,215 @@
+package driver
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/smarthome-go/smarthome/core/database"
+)
+
+//
+// Bundled drivers.
+// Smarthome ships drivers for devices which speak one of the common MQTT dialects (Tasmota, Shelly Gen2 and Zigbee2MQTT).
+// They keep the state of their devices up to date using MQTT trigger annotations and publish commands to the broker.
+// Bundled drivers are installed and upgraded like any other driver package.
+//
+
+//go:embed bundled/*.hms
+var bundledDriverCode embed.FS
+
+type bundledDriver struct {
+	file          string
+	manifest      DriverPackageManifest
+	defaultConfig map[string]interface{}
+}
+
+var tasmotaDefaultConfig = map[string]interface{}{
+	"command_prefix": "cmnd",
+	"stat_prefix":    "stat",
+	"tele_prefix":    "tele",
+}
+
+var shellyGen2DefaultConfig = map[string]interface{}{
+	"client_id": "smarthome",
+}
+
+var zigbee2MqttDefaultConfig = map[string]interface{}{
+	"base_topic": "zigbee2mqtt",
+}
+
+var bundledDrivers = []bundledDriver{
+	{
+		file: "bundled/tasmota_plug.hms",
+		manifest: DriverPackageManifest{
+			VendorID:             "tasmota",
+			ModelID:              "plug",
+			Name:                 "Tasmota Plug",
+			Version:              "1.0.0",
+			Description:          "Plugs running the Tasmota firmware, reports the energy usage of plugs which measure it",
+			Icon:                 "",
+			RequiredCapabilities: []DeviceCapability{DeviceCapabilityPower, DeviceCapabilitySensor},
+			MinServerVersion:     "",
+		},
+		defaultConfig: tasmotaDefaultConfig,
+	},
+	{
+		file: "bundled/tasmota_light.hms",
+		manifest: DriverPackageManifest{
+			VendorID:             "tasmota",
+			ModelID:              "light",
+			Name:                 "Tasmota Light",
+			Version:              "1.0.0",
+			Description:          "Dimmable lights running the Tasmota firmware",
+			Icon:                 "",
+			RequiredCapabilities: []DeviceCapability{DeviceCapabilityPower, DeviceCapabilityDimmable},
+			MinServerVersion:     "",
+		},
+		defaultConfig: tasmotaDefaultConfig,
+	},
+	{
+		file: "bundled/shelly_gen2_switch.hms",
+		manifest: DriverPackageManifest{
+			VendorID:             "shelly",
+			ModelID:              "gen2_switch",
+			Name:                 "Shelly Gen2 Switch",
+			Version:              "1.0.0",
+			Description:          "Shelly Plus and Pro switches and plugs, requires generic status updates over MQTT",
+			Icon:                 "",
+			RequiredCapabilities: []DeviceCapability{DeviceCapabilityPower, DeviceCapabilitySensor},
+			MinServerVersion:     "",
+		},
+		defaultConfig: shellyGen2DefaultConfig,
+	},
+	{
+		file: "bundled/shelly_gen2_light.hms",
+		manifest: DriverPackageManifest{
+			VendorID:             "shelly",
+			ModelID:              "gen2_light",
+			Name:                 "Shelly Gen2 Dimmer",
+			Version:              "1.0.0",
+			Description:          "Shelly Plus and Pro dimmers, requires generic status updates over MQTT",
+			Icon:                 "",
+			RequiredCapabilities: []DeviceCapability{DeviceCapabilityPower, DeviceCapabilityDimmable},
+			MinServerVersion:     "",
+		},
+		defaultConfig: shellyGen2DefaultConfig,
+	},
+	{
+		file: "bundled/zigbee2mqtt_light.hms",
+		manifest: DriverPackageManifest{
+			VendorID:             "zigbee2mqtt",
+			ModelID:              "light",
+			Name:                 "Zigbee2MQTT Light",
+			Version:              "1.0.0",
+			Description:          "Dimmable Zigbee lights which are connected through Zigbee2MQTT",
+			Icon:                 "",
+			RequiredCapabilities: []DeviceCapability{DeviceCapabilityPower, DeviceCapabilityDimmable},
+			MinServerVersion:     "",
+		},
+		defaultConfig: zigbee2MqttDefaultConfig,
+	},
+	{
+		file: "bundled/zigbee2mqtt_plug.hms",
+		manifest: DriverPackageManifest{
+			VendorID:             "zigbee2mqtt",
+			ModelID:              "plug",
+			Name:                 "Zigbee2MQTT Plug",
+			Version:              "1.0.0",
+			Description:          "Zigbee plugs which are connected through Zigbee2MQTT",
+			Icon:                 "",
+			RequiredCapabilities: []DeviceCapability{DeviceCapabilityPower, DeviceCapabilitySensor},
+			MinServerVersion:     "",
+		},
+		defaultConfig: zigbee2MqttDefaultConfig,
+	},
+	{
+		file: "bundled/zigbee2mqtt_sensor.hms",
+		manifest: DriverPackageManifest{
+			VendorID:             "zigbee2mqtt",
+			ModelID:              "sensor",
+			Name:                 "Zigbee2MQTT Sensor",
+			Version:              "1.0.0",
+			Description:          "Zigbee sensors which are connected through Zigbee2MQTT",
+			Icon:                 "",
+			RequiredCapabilities: []DeviceCapability{DeviceCapabilitySensor},
+			MinServerVersion:     "",
+		},
+		defaultConfig: zigbee2MqttDefaultConfig,
+	},
+}
+
+type BundledDriver struct {
+	Manifest DriverPackageManifest `json:"manifest"`
+	// Is `nil` if the driver is not installed.
+	InstalledVersion *string `json:"installedVersion"`
+}
+
+func (self bundledDriver) driverPackage() DriverPackage {
+	code, err := bundledDriverCode.ReadFile(self.file)
+	if err != nil {
+		panic(fmt.Sprintf("Bundled driver `%s` is not embedded: %s", self.file, err.Error()))
+	}
+
+	// Each package receives its own copy of the default config as it might be modified during the import.
+	defaultConfig := make(map[string]interface{})
+	for key, item := range self.defaultConfig {
+		defaultConfig[key] = item
+	}
+
+	return DriverPackage{
+		FormatVersion:  DriverPackageFormatVersion,
+		Manifest:       self.manifest,
+		HomescriptCode: string(code),
+		DefaultConfig:  defaultConfig,
+	}
+}
+
+// Returns the package of a bundled driver.
+func BundledDriverPackage(vendorID, modelID string) (pkg DriverPackage, found bool) {
+	for _, bundled := range bundledDrivers {
+		if bundled.manifest.VendorID == vendorID && bundled.manifest.ModelID == modelID {
+			return bundled.driverPackage(), true
+		}
+	}
+
+	return DriverPackage{}, false
+}
+
+// Lists every bundled driver along with its installed version.
+func ListBundledDrivers() ([]BundledDriver, error) {
+	drivers := make([]BundledDriver, 0, len(bundledDrivers))
+
+	for _, bundled := range bundledDrivers {
+		installed, found, err := database.GetDeviceDriver(bundled.manifest.VendorID, bundled.manifest.ModelID)
+		if err != nil {
+			return nil, err
+		}
+
+		var installedVersion *string
+		if found {
+			installedVersion = &installed.Version
+		}
+
+		drivers = append(drivers, BundledDriver{
+			Manifest:         bundled.manifest,
+			InstalledVersion: installedVersion,
+		})
+	}
+
+	return drivers, nil
+}
+
+// Installs a bundled driver or upgrades the installed driver of the same vendor and model (see `ImportDriverPackage`).
+func (d DriverManager) InstallBundledDriver(
+	vendorID string,
+	modelID string,
+	serverVersion string,
+) (result DriverPackageImportResult, found bool, validationErr error, dbErr error) {
+	pkg, found := BundledDriverPackage(vendorID, modelID)
+	if !found {
+		return DriverPackageImportResult{}, false, nil, nil
+	}
+
+	result, validationErr, dbErr = d.ImportDriverPackage(pkg, serverVersion, false)
+	return result, true, validationErr, dbErr
+}
@@ -0,0 +1,81 @@
+package driver
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundledDriverPackages(t *testing.T) {
+	requiredFunctions := map[DeviceCapability][]string{
+		DeviceCapabilityPower:    {DeviceFunctionSetPower, DeviceFunctionReportPowerState, DeviceFunctionReportPowerDraw},
+		DeviceCapabilityDimmable: {DeviceFunctionSetDim, DeviceFunctionReportDim},
+		DeviceCapabilitySensor:   {DeviceFunctionReportSensorReadings},
+	}
+
+	implPattern := regexp.MustCompile(`impl Device for \$Device with \{ ([a-z, ]+) \}`)
+	seen := make(map[database.DriverTuple]bool)
+
+	for _, bundled := range bundledDrivers {
+		manifest := bundled.manifest
+		tuple := database.DriverTuple{VendorID: manifest.VendorID, ModelID: manifest.ModelID}
+
+		assert.False(t, seen[tuple], "duplicate bundled driver %v", tuple)
+		seen[tuple] = true
+
+		assert.NoError(t, validateDriverPackageID("vendor", manifest.VendorID))
+		assert.NoError(t, validateDriverPackageID("model", manifest.ModelID))
+
+		_, err := ParseDriverVersion(manifest.Version)
+		assert.NoError(t, err)
+
+		pkg, found := BundledDriverPackage(manifest.VendorID, manifest.ModelID)
+		assert.True(t, found)
+		assert.Equal(t, manifest, pkg.Manifest)
+		assert.Equal(t, uint(DriverPackageFormatVersion), pkg.FormatVersion)
+
+		code := pkg.HomescriptCode
+		assert.NotEmpty(t, code)
+
+		// The implemented capabilities must match the manifest.
+		impl := implPattern.FindStringSubmatch(code)
+		if assert.NotNil(t, impl, "%v does not implement any capabilities", tuple) {
+			implemented := strings.Split(impl[1], ", ")
+			assert.Len(t, implemented, len(manifest.RequiredCapabilities), "%v", tuple)
+
+			for _, capability := range manifest.RequiredCapabilities {
+				assert.Contains(t, implemented, string(capability), "%v", tuple)
+
+				for _, function := range requiredFunctions[capability] {
+					assert.Contains(t, code, fmt.Sprintf("pub fn %s(self: $Device", function), "%v", tuple)
+				}
+			}
+		}
+
+		// The default config must only contain driver settings.
+		for key := range bundled.defaultConfig {
+			assert.Contains(t, code, fmt.Sprintf("@setting %s: str,", key), "%v", tuple)
+		}
+
+		// The state is kept up to date using MQTT messages.
+		assert.Contains(t, code, "@trigger on message(", "%v", tuple)
+	}
+
+	_, found := BundledDriverPackage("tasmota", "does_not_exist")
+	assert.False(t, found)
+}
+
+func TestBundledDriverPackageConfigIsCopied(t *testing.T) {
+	pkg, found := BundledDriverPackage("zigbee2mqtt", "light")
+	assert.True(t, found)
+
+	pkg.DefaultConfig.(map[string]interface{})["base_topic"] = "modified"
+
+	pkg, found = BundledDriverPackage("zigbee2mqtt", "light")
+	assert.True(t, found)
+	assert.Equal(t, "zigbee2mqtt", pkg.DefaultConfig.(map[string]interface{})["base_topic"])
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"slices"
+	"sync"
 
 	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
 	"github.com/smarthome-go/smarthome/core/database"
@@ -34,6 +35,8 @@ type DeviceExtractions struct {
 	PowerInformation    DevicePowerInformation                   `json:"powerInformation"`
 	DimmableInformation []DriverActionReportDimOutput            `json:"dimmables"`
 	SensorReadings      []DriverActionReportSensorReadingsOutput `json:"sensors"`
+	// If the breaker is open, the information above is the last value which was reported successfully.
+	CircuitBreaker DeviceBreakerStatus `json:"circuitBreaker"`
 }
 
 type DevicePowerInformation struct {
@@ -45,10 +48,10 @@ func (d DriverManager) shallowSorter(input *[]database.ShallowDevice) error {
 	needsRebuild := false
 
 	for _, dev := range *input {
-		_, found := CachedDriverMeta[database.DriverTuple{
+		_, found := cachedDriverInfo(database.DriverTuple{
 			VendorID: dev.VendorID,
 			ModelID:  dev.ModelID,
-		}]
+		})
 
 		if !found {
 			needsRebuild = true
@@ -63,13 +66,18 @@ func (d DriverManager) shallowSorter(input *[]database.ShallowDevice) error {
 		}
 	}
 
+	// The cache might be rebuilt concurrently, therefore, the sort uses a consistent snapshot.
+	cachedDriverMetaLock.RLock()
+	meta := cachedDriverMeta
+	cachedDriverMetaLock.RUnlock()
+
 	slices.SortFunc[[]database.ShallowDevice](*input, func(_a database.ShallowDevice, _b database.ShallowDevice) int {
-		a := CachedDriverMeta[database.DriverTuple{
+		a := meta[database.DriverTuple{
 			VendorID: _a.VendorID,
 			ModelID:  _a.ModelID,
 		}]
 
-		b := CachedDriverMeta[database.DriverTuple{
+		b := meta[database.DriverTuple{
 			VendorID: _b.VendorID,
 			ModelID:  _b.ModelID,
 		}]
@@ -170,7 +178,10 @@ func (d DriverManager) EnrichDeviceAll(deviceID string) (RichDevice, bool, error
 func (d DriverManager) EnrichDevice(device database.ShallowDevice, fittingDriver RichDriver) (RichDevice, error) {
 	hmsErrors := types.HmsErrorsFromDiagnostics(fittingDriver.ValidationErrors)
 
+	ValueStoreLock.RLock()
 	storedDeviceValue := DeviceStore[device.ID]
+	ValueStoreLock.RUnlock()
+
 	savedConfig, _ := value.MarshalValue(
 		filterObjFieldsWithoutSetting(storedDeviceValue, fittingDriver.ExtractedInfo.DeviceConfig.Info.HmsType),
 		false,
@@ -250,6 +261,11 @@ func (d DriverManager) EnrichDevice(device database.ShallowDevice, fittingDriver
 		sensorReadings = readingsTemp
 	}
 
+	breaker, err := DeviceBreaker(device.ID, device.VendorID, device.ModelID)
+	if err != nil {
+		return RichDevice{}, err
+	}
+
 	return RichDevice{
 		Shallow: ShallowDevice{
 			DeviceType:     device.DeviceType,
@@ -269,6 +285,7 @@ func (d DriverManager) EnrichDevice(device database.ShallowDevice, fittingDriver
 			},
 			DimmableInformation: dimmableInformation,
 			SensorReadings:      sensorReadings,
+			CircuitBreaker:      breaker,
 		},
 	}, nil
 }
@@ -423,7 +440,18 @@ func (d DriverManager) EnrichDevice(device database.ShallowDevice, fittingDriver
 // 	return output, nil
 // }
 
-var CachedDriverMeta map[database.DriverTuple]DriverInfo = make(map[database.DriverTuple]DriverInfo)
+// Is replaced as a whole by `RebuildCache` and never modified in place, the lock only protects the variable.
+// It must only be accessed via `cachedDriverInfo` or while holding the lock.
+var cachedDriverMeta map[database.DriverTuple]DriverInfo = make(map[database.DriverTuple]DriverInfo)
+var cachedDriverMetaLock sync.RWMutex
+
+func cachedDriverInfo(tuple database.DriverTuple) (DriverInfo, bool) {
+	cachedDriverMetaLock.RLock()
+	defer cachedDriverMetaLock.RUnlock()
+
+	info, found := cachedDriverMeta[tuple]
+	return info, found
+}
 
 // TODO: only run this function on drivers which actually changed
 func (d DriverManager) RebuildCache() error {
@@ -433,13 +461,19 @@ func (d DriverManager) RebuildCache() error {
 		return err
 	}
 
+	// Extracting the driver info might take a while, readers keep using the old cache meanwhile.
+	meta := make(map[database.DriverTuple]DriverInfo, len(drivers))
 	for _, driver := range drivers {
-		CachedDriverMeta[database.DriverTuple{
+		meta[database.DriverTuple{
 			VendorID: driver.Driver.VendorID,
 			ModelID:  driver.Driver.ModelID,
 		}] = driver.ExtractedInfo
 	}
 
+	cachedDriverMetaLock.Lock()
+	cachedDriverMeta = meta
+	cachedDriverMetaLock.Unlock()
+
 	return nil
 }
 
@@ -449,8 +483,11 @@ func (d DriverManager) EnrichDevicesList(input []database.ShallowDevice) ([]Rich
 		return nil, err
 	}
 
+	// Devices are enriched concurrently so that a single slow device does not stall the whole list.
 	output := make([]RichDevice, len(input))
-	for index, device := range input {
+	if err := forEachConcurrently(len(input), enrichmentWorkers, func(index int) error {
+		device := input[index]
+
 		// Find correct driver.
 		var fittingDriver RichDriver
 
@@ -463,121 +500,13 @@ func (d DriverManager) EnrichDevicesList(input []database.ShallowDevice) ([]Rich
 
 		enriched, err := d.EnrichDevice(device, fittingDriver)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		output[index] = enriched
-
-		// hmsErrors := HmsErrorsFromDiagnostics(fittingDriver.ValidationErrors)
-		//
-		// storedDeviceValue := DeviceStore[device.ID]
-		// savedConfig, _ := value.MarshalValue(
-		// 	filterObjFieldsWithoutSetting(storedDeviceValue, fittingDriver.ExtractedInfo.DeviceConfig.Info.HmsType),
-		// 	false,
-		// )
-		//
-		// // Extract additional information by invoking driver function code.
-		// // TODO: a hot / ready / precompiled VM instance would lead to additional performance gains here.
-		// // TODO: fuse these
-		// var powerStateInfo DriverActionGetPowerStateOutput
-		// var powerDrawInfo DriverActionGetPowerDrawOutput
-		// if fittingDriver.DeviceSupports(DeviceCapabilityPower) {
-		// 	//
-		// 	// Power state
-		// 	//
-		// 	powerStateTemp, hmsErrs, err := InvokeDriverReportPowerState(
-		// 		DriverInvocationIDs{
-		// 			deviceID: device.ID,
-		// 			vendorID: device.VendorID,
-		// 			modelID:  device.ModelID,
-		// 		},
-		// 	)
-		// 	if err != nil {
-		// 		return nil, err
-		// 	}
-		// 	if hmsErrs != nil {
-		// 		hmsErrors = append(hmsErrors, hmsErrs...)
-		// 	}
-		//
-		// 	powerStateInfo = powerStateTemp
-		//
-		// 	//
-		// 	// Power draw
-		// 	//
-		// 	powerDrawTemp, hmsErrs, err := InvokeDriverReportPowerDraw(
-		// 		DriverInvocationIDs{
-		// 			deviceID: device.ID, vendorID: device.VendorID, modelID: device.ModelID,
-		// 		},
-		// 	)
-		// 	if err != nil {
-		// 		return nil, err
-		// 	}
-		// 	if hmsErrs != nil {
-		// 		hmsErrors = append(hmsErrors, hmsErrs...)
-		// 	}
-		//
-		// 	powerDrawInfo = powerDrawTemp
-		// }
-		//
-		// var dimmableInformation []DriverActionReportDimOutput
-		// if fittingDriver.DeviceSupports(DeviceCapabilityDimmable) {
-		// 	dimmableInformationTemp, hmsErrs, err := InvokeDriverReportDimmable(
-		// 		DriverInvocationIDs{
-		// 			deviceID: device.ID,
-		// 			vendorID: device.VendorID,
-		// 			modelID:  device.ModelID,
-		// 		},
-		// 	)
-		// 	if err != nil {
-		// 		return nil, err
-		// 	}
-		// 	if hmsErrs != nil {
-		// 		hmsErrors = append(hmsErrors, hmsErrs...)
-		// 	}
-		//
-		// 	dimmableInformation = dimmableInformationTemp
-		// }
-		//
-		// var sensorReadings []DriverActionReportSensorReadingsOutput
-		// if fittingDriver.DeviceSupports(DeviceCapabilitySensor) {
-		// 	readingsTemp, hmsErrs, err := InvokeDriverReportSensors(
-		// 		DriverInvocationIDs{
-		// 			deviceID: device.ID,
-		// 			vendorID: device.VendorID,
-		// 			modelID:  device.ModelID,
-		// 		},
-		// 	)
-		// 	if err != nil {
-		// 		return nil, err
-		// 	}
-		// 	if hmsErrs != nil {
-		// 		hmsErrors = append(hmsErrors, hmsErrs...)
-		// 	}
-		//
-		// 	sensorReadings = readingsTemp
-		// }
-		//
-		// output[index] = RichDevice{
-		// 	Shallow: ShallowDevice{
-		// 		DeviceType:     device.DeviceType,
-		// 		ID:             device.ID,
-		// 		Name:           device.Name,
-		// 		RoomID:         device.RoomID,
-		// 		DriverVendorID: device.VendorID,
-		// 		DriverModelID:  device.ModelID,
-		// 		SingletonJSON:  savedConfig,
-		// 	},
-		// 	Extractions: DeviceExtractions{
-		// 		HmsErrors: hmsErrors,
-		// 		Config:    fittingDriver.ExtractedInfo.DeviceConfig,
-		// 		PowerInformation: DevicePowerInformation{
-		// 			State:          powerStateInfo.State,
-		// 			PowerDrawWatts: powerDrawInfo.Watts,
-		// 		},
-		// 		DimmableInformation: dimmableInformation,
-		// 		SensorReadings:      sensorReadings,
-		// 	},
-		// }
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
 	// TODO: maybe remove this?
@@ -705,3 +634,75 @@ func (d DriverManager) SetDeviceDim(deviceId string, function string, value int6
 
 	return output, true, nil, nil
 }
+
+// Looks up the capabilities of a device using the driver metadata cache.
+func (d DriverManager) DeviceCapabilities(device database.ShallowDevice) (CapabilitySet[DeviceCapability], error) {
+	tuple := database.DriverTuple{
+		VendorID: device.VendorID,
+		ModelID:  device.ModelID,
+	}
+
+	if _, found := cachedDriverInfo(tuple); !found {
+		log.Trace("Driver cache outdated, needs rebuild before capability lookup.")
+		if err := d.RebuildCache(); err != nil {
+			return nil, err
+		}
+	}
+
+	info, _ := cachedDriverInfo(tuple)
+	return info.DeviceConfig.Capabilities, nil
+}
+
+// Invokes a report function of the driver of the given device.
+// If the device does not support the required capability, `supported` is false and the driver is not invoked.
+func reportDevice[T any](
+	d DriverManager,
+	deviceID string,
+	capability DeviceCapability,
+	invoke func(ids driverTypes.DriverInvocationIDs) (T, []types.HmsError, error),
+) (output T, deviceFound bool, supported bool, hmsErr *types.HmsError, err error) {
+	device, found, err := database.GetDeviceById(deviceID)
+	if err != nil || !found {
+		return output, false, false, nil, err
+	}
+
+	capabilities, err := d.DeviceCapabilities(device)
+	if err != nil {
+		return output, true, false, nil, err
+	}
+
+	if !capabilities.Has(capability) {
+		return output, true, false, nil, nil
+	}
+
+	output, hmsErrs, err := invoke(driverTypes.DriverInvocationIDs{
+		DeviceID: &device.ID,
+		VendorID: device.VendorID,
+		ModelID:  device.ModelID,
+	})
+	if err != nil {
+		return output, true, true, nil, err
+	}
+
+	if hmsErrs != nil {
+		return output, true, true, &hmsErrs[0], nil
+	}
+
+	return output, true, true, nil, nil
+}
+
+func (d DriverManager) ReportDevicePowerState(deviceID string) (output DriverActionGetPowerStateOutput, deviceFound bool, supported bool, hmsErr *types.HmsError, err error) {
+	return reportDevice(d, deviceID, DeviceCapabilityPower, d.InvokeDriverReportPowerState)
+}
+
+func (d DriverManager) ReportDevicePowerDraw(deviceID string) (output DriverActionGetPowerDrawOutput, deviceFound bool, supported bool, hmsErr *types.HmsError, err error) {
+	return reportDevice(d, deviceID, DeviceCapabilityPower, d.InvokeDriverReportPowerDraw)
+}
+
+func (d DriverManager) ReportDeviceDimmables(deviceID string) (output []DriverActionReportDimOutput, deviceFound bool, supported bool, hmsErr *types.HmsError, err error) {
+	return reportDevice(d, deviceID, DeviceCapabilityDimmable, d.InvokeDriverReportDimmable)
+}
+
+func (d DriverManager) ReportDeviceSensors(deviceID string) (output []DriverActionReportSensorReadingsOutput, deviceFound bool, supported bool, hmsErr *types.HmsError, err error) {
+	return reportDevice(d, deviceID, DeviceCapabilitySensor, d.InvokeDriverReportSensors)
+}
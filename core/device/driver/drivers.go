@@ -334,71 +334,45 @@ outer:
 }
 
 // Apart from actually modifying the code of the driver in the DB,
-// the saved singleton state of this driver and all dependent devices must be rebuilt.
+// the saved singleton state of this driver and all dependent devices must be migrated.
+// Valid code is applied using `MigrateDriver` with the current version: declared migration functions are invoked
+// and a snapshot is taken, so that the change can be rolled back.
 func (d DriverManager) ModifyCode(vendorID, modelID, newCode string) (found bool, codeErr error, dbErr error) {
-	// Try to create default JSON from schema. TODO: why default: ???
-	// This can fail if the Homescript code is invalid.
-	configInfo, hmsErrs, err := d.extractInfoFromDriver(vendorID, modelID, newCode)
-	if err != nil {
+	existing, found, err := database.GetDeviceDriver(vendorID, modelID)
+	if err != nil || !found {
 		return false, nil, err
 	}
 
-	if err = database.ModifyDeviceDriverCode(
-		vendorID,
-		modelID,
-		newCode,
-	); err != nil {
+	// This can fail if the Homescript code is invalid.
+	_, hmsErrs, err := d.extractInfoFromDriver(vendorID, modelID, newCode)
+	if err != nil {
 		return false, nil, err
 	}
 
-	// Only apply transactions if there are no errors in the code.
+	// Only migrate the singletons if there are no errors in the code.
 	// Otherwise, the stored data of every singleton would be erased as soon as there is an error.
 	// NOTE: the code should be saved however.
-	// Therefore, the code is saved before this.
 	if len(hmsErrs) > 0 {
+		if err = database.ModifyDeviceDriverCode(
+			vendorID,
+			modelID,
+			newCode,
+		); err != nil {
+			return false, nil, err
+		}
+
 		log.Debugf("[singleton] Not updating singleton stores of driver / devices due to errors in new code: %s", hmsErrs[0].Message)
 		return false, fmt.Errorf("Refusing to save broken code"), nil
 	}
 
-	objVal := value.ValueObject{FieldsInternal: make(map[string]*value.Value)}
-
-	// TODO: add proper error handling in here:
-	// - check if there is an erorr and return early
-	// - otherwise (no error) load the current data and perform the patches on it.
-
-	ValueStoreLock.RLock()
-	old := DriverStore[database.DriverTuple{
-		VendorID: vendorID,
-		ModelID:  modelID,
-	}]
-	ValueStoreLock.RUnlock()
-	objVal = (*ApplyNewSchemaOnObjData(old, configInfo.DriverConfig.Info.HmsType)).(value.ValueObject)
-
-	if err := StoreDriverSingletonBackend(vendorID, modelID, objVal); err != nil {
-		return false, nil, err
-	}
-
-	// Also patch every device that uses this driver.
-	// TODO: add a separate device-list that only lists devices of a certain driver.
-
-	// TODO: what to do on HMS errors?
-
-	devices, err := database.ListAllDevices()
-	if err != nil {
-		return false, nil, err
+	report, found, codeErr, err := d.MigrateDriver(vendorID, modelID, newCode, existing.Version, false)
+	if err != nil || !found || codeErr != nil {
+		return found, codeErr, err
 	}
 
-	for _, device := range devices {
-		if device.VendorID != vendorID || device.ModelID != modelID {
-			continue
-		}
-		ValueStoreLock.RLock()
-		oldDeviceData := DeviceStore[device.ID]
-		ValueStoreLock.RUnlock()
-		newDeviceData := (*ApplyNewSchemaOnObjData(oldDeviceData, configInfo.DeviceConfig.Info.HmsType)).(value.ValueObject)
-		if err := StoreDeviceSingletonBackend(device.ID, newDeviceData); err != nil {
-			return false, nil, err
-		}
+	// If a migration function failed, neither the code nor the singletons were changed.
+	if err := report.Err(); err != nil {
+		return true, err, nil
 	}
 
 	return true, nil, nil
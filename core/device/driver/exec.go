@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/smarthome-go/homescript/v3/homescript/diagnostic"
 	"github.com/smarthome-go/homescript/v3/homescript/errors"
@@ -50,6 +49,8 @@ type FunctionCall struct {
 // 	panic("Unreachable, there is at least one error if `Success` was `false`")
 // }
 
+// Applies the invocation policy of the driver: every attempt runs with a timeout and failed report functions are retried.
+// Devices whose circuit breaker is open are not invoked, see `breakerAdmit`.
 func (d *DriverManager) invokeDriverGeneric(
 	// Termination handling
 	cancelCtx context.Context,
@@ -60,6 +61,85 @@ func (d *DriverManager) invokeDriverGeneric(
 	modelId string,
 	functionInvocation FunctionCall,
 ) (types.HmsRes, error) {
+	defer cancelFunc()
+
+	policy, err := invocationPolicy(vendorId, modelId)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+
+	timeout, err := invocationTimeout(policy, driverCtx.DeviceId)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+
+	function := functionInvocation.Invocation.Function
+
+	if driverCtx.DeviceId != nil {
+		if res, skip := breakerAdmit(*driverCtx.DeviceId, function, policy); skip {
+			return res, nil
+		}
+	}
+
+	attempts := uint(1)
+	if idempotentDeviceFunctions[function] {
+		attempts += policy.Retries
+	}
+
+	var res types.HmsRes
+	for attempt := uint(1); attempt <= attempts; attempt++ {
+		attemptCtx, attemptCancel := context.WithTimeout(cancelCtx, timeout)
+		res, err = d.runDriverFunction(attemptCtx, attemptCancel, driverCtx, vendorId, modelId, functionInvocation)
+		attemptCancel()
+
+		if err != nil {
+			if driverCtx.DeviceId != nil {
+				breakerReleaseProbe(*driverCtx.DeviceId)
+			}
+			return types.HmsRes{}, err
+		}
+
+		// Retrying is pointless once the caller has given up.
+		if !res.Errors.ContainsError || cancelCtx.Err() != nil {
+			break
+		}
+
+		if attempt < attempts {
+			log.Debugf("Driver function `%s` of `%s:%s` failed (attempt %d of %d), retrying...", function, vendorId, modelId, attempt, attempts)
+		}
+	}
+
+	if driverCtx.DeviceId != nil {
+		breakerRecord(*driverCtx.DeviceId, function, policy, res)
+	}
+
+	return res, nil
+}
+
+func (d *DriverManager) runDriverFunction(
+	// Termination handling
+	cancelCtx context.Context,
+	cancelFunc context.CancelFunc,
+	// Call data
+	driverCtx DriverContext,
+	vendorId,
+	modelId string,
+	functionInvocation FunctionCall,
+) (types.HmsRes, error) {
+	// Virtual devices are not stored in the database, they run using simulated state.
+	if driverCtx.DeviceId != nil && IsVirtualDevice(*driverCtx.DeviceId) {
+		return d.invokeVirtualDevice(
+			types.Cancelation{
+				Context:    cancelCtx,
+				CancelFunc: cancelFunc,
+			},
+			*driverCtx.DeviceId,
+			vendorId,
+			modelId,
+			functionInvocation.Invocation,
+		)
+	}
+
 	driver, found, err := database.GetDeviceDriver(vendorId, modelId)
 	if err != nil {
 		return types.HmsRes{}, err
@@ -193,27 +273,7 @@ func (d *DriverManager) invokeDriverGeneric(
 	}
 
 	if res.Errors.ContainsError {
-		errorList := make([]types.HmsError, 0)
-
-		// Filter out any non-error messages.
-		for _, d := range res.Errors.Diagnostics {
-			if d.DiagnosticError != nil && d.DiagnosticError.Level != diagnostic.DiagnosticLevelError {
-				continue
-			}
-			errorList = append(errorList, d)
-		}
-
-		return types.HmsRes{
-			Errors: types.HmsDiagnosticsContainer{
-				ContainsError: true,
-				Diagnostics:   errorList,
-				FileContents:  res.Errors.FileContents,
-			},
-			Singletons:  nil,
-			ReturnValue: nil,
-			// TODO: called function span
-			// CalledFunctionSpan: errors.Span{},
-		}, nil
+		return filterErrorDiagnostics(res), nil
 	}
 
 	// Get driver and device singleton.
@@ -239,6 +299,31 @@ func (d *DriverManager) invokeDriverGeneric(
 	return res, nil
 }
 
+// Strips all non-error diagnostics from a failed run.
+func filterErrorDiagnostics(res types.HmsRes) types.HmsRes {
+	errorList := make([]types.HmsError, 0)
+
+	// Filter out any non-error messages.
+	for _, d := range res.Errors.Diagnostics {
+		if d.DiagnosticError != nil && d.DiagnosticError.Level != diagnostic.DiagnosticLevelError {
+			continue
+		}
+		errorList = append(errorList, d)
+	}
+
+	return types.HmsRes{
+		Errors: types.HmsDiagnosticsContainer{
+			ContainsError: true,
+			Diagnostics:   errorList,
+			FileContents:  res.Errors.FileContents,
+		},
+		Singletons:  nil,
+		ReturnValue: nil,
+		// TODO: called function span
+		// CalledFunctionSpan: errors.Span{},
+	}
+}
+
 //
 //
 //
@@ -259,20 +344,37 @@ func (d DriverManager) InvokeDriverFunc(
 		panic("One or more ids in the driver-device triplet were empty or <nil>")
 	}
 
-	// TODO: add context support
-	ctx, cancel := context.WithCancel(context.Background())
-	ctx, cancel = context.WithTimeout(ctx, time.Second*10)
+	invoke := func() (types.HmsRes, error) {
+		// TODO: add context support
+		// NOTE: the timeout is applied by `invokeDriverGeneric` according to the invocation policy of the driver.
+		ctx, cancel := context.WithCancel(context.Background())
 
-	runResult, dbErr := d.invokeDriverGeneric(
-		ctx,
-		cancel,
-		DriverContext{
-			DeviceId: ids.DeviceID,
-		},
-		ids.VendorID,
-		ids.ModelID,
-		call,
-	)
+		return d.invokeDriverGeneric(
+			ctx,
+			cancel,
+			DriverContext{
+				DeviceId: ids.DeviceID,
+			},
+			ids.VendorID,
+			ids.ModelID,
+			call,
+		)
+	}
+
+	var runResult types.HmsRes
+	var dbErr error
+
+	// Reports of virtual devices are never cached so that every invocation reaches the mocks.
+	if idempotentDeviceFunctions[call.Invocation.Function] && len(call.Invocation.Args) == 0 && !IsVirtualDevice(*ids.DeviceID) {
+		runResult, dbErr = cachedReport(*ids.DeviceID, call.Invocation.Function, invoke)
+	} else {
+		runResult, dbErr = invoke()
+
+		// Other functions, such as MQTT callbacks, may have updated the state which is reported by the device.
+		if !idempotentDeviceFunctions[call.Invocation.Function] {
+			InvalidateDeviceReports(*ids.DeviceID)
+		}
+	}
 
 	if dbErr != nil {
 		return types.HmsRes{}, dbErr
@@ -464,6 +566,9 @@ func (d DriverManager) InvokeDriverSetPower(
 		},
 	)
 
+	// Even a failed invocation may have changed the device.
+	InvalidateDeviceReports(deviceID)
+
 	if dbErr != nil || runResult.Errors.ContainsError {
 		return DriverActionPowerOutput{}, runResult.Errors.Diagnostics, dbErr
 	}
@@ -595,6 +700,9 @@ func (d DriverManager) InvokeDriverDim(
 		},
 	)
 
+	// Even a failed invocation may have changed the device.
+	InvalidateDeviceReports(deviceID)
+
 	if dbErr != nil || res.Errors.ContainsError {
 		return DriverActionDimOutput{}, res.Errors.Diagnostics, dbErr
 	}
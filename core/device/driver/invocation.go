@@ -0,0 +1,387 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+//
+// Invocation policies and circuit breakers.
+// Every driver function runs with a timeout, failed report functions are retried.
+// Devices which fail repeatedly are skipped by their circuit breaker until a backoff expires.
+// While a breaker is open, report functions return the last value which was reported successfully.
+//
+
+// The bounds of user-provided policies.
+const (
+	InvocationTimeoutMinMillis = 100
+	InvocationTimeoutMaxMillis = 10 * 60 * 1000
+	InvocationMaxRetries       = 10
+)
+
+// These functions only report state, therefore, they can be retried and their results can be cached.
+var idempotentDeviceFunctions = map[string]bool{
+	DeviceFunctionValidateDevice:       true,
+	DeviceFunctionReportPowerState:     true,
+	DeviceFunctionReportPowerDraw:      true,
+	DeviceFunctionReportDim:            true,
+	DeviceFunctionReportSensorReadings: true,
+}
+
+var (
+	invocationPolicies     = make(map[database.DriverTuple]database.DeviceDriverInvocationPolicy)
+	deviceTimeouts         = make(map[string]*uint)
+	invocationPoliciesLock sync.RWMutex
+)
+
+func invocationPolicy(vendorID, modelID string) (database.DeviceDriverInvocationPolicy, error) {
+	tuple := database.DriverTuple{VendorID: vendorID, ModelID: modelID}
+
+	invocationPoliciesLock.RLock()
+	policy, found := invocationPolicies[tuple]
+	invocationPoliciesLock.RUnlock()
+
+	if found {
+		return policy, nil
+	}
+
+	policy, err := database.GetDeviceDriverInvocationPolicy(vendorID, modelID)
+	if err != nil {
+		return database.DeviceDriverInvocationPolicy{}, err
+	}
+
+	invocationPoliciesLock.Lock()
+	invocationPolicies[tuple] = policy
+	invocationPoliciesLock.Unlock()
+
+	return policy, nil
+}
+
+func deviceTimeout(deviceID string) (*uint, error) {
+	invocationPoliciesLock.RLock()
+	timeout, found := deviceTimeouts[deviceID]
+	invocationPoliciesLock.RUnlock()
+
+	if found {
+		return timeout, nil
+	}
+
+	timeout, err := database.GetDeviceInvocationTimeout(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	invocationPoliciesLock.Lock()
+	deviceTimeouts[deviceID] = timeout
+	invocationPoliciesLock.Unlock()
+
+	return timeout, nil
+}
+
+// Returns the timeout of a single invocation, the timeout of the device takes precedence over the one of its driver.
+func invocationTimeout(policy database.DeviceDriverInvocationPolicy, deviceID *string) (time.Duration, error) {
+	millis := policy.TimeoutMillis
+
+	if deviceID != nil {
+		override, err := deviceTimeout(*deviceID)
+		if err != nil {
+			return 0, err
+		}
+		if override != nil {
+			millis = *override
+		}
+	}
+
+	return time.Duration(millis) * time.Millisecond, nil
+}
+
+// Must be called after drivers or devices were deleted so that recreated ones do not inherit stale policies.
+func InvalidateInvocationPolicyCache() {
+	invocationPoliciesLock.Lock()
+	defer invocationPoliciesLock.Unlock()
+
+	invocationPolicies = make(map[database.DriverTuple]database.DeviceDriverInvocationPolicy)
+	deviceTimeouts = make(map[string]*uint)
+}
+
+func validateInvocationTimeout(timeoutMillis uint) error {
+	if timeoutMillis < InvocationTimeoutMinMillis || timeoutMillis > InvocationTimeoutMaxMillis {
+		return fmt.Errorf(
+			"The timeout must be between %d and %d milliseconds",
+			InvocationTimeoutMinMillis,
+			InvocationTimeoutMaxMillis,
+		)
+	}
+	return nil
+}
+
+func (d DriverManager) SetInvocationPolicy(policy database.DeviceDriverInvocationPolicy) (validationErr error, dbErr error) {
+	if err := validateInvocationTimeout(policy.TimeoutMillis); err != nil {
+		return err, nil
+	}
+
+	if policy.Retries > InvocationMaxRetries {
+		return fmt.Errorf("At most %d retries are allowed", InvocationMaxRetries), nil
+	}
+
+	if policy.BreakerThreshold > 0 && policy.BreakerBackoffSeconds == 0 {
+		return fmt.Errorf("The breaker backoff must not be zero while the breaker is enabled"), nil
+	}
+
+	if err := database.SetDeviceDriverInvocationPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	invocationPoliciesLock.Lock()
+	invocationPolicies[database.DriverTuple{VendorID: policy.VendorID, ModelID: policy.ModelID}] = policy
+	invocationPoliciesLock.Unlock()
+
+	return nil, nil
+}
+
+// Overrides the timeout of a single device, `nil` removes the override.
+func (d DriverManager) SetDeviceTimeout(deviceID string, timeoutMillis *uint) (validationErr error, dbErr error) {
+	if timeoutMillis != nil {
+		if err := validateInvocationTimeout(*timeoutMillis); err != nil {
+			return err, nil
+		}
+	}
+
+	if err := database.SetDeviceInvocationTimeout(deviceID, timeoutMillis); err != nil {
+		return nil, err
+	}
+
+	invocationPoliciesLock.Lock()
+	deviceTimeouts[deviceID] = timeoutMillis
+	invocationPoliciesLock.Unlock()
+
+	return nil, nil
+}
+
+//
+// Circuit breaker.
+//
+
+type BreakerState string
+
+const (
+	BreakerClosed BreakerState = "closed"
+	BreakerOpen   BreakerState = "open"
+	// The backoff has expired, the next invocation decides whether the breaker is closed again.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+type DeviceBreakerStatus struct {
+	DeviceID            string       `json:"deviceId"`
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures uint         `json:"consecutiveFailures"`
+	// Is `nil` unless the breaker has been opened.
+	OpenUntil *time.Time `json:"openUntil"`
+	LastError *string    `json:"lastError"`
+}
+
+type deviceBreaker struct {
+	failures  uint
+	openUntil time.Time
+	// Only a single invocation may probe a half-open breaker.
+	probing   bool
+	lastError string
+	// The last successful result of every idempotent function.
+	lastKnown map[string]types.HmsRes
+}
+
+var (
+	breakers     = make(map[string]*deviceBreaker)
+	breakersLock sync.Mutex
+)
+
+func (self *deviceBreaker) state(threshold uint, now time.Time) BreakerState {
+	if threshold == 0 || self.failures < threshold {
+		return BreakerClosed
+	}
+	if now.Before(self.openUntil) || self.probing {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+func (self *deviceBreaker) status(deviceID string, threshold uint, now time.Time) DeviceBreakerStatus {
+	status := DeviceBreakerStatus{
+		DeviceID:            deviceID,
+		State:               self.state(threshold, now),
+		ConsecutiveFailures: self.failures,
+		OpenUntil:           nil,
+		LastError:           nil,
+	}
+
+	if !self.openUntil.IsZero() {
+		openUntil := self.openUntil
+		status.OpenUntil = &openUntil
+	}
+
+	if self.lastError != "" {
+		lastError := self.lastError
+		status.LastError = &lastError
+	}
+
+	return status
+}
+
+func breakerSkippedResult(deviceID string, breaker *deviceBreaker) types.HmsRes {
+	return types.HmsRes{
+		Errors: types.HmsDiagnosticsContainer{
+			ContainsError: true,
+			Diagnostics: []types.HmsError{
+				{
+					SyntaxError:     nil,
+					DiagnosticError: nil,
+					RuntimeInterrupt: &types.HmsRuntimeInterrupt{
+						Kind: "driver",
+						Message: fmt.Sprintf(
+							"Device `%s` is skipped after %d consecutive failures until %s: %s",
+							deviceID,
+							breaker.failures,
+							breaker.openUntil.Format(time.RFC3339),
+							breaker.lastError,
+						),
+					},
+				},
+			},
+		},
+	}
+}
+
+// Decides whether an invocation may run.
+// If the breaker of the device is open, the last known result (or an error) is returned instead.
+func breakerAdmit(deviceID string, function string, policy database.DeviceDriverInvocationPolicy) (res types.HmsRes, skip bool) {
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+
+	breaker, found := breakers[deviceID]
+	if !found {
+		return types.HmsRes{}, false
+	}
+
+	switch breaker.state(policy.BreakerThreshold, time.Now()) {
+	case BreakerClosed:
+		return types.HmsRes{}, false
+	case BreakerHalfOpen:
+		breaker.probing = true
+		return types.HmsRes{}, false
+	}
+
+	if cached, found := breaker.lastKnown[function]; found {
+		return cached, true
+	}
+
+	return breakerSkippedResult(deviceID, breaker), true
+}
+
+func breakerRecord(deviceID string, function string, policy database.DeviceDriverInvocationPolicy, res types.HmsRes) {
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+
+	breaker, found := breakers[deviceID]
+	if !found {
+		breaker = &deviceBreaker{lastKnown: make(map[string]types.HmsRes)}
+		breakers[deviceID] = breaker
+	}
+
+	breaker.probing = false
+
+	if !res.Errors.ContainsError {
+		if breaker.failures >= policy.BreakerThreshold && policy.BreakerThreshold > 0 {
+			log.Infof("Circuit breaker of device `%s` closed again", deviceID)
+		}
+
+		breaker.failures = 0
+		breaker.openUntil = time.Time{}
+		breaker.lastError = ""
+
+		if idempotentDeviceFunctions[function] {
+			breaker.lastKnown[function] = res
+		}
+
+		return
+	}
+
+	breaker.failures++
+	breaker.lastError = fmt.Sprintf("`%s` failed", function)
+	if len(res.Errors.Diagnostics) > 0 {
+		breaker.lastError = res.Errors.Diagnostics[0].String()
+	}
+
+	if policy.BreakerThreshold > 0 && breaker.failures >= policy.BreakerThreshold {
+		breaker.openUntil = time.Now().Add(time.Duration(policy.BreakerBackoffSeconds) * time.Second)
+		log.Warnf(
+			"Circuit breaker of device `%s` opened after %d consecutive failures, skipping it until %s",
+			deviceID,
+			breaker.failures,
+			breaker.openUntil.Format(time.RFC3339),
+		)
+	}
+}
+
+// Allows another probe if the probing invocation could not run at all.
+func breakerReleaseProbe(deviceID string) {
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+
+	if breaker, found := breakers[deviceID]; found {
+		breaker.probing = false
+	}
+}
+
+// Returns the breaker state of a device, devices which were never invoked are closed.
+func DeviceBreaker(deviceID string, vendorID string, modelID string) (DeviceBreakerStatus, error) {
+	policy, err := invocationPolicy(vendorID, modelID)
+	if err != nil {
+		return DeviceBreakerStatus{}, err
+	}
+
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+
+	breaker, found := breakers[deviceID]
+	if !found {
+		return DeviceBreakerStatus{DeviceID: deviceID, State: BreakerClosed}, nil
+	}
+
+	return breaker.status(deviceID, policy.BreakerThreshold, time.Now()), nil
+}
+
+// Lists the breaker state of every device the user has access to, sorted by device ID.
+func ListDeviceBreakers(username string) ([]DeviceBreakerStatus, error) {
+	devices, err := database.ListUserDevices(username)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]DeviceBreakerStatus, 0)
+	for _, device := range devices {
+		status, err := DeviceBreaker(device.ID, device.VendorID, device.ModelID)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].DeviceID < statuses[j].DeviceID
+	})
+
+	return statuses, nil
+}
+
+// Closes the breaker of a device so that it is invoked again immediately.
+func ResetDeviceBreaker(deviceID string) {
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+
+	delete(breakers, deviceID)
+}
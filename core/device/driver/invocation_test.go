@@ -0,0 +1,87 @@
+package driver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+func TestDeviceBreaker(t *testing.T) {
+	InitLogger(logrus.New())
+
+	const deviceID = "breaker_test"
+	defer ResetDeviceBreaker(deviceID)
+
+	policy := database.DefaultDeviceDriverInvocationPolicy("breaker_vendor", "breaker_model")
+	policy.BreakerThreshold = 2
+	policy.BreakerBackoffSeconds = 60
+
+	success := types.HmsRes{}
+	failure := types.HmsRes{
+		Errors: types.HmsDiagnosticsContainer{
+			ContainsError: true,
+			Diagnostics:   []types.HmsError{{RuntimeInterrupt: &types.HmsRuntimeInterrupt{Kind: "driver", Message: "unreachable"}}},
+		},
+	}
+
+	// Devices which were never invoked are admitted.
+	_, skip := breakerAdmit(deviceID, DeviceFunctionReportPowerState, policy)
+	assert.False(t, skip)
+
+	breakerRecord(deviceID, DeviceFunctionReportPowerState, policy, success)
+	breakerRecord(deviceID, DeviceFunctionReportPowerState, policy, failure)
+
+	// Below the threshold, the breaker stays closed.
+	_, skip = breakerAdmit(deviceID, DeviceFunctionReportPowerState, policy)
+	assert.False(t, skip)
+
+	breakerRecord(deviceID, DeviceFunctionReportPowerState, policy, failure)
+	assert.Equal(t, BreakerOpen, breakers[deviceID].state(policy.BreakerThreshold, time.Now()))
+
+	// Report functions return their last known value while the breaker is open.
+	res, skip := breakerAdmit(deviceID, DeviceFunctionReportPowerState, policy)
+	assert.True(t, skip)
+	assert.False(t, res.Errors.ContainsError)
+
+	// Other functions fail immediately.
+	res, skip = breakerAdmit(deviceID, DeviceFunctionSetPower, policy)
+	assert.True(t, skip)
+	assert.True(t, res.Errors.ContainsError)
+
+	// Once the backoff has expired, a single invocation probes the device.
+	breakers[deviceID].openUntil = time.Now().Add(-time.Second)
+	_, skip = breakerAdmit(deviceID, DeviceFunctionSetPower, policy)
+	assert.False(t, skip)
+	_, skip = breakerAdmit(deviceID, DeviceFunctionSetPower, policy)
+	assert.True(t, skip)
+
+	// A failed probe opens the breaker again.
+	breakerRecord(deviceID, DeviceFunctionSetPower, policy, failure)
+	_, skip = breakerAdmit(deviceID, DeviceFunctionSetPower, policy)
+	assert.True(t, skip)
+
+	// A successful probe closes it.
+	breakers[deviceID].openUntil = time.Now().Add(-time.Second)
+	_, skip = breakerAdmit(deviceID, DeviceFunctionSetPower, policy)
+	assert.False(t, skip)
+	breakerRecord(deviceID, DeviceFunctionSetPower, policy, success)
+
+	status := breakers[deviceID].status(deviceID, policy.BreakerThreshold, time.Now())
+	assert.Equal(t, BreakerClosed, status.State)
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Nil(t, status.OpenUntil)
+	assert.Nil(t, status.LastError)
+
+	// A disabled breaker never opens.
+	policy.BreakerThreshold = 0
+	for i := 0; i < 5; i++ {
+		breakerRecord(deviceID, DeviceFunctionSetPower, policy, failure)
+	}
+	_, skip = breakerAdmit(deviceID, DeviceFunctionSetPower, policy)
+	assert.False(t, skip)
+}
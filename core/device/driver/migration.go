@@ -0,0 +1,635 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/smarthome-go/homescript/v3/homescript"
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/stdlib"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+//
+// Driver migrations.
+// When the singleton types of a driver change, the stored values are transformed into the new types.
+// By default, fields are matched by name (see `ApplyNewSchemaOnObjData`), which drops renamed fields.
+// Drivers can take control by declaring migration functions with the following signature:
+//
+//	fn migrate_driver(old: str, from_version: str, to_version: str) -> str
+//	fn migrate_device(old: str, from_version: str, to_version: str) -> str
+//
+// `old` is the JSON-encoded singleton value before the upgrade, the function returns the new value as JSON.
+// Code changes which keep the version (see `ModifyCode`) also invoke these functions, `from_version` equals `to_version` then.
+//
+
+const DriverFunctionMigrateDriver = "migrate_driver"
+const DriverFunctionMigrateDevice = "migrate_device"
+
+// Maximum runtime of a single migration function.
+const migrationTimeout = 10 * time.Second
+
+func migrationSignature() runtime.FunctionInvocationSignature {
+	span := errors.Span{}
+	return runtime.FunctionInvocationSignature{
+		Params: []runtime.FunctionInvocationSignatureParam{
+			{Ident: "old", Type: ast.NewStringType(span)},
+			{Ident: "from_version", Type: ast.NewStringType(span)},
+			{Ident: "to_version", Type: ast.NewStringType(span)},
+		},
+		ReturnType: ast.NewStringType(span),
+	}
+}
+
+type SingletonMigrationResult struct {
+	// Is `nil` for the driver singleton.
+	DeviceID   *string `json:"deviceId"`
+	DeviceName *string `json:"deviceName"`
+	// If this is false, the fields of the old value were matched by name.
+	UsedMigrationFunction bool        `json:"usedMigrationFunction"`
+	Before                interface{} `json:"before"`
+	After                 interface{} `json:"after"`
+	// Output which was printed by the migration function.
+	Output string `json:"output"`
+	// If this is not <nil>, the migration failed and `After` is <nil>.
+	Error *string `json:"error"`
+
+	migrated value.ValueObject
+}
+
+type DriverMigrationReport struct {
+	VendorID    string `json:"vendorId"`
+	ModelID     string `json:"modelId"`
+	FromVersion string `json:"fromVersion"`
+	ToVersion   string `json:"toVersion"`
+	DryRun      bool   `json:"dryRun"`
+	// Is only true if every singleton was migrated successfully.
+	Success bool                       `json:"success"`
+	Applied bool                       `json:"applied"`
+	Driver  SingletonMigrationResult   `json:"driver"`
+	Devices []SingletonMigrationResult `json:"devices"`
+	// The snapshot which can be used to roll back this migration, `nil` if nothing was applied.
+	SnapshotID *uint `json:"snapshotId"`
+}
+
+// Returns an error describing the first failed singleton migration, `nil` if every migration succeeded.
+func (self DriverMigrationReport) Err() error {
+	if self.Driver.Error != nil {
+		return fmt.Errorf("Could not migrate driver `%s:%s`: %s", self.VendorID, self.ModelID, *self.Driver.Error)
+	}
+
+	for _, device := range self.Devices {
+		if device.Error != nil {
+			return fmt.Errorf("Could not migrate device `%s`: %s", *device.DeviceID, *device.Error)
+		}
+	}
+
+	return nil
+}
+
+// Converts a singleton type into a shape so that the output of migration functions can be validated.
+func shapeFromType(from ast.Type) (stdlib.Shape, error) {
+	switch from.Kind() {
+	case ast.IntTypeKind:
+		return stdlib.Shape{Kind: stdlib.ShapeInt}, nil
+	case ast.FloatTypeKind:
+		return stdlib.Shape{Kind: stdlib.ShapeFloat}, nil
+	case ast.BoolTypeKind:
+		return stdlib.Shape{Kind: stdlib.ShapeBool}, nil
+	case ast.StringTypeKind:
+		return stdlib.Shape{Kind: stdlib.ShapeString}, nil
+	case ast.ListTypeKind:
+		inner, err := shapeFromType(from.(ast.ListType).Inner)
+		if err != nil {
+			return stdlib.Shape{}, err
+		}
+		return stdlib.Shape{Kind: stdlib.ShapeList, Inner: &inner}, nil
+	case ast.OptionTypeKind:
+		inner, err := shapeFromType(from.(ast.OptionType).Inner)
+		if err != nil {
+			return stdlib.Shape{}, err
+		}
+		return stdlib.Shape{Kind: stdlib.ShapeOption, Inner: &inner}, nil
+	case ast.ObjectTypeKind:
+		fields := make(map[string]stdlib.Shape)
+		for _, field := range from.(ast.ObjectType).ObjFields {
+			fieldShape, err := shapeFromType(field.Type)
+			if err != nil {
+				return stdlib.Shape{}, err
+			}
+			fields[field.FieldName.Ident()] = fieldShape
+		}
+		return stdlib.Shape{Kind: stdlib.ShapeObject, Fields: fields}, nil
+	default:
+		return stdlib.Shape{}, fmt.Errorf("Singletons containing values of type `%s` cannot be migrated", from)
+	}
+}
+
+// Converts data which was validated using the shape of `typ` into a Homescript value.
+func migratedToValue(data any, typ ast.Type) *value.Value {
+	switch typ.Kind() {
+	case ast.IntTypeKind:
+		return value.NewValueInt(data.(int64))
+	case ast.FloatTypeKind:
+		return value.NewValueFloat(data.(float64))
+	case ast.BoolTypeKind:
+		return value.NewValueBool(data.(bool))
+	case ast.StringTypeKind:
+		return value.NewValueString(data.(string))
+	case ast.ListTypeKind:
+		items := data.([]any)
+		list := make([]*value.Value, len(items))
+		for idx, item := range items {
+			list[idx] = migratedToValue(item, typ.(ast.ListType).Inner)
+		}
+		return value.NewValueList(list)
+	case ast.OptionTypeKind:
+		option := data.(stdlib.Option)
+		if !option.IsSome {
+			return value.NewNoneOption()
+		}
+		return value.NewValueOption(migratedToValue(option.Inner, typ.(ast.OptionType).Inner))
+	case ast.ObjectTypeKind:
+		object := data.(stdlib.Object)
+		fields := make(map[string]*value.Value)
+		for _, field := range typ.(ast.ObjectType).ObjFields {
+			fields[field.FieldName.Ident()] = migratedToValue(object[field.FieldName.Ident()], field.Type)
+		}
+		return value.NewValueObject(fields)
+	default:
+		panic(fmt.Sprintf("Unreachable: type `%s` was rejected by `shapeFromType`", typ))
+	}
+}
+
+func marshalSingleton(val value.ValueObject) (interface{}, string) {
+	marshaled, _ := value.MarshalValue(val, false)
+
+	encoded, err := json.Marshal(marshaled)
+	if err != nil {
+		panic(fmt.Sprintf("Impossible marshal error: %s", err.Error()))
+	}
+
+	return marshaled, string(encoded)
+}
+
+// Returns which migration functions are declared by the given driver code.
+func (d DriverManager) declaredMigrations(vendorID, modelID, code string) (driverFn bool, deviceFn bool, err error) {
+	filename := types.CreateDriverHmsId(database.DriverTuple{VendorID: vendorID, ModelID: modelID})
+
+	modules, _, err := d.Hms.Analyze(
+		homescript.InputProgram{
+			ProgramText: code,
+			Filename:    filename,
+		},
+		types.NewExecutionContextDriver(vendorID, modelID, nil),
+	)
+	if err != nil {
+		return false, false, err
+	}
+
+	for _, fn := range modules[filename].Functions {
+		switch fn.Ident.Ident() {
+		case DriverFunctionMigrateDriver:
+			driverFn = true
+		case DriverFunctionMigrateDevice:
+			deviceFn = true
+		}
+	}
+
+	return driverFn, deviceFn, nil
+}
+
+// Invokes a migration function of the (not yet saved) driver code.
+// The driver and device singletons of the code are zero-valued, only the arguments carry the old state.
+func (d DriverManager) runMigrationFunction(
+	vendorID, modelID, code string,
+	info DriverInfo,
+	function string,
+	deviceID *string,
+	oldJSON string,
+	fromVersion, toVersion string,
+	hmsType ast.ObjectType,
+) (migrated value.ValueObject, output string, migrationErr error, err error) {
+	shape, migrationErr := shapeFromType(hmsType)
+	if migrationErr != nil {
+		return value.ValueObject{}, "", migrationErr, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	var outputBuffer bytes.Buffer
+
+	res, err := d.Hms.RunGeneric(
+		types.ProgramInvocation{
+			Identifier: homescript.InputProgram{
+				ProgramText: code,
+				Filename:    types.CreateDriverHmsId(database.DriverTuple{VendorID: vendorID, ModelID: modelID}),
+			},
+			FunctionInvocation: &runtime.FunctionInvocation{
+				Function: function,
+				Args: []value.Value{
+					*value.NewValueString(oldJSON),
+					*value.NewValueString(fromVersion),
+					*value.NewValueString(toVersion),
+				},
+				FunctionSignature: migrationSignature(),
+			},
+			LoadedSingletons: map[string]value.Value{
+				DriverSingletonIdent:       value.ObjectZeroValue(info.DriverConfig.Info.HmsType),
+				DriverDeviceSingletonIdent: value.ObjectZeroValue(info.DeviceConfig.Info.HmsType),
+			},
+		},
+		types.NewExecutionContextDriver(vendorID, modelID, deviceID),
+		types.Cancelation{
+			Context:    ctx,
+			CancelFunc: cancel,
+		},
+		nil,
+		&outputBuffer,
+		false,
+		nil,
+	)
+	if err != nil {
+		return value.ValueObject{}, "", nil, err
+	}
+
+	output = outputBuffer.String()
+
+	if res.Errors.ContainsError {
+		return value.ValueObject{}, output, fmt.Errorf("Migration function `%s` failed: %s", function, res.Errors.Diagnostics[0].String()), nil
+	}
+
+	returned, isString := res.ReturnValue.(value.ValueString)
+	if !isString {
+		return value.ValueObject{}, output, fmt.Errorf("Migration function `%s` must return a string", function), nil
+	}
+
+	var decoded any
+	if err := json.Unmarshal([]byte(returned.Inner), &decoded); err != nil {
+		return value.ValueObject{}, output, fmt.Errorf("Migration function `%s` returned invalid JSON: %s", function, err.Error()), nil
+	}
+
+	validated, err := shape.Validate(decoded)
+	if err != nil {
+		return value.ValueObject{}, output, fmt.Errorf("Migration function `%s` returned an invalid value: %s", function, err.Error()), nil
+	}
+
+	return (*migratedToValue(validated, hmsType)).(value.ValueObject), output, nil, nil
+}
+
+func (d DriverManager) migrateSingleton(
+	vendorID, modelID, code string,
+	info DriverInfo,
+	function string,
+	useFunction bool,
+	device *database.ShallowDevice,
+	old value.ValueObject,
+	fromVersion, toVersion string,
+	hmsType ast.ObjectType,
+) (SingletonMigrationResult, error) {
+	before, oldJSON := marshalSingleton(old)
+
+	result := SingletonMigrationResult{
+		DeviceID:              nil,
+		DeviceName:            nil,
+		UsedMigrationFunction: useFunction,
+		Before:                before,
+		After:                 nil,
+		Output:                "",
+		Error:                 nil,
+	}
+
+	var deviceID *string
+	if device != nil {
+		deviceID = &device.ID
+		result.DeviceID = &device.ID
+		result.DeviceName = &device.Name
+	}
+
+	if !useFunction {
+		result.migrated = (*ApplyNewSchemaOnObjData(old, hmsType)).(value.ValueObject)
+		result.After, _ = marshalSingleton(result.migrated)
+		return result, nil
+	}
+
+	migrated, output, migrationErr, err := d.runMigrationFunction(
+		vendorID,
+		modelID,
+		code,
+		info,
+		function,
+		deviceID,
+		oldJSON,
+		fromVersion,
+		toVersion,
+		hmsType,
+	)
+	if err != nil {
+		return SingletonMigrationResult{}, err
+	}
+
+	result.Output = output
+
+	if migrationErr != nil {
+		message := migrationErr.Error()
+		result.Error = &message
+		return result, nil
+	}
+
+	result.migrated = migrated
+	result.After, _ = marshalSingleton(migrated)
+
+	return result, nil
+}
+
+// Replaces the code and version of a driver while migrating the stored driver and device singletons.
+// Singletons are only modified if every migration succeeds, otherwise, nothing is changed.
+// In a dry run, the migrations are only computed and reported.
+// Before changes are applied, a snapshot of the previous state is saved so that the upgrade can be rolled back.
+func (d DriverManager) MigrateDriver(
+	vendorID, modelID, newCode, newVersion string,
+	dryRun bool,
+) (report DriverMigrationReport, found bool, codeErr error, dbErr error) {
+	existing, found, err := database.GetDeviceDriver(vendorID, modelID)
+	if err != nil || !found {
+		return DriverMigrationReport{}, false, nil, err
+	}
+
+	if _, err := ParseDriverVersion(newVersion); err != nil {
+		return DriverMigrationReport{}, true, fmt.Errorf("The version `%s` is not valid: %s", newVersion, err.Error()), nil
+	}
+
+	info, diagnostics, err := d.extractInfoFromDriver(vendorID, modelID, newCode)
+	if err != nil {
+		return DriverMigrationReport{}, false, nil, err
+	}
+
+	if len(diagnostics) > 0 {
+		return DriverMigrationReport{}, true, fmt.Errorf("Refusing to migrate to broken code: %s", diagnostics[0].Message), nil
+	}
+
+	hasDriverMigration, hasDeviceMigration, err := d.declaredMigrations(vendorID, modelID, newCode)
+	if err != nil {
+		return DriverMigrationReport{}, false, nil, err
+	}
+
+	allDevices, err := database.ListAllDevices()
+	if err != nil {
+		return DriverMigrationReport{}, false, nil, err
+	}
+
+	devices := make([]database.ShallowDevice, 0)
+	for _, device := range allDevices {
+		if device.VendorID == vendorID && device.ModelID == modelID {
+			devices = append(devices, device)
+		}
+	}
+
+	ValueStoreLock.RLock()
+	oldDriver := DriverStore[database.DriverTuple{
+		VendorID: vendorID,
+		ModelID:  modelID,
+	}]
+	oldDevices := make([]value.ValueObject, len(devices))
+	for idx, device := range devices {
+		oldDevices[idx] = DeviceStore[device.ID]
+	}
+	ValueStoreLock.RUnlock()
+
+	report = DriverMigrationReport{
+		VendorID:    vendorID,
+		ModelID:     modelID,
+		FromVersion: existing.Version,
+		ToVersion:   newVersion,
+		DryRun:      dryRun,
+		Success:     true,
+		Applied:     false,
+		Devices:     make([]SingletonMigrationResult, len(devices)),
+		SnapshotID:  nil,
+	}
+
+	report.Driver, err = d.migrateSingleton(
+		vendorID,
+		modelID,
+		newCode,
+		info,
+		DriverFunctionMigrateDriver,
+		hasDriverMigration,
+		nil,
+		oldDriver,
+		existing.Version,
+		newVersion,
+		info.DriverConfig.Info.HmsType,
+	)
+	if err != nil {
+		return DriverMigrationReport{}, false, nil, err
+	}
+	report.Success = report.Driver.Error == nil
+
+	for idx := range devices {
+		report.Devices[idx], err = d.migrateSingleton(
+			vendorID,
+			modelID,
+			newCode,
+			info,
+			DriverFunctionMigrateDevice,
+			hasDeviceMigration,
+			&devices[idx],
+			oldDevices[idx],
+			existing.Version,
+			newVersion,
+			info.DeviceConfig.Info.HmsType,
+		)
+		if err != nil {
+			return DriverMigrationReport{}, false, nil, err
+		}
+		report.Success = report.Success && report.Devices[idx].Error == nil
+	}
+
+	if dryRun || !report.Success {
+		return report, true, nil, nil
+	}
+
+	//
+	// Apply the migration.
+	//
+
+	_, oldDriverJSON := marshalSingleton(oldDriver)
+	oldDevicesJSON := make(map[string]string)
+	for idx, device := range devices {
+		_, oldDevicesJSON[device.ID] = marshalSingleton(oldDevices[idx])
+	}
+
+	snapshotID, err := database.InsertDeviceDriverSnapshot(database.DeviceDriverSnapshot{
+		VendorID:             vendorID,
+		ModelID:              modelID,
+		Version:              existing.Version,
+		HomescriptCode:       existing.HomescriptCode,
+		DriverSingletonJSON:  oldDriverJSON,
+		DeviceSingletonsJSON: oldDevicesJSON,
+	})
+	if err != nil {
+		return DriverMigrationReport{}, false, nil, err
+	}
+	report.SnapshotID = &snapshotID
+
+	if err := d.replaceDriverState(existing, newCode, newVersion, report.Driver.migrated, devices, report.Devices); err != nil {
+		return DriverMigrationReport{}, false, nil, err
+	}
+
+	report.Applied = true
+
+	log.Infof("Migrated driver `%s:%s` from version %s to %s (%d device(s), snapshot %d)", vendorID, modelID, existing.Version, newVersion, len(devices), snapshotID)
+
+	return report, true, nil, nil
+}
+
+// Saves new code and singleton values of a driver and its devices and marks the driver as dirty.
+// The database is updated in a single transaction, the value stores are only updated once it has been committed.
+func (d DriverManager) replaceDriverState(
+	driver database.DeviceDriver,
+	code string,
+	version string,
+	driverSingleton value.ValueObject,
+	devices []database.ShallowDevice,
+	deviceResults []SingletonMigrationResult,
+) error {
+	_, driverJSON := marshalSingleton(driverSingleton)
+
+	driver.HomescriptCode = code
+	driver.Version = version
+	driver.SingletonJSON = &driverJSON
+	driver.Dirty = true
+
+	deviceSingletonsJSON := make(map[string]string)
+	for idx, device := range devices {
+		_, deviceSingletonsJSON[device.ID] = marshalSingleton(deviceResults[idx].migrated)
+	}
+
+	if err := database.ReplaceDeviceDriverState(driver, deviceSingletonsJSON); err != nil {
+		return err
+	}
+
+	ValueStoreLock.Lock()
+	defer ValueStoreLock.Unlock()
+
+	DriverStore[database.DriverTuple{
+		VendorID: driver.VendorID,
+		ModelID:  driver.ModelID,
+	}] = driverSingleton
+
+	for idx, device := range devices {
+		DeviceStore[device.ID] = deviceResults[idx].migrated
+	}
+
+	return nil
+}
+
+// Restores the code, version and singleton values which were saved before a migration.
+// The current state is saved as a new snapshot beforehand, so that the rollback itself can be undone.
+// Devices which were created after the snapshot was taken are migrated to the restored code by matching fields by name.
+func (d DriverManager) RollbackDriverMigration(snapshotID uint) (driver database.DeviceDriver, found bool, codeErr error, dbErr error) {
+	snapshot, found, err := database.GetDeviceDriverSnapshot(snapshotID)
+	if err != nil || !found {
+		return database.DeviceDriver{}, false, nil, err
+	}
+
+	current, found, err := database.GetDeviceDriver(snapshot.VendorID, snapshot.ModelID)
+	if err != nil || !found {
+		return database.DeviceDriver{}, false, nil, err
+	}
+
+	info, diagnostics, err := d.extractInfoFromDriver(snapshot.VendorID, snapshot.ModelID, snapshot.HomescriptCode)
+	if err != nil {
+		return database.DeviceDriver{}, false, nil, err
+	}
+
+	if len(diagnostics) > 0 {
+		return database.DeviceDriver{}, true, fmt.Errorf("The code of the snapshot is no longer valid: %s", diagnostics[0].Message), nil
+	}
+
+	allDevices, err := database.ListAllDevices()
+	if err != nil {
+		return database.DeviceDriver{}, false, nil, err
+	}
+
+	devices := make([]database.ShallowDevice, 0)
+	for _, device := range allDevices {
+		if device.VendorID == snapshot.VendorID && device.ModelID == snapshot.ModelID {
+			devices = append(devices, device)
+		}
+	}
+
+	restore := func(encoded string, hmsType ast.ObjectType) (value.ValueObject, error) {
+		var unmarshaled any
+		if err := json.Unmarshal([]byte(encoded), &unmarshaled); err != nil {
+			return value.ValueObject{}, err
+		}
+		return (*value.TypeAwareUnmarshalValue(unmarshaled, hmsType)).(value.ValueObject), nil
+	}
+
+	restoredDriver, err := restore(snapshot.DriverSingletonJSON, info.DriverConfig.Info.HmsType)
+	if err != nil {
+		return database.DeviceDriver{}, false, nil, err
+	}
+
+	ValueStoreLock.RLock()
+	currentDriver := DriverStore[database.DriverTuple{
+		VendorID: snapshot.VendorID,
+		ModelID:  snapshot.ModelID,
+	}]
+	currentDevices := make(map[string]value.ValueObject)
+	for _, device := range devices {
+		currentDevices[device.ID] = DeviceStore[device.ID]
+	}
+	ValueStoreLock.RUnlock()
+
+	deviceResults := make([]SingletonMigrationResult, len(devices))
+	currentDevicesJSON := make(map[string]string)
+	for idx, device := range devices {
+		_, currentDevicesJSON[device.ID] = marshalSingleton(currentDevices[device.ID])
+
+		if encoded, existed := snapshot.DeviceSingletonsJSON[device.ID]; existed {
+			deviceResults[idx].migrated, err = restore(encoded, info.DeviceConfig.Info.HmsType)
+			if err != nil {
+				return database.DeviceDriver{}, false, nil, err
+			}
+			continue
+		}
+
+		deviceResults[idx].migrated = (*ApplyNewSchemaOnObjData(currentDevices[device.ID], info.DeviceConfig.Info.HmsType)).(value.ValueObject)
+	}
+
+	_, currentDriverJSON := marshalSingleton(currentDriver)
+	if _, err := database.InsertDeviceDriverSnapshot(database.DeviceDriverSnapshot{
+		VendorID:             current.VendorID,
+		ModelID:              current.ModelID,
+		Version:              current.Version,
+		HomescriptCode:       current.HomescriptCode,
+		DriverSingletonJSON:  currentDriverJSON,
+		DeviceSingletonsJSON: currentDevicesJSON,
+	}); err != nil {
+		return database.DeviceDriver{}, false, nil, err
+	}
+
+	if err := d.replaceDriverState(current, snapshot.HomescriptCode, snapshot.Version, restoredDriver, devices, deviceResults); err != nil {
+		return database.DeviceDriver{}, false, nil, err
+	}
+
+	log.Infof("Rolled back driver `%s:%s` from version %s to %s (snapshot %d)", current.VendorID, current.ModelID, current.Version, snapshot.Version, snapshotID)
+
+	driver, _, err = database.GetDeviceDriver(current.VendorID, current.ModelID)
+	if err != nil {
+		return database.DeviceDriver{}, false, nil, err
+	}
+
+	return driver, true, nil, nil
+}
@@ -0,0 +1,332 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+)
+
+//
+// Portable driver packages.
+// A driver package bundles everything which is required in order to install a driver on another Smarthome server.
+//
+
+// Is incremented on every incompatible change of the package format.
+const DriverPackageFormatVersion = 1
+
+// The maximum length of the icon of a package (which can be an inline data URL).
+const DriverPackageIconMaxLen = 64 * 1024
+
+type DriverPackage struct {
+	FormatVersion  uint                  `json:"formatVersion"`
+	Manifest       DriverPackageManifest `json:"manifest"`
+	HomescriptCode string                `json:"homescriptCode"`
+	// If this is `nil`, the driver is created using the zero value of its configuration.
+	DefaultConfig interface{} `json:"defaultConfig"`
+}
+
+type DriverPackageManifest struct {
+	VendorID    string `json:"vendorId"`
+	ModelID     string `json:"modelId"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	// The device capabilities which the driver code must implement.
+	RequiredCapabilities []DeviceCapability `json:"requiredCapabilities"`
+	// The oldest Smarthome server version which is able to run this driver, may be empty.
+	MinServerVersion string `json:"minServerVersion"`
+}
+
+type DriverPackageImportAction string
+
+const (
+	DriverPackageInstalled   DriverPackageImportAction = "installed"
+	DriverPackageUpgraded    DriverPackageImportAction = "upgraded"
+	DriverPackageReinstalled DriverPackageImportAction = "reinstalled"
+	DriverPackageDowngraded  DriverPackageImportAction = "downgraded"
+)
+
+type DriverPackageImportResult struct {
+	Action DriverPackageImportAction `json:"action"`
+	// Is `nil` if the driver was not installed previously.
+	PreviousVersion *string `json:"previousVersion"`
+	// Describes how the stored configuration was migrated, `nil` for fresh installations.
+	Migration *DriverMigrationReport `json:"migration"`
+}
+
+// Bundles an installed driver into a package.
+// If `includeConfig` is set, the current settings of the driver are used as the default config of the package.
+func (d DriverManager) ExportDriverPackage(vendorID, modelID string, includeConfig bool) (pkg DriverPackage, found bool, err error) {
+	driver, found, err := d.GetDriverWithInfos(vendorID, modelID)
+	if err != nil || !found {
+		return DriverPackage{}, false, err
+	}
+
+	meta, err := database.GetDeviceDriverMeta(vendorID, modelID)
+	if err != nil {
+		return DriverPackage{}, false, err
+	}
+
+	capabilities := make([]DeviceCapability, 0)
+	if driver.IsValid {
+		capabilities = append(capabilities, driver.ExtractedInfo.DeviceConfig.Capabilities...)
+	}
+
+	var defaultConfig interface{}
+	if includeConfig && driver.IsValid {
+		ValueStoreLock.RLock()
+		stored, hasStored := DriverStore[database.DriverTuple{
+			VendorID: vendorID,
+			ModelID:  modelID,
+		}]
+		ValueStoreLock.RUnlock()
+
+		if hasStored {
+			defaultConfig, _ = value.MarshalValue(
+				filterObjFieldsWithoutSetting(stored, driver.ExtractedInfo.DriverConfig.Info.HmsType),
+				false,
+			)
+		}
+	}
+
+	return DriverPackage{
+		FormatVersion: DriverPackageFormatVersion,
+		Manifest: DriverPackageManifest{
+			VendorID:             vendorID,
+			ModelID:              modelID,
+			Name:                 driver.Driver.Name,
+			Version:              driver.Driver.Version,
+			Description:          meta.Description,
+			Icon:                 meta.Icon,
+			RequiredCapabilities: capabilities,
+			MinServerVersion:     "",
+		},
+		HomescriptCode: driver.Driver.HomescriptCode,
+		DefaultConfig:  defaultConfig,
+	}, true, nil
+}
+
+func validateDriverPackageID(kind string, id string) error {
+	if id == "" || strings.Contains(id, " ") || utf8.RuneCountInString(id) > database.DEVICE_DRIVER_MODVEN_ID_LEN {
+		return fmt.Errorf(
+			"The %s id `%s` must not be empty, exceed %d characters or include any whitespaces",
+			kind,
+			id,
+			database.DEVICE_DRIVER_MODVEN_ID_LEN,
+		)
+	}
+	return nil
+}
+
+// Validates the manifest of a package without looking at its code.
+func validateDriverPackageManifest(pkg DriverPackage, serverVersion string) (SemanticVersion, error) {
+	if pkg.FormatVersion != DriverPackageFormatVersion {
+		return SemanticVersion{}, fmt.Errorf(
+			"Unsupported package format version %d, expected %d",
+			pkg.FormatVersion,
+			DriverPackageFormatVersion,
+		)
+	}
+
+	manifest := pkg.Manifest
+
+	if err := validateDriverPackageID("vendor", manifest.VendorID); err != nil {
+		return SemanticVersion{}, err
+	}
+
+	if err := validateDriverPackageID("model", manifest.ModelID); err != nil {
+		return SemanticVersion{}, err
+	}
+
+	if utf8.RuneCountInString(manifest.Version) > database.DEVICE_DRIVER_VERSION_LEN {
+		return SemanticVersion{}, fmt.Errorf("The version `%s` must not exceed %d characters", manifest.Version, database.DEVICE_DRIVER_VERSION_LEN)
+	}
+
+	version, err := ParseDriverVersion(manifest.Version)
+	if err != nil {
+		return SemanticVersion{}, fmt.Errorf("The version `%s` is not valid: %s", manifest.Version, err.Error())
+	}
+
+	if len(manifest.Icon) > DriverPackageIconMaxLen {
+		return SemanticVersion{}, fmt.Errorf("The icon must not exceed %d bytes", DriverPackageIconMaxLen)
+	}
+
+	if manifest.MinServerVersion != "" {
+		minVersion, err := ParseServerVersion(manifest.MinServerVersion)
+		if err != nil {
+			return SemanticVersion{}, fmt.Errorf("The minimum server version `%s` is not valid: %s", manifest.MinServerVersion, err.Error())
+		}
+
+		currentVersion, err := ParseServerVersion(serverVersion)
+		if err != nil {
+			return SemanticVersion{}, fmt.Errorf("Could not parse server version `%s`: %s", serverVersion, err.Error())
+		}
+
+		if currentVersion.Compare(minVersion) < 0 {
+			return SemanticVersion{}, fmt.Errorf(
+				"This driver requires at least Smarthome %s, this server runs %s",
+				manifest.MinServerVersion,
+				serverVersion,
+			)
+		}
+	}
+
+	return version, nil
+}
+
+// Validates the code of a package and checks that it provides every required capability.
+// Also validates the default config against the configuration schema of the driver.
+func (d DriverManager) validateDriverPackageCode(pkg DriverPackage) (validationErr error, err error) {
+	info, diagnostics, err := d.extractInfoFromDriver(pkg.Manifest.VendorID, pkg.Manifest.ModelID, pkg.HomescriptCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(diagnostics) > 0 {
+		return fmt.Errorf("Invalid driver code: %s", diagnostics[0].Message), nil
+	}
+
+	for _, required := range pkg.Manifest.RequiredCapabilities {
+		if !info.DeviceConfig.Capabilities.Has(required) {
+			return fmt.Errorf("The driver code does not implement the required capability `%s`", required), nil
+		}
+	}
+
+	if pkg.DefaultConfig == nil {
+		return nil, nil
+	}
+
+	if valid, _, msg := valueMatchesSpec(pkg.DefaultConfig, info.DriverConfig.Info.Config, make([]FieldAccess, 0)); !valid {
+		return fmt.Errorf("Invalid default config: %s", msg), nil
+	}
+
+	return nil, nil
+}
+
+// Installs a driver package or upgrades an already installed driver of the same vendor and model.
+// Upgrading replaces the code while migrating the stored configuration of the driver and its devices (see `MigrateDriver`).
+// The default config of the package is only applied on a fresh installation.
+// Downgrades are rejected unless `allowDowngrade` is set.
+func (d DriverManager) ImportDriverPackage(
+	pkg DriverPackage,
+	serverVersion string,
+	allowDowngrade bool,
+) (result DriverPackageImportResult, validationErr error, dbErr error) {
+	newVersion, validationErr := validateDriverPackageManifest(pkg, serverVersion)
+	if validationErr != nil {
+		return DriverPackageImportResult{}, validationErr, nil
+	}
+
+	if validationErr, dbErr := d.validateDriverPackageCode(pkg); validationErr != nil || dbErr != nil {
+		return DriverPackageImportResult{}, validationErr, dbErr
+	}
+
+	vendorID, modelID := pkg.Manifest.VendorID, pkg.Manifest.ModelID
+
+	existing, alreadyInstalled, err := database.GetDeviceDriver(vendorID, modelID)
+	if err != nil {
+		return DriverPackageImportResult{}, nil, err
+	}
+
+	meta := database.DeviceDriverMeta{
+		VendorID:    vendorID,
+		ModelID:     modelID,
+		Description: pkg.Manifest.Description,
+		Icon:        pkg.Manifest.Icon,
+	}
+
+	if !alreadyInstalled {
+		hmsErr, err := d.CreateDriver(vendorID, modelID, pkg.Manifest.Name, pkg.Manifest.Version, &pkg.HomescriptCode)
+		if err != nil {
+			return DriverPackageImportResult{}, nil, err
+		}
+		if hmsErr != nil {
+			return DriverPackageImportResult{}, hmsErr, nil
+		}
+
+		if err := database.SetDeviceDriverMeta(meta); err != nil {
+			return DriverPackageImportResult{}, nil, err
+		}
+
+		if pkg.DefaultConfig != nil {
+			if err := d.StoreDriverSingletonConfigUpdate(vendorID, modelID, pkg.DefaultConfig); err != nil {
+				return DriverPackageImportResult{}, nil, err
+			}
+		}
+
+		log.Infof("Installed driver package `%s:%s` at version %s", vendorID, modelID, newVersion)
+
+		return DriverPackageImportResult{
+			Action:          DriverPackageInstalled,
+			PreviousVersion: nil,
+			Migration:       nil,
+		}, nil, nil
+	}
+
+	action := DriverPackageReinstalled
+
+	// Drivers which were created manually may carry an invalid version, these are always replaced.
+	if oldVersion, err := ParseDriverVersion(existing.Version); err == nil {
+		switch newVersion.Compare(oldVersion) {
+		case 1:
+			action = DriverPackageUpgraded
+		case -1:
+			if !allowDowngrade {
+				return DriverPackageImportResult{}, fmt.Errorf(
+					"Refusing to downgrade driver `%s:%s` from version %s to %s",
+					vendorID,
+					modelID,
+					existing.Version,
+					pkg.Manifest.Version,
+				), nil
+			}
+			action = DriverPackageDowngraded
+		}
+	} else {
+		action = DriverPackageUpgraded
+	}
+
+	// The stored configuration of the driver and its devices is migrated using the migration functions of the new code.
+	migration, _, codeErr, err := d.MigrateDriver(vendorID, modelID, pkg.HomescriptCode, pkg.Manifest.Version, false)
+	if err != nil {
+		return DriverPackageImportResult{}, nil, err
+	}
+	if codeErr != nil {
+		return DriverPackageImportResult{}, codeErr, nil
+	}
+	if err := migration.Err(); err != nil {
+		return DriverPackageImportResult{}, err, nil
+	}
+
+	// The code has been modified, therefore, the driver needs to be fetched again.
+	updated, found, err := database.GetDeviceDriver(vendorID, modelID)
+	if err != nil {
+		return DriverPackageImportResult{}, nil, err
+	}
+	if !found {
+		// The driver was deleted concurrently.
+		return DriverPackageImportResult{}, nil, fmt.Errorf("Driver `%s:%s` vanished during package import", vendorID, modelID)
+	}
+
+	updated.Name = pkg.Manifest.Name
+
+	if err := database.ModifyDeviceDriver(updated); err != nil {
+		return DriverPackageImportResult{}, nil, err
+	}
+
+	if err := database.SetDeviceDriverMeta(meta); err != nil {
+		return DriverPackageImportResult{}, nil, err
+	}
+
+	log.Infof("Driver package `%s:%s` %s from version %s to %s", vendorID, modelID, action, existing.Version, newVersion)
+
+	return DriverPackageImportResult{
+		Action:          action,
+		PreviousVersion: &existing.Version,
+		Migration:       &migration,
+	}, nil, nil
+}
@@ -0,0 +1,44 @@
+package driver
+
+import "sync"
+
+// How many devices are enriched concurrently.
+const enrichmentWorkers = 8
+
+// Calls `fn` for every index in `0..count` using at most `workers` goroutines.
+// Returns the first error which occurred, the remaining indices are still processed.
+func forEachConcurrently(count int, workers int, fn func(index int) error) error {
+	if workers > count {
+		workers = count
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	var firstErr error
+	var errLock sync.Mutex
+
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indices {
+				if err := fn(index); err != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errLock.Unlock()
+				}
+			}
+		}()
+	}
+
+	for index := 0; index < count; index++ {
+		indices <- index
+	}
+	close(indices)
+
+	wg.Wait()
+
+	return firstErr
+}
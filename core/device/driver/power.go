@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-co-op/gocron"
 	"github.com/smarthome-go/smarthome/core/database"
+	driverTypes "github.com/smarthome-go/smarthome/core/device/driver/types"
 	"github.com/smarthome-go/smarthome/core/event"
 )
 
@@ -60,32 +61,75 @@ func generateSnapshot() (onData database.PowerDrawData, offData database.PowerDr
 	// regardless of whether they are active or disabled.
 	var totalWatts uint = 0
 
-	// Loop over all devices and try to query power.
-	devices, err := Manager.ListAllDevicesRich()
+	devices, err := database.ListAllDevices()
 	if err != nil {
 		return database.PowerDrawData{}, database.PowerDrawData{}, err
 	}
 
+	// Only devices which support power are queried.
+	// The capability lookup may rebuild the driver cache, therefore, it is not performed concurrently.
+	powerDevices := make([]database.ShallowDevice, 0)
 	for _, dev := range devices {
-		if !dev.Extractions.Config.Capabilities.Has(DeviceCapabilityPower) {
-			continue
+		capabilities, err := Manager.DeviceCapabilities(dev)
+		if err != nil {
+			return database.PowerDrawData{}, database.PowerDrawData{}, err
+		}
+		if capabilities.Has(DeviceCapabilityPower) {
+			powerDevices = append(powerDevices, dev)
+		}
+	}
+
+	// Devices which fail to report their power are considered to be off and to draw no power.
+	powerInformation := make([]DevicePowerInformation, len(powerDevices))
+	if err := forEachConcurrently(len(powerDevices), enrichmentWorkers, func(index int) error {
+		dev := powerDevices[index]
+		ids := driverTypes.DriverInvocationIDs{
+			DeviceID: &dev.ID,
+			VendorID: dev.VendorID,
+			ModelID:  dev.ModelID,
+		}
+
+		state, hmsErrs, err := Manager.InvokeDriverReportPowerState(ids)
+		if err != nil {
+			return err
+		}
+		if hmsErrs != nil {
+			return nil
 		}
 
+		draw, hmsErrs, err := Manager.InvokeDriverReportPowerDraw(ids)
+		if err != nil {
+			return err
+		}
+		if hmsErrs != nil {
+			return nil
+		}
+
+		powerInformation[index] = DevicePowerInformation{
+			State:          state.State,
+			PowerDrawWatts: draw.Watts,
+		}
+		return nil
+	}); err != nil {
+		return database.PowerDrawData{}, database.PowerDrawData{}, err
+	}
+
+	for _, info := range powerInformation {
 		// If the current switch is active, account for in int the `onData`.
-		if dev.Extractions.PowerInformation.State {
+		if info.State {
 			onData.SwitchCount++
 			// Increment the switch count of all active switches by one.
 			// Add the power draw of the current switch to the total of the active switches.
-			onData.Watts += uint(dev.Extractions.PowerInformation.PowerDrawWatts)
+			onData.Watts += uint(info.PowerDrawWatts)
 		} else {
 			offData.SwitchCount++
 			// Increment the switch count of all passive switches by one.
 			// Add the power draw of the current switch to the total of the passive switches.
-			offData.Watts += uint(dev.Extractions.PowerInformation.PowerDrawWatts)
+			offData.Watts += uint(info.PowerDrawWatts)
 		}
 
 		// Regardless of the power state, increment the total watt count.
-		totalWatts += dev.Extractions.PowerInformation.PowerDrawWatts
+		totalWatts += info.PowerDrawWatts
 	}
 
 	// NOTE: If the total watts are equal to 0,
@@ -0,0 +1,131 @@
+package driver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+//
+// Report cache.
+// The power snapshot scheduler, device listings and Homescript all invoke the same report functions.
+// Successful reports are cached for a short time and concurrent readers share a single in-flight invocation per device.
+// Changing the state of a device invalidates its reports.
+//
+
+// How long a successful report is reused.
+const ReportCacheTTL = 5 * time.Second
+
+type reportCacheKey struct {
+	deviceID string
+	function string
+}
+
+type reportCacheEntry struct {
+	res     types.HmsRes
+	expires time.Time
+}
+
+// An invocation which is currently running, other readers wait for it instead of invoking the driver again.
+type reportFlight struct {
+	done chan struct{}
+	res  types.HmsRes
+	err  error
+}
+
+var reportCache = struct {
+	lock    sync.Mutex
+	entries map[reportCacheKey]reportCacheEntry
+	flights map[reportCacheKey]*reportFlight
+	// Is incremented on every invalidation so that flights which started before are not cached.
+	generations map[string]uint64
+}{
+	lock:        sync.Mutex{},
+	entries:     make(map[reportCacheKey]reportCacheEntry),
+	flights:     make(map[reportCacheKey]*reportFlight),
+	generations: make(map[string]uint64),
+}
+
+// Returns a cached report, joins an in-flight invocation or invokes the driver using `invoke`.
+func cachedReport(deviceID string, function string, invoke func() (types.HmsRes, error)) (types.HmsRes, error) {
+	key := reportCacheKey{deviceID: deviceID, function: function}
+
+	reportCache.lock.Lock()
+
+	if entry, found := reportCache.entries[key]; found && time.Now().Before(entry.expires) {
+		reportCache.lock.Unlock()
+		return entry.res, nil
+	}
+
+	if flight, found := reportCache.flights[key]; found {
+		reportCache.lock.Unlock()
+		<-flight.done
+		return flight.res, flight.err
+	}
+
+	flight := &reportFlight{done: make(chan struct{})}
+	reportCache.flights[key] = flight
+	generation := reportCache.generations[deviceID]
+
+	reportCache.lock.Unlock()
+
+	flight.res, flight.err = invoke()
+
+	reportCache.lock.Lock()
+	if reportCache.flights[key] == flight {
+		delete(reportCache.flights, key)
+	}
+	if flight.err == nil && !flight.res.Errors.ContainsError && reportCache.generations[deviceID] == generation {
+		reportCache.entries[key] = reportCacheEntry{
+			res:     flight.res,
+			expires: time.Now().Add(ReportCacheTTL),
+		}
+	}
+	reportCache.lock.Unlock()
+
+	close(flight.done)
+
+	return flight.res, flight.err
+}
+
+var invalidationListeners = struct {
+	lock      sync.RWMutex
+	listeners []func(deviceID string)
+}{
+	lock:      sync.RWMutex{},
+	listeners: make([]func(deviceID string), 0),
+}
+
+// Registers a function which is called whenever the reports of a device are invalidated.
+// This happens if the state of the device might have changed, for instance after an action or an MQTT message.
+// Listeners are called synchronously, therefore, they must not block.
+func OnDeviceReportsInvalidated(listener func(deviceID string)) {
+	invalidationListeners.lock.Lock()
+	defer invalidationListeners.lock.Unlock()
+
+	invalidationListeners.listeners = append(invalidationListeners.listeners, listener)
+}
+
+// Discards all cached reports of a device.
+// Invocations which are still running are detached so that later readers invoke the driver again.
+func InvalidateDeviceReports(deviceID string) {
+	reportCache.lock.Lock()
+
+	reportCache.generations[deviceID]++
+
+	for function := range idempotentDeviceFunctions {
+		key := reportCacheKey{deviceID: deviceID, function: function}
+		delete(reportCache.entries, key)
+		delete(reportCache.flights, key)
+	}
+
+	reportCache.lock.Unlock()
+
+	invalidationListeners.lock.RLock()
+	defer invalidationListeners.lock.RUnlock()
+
+	for _, listener := range invalidationListeners.listeners {
+		listener(deviceID)
+	}
+}
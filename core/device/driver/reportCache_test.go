@@ -0,0 +1,134 @@
+package driver
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+func TestCachedReportSharesInvocations(t *testing.T) {
+	const deviceID = "cache_shared"
+	defer InvalidateDeviceReports(deviceID)
+
+	var invocations atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	invoke := func() (types.HmsRes, error) {
+		if invocations.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return types.HmsRes{}, nil
+	}
+
+	// Concurrent readers join the invocation which is already in flight.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cachedReport(deviceID, DeviceFunctionReportPowerState, invoke)
+			assert.NoError(t, err)
+		}()
+	}
+
+	<-started
+	close(release)
+	wg.Wait()
+
+	// The successful result is reused until it expires.
+	_, err := cachedReport(deviceID, DeviceFunctionReportPowerState, invoke)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), invocations.Load())
+
+	// Invalidation forces a new invocation.
+	InvalidateDeviceReports(deviceID)
+	_, err = cachedReport(deviceID, DeviceFunctionReportPowerState, invoke)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), invocations.Load())
+}
+
+func TestCachedReportSkipsFailures(t *testing.T) {
+	const deviceID = "cache_failures"
+	defer InvalidateDeviceReports(deviceID)
+
+	invocations := 0
+	invoke := func() (types.HmsRes, error) {
+		invocations++
+		return types.HmsRes{Errors: types.HmsDiagnosticsContainer{ContainsError: true}}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		res, err := cachedReport(deviceID, DeviceFunctionReportDim, invoke)
+		assert.NoError(t, err)
+		assert.True(t, res.Errors.ContainsError)
+	}
+	assert.Equal(t, 3, invocations)
+}
+
+func TestCachedReportDiscardsStaleFlights(t *testing.T) {
+	const deviceID = "cache_stale"
+	defer InvalidateDeviceReports(deviceID)
+
+	invocations := 0
+	invoke := func() (types.HmsRes, error) {
+		invocations++
+		// The device changes while its state is being reported.
+		if invocations == 1 {
+			InvalidateDeviceReports(deviceID)
+		}
+		return types.HmsRes{}, nil
+	}
+
+	_, err := cachedReport(deviceID, DeviceFunctionReportPowerDraw, invoke)
+	assert.NoError(t, err)
+	_, err = cachedReport(deviceID, DeviceFunctionReportPowerDraw, invoke)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, invocations)
+}
+
+func TestInvalidationListeners(t *testing.T) {
+	const deviceID = "cache_listener"
+
+	invalidated := make(chan string, 1)
+	OnDeviceReportsInvalidated(func(id string) {
+		if id == deviceID {
+			invalidated <- id
+		}
+	})
+
+	InvalidateDeviceReports(deviceID)
+	assert.Equal(t, deviceID, <-invalidated)
+}
+
+func TestForEachConcurrently(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	results := make([]int, 50)
+
+	assert.NoError(t, forEachConcurrently(len(results), 4, func(index int) error {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			observed := maxRunning.Load()
+			if current <= observed || maxRunning.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		results[index] = index * 2
+		return nil
+	}))
+
+	assert.LessOrEqual(t, maxRunning.Load(), int32(4))
+	for index, result := range results {
+		assert.Equal(t, index*2, result)
+	}
+
+	assert.NoError(t, forEachConcurrently(0, 4, func(index int) error {
+		t.Fail()
+		return nil
+	}))
+}
@@ -0,0 +1,536 @@
+package driver
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/smarthome-go/homescript/v3/homescript"
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+	driverTypes "github.com/smarthome-go/smarthome/core/device/driver/types"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+//
+// Driver simulations.
+// Virtual devices only exist in memory and run their driver with mocked side-effect modules.
+// Their `net.http` and `mqtt` calls are served by scripted responses so that drivers can be tested without hardware.
+// Virtual devices can be passed to every `InvokeDriver*` function like regular devices.
+//
+
+// Every ID of a virtual device starts with this prefix.
+const VirtualDeviceIDPrefix = "@sim:"
+
+// How often scripted MQTT replies are delivered after a single invocation.
+// Replies which are caused by callbacks are delivered in the next round.
+const simulationMqttRounds = 8
+
+type virtualDevice struct {
+	lock            sync.Mutex
+	vendorID        string
+	modelID         string
+	code            string
+	driverSingleton value.ValueObject
+	deviceSingleton value.ValueObject
+	mocks           *types.TestMocks
+	output          bytes.Buffer
+}
+
+var (
+	virtualDevices        = make(map[string]*virtualDevice)
+	virtualDevicesLock    sync.RWMutex
+	virtualDeviceSequence atomic.Uint64
+)
+
+func IsVirtualDevice(deviceID string) bool {
+	return strings.HasPrefix(deviceID, VirtualDeviceIDPrefix)
+}
+
+type VirtualDevice struct {
+	Name string `json:"name"`
+	// If this is `nil`, the device is created using the zero value of its configuration.
+	Config any `json:"config"`
+}
+
+// Converts user-provided configuration JSON into a singleton.
+func simulationSingleton(config any, hmsType ast.ObjectType) (value.ValueObject, error) {
+	if config == nil {
+		return value.ObjectZeroValue(hmsType), nil
+	}
+
+	shape, err := shapeFromType(hmsType)
+	if err != nil {
+		return value.ValueObject{}, err
+	}
+
+	validated, err := shape.Validate(config)
+	if err != nil {
+		return value.ValueObject{}, err
+	}
+
+	return (*migratedToValue(validated, hmsType)).(value.ValueObject), nil
+}
+
+func (d DriverManager) createVirtualDevice(
+	vendorID, modelID, code string,
+	info DriverInfo,
+	driverConfig any,
+	device VirtualDevice,
+	mocks *types.TestMocks,
+) (deviceID string, configErr error) {
+	driverSingleton, err := simulationSingleton(driverConfig, info.DriverConfig.Info.HmsType)
+	if err != nil {
+		return "", fmt.Errorf("Invalid driver config: %s", err.Error())
+	}
+
+	deviceSingleton, err := simulationSingleton(device.Config, info.DeviceConfig.Info.HmsType)
+	if err != nil {
+		return "", fmt.Errorf("Invalid config of virtual device `%s`: %s", device.Name, err.Error())
+	}
+
+	deviceID = fmt.Sprintf("%s%s:%s:%d", VirtualDeviceIDPrefix, vendorID, modelID, virtualDeviceSequence.Add(1))
+
+	virtualDevicesLock.Lock()
+	defer virtualDevicesLock.Unlock()
+
+	virtualDevices[deviceID] = &virtualDevice{
+		lock:            sync.Mutex{},
+		vendorID:        vendorID,
+		modelID:         modelID,
+		code:            code,
+		driverSingleton: driverSingleton,
+		deviceSingleton: deviceSingleton,
+		mocks:           mocks,
+		output:          bytes.Buffer{},
+	}
+
+	return deviceID, nil
+}
+
+// Creates a virtual device of an installed driver and returns its ID.
+// If `code` is not `nil`, it is executed instead of the stored code of the driver.
+// Every virtual device owns a separate copy of the driver singleton.
+// The device must be removed using `RemoveVirtualDevice` once it is no longer needed.
+func (d DriverManager) CreateVirtualDevice(
+	vendorID, modelID string,
+	code *string,
+	driverConfig any,
+	device VirtualDevice,
+	mocks *types.TestMocks,
+) (deviceID string, found bool, codeErr error, dbErr error) {
+	driver, found, err := database.GetDeviceDriver(vendorID, modelID)
+	if err != nil || !found {
+		return "", false, nil, err
+	}
+
+	if code == nil {
+		code = &driver.HomescriptCode
+	}
+
+	info, diagnostics, err := d.extractInfoFromDriver(vendorID, modelID, *code)
+	if err != nil {
+		return "", true, nil, err
+	}
+
+	if len(diagnostics) > 0 {
+		return "", true, fmt.Errorf("Invalid driver code: %s", diagnostics[0].Message), nil
+	}
+
+	deviceID, codeErr = d.createVirtualDevice(vendorID, modelID, *code, info, driverConfig, device, mocks)
+	return deviceID, true, codeErr, nil
+}
+
+func RemoveVirtualDevice(deviceID string) {
+	virtualDevicesLock.Lock()
+	defer virtualDevicesLock.Unlock()
+
+	delete(virtualDevices, deviceID)
+}
+
+func getVirtualDevice(deviceID string) (*virtualDevice, error) {
+	virtualDevicesLock.RLock()
+	defer virtualDevicesLock.RUnlock()
+
+	device, found := virtualDevices[deviceID]
+	if !found {
+		return nil, fmt.Errorf("Virtual device `%s` does not exist", deviceID)
+	}
+
+	return device, nil
+}
+
+// Returns the configuration of a virtual device and of its driver.
+func VirtualDeviceConfig(deviceID string) (driverConfig any, deviceConfig any, err error) {
+	device, err := getVirtualDevice(deviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	device.lock.Lock()
+	defer device.lock.Unlock()
+
+	driverConfig, _ = marshalSingleton(device.driverSingleton)
+	deviceConfig, _ = marshalSingleton(device.deviceSingleton)
+	return driverConfig, deviceConfig, nil
+}
+
+func (self *virtualDevice) run(d *DriverManager, deviceID string, cancelation types.Cancelation, invocation runtime.FunctionInvocation) (types.HmsRes, error) {
+	return d.Hms.RunGeneric(
+		types.ProgramInvocation{
+			Identifier: homescript.InputProgram{
+				ProgramText: self.code,
+				Filename: types.CreateDriverHmsId(database.DriverTuple{
+					VendorID: self.vendorID,
+					ModelID:  self.modelID,
+				}),
+			},
+			FunctionInvocation: &invocation,
+			LoadedSingletons: map[string]value.Value{
+				DriverSingletonIdent:       self.driverSingleton,
+				DriverDeviceSingletonIdent: self.deviceSingleton,
+			},
+			Mocks: self.mocks,
+		},
+		types.NewExecutionContextDriver(self.vendorID, self.modelID, &deviceID),
+		cancelation,
+		nil,
+		&self.output,
+		false,
+		nil,
+	)
+}
+
+// Keeps the singletons of a successful run for the next invocation.
+func (self *virtualDevice) update(res types.HmsRes) {
+	if driverSingleton, found := res.Singletons[DriverSingletonIdent]; found {
+		self.driverSingleton = driverSingleton.(value.ValueObject)
+	}
+	if deviceSingleton, found := res.Singletons[DriverDeviceSingletonIdent]; found {
+		self.deviceSingleton = deviceSingleton.(value.ValueObject)
+	}
+}
+
+func mqttCallbackInvocation(function string, message types.FakeMqttMessage) runtime.FunctionInvocation {
+	return runtime.FunctionInvocation{
+		Function:    function,
+		LiteralName: true,
+		Args: []value.Value{
+			*value.NewValueString(message.Topic),
+			*value.NewValueString(message.Payload),
+		},
+		FunctionSignature: runtime.FunctionInvocationSignature{
+			Params: []runtime.FunctionInvocationSignatureParam{
+				{
+					Ident: "topic",
+					Type:  ast.NewStringType(errors.Span{}),
+				},
+				{
+					Ident: "payload",
+					Type:  ast.NewStringType(errors.Span{}),
+				},
+			},
+			ReturnType: ast.NewNullType(errors.Span{}),
+		},
+	}
+}
+
+// Delivers the scripted replies to messages which were published by the driver to its subscriptions.
+// If a callback fails, its result is returned and `failed` is set.
+func (self *virtualDevice) deliverMqtt(d *DriverManager, deviceID string, cancelation types.Cancelation) (res types.HmsRes, failed bool, err error) {
+	for round := 0; round < simulationMqttRounds; round++ {
+		pending := self.mocks.TakePendingMqttMessages()
+		if len(pending) == 0 {
+			return types.HmsRes{}, false, nil
+		}
+
+		for _, message := range pending {
+			for _, subscription := range self.mocks.SubscriptionsFor(message.Topic) {
+				self.mocks.RecordCall("mqtt", "deliver", []string{message.Topic, message.Payload, subscription.Function})
+
+				res, err := self.run(d, deviceID, cancelation, mqttCallbackInvocation(subscription.Function, message))
+				if err != nil {
+					return types.HmsRes{}, false, err
+				}
+
+				if res.Errors.ContainsError {
+					return res, true, nil
+				}
+
+				self.update(res)
+			}
+		}
+	}
+
+	return types.HmsRes{}, false, nil
+}
+
+// Runs a driver function of a virtual device, is called by `invokeDriverGeneric`.
+func (d *DriverManager) invokeVirtualDevice(
+	cancelation types.Cancelation,
+	deviceID string,
+	vendorID,
+	modelID string,
+	invocation runtime.FunctionInvocation,
+) (types.HmsRes, error) {
+	device, err := getVirtualDevice(deviceID)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+
+	if device.vendorID != vendorID || device.modelID != modelID {
+		return types.HmsRes{}, fmt.Errorf(
+			"Virtual device `%s` uses driver `%s:%s`, not `%s:%s`",
+			deviceID,
+			device.vendorID,
+			device.modelID,
+			vendorID,
+			modelID,
+		)
+	}
+
+	// Invocations of the same device are serialized so that singleton updates are not lost.
+	device.lock.Lock()
+	defer device.lock.Unlock()
+
+	res, err := device.run(d, deviceID, cancelation, invocation)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+
+	if res.Errors.ContainsError {
+		return filterErrorDiagnostics(res), nil
+	}
+
+	device.update(res)
+
+	callbackRes, failed, err := device.deliverMqtt(d, deviceID, cancelation)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+
+	if failed {
+		return filterErrorDiagnostics(callbackRes), nil
+	}
+
+	return res, nil
+}
+
+//
+// Simulation runner.
+//
+
+type DriverSimulation struct {
+	VendorID string `json:"vendorId"`
+	ModelID  string `json:"modelId"`
+	// If this is `nil`, the stored code of the driver is simulated.
+	HomescriptCode *string         `json:"homescriptCode"`
+	DriverConfig   any             `json:"driverConfig"`
+	Devices        []VirtualDevice `json:"devices"`
+	// Scripted responses which are shared by all virtual devices.
+	HttpResponses []types.FakeHttpResponse `json:"httpResponses"`
+	MqttResponses []types.FakeMqttResponse `json:"mqttResponses"`
+	// The arguments which are passed to `set_power` and `dim`.
+	PowerState bool  `json:"powerState"`
+	DimValue   int64 `json:"dimValue"`
+}
+
+type SimulatedFunctionResult struct {
+	Function string `json:"function"`
+	// Is `nil` if the function failed or does not return anything.
+	Output    any              `json:"output"`
+	HmsErrors []types.HmsError `json:"hmsErrors"`
+}
+
+type SimulatedDeviceReport struct {
+	DeviceID     string                    `json:"deviceId"`
+	Name         string                    `json:"name"`
+	Results      []SimulatedFunctionResult `json:"results"`
+	MockedCalls  []types.MockedCall        `json:"mockedCalls"`
+	Output       string                    `json:"output"`
+	DriverConfig any                       `json:"driverConfig"`
+	DeviceConfig any                       `json:"deviceConfig"`
+}
+
+type DriverSimulationReport struct {
+	VendorID     string                  `json:"vendorId"`
+	ModelID      string                  `json:"modelId"`
+	Capabilities []DeviceCapability      `json:"capabilities"`
+	Success      bool                    `json:"success"`
+	Devices      []SimulatedDeviceReport `json:"devices"`
+}
+
+func simulatedResult(function string, output any, hmsErrors []types.HmsError) SimulatedFunctionResult {
+	if len(hmsErrors) > 0 {
+		output = nil
+	} else {
+		hmsErrors = make([]types.HmsError, 0)
+	}
+
+	return SimulatedFunctionResult{
+		Function:  function,
+		Output:    output,
+		HmsErrors: hmsErrors,
+	}
+}
+
+// Invokes every device function which is supported by the capabilities of the driver on a virtual device.
+func (d DriverManager) simulateDevice(
+	ids driverTypes.DriverInvocationIDs,
+	capabilities CapabilitySet[DeviceCapability],
+	simulation DriverSimulation,
+) ([]SimulatedFunctionResult, error) {
+	results := make([]SimulatedFunctionResult, 0)
+
+	hmsErrors, err := d.InvokeValidateCheckDriver(ids)
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, simulatedResult(DeviceFunctionValidateDevice, nil, hmsErrors))
+
+	if capabilities.Has(DeviceCapabilityPower) {
+		state, hmsErrors, err := d.InvokeDriverReportPowerState(ids)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, simulatedResult(DeviceFunctionReportPowerState, state, hmsErrors))
+
+		draw, hmsErrors, err := d.InvokeDriverReportPowerDraw(ids)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, simulatedResult(DeviceFunctionReportPowerDraw, draw, hmsErrors))
+
+		changed, hmsErrors, err := d.InvokeDriverSetPower(*ids.DeviceID, ids.VendorID, ids.ModelID, DriverActionPower{
+			State: simulation.PowerState,
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, simulatedResult(DeviceFunctionSetPower, changed, hmsErrors))
+	}
+
+	if capabilities.Has(DeviceCapabilityDimmable) {
+		dimmables, hmsErrors, err := d.InvokeDriverReportDimmable(ids)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, simulatedResult(DeviceFunctionReportDim, dimmables, hmsErrors))
+
+		// The first reported label is dimmed, drivers which do not report any labels receive an empty label.
+		label := ""
+		if len(dimmables) > 0 {
+			label = dimmables[0].Label
+		}
+
+		changed, hmsErrors, err := d.InvokeDriverDim(*ids.DeviceID, ids.VendorID, ids.ModelID, DriverActionDim{
+			Value: simulation.DimValue,
+			Label: label,
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, simulatedResult(DeviceFunctionSetDim, changed, hmsErrors))
+	}
+
+	if capabilities.Has(DeviceCapabilitySensor) {
+		readings, hmsErrors, err := d.InvokeDriverReportSensors(ids)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, simulatedResult(DeviceFunctionReportSensorReadings, readings, hmsErrors))
+	}
+
+	return results, nil
+}
+
+// Creates the virtual devices of a simulation and invokes every supported device function on each of them.
+// The virtual devices are removed afterwards, nothing is persisted.
+func (d DriverManager) SimulateDriver(simulation DriverSimulation) (report DriverSimulationReport, found bool, codeErr error, dbErr error) {
+	driver, found, err := database.GetDeviceDriver(simulation.VendorID, simulation.ModelID)
+	if err != nil || !found {
+		return DriverSimulationReport{}, false, nil, err
+	}
+
+	code := driver.HomescriptCode
+	if simulation.HomescriptCode != nil {
+		code = *simulation.HomescriptCode
+	}
+
+	info, diagnostics, err := d.extractInfoFromDriver(driver.VendorID, driver.ModelID, code)
+	if err != nil {
+		return DriverSimulationReport{}, true, nil, err
+	}
+
+	if len(diagnostics) > 0 {
+		return DriverSimulationReport{}, true, fmt.Errorf("Invalid driver code: %s", diagnostics[0].Message), nil
+	}
+
+	report = DriverSimulationReport{
+		VendorID:     driver.VendorID,
+		ModelID:      driver.ModelID,
+		Capabilities: info.DeviceConfig.Capabilities,
+		Success:      true,
+		Devices:      make([]SimulatedDeviceReport, 0),
+	}
+
+	for _, device := range simulation.Devices {
+		mocks := types.NewSimulationMocks(simulation.HttpResponses, simulation.MqttResponses)
+
+		deviceID, configErr := d.createVirtualDevice(driver.VendorID, driver.ModelID, code, info, simulation.DriverConfig, device, mocks)
+		if configErr != nil {
+			return DriverSimulationReport{}, true, configErr, nil
+		}
+		defer RemoveVirtualDevice(deviceID)
+
+		results, err := d.simulateDevice(
+			driverTypes.DriverInvocationIDs{
+				DeviceID: &deviceID,
+				VendorID: driver.VendorID,
+				ModelID:  driver.ModelID,
+			},
+			info.DeviceConfig.Capabilities,
+			simulation,
+		)
+		if err != nil {
+			return DriverSimulationReport{}, true, nil, err
+		}
+
+		for _, result := range results {
+			if len(result.HmsErrors) > 0 {
+				report.Success = false
+			}
+		}
+
+		driverConfig, deviceConfig, err := VirtualDeviceConfig(deviceID)
+		if err != nil {
+			return DriverSimulationReport{}, true, nil, err
+		}
+
+		virtual, err := getVirtualDevice(deviceID)
+		if err != nil {
+			return DriverSimulationReport{}, true, nil, err
+		}
+
+		virtual.lock.Lock()
+		output := virtual.output.String()
+		virtual.lock.Unlock()
+
+		report.Devices = append(report.Devices, SimulatedDeviceReport{
+			DeviceID:     deviceID,
+			Name:         device.Name,
+			Results:      results,
+			MockedCalls:  mocks.Calls(),
+			Output:       output,
+			DriverConfig: driverConfig,
+			DeviceConfig: deviceConfig,
+		})
+	}
+
+	return report, true, nil, nil
+}
@@ -3,6 +3,7 @@ package driver
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"sync"
 
 	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
@@ -94,8 +95,6 @@ func (d DriverManager) StoreDriverSingletonConfigUpdate(
 	if affetedASetting {
 		log.Debugf("Driver `%s:%s` singleton update affected a `settings` field, triggering reload...", driver.Driver.VendorID, driver.Driver.ModelID)
 		// TODO: only make the driver dirty if the change originates from the web.
-		// TODO: only trigger this if there were changes.
-		// TLDR: only mark dirty if settings fields were altered.
 		if err := MakeDriverDirty(vendorID, modelID, true); err != nil {
 			return err
 		}
@@ -240,10 +239,14 @@ func ApplyTransactionOnStored(
 				continue
 			}
 
-			if transformed.FieldsInternal[field.FieldName.Ident()] != newF {
-				changedASettingsField = true
-				transformed.FieldsInternal[field.FieldName.Ident()] = newF
-			}
+			transformed.FieldsInternal[field.FieldName.Ident()] = newF
+			continue
+		}
+
+		// Settings may be used by trigger annotations, for instance as MQTT topics.
+		// Only changes to them require a reload, state updates of the driver do not.
+		if !storedValuesEqual(transformed.FieldsInternal[field.FieldName.Ident()], newVal.FieldsInternal[field.FieldName.Ident()]) {
+			changedASettingsField = true
 		}
 
 		transformed.FieldsInternal[field.FieldName.Ident()] = newVal.FieldsInternal[field.FieldName.Ident()]
@@ -252,6 +255,17 @@ func ApplyTransactionOnStored(
 	return changedASettingsField, transformed
 }
 
+func storedValuesEqual(a *value.Value, b *value.Value) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	aMarshaled, _ := value.MarshalValue(*a, false)
+	bMarshaled, _ := value.MarshalValue(*b, false)
+
+	return reflect.DeepEqual(aMarshaled, bMarshaled)
+}
+
 func filterObjFieldsWithoutSetting(input value.ValueObject, singletonType ast.ObjectType) value.ValueObject {
 	outputFields := make(map[string]*value.Value)
 
@@ -31,8 +31,40 @@ func ParseDriverVersion(source string) (SemanticVersion, error) {
 		parsedValues[idx] = parsed
 	}
 
-	//nolint:exhaustruct
-	return SemanticVersion{}, nil
+	return SemanticVersion{
+		Major: parsedValues[0],
+		Minor: parsedValues[1],
+		Patch: parsedValues[2],
+	}, nil
+}
+
+// Parses a version which may carry a pre-release or build suffix, for instance `0.12.0-alpha`.
+// The suffix is ignored, this is used for the version of the Smarthome server.
+func ParseServerVersion(source string) (SemanticVersion, error) {
+	if idx := strings.IndexAny(source, "-+"); idx >= 0 {
+		source = source[:idx]
+	}
+	return ParseDriverVersion(source)
+}
+
+// Returns -1 if this version is older than `other`, 0 if both are equal and 1 if this version is newer.
+func (self SemanticVersion) Compare(other SemanticVersion) int {
+	pairs := [semVerSegments][2]uint64{
+		{self.Major, other.Major},
+		{self.Minor, other.Minor},
+		{self.Patch, other.Patch},
+	}
+
+	for _, pair := range pairs {
+		if pair[0] < pair[1] {
+			return -1
+		}
+		if pair[0] > pair[1] {
+			return 1
+		}
+	}
+
+	return 0
 }
 
 func (self SemanticVersion) String() string {
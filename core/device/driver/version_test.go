@@ -0,0 +1,33 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDriverVersion(t *testing.T) {
+	version, err := ParseDriverVersion("1.12.3")
+	assert.NoError(t, err)
+	assert.Equal(t, SemanticVersion{Major: 1, Minor: 12, Patch: 3}, version)
+	assert.Equal(t, "1.12.3", version.String())
+
+	for _, invalid := range []string{"", "1.2", "1.2.3.4", "1.2.x", "0.12.0-alpha"} {
+		_, err := ParseDriverVersion(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	version, err = ParseServerVersion("0.12.0-alpha")
+	assert.NoError(t, err)
+	assert.Equal(t, SemanticVersion{Major: 0, Minor: 12, Patch: 0}, version)
+}
+
+func TestCompareVersions(t *testing.T) {
+	base := SemanticVersion{Major: 1, Minor: 2, Patch: 3}
+
+	assert.Equal(t, 0, base.Compare(base))
+	assert.Equal(t, -1, base.Compare(SemanticVersion{Major: 1, Minor: 2, Patch: 4}))
+	assert.Equal(t, -1, base.Compare(SemanticVersion{Major: 2, Minor: 0, Patch: 0}))
+	assert.Equal(t, 1, base.Compare(SemanticVersion{Major: 1, Minor: 1, Patch: 9}))
+	assert.Equal(t, 1, base.Compare(SemanticVersion{Major: 0, Minor: 9, Patch: 9}))
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -46,7 +47,10 @@ type SetupUser struct {
 	Tokens            []SetupAuthToken         `json:"tokens"`
 	Homescripts       []SetupHomescript        `json:"homescripts"`
 	HomescriptStorage []SetupHomescriptStorage `json:"homescriptStorage"`
-	Reminders         []SetupReminder          `json:"reminders"`
+	// Entries of the typed, namespaced storage
+	HomescriptStore   []SetupHomescriptStorageEntry `json:"homescriptStore"`
+	HomescriptSecrets []SetupHomescriptSecret       `json:"homescriptSecrets"`
+	Reminders         []SetupReminder               `json:"reminders"`
 
 	// Profile picture as B64
 	ProfilePicture *SetupUserProfilePicture `json:"profilePicture"`
@@ -103,6 +107,24 @@ type SetupHomescriptStorage struct {
 	Value string `json:"value"`
 }
 
+type SetupHomescriptStorageEntry struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	// The value as tagged JSON
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt *time.Time      `json:"expiresAt"`
+}
+
+// Secrets are only exported in their encrypted form
+// They can only be decrypted by a server which uses the same secrets key
+type SetupHomescriptSecret struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Shared      bool   `json:"shared"`
+	// Base64-encoded ciphertext
+	Ciphertext string `json:"ciphertext"`
+}
+
 type SetupAutomation struct {
 	Name                   string                     `json:"name"`
 	Description            string                     `json:"description"`
@@ -303,6 +325,37 @@ func ExportConfig(
 			})
 		}
 
+		storeEntries, err := database.ListHomescriptStorageEntries(userData.Username, "", "")
+		if err != nil {
+			return SetupStruct{}, err
+		}
+
+		storeOutput := make([]SetupHomescriptStorageEntry, 0)
+		for _, entry := range storeEntries {
+			storeOutput = append(storeOutput, SetupHomescriptStorageEntry{
+				Namespace: entry.Namespace,
+				Key:       entry.Key,
+				Value:     json.RawMessage(entry.Value),
+				ExpiresAt: entry.ExpiresAt,
+			})
+		}
+
+		// Homescript secrets
+		secrets, err := database.ListHomescriptSecretsOfUser(userData.Username)
+		if err != nil {
+			return SetupStruct{}, err
+		}
+
+		secretsOutput := make([]SetupHomescriptSecret, 0)
+		for _, secret := range secrets {
+			secretsOutput = append(secretsOutput, SetupHomescriptSecret{
+				Name:        secret.Name,
+				Description: secret.Description,
+				Shared:      secret.Shared,
+				Ciphertext:  base64.StdEncoding.EncodeToString(secret.Ciphertext),
+			})
+		}
+
 		// Reminders
 		remindersDB, err := database.GetUserReminders(userData.Username)
 		if err != nil {
@@ -376,6 +429,8 @@ func ExportConfig(
 			Tokens:            tokens,
 			Homescripts:       homescripts,
 			HomescriptStorage: storageOutput,
+			HomescriptStore:   storeOutput,
+			HomescriptSecrets: secretsOutput,
 			Reminders:         reminders,
 			Permissions:       permissions,
 			DevicePermissions: devPermissions,
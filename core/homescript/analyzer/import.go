@@ -34,6 +34,10 @@ func GetImport(
 		}, true, true
 	}
 
+	if result, moduleFound, valueFound := getStdlibImport(moduleName, valueName, span); moduleFound {
+		return result, moduleFound, valueFound
+	}
+
 	switch moduleName {
 	case "triggers":
 		if kind != pAst.IMPORT_KIND_TRIGGER {
@@ -95,6 +99,40 @@ func GetImport(
 				Type:     nil,
 				Template: nil,
 			}, true, true
+		case types.TriggerCronIdent:
+			trigger := timeTrigger([]ast.FunctionTypeParam{
+				ast.NewFunctionTypeParam(pAst.NewSpannedIdent("expression", span), ast.NewStringType(span), nil),
+			}, span)
+			trigger.Connective = pAst.OnTriggerDispatchKeyword
+
+			return analyzer.BuiltinImport{
+				Trigger:  &trigger,
+				Type:     nil,
+				Template: nil,
+			}, true, true
+		case types.TriggerSunriseIdent, types.TriggerSunsetIdent:
+			trigger := timeTrigger([]ast.FunctionTypeParam{
+				ast.NewFunctionTypeParam(pAst.NewSpannedIdent("offset_minutes", span), ast.NewIntType(span), nil),
+			}, span)
+			trigger.Connective = pAst.AtTriggerDispatchKeyword
+
+			return analyzer.BuiltinImport{
+				Trigger:  &trigger,
+				Type:     nil,
+				Template: nil,
+			}, true, true
+		case types.TriggerAtIdent:
+			trigger := timeTrigger([]ast.FunctionTypeParam{
+				ast.NewFunctionTypeParam(pAst.NewSpannedIdent("hour", span), ast.NewIntType(span), nil),
+				ast.NewFunctionTypeParam(pAst.NewSpannedIdent("minute", span), ast.NewIntType(span), nil),
+			}, span)
+			trigger.Connective = pAst.AtTriggerDispatchKeyword
+
+			return analyzer.BuiltinImport{
+				Trigger:  &trigger,
+				Type:     nil,
+				Template: nil,
+			}, true, true
 		default:
 			return analyzer.BuiltinImport{}, true, false
 		}
@@ -178,14 +216,15 @@ func GetImport(
 						).(ast.FunctionType),
 						CallbackFnType: ast.NewFunctionType(
 							ast.NewNormalFunctionTypeParamKind(
+								// NOTE: this has to match the invocation of MQTT callbacks in the dispatcher.
 								[]ast.FunctionTypeParam{
 									ast.NewFunctionTypeParam(
-										pAst.NewSpannedIdent("payload", span),
+										pAst.NewSpannedIdent("topic", span),
 										ast.NewStringType(span),
 										nil,
 									),
 									ast.NewFunctionTypeParam(
-										pAst.NewSpannedIdent("topic", span),
+										pAst.NewSpannedIdent("payload", span),
 										ast.NewStringType(span),
 										nil,
 									),
@@ -199,12 +238,75 @@ func GetImport(
 						ImportedAt: span,
 					},
 				}, true, true
+			case types.TriggerMqttBrokerMessageIdent:
+				return analyzer.BuiltinImport{
+					Type:     nil,
+					Template: nil,
+					Trigger: &analyzer.TriggerFunction{
+						TriggerFnType: ast.NewFunctionType(
+							ast.NewNormalFunctionTypeParamKind(
+								[]ast.FunctionTypeParam{
+									ast.NewFunctionTypeParam(
+										pAst.NewSpannedIdent("broker", span),
+										ast.NewStringType(span),
+										nil,
+									),
+									ast.NewFunctionTypeParam(
+										pAst.NewSpannedIdent("topics", span),
+										ast.NewListType(ast.NewStringType(span), span),
+										nil,
+									),
+								},
+							),
+							span,
+							ast.NewNullType(span),
+							span,
+						).(ast.FunctionType),
+						// NOTE: this has to match the invocation of MQTT callbacks in the dispatcher.
+						CallbackFnType: MqttCallbackFn(span).(ast.FunctionType),
+						Connective:     pAst.OnTriggerDispatchKeyword,
+						ImportedAt:     span,
+					},
+				}, true, true
 			}
 
 			return analyzer.BuiltinImport{}, true, false
 		}
 
 		switch valueName {
+		case "subscribe_to":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("broker", span), ast.NewStringType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("topics", span), ast.NewListType(ast.NewStringType(span), span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("callback", span), ast.NewFunctionType(
+							ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{}),
+							span,
+							ast.NewNullType(span),
+							span,
+						), nil),
+					}),
+					span,
+					ast.NewNullType(span),
+					span,
+				),
+				Template: nil,
+			}, true, true
+		case "publish_to":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("broker", span), ast.NewStringType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("topic", span), ast.NewStringType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("payload", span), ast.NewStringType(span), nil),
+					}),
+					span,
+					ast.NewNullType(span),
+					span,
+				),
+				Template: nil,
+			}, true, true
 		case "subscribe":
 			return analyzer.BuiltinImport{
 				Type: ast.NewFunctionType(
@@ -338,30 +440,77 @@ func GetImport(
 			nil,
 		)
 
+		deviceIDParam := ast.NewFunctionTypeParam(pAst.NewSpannedIdent("device_id", span), ast.NewStringType(span), nil)
+		deviceQuery := func(params []ast.FunctionTypeParam, result ast.Type) (analyzer.BuiltinImport, bool, bool) {
+			if params == nil {
+				params = make([]ast.FunctionTypeParam, 0)
+			}
+
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind(params),
+					span,
+					result,
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
+		}
+
 		switch valueName {
-		// TODO: port to device
-		// case "get_switch":
-		// 	return analyzer.BuiltinImport{
-		// 		Type: ast.NewFunctionType(
-		// 			ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{
-		// 				ast.NewFunctionTypeParam(pAst.NewSpannedIdent("id", span), ast.NewStringType(span), nil),
-		// 			}),
-		// 			span,
-		// 			ast.NewOptionType(
-		// 				ast.NewObjectType(
-		// 					[]ast.ObjectTypeField{
-		// 						ast.NewObjectTypeField(pAst.NewSpannedIdent("name", span), ast.NewStringType(span), span),
-		// 						ast.NewObjectTypeField(pAst.NewSpannedIdent("room_id", span), ast.NewStringType(span), span),
-		// 						ast.NewObjectTypeField(pAst.NewSpannedIdent("power", span), ast.NewBoolType(span), span),
-		// 						ast.NewObjectTypeField(pAst.NewSpannedIdent("watts", span), ast.NewIntType(span), span),
-		// 						ast.NewObjectTypeField(pAst.NewSpannedIdent("target_node", span), ast.NewOptionType(ast.NewStringType(span), span), span),
-		// 					},
-		// 					span),
-		// 				span),
-		// 			span,
-		// 		),
-		// 		Template: &ast.TemplateSpec{},
-		// 	}, true, true
+		case "DeviceInfo", "DimLevel", "SensorReading":
+			if kind != pAst.IMPORT_KIND_TYPE {
+				return analyzer.BuiltinImport{}, true, true
+			}
+
+			typ := map[string]ast.Type{
+				"DeviceInfo":    deviceInfoType(span),
+				"DimLevel":      dimLevelType(span),
+				"SensorReading": sensorReadingType(span),
+			}[valueName]
+
+			return analyzer.BuiltinImport{
+				Type:     typ,
+				Template: nil,
+				Trigger:  nil,
+			}, true, true
+		case "list_devices":
+			return deviceQuery(nil, ast.NewListType(deviceInfoType(span), span))
+		case "list_room_devices":
+			return deviceQuery(
+				[]ast.FunctionTypeParam{
+					ast.NewFunctionTypeParam(pAst.NewSpannedIdent("room_id", span), ast.NewStringType(span), nil),
+				},
+				ast.NewListType(deviceInfoType(span), span),
+			)
+		case "list_capability_devices":
+			return deviceQuery(
+				[]ast.FunctionTypeParam{
+					ast.NewFunctionTypeParam(pAst.NewSpannedIdent("capability", span), ast.NewStringType(span), nil),
+				},
+				ast.NewListType(deviceInfoType(span), span),
+			)
+		case "list_driver_devices":
+			return deviceQuery(
+				[]ast.FunctionTypeParam{
+					ast.NewFunctionTypeParam(pAst.NewSpannedIdent("vendor_id", span), ast.NewStringType(span), nil),
+					ast.NewFunctionTypeParam(pAst.NewSpannedIdent("model_id", span), ast.NewStringType(span), nil),
+				},
+				ast.NewListType(deviceInfoType(span), span),
+			)
+		case "get_device":
+			return deviceQuery(
+				[]ast.FunctionTypeParam{deviceIDParam},
+				ast.NewOptionType(deviceInfoType(span), span),
+			)
+		case "power_state":
+			return deviceQuery([]ast.FunctionTypeParam{deviceIDParam}, ast.NewBoolType(span))
+		case "power_draw":
+			return deviceQuery([]ast.FunctionTypeParam{deviceIDParam}, ast.NewIntType(span))
+		case "dim_levels":
+			return deviceQuery([]ast.FunctionTypeParam{deviceIDParam}, ast.NewListType(dimLevelType(span), span))
+		case "sensor_readings":
+			return deviceQuery([]ast.FunctionTypeParam{deviceIDParam}, ast.NewListType(sensorReadingType(span), span))
 		case "emit":
 			return analyzer.BuiltinImport{
 				Type: ast.NewFunctionType(
@@ -546,6 +695,34 @@ func GetImport(
 				),
 				Template: &ast.TemplateSpec{},
 			}, true, true
+		case "Store":
+			if kind != pAst.IMPORT_KIND_TYPE {
+				return analyzer.BuiltinImport{}, true, true
+			}
+
+			return analyzer.BuiltinImport{
+				Type:     storeType(span),
+				Template: nil,
+				Trigger:  nil,
+			}, true, true
+		case "store":
+			return analyzer.BuiltinImport{
+				Type:     storeType(span),
+				Template: &ast.TemplateSpec{},
+			}, true, true
+		case "open_store":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(ast.NewNormalFunctionTypeParamKind(
+					[]ast.FunctionTypeParam{
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("name", span), ast.NewStringType(span), nil),
+					},
+				),
+					span,
+					storeType(span),
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
 		default:
 			return analyzer.BuiltinImport{}, true, false
 		}
@@ -574,6 +751,24 @@ func GetImport(
 		default:
 			return analyzer.BuiltinImport{}, true, false
 		}
+	case "secrets":
+		switch valueName {
+		case "get":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(ast.NewNormalFunctionTypeParamKind(
+					[]ast.FunctionTypeParam{
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("name", span), ast.NewStringType(span), nil),
+					},
+				),
+					span,
+					ast.NewOptionType(ast.NewStringType(span), span),
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
+		default:
+			return analyzer.BuiltinImport{}, true, false
+		}
 	case "net":
 		newHttpResponse := func() ast.Type {
 			return ast.NewObjectType(
@@ -601,6 +796,52 @@ func GetImport(
 				),
 				Template: &ast.TemplateSpec{},
 			}, true, true
+		case "wake_on_lan":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("mac", span), ast.NewStringType(span), nil),
+					}),
+					span,
+					ast.NewNullType(span),
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
+		case "tcp_send", "tcp_request":
+			var result ast.Type = ast.NewNullType(span)
+			if valueName == "tcp_request" {
+				result = ast.NewStringType(span)
+			}
+
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("host", span), ast.NewStringType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("port", span), ast.NewIntType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("data", span), ast.NewStringType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("timeout", span), ast.NewFloatType(span), nil),
+					}),
+					span,
+					result,
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
+		case "udp_send":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("host", span), ast.NewStringType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("port", span), ast.NewIntType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("data", span), ast.NewStringType(span), nil),
+					}),
+					span,
+					ast.NewNullType(span),
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
 		case "HttpResponse":
 			return analyzer.BuiltinImport{
 				Type:     newHttpResponse(),
@@ -708,6 +949,14 @@ func GetImport(
 			ast.NewObjectTypeField(pAst.NewSpannedIdent("level", span), ast.NewIntType(span), span),
 		}, span)
 
+		webhookRequestType := ast.NewObjectType([]ast.ObjectTypeField{
+			ast.NewObjectTypeField(pAst.NewSpannedIdent("webhook_id", span), ast.NewStringType(span), span),
+			ast.NewObjectTypeField(pAst.NewSpannedIdent("method", span), ast.NewStringType(span), span),
+			ast.NewObjectTypeField(pAst.NewSpannedIdent("headers", span), ast.NewAnyObjectType(span), span),
+			ast.NewObjectTypeField(pAst.NewSpannedIdent("query", span), ast.NewAnyObjectType(span), span),
+			ast.NewObjectTypeField(pAst.NewSpannedIdent("body", span), ast.NewStringType(span), span),
+		}, span)
+
 		switch valueName {
 		case "args":
 			return analyzer.BuiltinImport{
@@ -729,6 +978,21 @@ func GetImport(
 				Type:     ast.NewOptionType(notificationType, span),
 				Template: nil,
 			}, true, true
+		case "WebhookRequest":
+			if kind != pAst.IMPORT_KIND_TYPE {
+				return analyzer.BuiltinImport{}, true, true
+			}
+
+			return analyzer.BuiltinImport{
+				Type:     webhookRequestType,
+				Template: nil,
+				Trigger:  nil,
+			}, true, true
+		case "webhook":
+			return analyzer.BuiltinImport{
+				Type:     ast.NewOptionType(webhookRequestType, span),
+				Template: nil,
+			}, true, true
 		}
 		return analyzer.BuiltinImport{}, true, false
 	case "scheduler":
@@ -799,6 +1063,66 @@ func GetImport(
 			}, true, true
 		}
 		return analyzer.BuiltinImport{}, true, false
+	case "camera":
+		cameraIDParam := ast.NewFunctionTypeParam(pAst.NewSpannedIdent("camera_id", span), ast.NewStringType(span), nil)
+
+		switch valueName {
+		case "Camera":
+			if kind != pAst.IMPORT_KIND_TYPE {
+				return analyzer.BuiltinImport{}, true, true
+			}
+
+			return analyzer.BuiltinImport{
+				Type:     cameraType(span),
+				Template: nil,
+			}, true, true
+		case "list_cameras":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind(make([]ast.FunctionTypeParam, 0)),
+					span,
+					ast.NewListType(cameraType(span), span),
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
+		case "save_snapshot":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{cameraIDParam}),
+					span,
+					ast.NewIntType(span),
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
+		case "notify_snapshot":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{
+						cameraIDParam,
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("title", span), ast.NewStringType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("description", span), ast.NewStringType(span), nil),
+						ast.NewFunctionTypeParam(pAst.NewSpannedIdent("level", span), ast.NewIntType(span), nil),
+					}),
+					span,
+					ast.NewIntType(span),
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
+		case "frame_difference":
+			return analyzer.BuiltinImport{
+				Type: ast.NewFunctionType(
+					ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{cameraIDParam}),
+					span,
+					ast.NewOptionType(ast.NewFloatType(span), span),
+					span,
+				),
+				Template: &ast.TemplateSpec{},
+			}, true, true
+		}
+		return analyzer.BuiltinImport{}, true, false
 	case "notification":
 		switch valueName {
 		case "notify":
@@ -829,3 +1153,123 @@ func GetImport(
 	}
 	return analyzer.BuiltinImport{}, false, false
 }
+
+// Time-based triggers share the same callback signature: `fn(elapsed: int)`.
+// The `elapsed` parameter contains the seconds since the trigger was registered.
+func timeTrigger(params []ast.FunctionTypeParam, span errors.Span) analyzer.TriggerFunction {
+	return analyzer.TriggerFunction{
+		TriggerFnType: ast.NewFunctionType(
+			ast.NewNormalFunctionTypeParamKind(params),
+			span,
+			ast.NewNullType(span),
+			span,
+		).(ast.FunctionType),
+		CallbackFnType: ast.NewFunctionType(
+			ast.NewNormalFunctionTypeParamKind([]ast.FunctionTypeParam{
+				ast.NewFunctionTypeParam(
+					pAst.NewSpannedIdent("elapsed", span),
+					ast.NewIntType(span),
+					nil,
+				),
+			}),
+			span,
+			ast.NewNullType(span),
+			span,
+		).(ast.FunctionType),
+		ImportedAt: span,
+	}
+}
+
+// A handle to one namespace of the typed Homescript storage.
+// The `store` value of the `storage` module is bound to the namespace of the running script.
+func storeType(span errors.Span) ast.Type {
+	method := func(params []ast.FunctionTypeParam, result ast.Type) ast.Type {
+		return ast.NewFunctionType(ast.NewNormalFunctionTypeParamKind(params), span, result, span)
+	}
+	param := func(name string, typ ast.Type) ast.FunctionTypeParam {
+		return ast.NewFunctionTypeParam(pAst.NewSpannedIdent(name, span), typ, nil)
+	}
+	field := func(name string, typ ast.Type) ast.ObjectTypeField {
+		return ast.NewObjectTypeField(pAst.NewSpannedIdent(name, span), typ, span)
+	}
+
+	return ast.NewObjectType([]ast.ObjectTypeField{
+		field("namespace", ast.NewStringType(span)),
+		field("get", method(
+			[]ast.FunctionTypeParam{param("key", ast.NewStringType(span))},
+			ast.NewOptionType(ast.NewAnyType(span), span),
+		)),
+		field("set", method(
+			[]ast.FunctionTypeParam{param("key", ast.NewStringType(span)), param("value", ast.NewUnknownType())},
+			ast.NewNullType(span),
+		)),
+		field("set_ttl", method(
+			[]ast.FunctionTypeParam{
+				param("key", ast.NewStringType(span)),
+				param("value", ast.NewUnknownType()),
+				param("ttl_seconds", ast.NewIntType(span)),
+			},
+			ast.NewNullType(span),
+		)),
+		field("delete", method(
+			[]ast.FunctionTypeParam{param("key", ast.NewStringType(span))},
+			ast.NewBoolType(span),
+		)),
+		field("increment", method(
+			[]ast.FunctionTypeParam{param("key", ast.NewStringType(span)), param("by", ast.NewIntType(span))},
+			ast.NewIntType(span),
+		)),
+		field("compare_and_swap", method(
+			[]ast.FunctionTypeParam{
+				param("key", ast.NewStringType(span)),
+				param("expected", ast.NewUnknownType()),
+				param("new", ast.NewUnknownType()),
+			},
+			ast.NewBoolType(span),
+		)),
+		field("keys", method(
+			[]ast.FunctionTypeParam{param("prefix", ast.NewStringType(span))},
+			ast.NewListType(ast.NewStringType(span), span),
+		)),
+	}, span)
+}
+
+// Metadata of a device as returned by the query functions of the `device` module.
+func deviceInfoType(span errors.Span) ast.Type {
+	return ast.NewObjectType([]ast.ObjectTypeField{
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("id", span), ast.NewStringType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("name", span), ast.NewStringType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("room_id", span), ast.NewStringType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("vendor_id", span), ast.NewStringType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("model_id", span), ast.NewStringType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("capabilities", span), ast.NewListType(ast.NewStringType(span), span), span),
+	}, span)
+}
+
+// The current value of a dimmable function of a device, `lower` and `upper` are inclusive.
+func dimLevelType(span errors.Span) ast.Type {
+	return ast.NewObjectType([]ast.ObjectTypeField{
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("label", span), ast.NewStringType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("value", span), ast.NewIntType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("lower", span), ast.NewIntType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("upper", span), ast.NewIntType(span), span),
+	}, span)
+}
+
+// A single reading of a sensor, the value is always of a primitive type.
+func sensorReadingType(span errors.Span) ast.Type {
+	return ast.NewObjectType([]ast.ObjectTypeField{
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("label", span), ast.NewStringType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("value", span), ast.NewAnyType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("unit", span), ast.NewStringType(span), span),
+	}, span)
+}
+
+// A camera which the user may view.
+func cameraType(span errors.Span) ast.Type {
+	return ast.NewObjectType([]ast.ObjectTypeField{
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("id", span), ast.NewStringType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("name", span), ast.NewStringType(span), span),
+		ast.NewObjectTypeField(pAst.NewSpannedIdent("room_id", span), ast.NewStringType(span), span),
+	}, span)
+}
@@ -0,0 +1,108 @@
+package analyzer
+
+import (
+	"sort"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	pAst "github.com/smarthome-go/homescript/v3/homescript/parser/ast"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// A value, type, template or trigger which can be imported from a builtin module.
+type BuiltinMember struct {
+	Name string
+	Kind pAst.IMPORT_KIND
+}
+
+// Lists the importable members of every builtin module, this is used for editor completions.
+// NOTE: this has to be kept in sync with `GetImport`.
+func BuiltinModules() map[string][]BuiltinMember {
+	normal := func(names ...string) []BuiltinMember {
+		members := make([]BuiltinMember, len(names))
+		for idx, name := range names {
+			members[idx] = BuiltinMember{Name: name, Kind: pAst.IMPORT_KIND_NORMAL}
+		}
+		return members
+	}
+
+	modules := map[string][]BuiltinMember{
+		"triggers": {
+			{Name: types.TriggerKillIdent, Kind: pAst.IMPORT_KIND_TRIGGER},
+			{Name: types.TriggerMinuteIdent, Kind: pAst.IMPORT_KIND_TRIGGER},
+			{Name: types.TriggerCronIdent, Kind: pAst.IMPORT_KIND_TRIGGER},
+			{Name: types.TriggerSunriseIdent, Kind: pAst.IMPORT_KIND_TRIGGER},
+			{Name: types.TriggerSunsetIdent, Kind: pAst.IMPORT_KIND_TRIGGER},
+			{Name: types.TriggerAtIdent, Kind: pAst.IMPORT_KIND_TRIGGER},
+		},
+		"driver": {
+			{Name: "DriverMeta", Kind: pAst.IMPORT_KIND_TYPE},
+			{Name: "Dimmable", Kind: pAst.IMPORT_KIND_TYPE},
+			{Name: "Sensor", Kind: pAst.IMPORT_KIND_TYPE},
+		},
+		"mqtt": append(
+			normal("subscribe", "publish", "subscribe_to", "publish_to"),
+			BuiltinMember{Name: types.TriggerMqttMessageIdent, Kind: pAst.IMPORT_KIND_TRIGGER},
+			BuiltinMember{Name: types.TriggerMqttBrokerMessageIdent, Kind: pAst.IMPORT_KIND_TRIGGER},
+		),
+		"hms":      normal("exec", "exec_user"),
+		"location": normal("sun_times", "weather"),
+		"device": append(
+			normal(
+				"emit", "set_power", "dim",
+				"list_devices", "list_room_devices", "list_capability_devices", "list_driver_devices",
+				"get_device", "power_state", "power_draw", "dim_levels", "sensor_readings",
+			),
+			BuiltinMember{Name: "DeviceInfo", Kind: pAst.IMPORT_KIND_TYPE},
+			BuiltinMember{Name: "DimLevel", Kind: pAst.IMPORT_KIND_TYPE},
+			BuiltinMember{Name: "SensorReading", Kind: pAst.IMPORT_KIND_TYPE},
+			BuiltinMember{Name: types.TriggerDeviceEvent, Kind: pAst.IMPORT_KIND_TRIGGER},
+			BuiltinMember{Name: types.TriggerDeviceClassEvent, Kind: pAst.IMPORT_KIND_TRIGGER},
+		),
+		"widget":  normal("on_click_js", "on_click_hms"),
+		"testing": normal("assert_eq"),
+		"storage": append(
+			normal("set_storage", "get_storage", "store", "open_store"),
+			BuiltinMember{Name: "Store", Kind: pAst.IMPORT_KIND_TYPE},
+		),
+		"secrets":  normal("get"),
+		"reminder": normal("remind"),
+		"net": append(
+			normal("ping", "http", "wake_on_lan", "tcp_send", "tcp_request", "udp_send"),
+			BuiltinMember{Name: "HttpResponse", Kind: pAst.IMPORT_KIND_TYPE},
+		),
+		"log": normal("logger"),
+		"context": append(
+			normal("args", "notification", "webhook"),
+			BuiltinMember{Name: "Notification", Kind: pAst.IMPORT_KIND_TYPE},
+			BuiltinMember{Name: "WebhookRequest", Kind: pAst.IMPORT_KIND_TYPE},
+		),
+		"scheduler":    normal("create_schedule", "delete_schedule", "list_schedules"),
+		"notification": normal("notify"),
+		"camera": append(
+			normal("list_cameras", "save_snapshot", "notify_snapshot", "frame_difference"),
+			BuiltinMember{Name: "Camera", Kind: pAst.IMPORT_KIND_TYPE},
+		),
+		"time": {
+			{Name: "Time", Kind: pAst.IMPORT_KIND_TYPE},
+		},
+	}
+
+	for module, members := range stdlibModules(errors.Span{}) {
+		names := make([]string, 0, len(members))
+		for name := range members {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		modules[module] = normal(names...)
+	}
+
+	for key := range driver.Templates(errors.Span{}) {
+		modules[key.ModuleName] = append(modules[key.ModuleName], BuiltinMember{
+			Name: key.ValueName,
+			Kind: pAst.IMPORT_KIND_TEMPLATE,
+		})
+	}
+
+	return modules
+}
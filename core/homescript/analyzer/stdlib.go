@@ -0,0 +1,96 @@
+package analyzer
+
+import (
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer"
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	pAst "github.com/smarthome-go/homescript/v3/homescript/parser/ast"
+)
+
+// Returns the types of the members of the standard library modules (`json`, `regex`, `crypto`, `strings`, `math`).
+// These modules are free of side-effects, their implementation lives in `executor/stdlib.go`.
+func stdlibModules(span errors.Span) map[string]map[string]ast.Type {
+	fn := func(result ast.Type, params ...ast.FunctionTypeParam) ast.Type {
+		if params == nil {
+			params = make([]ast.FunctionTypeParam, 0)
+		}
+		return ast.NewFunctionType(ast.NewNormalFunctionTypeParamKind(params), span, result, span)
+	}
+	param := func(name string, typ ast.Type) ast.FunctionTypeParam {
+		return ast.NewFunctionTypeParam(pAst.NewSpannedIdent(name, span), typ, nil)
+	}
+
+	str := ast.NewStringType(span)
+	integer := ast.NewIntType(span)
+	float := ast.NewFloatType(span)
+	boolean := ast.NewBoolType(span)
+	strList := ast.NewListType(str, span)
+
+	return map[string]map[string]ast.Type{
+		"json": {
+			"parse":            fn(ast.NewAnyType(span), param("text", str)),
+			"parse_typed":      fn(ast.NewAnyType(span), param("text", str), param("shape", str)),
+			"stringify":        fn(str, param("value", ast.NewAnyType(span))),
+			"stringify_pretty": fn(str, param("value", ast.NewAnyType(span))),
+		},
+		"regex": {
+			"is_match": fn(boolean, param("pattern", str), param("text", str)),
+			"match":    fn(ast.NewOptionType(strList, span), param("pattern", str), param("text", str)),
+			"find_all": fn(ast.NewListType(strList, span), param("pattern", str), param("text", str)),
+			"replace":  fn(str, param("pattern", str), param("text", str), param("replacement", str)),
+		},
+		"crypto": {
+			"sha256":        fn(str, param("data", str)),
+			"hmac_sha256":   fn(str, param("key", str), param("data", str)),
+			"base64_encode": fn(str, param("data", str)),
+			"base64_decode": fn(str, param("data", str)),
+			"uuid":          fn(str),
+		},
+		"strings": {
+			"split":       fn(strList, param("text", str), param("separator", str)),
+			"join":        fn(str, param("parts", strList), param("separator", str)),
+			"trim":        fn(str, param("text", str)),
+			"to_upper":    fn(str, param("text", str)),
+			"to_lower":    fn(str, param("text", str)),
+			"contains":    fn(boolean, param("text", str), param("search", str)),
+			"starts_with": fn(boolean, param("text", str), param("prefix", str)),
+			"ends_with":   fn(boolean, param("text", str), param("suffix", str)),
+			"index_of":    fn(integer, param("text", str), param("search", str)),
+			"replace":     fn(str, param("text", str), param("old", str), param("new", str)),
+			"repeat":      fn(str, param("text", str), param("count", integer)),
+			"pad_start":   fn(str, param("text", str), param("width", integer), param("fill", str)),
+		},
+		"math": {
+			"pi":         float,
+			"e":          float,
+			"abs":        fn(float, param("x", float)),
+			"floor":      fn(integer, param("x", float)),
+			"ceil":       fn(integer, param("x", float)),
+			"round":      fn(integer, param("x", float)),
+			"sqrt":       fn(float, param("x", float)),
+			"pow":        fn(float, param("base", float), param("exponent", float)),
+			"min":        fn(float, param("a", float), param("b", float)),
+			"max":        fn(float, param("a", float), param("b", float)),
+			"clamp":      fn(float, param("x", float), param("lower", float), param("upper", float)),
+			"random":     fn(float),
+			"random_int": fn(integer, param("lower", integer), param("upper", integer)),
+		},
+	}
+}
+
+func getStdlibImport(moduleName string, valueName string, span errors.Span) (result analyzer.BuiltinImport, moduleFound bool, valueFound bool) {
+	module, found := stdlibModules(span)[moduleName]
+	if !found {
+		return analyzer.BuiltinImport{}, false, false
+	}
+
+	typ, found := module[valueName]
+	if !found {
+		return analyzer.BuiltinImport{}, true, false
+	}
+
+	return analyzer.BuiltinImport{
+		Type:     typ,
+		Template: &ast.TemplateSpec{},
+	}, true, true
+}
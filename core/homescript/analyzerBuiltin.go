@@ -10,6 +10,7 @@ import (
 	"github.com/smarthome-go/homescript/v3/homescript/diagnostic"
 	"github.com/smarthome-go/homescript/v3/homescript/errors"
 	pAst "github.com/smarthome-go/homescript/v3/homescript/parser/ast"
+	"github.com/smarthome-go/smarthome/core/database"
 	"github.com/smarthome-go/smarthome/core/device/driver"
 	a "github.com/smarthome-go/smarthome/core/homescript/analyzer"
 	"github.com/smarthome-go/smarthome/core/homescript/types"
@@ -118,8 +119,12 @@ func (self analyzerHost) ResolveCodeModule(moduleName string) (code string, modu
 
 	if self.context.Username() != nil {
 		script, found, err := HmsManager.GetPersonalScriptById(moduleName, *self.context.Username())
-		if err != nil || !found {
-			return "", found, err
+		if err != nil {
+			return "", false, err
+		}
+		if !found {
+			// Fall back to libraries which are shared with the user.
+			return database.ResolveHomescriptLibraryCode(moduleName, *self.context.Username())
 		}
 		return script.Data.Code, true, nil
 	} else {
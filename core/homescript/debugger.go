@@ -0,0 +1,58 @@
+package homescript
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/smarthome-go/homescript/v3/homescript"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// Reports whether the Homescript runtime of this build emits the debug output which debug sessions rely on.
+// Otherwise, `RunGeneric` rejects every invocation which carries a debug session.
+func DebuggingSupported() bool {
+	return runtime.VM_DEBUGGER
+}
+
+// Runs a user script in debug mode, the execution is controlled by the given debug session.
+// Annotations are not processed as the program is only run for debugging purposes.
+func (m *Manager) DebugUserScript(
+	programID, username string,
+	session *types.DebugSession,
+	cancelation types.Cancelation,
+	outputWriter io.Writer,
+	idChan *chan uint64,
+	stdin *types.StdinBuffer,
+	args map[string]string,
+) (types.HmsRes, error) {
+	// The VM is not started on every path, consumers of the session must not wait for `Paused` in this case.
+	defer session.Finish()
+
+	script, found, err := m.GetPersonalScriptById(programID, username)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+	if !found {
+		return types.HmsRes{}, fmt.Errorf("Homescript with ID `%s` owned by user `%s` was not found", programID, username)
+	}
+
+	return m.RunGeneric(
+		types.ProgramInvocation{
+			Identifier: homescript.InputProgram{
+				ProgramText: script.Data.Code,
+				Filename:    script.Data.Id,
+			},
+			FunctionInvocation: nil,
+			LoadedSingletons:   map[string]value.Value{},
+			Debugger:           session,
+		},
+		types.NewExecutionContextUser(script.Data.Id, username, args),
+		cancelation,
+		idChan,
+		outputWriter,
+		false,
+		stdin,
+	)
+}
@@ -0,0 +1,532 @@
+package homescript
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/smarthome-go/homescript/v3/homescript"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/analyzer"
+	"github.com/smarthome-go/smarthome/core/homescript/lsp"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+type DependentKind string
+
+const (
+	DependentKindHomescript DependentKind = "homescript"
+	DependentKindAutomation DependentKind = "automation"
+	DependentKindSchedule   DependentKind = "schedule"
+	DependentKindWebhook    DependentKind = "webhook"
+	DependentKindLibrary    DependentKind = "library"
+	DependentKindDevice     DependentKind = "device"
+)
+
+// Something which stops working (or is deleted as well) if the resource it depends on is deleted.
+type Dependent struct {
+	Kind  DependentKind `json:"kind"`
+	Id    string        `json:"id"`
+	Owner string        `json:"owner"`
+	Name  string        `json:"name"`
+	// Describes how the dependent uses the resource.
+	Reason string `json:"reason"`
+}
+
+// The resources referenced by a single Homescript.
+type HomescriptDependencies struct {
+	HomescriptId string `json:"homescriptId"`
+	Owner        string `json:"owner"`
+	lsp.References
+}
+
+// A static snapshot of which Homescripts, automations and schedules reference which resources.
+// The index is built by analyzing the stored code, nothing is executed.
+type DependencyIndex struct {
+	Homescripts []HomescriptDependencies `json:"homescripts"`
+
+	names       map[string]string
+	schedules   []database.Schedule
+	scheduleRef map[uint]lsp.References
+	automations []database.Automation
+	webhooks    []database.HomescriptWebhook
+	libraries   []database.HomescriptLibrary
+}
+
+// Builds a new dependency index from the current state of the database.
+// Every Homescript and schedule is analyzed, use `GetDependencyIndex` in order to benefit from the cache.
+func BuildDependencyIndex() (DependencyIndex, error) {
+	index, _, err := buildDependencyIndex(make(map[string]cachedReferences))
+	return index, err
+}
+
+// The references of a program, only valid as long as its code is unchanged.
+type cachedReferences struct {
+	code       string
+	references lsp.References
+}
+
+// The cached dependency index, it is rebuilt once the dependency revision of the database has changed.
+// Programs whose code has not changed since the previous build are not analyzed again.
+var dependencyIndexCache = struct {
+	lock     sync.Mutex
+	valid    bool
+	revision uint64
+	index    DependencyIndex
+	// Maps the key of a program (see `scriptKey`) to its references.
+	references map[string]cachedReferences
+}{
+	references: make(map[string]cachedReferences),
+}
+
+// Returns the dependency index of the current state of the database.
+// The index is cached and only updated if Homescripts, schedules or other dependencies were modified since it was built.
+// The returned index must not be modified.
+func GetDependencyIndex() (DependencyIndex, error) {
+	dependencyIndexCache.lock.Lock()
+	defer dependencyIndexCache.lock.Unlock()
+
+	revision := database.DependencyRevision()
+	if dependencyIndexCache.valid && dependencyIndexCache.revision == revision {
+		return dependencyIndexCache.index, nil
+	}
+
+	index, references, err := buildDependencyIndex(dependencyIndexCache.references)
+	if err != nil {
+		return DependencyIndex{}, err
+	}
+
+	dependencyIndexCache.valid = true
+	dependencyIndexCache.revision = revision
+	dependencyIndexCache.index = index
+	dependencyIndexCache.references = references
+
+	return index, nil
+}
+
+// Builds a dependency index, references of unchanged programs are taken from `previous`.
+// Returns the references of every indexed program so that they can be reused by the next build.
+func buildDependencyIndex(previous map[string]cachedReferences) (DependencyIndex, map[string]cachedReferences, error) {
+	index := DependencyIndex{
+		Homescripts: make([]HomescriptDependencies, 0),
+		names:       make(map[string]string),
+		scheduleRef: make(map[uint]lsp.References),
+		webhooks:    make([]database.HomescriptWebhook, 0),
+	}
+	references := make(map[string]cachedReferences)
+
+	// Only analyzes a program if its code has changed.
+	scan := func(owner string, filename string, code string) (lsp.References, error) {
+		key := scriptKey(owner, filename)
+		if cached, found := previous[key]; found && cached.code == code {
+			references[key] = cached
+			return cached.references, nil
+		}
+
+		scanned, err := scanReferences(owner, filename, code)
+		if err != nil {
+			return lsp.References{}, err
+		}
+		references[key] = cachedReferences{code: code, references: scanned}
+		return scanned, nil
+	}
+
+	homescripts, err := database.ListAllHomescripts()
+	if err != nil {
+		return DependencyIndex{}, nil, err
+	}
+
+	owners := make(map[string]bool)
+	for _, script := range homescripts {
+		if script.Data.Type == database.HOMESCRIPT_TYPE_DRIVER {
+			continue
+		}
+		owners[script.Owner] = true
+		index.names[scriptKey(script.Owner, script.Data.Id)] = script.Data.Name
+
+		scriptReferences, err := scan(script.Owner, script.Data.Id, script.Data.Code)
+		if err != nil {
+			return DependencyIndex{}, nil, err
+		}
+		index.Homescripts = append(index.Homescripts, HomescriptDependencies{
+			HomescriptId: script.Data.Id,
+			Owner:        script.Owner,
+			References:   scriptReferences,
+		})
+	}
+
+	if index.schedules, err = database.GetSchedules(); err != nil {
+		return DependencyIndex{}, nil, err
+	}
+	for _, schedule := range index.schedules {
+		if schedule.Data.TargetMode != database.ScheduleTargetModeCode {
+			continue
+		}
+		scheduleReferences, err := scan(schedule.Owner, types.ScheduleFilename(schedule.Id), schedule.Data.HomescriptCode)
+		if err != nil {
+			return DependencyIndex{}, nil, err
+		}
+		index.scheduleRef[schedule.Id] = scheduleReferences
+	}
+
+	if index.automations, err = database.GetAutomations(); err != nil {
+		return DependencyIndex{}, nil, err
+	}
+
+	for owner := range owners {
+		webhooks, err := database.ListHomescriptWebhooksOfUser(owner)
+		if err != nil {
+			return DependencyIndex{}, nil, err
+		}
+		index.webhooks = append(index.webhooks, webhooks...)
+	}
+
+	if index.libraries, err = database.ListHomescriptLibraries(); err != nil {
+		return DependencyIndex{}, nil, err
+	}
+
+	return index, references, nil
+}
+
+// Analyzes code in the context of its owner and returns the resources it references.
+// The analyzer resolves imported modules, an error is only returned if they could not be loaded.
+func scanReferences(owner string, filename string, code string) (lsp.References, error) {
+	modules, _, err := HmsManager.Analyze(
+		homescript.InputProgram{
+			ProgramText: code,
+			Filename:    filename,
+		},
+		types.NewExecutionContextUser(filename, owner, make(map[string]string)),
+	)
+	if err != nil {
+		return lsp.References{}, err
+	}
+
+	return lsp.ScanReferences(modules, filename), nil
+}
+
+func scriptKey(owner string, id string) string {
+	return owner + "/" + id
+}
+
+// Returns the dependencies of all Homescripts owned by the given user.
+func (i DependencyIndex) HomescriptsOfUser(username string) []HomescriptDependencies {
+	result := make([]HomescriptDependencies, 0)
+	for _, script := range i.Homescripts {
+		if script.Owner == username {
+			result = append(result, script)
+		}
+	}
+	return result
+}
+
+// Resolves which Homescript or library an import of a user refers to.
+// Returns an empty string for builtin modules.
+func (i DependencyIndex) resolveImport(username string, module string) (homescriptOwner string, homescriptId string) {
+	if _, isBuiltin := analyzer.BuiltinModules()[module]; isBuiltin {
+		return "", ""
+	}
+
+	// Personal scripts take precedence over libraries of the same name.
+	if _, found := i.names[scriptKey(username, module)]; found {
+		return username, module
+	}
+
+	for _, library := range i.libraries {
+		if library.Name == module {
+			return library.Owner, library.HomescriptId
+		}
+	}
+
+	return "", ""
+}
+
+// Returns everything that depends on the given Homescript.
+func (i DependencyIndex) DependentsOfHomescript(owner string, homescriptId string) []Dependent {
+	dependents := make([]Dependent, 0)
+
+	for _, script := range i.Homescripts {
+		if script.Owner == owner && script.HomescriptId == homescriptId {
+			continue
+		}
+		for _, module := range script.Imports {
+			importOwner, importId := i.resolveImport(script.Owner, module)
+			if importOwner != owner || importId != homescriptId {
+				continue
+			}
+			dependents = append(dependents, Dependent{
+				Kind:   DependentKindHomescript,
+				Id:     script.HomescriptId,
+				Owner:  script.Owner,
+				Name:   i.names[scriptKey(script.Owner, script.HomescriptId)],
+				Reason: fmt.Sprintf("imports module `%s`", module),
+			})
+			break
+		}
+	}
+
+	for _, automation := range i.automations {
+		if automation.Owner == owner && automation.Data.HomescriptId == homescriptId {
+			dependents = append(dependents, Dependent{
+				Kind:   DependentKindAutomation,
+				Id:     fmt.Sprint(automation.Id),
+				Owner:  automation.Owner,
+				Name:   automation.Data.Name,
+				Reason: "runs the Homescript",
+			})
+		}
+	}
+
+	for _, schedule := range i.schedules {
+		if schedule.Owner != owner {
+			continue
+		}
+		if schedule.Data.TargetMode == database.ScheduleTargetModeHMS && schedule.Data.HomescriptTargetId == homescriptId {
+			dependents = append(dependents, Dependent{
+				Kind:   DependentKindSchedule,
+				Id:     fmt.Sprint(schedule.Id),
+				Owner:  schedule.Owner,
+				Name:   schedule.Data.Name,
+				Reason: "runs the Homescript",
+			})
+			continue
+		}
+		for _, module := range i.scheduleRef[schedule.Id].Imports {
+			if importOwner, importId := i.resolveImport(schedule.Owner, module); importOwner == owner && importId == homescriptId {
+				dependents = append(dependents, Dependent{
+					Kind:   DependentKindSchedule,
+					Id:     fmt.Sprint(schedule.Id),
+					Owner:  schedule.Owner,
+					Name:   schedule.Data.Name,
+					Reason: fmt.Sprintf("imports module `%s`", module),
+				})
+				break
+			}
+		}
+	}
+
+	for _, webhook := range i.webhooks {
+		if webhook.Owner == owner && webhook.HomescriptId == homescriptId {
+			dependents = append(dependents, Dependent{
+				Kind:   DependentKindWebhook,
+				Id:     webhook.Id,
+				Owner:  webhook.Owner,
+				Name:   webhook.Name,
+				Reason: "runs the Homescript",
+			})
+		}
+	}
+
+	for _, library := range i.libraries {
+		if library.Owner == owner && library.HomescriptId == homescriptId {
+			dependents = append(dependents, Dependent{
+				Kind:   DependentKindLibrary,
+				Id:     library.Name,
+				Owner:  library.Owner,
+				Name:   library.Name,
+				Reason: "is published from the Homescript",
+			})
+		}
+	}
+
+	return dependents
+}
+
+// Returns every Homescript and schedule which controls the given device.
+func (i DependencyIndex) DependentsOfDevice(deviceId string) []Dependent {
+	dependents := make([]Dependent, 0)
+
+	for _, script := range i.Homescripts {
+		for _, device := range script.Devices {
+			if device == deviceId {
+				dependents = append(dependents, Dependent{
+					Kind:   DependentKindHomescript,
+					Id:     script.HomescriptId,
+					Owner:  script.Owner,
+					Name:   i.names[scriptKey(script.Owner, script.HomescriptId)],
+					Reason: fmt.Sprintf("controls device `%s`", deviceId),
+				})
+				break
+			}
+		}
+	}
+
+	for _, schedule := range i.schedules {
+		reference := false
+
+		switch schedule.Data.TargetMode {
+		case database.ScheduleTargetModeDevices:
+			for _, job := range schedule.Data.SwitchJobs {
+				if job.DeviceId == deviceId {
+					reference = true
+					break
+				}
+			}
+		case database.ScheduleTargetModeCode:
+			for _, device := range i.scheduleRef[schedule.Id].Devices {
+				if device == deviceId {
+					reference = true
+					break
+				}
+			}
+		}
+
+		if reference {
+			dependents = append(dependents, Dependent{
+				Kind:   DependentKindSchedule,
+				Id:     fmt.Sprint(schedule.Id),
+				Owner:  schedule.Owner,
+				Name:   schedule.Data.Name,
+				Reason: fmt.Sprintf("controls device `%s`", deviceId),
+			})
+		}
+	}
+
+	return dependents
+}
+
+// Returns every Homescript and schedule of the user which reads or writes the given storage key.
+// Storage is personal, hence only the user's own scripts are considered.
+func (i DependencyIndex) DependentsOfStorageKey(username string, key string) []Dependent {
+	dependents := make([]Dependent, 0)
+
+	for _, script := range i.Homescripts {
+		if script.Owner != username {
+			continue
+		}
+		for _, storageKey := range script.StorageKeys {
+			if storageKey == key {
+				dependents = append(dependents, Dependent{
+					Kind:   DependentKindHomescript,
+					Id:     script.HomescriptId,
+					Owner:  script.Owner,
+					Name:   i.names[scriptKey(script.Owner, script.HomescriptId)],
+					Reason: fmt.Sprintf("uses storage key `%s`", key),
+				})
+				break
+			}
+		}
+	}
+
+	for _, schedule := range i.schedules {
+		if schedule.Owner != username {
+			continue
+		}
+		for _, storageKey := range i.scheduleRef[schedule.Id].StorageKeys {
+			if storageKey == key {
+				dependents = append(dependents, Dependent{
+					Kind:   DependentKindSchedule,
+					Id:     fmt.Sprint(schedule.Id),
+					Owner:  schedule.Owner,
+					Name:   schedule.Data.Name,
+					Reason: fmt.Sprintf("uses storage key `%s`", key),
+				})
+				break
+			}
+		}
+	}
+
+	return dependents
+}
+
+// Returns the storage namespace a key of the typed storage belongs to.
+// The store of a script (`storage.store`) is named after the script, shared stores are prefixed with their owner.
+func storeNamespace(owner string, filename string, key lsp.StoreKey) string {
+	if key.Store == "" {
+		return filename
+	}
+	return database.HomescriptStoreNamespace(owner, key.Store)
+}
+
+// Returns every Homescript and schedule of the user which uses the given key of the typed storage.
+func (i DependencyIndex) DependentsOfStoreKey(username string, namespace string, key string) []Dependent {
+	dependents := make([]Dependent, 0)
+
+	for _, script := range i.Homescripts {
+		if script.Owner != username {
+			continue
+		}
+		for _, storeKey := range script.StoreKeys {
+			if storeKey.Key == key && storeNamespace(username, script.HomescriptId, storeKey) == namespace {
+				dependents = append(dependents, Dependent{
+					Kind:   DependentKindHomescript,
+					Id:     script.HomescriptId,
+					Owner:  script.Owner,
+					Name:   i.names[scriptKey(script.Owner, script.HomescriptId)],
+					Reason: fmt.Sprintf("uses key `%s` of store `%s`", key, namespace),
+				})
+				break
+			}
+		}
+	}
+
+	for _, schedule := range i.schedules {
+		if schedule.Owner != username {
+			continue
+		}
+		for _, storeKey := range i.scheduleRef[schedule.Id].StoreKeys {
+			if storeKey.Key == key && storeNamespace(username, types.ScheduleFilename(schedule.Id), storeKey) == namespace {
+				dependents = append(dependents, Dependent{
+					Kind:   DependentKindSchedule,
+					Id:     fmt.Sprint(schedule.Id),
+					Owner:  schedule.Owner,
+					Name:   schedule.Data.Name,
+					Reason: fmt.Sprintf("uses key `%s` of store `%s`", key, namespace),
+				})
+				break
+			}
+		}
+	}
+
+	return dependents
+}
+
+// Returns the devices of a room and everything which depends on them.
+// Deleting a room also deletes all of its devices.
+func (i DependencyIndex) DependentsOfRoom(roomId string) ([]Dependent, error) {
+	devices, err := database.ListAllDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := make([]Dependent, 0)
+	for _, device := range devices {
+		if device.RoomID != roomId {
+			continue
+		}
+		dependents = append(dependents, Dependent{
+			Kind:   DependentKindDevice,
+			Id:     device.ID,
+			Owner:  "",
+			Name:   device.Name,
+			Reason: fmt.Sprintf("is located in room `%s`", roomId),
+		})
+		dependents = append(dependents, i.DependentsOfDevice(device.ID)...)
+	}
+
+	return dependents, nil
+}
+
+// Returns the devices controlled by a driver and everything which depends on them.
+func (i DependencyIndex) DependentsOfDriver(vendorId string, modelId string) ([]Dependent, error) {
+	devices, err := database.ListAllDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := make([]Dependent, 0)
+	for _, device := range devices {
+		if device.VendorID != vendorId || device.ModelID != modelId {
+			continue
+		}
+		dependents = append(dependents, Dependent{
+			Kind:   DependentKindDevice,
+			Id:     device.ID,
+			Owner:  "",
+			Name:   device.Name,
+			Reason: fmt.Sprintf("is controlled by driver `%s:%s`", vendorId, modelId),
+		})
+		dependents = append(dependents, i.DependentsOfDevice(device.ID)...)
+	}
+
+	return dependents, nil
+}
@@ -0,0 +1,106 @@
+package homescript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smarthome-go/smarthome/core/database"
+)
+
+func TestDependencyIndex(t *testing.T) {
+	scripts := []database.HomescriptData{
+		{
+			Id:   "dep_helpers",
+			Name: "Helpers",
+			Code: "pub fn helper() {}",
+		},
+		{
+			Id:   "dep_lights",
+			Name: "Lights",
+			Code: `import { set_power } from device;
+import { set_storage, store, open_store } from storage;
+import { helper } from dep_helpers;
+
+fn main() {
+    set_power("dep_lamp", true);
+    set_storage("dep_counter", 1);
+    store.increment("dep_runs", 1);
+    open_store("dep_shared").set("dep_runs", 1);
+    helper();
+}`,
+		},
+	}
+	for _, script := range scripts {
+		assert.NoError(t, database.CreateNewHomescript(database.Homescript{Owner: "admin", Data: script}))
+	}
+
+	index, err := BuildDependencyIndex()
+	assert.NoError(t, err)
+
+	dependents := index.DependentsOfHomescript("admin", "dep_helpers")
+	assert.Len(t, dependents, 1)
+	assert.Equal(t, DependentKindHomescript, dependents[0].Kind)
+	assert.Equal(t, "dep_lights", dependents[0].Id)
+
+	// Other users cannot import the personal scripts of the admin user
+	assert.Empty(t, index.DependentsOfHomescript("other_user", "dep_helpers"))
+
+	dependents = index.DependentsOfDevice("dep_lamp")
+	assert.Len(t, dependents, 1)
+	assert.Equal(t, "dep_lights", dependents[0].Id)
+
+	assert.Len(t, index.DependentsOfStorageKey("admin", "dep_counter"), 1)
+	assert.Empty(t, index.DependentsOfStorageKey("other_user", "dep_counter"))
+
+	// Keys of the typed storage are scoped to their store
+	assert.Len(t, index.DependentsOfStoreKey("admin", "dep_lights", "dep_runs"), 1)
+	assert.Len(t, index.DependentsOfStoreKey("admin", "admin:dep_shared", "dep_runs"), 1)
+	assert.Empty(t, index.DependentsOfStoreKey("admin", "dep_helpers", "dep_runs"))
+
+	for _, script := range scripts {
+		assert.NoError(t, database.DeleteHomescriptById(script.Id, "admin"))
+	}
+}
+
+func TestGetDependencyIndex(t *testing.T) {
+	script := database.HomescriptData{
+		Id:   "dep_cached",
+		Name: "Cached",
+		Code: `import { set_power } from device;
+
+fn main() {
+    set_power("dep_cached_lamp", true);
+}`,
+	}
+	assert.NoError(t, database.CreateNewHomescript(database.Homescript{Owner: "admin", Data: script}))
+
+	index, err := GetDependencyIndex()
+	assert.NoError(t, err)
+	assert.Len(t, index.DependentsOfDevice("dep_cached_lamp"), 1)
+
+	// Without modifications, the cached index is returned
+	cached, err := GetDependencyIndex()
+	assert.NoError(t, err)
+	assert.Equal(t, index.Homescripts, cached.Homescripts)
+
+	// Saving the script updates the index
+	script.Code = `import { set_power } from device;
+
+fn main() {
+    set_power("dep_cached_fan", true);
+}`
+	assert.NoError(t, database.ModifyHomescriptById(script.Id, "admin", script))
+
+	index, err = GetDependencyIndex()
+	assert.NoError(t, err)
+	assert.Empty(t, index.DependentsOfDevice("dep_cached_lamp"))
+	assert.Len(t, index.DependentsOfDevice("dep_cached_fan"), 1)
+
+	// Deleting the script removes it from the index
+	assert.NoError(t, database.DeleteHomescriptById(script.Id, "admin"))
+
+	index, err = GetDependencyIndex()
+	assert.NoError(t, err)
+	assert.Empty(t, index.DependentsOfDevice("dep_cached_fan"))
+}
@@ -189,6 +189,33 @@ func (i *InstanceT) RegisterUserScript(programID string, username string) error
 				return err
 			}
 
+			logger.Infof("Register user program: %d", id)
+		case types.TriggerCronIdent, types.TriggerSunriseIdent, types.TriggerSunsetIdent, types.TriggerAtIdent:
+			timeTrigger, err := TimeTriggerFromArgs(trigger.Trigger, trigger.Args)
+			if err != nil {
+				return err
+			}
+
+			id, err := i.registerInternal(
+				dispatcherTypes.RegisterInfo{
+					ProgramID: programID,
+					Function: &dispatcherTypes.CalledFunction{
+						Ident:          trigger.CalledFnIdentMangled,
+						IdentIsLiteral: true,
+						CallMode: dispatcherTypes.CallModeAdaptive{
+							AllocatingFallback: dispatcherTypes.CallModeAllocating{
+								Context: context,
+							},
+						},
+					},
+					Trigger: timeTrigger,
+				},
+			)
+
+			if err != nil {
+				return err
+			}
+
 			logger.Infof("Register user program: %d", id)
 		case types.TriggerDeviceClassEvent:
 			panic("HI")
@@ -303,10 +330,18 @@ func (i *InstanceT) RegisterDevice(driver database.DeviceDriver, deviceID string
 
 	for _, trigger := range triggers {
 		switch trigger.Trigger {
-		case types.TriggerMqttMessageIdent:
+		case types.TriggerMqttMessageIdent, types.TriggerMqttBrokerMessageIdent:
 			containsEmpty := false
 
-			argList := trigger.Args[0].(value.ValueList).Values
+			// In contrast to `message`, `message_from` takes the broker as its first argument.
+			broker := dispatcherTypes.DefaultMqttBroker
+			topicsArg := trigger.Args[0]
+			if trigger.Trigger == types.TriggerMqttBrokerMessageIdent {
+				broker = trigger.Args[0].(value.ValueString).Inner
+				topicsArg = trigger.Args[1]
+			}
+
+			argList := topicsArg.(value.ValueList).Values
 			topics := make([]string, len(*argList))
 
 			for idx, arg := range *argList {
@@ -338,10 +373,39 @@ func (i *InstanceT) RegisterDevice(driver database.DeviceDriver, deviceID string
 						},
 					},
 				},
+				broker,
 				topics,
 			)
 			i.DoneRegistrations.Lock.Lock()
 
+			if err != nil {
+				return err
+			}
+		case types.TriggerCronIdent, types.TriggerSunriseIdent, types.TriggerSunsetIdent, types.TriggerAtIdent:
+			timeTrigger, err := TimeTriggerFromArgs(trigger.Trigger, trigger.Args)
+			if err != nil {
+				return err
+			}
+
+			// NOTE: the adaptive call mode cannot be used here:
+			// it would replace the equal registrations of other devices using the same driver.
+			i.DoneRegistrations.Lock.Unlock()
+			_, err = i.Register(
+				dispatcherTypes.RegisterInfo{
+					ProgramID: filename,
+					Function: &dispatcherTypes.CalledFunction{
+						Ident:          trigger.CalledFnIdentMangled,
+						IdentIsLiteral: true,
+						CallMode: dispatcherTypes.CallModeAllocating{
+							Context: context,
+						},
+					},
+					Trigger: timeTrigger,
+				},
+				dispatcherTypes.ToleranceRetry,
+			)
+			i.DoneRegistrations.Lock.Lock()
+
 			if err != nil {
 				return err
 			}
@@ -357,6 +421,7 @@ func (i *InstanceT) RegisterDevice(driver database.DeviceDriver, deviceID string
 func (i *InstanceT) RegisterMqttTriggerAnnotation(
 	programID string,
 	callback dispatcherTypes.CalledFunction,
+	broker string,
 	mqttTopics []string,
 ) error {
 	_, err := i.Register(
@@ -364,6 +429,7 @@ func (i *InstanceT) RegisterMqttTriggerAnnotation(
 			ProgramID: programID,
 			Function:  &callback,
 			Trigger: dispatcherTypes.CallBackTriggerMqtt{
+				Broker: broker,
 				Topics: mqttTopics,
 			},
 		},
@@ -0,0 +1,171 @@
+package dispatcher
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	dispatcherTypes "github.com/smarthome-go/smarthome/core/homescript/dispatcher/types"
+)
+
+type MqttBrokerStatus struct {
+	Name string
+	// Is `nil` if the broker is reachable.
+	Err error
+}
+
+// Returns the manager of a broker, an empty name or `default` refer to the default broker.
+func (i *InstanceT) MqttBroker(name string) (*MqttManager, error) {
+	name = dispatcherTypes.MqttBrokerName(name)
+	if name == dispatcherTypes.DefaultMqttBroker {
+		return i.Mqtt, nil
+	}
+
+	i.MqttBrokersLock.RLock()
+	defer i.MqttBrokersLock.RUnlock()
+
+	manager, found := i.MqttBrokers[name]
+	if !found {
+		return nil, fmt.Errorf("MQTT broker `%s` is not configured", name)
+	}
+
+	return manager, nil
+}
+
+// Connects to, reconfigures or disconnects from the named brokers so that they match the config.
+// New brokers are connected in the background, failures are reported via `MqttBrokersStatus`.
+func (i *InstanceT) ApplyMqttBrokers(config database.MqttConfig) error {
+	wanted := make(map[string]database.MqttBrokerConnection)
+	for _, connection := range config.Connections {
+		// Disabling MQTT also disables all named brokers.
+		connection.Enabled = config.Enabled && connection.Enabled
+		wanted[connection.Name] = connection
+	}
+
+	changed := make([]*MqttManager, 0)
+	removed := make([]string, 0)
+
+	i.MqttBrokersLock.Lock()
+
+	for name, manager := range i.MqttBrokers {
+		if _, keep := wanted[name]; keep {
+			continue
+		}
+
+		manager.stop()
+		delete(i.MqttBrokers, name)
+		removed = append(removed, name)
+		logger.Infof("Removed MQTT broker `%s`, its registrations are pending until the broker is added again", name)
+	}
+
+	for name, connection := range wanted {
+		manager, exists := i.MqttBrokers[name]
+		if !exists {
+			i.MqttBrokers[name] = newMqttManager(connection, i.Mqtt.TriggerTryPendingRegistrations)
+			continue
+		}
+
+		if manager.config() == connection {
+			continue
+		}
+
+		manager.setConfig(connection)
+		changed = append(changed, manager)
+	}
+
+	i.MqttBrokersLock.Unlock()
+
+	for _, name := range removed {
+		i.suspendMqttRegistrations(name)
+	}
+
+	// Reconnecting might take a while, lookups of other brokers should not be blocked meanwhile.
+	var reloadErr error
+	for _, manager := range changed {
+		if err := manager.Reload(); err != nil && reloadErr == nil {
+			reloadErr = fmt.Errorf("Could not reload MQTT broker `%s`: %s", manager.Name, err.Error())
+		}
+	}
+
+	return reloadErr
+}
+
+// Moves all registrations of a removed broker back into the pending queue.
+// Once a broker with this name connects again, they are registered using the retry hook.
+func (i *InstanceT) suspendMqttRegistrations(broker string) {
+	i.DoneRegistrations.Lock.Lock()
+	defer i.DoneRegistrations.Lock.Unlock()
+
+	ids := make(map[dispatcherTypes.RegistrationID]struct{})
+	for key, keyIDs := range i.DoneRegistrations.MqttRegistrations {
+		if key.Broker != broker {
+			continue
+		}
+
+		for _, id := range keyIDs {
+			ids[id] = struct{}{}
+		}
+		delete(i.DoneRegistrations.MqttRegistrations, key)
+	}
+
+	for id := range ids {
+		info, found := i.DoneRegistrations.Set[id]
+		if !found {
+			continue
+		}
+
+		delete(i.DoneRegistrations.Set, id)
+		i.PendingRegistrations.Enqueue(info)
+	}
+
+	if len(ids) > 0 {
+		logger.Debugf("Suspended %d registration(s) of removed MQTT broker `%s`", len(ids), broker)
+	}
+}
+
+// Returns the status of all named brokers ordered by their name.
+func (i *InstanceT) MqttBrokersStatus() []MqttBrokerStatus {
+	i.MqttBrokersLock.RLock()
+	managers := make([]*MqttManager, 0, len(i.MqttBrokers))
+	for _, manager := range i.MqttBrokers {
+		managers = append(managers, manager)
+	}
+	i.MqttBrokersLock.RUnlock()
+
+	sort.Slice(managers, func(a, b int) bool {
+		return managers[a].Name < managers[b].Name
+	})
+
+	// Unreachable brokers run into timeouts, therefore, they are checked concurrently.
+	status := make([]MqttBrokerStatus, len(managers))
+	var wg sync.WaitGroup
+	for idx, manager := range managers {
+		wg.Add(1)
+		go func(idx int, manager *MqttManager) {
+			defer wg.Done()
+
+			status[idx] = MqttBrokerStatus{Name: manager.Name}
+			if !manager.config().Enabled {
+				status[idx].Err = errors.New("Connection is disabled")
+				return
+			}
+			status[idx].Err = manager.Status()
+		}(idx, manager)
+	}
+	wg.Wait()
+
+	return status
+}
+
+// Disconnects from all named brokers, is called during shutdown.
+func (i *InstanceT) ShutdownMqttBrokers() {
+	i.MqttBrokersLock.Lock()
+	defer i.MqttBrokersLock.Unlock()
+
+	for name, manager := range i.MqttBrokers {
+		manager.stop()
+		delete(i.MqttBrokers, name)
+	}
+}
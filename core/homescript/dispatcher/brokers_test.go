@@ -0,0 +1,91 @@
+package dispatcher_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
+	dispatcherTypes "github.com/smarthome-go/smarthome/core/homescript/dispatcher/types"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func brokerConfig(connections ...database.MqttBrokerConnection) database.MqttConfig {
+	return database.MqttConfig{
+		Enabled:     true,
+		Host:        testBrokerHost,
+		Port:        testBrokerPort,
+		Connections: connections,
+	}
+}
+
+func isRegistered(id dispatcherTypes.RegistrationID, key dispatcherTypes.MqttRegistrationKey) bool {
+	registrations := &dispatcher.Instance.DoneRegistrations
+
+	registrations.Lock.RLock()
+	defer registrations.Lock.RUnlock()
+
+	for _, registered := range registrations.MqttRegistrations[key] {
+		if registered == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRemovedBrokerRegistrations(t *testing.T) {
+	garden := database.MqttBrokerConnection{
+		Name:    "garden",
+		Enabled: true,
+		Host:    testBrokerHost,
+		Port:    testBrokerPort,
+	}
+
+	assert.NoError(t, dispatcher.Instance.ApplyMqttBrokers(brokerConfig(garden)))
+	t.Cleanup(func() { dispatcher.Instance.ShutdownMqttBrokers() })
+
+	assert.Eventually(t, func() bool {
+		manager, err := dispatcher.Instance.MqttBroker("garden")
+		return err == nil && manager.Status() == nil
+	}, messageTimeout, 50*time.Millisecond)
+
+	programID := "broker_registrations"
+	key := dispatcherTypes.MqttRegistrationKey{Broker: "garden", Topic: "garden/soil"}
+
+	id, err := dispatcher.Instance.Register(dispatcherTypes.RegisterInfo{
+		ProgramID: programID,
+		Function: &dispatcherTypes.CalledFunction{
+			Ident:          "on_soil",
+			IdentIsLiteral: false,
+			CallMode: dispatcherTypes.CallModeAllocating{
+				Context: types.NewExecutionContextUser(programID, "admin", make(map[string]string)),
+			},
+		},
+		Trigger: dispatcherTypes.CallBackTriggerMqtt{Broker: "garden", Topics: []string{"garden/soil"}},
+	}, dispatcherTypes.NoTolerance)
+	assert.NoError(t, err)
+	assert.True(t, isRegistered(id, key))
+
+	// Removing the broker moves its registrations back into the pending queue.
+	assert.NoError(t, dispatcher.Instance.ApplyMqttBrokers(brokerConfig()))
+	assert.False(t, isRegistered(id, key))
+	assert.False(t, dispatcher.Instance.PendingRegistrations.IsEmpty())
+
+	// While the broker is missing, retries fail without losing the registration.
+	assert.Error(t, dispatcher.Instance.RegisterPending())
+	assert.False(t, dispatcher.Instance.PendingRegistrations.IsEmpty())
+
+	// Once the broker is added again, the registration is subscribed again.
+	assert.NoError(t, dispatcher.Instance.ApplyMqttBrokers(brokerConfig(garden)))
+	assert.Eventually(t, func() bool {
+		return dispatcher.Instance.RegisterPending() == nil
+	}, messageTimeout, 50*time.Millisecond)
+	assert.True(t, dispatcher.Instance.PendingRegistrations.IsEmpty())
+
+	dispatcher.Instance.DoneRegistrations.Lock.RLock()
+	assert.Len(t, dispatcher.Instance.DoneRegistrations.MqttRegistrations[key], 1)
+	dispatcher.Instance.DoneRegistrations.Lock.RUnlock()
+
+	assert.NoError(t, dispatcher.Instance.UnregisterUserProgram(programID))
+}
@@ -0,0 +1,279 @@
+package dispatcher_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript"
+	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
+	"github.com/smarthome-go/smarthome/core/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// These tests require the database and the MQTT broker of `docker-compose-dev.yml`.
+const (
+	testBrokerHost = "localhost"
+	testBrokerPort = 1883
+)
+
+// How long the drivers may take to process an emulated message.
+const messageTimeout = 5 * time.Second
+
+func TestMain(m *testing.M) {
+	log := logrus.New()
+	log.Level = logrus.FatalLevel
+
+	database.InitLogger(log)
+	homescript.InitLogger(log)
+	dispatcher.InitLogger(log)
+	driver.InitLogger(log)
+
+	if err := database.Init(database.DatabaseConfig{
+		Username: "smarthome",
+		Password: "testing",
+		Hostname: "localhost",
+		Database: "smarthome",
+		Port:     3330,
+	}, "admin"); err != nil {
+		panic(err.Error())
+	}
+
+	hmsManager := homescript.InitManager()
+
+	mqttManager, err := dispatcher.NewMqttManager(database.MqttConfig{
+		Enabled:  true,
+		Host:     testBrokerHost,
+		Port:     testBrokerPort,
+		Username: "",
+		Password: "",
+	}, func() error { return nil })
+	if err != nil {
+		panic(err.Error())
+	}
+
+	disp, err := dispatcher.InitInstance(hmsManager, mqttManager)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	driver.InitManager(hmsManager, disp.DriverReloadCallBackFn, disp.DeviceReloadCallBackFn)
+	if err := driver.Manager.PopulateValueCache(); err != nil {
+		panic(err.Error())
+	}
+
+	os.Exit(m.Run())
+}
+
+// Emulates a physical device which is connected to the broker.
+func connectEmulatedDevice(t *testing.T) mqtt.Client {
+	options := mqtt.NewClientOptions().
+		AddBroker(fmt.Sprintf("tcp://%s:%d", testBrokerHost, testBrokerPort)).
+		SetClientID(fmt.Sprintf("emulated_device_%d", time.Now().UnixNano()))
+
+	client := mqtt.NewClient(options)
+	token := client.Connect()
+	token.Wait()
+	assert.NoError(t, token.Error())
+
+	t.Cleanup(func() { client.Disconnect(250) })
+
+	return client
+}
+
+// Collects the messages which the driver publishes on a topic.
+func expectCommands(t *testing.T, client mqtt.Client, topic string) <-chan string {
+	messages := make(chan string, 16)
+
+	token := client.Subscribe(topic, dispatcher.MqttQOS, func(_ mqtt.Client, message mqtt.Message) {
+		messages <- string(message.Payload())
+	})
+	token.Wait()
+	assert.NoError(t, token.Error())
+
+	return messages
+}
+
+func emulateMessage(t *testing.T, client mqtt.Client, topic string, payload string) {
+	token := client.Publish(topic, dispatcher.MqttQOS, false, payload)
+	token.Wait()
+	assert.NoError(t, token.Error())
+}
+
+func receiveCommand(t *testing.T, messages <-chan string) string {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(messageTimeout):
+		t.Fatal("The driver did not publish a command")
+		return ""
+	}
+}
+
+// Installs a bundled driver and creates a device which uses it.
+func createBundledDevice(t *testing.T, vendorID, modelID string, config map[string]interface{}) string {
+	_, found, validationErr, dbErr := driver.Manager.InstallBundledDriver(vendorID, modelID, utils.Version)
+	assert.NoError(t, dbErr)
+	assert.NoError(t, validationErr)
+	assert.True(t, found)
+
+	deviceID := fmt.Sprintf("bundled_%d", time.Now().UnixNano()%1_000_000_000)
+
+	assert.NoError(t, database.CreateRoom(database.RoomData{
+		ID:          deviceID,
+		Name:        "Bundled Driver Test",
+		Description: "/",
+	}))
+
+	driverFound, hmsErr, dbErr := driver.Manager.CreateDevice(
+		database.DEVICE_TYPE_OUTPUT,
+		deviceID,
+		fmt.Sprintf("%s %s", vendorID, modelID),
+		deviceID,
+		vendorID,
+		modelID,
+	)
+	assert.NoError(t, dbErr)
+	assert.NoError(t, hmsErr)
+	assert.True(t, driverFound)
+
+	// Configuring the topics of the device also registers its MQTT triggers.
+	assert.NoError(t, driver.Manager.StoreDeviceSingletonConfigUpdate(deviceID, config))
+
+	return deviceID
+}
+
+func assertPowerState(t *testing.T, deviceID string, expected bool) {
+	assert.Eventually(t, func() bool {
+		output, found, supported, hmsErr, err := driver.Manager.ReportDevicePowerState(deviceID)
+		return err == nil && hmsErr == nil && found && supported && output.State == expected
+	}, messageTimeout, 50*time.Millisecond)
+}
+
+func sensorReadings(t *testing.T, deviceID string) map[string]any {
+	output, found, supported, hmsErr, err := driver.Manager.ReportDeviceSensors(deviceID)
+	assert.NoError(t, err)
+	assert.Nil(t, hmsErr)
+	assert.True(t, found)
+	assert.True(t, supported)
+
+	readings := make(map[string]any)
+	for _, reading := range output {
+		readings[reading.Label] = reading.Value
+	}
+
+	return readings
+}
+
+func TestBundledTasmotaPlug(t *testing.T) {
+	topic := fmt.Sprintf("plug_%d", time.Now().UnixNano())
+	deviceID := createBundledDevice(t, "tasmota", "plug", map[string]interface{}{"topic": topic})
+
+	plug := connectEmulatedDevice(t)
+	commands := expectCommands(t, plug, fmt.Sprintf("cmnd/%s/POWER", topic))
+
+	output, found, hmsErr, err := driver.Manager.SetDevicePower(deviceID, true)
+	assert.NoError(t, err)
+	assert.Nil(t, hmsErr)
+	assert.True(t, found)
+	assert.True(t, output.Changed)
+	assert.Equal(t, "ON", receiveCommand(t, commands))
+
+	// The plug was switched off using its button.
+	emulateMessage(t, plug, fmt.Sprintf("stat/%s/POWER", topic), "OFF")
+	assertPowerState(t, deviceID, false)
+
+	emulateMessage(t, plug, fmt.Sprintf("tele/%s/STATE", topic), `{"Time":"2024-01-01T00:00:00","POWER":"ON"}`)
+	assertPowerState(t, deviceID, true)
+
+	emulateMessage(
+		t,
+		plug,
+		fmt.Sprintf("tele/%s/SENSOR", topic),
+		`{"ENERGY":{"Total":12.5,"Power":42.4,"Voltage":230.0,"Current":0.18}}`,
+	)
+	assert.Eventually(t, func() bool {
+		output, found, supported, hmsErr, err := driver.Manager.ReportDevicePowerDraw(deviceID)
+		return err == nil && hmsErr == nil && found && supported && output.Watts == 42
+	}, messageTimeout, 50*time.Millisecond)
+
+	readings := sensorReadings(t, deviceID)
+	assert.Equal(t, 230.0, readings["Voltage"])
+	assert.Equal(t, 12.5, readings["Energy"])
+}
+
+func TestBundledShellyGen2Switch(t *testing.T) {
+	prefix := fmt.Sprintf("shellyplus1pm-%d", time.Now().UnixNano())
+	deviceID := createBundledDevice(t, "shelly", "gen2_switch", map[string]interface{}{
+		"topic_prefix": prefix,
+		// The config is usually decoded from JSON, therefore numbers are floats.
+		"switch_id": float64(0),
+	})
+
+	shelly := connectEmulatedDevice(t)
+	commands := expectCommands(t, shelly, fmt.Sprintf("%s/rpc", prefix))
+
+	_, found, hmsErr, err := driver.Manager.SetDevicePower(deviceID, true)
+	assert.NoError(t, err)
+	assert.Nil(t, hmsErr)
+	assert.True(t, found)
+
+	command := receiveCommand(t, commands)
+	assert.Contains(t, command, `"method":"Switch.Set"`)
+	assert.Contains(t, command, `"on":true`)
+
+	emulateMessage(
+		t,
+		shelly,
+		fmt.Sprintf("%s/status/switch:0", prefix),
+		`{"id":0,"source":"button","output":false,"apower":0.0,"voltage":231.2,"current":0.0}`,
+	)
+	assertPowerState(t, deviceID, false)
+
+	readings := sensorReadings(t, deviceID)
+	assert.Equal(t, 231.2, readings["Voltage"])
+}
+
+func TestBundledZigbee2MqttLight(t *testing.T) {
+	name := fmt.Sprintf("light_%d", time.Now().UnixNano())
+	deviceID := createBundledDevice(t, "zigbee2mqtt", "light", map[string]interface{}{"friendly_name": name})
+
+	bridge := connectEmulatedDevice(t)
+	commands := expectCommands(t, bridge, fmt.Sprintf("zigbee2mqtt/%s/set", name))
+
+	_, found, hmsErr, err := driver.Manager.SetDeviceDim(deviceID, "Brightness", 128)
+	assert.NoError(t, err)
+	assert.Nil(t, hmsErr)
+	assert.True(t, found)
+	assert.JSONEq(t, `{"brightness":128}`, receiveCommand(t, commands))
+
+	emulateMessage(t, bridge, fmt.Sprintf("zigbee2mqtt/%s", name), `{"state":"ON","brightness":200,"linkquality":87}`)
+	assertPowerState(t, deviceID, true)
+
+	assert.Eventually(t, func() bool {
+		output, found, supported, hmsErr, err := driver.Manager.ReportDeviceDimmables(deviceID)
+		return err == nil && hmsErr == nil && found && supported && len(output) == 1 && output[0].Value == 200
+	}, messageTimeout, 50*time.Millisecond)
+}
+
+func TestBundledZigbee2MqttSensor(t *testing.T) {
+	name := fmt.Sprintf("sensor_%d", time.Now().UnixNano())
+	deviceID := createBundledDevice(t, "zigbee2mqtt", "sensor", map[string]interface{}{"friendly_name": name})
+
+	bridge := connectEmulatedDevice(t)
+	emulateMessage(t, bridge, fmt.Sprintf("zigbee2mqtt/%s", name), `{"temperature":21.5,"humidity":48.0,"battery":97}`)
+
+	assert.Eventually(t, func() bool {
+		readings := sensorReadings(t, deviceID)
+		return readings["Temperature"] == 21.5 && readings["Humidity"] == 48.0
+	}, messageTimeout, 50*time.Millisecond)
+
+	// Sensors which are not reported by the device are omitted.
+	_, hasPressure := sensorReadings(t, deviceID)["Pressure"]
+	assert.False(t, hasPressure)
+}
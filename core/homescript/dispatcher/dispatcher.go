@@ -44,6 +44,9 @@ func InitLogger(log *logrus.Logger) {
 type InstanceT struct {
 	Hms  types.Manager
 	Mqtt *MqttManager
+	// Additional, named brokers, the default broker is `Mqtt`.
+	MqttBrokers     map[string]*MqttManager
+	MqttBrokersLock sync.RWMutex
 	// DeviceRules          map[dispatcherTypes.CallbackTriggerDeviceAction]dispatcherTypes.RegisterInfo
 	DoneRegistrations    dispatcherTypes.Registrations
 	PendingRegistrations PendingQueue
@@ -90,13 +93,15 @@ func (i *InstanceT) DeviceReloadCallBackFn(id string) {
 
 func InitInstance(hms types.Manager, mqtt *MqttManager) (*InstanceT, error) {
 	Instance = InstanceT{
-		Hms:  hms,
-		Mqtt: mqtt,
+		Hms:             hms,
+		Mqtt:            mqtt,
+		MqttBrokers:     make(map[string]*MqttManager),
+		MqttBrokersLock: sync.RWMutex{},
 		// DeviceRules: make(map[dispatcherTypes.CallbackTriggerDeviceAction]dispatcherTypes.RegisterInfo),
 		DoneRegistrations: dispatcherTypes.Registrations{
 			Lock:                   sync.RWMutex{},
 			Set:                    make(map[dispatcherTypes.RegistrationID]dispatcherTypes.RegisterInfo),
-			MqttRegistrations:      make(map[string][]dispatcherTypes.RegistrationID),
+			MqttRegistrations:      make(map[dispatcherTypes.MqttRegistrationKey][]dispatcherTypes.RegistrationID),
 			SchedulerRegistrations: make(map[string]dispatcherTypes.RegistrationID),
 			Device:                 make([]dispatcherTypes.DeviceRegistration, 0),
 		},
@@ -116,8 +121,14 @@ func (i *InstanceT) MQTTStatus() error {
 }
 
 func (i *InstanceT) Reload(mqttConfig database.MqttConfig) error {
-	i.Mqtt.setConfig(mqttConfig)
-	return i.Mqtt.Reload()
+	i.Mqtt.setConfig(defaultMqttConnection(mqttConfig))
+	reloadErr := i.Mqtt.Reload()
+
+	if err := i.ApplyMqttBrokers(mqttConfig); err != nil && reloadErr == nil {
+		reloadErr = err
+	}
+
+	return reloadErr
 }
 
 // TODO: same as for the HMS manager, join these two functions.
@@ -220,8 +231,15 @@ func (i *InstanceT) registerInternal(info dispatcherTypes.RegisterInfo) (dispatc
 			topics = append(topics, topic)
 		}
 
-		// TODO: maybe check that a program cannot register twice.
-		if err := i.Mqtt.Subscribe(topics, i.mqttCallBack); err != nil {
+		broker := dispatcherTypes.MqttBrokerName(trigger.Broker)
+
+		manager, err := i.MqttBroker(broker)
+		if err == nil {
+			// TODO: maybe check that a program cannot register twice.
+			err = manager.Subscribe(topics, i.mqttCallBack(broker))
+		}
+
+		if err != nil {
 			// Delete allocated ID again. TODO: make deletion on failure more robust -> refactor code
 			i.DoneRegistrations.Lock.Lock()
 			delete(i.DoneRegistrations.Set, id)
@@ -234,26 +252,24 @@ func (i *InstanceT) registerInternal(info dispatcherTypes.RegisterInfo) (dispatc
 		i.DoneRegistrations.Set[id] = info
 
 		for _, topic := range topics {
-			old, found := i.DoneRegistrations.MqttRegistrations[topic]
+			key := dispatcherTypes.MqttRegistrationKey{Broker: broker, Topic: topic}
+
+			old, found := i.DoneRegistrations.MqttRegistrations[key]
 			if !found {
-				i.DoneRegistrations.MqttRegistrations[topic] = make([]dispatcherTypes.RegistrationID, 0)
+				i.DoneRegistrations.MqttRegistrations[key] = make([]dispatcherTypes.RegistrationID, 0)
 			}
 
-			i.DoneRegistrations.MqttRegistrations[topic] = append(old, id)
+			i.DoneRegistrations.MqttRegistrations[key] = append(old, id)
 		}
 
 		i.DoneRegistrations.Lock.Unlock()
-	case dispatcherTypes.CallBackTriggerAtTime:
-		// TODO: need job ID here, this is not unique.
-		schedulerTag := fmt.Sprintf("dispatcher-%s-%s", info.ProgramID, info.Function.Ident)
-
-		if err := scheduler.Manager.CreateNewScheduleInternal(
-			trigger.Hour,
-			trigger.Minute,
-			schedulerTag,
-			i.timeCallBack,
-			info,
-		); err != nil {
+	case dispatcherTypes.CallBackTriggerAtTime,
+		dispatcherTypes.CallBackTriggerCron,
+		dispatcherTypes.CallBackTriggerSun:
+		// The registration ID makes this tag unique, even if a function is registered multiple times.
+		schedulerTag := fmt.Sprintf("dispatcher-%s-%s-%d", info.ProgramID, info.Function.Ident, id)
+
+		if err := i.scheduleTimeTrigger(info, schedulerTag); err != nil {
 			// Delete allocated ID again.
 			i.DoneRegistrations.Lock.Lock()
 			delete(i.DoneRegistrations.Set, id)
@@ -284,6 +300,9 @@ func (i *InstanceT) registerInternal(info dispatcherTypes.RegisterInfo) (dispatc
 }
 
 func (i *InstanceT) UnregisterUserProgram(id string) error {
+	// Pending registrations of this program must not be registered later on.
+	i.PendingRegistrations.RemoveProgram(id)
+
 	i.DoneRegistrations.Lock.Lock()
 	set := i.DoneRegistrations.Set
 
@@ -321,52 +340,56 @@ func (i *InstanceT) Unregister(id dispatcherTypes.RegistrationID) error {
 
 	var unregisterErr error
 
-	mqttRegistrations := i.DoneRegistrations.MqttRegistrations
+	// Scheduler callbacks modify the registrations concurrently, therefore, the affected entries are collected under the lock.
+	mqttKeys := make([]dispatcherTypes.MqttRegistrationKey, 0)
+	for key, ids := range i.DoneRegistrations.MqttRegistrations {
+		if slices.Contains(ids, id) {
+			mqttKeys = append(mqttKeys, key)
+		}
+	}
+
+	schedulerTags := make([]string, 0)
+	for tag, idToCheck := range i.DoneRegistrations.SchedulerRegistrations {
+		if idToCheck == id {
+			schedulerTags = append(schedulerTags, tag)
+		}
+	}
+
 	i.DoneRegistrations.Lock.Unlock()
 
 	// Also delete all references in MQTT.
-	for topic, ids := range mqttRegistrations {
-		if slices.Contains(ids, id) {
-			if err := i.Mqtt.Unsubscribe(topic); err != nil && unregisterErr == nil {
+	for _, key := range mqttKeys {
+		// If the broker was removed in the meantime, there is nothing to unsubscribe from.
+		if manager, err := i.MqttBroker(key.Broker); err == nil {
+			if err := manager.Unsubscribe(key.Topic); err != nil && unregisterErr == nil {
 				unregisterErr = err
 			}
+		}
 
-			if len(ids) == 1 {
-				// Remove entire topic from map.
-				i.DoneRegistrations.Lock.Lock()
-				delete(i.DoneRegistrations.MqttRegistrations, topic)
-				i.DoneRegistrations.Lock.Unlock()
-				continue
-			}
-
-			newSlice := make([]dispatcherTypes.RegistrationID, 0)
-			for _, idToCheck := range ids {
-				if idToCheck == id {
-					continue
-				}
-				newSlice = append(newSlice, idToCheck)
-			}
+		i.DoneRegistrations.Lock.Lock()
+		remaining := slices.DeleteFunc(
+			slices.Clone(i.DoneRegistrations.MqttRegistrations[key]),
+			func(idToCheck dispatcherTypes.RegistrationID) bool { return idToCheck == id },
+		)
 
-			i.DoneRegistrations.Lock.Lock()
-			i.DoneRegistrations.MqttRegistrations[topic] = newSlice
-			i.DoneRegistrations.Lock.Unlock()
+		if len(remaining) == 0 {
+			// Remove entire topic from map.
+			delete(i.DoneRegistrations.MqttRegistrations, key)
+		} else {
+			i.DoneRegistrations.MqttRegistrations[key] = remaining
 		}
+		i.DoneRegistrations.Lock.Unlock()
 	}
 
 	// Delete reference in scheduler if required.
-	i.DoneRegistrations.Lock.RLock()
-	scheds := i.DoneRegistrations.SchedulerRegistrations
-	i.DoneRegistrations.Lock.RUnlock()
-	for tag, idToCheck := range scheds {
-		if id == idToCheck {
-			if err := scheduler.Manager.RemoveScheduleInternal(tag); err != nil && unregisterErr == nil {
-				unregisterErr = err
-			}
-
-			i.DoneRegistrations.Lock.Lock()
-			delete(i.DoneRegistrations.SchedulerRegistrations, tag)
-			i.DoneRegistrations.Lock.Unlock()
+	for _, tag := range schedulerTags {
+		if err := scheduler.Manager.RemoveScheduleInternal(tag); err != nil && unregisterErr == nil {
+			unregisterErr = err
 		}
+
+		i.DoneRegistrations.Lock.Lock()
+		delete(i.DoneRegistrations.SchedulerRegistrations, tag)
+		i.DoneRegistrations.Lock.Unlock()
 	}
 
 	// Delete reference in device events
@@ -654,17 +677,25 @@ func eventMatchesDevice(
 	return false
 }
 
-func (i *InstanceT) mqttCallBack(_ mqtt.Client, message mqtt.Message) {
+// Returns the message handler of a broker.
+func (i *InstanceT) mqttCallBack(broker string) mqtt.MessageHandler {
+	return func(_ mqtt.Client, message mqtt.Message) {
+		i.handleMqttMessage(broker, message)
+	}
+}
+
+func (i *InstanceT) handleMqttMessage(broker string, message mqtt.Message) {
 	// Invoke all MQTT registrations for this topic.
 	topic := message.Topic()
 	payload := string(message.Payload())
 
-	logger.Tracef("Mqtt Callback: topic: `%s`, payload: `%s`", topic, payload)
+	logger.Tracef("Mqtt Callback: broker: `%s`, topic: `%s`, payload: `%s`", broker, topic, payload)
 
 	i.DoneRegistrations.Lock.RLock()
 	defer i.DoneRegistrations.Lock.RUnlock()
 
-	for _, registrationID := range i.DoneRegistrations.MqttRegistrations[topic] {
+	key := dispatcherTypes.MqttRegistrationKey{Broker: broker, Topic: topic}
+	for _, registrationID := range i.DoneRegistrations.MqttRegistrations[key] {
 		registration, found := i.DoneRegistrations.Set[registrationID]
 		if !found {
 			panic(fmt.Sprintf("Registered MQTT ID not found: %d", registrationID))
@@ -691,21 +722,6 @@ func (i *InstanceT) mqttCallBack(_ mqtt.Client, message mqtt.Message) {
 	}
 }
 
-func (i *InstanceT) timeCallBack(registration dispatcherTypes.RegisterInfo) {
-	trigger := registration.Trigger.(dispatcherTypes.CallBackTriggerAtTime)
-	i.CallBack(registration, CallBackMeta{
-		Args: []value.Value{
-			*value.NewValueInt(int64(time.Since(trigger.RegisteredAt).Seconds())),
-		},
-		FunctionSignature: runtime.FunctionInvocationSignature{
-			Params: []runtime.FunctionInvocationSignatureParam{
-				{Ident: "elapsed", Type: ast.NewIntType(herrors.Span{})},
-			},
-			ReturnType: ast.NewNullType(herrors.Span{}),
-		},
-	})
-}
-
 func (i *InstanceT) deviceCallBack(registration dispatcherTypes.RegisterInfo) {
 	panic("TODO: implement this")
 }
@@ -1,10 +1,14 @@
 package dispatcher
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"regexp"
 	"runtime"
 	"sync"
 	"time"
@@ -13,6 +17,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/smarthome-go/smarthome/core/database"
 	"github.com/smarthome-go/smarthome/core/homescript/dispatcher/types"
+	"github.com/smarthome-go/smarthome/core/mqttbroker"
 )
 
 const MqttKeepAlive time.Duration = time.Second * 60
@@ -21,8 +26,11 @@ const MqttPingTimeout time.Duration = time.Second
 const MqttDisconnectTimeoutMillis uint = 250
 const MqttQOS byte = 0x2
 const MqttHealthCheckTopic = "healthcheck"
+const MqttClientID = "homescript-smarthome"
 const mqttAllowVerbose = false
 
+var mqttBrokerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,30}$`)
+
 // Error messages.
 
 const notInitializedErrMsg = "MQTT subsystem is not initialized"
@@ -38,8 +46,10 @@ type Subscription struct {
 type MqttManagerBody struct {
 	Subscriptions map[string]Subscription
 	Client        mqtt.Client
-	Config        database.MqttConfig
+	Config        database.MqttBrokerConnection
 	Initialized   bool
+	// Are called after a connection was established and all subscriptions were restored.
+	ReconnectHooks []func()
 }
 
 //
@@ -93,6 +103,9 @@ func (m TracingRWMutex) RUnlock() {
 //
 
 type MqttManager struct {
+	// The name of the broker, is `default` for the broker of the server's main MQTT config.
+	Name string
+
 	Body struct {
 		Lock    TracingRWMutex
 		Content MqttManagerBody
@@ -118,7 +131,7 @@ func (m *MqttManager) connectionLostHandler(_ mqtt.Client, err error) {
 	m.Body.Lock.Lock()
 	m.Body.Content.Initialized = false
 	m.Body.Lock.Unlock()
-	logger.Errorf("MQTT connection lost: %s\n", err.Error())
+	logger.Errorf("MQTT connection `%s` lost: %s\n", m.Name, err.Error())
 }
 
 func (m *MqttManager) connectionEstablishedHandler(client mqtt.Client) {
@@ -135,7 +148,7 @@ func (m *MqttManager) connectionEstablishedHandler(client mqtt.Client) {
 		logger.Errorf("Failed to trigger parent reload after connection was established: %s\n", err.Error())
 	}
 
-	logger.Info("MQTT connection established")
+	logger.Infof("MQTT connection `%s` established", m.Name)
 }
 
 func InitModule() {
@@ -145,8 +158,17 @@ func InitModule() {
 	}
 }
 
+// Creates the manager of the default broker.
 func NewMqttManager(config database.MqttConfig, retryHook func() error) (m *MqttManager, e error) {
-	m = &MqttManager{
+	m = newMqttManager(defaultMqttConnection(config), retryHook)
+	Manager = *m
+	return m, nil
+}
+
+// Creates a manager which connects to its broker in the background.
+func newMqttManager(connection database.MqttBrokerConnection, retryHook func() error) *MqttManager {
+	m := &MqttManager{
+		Name: connection.Name,
 		Body: struct {
 			Lock    TracingRWMutex
 			Content MqttManagerBody
@@ -155,28 +177,163 @@ func NewMqttManager(config database.MqttConfig, retryHook func() error) (m *Mqtt
 				Internal: &sync.RWMutex{},
 			},
 			Content: MqttManagerBody{
-				Subscriptions: make(map[string]Subscription),
-				Client:        nil,
-				Config:        config,
-				Initialized:   false,
+				Subscriptions:  make(map[string]Subscription),
+				Client:         nil,
+				Config:         connection,
+				Initialized:    false,
+				ReconnectHooks: make([]func(), 0),
 			},
 		},
 		TriggerTryPendingRegistrations: retryHook,
 		ShutdownChan:                   make(chan struct{}),
-		ShutdownCompleted:              make(chan struct{}),
+		// Is buffered so that the keepalive of a stopped manager can exit without a receiver.
+		ShutdownCompleted: make(chan struct{}, 1),
 	}
 
-	Manager = *m
-
 	go m.MQTTKeepalive()
 
-	return m, nil
+	return m
 }
 
-func (m *MqttManager) setConfig(config database.MqttConfig) {
+func (m *MqttManager) setConfig(connection database.MqttBrokerConnection) {
 	m.Body.Lock.Lock()
 	defer m.Body.Lock.Unlock()
-	m.Body.Content.Config = config
+	m.Body.Content.Config = connection
+}
+
+func (m *MqttManager) config() database.MqttBrokerConnection {
+	m.Body.Lock.RLock()
+	defer m.Body.Lock.RUnlock()
+	return m.Body.Content.Config
+}
+
+// Returns how to reach the default broker, the embedded broker is reached locally using the internal user.
+func defaultMqttConnection(config database.MqttConfig) database.MqttBrokerConnection {
+	if config.Broker.Enabled {
+		return database.MqttBrokerConnection{
+			Name:     types.DefaultMqttBroker,
+			Enabled:  config.Enabled,
+			Host:     embeddedBrokerHost(config.Broker.Address),
+			Port:     config.Broker.Port,
+			Username: mqttbroker.InternalUsername,
+			Password: mqttbroker.InternalPassword(),
+			TLS: database.MqttTLSConfig{
+				Enabled: config.Broker.TLSCertificate != "",
+				// The certificate is issued for the public name of the server, not for the address which is dialed here.
+				// As the connection never leaves this host, the certificate is not verified.
+				InsecureSkipVerify: true,
+			},
+		}
+	}
+
+	return database.MqttBrokerConnection{
+		Name:     types.DefaultMqttBroker,
+		Enabled:  config.Enabled,
+		Host:     config.Host,
+		Port:     config.Port,
+		Username: config.Username,
+		Password: config.Password,
+		TLS:      config.TLS,
+	}
+}
+
+// The embedded broker is dialed via loopback unless it is bound to a specific address.
+func embeddedBrokerHost(address string) string {
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+		return mqttbroker.DefaultAddress
+	case ip.IsUnspecified() && ip.To4() == nil:
+		return net.IPv6loopback.String()
+	case ip.IsUnspecified():
+		return mqttbroker.DefaultAddress
+	default:
+		return address
+	}
+}
+
+// Builds the TLS config of a connection from its PEM encoded certificates.
+func buildTLSConfig(config database.MqttTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// This is an explicit choice of the user, for instance, in order to use self-signed certificates.
+		InsecureSkipVerify: config.InsecureSkipVerify, // nolint:gosec
+	}
+
+	if config.CaBundle != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(config.CaBundle)) {
+			return nil, errors.New("the CA bundle does not contain any valid PEM certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (config.ClientCertificate == "") != (config.ClientKey == "") {
+		return nil, errors.New("a client certificate requires a client key and vice versa")
+	}
+
+	if config.ClientCertificate != "" {
+		certificate, err := tls.X509KeyPair([]byte(config.ClientCertificate), []byte(config.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate or key: %s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// Validates the parts of an MQTT config which would otherwise only fail once the server connects.
+func ValidateMqttConfig(config database.MqttConfig) error {
+	if config.Broker.Enabled {
+		if config.Broker.Address != "" && net.ParseIP(config.Broker.Address) == nil {
+			return fmt.Errorf("invalid address of the embedded broker `%s`: an IP address is required", config.Broker.Address)
+		}
+
+		if (config.Broker.TLSCertificate == "") != (config.Broker.TLSKey == "") {
+			return errors.New("the embedded broker requires both a certificate and a key in order to use TLS")
+		}
+
+		if config.Broker.TLSCertificate != "" {
+			if _, err := mqttbroker.ServerTLSConfig(config.Broker.TLSCertificate, config.Broker.TLSKey); err != nil {
+				return fmt.Errorf("invalid TLS settings of the embedded broker: %s", err.Error())
+			}
+		}
+	}
+
+	if config.TLS.Enabled {
+		if _, err := buildTLSConfig(config.TLS); err != nil {
+			return fmt.Errorf("invalid TLS settings of the default broker: %s", err.Error())
+		}
+	}
+
+	names := make(map[string]struct{})
+	for _, connection := range config.Connections {
+		if !mqttBrokerNamePattern.MatchString(connection.Name) {
+			return fmt.Errorf("invalid broker name `%s`: only 1 to 30 letters, digits, `-` and `_` are allowed", connection.Name)
+		}
+
+		if connection.Name == types.DefaultMqttBroker {
+			return fmt.Errorf("the broker name `%s` is reserved for the default broker", types.DefaultMqttBroker)
+		}
+
+		if _, duplicate := names[connection.Name]; duplicate {
+			return fmt.Errorf("the broker name `%s` is used more than once", connection.Name)
+		}
+		names[connection.Name] = struct{}{}
+
+		if connection.Host == "" || connection.Port == 0 {
+			return fmt.Errorf("the broker `%s` requires a host and a port", connection.Name)
+		}
+
+		if connection.TLS.Enabled {
+			if _, err := buildTLSConfig(connection.TLS); err != nil {
+				return fmt.Errorf("invalid TLS settings of the broker `%s`: %s", connection.Name, err.Error())
+			}
+		}
+	}
+
+	return nil
 }
 
 func (m *MqttManager) init() error {
@@ -185,28 +342,43 @@ func (m *MqttManager) init() error {
 
 	m.Body.Lock.Lock()
 	defer m.Body.Lock.Unlock()
-	mqttEnabled := m.Body.Content.Config.Enabled
+	connection := m.Body.Content.Config
 
-	if !mqttEnabled {
-		logger.Debugf("MQTT subsystem is disabled according to server config")
+	if !connection.Enabled {
+		logger.Debugf("MQTT connection `%s` is disabled according to server config", m.Name)
 		return nil
 	}
 
 	logger.Debugf(
-		"Initializing MQTT subsystem for broker `%s@%s` (timeout: %v)...",
-		m.Body.Content.Config.Username,
-		m.Body.Content.Config.Host,
+		"Initializing MQTT connection `%s` to broker `%s@%s` (timeout: %v)...",
+		m.Name,
+		connection.Username,
+		connection.Host,
 		MqttConnectTimeout,
 	)
 
+	// Named brokers might be the same as the default broker, therefore, the client IDs must differ.
+	clientID := MqttClientID
+	if m.Name != types.DefaultMqttBroker {
+		clientID = fmt.Sprintf("%s-%s", MqttClientID, m.Name)
+	}
+
 	opts := mqtt.NewClientOptions().
-		AddBroker(types.MakeBrokerURI(
-			m.Body.Content.Config.Host,
-			m.Body.Content.Config.Port,
-		)).
-		SetClientID("homescript-smarthome").
-		SetUsername(m.Body.Content.Config.Username).
-		SetPassword(m.Body.Content.Config.Password)
+		SetClientID(clientID).
+		SetUsername(connection.Username).
+		SetPassword(connection.Password)
+
+	if connection.TLS.Enabled {
+		tlsConfig, err := buildTLSConfig(connection.TLS)
+		if err != nil {
+			return err
+		}
+
+		opts.AddBroker(types.MakeSecureBrokerURI(connection.Host, connection.Port))
+		opts.SetTLSConfig(tlsConfig)
+	} else {
+		opts.AddBroker(types.MakeBrokerURI(connection.Host, connection.Port))
+	}
 
 	opts.SetConnectTimeout(MqttConnectTimeout)
 	opts.SetKeepAlive(MqttKeepAlive)
@@ -236,7 +408,7 @@ func (m *MqttManager) init() error {
 
 	m.Body.Content.Initialized = true
 
-	logger.Infof("Initialized MQTT subsystem for broker `%s@%s`", m.Body.Content.Config.Username, m.Body.Content.Config.Host)
+	logger.Infof("Initialized MQTT connection `%s` to broker `%s@%s`", m.Name, connection.Username, connection.Host)
 
 	return nil
 }
@@ -265,7 +437,7 @@ func (m *MqttManager) MQTTKeepalive() {
 			m.Body.Lock.RUnlock()
 
 			if enabled {
-				logger.Errorf("MQTT could not be initialized: %s", err.Error())
+				logger.Errorf("MQTT connection `%s` could not be initialized: %s", m.Name, err.Error())
 			}
 		}
 
@@ -273,6 +445,20 @@ func (m *MqttManager) MQTTKeepalive() {
 	}
 }
 
+// Disconnects from the broker and stops the keepalive, the manager must not be used afterwards.
+func (m *MqttManager) stop() {
+	m.Body.Lock.Lock()
+	m.Body.Content.Config.Enabled = false
+	m.Body.Lock.Unlock()
+
+	// As the connection is disabled now, reloading only disconnects.
+	if err := m.Reload(); err != nil {
+		logger.Warnf("Could not cleanly disconnect MQTT connection `%s`: %s", m.Name, err.Error())
+	}
+
+	close(m.ShutdownChan)
+}
+
 func (m *MqttManager) IsConnected() bool {
 	return m.Body.Content.Initialized && m.Body.Content.Client != nil && m.Body.Content.Client.IsConnected()
 }
@@ -354,7 +540,29 @@ func (m *MqttManager) reloadOnReconnect() error {
 	}
 
 	m.unsubscribeAllSubscriptionsNonTracing()
-	return m.resubscribeNonTracing()
+	if err := m.resubscribeNonTracing(); err != nil {
+		return err
+	}
+
+	m.Body.Lock.RLock()
+	hooks := m.Body.Content.ReconnectHooks
+	m.Body.Lock.RUnlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	return nil
+}
+
+// Registers a function which is called whenever the connection to the broker is (re-)established.
+// Retained messages might have been lost meanwhile, therefore, they should be published again.
+// Hooks are called by the MQTT client, therefore, they must not block.
+func (m *MqttManager) OnReconnect(hook func()) {
+	m.Body.Lock.Lock()
+	defer m.Body.Lock.Unlock()
+
+	m.Body.Content.ReconnectHooks = append(m.Body.Content.ReconnectHooks, hook)
 }
 
 func (m *MqttManager) unsubscribeAllSubscriptionsNonTracing() {
@@ -523,6 +731,15 @@ func (m *MqttManager) Unsubscribe(topic string) error {
 }
 
 func (m *MqttManager) Publish(topic string, message string) error {
+	return m.publish(topic, message, false)
+}
+
+// Retained messages are also delivered to clients which subscribe later on.
+func (m *MqttManager) PublishRetained(topic string, message string) error {
+	return m.publish(topic, message, true)
+}
+
+func (m *MqttManager) publish(topic string, message string, retained bool) error {
 	m.Body.Lock.Lock()
 	defer m.Body.Lock.Unlock()
 
@@ -530,7 +747,7 @@ func (m *MqttManager) Publish(topic string, message string) error {
 		return errors.New(notInitializedErrMsg)
 	}
 
-	token := m.Body.Content.Client.Publish(topic, MqttQOS, false, message)
+	token := m.Body.Content.Client.Publish(topic, MqttQOS, retained, message)
 	token.Wait()
 	if token.Error() != nil {
 		logger.Errorf("Could not publish to MQTT topic `%s`: %s", topic, token.Error())
@@ -0,0 +1,177 @@
+package dispatcher_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a PEM encoded, self-signed certificate and its key.
+func selfSignedCertificate(t *testing.T) (certificate string, key string) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "shed.garden.lan"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+}
+
+func TestValidateMqttConfig(t *testing.T) {
+	certificate, key := selfSignedCertificate(t)
+	_, otherKey := selfSignedCertificate(t)
+
+	connection := func(name string, tls database.MqttTLSConfig) database.MqttBrokerConnection {
+		return database.MqttBrokerConnection{
+			Name:    name,
+			Enabled: true,
+			Host:    "shed.garden.lan",
+			Port:    8883,
+			TLS:     tls,
+		}
+	}
+
+	table := []struct {
+		Name  string
+		Input database.MqttConfig
+		Valid bool
+	}{
+		{
+			Name:  "empty",
+			Input: database.MqttConfig{},
+			Valid: true,
+		},
+		{
+			Name: "mutual TLS",
+			Input: database.MqttConfig{
+				TLS: database.MqttTLSConfig{Enabled: true, CaBundle: certificate},
+				Connections: []database.MqttBrokerConnection{
+					connection("shed", database.MqttTLSConfig{
+						Enabled:           true,
+						CaBundle:          certificate,
+						ClientCertificate: certificate,
+						ClientKey:         key,
+					}),
+					connection("local-2", database.MqttTLSConfig{}),
+				},
+			},
+			Valid: true,
+		},
+		{
+			Name: "invalid TLS settings are ignored if TLS is disabled",
+			Input: database.MqttConfig{
+				TLS: database.MqttTLSConfig{Enabled: false, CaBundle: "invalid"},
+			},
+			Valid: true,
+		},
+		{
+			Name: "invalid CA bundle of the default broker",
+			Input: database.MqttConfig{
+				TLS: database.MqttTLSConfig{Enabled: true, CaBundle: "invalid"},
+			},
+			Valid: false,
+		},
+		{
+			Name: "client certificate without key",
+			Input: database.MqttConfig{
+				Connections: []database.MqttBrokerConnection{
+					connection("shed", database.MqttTLSConfig{Enabled: true, ClientCertificate: certificate}),
+				},
+			},
+			Valid: false,
+		},
+		{
+			Name: "mismatching client key",
+			Input: database.MqttConfig{
+				Connections: []database.MqttBrokerConnection{
+					connection("shed", database.MqttTLSConfig{Enabled: true, ClientCertificate: certificate, ClientKey: otherKey}),
+				},
+			},
+			Valid: false,
+		},
+		{
+			Name: "reserved name",
+			Input: database.MqttConfig{
+				Connections: []database.MqttBrokerConnection{connection("default", database.MqttTLSConfig{})},
+			},
+			Valid: false,
+		},
+		{
+			Name: "invalid name",
+			Input: database.MqttConfig{
+				Connections: []database.MqttBrokerConnection{connection("garden shed", database.MqttTLSConfig{})},
+			},
+			Valid: false,
+		},
+		{
+			Name: "duplicate name",
+			Input: database.MqttConfig{
+				Connections: []database.MqttBrokerConnection{
+					connection("shed", database.MqttTLSConfig{}),
+					connection("shed", database.MqttTLSConfig{}),
+				},
+			},
+			Valid: false,
+		},
+		{
+			Name: "embedded broker using TLS on all interfaces",
+			Input: database.MqttConfig{
+				Broker: database.MqttBrokerConfig{Enabled: true, Address: "::", Port: 8883, TLSCertificate: certificate, TLSKey: key},
+			},
+			Valid: true,
+		},
+		{
+			Name: "embedded broker bound to a hostname",
+			Input: database.MqttConfig{
+				Broker: database.MqttBrokerConfig{Enabled: true, Address: "shed.garden.lan", Port: 1883},
+			},
+			Valid: false,
+		},
+		{
+			Name: "embedded broker certificate without key",
+			Input: database.MqttConfig{
+				Broker: database.MqttBrokerConfig{Enabled: true, Address: "127.0.0.1", Port: 8883, TLSCertificate: certificate},
+			},
+			Valid: false,
+		},
+		{
+			Name: "missing host",
+			Input: database.MqttConfig{
+				Connections: []database.MqttBrokerConnection{{Name: "shed", Port: 1883}},
+			},
+			Valid: false,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Name, func(t *testing.T) {
+			err := dispatcher.ValidateMqttConfig(test.Input)
+			if test.Valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package dispatcher
 
 import (
+	"slices"
 	"sync"
 
 	dispatcherTypes "github.com/smarthome-go/smarthome/core/homescript/dispatcher/types"
@@ -53,6 +54,26 @@ func (q *PendingQueue) First() *dispatcherTypes.RegisterInfo {
 	return &first
 }
 
+// Removes and returns all queued registrations.
+func (q *PendingQueue) Drain() []dispatcherTypes.RegisterInfo {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	drained := q.internal
+	q.internal = make([]dispatcherTypes.RegisterInfo, 0)
+	return drained
+}
+
+// Removes all queued registrations of the given program.
+func (q *PendingQueue) RemoveProgram(programID string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.internal = slices.DeleteFunc(q.internal, func(info dispatcherTypes.RegisterInfo) bool {
+		return info.ProgramID == programID
+	})
+}
+
 func (q *PendingQueue) IsEmpty() bool {
 	q.lock.Lock()
 	defer q.lock.Unlock()
@@ -69,20 +90,18 @@ func (i *InstanceT) RegisterPending() error {
 
 	var generalErr error
 
-	for !i.PendingRegistrations.IsEmpty() {
-		current := i.PendingRegistrations.First()
-
-		id, err := i.registerInternal(*current)
+	// Every registration is only tried once, failed ones remain pending until the next attempt.
+	for _, current := range i.PendingRegistrations.Drain() {
+		id, err := i.registerInternal(current)
 		if err != nil {
 			if generalErr == nil {
 				generalErr = err
 			}
+			i.PendingRegistrations.Enqueue(current)
 			continue
 		}
 
 		logger.Tracef("Successfully registered pending registration (new id: %d)\n", id)
-
-		i.PendingRegistrations.Dequeue()
 	}
 
 	return generalErr
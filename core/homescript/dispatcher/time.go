@@ -0,0 +1,241 @@
+package dispatcher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nathan-osman/go-sunrise"
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	herrors "github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/automation"
+	"github.com/smarthome-go/smarthome/core/database"
+	dispatcherTypes "github.com/smarthome-go/smarthome/core/homescript/dispatcher/types"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/smarthome-go/smarthome/core/scheduler"
+)
+
+// How many days are searched for the next sun event (polar day / night has none).
+const sunEventSearchDays = 7
+
+// Cron triggers have a resolution of minutes, seconds fields are not supported.
+const cronExpressionFields = 5
+
+// Sun event offsets are limited to half a day in each direction.
+const sunEventMaxOffsetMinutes = 12 * 60
+
+// Creates a repeating time-based trigger from the arguments of the trigger functions
+// `cron`, `sunrise`, `sunset` and `at`.
+func TimeTriggerFromArgs(triggerIdent string, args []value.Value) (dispatcherTypes.CallBackTrigger, error) {
+	now := time.Now()
+
+	switch triggerIdent {
+	case types.TriggerCronIdent:
+		expression := args[0].(value.ValueString).Inner
+		// Expressions with a seconds field could fire more often than once per minute.
+		if len(strings.Fields(expression)) != cronExpressionFields {
+			return nil, fmt.Errorf("Cron expression `%s` must consist of exactly %d fields (minute, hour, day of month, month, day of week)", expression, cronExpressionFields)
+		}
+		if !automation.IsValidCronExpression(expression) {
+			return nil, fmt.Errorf("Invalid cron expression `%s`", expression)
+		}
+
+		return dispatcherTypes.CallBackTriggerCron{
+			Expression:   expression,
+			RegisteredAt: now,
+		}, nil
+	case types.TriggerSunriseIdent, types.TriggerSunsetIdent:
+		offset := args[0].(value.ValueInt).Inner
+		if offset < -sunEventMaxOffsetMinutes || offset > sunEventMaxOffsetMinutes {
+			return nil, fmt.Errorf(
+				"Sun event offset must be between -%d and %d minutes, got %d",
+				sunEventMaxOffsetMinutes,
+				sunEventMaxOffsetMinutes,
+				offset,
+			)
+		}
+
+		event := dispatcherTypes.SunriseEvent
+		if triggerIdent == types.TriggerSunsetIdent {
+			event = dispatcherTypes.SunsetEvent
+		}
+
+		return dispatcherTypes.CallBackTriggerSun{
+			Event:         event,
+			OffsetMinutes: offset,
+			RegisteredAt:  now,
+		}, nil
+	case types.TriggerAtIdent:
+		hour := args[0].(value.ValueInt).Inner
+		minute := args[1].(value.ValueInt).Inner
+		if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+			return nil, fmt.Errorf("Invalid time %02d:%02d: hour must be 0-23 and minute must be 0-59", hour, minute)
+		}
+
+		return dispatcherTypes.CallBackTriggerAtTime{
+			Hour:         uint8(hour),
+			Minute:       uint8(minute),
+			Second:       0,
+			Mode:         dispatcherTypes.RepeatingTriggerTimeMode,
+			RegisteredAt: now,
+		}, nil
+	default:
+		return nil, fmt.Errorf("Trigger `%s` is not time-based", triggerIdent)
+	}
+}
+
+// Creates the scheduler job of a time-based registration.
+func (i *InstanceT) scheduleTimeTrigger(info dispatcherTypes.RegisterInfo, schedulerTag string) error {
+	switch trigger := info.Trigger.(type) {
+	case dispatcherTypes.CallBackTriggerAtTime:
+		if trigger.Mode == dispatcherTypes.RepeatingTriggerTimeMode {
+			return scheduler.Manager.CreateRepeatingScheduleInternal(
+				trigger.Hour,
+				trigger.Minute,
+				schedulerTag,
+				i.timeCallBack,
+				info,
+			)
+		}
+
+		return scheduler.Manager.CreateNewScheduleInternal(
+			trigger.Hour,
+			trigger.Minute,
+			schedulerTag,
+			i.timeCallBack,
+			info,
+		)
+	case dispatcherTypes.CallBackTriggerCron:
+		return scheduler.Manager.CreateCronScheduleInternal(
+			trigger.Expression,
+			schedulerTag,
+			i.timeCallBack,
+			info,
+		)
+	case dispatcherTypes.CallBackTriggerSun:
+		// Sun events shift every day: therefore, only the next occurrence is scheduled.
+		// Once it fires, the next occurrence is calculated by `sunCallBack`.
+		next, err := nextSunEvent(trigger, time.Now())
+		if err != nil {
+			return err
+		}
+
+		// The next event might be tomorrow at a later time of day, therefore, the job must not be scheduled by its time of day alone.
+		return scheduler.Manager.CreateScheduleAtInternal(
+			next,
+			schedulerTag,
+			i.sunCallBack,
+			info,
+			schedulerTag,
+		)
+	default:
+		panic(fmt.Sprintf("Unreachable: trigger %v is not time-based", info.Trigger))
+	}
+}
+
+// Calculates the next point in time (after `now`) at which the given sun trigger fires.
+func nextSunEvent(trigger dispatcherTypes.CallBackTriggerSun, now time.Time) (time.Time, error) {
+	config, found, err := database.GetServerConfiguration()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !found {
+		return time.Time{}, fmt.Errorf("Could not calculate sun event: server configuration not found")
+	}
+
+	offset := time.Duration(trigger.OffsetMinutes) * time.Minute
+
+	for day := 0; day < sunEventSearchDays; day++ {
+		date := now.AddDate(0, 0, day)
+
+		rise, set := sunrise.SunriseSunset(
+			float64(config.Latitude), float64(config.Longitude),
+			date.Year(), date.Month(), date.Day(),
+		)
+
+		event := rise
+		if trigger.Event == dispatcherTypes.SunsetEvent {
+			event = set
+		}
+
+		// The sun does not rise or set on this day.
+		if event.IsZero() {
+			continue
+		}
+
+		// The scheduler only has a resolution of minutes.
+		if candidate := event.Add(offset).Local().Truncate(time.Minute); candidate.After(now) {
+			return candidate, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Could not calculate sun event: there is no sunrise or sunset in the next %d days", sunEventSearchDays)
+}
+
+func registeredAt(trigger dispatcherTypes.CallBackTrigger) time.Time {
+	switch t := trigger.(type) {
+	case dispatcherTypes.CallBackTriggerAtTime:
+		return t.RegisteredAt
+	case dispatcherTypes.CallBackTriggerCron:
+		return t.RegisteredAt
+	case dispatcherTypes.CallBackTriggerSun:
+		return t.RegisteredAt
+	default:
+		panic(fmt.Sprintf("Unreachable: trigger %v is not time-based", trigger))
+	}
+}
+
+func (i *InstanceT) timeCallBack(registration dispatcherTypes.RegisterInfo) {
+	i.CallBack(registration, CallBackMeta{
+		Args: []value.Value{
+			*value.NewValueInt(int64(time.Since(registeredAt(registration.Trigger)).Seconds())),
+		},
+		FunctionSignature: runtime.FunctionInvocationSignature{
+			Params: []runtime.FunctionInvocationSignatureParam{
+				{Ident: "elapsed", Type: ast.NewIntType(herrors.Span{})},
+			},
+			ReturnType: ast.NewNullType(herrors.Span{}),
+		},
+	})
+}
+
+// Invokes the callback of a sun trigger and schedules its next occurrence.
+func (i *InstanceT) sunCallBack(registration dispatcherTypes.RegisterInfo, schedulerTag string) {
+	i.timeCallBack(registration)
+
+	i.DoneRegistrations.Lock.RLock()
+	id, found := i.DoneRegistrations.SchedulerRegistrations[schedulerTag]
+	i.DoneRegistrations.Lock.RUnlock()
+
+	// The registration might have been removed in the meantime.
+	if !found {
+		return
+	}
+
+	// The old job is removed by the scheduler once it has run, therefore the next job requires a new tag.
+	// Calculating the next event queries the database, the registrations must not be locked meanwhile.
+	nextTag := fmt.Sprintf("dispatcher-%s-%s-%d-%d", registration.ProgramID, registration.Function.Ident, id, time.Now().Unix())
+	scheduleErr := i.scheduleTimeTrigger(registration, nextTag)
+
+	i.DoneRegistrations.Lock.Lock()
+	_, stillRegistered := i.DoneRegistrations.SchedulerRegistrations[schedulerTag]
+	delete(i.DoneRegistrations.SchedulerRegistrations, schedulerTag)
+	if scheduleErr == nil && stillRegistered {
+		i.DoneRegistrations.SchedulerRegistrations[nextTag] = id
+	}
+	i.DoneRegistrations.Lock.Unlock()
+
+	if scheduleErr != nil {
+		logger.Errorf("Could not schedule next sun event for program `%s`: %s", registration.ProgramID, scheduleErr.Error())
+		return
+	}
+
+	// The registration was removed while the next event was scheduled, its new job is not known to `Unregister`.
+	if !stillRegistered {
+		if err := scheduler.Manager.RemoveScheduleInternal(nextTag); err != nil {
+			logger.Errorf("Could not remove next sun event of unregistered program `%s`: %s", registration.ProgramID, err.Error())
+		}
+	}
+}
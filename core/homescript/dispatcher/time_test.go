@@ -0,0 +1,39 @@
+package dispatcher_test
+
+import (
+	"testing"
+
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronTriggerFromArgs(t *testing.T) {
+	table := []struct {
+		Expression string
+		Valid      bool
+	}{
+		{Expression: "*/5 * * * *", Valid: true},
+		{Expression: "30 7 * * 1-5", Valid: true},
+		// Seconds fields would allow triggers which fire more often than once per minute.
+		{Expression: "* * * * * *", Valid: false},
+		{Expression: "*/10 * * * * *", Valid: false},
+		{Expression: "* * *", Valid: false},
+		{Expression: "61 * * * *", Valid: false},
+	}
+
+	for _, test := range table {
+		t.Run(test.Expression, func(t *testing.T) {
+			_, err := dispatcher.TimeTriggerFromArgs(
+				types.TriggerCronIdent,
+				[]value.Value{*value.NewValueString(test.Expression)},
+			)
+			if test.Valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -7,7 +7,7 @@ type RegistrationID uint64
 type Registrations struct {
 	Lock                   sync.RWMutex
 	Set                    map[RegistrationID]RegisterInfo
-	MqttRegistrations      map[string][]RegistrationID
+	MqttRegistrations      map[MqttRegistrationKey][]RegistrationID
 	SchedulerRegistrations map[string]RegistrationID
 	Device                 []DeviceRegistration
 }
@@ -25,6 +25,13 @@ func (self *Registrations) Copy() map[RegistrationID]RegisterInfo {
 	return clone
 }
 
+// Topics of different brokers are unrelated, therefore, MQTT registrations are tracked per broker.
+type MqttRegistrationKey struct {
+	// Is always resolved using `MqttBrokerName`.
+	Broker string
+	Topic  string
+}
+
 type DeviceRegistration struct {
 	ID     RegistrationID
 	Action CallbackTriggerDeviceAction
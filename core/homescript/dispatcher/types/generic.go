@@ -2,7 +2,9 @@ package types
 
 import (
 	"fmt"
+	"net"
 	"slices"
+	"strconv"
 	"time"
 
 	hmsTypes "github.com/smarthome-go/smarthome/core/homescript/types"
@@ -95,6 +97,8 @@ const (
 	OnMqttCallBackTriggerKind CallBackTriggerKind = iota
 	AtTimeCallBackTriggerKind
 	OnDeviceActionTriggerKind
+	CronCallBackTriggerKind
+	SunCallBackTriggerKind
 )
 
 type CallBackTrigger interface {
@@ -106,6 +110,8 @@ type CallBackTrigger interface {
 // MQTT Trigger.
 
 type CallBackTriggerMqtt struct {
+	// The name of the broker, an empty name refers to the default broker.
+	Broker string
 	Topics []string
 }
 
@@ -117,6 +123,10 @@ func (self CallBackTriggerMqtt) Eq(other CallBackTrigger) bool {
 
 	otherM := other.(CallBackTriggerMqtt)
 
+	if MqttBrokerName(self.Broker) != MqttBrokerName(otherM.Broker) {
+		return false
+	}
+
 	// Other is subset of self.
 	for _, topic := range otherM.Topics {
 		if !slices.Contains(self.Topics, topic) {
@@ -136,6 +146,7 @@ func (self CallBackTriggerMqtt) Eq(other CallBackTrigger) bool {
 
 func (self CallBackTriggerMqtt) Clone() CallBackTrigger {
 	return CallBackTriggerMqtt{
+		Broker: self.Broker,
 		Topics: slices.Clone(self.Topics),
 	}
 }
@@ -181,6 +192,61 @@ func (self CallBackTriggerAtTime) Clone() CallBackTrigger {
 	}
 }
 
+// Cron Trigger.
+
+type CallBackTriggerCron struct {
+	Expression   string
+	RegisteredAt time.Time
+}
+
+func (self CallBackTriggerCron) Kind() CallBackTriggerKind { return CronCallBackTriggerKind }
+func (self CallBackTriggerCron) Eq(other CallBackTrigger) bool {
+	if other.Kind() != CronCallBackTriggerKind {
+		return false
+	}
+
+	return other.(CallBackTriggerCron).Expression == self.Expression
+}
+func (self CallBackTriggerCron) Clone() CallBackTrigger {
+	return CallBackTriggerCron{
+		Expression:   self.Expression,
+		RegisteredAt: self.RegisteredAt,
+	}
+}
+
+// Sun Trigger.
+
+type SunEvent uint8
+
+const (
+	SunriseEvent SunEvent = iota
+	SunsetEvent
+)
+
+type CallBackTriggerSun struct {
+	Event SunEvent
+	// Shifts the trigger time relative to the sun event, can be negative.
+	OffsetMinutes int64
+	RegisteredAt  time.Time
+}
+
+func (self CallBackTriggerSun) Kind() CallBackTriggerKind { return SunCallBackTriggerKind }
+func (self CallBackTriggerSun) Eq(other CallBackTrigger) bool {
+	if other.Kind() != SunCallBackTriggerKind {
+		return false
+	}
+
+	otherS := other.(CallBackTriggerSun)
+	return otherS.Event == self.Event && otherS.OffsetMinutes == self.OffsetMinutes
+}
+func (self CallBackTriggerSun) Clone() CallBackTrigger {
+	return CallBackTriggerSun{
+		Event:         self.Event,
+		OffsetMinutes: self.OffsetMinutes,
+		RegisteredAt:  self.RegisteredAt,
+	}
+}
+
 //
 // Dispatcher.
 //
@@ -212,7 +278,23 @@ type Dispatcher interface {
 }
 
 const mqttProtocol = "tcp"
+const mqttSecureProtocol = "ssl"
 
 func MakeBrokerURI(host string, port uint16) string {
-	return fmt.Sprintf("%s://%s:%d", mqttProtocol, host, port)
+	return fmt.Sprintf("%s://%s", mqttProtocol, net.JoinHostPort(host, strconv.Itoa(int(port))))
+}
+
+func MakeSecureBrokerURI(host string, port uint16) string {
+	return fmt.Sprintf("%s://%s", mqttSecureProtocol, net.JoinHostPort(host, strconv.Itoa(int(port))))
+}
+
+// The name under which the broker of the server's main MQTT config is addressed.
+const DefaultMqttBroker = "default"
+
+// Resolves an empty broker name to the default broker.
+func MqttBrokerName(name string) string {
+	if name == "" {
+		return DefaultMqttBroker
+	}
+	return name
 }
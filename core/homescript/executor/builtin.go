@@ -20,6 +20,7 @@ import (
 	"github.com/smarthome-go/smarthome/core/homescript/types"
 	"github.com/smarthome-go/smarthome/core/scheduler"
 	"github.com/smarthome-go/smarthome/core/user/notify"
+	"github.com/smarthome-go/smarthome/core/user/secret"
 	"github.com/smarthome-go/smarthome/services/weather"
 )
 
@@ -33,13 +34,28 @@ func (self InterpreterExecutor) GetBuiltinImport(
 	moduleName string,
 	toImport string,
 ) (val value.Value, found bool) {
+	// During test execution, side-effect modules are replaced by mocks.
+	if self.mocks != nil {
+		if val, found := self.getMockedImport(moduleName, toImport); found {
+			return val, true
+		}
+	}
+
+	if val, moduleFound := getStdlibImport(moduleName, toImport); moduleFound {
+		return val, val != nil
+	}
+
 	switch moduleName {
 	case "mqtt":
 		switch toImport {
 		case "subscribe":
-			return mqttSubscribe(), true
+			return mqttSubscribe(false), true
 		case "publish":
-			return mqttPublish(), true
+			return mqttPublish(false), true
+		case "subscribe_to":
+			return mqttSubscribe(true), true
+		case "publish_to":
+			return mqttPublish(true), true
 		default:
 			return nil, false
 		}
@@ -108,29 +124,11 @@ func (self InterpreterExecutor) GetBuiltinImport(
 			return nil, false
 		}
 	case "device":
+		if val, found := self.getDeviceQueryImport(toImport); found {
+			return val, true
+		}
+
 		switch toImport {
-		// case "get_switch":
-		// 	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
-		// 		sw, found, err := database.GetDeviceById(args[0].(value.ValueString).Inner)
-		// 		if err != nil {
-		// 			return nil, value.NewVMFatalException(
-		// 				err.Error(),
-		// 				value.Vm_HostErrorKind,
-		// 				span,
-		// 			)
-		// 		}
-		//
-		// 		if !found {
-		// 			return value.NewNoneOption(), nil
-		// 		}
-		//
-		// 		return value.NewValueOption(value.NewValueObject(map[string]*value.Value{
-		// 			"name":      value.NewValueString(sw.Name),
-		// 			"room_id":   value.NewValueString(sw.RoomId),
-		// 			"vendor_id": value.NewValueString(sw.VendorId),
-		// 			"model_id":  value.NewValueString(sw.VendorId),
-		// 		})), nil
-		// 	}), true
 		case "emit":
 			return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
 				topic := args[0].(value.ValueString).Inner
@@ -340,6 +338,42 @@ func (self InterpreterExecutor) GetBuiltinImport(
 
 				return value.NewNoneOption(), nil
 			}), true
+		case "store":
+			// Every script has its own namespace by default.
+			return *self.storeValue(self.ProgramID), true
+		case "open_store":
+			return self.openStoreBuiltin(), true
+		}
+	case "secrets":
+		switch toImport {
+		case "get":
+			return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+				if self.context.Username() == nil {
+					return nil, value.NewVMFatalException(
+						"The usage of the `secrets` functions in a non-user environment is not possible",
+						value.Vm_HostErrorKind,
+						span,
+					)
+				}
+
+				name := args[0].(value.ValueString).Inner
+
+				val, found, err := secret.Resolve(*self.context.Username(), name)
+				if err != nil {
+					return nil, value.NewVMFatalException(
+						fmt.Sprintf("Could not get secret: %s", err.Error()),
+						value.Vm_HostErrorKind,
+						span,
+					)
+				}
+
+				if !found {
+					return value.NewNoneOption(), nil
+				}
+
+				self.secrets.add(val)
+				return value.NewValueOption(value.NewValueString(val)), nil
+			}), true
 		}
 	case "reminder":
 		switch toImport {
@@ -397,6 +431,10 @@ func (self InterpreterExecutor) GetBuiltinImport(
 			}), true
 		}
 	case "net":
+		if val, found := self.getNetworkSocketImport(toImport); found {
+			return val, true
+		}
+
 		switch toImport {
 		case "ping":
 			return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
@@ -708,6 +746,31 @@ func (self InterpreterExecutor) GetBuiltinImport(
 				"description": value.NewValueString(automationContext.Inner.NotificationContext.Description),
 				"level":       value.NewValueInt(int64(automationContext.Inner.NotificationContext.Level)),
 			})), true
+		case "webhook":
+			// If this program was not invoked by a webhook.
+			if self.context.Kind() != types.HMS_PROGRAM_KIND_WEBHOOK {
+				return *value.NewNoneOption(), true
+			}
+
+			webhookContext := self.context.(types.ExecutionContextWebhook)
+
+			headers := make(map[string]*value.Value)
+			for key, val := range webhookContext.Request.Headers {
+				headers[key] = value.NewValueString(val)
+			}
+
+			query := make(map[string]*value.Value)
+			for key, val := range webhookContext.Request.Query {
+				query[key] = value.NewValueString(val)
+			}
+
+			return *value.NewValueOption(value.NewValueObject(map[string]*value.Value{
+				"webhook_id": value.NewValueString(webhookContext.WebhookID),
+				"method":     value.NewValueString(webhookContext.Request.Method),
+				"headers":    value.NewValueAnyObject(headers),
+				"query":      value.NewValueAnyObject(query),
+				"body":       value.NewValueString(webhookContext.Request.Body),
+			})), true
 
 		}
 	case "scheduler":
@@ -847,6 +910,8 @@ func (self InterpreterExecutor) GetBuiltinImport(
 			// ast.NewObjectTypeField(pAst.NewSpannedIdent("minute", span), ast.NewIntType(span), span),
 			// ast.NewObjectTypeField(pAst.NewSpannedIdent("target_mode", span), ast.NewStringType(span), span),
 		}
+	case "camera":
+		return self.getCameraImport(toImport)
 	case "notification":
 		switch toImport {
 		case "notify":
@@ -863,19 +928,12 @@ func (self InterpreterExecutor) GetBuiltinImport(
 				description := args[1].(value.ValueString).Inner
 				level := args[2].(value.ValueInt).Inner
 
-				hmsExecutor := executor.(InterpreterExecutor)
-
-				// Only run notification hooks if this homescript was NOT triggered due to a notification
-				// this avoids unconditional recursion and thus prevents a crash.
-				runHooks := hmsExecutor.context.Kind() != types.HMS_PROGRAM_KIND_AUTOMATION ||
-					hmsExecutor.context.(types.ExecutionContextAutomation).Inner.NotificationContext == nil
-
 				newId, err := notify.Manager.Notify(
 					*self.context.Username(),
 					title,
 					description,
 					notify.NotificationLevel(level),
-					runHooks,
+					executor.(InterpreterExecutor).notificationHooksAllowed(),
 				)
 
 				if err != nil {
@@ -909,12 +967,26 @@ func (self InterpreterExecutor) getArgs() map[string]*value.Value {
 
 // returns the Homescript code of the requested module
 func (self InterpreterExecutor) ResolveModuleCode(moduleName string) (code string, found bool, err error) {
-	return "", false, nil
+	username := self.context.Username()
+	if username == nil {
+		return "", false, nil
+	}
+
+	script, found, err := database.GetPersonalHomescriptById(moduleName, *username)
+	if err != nil {
+		return "", false, err
+	}
+	if found {
+		return script.Data.Code, true, nil
+	}
+
+	// Fall back to libraries which are shared with the user.
+	return database.ResolveHomescriptLibraryCode(moduleName, *username)
 }
 
 // Writes the given string (produced by a print function for instance) to any arbitrary source
 func (self InterpreterExecutor) WriteStringTo(input string) error {
-	self.ioWriter.Write([]byte(input))
+	self.ioWriter.Write([]byte(self.secrets.redact(input)))
 	return nil
 }
 
@@ -0,0 +1,206 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/smarthome-go/smarthome/core/user/notify"
+	"github.com/smarthome-go/smarthome/services/camera"
+)
+
+// The timeout for fetching a single frame from a camera.
+const cameraFetchTimeoutSecs = 20
+
+// Only run notification hooks if this program was NOT triggered due to a notification.
+// This avoids unconditional recursion and thus prevents a crash.
+func (self InterpreterExecutor) notificationHooksAllowed() bool {
+	return self.context.Kind() != types.HMS_PROGRAM_KIND_AUTOMATION ||
+		self.context.(types.ExecutionContextAutomation).Inner.NotificationContext == nil
+}
+
+// Validates that the user may view the camera and fetches its current frame.
+func (self InterpreterExecutor) fetchCameraFrame(span errors.Span, cameraID string) ([]byte, *value.VmInterrupt) {
+	username := *self.context.Username()
+
+	hasPermission, err := database.UserHasPermission(username, database.PermissionViewCameras)
+	if err == nil && hasPermission {
+		hasPermission, err = database.UserHasCameraPermission(username, cameraID)
+	}
+	if err != nil {
+		return nil, value.NewVMFatalException(
+			fmt.Sprintf("Could not check camera permission: %s", err.Error()),
+			value.Vm_HostErrorKind,
+			span,
+		)
+	}
+
+	_, found, err := database.GetCameraById(cameraID)
+	if err != nil {
+		return nil, value.NewVMFatalException(
+			fmt.Sprintf("Could not get camera: %s", err.Error()),
+			value.Vm_HostErrorKind,
+			span,
+		)
+	}
+
+	// Cameras which the user may not view are treated as if they did not exist.
+	if !found || !hasPermission {
+		return nil, value.NewVMThrowInterrupt(
+			span,
+			fmt.Sprintf("No such camera: `%s`", cameraID),
+		)
+	}
+
+	frame, err := camera.GetCameraFeed(cameraID, cameraFetchTimeoutSecs)
+	if err != nil {
+		return nil, value.NewVMThrowInterrupt(
+			span,
+			fmt.Sprintf("Could not fetch frame of camera `%s`: %s", cameraID, err.Error()),
+		)
+	}
+
+	return frame, nil
+}
+
+// Creates a builtin function which requires a user context and fetches the frame of the camera passed as the first argument.
+func (self InterpreterExecutor) cameraFrameBuiltin(
+	handler func(span errors.Span, cameraID string, frame []byte, args ...value.Value) (*value.Value, *value.VmInterrupt),
+) value.Value {
+	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		if self.context.Username() == nil {
+			return nil, value.NewVMFatalException(
+				"The usage of this function in a non-user environment is not possible",
+				value.Vm_HostErrorKind,
+				span,
+			)
+		}
+
+		cameraID := args[0].(value.ValueString).Inner
+
+		frame, i := self.fetchCameraFrame(span, cameraID)
+		if i != nil {
+			return nil, i
+		}
+
+		return handler(span, cameraID, frame, args[1:]...)
+	})
+}
+
+func (self InterpreterExecutor) saveSnapshot(span errors.Span, cameraID string, frame []byte, notificationID *uint) (*value.Value, *value.VmInterrupt) {
+	snapshotID, err := database.InsertCameraSnapshot(
+		*self.context.Username(),
+		cameraID,
+		notificationID,
+		http.DetectContentType(frame),
+		frame,
+	)
+	if err != nil {
+		return nil, value.NewVMFatalException(
+			fmt.Sprintf("Could not save snapshot: %s", err.Error()),
+			value.Vm_HostErrorKind,
+			span,
+		)
+	}
+
+	return value.NewValueInt(int64(snapshotID)), nil
+}
+
+func (self InterpreterExecutor) getCameraImport(toImport string) (val value.Value, found bool) {
+	switch toImport {
+	case "list_cameras":
+		return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			if self.context.Username() == nil {
+				return nil, value.NewVMFatalException(
+					"The usage of this function in a non-user environment is not possible",
+					value.Vm_HostErrorKind,
+					span,
+				)
+			}
+
+			list := make([]*value.Value, 0)
+
+			hasPermission, err := database.UserHasPermission(*self.context.Username(), database.PermissionViewCameras)
+			if err != nil {
+				return nil, value.NewVMFatalException(
+					fmt.Sprintf("Could not list cameras: %s", err.Error()),
+					value.Vm_HostErrorKind,
+					span,
+				)
+			}
+
+			if !hasPermission {
+				return value.NewValueList(list), nil
+			}
+
+			cameras, err := database.ListUserCameras(*self.context.Username())
+			if err != nil {
+				return nil, value.NewVMFatalException(
+					fmt.Sprintf("Could not list cameras: %s", err.Error()),
+					value.Vm_HostErrorKind,
+					span,
+				)
+			}
+
+			for _, cam := range cameras {
+				list = append(list, value.NewValueObject(map[string]*value.Value{
+					"id":      value.NewValueString(cam.ID),
+					"name":    value.NewValueString(cam.Name),
+					"room_id": value.NewValueString(cam.RoomID),
+				}))
+			}
+
+			return value.NewValueList(list), nil
+		}), true
+	case "save_snapshot":
+		return self.cameraFrameBuiltin(func(span errors.Span, cameraID string, frame []byte, _ ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return self.saveSnapshot(span, cameraID, frame, nil)
+		}), true
+	case "notify_snapshot":
+		return self.cameraFrameBuiltin(func(span errors.Span, cameraID string, frame []byte, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			title := args[0].(value.ValueString).Inner
+			description := args[1].(value.ValueString).Inner
+			level := args[2].(value.ValueInt).Inner
+
+			notificationID, err := notify.Manager.Notify(
+				*self.context.Username(),
+				title,
+				description,
+				notify.NotificationLevel(level),
+				self.notificationHooksAllowed(),
+			)
+			if err != nil {
+				return nil, value.NewVMFatalException(
+					fmt.Sprintf("Could not add notification: %s", err.Error()),
+					value.Vm_HostErrorKind,
+					span,
+				)
+			}
+
+			if _, i := self.saveSnapshot(span, cameraID, frame, &notificationID); i != nil {
+				return nil, i
+			}
+
+			return value.NewValueInt(int64(notificationID)), nil
+		}), true
+	case "frame_difference":
+		return self.cameraFrameBuiltin(func(span errors.Span, cameraID string, frame []byte, _ ...value.Value) (*value.Value, *value.VmInterrupt) {
+			score, hasPrevious, err := camera.CompareWithPreviousFrame(*self.context.Username(), cameraID, frame)
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, err.Error())
+			}
+
+			if !hasPrevious {
+				return value.NewNoneOption(), nil
+			}
+
+			return value.NewValueOption(value.NewValueFloat(score)), nil
+		}), true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,277 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// Returns all devices which the executing user may access.
+// Programs without a user context (for instance drivers) can access every device.
+func (self InterpreterExecutor) accessibleDevices() ([]database.ShallowDevice, error) {
+	if self.context.Username() == nil {
+		return driver.Manager.ListAllDevicesShallow()
+	}
+	return driver.Manager.ListPersonalDevicesShallow(*self.context.Username())
+}
+
+func (self InterpreterExecutor) canAccessDevice(deviceID string) (bool, error) {
+	if self.context.Username() == nil {
+		return true, nil
+	}
+	return database.UserHasDevicePermission(*self.context.Username(), deviceID)
+}
+
+func deviceInfoValue(device database.ShallowDevice, capabilities driver.CapabilitySet[driver.DeviceCapability]) *value.Value {
+	capabilityList := make([]*value.Value, len(capabilities))
+	for idx, capability := range capabilities {
+		capabilityList[idx] = value.NewValueString(string(capability))
+	}
+
+	return value.NewValueObject(map[string]*value.Value{
+		"id":           value.NewValueString(device.ID),
+		"name":         value.NewValueString(device.Name),
+		"room_id":      value.NewValueString(device.RoomID),
+		"vendor_id":    value.NewValueString(device.VendorID),
+		"model_id":     value.NewValueString(device.ModelID),
+		"capabilities": value.NewValueList(capabilityList),
+	})
+}
+
+// Creates a builtin function which lists all accessible devices matching the filter.
+// The filter receives the arguments of the function call.
+func (self InterpreterExecutor) deviceListBuiltin(
+	filter func(device database.ShallowDevice, capabilities driver.CapabilitySet[driver.DeviceCapability], args ...value.Value) bool,
+) value.Value {
+	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		devices, err := self.accessibleDevices()
+		if err != nil {
+			return nil, value.NewVMFatalException(
+				fmt.Sprintf("Could not list devices: %s", err.Error()),
+				value.Vm_HostErrorKind,
+				span,
+			)
+		}
+
+		list := make([]*value.Value, 0)
+		for _, device := range devices {
+			capabilities, err := driver.Manager.DeviceCapabilities(device)
+			if err != nil {
+				return nil, value.NewVMFatalException(
+					fmt.Sprintf("Could not list devices: %s", err.Error()),
+					value.Vm_HostErrorKind,
+					span,
+				)
+			}
+
+			if filter(device, capabilities, args...) {
+				list = append(list, deviceInfoValue(device, capabilities))
+			}
+		}
+
+		return value.NewValueList(list), nil
+	})
+}
+
+// Creates a builtin function which invokes a report function of the driver of a device.
+// Devices which the user may not access are treated as if they did not exist.
+func deviceReportBuiltin[T any](
+	self InterpreterExecutor,
+	capability driver.DeviceCapability,
+	report func(deviceID string) (T, bool, bool, *types.HmsError, error),
+	convert func(output T) *value.Value,
+) value.Value {
+	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		deviceID := args[0].(value.ValueString).Inner
+
+		hasPermission, err := self.canAccessDevice(deviceID)
+		if err != nil {
+			return nil, value.NewVMFatalException(
+				fmt.Sprintf("Could not check device permission: %s", err.Error()),
+				value.Vm_HostErrorKind,
+				span,
+			)
+		}
+
+		if !hasPermission {
+			return nil, value.NewVMThrowInterrupt(
+				span,
+				fmt.Sprintf("No such device: `%s`", deviceID),
+			)
+		}
+
+		output, deviceFound, supported, hmsErr, err := report(deviceID)
+		if err != nil {
+			return nil, value.NewVMFatalException(
+				fmt.Sprintf("Backend failure during device report: %s", err.Error()),
+				value.Vm_HostErrorKind,
+				span,
+			)
+		}
+
+		if !deviceFound {
+			return nil, value.NewVMThrowInterrupt(
+				span,
+				fmt.Sprintf("No such device: `%s`", deviceID),
+			)
+		}
+
+		if !supported {
+			return nil, value.NewVMThrowInterrupt(
+				span,
+				fmt.Sprintf("Device `%s` does not support the `%s` capability", deviceID, capability),
+			)
+		}
+
+		if hmsErr != nil {
+			return nil, value.NewVMThrowInterrupt(
+				span,
+				fmt.Sprintf("Device malfunction: %s", hmsErr.String()),
+			)
+		}
+
+		return convert(output), nil
+	})
+}
+
+// Sensor readings are marshaled by the driver, this restores their Homescript representation.
+func sensorValue(marshaled any) *value.Value {
+	switch inner := marshaled.(type) {
+	case int64:
+		return value.NewValueInt(inner)
+	case int:
+		return value.NewValueInt(int64(inner))
+	case float64:
+		return value.NewValueFloat(inner)
+	case bool:
+		return value.NewValueBool(inner)
+	case string:
+		return value.NewValueString(inner)
+	case nil:
+		return value.NewValueNull()
+	default:
+		return value.NewValueString(fmt.Sprint(inner))
+	}
+}
+
+func (self InterpreterExecutor) getDeviceQueryImport(toImport string) (val value.Value, found bool) {
+	switch toImport {
+	case "list_devices":
+		return self.deviceListBuiltin(func(_ database.ShallowDevice, _ driver.CapabilitySet[driver.DeviceCapability], _ ...value.Value) bool {
+			return true
+		}), true
+	case "list_room_devices":
+		return self.deviceListBuiltin(func(device database.ShallowDevice, _ driver.CapabilitySet[driver.DeviceCapability], args ...value.Value) bool {
+			return device.RoomID == args[0].(value.ValueString).Inner
+		}), true
+	case "list_capability_devices":
+		return self.deviceListBuiltin(func(_ database.ShallowDevice, capabilities driver.CapabilitySet[driver.DeviceCapability], args ...value.Value) bool {
+			return capabilities.Has(driver.DeviceCapability(args[0].(value.ValueString).Inner))
+		}), true
+	case "list_driver_devices":
+		return self.deviceListBuiltin(func(device database.ShallowDevice, _ driver.CapabilitySet[driver.DeviceCapability], args ...value.Value) bool {
+			return device.VendorID == args[0].(value.ValueString).Inner && device.ModelID == args[1].(value.ValueString).Inner
+		}), true
+	case "get_device":
+		return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			deviceID := args[0].(value.ValueString).Inner
+
+			hasPermission, err := self.canAccessDevice(deviceID)
+			if err != nil {
+				return nil, value.NewVMFatalException(
+					fmt.Sprintf("Could not check device permission: %s", err.Error()),
+					value.Vm_HostErrorKind,
+					span,
+				)
+			}
+
+			if !hasPermission {
+				return value.NewNoneOption(), nil
+			}
+
+			device, found, err := database.GetDeviceById(deviceID)
+			if err != nil {
+				return nil, value.NewVMFatalException(
+					fmt.Sprintf("Could not get device: %s", err.Error()),
+					value.Vm_HostErrorKind,
+					span,
+				)
+			}
+
+			if !found {
+				return value.NewNoneOption(), nil
+			}
+
+			capabilities, err := driver.Manager.DeviceCapabilities(device)
+			if err != nil {
+				return nil, value.NewVMFatalException(
+					fmt.Sprintf("Could not get device: %s", err.Error()),
+					value.Vm_HostErrorKind,
+					span,
+				)
+			}
+
+			return value.NewValueOption(deviceInfoValue(device, capabilities)), nil
+		}), true
+	case "power_state":
+		return deviceReportBuiltin(
+			self,
+			driver.DeviceCapabilityPower,
+			driver.Manager.ReportDevicePowerState,
+			func(output driver.DriverActionGetPowerStateOutput) *value.Value {
+				return value.NewValueBool(output.State)
+			},
+		), true
+	case "power_draw":
+		return deviceReportBuiltin(
+			self,
+			driver.DeviceCapabilityPower,
+			driver.Manager.ReportDevicePowerDraw,
+			func(output driver.DriverActionGetPowerDrawOutput) *value.Value {
+				return value.NewValueInt(int64(output.Watts))
+			},
+		), true
+	case "dim_levels":
+		return deviceReportBuiltin(
+			self,
+			driver.DeviceCapabilityDimmable,
+			driver.Manager.ReportDeviceDimmables,
+			func(output []driver.DriverActionReportDimOutput) *value.Value {
+				list := make([]*value.Value, len(output))
+				for idx, dimmable := range output {
+					list[idx] = value.NewValueObject(map[string]*value.Value{
+						"label": value.NewValueString(dimmable.Label),
+						"value": value.NewValueInt(dimmable.Value),
+						"lower": value.NewValueInt(dimmable.Range.Lower),
+						"upper": value.NewValueInt(dimmable.Range.Upper),
+					})
+				}
+				return value.NewValueList(list)
+			},
+		), true
+	case "sensor_readings":
+		return deviceReportBuiltin(
+			self,
+			driver.DeviceCapabilitySensor,
+			driver.Manager.ReportDeviceSensors,
+			func(output []driver.DriverActionReportSensorReadingsOutput) *value.Value {
+				list := make([]*value.Value, len(output))
+				for idx, reading := range output {
+					list[idx] = value.NewValueObject(map[string]*value.Value{
+						"label": value.NewValueString(reading.Label),
+						"value": sensorValue(reading.Value),
+						"unit":  value.NewValueString(reading.Unit),
+					})
+				}
+				return value.NewValueList(list)
+			},
+		), true
+	}
+
+	return nil, false
+}
@@ -25,9 +25,20 @@ func (self InterpreterExecutor) RegisterTrigger(
 			callbackFunctionIdentMangled,
 			nil,
 			self.ProgramID,
+			types.DefaultMqttBroker,
 			args,
 			self.context,
 		)
+	case hmsTypes.TriggerMqttBrokerMessageIdent:
+		// The broker is the first argument, the topics follow.
+		registrationID, err = registerTriggerMessage(
+			callbackFunctionIdentMangled,
+			nil,
+			self.ProgramID,
+			args[0].(value.ValueString).Inner,
+			args[1:],
+			self.context,
+		)
 	case hmsTypes.TriggerMinuteIdent:
 		registrationID, err = registerTriggerMinute(
 			callbackFunctionIdentMangled,
@@ -36,6 +47,14 @@ func (self InterpreterExecutor) RegisterTrigger(
 			args,
 			self.context,
 		)
+	case hmsTypes.TriggerCronIdent, hmsTypes.TriggerSunriseIdent, hmsTypes.TriggerSunsetIdent, hmsTypes.TriggerAtIdent:
+		registrationID, err = registerTriggerTime(
+			callbackFunctionIdentMangled,
+			eventTriggerIdent,
+			self.ProgramID,
+			self.jobID,
+			args,
+		)
 	case hmsTypes.TriggerKillIdent:
 		self.registerTriggerKill(callbackFunctionIdentMangled)
 	case hmsTypes.TriggerDeviceEvent:
@@ -187,6 +206,7 @@ func registerTriggerMessage(
 	callbackFunctionIdentMangled string,
 	callmodeOverride *types.CallMode,
 	programID string,
+	broker string,
 	args []value.Value,
 	context hmsTypes.ExecutionContext,
 ) (types.RegistrationID, error) {
@@ -216,7 +236,10 @@ func registerTriggerMessage(
 				CallMode:       callMode,
 				// TODO: this is broken?
 			},
-			Trigger: nil,
+			Trigger: types.CallBackTriggerMqtt{
+				Broker: broker,
+				Topics: topicsStrList,
+			},
 		},
 		// TODO: maybe make this a `toleranceFunc` to only retry on specific failures
 		types.ToleranceRetry,
@@ -289,3 +312,41 @@ func registerTriggerMinute(
 
 	return id, nil
 }
+
+// Registers one of the repeating time triggers (`cron`, `sunrise`, `sunset` and `at`).
+// If used via `on` / `at`, the callback is bound to the lifetime of the current job.
+func registerTriggerTime(
+	callbackFunctionIdentMangled string,
+	triggerIdent string,
+	programID string,
+	jobID uint64,
+	args []value.Value,
+) (types.RegistrationID, error) {
+	trigger, err := dispatcher.TimeTriggerFromArgs(triggerIdent, args)
+	if err != nil {
+		return 0, err
+	}
+
+	callmode := types.CallMode(types.CallModeAttaching{
+		HMSJobID: jobID,
+	})
+
+	id, err := dispatcher.Instance.Register(
+		types.RegisterInfo{
+			ProgramID: programID,
+			Function: &types.CalledFunction{
+				Ident:          callbackFunctionIdentMangled,
+				IdentIsLiteral: true,
+				CallMode:       callmode,
+			},
+			Trigger: trigger,
+		},
+		types.ToleranceRetry,
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -40,6 +40,12 @@ type InterpreterExecutor struct {
 	stdin *types.StdinBuffer
 
 	manager types.Manager
+
+	// If this is not <nil>, side-effect modules are mocked (test execution).
+	mocks *types.TestMocks
+
+	// Secret values which were read by the program, these are removed from its output.
+	secrets *secretRedactor
 }
 
 func (self InterpreterExecutor) Free() error {
@@ -68,6 +74,7 @@ func NewInterpreterExecutor(
 	context types.ExecutionContext,
 	stdin *types.StdinBuffer,
 	mananger types.Manager,
+	mocks *types.TestMocks,
 ) InterpreterExecutor {
 	registrations := make([]dispatcherT.RegistrationID, 0)
 	onKillCallbackFuncs := make([]string, 0)
@@ -87,6 +94,8 @@ func NewInterpreterExecutor(
 		OnKillCallbackFuncs: &onKillCallbackFuncs,
 		stdin:               stdin,
 		manager:             mananger,
+		mocks:               mocks,
+		secrets:             newSecretRedactor(),
 	}
 }
 
@@ -175,7 +184,8 @@ func (self InterpreterExecutor) execBuiltin(usernameNeedsToBeSpecified bool, man
 
 		switch usernameNeedsToBeSpecified {
 		case true:
-			if self.context.Kind() == types.HMS_PROGRAM_KIND_USER {
+			// Webhooks are triggered by external systems, therefore they must not impersonate other users.
+			if self.context.Kind() == types.HMS_PROGRAM_KIND_USER || self.context.Kind() == types.HMS_PROGRAM_KIND_WEBHOOK {
 				return nil, value.NewVMFatalException(
 					fmt.Sprintf("The usage of the `%s` function in a user environment is not allowed", execUserFnIdent),
 					value.Vm_HostErrorKind,
@@ -0,0 +1,145 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+)
+
+// Creates a builtin function which only records its invocation and returns a fixed value.
+func (self InterpreterExecutor) mockRecorder(moduleName, functionName string, ret func() *value.Value) value.Value {
+	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		displayed := make([]string, len(args))
+		for idx, arg := range args {
+			disp, i := arg.Display()
+			if i != nil {
+				return nil, i
+			}
+			displayed[idx] = disp
+		}
+
+		self.mocks.RecordCall(moduleName, functionName, displayed)
+
+		return ret(), nil
+	})
+}
+
+// Returns the mocked version of a builtin value if the module is replaced during test execution.
+// These mocks never cause any side-effects, they only record the calls made to them.
+func (self InterpreterExecutor) getMockedImport(moduleName string, toImport string) (val value.Value, found bool) {
+	switch moduleName {
+	case "device":
+		switch toImport {
+		case "emit":
+			return self.mockRecorder(moduleName, toImport, value.NewValueNull), true
+		case "set_power":
+			return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+				deviceID := args[0].(value.ValueString).Inner
+				on := args[1].(value.ValueBool).Inner
+
+				self.mocks.RecordCall(moduleName, toImport, []string{deviceID, fmt.Sprint(on)})
+				self.mocks.SetPowerState(deviceID, on)
+
+				return value.NewValueBool(true), nil
+			}), true
+		case "dim":
+			return self.mockRecorder(moduleName, toImport, func() *value.Value {
+				return value.NewValueBool(true)
+			}), true
+		// Queries must not depend on the real devices, the mocked device module contains no devices.
+		case "list_devices", "list_room_devices", "list_capability_devices", "list_driver_devices", "dim_levels", "sensor_readings":
+			return self.mockRecorder(moduleName, toImport, func() *value.Value {
+				return value.NewValueList(make([]*value.Value, 0))
+			}), true
+		case "get_device":
+			return self.mockRecorder(moduleName, toImport, value.NewNoneOption), true
+		case "power_state":
+			return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+				deviceID := args[0].(value.ValueString).Inner
+				self.mocks.RecordCall(moduleName, toImport, []string{deviceID})
+
+				// Reflects the mocked `set_power` calls of the test.
+				return value.NewValueBool(self.mocks.PowerState(deviceID)), nil
+			}), true
+		case "power_draw":
+			return self.mockRecorder(moduleName, toImport, func() *value.Value {
+				return value.NewValueInt(0)
+			}), true
+		}
+	case "mqtt":
+		switch toImport {
+		case "subscribe", "subscribe_to":
+			if self.mocks.IsSimulation() {
+				return self.mockMqttSubscribe(toImport == "subscribe_to"), true
+			}
+			return self.mockRecorder(moduleName, toImport, value.NewValueNull), true
+		case "publish", "publish_to":
+			if self.mocks.IsSimulation() {
+				return self.mockMqttPublish(toImport == "publish_to"), true
+			}
+			return self.mockRecorder(moduleName, toImport, value.NewValueNull), true
+		}
+	case "camera":
+		switch toImport {
+		case "save_snapshot", "notify_snapshot":
+			return self.mockRecorder(moduleName, toImport, func() *value.Value {
+				return value.NewValueInt(int64(self.mocks.CallCount(moduleName, toImport)))
+			}), true
+		case "frame_difference":
+			return self.mockRecorder(moduleName, toImport, value.NewNoneOption), true
+		}
+	case "net":
+		switch toImport {
+		case "wake_on_lan", "tcp_send", "udp_send":
+			return self.mockRecorder(moduleName, toImport, value.NewValueNull), true
+		case "http":
+			if self.mocks.IsSimulation() {
+				return self.mockHttp(), true
+			}
+		case "tcp_request":
+			return self.mockRecorder(moduleName, toImport, func() *value.Value {
+				return value.NewValueString("")
+			}), true
+		}
+	case "notification":
+		switch toImport {
+		case "notify":
+			return self.mockRecorder(moduleName, toImport, func() *value.Value {
+				// Use the amount of recorded notifications as the ID of the new notification.
+				return value.NewValueInt(int64(self.mocks.CallCount(moduleName, toImport)))
+			}), true
+		}
+	case "storage":
+		switch toImport {
+		case "set_storage":
+			return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+				key := args[0].(value.ValueString).Inner
+				disp, i := args[1].Display()
+				if i != nil {
+					return nil, i
+				}
+
+				self.mocks.RecordCall(moduleName, toImport, []string{key, disp})
+				self.mocks.SetStorage(key, disp)
+
+				return value.NewValueNull(), nil
+			}), true
+		case "get_storage":
+			return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+				key := args[0].(value.ValueString).Inner
+
+				self.mocks.RecordCall(moduleName, toImport, []string{key})
+
+				if val, found := self.mocks.GetStorage(key); found {
+					return value.NewValueOption(value.NewValueString(val)), nil
+				}
+
+				return value.NewNoneOption(), nil
+			}), true
+		}
+	}
+
+	return nil, false
+}
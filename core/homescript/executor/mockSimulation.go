@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+//
+// During driver simulations, the network modules are served by scripted responses instead of real hardware.
+//
+
+func (self InterpreterExecutor) fakeHttpRequest(method, url string, span errors.Span) (*value.Value, *value.VmInterrupt) {
+	self.mocks.RecordCall("net", "http", []string{method, url})
+
+	response, found := self.mocks.MatchHttpResponse(method, url)
+	if !found {
+		return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("No scripted response for %s request to `%s`", method, url))
+	}
+
+	return value.NewValueObject(map[string]*value.Value{
+		"status":      value.NewValueString(fmt.Sprintf("%d %s", response.StatusCode, http.StatusText(response.StatusCode))),
+		"status_code": value.NewValueInt(int64(response.StatusCode)),
+		"body":        value.NewValueString(response.Body),
+		"cookies":     value.NewValueAnyObject(make(map[string]*value.Value)),
+	}), nil
+}
+
+func (self InterpreterExecutor) mockHttp() value.Value {
+	return *value.NewValueObject(map[string]*value.Value{
+		"get": value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return self.fakeHttpRequest(http.MethodGet, args[0].(value.ValueString).Inner, span)
+		}),
+		"generic": value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return self.fakeHttpRequest(args[1].(value.ValueString).Inner, args[0].(value.ValueString).Inner, span)
+		}),
+	})
+}
+
+// Simulations have a single, scripted network, therefore, the broker only shows up in the recorded call.
+func (self InterpreterExecutor) mockMqttSubscribe(withBroker bool) value.Value {
+	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		broker, args := mqttBrokerArg(withBroker, args)
+
+		topicsRaw := *args[0].(value.ValueList).Values
+
+		topics := make([]string, len(topicsRaw))
+		for idx, v := range topicsRaw {
+			topics[idx] = (*v).(value.ValueString).Inner
+		}
+
+		fn, isFn := args[1].(value.ValueVMFunction)
+		if !isFn {
+			return nil, value.NewVMFatalException("Only named functions can be used as MQTT callbacks during simulations", value.Vm_HostErrorKind, span)
+		}
+
+		if withBroker {
+			self.mocks.RecordCall("mqtt", "subscribe_to", append([]string{broker}, topics...))
+		} else {
+			self.mocks.RecordCall("mqtt", "subscribe", topics)
+		}
+		self.mocks.AddSubscription(types.MockedSubscription{
+			Topics:   topics,
+			Function: fn.Ident,
+		})
+
+		return value.NewValueNull(), nil
+	})
+}
+
+func (self InterpreterExecutor) mockMqttPublish(withBroker bool) value.Value {
+	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		broker, args := mqttBrokerArg(withBroker, args)
+
+		topic := args[0].(value.ValueString).Inner
+		payload := args[1].(value.ValueString).Inner
+
+		if withBroker {
+			self.mocks.RecordCall("mqtt", "publish_to", []string{broker, topic, payload})
+		} else {
+			self.mocks.RecordCall("mqtt", "publish", []string{topic, payload})
+		}
+
+		if !self.mocks.PublishMqtt(topic) {
+			return nil, value.NewVMFatalException(
+				fmt.Sprintf("Too many simulated MQTT messages, at most %d may be pending", types.SimulationMaxPendingMqttMessages),
+				value.Vm_HostErrorKind,
+				span,
+			)
+		}
+
+		return value.NewValueNull(), nil
+	})
+}
@@ -10,8 +10,18 @@ import (
 	dispatcherTypes "github.com/smarthome-go/smarthome/core/homescript/dispatcher/types"
 )
 
-func mqttSubscribe() value.Value {
+// Splits off the broker argument of `subscribe_to` and `publish_to`, the other functions use the default broker.
+func mqttBrokerArg(withBroker bool, args []value.Value) (string, []value.Value) {
+	if !withBroker {
+		return dispatcherTypes.DefaultMqttBroker, args
+	}
+	return args[0].(value.ValueString).Inner, args[1:]
+}
+
+func mqttSubscribe(withBroker bool) value.Value {
 	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		broker, args := mqttBrokerArg(withBroker, args)
+
 		topicsRaw := *args[0].(value.ValueList).Values
 
 		topicsActual := make([]string, len(topicsRaw))
@@ -35,6 +45,7 @@ func mqttSubscribe() value.Value {
 					},
 				},
 				Trigger: dispatcherTypes.CallBackTriggerMqtt{
+					Broker: broker,
 					Topics: topicsActual,
 				},
 			},
@@ -51,12 +62,19 @@ func mqttSubscribe() value.Value {
 	})
 }
 
-func mqttPublish() value.Value {
+func mqttPublish(withBroker bool) value.Value {
 	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		broker, args := mqttBrokerArg(withBroker, args)
+
 		topic := args[0].(value.ValueString).Inner
 		payload := args[1].(value.ValueString).Inner
 
-		if err := dispatcher.Instance.Mqtt.Publish(topic, payload); err != nil {
+		manager, err := dispatcher.Instance.MqttBroker(broker)
+		if err != nil {
+			return nil, value.NewVMFatalException(err.Error(), value.Vm_HostErrorKind, span)
+		}
+
+		if err := manager.Publish(topic, payload); err != nil {
 			return nil, value.NewVMFatalException(fmt.Sprintf("Dispatcher registration failed: %s", err.Error()), value.Vm_HostErrorKind, span)
 		}
 
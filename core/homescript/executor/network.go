@@ -0,0 +1,230 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/stdlib"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// The maximum size of a response read by `net.tcp_request`.
+const tcpRequestMaxResponseLen = 64 * 1024
+
+// Wake-on-LAN packets are sent to the discard port via broadcast.
+const wakeOnLanAddr = "255.255.255.255:9"
+
+// Programs of users require the `hmsNetwork` permission.
+// Programs without a user context (drivers) are only limited by their allowlist.
+func (self InterpreterExecutor) checkNetworkPermission(span errors.Span, action string) *value.VmInterrupt {
+	if self.context.Username() == nil {
+		return nil
+	}
+
+	hasPermission, err := database.UserHasPermission(*self.context.Username(), database.PermissionHomescriptNetwork)
+	if err != nil {
+		return value.NewVMFatalException(
+			fmt.Sprintf("Could not %s: failed to validate your permissions: %s", action, err.Error()),
+			value.Vm_HostErrorKind,
+			span,
+		)
+	}
+
+	if !hasPermission {
+		return value.NewVMFatalException(
+			fmt.Sprintf("Will not %s: lacking permission to access the network via Homescript. If this is unintentional, contact your administrator", action),
+			value.Vm_HostErrorKind,
+			span,
+		)
+	}
+
+	return nil
+}
+
+// Returns the host allowlist of the user or driver executing this program.
+func (self InterpreterExecutor) networkAllowlist() ([]string, error) {
+	if driverCtx, isDriver := self.context.(types.ExecutionContextDriver); isDriver {
+		return database.ListDriverNetworkHosts(driverCtx.DriverVendor, driverCtx.DriverModel)
+	}
+
+	if self.context.Username() == nil {
+		return make([]string, 0), nil
+	}
+
+	return database.ListUserNetworkHosts(*self.context.Username())
+}
+
+// Checks permissions, resolves the host and validates it against the allowlist.
+// Returns the address to connect to, the host is not resolved again in order to prevent DNS rebinding.
+func (self InterpreterExecutor) resolveNetworkAddress(
+	ctx context.Context,
+	span errors.Span,
+	action string,
+	host string,
+	port int64,
+) (string, *value.VmInterrupt) {
+	if i := self.checkNetworkPermission(span, action); i != nil {
+		return "", i
+	}
+
+	if port < 1 || port > 65535 {
+		return "", value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid port: %d", port))
+	}
+
+	allowlist, err := self.networkAllowlist()
+	if err != nil {
+		return "", value.NewVMFatalException(
+			fmt.Sprintf("Could not %s: failed to load the network allowlist: %s", action, err.Error()),
+			value.Vm_HostErrorKind,
+			span,
+		)
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", value.NewVMThrowInterrupt(span, fmt.Sprintf("Could not resolve host `%s`: %s", host, err.Error()))
+	}
+
+	resolved := make([]net.IP, len(addrs))
+	for idx, addr := range addrs {
+		resolved[idx] = addr.IP
+	}
+
+	ip, allowed := stdlib.AllowedAddress(allowlist, host, resolved)
+	if !allowed {
+		return "", value.NewVMFatalException(
+			fmt.Sprintf("Will not %s: host `%s` is not on the network allowlist. If this is unintentional, contact your administrator", action, host),
+			value.Vm_HostErrorKind,
+			span,
+		)
+	}
+
+	return net.JoinHostPort(ip.String(), strconv.FormatInt(port, 10)), nil
+}
+
+func networkTimeout(span errors.Span, seconds float64) (time.Duration, *value.VmInterrupt) {
+	if seconds <= 0 || seconds > 300 {
+		return 0, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid timeout: %f seconds, expected a value between 0 and 300", seconds))
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Connects to a TCP host, writes the data and optionally reads a single line of response.
+func (self InterpreterExecutor) tcpBuiltin(readResponse bool) value.Value {
+	action := "send TCP data"
+	if readResponse {
+		action = "perform TCP request"
+	}
+
+	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		host := args[0].(value.ValueString).Inner
+		port := args[1].(value.ValueInt).Inner
+		data := args[2].(value.ValueString).Inner
+
+		timeout, i := networkTimeout(span, args[3].(value.ValueFloat).Inner)
+		if i != nil {
+			return nil, i
+		}
+
+		ctx, cancel := context.WithTimeout(*cancelCtx, timeout)
+		defer cancel()
+
+		addr, i := self.resolveNetworkAddress(ctx, span, action, host, port)
+		if i != nil {
+			return nil, i
+		}
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, value.NewVMThrowInterrupt(span, err.Error())
+		}
+		defer conn.Close()
+
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		if _, err := io.WriteString(conn, data); err != nil {
+			return nil, value.NewVMThrowInterrupt(span, err.Error())
+		}
+
+		if !readResponse {
+			return value.NewValueNull(), nil
+		}
+
+		// The response ends with the first newline or when the peer closes the connection.
+		line, err := bufio.NewReader(io.LimitReader(conn, tcpRequestMaxResponseLen)).ReadString('\n')
+		if err != nil && !(err == io.EOF && line != "") {
+			return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Could not read response: %s", err.Error()))
+		}
+
+		return value.NewValueString(strings.TrimRight(line, "\r\n")), nil
+	})
+}
+
+func (self InterpreterExecutor) getNetworkSocketImport(toImport string) (val value.Value, found bool) {
+	switch toImport {
+	case "wake_on_lan":
+		return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			if i := self.checkNetworkPermission(span, "send Wake-on-LAN packet"); i != nil {
+				return nil, i
+			}
+
+			packet, err := stdlib.MagicPacket(args[0].(value.ValueString).Inner)
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, err.Error())
+			}
+
+			conn, err := net.Dial("udp", wakeOnLanAddr)
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, err.Error())
+			}
+			defer conn.Close()
+
+			if _, err := conn.Write(packet); err != nil {
+				return nil, value.NewVMThrowInterrupt(span, err.Error())
+			}
+
+			return value.NewValueNull(), nil
+		}), true
+	case "tcp_send":
+		return self.tcpBuiltin(false), true
+	case "tcp_request":
+		return self.tcpBuiltin(true), true
+	case "udp_send":
+		return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			host := args[0].(value.ValueString).Inner
+			port := args[1].(value.ValueInt).Inner
+			data := args[2].(value.ValueString).Inner
+
+			addr, i := self.resolveNetworkAddress(*cancelCtx, span, "send UDP data", host, port)
+			if i != nil {
+				return nil, i
+			}
+
+			conn, err := net.Dial("udp", addr)
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, err.Error())
+			}
+			defer conn.Close()
+
+			if _, err := io.WriteString(conn, data); err != nil {
+				return nil, value.NewVMThrowInterrupt(span, err.Error())
+			}
+
+			return value.NewValueNull(), nil
+		}), true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,76 @@
+package executor
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// Replaces secret values in the output of a job.
+const redactedPlaceholder = "********"
+
+// Collects the secret values which were read by a program so that they can be removed from its output.
+type secretRedactor struct {
+	lock   sync.RWMutex
+	values []string
+}
+
+func newSecretRedactor() *secretRedactor {
+	return &secretRedactor{
+		lock:   sync.RWMutex{},
+		values: make([]string, 0),
+	}
+}
+
+func (self *secretRedactor) add(value string) {
+	// Empty values would match everywhere.
+	if value == "" {
+		return
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for _, existing := range self.values {
+		if existing == value {
+			return
+		}
+	}
+	self.values = append(self.values, value)
+}
+
+func (self *secretRedactor) redact(input string) string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	for _, value := range self.values {
+		input = strings.ReplaceAll(input, value, redactedPlaceholder)
+	}
+	return input
+}
+
+// Removes the secrets which the program has read so far from a string.
+func (self InterpreterExecutor) RedactSecrets(input string) string {
+	return self.secrets.redact(input)
+}
+
+// Removes the secrets which the program has read from the messages of the given errors, they are modified in place.
+func (self InterpreterExecutor) RedactErrors(errors []types.HmsError) {
+	for _, err := range errors {
+		if err.SyntaxError != nil {
+			err.SyntaxError.Message = self.secrets.redact(err.SyntaxError.Message)
+		}
+
+		if err.DiagnosticError != nil {
+			err.DiagnosticError.Message = self.secrets.redact(err.DiagnosticError.Message)
+			for idx, note := range err.DiagnosticError.Notes {
+				err.DiagnosticError.Notes[idx] = self.secrets.redact(note)
+			}
+		}
+
+		if err.RuntimeInterrupt != nil {
+			err.RuntimeInterrupt.Message = self.secrets.redact(err.RuntimeInterrupt.Message)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package executor
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/homescript/stdlib"
+)
+
+// The maximum length of strings created by `strings.repeat` and `strings.pad_start`.
+const stdlibMaxStringLen = 1 << 20
+
+type stdlibFunction func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt)
+
+// Returns a member of the standard library modules, the types are declared in `analyzer/stdlib.go`.
+// If the module is not part of the standard library, `moduleFound` is false.
+func getStdlibImport(moduleName string, toImport string) (val value.Value, moduleFound bool) {
+	switch moduleName {
+	case "json", "regex", "crypto", "strings":
+	case "math":
+		switch toImport {
+		case "pi":
+			return *value.NewValueFloat(math.Pi), true
+		case "e":
+			return *value.NewValueFloat(math.E), true
+		}
+	default:
+		return nil, false
+	}
+
+	fn, found := stdlibFunctions[moduleName][toImport]
+	if !found {
+		return nil, true
+	}
+
+	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		return fn(span, args...)
+	}), true
+}
+
+func strArg(args []value.Value, idx int) string {
+	return args[idx].(value.ValueString).Inner
+}
+
+func intArg(args []value.Value, idx int) int64 {
+	return args[idx].(value.ValueInt).Inner
+}
+
+func floatArg(args []value.Value, idx int) float64 {
+	return args[idx].(value.ValueFloat).Inner
+}
+
+func stringList(items []string) *value.Value {
+	list := make([]*value.Value, len(items))
+	for idx, item := range items {
+		list[idx] = value.NewValueString(item)
+	}
+	return value.NewValueList(list)
+}
+
+// Converts data produced by `stdlib.DecodeJSON` or `stdlib.Shape.Validate` into a Homescript value.
+// Objects which were validated against a shape become typed objects, all other objects become `any` objects.
+func jsonToValue(data any) *value.Value {
+	switch inner := data.(type) {
+	case nil:
+		return value.NewValueNull()
+	case int64:
+		return value.NewValueInt(inner)
+	case float64:
+		return value.NewValueFloat(inner)
+	case bool:
+		return value.NewValueBool(inner)
+	case string:
+		return value.NewValueString(inner)
+	case []any:
+		list := make([]*value.Value, len(inner))
+		for idx, item := range inner {
+			list[idx] = jsonToValue(item)
+		}
+		return value.NewValueList(list)
+	case stdlib.Object:
+		fields := make(map[string]*value.Value)
+		for key, field := range inner {
+			fields[key] = jsonToValue(field)
+		}
+		return value.NewValueObject(fields)
+	case map[string]any:
+		fields := make(map[string]*value.Value)
+		for key, field := range inner {
+			fields[key] = jsonToValue(field)
+		}
+		return value.NewValueAnyObject(fields)
+	case stdlib.Option:
+		if !inner.IsSome {
+			return value.NewNoneOption()
+		}
+		return value.NewValueOption(jsonToValue(inner.Inner))
+	default:
+		panic(fmt.Sprintf("Unsupported JSON data type `%T`", data))
+	}
+}
+
+// Converts a Homescript value into data which can be encoded as JSON.
+// Options are represented by their inner value or `null`.
+func valueToJSON(val value.Value) (any, error) {
+	if val.Kind() == value.NullValueKind {
+		return nil, nil
+	}
+
+	objectToJSON := func(fields map[string]*value.Value) (any, error) {
+		output := make(map[string]any)
+		for key, field := range fields {
+			converted, err := valueToJSON(*field)
+			if err != nil {
+				return nil, err
+			}
+			output[key] = converted
+		}
+		return output, nil
+	}
+
+	switch inner := val.(type) {
+	case value.ValueInt:
+		return inner.Inner, nil
+	case value.ValueFloat:
+		if math.IsNaN(inner.Inner) || math.IsInf(inner.Inner, 0) {
+			return nil, fmt.Errorf("the float `%f` cannot be represented in JSON", inner.Inner)
+		}
+		return inner.Inner, nil
+	case value.ValueBool:
+		return inner.Inner, nil
+	case value.ValueString:
+		return inner.Inner, nil
+	case value.ValueList:
+		output := make([]any, len(*inner.Values))
+		for idx, item := range *inner.Values {
+			converted, err := valueToJSON(*item)
+			if err != nil {
+				return nil, err
+			}
+			output[idx] = converted
+		}
+		return output, nil
+	case value.ValueObject:
+		return objectToJSON(inner.FieldsInternal)
+	case value.ValueAnyObject:
+		return objectToJSON(inner.FieldsInternal)
+	case value.ValueOption:
+		if inner.Inner == nil {
+			return nil, nil
+		}
+		return valueToJSON(*inner.Inner)
+	default:
+		return nil, fmt.Errorf("values of kind `%v` cannot be converted to JSON", val.Kind())
+	}
+}
+
+func stringify(indent bool) stdlibFunction {
+	return func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		data, err := valueToJSON(args[0])
+		if err != nil {
+			return nil, value.NewVMThrowInterrupt(span, err.Error())
+		}
+
+		encoded, err := stdlib.EncodeJSON(data, indent)
+		if err != nil {
+			return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Could not stringify value: %s", err.Error()))
+		}
+
+		return value.NewValueString(encoded), nil
+	}
+}
+
+func floatToInt(name string, rounded float64, span errors.Span) (*value.Value, *value.VmInterrupt) {
+	if math.IsNaN(rounded) || rounded >= math.MaxInt64 || rounded < math.MinInt64 {
+		return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("The result of `%s` does not fit into an int", name))
+	}
+	return value.NewValueInt(int64(rounded)), nil
+}
+
+var stdlibFunctions = map[string]map[string]stdlibFunction{
+	"json": {
+		"parse": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			data, err := stdlib.DecodeJSON(strArg(args, 0))
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid JSON: %s", err.Error()))
+			}
+			return jsonToValue(data), nil
+		},
+		"parse_typed": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			shape, err := stdlib.ParseShape(strArg(args, 1))
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, err.Error())
+			}
+
+			data, err := stdlib.DecodeJSON(strArg(args, 0))
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid JSON: %s", err.Error()))
+			}
+
+			validated, err := shape.Validate(data)
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("JSON does not match shape: %s", err.Error()))
+			}
+
+			return jsonToValue(validated), nil
+		},
+		"stringify":        stringify(false),
+		"stringify_pretty": stringify(true),
+	},
+	"regex": {
+		"is_match": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			_, found, err := stdlib.RegexMatch(strArg(args, 0), strArg(args, 1))
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid pattern: %s", err.Error()))
+			}
+			return value.NewValueBool(found), nil
+		},
+		"match": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			groups, found, err := stdlib.RegexMatch(strArg(args, 0), strArg(args, 1))
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid pattern: %s", err.Error()))
+			}
+			if !found {
+				return value.NewNoneOption(), nil
+			}
+			return value.NewValueOption(stringList(groups)), nil
+		},
+		"find_all": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			matches, err := stdlib.RegexFindAll(strArg(args, 0), strArg(args, 1))
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid pattern: %s", err.Error()))
+			}
+			list := make([]*value.Value, len(matches))
+			for idx, groups := range matches {
+				list[idx] = stringList(groups)
+			}
+			return value.NewValueList(list), nil
+		},
+		"replace": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			replaced, err := stdlib.RegexReplace(strArg(args, 0), strArg(args, 1), strArg(args, 2))
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid pattern: %s", err.Error()))
+			}
+			return value.NewValueString(replaced), nil
+		},
+	},
+	"crypto": {
+		"sha256": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueString(stdlib.SHA256Hex(strArg(args, 0))), nil
+		},
+		"hmac_sha256": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueString(stdlib.HMACSHA256Hex(strArg(args, 0), strArg(args, 1))), nil
+		},
+		"base64_encode": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueString(base64.StdEncoding.EncodeToString([]byte(strArg(args, 0)))), nil
+		},
+		"base64_decode": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			decoded, err := base64.StdEncoding.DecodeString(strArg(args, 0))
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid base64: %s", err.Error()))
+			}
+			return value.NewValueString(string(decoded)), nil
+		},
+		"uuid": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			uuid, err := stdlib.NewUUID()
+			if err != nil {
+				return nil, value.NewVMFatalException(
+					fmt.Sprintf("Could not generate UUID: %s", err.Error()),
+					value.Vm_HostErrorKind,
+					span,
+				)
+			}
+			return value.NewValueString(uuid), nil
+		},
+	},
+	"strings": {
+		"split": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return stringList(strings.Split(strArg(args, 0), strArg(args, 1))), nil
+		},
+		"join": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			items := *args[0].(value.ValueList).Values
+			parts := make([]string, len(items))
+			for idx, item := range items {
+				parts[idx] = (*item).(value.ValueString).Inner
+			}
+			return value.NewValueString(strings.Join(parts, strArg(args, 1))), nil
+		},
+		"trim": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueString(strings.TrimSpace(strArg(args, 0))), nil
+		},
+		"to_upper": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueString(strings.ToUpper(strArg(args, 0))), nil
+		},
+		"to_lower": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueString(strings.ToLower(strArg(args, 0))), nil
+		},
+		"contains": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueBool(strings.Contains(strArg(args, 0), strArg(args, 1))), nil
+		},
+		"starts_with": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueBool(strings.HasPrefix(strArg(args, 0), strArg(args, 1))), nil
+		},
+		"ends_with": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueBool(strings.HasSuffix(strArg(args, 0), strArg(args, 1))), nil
+		},
+		// Returns the index in characters (not bytes) or -1 if the text does not contain the search string.
+		"index_of": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			text := strArg(args, 0)
+			idx := strings.Index(text, strArg(args, 1))
+			if idx < 0 {
+				return value.NewValueInt(-1), nil
+			}
+			return value.NewValueInt(int64(utf8.RuneCountInString(text[:idx]))), nil
+		},
+		"replace": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueString(strings.ReplaceAll(strArg(args, 0), strArg(args, 1), strArg(args, 2))), nil
+		},
+		"repeat": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			text := strArg(args, 0)
+			count := intArg(args, 1)
+			if count < 0 || (len(text) > 0 && count > int64(stdlibMaxStringLen/len(text))) {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid repeat count: %d", count))
+			}
+			return value.NewValueString(strings.Repeat(text, int(count))), nil
+		},
+		"pad_start": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			text := strArg(args, 0)
+			width := intArg(args, 1)
+			fill := strArg(args, 2)
+			if utf8.RuneCountInString(fill) != 1 {
+				return nil, value.NewVMThrowInterrupt(span, "The fill string must consist of exactly one character")
+			}
+			if width > stdlibMaxStringLen {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid width: %d", width))
+			}
+			missing := int(width) - utf8.RuneCountInString(text)
+			if missing <= 0 {
+				return value.NewValueString(text), nil
+			}
+			return value.NewValueString(strings.Repeat(fill, missing) + text), nil
+		},
+	},
+	"math": {
+		"abs": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueFloat(math.Abs(floatArg(args, 0))), nil
+		},
+		"floor": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return floatToInt("floor", math.Floor(floatArg(args, 0)), span)
+		},
+		"ceil": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return floatToInt("ceil", math.Ceil(floatArg(args, 0)), span)
+		},
+		"round": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return floatToInt("round", math.Round(floatArg(args, 0)), span)
+		},
+		"sqrt": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			x := floatArg(args, 0)
+			if x < 0 {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Cannot calculate the square root of a negative number: %f", x))
+			}
+			return value.NewValueFloat(math.Sqrt(x)), nil
+		},
+		"pow": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueFloat(math.Pow(floatArg(args, 0), floatArg(args, 1))), nil
+		},
+		"min": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueFloat(math.Min(floatArg(args, 0), floatArg(args, 1))), nil
+		},
+		"max": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueFloat(math.Max(floatArg(args, 0), floatArg(args, 1))), nil
+		},
+		"clamp": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			x, lower, upper := floatArg(args, 0), floatArg(args, 1), floatArg(args, 2)
+			if lower > upper {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("Invalid range: lower bound %f is greater than upper bound %f", lower, upper))
+			}
+			return value.NewValueFloat(math.Max(lower, math.Min(upper, x))), nil
+		},
+		"random": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return value.NewValueFloat(rand.Float64()), nil
+		},
+		// The lower bound is inclusive, the upper bound is exclusive.
+		"random_int": func(span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			random, err := stdlib.RandomInt(intArg(args, 0), intArg(args, 1))
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, err.Error())
+			}
+			return value.NewValueInt(random), nil
+		},
+	},
+}
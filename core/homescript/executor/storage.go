@@ -0,0 +1,331 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// Persists the entries of the typed storage, entries are encoded as tagged JSON (see `types.EncodeStoredValue`).
+// During test execution, the database is replaced by the test mocks.
+type storeBackend interface {
+	get(namespace, key string) (*string, error)
+	set(namespace, key, value string, ttlSeconds *int64) error
+	delete(namespace, key string) (bool, error)
+	update(namespace, key string, update func(current *string) (*string, error)) error
+	keys(namespace, prefix string) ([]string, error)
+}
+
+type databaseStoreBackend struct {
+	username string
+}
+
+func (self databaseStoreBackend) get(namespace, key string) (*string, error) {
+	entry, found, err := database.GetHomescriptStorageEntry(self.username, namespace, key)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &entry.Value, nil
+}
+
+func (self databaseStoreBackend) set(namespace, key, value string, ttlSeconds *int64) error {
+	return database.SetHomescriptStorageEntry(self.username, namespace, key, value, ttlSeconds)
+}
+
+func (self databaseStoreBackend) delete(namespace, key string) (bool, error) {
+	return database.DeleteHomescriptStorageEntry(self.username, namespace, key)
+}
+
+func (self databaseStoreBackend) update(namespace, key string, update func(current *string) (*string, error)) error {
+	return database.UpdateHomescriptStorageEntry(self.username, namespace, key, update)
+}
+
+func (self databaseStoreBackend) keys(namespace, prefix string) ([]string, error) {
+	entries, err := database.ListHomescriptStorageEntries(self.username, namespace, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(entries))
+	for idx, entry := range entries {
+		keys[idx] = entry.Key
+	}
+	return keys, nil
+}
+
+// Mocked entries never expire as tests are short-lived.
+type mockStoreBackend struct {
+	mocks *types.TestMocks
+}
+
+func (self mockStoreBackend) get(namespace, key string) (*string, error) {
+	var value *string
+	err := self.mocks.UpdateStoreEntry(namespace, key, func(current *string) (*string, error) {
+		value = current
+		return nil, nil
+	})
+	return value, err
+}
+
+func (self mockStoreBackend) set(namespace, key, value string, _ *int64) error {
+	return self.mocks.UpdateStoreEntry(namespace, key, func(_ *string) (*string, error) {
+		return &value, nil
+	})
+}
+
+func (self mockStoreBackend) delete(namespace, key string) (bool, error) {
+	return self.mocks.DeleteStoreEntry(namespace, key), nil
+}
+
+func (self mockStoreBackend) update(namespace, key string, update func(current *string) (*string, error)) error {
+	return self.mocks.UpdateStoreEntry(namespace, key, update)
+}
+
+func (self mockStoreBackend) keys(namespace, prefix string) ([]string, error) {
+	return self.mocks.StoreKeys(namespace, prefix), nil
+}
+
+func (self InterpreterExecutor) storeBackend(span errors.Span) (storeBackend, *value.VmInterrupt) {
+	if self.mocks != nil {
+		return mockStoreBackend{mocks: self.mocks}, nil
+	}
+
+	if self.context.Username() == nil {
+		return nil, value.NewVMFatalException(
+			"The usage of the `storage` functions in a non-user environment is not possible",
+			value.Vm_HostErrorKind,
+			span,
+		)
+	}
+
+	return databaseStoreBackend{username: *self.context.Username()}, nil
+}
+
+func validateStoreKey(key string, span errors.Span) *value.VmInterrupt {
+	if key == "" || len(key) > database.HomescriptStorageKeyMaxLen {
+		return value.NewVMThrowInterrupt(
+			span,
+			fmt.Sprintf("Storage keys must be between 1 and %d characters long", database.HomescriptStorageKeyMaxLen),
+		)
+	}
+	return nil
+}
+
+func storeFailure(action string, err error, span errors.Span) *value.VmInterrupt {
+	return value.NewVMFatalException(
+		fmt.Sprintf("Could not %s storage entry: %s", action, err.Error()),
+		value.Vm_HostErrorKind,
+		span,
+	)
+}
+
+// Returns an object which operates on one namespace of the typed storage.
+// This is the value of `storage.store` and of `storage.open_store(name)`.
+func (self InterpreterExecutor) storeValue(namespace string) *value.Value {
+	builtin := func(
+		method string,
+		fn func(backend storeBackend, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt),
+	) *value.Value {
+		return value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			backend, i := self.storeBackend(span)
+			if i != nil {
+				return nil, i
+			}
+
+			// The only argument of `keys` is a prefix which may be empty.
+			if method != "keys" {
+				if i := validateStoreKey(args[0].(value.ValueString).Inner, span); i != nil {
+					return nil, i
+				}
+			}
+
+			if self.mocks != nil {
+				displayed := make([]string, len(args)+1)
+				displayed[0] = namespace
+				for idx, arg := range args {
+					disp, i := arg.Display()
+					if i != nil {
+						return nil, i
+					}
+					displayed[idx+1] = disp
+				}
+				self.mocks.RecordCall("storage", fmt.Sprintf("store.%s", method), displayed)
+			}
+
+			return fn(backend, span, args...)
+		})
+	}
+
+	set := func(backend storeBackend, span errors.Span, key string, val value.Value, ttlSeconds *int64) (*value.Value, *value.VmInterrupt) {
+		encoded, err := types.EncodeStoredValue(val)
+		if err != nil {
+			return nil, value.NewVMThrowInterrupt(span, err.Error())
+		}
+
+		if err := backend.set(namespace, key, encoded, ttlSeconds); err != nil {
+			return nil, storeFailure("set", err, span)
+		}
+
+		return value.NewValueNull(), nil
+	}
+
+	return value.NewValueObject(map[string]*value.Value{
+		"namespace": value.NewValueString(namespace),
+		"get": builtin("get", func(backend storeBackend, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			encoded, err := backend.get(namespace, args[0].(value.ValueString).Inner)
+			if err != nil {
+				return nil, storeFailure("get", err, span)
+			}
+
+			if encoded == nil {
+				return value.NewNoneOption(), nil
+			}
+
+			val, err := types.DecodeStoredValue(*encoded)
+			if err != nil {
+				return nil, storeFailure("decode", err, span)
+			}
+
+			return value.NewValueOption(val), nil
+		}),
+		"set": builtin("set", func(backend storeBackend, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			return set(backend, span, args[0].(value.ValueString).Inner, args[1], nil)
+		}),
+		"set_ttl": builtin("set_ttl", func(backend storeBackend, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			ttl := args[2].(value.ValueInt).Inner
+			if ttl <= 0 {
+				return nil, value.NewVMThrowInterrupt(span, fmt.Sprintf("The TTL must be a positive amount of seconds, got %d", ttl))
+			}
+
+			return set(backend, span, args[0].(value.ValueString).Inner, args[1], &ttl)
+		}),
+		"delete": builtin("delete", func(backend storeBackend, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			deleted, err := backend.delete(namespace, args[0].(value.ValueString).Inner)
+			if err != nil {
+				return nil, storeFailure("delete", err, span)
+			}
+
+			return value.NewValueBool(deleted), nil
+		}),
+		"increment": builtin("increment", func(backend storeBackend, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			key := args[0].(value.ValueString).Inner
+			by := args[1].(value.ValueInt).Inner
+
+			var result int64
+			var interrupt *value.VmInterrupt
+
+			if err := backend.update(namespace, key, func(current *string) (*string, error) {
+				if current != nil {
+					val, err := types.DecodeStoredValue(*current)
+					if err != nil {
+						return nil, err
+					}
+
+					currentInt, isInt := (*val).(value.ValueInt)
+					if !isInt {
+						interrupt = value.NewVMThrowInterrupt(span, fmt.Sprintf("Cannot increment storage entry `%s`: it does not contain an int", key))
+						return nil, nil
+					}
+
+					result = currentInt.Inner
+				}
+
+				result += by
+
+				encoded, err := types.EncodeStoredValue(*value.NewValueInt(result))
+				if err != nil {
+					return nil, err
+				}
+
+				return &encoded, nil
+			}); err != nil {
+				return nil, storeFailure("increment", err, span)
+			}
+
+			if interrupt != nil {
+				return nil, interrupt
+			}
+
+			return value.NewValueInt(result), nil
+		}),
+		"compare_and_swap": builtin("compare_and_swap", func(backend storeBackend, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			key := args[0].(value.ValueString).Inner
+
+			// An expected value of `null` means that the entry must not exist yet.
+			var expected *string
+			if args[1].Kind() != value.NullValueKind {
+				encoded, err := types.EncodeStoredValue(args[1])
+				if err != nil {
+					return nil, value.NewVMThrowInterrupt(span, err.Error())
+				}
+				expected = &encoded
+			}
+
+			newValue, err := types.EncodeStoredValue(args[2])
+			if err != nil {
+				return nil, value.NewVMThrowInterrupt(span, err.Error())
+			}
+
+			swapped := false
+			if err := backend.update(namespace, key, func(current *string) (*string, error) {
+				if current != nil && expected != nil {
+					normalized, _, err := types.NormalizeStoredValue(*current)
+					if err != nil {
+						return nil, err
+					}
+					swapped = normalized == *expected
+				} else {
+					swapped = current == nil && expected == nil
+				}
+
+				if !swapped {
+					return nil, nil
+				}
+
+				return &newValue, nil
+			}); err != nil {
+				return nil, storeFailure("swap", err, span)
+			}
+
+			return value.NewValueBool(swapped), nil
+		}),
+		"keys": builtin("keys", func(backend storeBackend, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+			keys, err := backend.keys(namespace, args[0].(value.ValueString).Inner)
+			if err != nil {
+				return nil, storeFailure("list", err, span)
+			}
+
+			list := make([]*value.Value, len(keys))
+			for idx, key := range keys {
+				list[idx] = value.NewValueString(key)
+			}
+
+			return value.NewValueList(list), nil
+		}),
+	})
+}
+
+// Opens a store which can be shared between the Homescripts of a user.
+// The namespace of the store is prefixed with its owner so that it cannot access the store of an individual script.
+func (self InterpreterExecutor) openStoreBuiltin() value.Value {
+	return *value.NewValueBuiltinFunction(func(executor value.Executor, cancelCtx *context.Context, span errors.Span, args ...value.Value) (*value.Value, *value.VmInterrupt) {
+		name := args[0].(value.ValueString).Inner
+		if name == "" || len(name) > database.HomescriptStorageStoreNameMaxLen {
+			return nil, value.NewVMThrowInterrupt(
+				span,
+				fmt.Sprintf("Store names must be between 1 and %d characters long", database.HomescriptStorageStoreNameMaxLen),
+			)
+		}
+
+		owner := ""
+		if self.context.Username() != nil {
+			owner = *self.context.Username()
+		}
+
+		return self.storeValue(database.HomescriptStoreNamespace(owner, name)), nil
+	})
+}
@@ -0,0 +1,210 @@
+package homescript
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// Is used if a job could not be executed due to an internal error (instead of a Homescript error).
+const internalErrorInterruptKind = "InternalError"
+
+// Runs which exceed the retention policy are removed periodically instead of after every run.
+const runHistoryPruneIntervalMinutes = 10
+
+// The retention policy is needed for every run, it is cached until it is changed.
+var (
+	cachedRunRetention     *database.HomescriptRunRetention
+	cachedRunRetentionLock sync.Mutex
+)
+
+func runRetention() (database.HomescriptRunRetention, error) {
+	cachedRunRetentionLock.Lock()
+	defer cachedRunRetentionLock.Unlock()
+
+	if cachedRunRetention != nil {
+		return *cachedRunRetention, nil
+	}
+
+	retention, err := database.GetHomescriptRunRetention()
+	if err != nil {
+		return database.HomescriptRunRetention{}, err
+	}
+	cachedRunRetention = &retention
+
+	return retention, nil
+}
+
+// Persists a new retention policy and applies it immediately.
+func SetRunRetention(retention database.HomescriptRunRetention) error {
+	cachedRunRetentionLock.Lock()
+	if err := database.SetHomescriptRunRetention(retention); err != nil {
+		// The stored policy is unknown now, therefore, it is loaded again on the next run.
+		cachedRunRetention = nil
+		cachedRunRetentionLock.Unlock()
+		return err
+	}
+	cachedRunRetention = &retention
+	cachedRunRetentionLock.Unlock()
+
+	// Failures are logged by the database, the pruner retries periodically.
+	_ = database.PurgeAllHomescriptRuns(retention)
+
+	return nil
+}
+
+func pruneRunHistory() {
+	retention, err := runRetention()
+	if err != nil {
+		return
+	}
+
+	if err := database.PurgeAllHomescriptRuns(retention); err != nil {
+		logger.Errorf("Could not prune Homescript execution history: %s", err.Error())
+	}
+}
+
+// Sets up a scheduler which enforces the retention policy of the execution history.
+func StartRunHistoryPruner() error {
+	scheduler := gocron.NewScheduler(time.Local)
+	if _, err := scheduler.Every(runHistoryPruneIntervalMinutes).Minute().Do(pruneRunHistory); err != nil {
+		return err
+	}
+	scheduler.StartAsync()
+	logger.Debug("Successfully started Homescript execution history pruner")
+	return nil
+}
+
+// Captures the (truncated) output of a job for the execution history.
+type historyWriter struct {
+	inner     io.Writer
+	lock      sync.Mutex
+	output    bytes.Buffer
+	truncated bool
+}
+
+func newHistoryWriter(inner io.Writer) *historyWriter {
+	return &historyWriter{
+		inner:     inner,
+		lock:      sync.Mutex{},
+		output:    bytes.Buffer{},
+		truncated: false,
+	}
+}
+
+func (w *historyWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	remaining := database.HomescriptRunMaxOutputLen - w.output.Len()
+	if len(p) > remaining {
+		w.output.Write(p[:remaining])
+		w.truncated = true
+	} else {
+		w.output.Write(p)
+	}
+	w.lock.Unlock()
+
+	return w.inner.Write(p)
+}
+
+func (w *historyWriter) result() (output string, truncated bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// Truncation could have split a multi-byte character.
+	return strings.ToValidUTF8(w.output.String(), ""), w.truncated
+}
+
+func runContextOf(context types.ExecutionContext) database.HomescriptRunContext {
+	switch context.Kind() {
+	case types.HMS_PROGRAM_KIND_AUTOMATION:
+		return database.HomescriptRunContextAutomation
+	case types.HMS_PROGRAM_KIND_DEVICE_DRIVER:
+		return database.HomescriptRunContextDriver
+	case types.HMS_PROGRAM_KIND_WEBHOOK:
+		return database.HomescriptRunContextWebhook
+	default:
+		return database.HomescriptRunContextUser
+	}
+}
+
+// Persists a finished job in the execution history.
+// Failures are only logged as the history must never affect the execution of a job.
+func (m *Manager) recordRun(
+	programID string,
+	context types.ExecutionContext,
+	startTime time.Time,
+	history *historyWriter,
+	exitCode int64,
+	res types.HmsRes,
+	runErr error,
+) {
+	retention, err := runRetention()
+	if err != nil {
+		return
+	}
+
+	if context.Kind() == types.HMS_PROGRAM_KIND_DEVICE_DRIVER && !retention.RecordDrivers {
+		return
+	}
+
+	endTime := time.Now()
+	output, truncated := history.result()
+
+	run := database.HomescriptRun{
+		ProgramId:       programID,
+		Context:         runContextOf(context),
+		Username:        context.Username(),
+		StartTime:       startTime,
+		EndTime:         endTime,
+		DurationMs:      uint(endTime.Sub(startTime).Milliseconds()),
+		ExitCode:        exitCode,
+		Success:         runErr == nil && !res.Errors.ContainsError,
+		Output:          output,
+		OutputTruncated: truncated,
+	}
+
+	switch ctx := context.(type) {
+	case types.ExecutionContextUser:
+		run.ScheduleId = ctx.ScheduleID
+	case types.ExecutionContextAutomation:
+		run.AutomationId = ctx.Inner.AutomationID
+	case types.ExecutionContextDriver:
+		run.DeviceId = ctx.DeviceID
+	}
+
+	hmsErrors := make([]types.HmsError, 0)
+	if runErr != nil {
+		hmsErrors = append(hmsErrors, types.HmsError{
+			RuntimeInterrupt: &types.HmsRuntimeInterrupt{
+				Kind:    internalErrorInterruptKind,
+				Message: runErr.Error(),
+			},
+		})
+	} else if res.Errors.ContainsError {
+		hmsErrors = res.Errors.Diagnostics
+	}
+
+	// A failed job without an explicit exit code is treated like `exit(1)`.
+	if !run.Success && run.ExitCode == 0 {
+		run.ExitCode = 1
+	}
+
+	errorsJSON, err := json.Marshal(hmsErrors)
+	if err != nil {
+		logger.Errorf("Could not record run of Homescript `%s`: encoding errors failed: %s", programID, err.Error())
+		return
+	}
+	run.Errors = errorsJSON
+
+	if _, err := database.InsertHomescriptRun(run); err != nil {
+		return
+	}
+}
@@ -0,0 +1,257 @@
+package homescript
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/smarthome-go/homescript/v3/homescript"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/analyzer"
+	"github.com/smarthome-go/smarthome/core/homescript/lsp"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// Library names are used as module names in imports.
+var libraryNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,29}$`)
+
+// The outcome of re-linting a Homescript which imports a library.
+type LibraryDependentReport struct {
+	HomescriptId string   `json:"homescriptId"`
+	Owner        string   `json:"owner"`
+	Valid        bool     `json:"valid"`
+	Errors       []string `json:"errors"`
+}
+
+// Generated every time a new version of a library is published.
+// Imports cannot pin a version of a library, dependents always use the latest version.
+// Therefore, every dependent is re-linted against the new version and the report lists the ones which broke.
+type LibraryPublishReport struct {
+	Library string `json:"library"`
+	Version uint   `json:"version"`
+	// Exports which were added, removed or changed compared to the previous version.
+	Changes    []lsp.ExportChange       `json:"changes"`
+	Dependents []LibraryDependentReport `json:"dependents"`
+	// The number of dependents which no longer pass the analyzer.
+	Broken int `json:"broken"`
+}
+
+// Validates the name of a new library.
+// Returns a human-readable reason if the name cannot be used.
+func ValidateLibraryName(name string) (reason string, valid bool, err error) {
+	if !libraryNameRegex.MatchString(name) {
+		return "library names must be valid identifiers of up to 30 characters", false, nil
+	}
+
+	if _, isBuiltin := analyzer.BuiltinModules()[name]; isBuiltin {
+		return fmt.Sprintf("`%s` is a builtin module", name), false, nil
+	}
+
+	_, exists, err := database.GetHomescriptLibrary(name)
+	if err != nil {
+		return "", false, err
+	}
+	if exists {
+		return fmt.Sprintf("a library named `%s` already exists", name), false, nil
+	}
+
+	return "", true, nil
+}
+
+// Creates a new library which is backed by one of the owner's Homescripts and publishes its first version.
+func (m *Manager) CreateLibrary(
+	library database.HomescriptLibrary,
+) (LibraryPublishReport, types.HmsDiagnosticsContainer, error) {
+	if err := database.CreateHomescriptLibrary(library); err != nil {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+	}
+
+	report, diagnostics, err := m.PublishLibrary(library.Name)
+	if err != nil || diagnostics.ContainsError {
+		// A library without any valid version is useless, remove it again.
+		if deleteErr := database.DeleteHomescriptLibrary(library.Name); deleteErr != nil {
+			return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, deleteErr
+		}
+	}
+
+	return report, diagnostics, err
+}
+
+// Publishes the current code of the library's Homescript as a new version.
+// Code which contains errors is not published, in this case the diagnostics are returned instead.
+// After publishing, every dependent is re-linted against the new version.
+func (m *Manager) PublishLibrary(name string) (LibraryPublishReport, types.HmsDiagnosticsContainer, error) {
+	library, found, err := database.GetHomescriptLibrary(name)
+	if err != nil {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+	}
+	if !found {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, fmt.Errorf("Library `%s` was not found", name)
+	}
+
+	script, found, err := m.GetPersonalScriptById(library.HomescriptId, library.Owner)
+	if err != nil {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+	}
+	if !found {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, fmt.Errorf("Homescript with ID `%s` owned by user `%s` was not found", library.HomescriptId, library.Owner)
+	}
+
+	modules, diagnostics, err := m.Analyze(
+		homescript.InputProgram{
+			ProgramText: script.Data.Code,
+			Filename:    script.Data.Id,
+		},
+		types.NewExecutionContextUser(script.Data.Id, library.Owner, make(map[string]string)),
+	)
+	if err != nil {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+	}
+	if diagnostics.ContainsError {
+		return LibraryPublishReport{}, diagnostics, nil
+	}
+
+	previousExports := make([]lsp.Export, 0)
+	if library.LatestVersion > 0 {
+		previous, found, err := database.GetHomescriptLibraryVersion(name, library.LatestVersion)
+		if err != nil {
+			return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+		}
+		if found {
+			if err := json.Unmarshal(previous.Exports, &previousExports); err != nil {
+				return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+			}
+		}
+	}
+
+	exports := lsp.ModuleExports(modules, script.Data.Id)
+	exportsJSON, err := json.Marshal(exports)
+	if err != nil {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+	}
+
+	version := library.LatestVersion + 1
+	if err := database.InsertHomescriptLibraryVersion(database.HomescriptLibraryVersion{
+		LibraryName: name,
+		Version:     version,
+		Code:        script.Data.Code,
+		PublishedAt: time.Now(),
+		Exports:     exportsJSON,
+	}); err != nil {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+	}
+
+	report := LibraryPublishReport{
+		Library:    name,
+		Version:    version,
+		Changes:    lsp.DiffExports(previousExports, exports),
+		Dependents: make([]LibraryDependentReport, 0),
+		Broken:     0,
+	}
+
+	dependents, err := LibraryDependents(library)
+	if err != nil {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+	}
+
+	for _, dependent := range dependents {
+		dependentReport, err := m.relintDependent(dependent)
+		if err != nil {
+			return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+		}
+		if !dependentReport.Valid {
+			report.Broken++
+		}
+		report.Dependents = append(report.Dependents, dependentReport)
+
+		m.InvalidateCompileCacheEntry(dependent.Data.Id)
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+	}
+	if err := database.SetHomescriptLibraryVersionReport(name, version, reportJSON); err != nil {
+		return LibraryPublishReport{}, types.HmsDiagnosticsContainer{}, err
+	}
+
+	logger.Infof("User `%s` published version %d of library `%s` (%d dependent(s), %d broken)", library.Owner, version, name, len(report.Dependents), report.Broken)
+	return report, types.HmsDiagnosticsContainer{}, nil
+}
+
+// Returns all Homescripts which import the given library.
+// The Homescript backing the library and scripts whose owners lost access are not included.
+// Imports are taken from the analyzer, scripts which contain syntax errors cannot be analyzed and are not included either.
+func LibraryDependents(library database.HomescriptLibrary) ([]database.Homescript, error) {
+	homescripts, err := database.ListAllHomescripts()
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := make([]database.Homescript, 0)
+	for _, script := range homescripts {
+		if script.Data.Type == database.HOMESCRIPT_TYPE_DRIVER {
+			continue
+		}
+		if script.Owner == library.Owner && script.Data.Id == library.HomescriptId {
+			continue
+		}
+
+		// Personal scripts take precedence over libraries of the same name.
+		if script.Owner == library.Owner {
+			if _, shadowed, err := database.GetPersonalHomescriptById(library.Name, script.Owner); err != nil {
+				return nil, err
+			} else if shadowed {
+				continue
+			}
+		}
+
+		canImport, err := database.UserCanImportHomescriptLibrary(library, script.Owner)
+		if err != nil {
+			return nil, err
+		}
+		if !canImport {
+			continue
+		}
+
+		// Analyzing is the most expensive check, hence it comes last.
+		references, err := scanReferences(script.Owner, script.Data.Id, script.Data.Code)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(references.Imports, library.Name) {
+			continue
+		}
+
+		dependents = append(dependents, script)
+	}
+
+	return dependents, nil
+}
+
+func (m *Manager) relintDependent(script database.Homescript) (LibraryDependentReport, error) {
+	_, diagnostics, err := m.Analyze(
+		homescript.InputProgram{
+			ProgramText: script.Data.Code,
+			Filename:    script.Data.Id,
+		},
+		types.NewExecutionContextUser(script.Data.Id, script.Owner, make(map[string]string)),
+	)
+	if err != nil {
+		return LibraryDependentReport{}, err
+	}
+
+	errors := make([]string, 0)
+	for _, diagnostic := range diagnostics.Diagnostics {
+		errors = append(errors, diagnostic.String())
+	}
+
+	return LibraryDependentReport{
+		HomescriptId: script.Data.Id,
+		Owner:        script.Owner,
+		Valid:        !diagnostics.ContainsError,
+		Errors:       errors,
+	}, nil
+}
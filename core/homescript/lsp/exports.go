@@ -0,0 +1,98 @@
+package lsp
+
+import (
+	"sort"
+
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+)
+
+// A public top-level declaration of a module which can be imported by other modules.
+type Export struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Signature string `json:"signature"`
+}
+
+const (
+	ExportKindFunction = "function"
+	ExportKindVariable = "variable"
+	ExportKindType     = "type"
+)
+
+// Returns the public top-level declarations of an analyzed module in the order of their declaration.
+// The signatures contain the types inferred by the analyzer.
+func ModuleExports(modules map[string]ast.AnalyzedProgram, module string) []Export {
+	index, _ := newSymbolIndex(modules, module)
+
+	symbols := make([]symbol, 0)
+	for _, sym := range index.symbols {
+		if sym.public && sym.topLevel && sym.importedFrom == "" {
+			symbols = append(symbols, sym)
+		}
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return symbols[i].ident.Start.before(symbols[j].ident.Start)
+	})
+
+	exports := make([]Export, 0, len(symbols))
+	for _, sym := range symbols {
+		kind := ExportKindVariable
+		switch sym.kind {
+		case SymbolKindFunction:
+			kind = ExportKindFunction
+		case SymbolKindStruct:
+			kind = ExportKindType
+		}
+
+		exports = append(exports, Export{
+			Name:      sym.name,
+			Kind:      kind,
+			Signature: sym.detail,
+		})
+	}
+
+	return exports
+}
+
+// Describes how an export changed between two versions of a module.
+type ExportChange struct {
+	Name string `json:"name"`
+	// `nil` if the export was added.
+	Before *Export `json:"before"`
+	// `nil` if the export was removed.
+	After *Export `json:"after"`
+}
+
+// Returns the exports which were added, removed or whose signature changed.
+func DiffExports(before []Export, after []Export) []ExportChange {
+	changes := make([]ExportChange, 0)
+
+	previous := make(map[string]Export)
+	for _, export := range before {
+		previous[export.Name] = export
+	}
+
+	current := make(map[string]bool)
+	for _, export := range after {
+		export := export
+		current[export.Name] = true
+
+		old, found := previous[export.Name]
+		if !found {
+			changes = append(changes, ExportChange{Name: export.Name, Before: nil, After: &export})
+			continue
+		}
+		if old != export {
+			changes = append(changes, ExportChange{Name: export.Name, Before: &old, After: &export})
+		}
+	}
+
+	for _, export := range before {
+		export := export
+		if !current[export.Name] {
+			changes = append(changes, ExportChange{Name: export.Name, Before: &export, After: nil})
+		}
+	}
+
+	return changes
+}
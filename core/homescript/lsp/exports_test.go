@@ -0,0 +1,54 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func moduleExportsOf(t *testing.T, code string) []Export {
+	doc := analyzeTestDocument(t, "library", code, nil)
+	return ModuleExports(doc.modules, "library")
+}
+
+func TestModuleExports(t *testing.T) {
+	exports := moduleExportsOf(t, `pub let LIMIT = 10;
+
+pub fn toggle(id: Id, on: bool) -> bool {
+    let label = "fn not_a_function";
+    on
+}
+
+fn private() {}
+
+pub type Id = str;
+`)
+
+	// Types are resolved by the analyzer.
+	assert.Equal(t, []Export{
+		{Name: "LIMIT", Kind: ExportKindVariable, Signature: "pub let LIMIT: int"},
+		{Name: "toggle", Kind: ExportKindFunction, Signature: "pub fn toggle(id: str, on: bool) -> bool"},
+		{Name: "Id", Kind: ExportKindType, Signature: "pub type Id = str"},
+	}, exports)
+
+	// Code which cannot be analyzed does not export anything.
+	assert.Empty(t, ModuleExports(nil, "library"))
+}
+
+func TestDiffExports(t *testing.T) {
+	before := moduleExportsOf(t, "pub fn a() {}\npub fn b(x: int) {}\npub fn c() {}\n")
+	after := moduleExportsOf(t, "pub fn a() {}\npub fn b(x: str) {}\npub fn d() {}\n")
+
+	changes := DiffExports(before, after)
+	assert.Len(t, changes, 3)
+
+	assert.Equal(t, "b", changes[0].Name)
+	assert.Equal(t, "pub fn b(x: int) -> null", changes[0].Before.Signature)
+	assert.Equal(t, "pub fn b(x: str) -> null", changes[0].After.Signature)
+
+	assert.Equal(t, "d", changes[1].Name)
+	assert.Nil(t, changes[1].Before)
+
+	assert.Equal(t, "c", changes[2].Name)
+	assert.Nil(t, changes[2].After)
+}
@@ -0,0 +1,367 @@
+package lsp
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Completion works on a lightweight lexical index of each document.
+// Unlike the analyzer, this also works on incomplete code which is the common case while typing.
+
+type tokenKind uint8
+
+const (
+	tokenIdent tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	// Byte offsets into the source.
+	start int
+	end   int
+	rng   Range
+}
+
+// Splits Homescript source code into tokens, comments and whitespace are dropped.
+func tokenize(src string) []token {
+	tokens := make([]token, 0)
+
+	offset := 0
+	pos := Position{Line: 0, Character: 0}
+
+	peek := func(n int) rune {
+		idx := offset
+		for ; n > 0 && idx < len(src); n-- {
+			_, size := utf8.DecodeRuneInString(src[idx:])
+			idx += size
+		}
+		if idx >= len(src) {
+			return 0
+		}
+		r, _ := utf8.DecodeRuneInString(src[idx:])
+		return r
+	}
+
+	advance := func() rune {
+		r, size := utf8.DecodeRuneInString(src[offset:])
+		offset += size
+		if r == '\n' {
+			pos.Line++
+			pos.Character = 0
+		} else if r >= 0x10000 {
+			// Characters outside of the BMP take two UTF-16 code units.
+			pos.Character += 2
+		} else {
+			pos.Character++
+		}
+		return r
+	}
+
+	for offset < len(src) {
+		r := peek(0)
+		start := offset
+		startPos := pos
+
+		var kind tokenKind
+
+		switch {
+		case unicode.IsSpace(r):
+			advance()
+			continue
+		case r == '/' && peek(1) == '/':
+			for offset < len(src) && peek(0) != '\n' {
+				advance()
+			}
+			continue
+		case r == '/' && peek(1) == '*':
+			advance()
+			advance()
+			for offset < len(src) && !(peek(0) == '*' && peek(1) == '/') {
+				advance()
+			}
+			if offset < len(src) {
+				advance()
+				advance()
+			}
+			continue
+		case r == '_' || unicode.IsLetter(r):
+			kind = tokenIdent
+			for offset < len(src) && (peek(0) == '_' || unicode.IsLetter(peek(0)) || unicode.IsDigit(peek(0))) {
+				advance()
+			}
+		case unicode.IsDigit(r):
+			kind = tokenNumber
+			for offset < len(src) && (peek(0) == '_' || peek(0) == '.' || unicode.IsLetter(peek(0)) || unicode.IsDigit(peek(0))) {
+				advance()
+			}
+		case r == '"' || r == '\'' || r == '`':
+			kind = tokenString
+			advance()
+			for offset < len(src) && peek(0) != r {
+				if advance() == '\\' && offset < len(src) {
+					advance()
+				}
+			}
+			if offset < len(src) {
+				advance()
+			}
+		default:
+			kind = tokenPunct
+			advance()
+		}
+
+		tokens = append(tokens, token{
+			kind:  kind,
+			value: src[start:offset],
+			start: start,
+			end:   offset,
+			rng:   Range{Start: startPos, End: pos},
+		})
+	}
+
+	return tokens
+}
+
+// Converts an LSP position into a byte offset of the source.
+func offsetOf(src string, pos Position) int {
+	line := 0
+	character := 0
+
+	for offset, r := range src {
+		if line == pos.Line && character >= pos.Character {
+			return offset
+		}
+		if r == '\n' {
+			if line == pos.Line {
+				return offset
+			}
+			line++
+			character = 0
+			continue
+		}
+		if line == pos.Line {
+			character += utf16Len(r)
+		}
+	}
+
+	return len(src)
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// A function, variable or type declared in a document.
+type declaration struct {
+	name      string
+	kind      SymbolKind
+	public    bool
+	topLevel  bool
+	nameToken int
+	// The header of the declaration, for instance the signature of a function.
+	detail string
+}
+
+// The import kind is given by an optional keyword in front of the imported name.
+const (
+	importKeywordType     = "type"
+	importKeywordTemplate = "templ"
+	importKeywordTrigger  = "trigger"
+)
+
+// A name which is imported from another module.
+type importedName struct {
+	name        string
+	module      string
+	keyword     string
+	nameToken   int
+	moduleToken int
+}
+
+type documentIndex struct {
+	source       string
+	tokens       []token
+	declarations []declaration
+	imports      []importedName
+}
+
+// The maximum length of the detail of a declaration.
+const maxDetailLen = 200
+
+func newDocumentIndex(src string) documentIndex {
+	index := documentIndex{
+		source:       src,
+		tokens:       tokenize(src),
+		declarations: make([]declaration, 0),
+		imports:      make([]importedName, 0),
+	}
+
+	depth := 0
+	for idx := 0; idx < len(index.tokens); idx++ {
+		tok := index.tokens[idx]
+
+		switch {
+		case tok.kind == tokenPunct && tok.value == "{":
+			depth++
+		case tok.kind == tokenPunct && tok.value == "}":
+			if depth > 0 {
+				depth--
+			}
+		case tok.kind == tokenIdent && tok.value == "import":
+			idx = index.parseImport(idx)
+		case tok.kind == tokenIdent && (tok.value == "fn" || tok.value == "let" || tok.value == "type"):
+			index.parseDeclaration(idx, depth == 0)
+		}
+	}
+
+	return index
+}
+
+// Parses `import { a, type B, trigger c } from module;` starting at the `import` keyword.
+// Returns the index of the last token which belongs to the import.
+func (d *documentIndex) parseImport(start int) int {
+	idx := start + 1
+	if !d.isPunct(idx, "{") {
+		return start
+	}
+
+	names := make([]importedName, 0)
+	for idx++; idx < len(d.tokens) && !d.isPunct(idx, "}"); idx++ {
+		tok := d.tokens[idx]
+		if tok.kind != tokenIdent {
+			continue
+		}
+
+		keyword := ""
+		switch tok.value {
+		case importKeywordType, importKeywordTemplate, importKeywordTrigger:
+			if d.isIdent(idx + 1) {
+				keyword = tok.value
+				idx++
+			}
+		}
+
+		names = append(names, importedName{
+			name:        d.tokens[idx].value,
+			keyword:     keyword,
+			nameToken:   idx,
+			moduleToken: -1,
+		})
+	}
+
+	// The module is still missing while the user is typing the import.
+	if !d.isIdentValue(idx+1, "from") || !d.isIdent(idx+2) {
+		return idx
+	}
+
+	for _, name := range names {
+		name.module = d.tokens[idx+2].value
+		name.moduleToken = idx + 2
+		d.imports = append(d.imports, name)
+	}
+
+	return idx + 2
+}
+
+func (d *documentIndex) parseDeclaration(keywordIdx int, topLevel bool) {
+	keyword := d.tokens[keywordIdx]
+
+	// Member accesses like `foo.type` are not declarations.
+	if d.isPunct(keywordIdx-1, ".") {
+		return
+	}
+
+	nameIdx := keywordIdx + 1
+	if keyword.value == "let" && d.isIdentValue(nameIdx, "mut") {
+		nameIdx++
+	}
+	// Anonymous functions do not declare a name.
+	if !d.isIdent(nameIdx) {
+		return
+	}
+
+	public := d.isIdentValue(keywordIdx-1, "pub")
+	start := keyword.start
+	if public {
+		start = d.tokens[keywordIdx-1].start
+	}
+
+	// The header of the declaration ends in front of its body or value.
+	end := len(d.tokens) - 1
+	for idx := nameIdx + 1; idx < len(d.tokens); idx++ {
+		tok := d.tokens[idx]
+		if tok.kind != tokenPunct {
+			continue
+		}
+		if (keyword.value == "fn" && tok.value == "{") || tok.value == "=" || tok.value == ";" {
+			end = idx - 1
+			break
+		}
+	}
+	if end < nameIdx {
+		end = nameIdx
+	}
+
+	detail := strings.Join(strings.Fields(d.source[start:d.tokens[end].end]), " ")
+	if len(detail) > maxDetailLen {
+		detail = detail[:maxDetailLen] + "..."
+	}
+
+	kind := SymbolKindVariable
+	switch keyword.value {
+	case "fn":
+		kind = SymbolKindFunction
+	case "type":
+		kind = SymbolKindStruct
+	}
+
+	d.declarations = append(d.declarations, declaration{
+		name:      d.tokens[nameIdx].value,
+		kind:      kind,
+		public:    public,
+		topLevel:  topLevel,
+		nameToken: nameIdx,
+		detail:    detail,
+	})
+}
+
+func (d *documentIndex) isPunct(idx int, value string) bool {
+	return idx >= 0 && idx < len(d.tokens) && d.tokens[idx].kind == tokenPunct && d.tokens[idx].value == value
+}
+
+func (d *documentIndex) isIdent(idx int) bool {
+	return idx >= 0 && idx < len(d.tokens) && d.tokens[idx].kind == tokenIdent
+}
+
+func (d *documentIndex) isIdentValue(idx int, value string) bool {
+	return d.isIdent(idx) && d.tokens[idx].value == value
+}
+
+// Returns the index of the last token which ends before the given byte offset, -1 if there is none.
+func (d *documentIndex) tokenBefore(offset int) int {
+	result := -1
+	for idx, tok := range d.tokens {
+		if tok.end > offset {
+			break
+		}
+		result = idx
+	}
+	return result
+}
+
+func (d *documentIndex) lookupImport(name string) (importedName, bool) {
+	for _, imported := range d.imports {
+		if imported.name == name {
+			return imported, true
+		}
+	}
+	return importedName{}, false
+}
@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const indexTestCode = `import { set_power, trigger device_event } from device;
+import { type Shared, helper } from utils;
+
+// fn commented_out() {}
+pub fn toggle(id: str, on: bool) -> bool {
+    let label = "fn not_a_function";
+    set_power(id, on);
+    return helper(label);
+}
+
+type Room = { name: str };
+
+fn main() {
+    let result = toggle("lamp", true);
+    println(result.label);
+}
+`
+
+func TestDocumentIndex(t *testing.T) {
+	index := newDocumentIndex(indexTestCode)
+
+	names := make([]string, 0)
+	for _, decl := range index.declarations {
+		names = append(names, decl.name)
+	}
+	assert.Equal(t, []string{"toggle", "label", "Room", "main", "result"}, names)
+
+	toggle := index.declarations[0]
+	assert.True(t, toggle.public)
+	assert.True(t, toggle.topLevel)
+	assert.Equal(t, SymbolKindFunction, toggle.kind)
+	assert.Equal(t, "pub fn toggle(id: str, on: bool) -> bool", toggle.detail)
+	assert.Equal(t, Range{Start: Position{Line: 4, Character: 7}, End: Position{Line: 4, Character: 13}}, index.tokens[toggle.nameToken].rng)
+
+	label := index.declarations[1]
+	assert.False(t, label.topLevel)
+
+	assert.Len(t, index.imports, 4)
+	deviceEvent, found := index.lookupImport("device_event")
+	assert.True(t, found)
+	assert.Equal(t, "device", deviceEvent.module)
+	assert.Equal(t, importKeywordTrigger, deviceEvent.keyword)
+	shared, found := index.lookupImport("Shared")
+	assert.True(t, found)
+	assert.Equal(t, "utils", shared.module)
+	assert.Equal(t, importKeywordType, shared.keyword)
+}
+
+func TestOffsetOf(t *testing.T) {
+	src := "let a = 1;\nlet 🙂 = 'b';\n"
+
+	assert.Equal(t, 0, offsetOf(src, Position{Line: 0, Character: 0}))
+	assert.Equal(t, 11, offsetOf(src, Position{Line: 1, Character: 0}))
+	// The emoji takes two UTF-16 code units but four bytes.
+	assert.Equal(t, 19, offsetOf(src, Position{Line: 1, Character: 6}))
+	// Positions behind the end of a line are clamped to the line.
+	assert.Equal(t, 10, offsetOf(src, Position{Line: 0, Character: 100}))
+}
+
+func TestModuleURIs(t *testing.T) {
+	assert.Equal(t, "example", moduleOf("hms:///scripts/example.hms"))
+	assert.Equal(t, "hms:///scripts/utils.hms", uriOfModule("hms:///scripts/example.hms", "utils"))
+}
@@ -0,0 +1,155 @@
+package lsp
+
+import (
+	"sort"
+
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	pAst "github.com/smarthome-go/homescript/v3/homescript/parser/ast"
+)
+
+// Resources which are referenced by a Homescript.
+type References struct {
+	// Modules imported by the script, including builtin modules.
+	Imports     []string `json:"imports"`
+	Devices     []string `json:"devices"`
+	StorageKeys []string `json:"storageKeys"`
+	// Keys of the typed storage, see `storage.store` and `storage.open_store`.
+	StoreKeys []StoreKey `json:"storeKeys"`
+	// Set if a device ID, storage key or store name is not a string literal and can therefore not be resolved statically.
+	// This is also set if the script could not be analyzed.
+	Dynamic bool `json:"dynamic"`
+}
+
+// A key of the typed storage.
+type StoreKey struct {
+	// The name of a store opened using `open_store`, empty for the store of the script itself.
+	Store string `json:"store"`
+	Key   string `json:"key"`
+}
+
+const (
+	referenceKindDevice  = "device"
+	referenceKindStorage = "storage"
+	referenceKindStore   = "store"
+)
+
+// Builtin functions whose first argument is a device ID or a storage key.
+// Methods of stores are listed as `store.<method>` in the `storage` module.
+var referencingFunctions = map[string]map[string]string{
+	"device": {
+		"set_power":       referenceKindDevice,
+		"dim":             referenceKindDevice,
+		"get_device":      referenceKindDevice,
+		"power_state":     referenceKindDevice,
+		"power_draw":      referenceKindDevice,
+		"dim_levels":      referenceKindDevice,
+		"sensor_readings": referenceKindDevice,
+	},
+	"storage": {
+		"set_storage":            referenceKindStorage,
+		"get_storage":            referenceKindStorage,
+		"store.get":              referenceKindStore,
+		"store.set":              referenceKindStore,
+		"store.set_ttl":          referenceKindStore,
+		"store.delete":           referenceKindStore,
+		"store.increment":        referenceKindStore,
+		"store.compare_and_swap": referenceKindStore,
+	},
+}
+
+// Collects the references to modules, devices and storage keys of an analyzed module.
+// Only direct calls of imported builtin functions and of methods of stores are considered.
+func ScanReferences(modules map[string]ast.AnalyzedProgram, module string) References {
+	index, found := newSymbolIndex(modules, module)
+	if !found {
+		return References{
+			Imports:     []string{},
+			Devices:     []string{},
+			StorageKeys: []string{},
+			StoreKeys:   []StoreKey{},
+			Dynamic:     true,
+		}
+	}
+
+	imports := make(map[string]bool)
+	for _, imported := range index.modules {
+		imports[imported.module] = true
+	}
+
+	devices := make(map[string]bool)
+	storageKeys := make(map[string]bool)
+	storeKeys := make(map[StoreKey]bool)
+	dynamic := false
+
+	for _, call := range index.calls {
+		var kind string
+
+		if call.function >= 0 {
+			sym := index.symbols[call.function]
+			if sym.importedFrom == "" || sym.importKind != pAst.IMPORT_KIND_NORMAL {
+				continue
+			}
+			kind = referencingFunctions[sym.importedFrom][sym.name]
+		} else if call.store != nil {
+			kind = referencingFunctions["storage"]["store."+call.method]
+			if kind != "" && call.store.dynamic {
+				dynamic = true
+				continue
+			}
+		}
+
+		if kind == "" {
+			continue
+		}
+
+		if len(call.args) == 0 {
+			dynamic = true
+			continue
+		}
+		literal, isLiteral := call.args[0].(ast.AnalyzedStringLiteralExpression)
+		if !isLiteral {
+			dynamic = true
+			continue
+		}
+
+		switch kind {
+		case referenceKindDevice:
+			devices[literal.Value] = true
+		case referenceKindStorage:
+			storageKeys[literal.Value] = true
+		case referenceKindStore:
+			storeKeys[StoreKey{Store: call.store.name, Key: literal.Value}] = true
+		}
+	}
+
+	return References{
+		Imports:     sortedKeys(imports),
+		Devices:     sortedKeys(devices),
+		StorageKeys: sortedKeys(storageKeys),
+		StoreKeys:   sortedStoreKeys(storeKeys),
+		Dynamic:     dynamic,
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedStoreKeys(set map[StoreKey]bool) []StoreKey {
+	keys := make([]StoreKey, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Store != keys[j].Store {
+			return keys[i].Store < keys[j].Store
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
@@ -0,0 +1,79 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanReferences(t *testing.T) {
+	code := `import { set_power, dim, sensor_readings } from device;
+import { get_storage, set_storage, store, open_store } from storage;
+import { helper } from utils;
+
+fn main() {
+    set_power("lamp", true);
+    dim('desk', "brightness", 50);
+    set_power("lamp", false);
+    sensor_readings("thermometer");
+    // set_power("commented_out", true);
+
+    let id = "heater";
+    set_power(id, true);
+
+    set_storage("counter", 1);
+    get_storage("counter");
+
+    store.set("runs", 1);
+    store.increment("runs", 1);
+    let shared = open_store("garden");
+    shared.get("watered");
+    open_store("garden").delete("skipped");
+
+    helper.set_power("not_a_builtin", true);
+}
+`
+	utils := `pub let helper = { set_power: fn(id: str, on: bool) {} };
+`
+	doc := analyzeTestDocument(t, "example", code, map[string]string{"utils": utils})
+	references := ScanReferences(doc.modules, "example")
+
+	assert.Equal(t, []string{"device", "storage", "utils"}, references.Imports)
+	assert.Equal(t, []string{"desk", "lamp", "thermometer"}, references.Devices)
+	assert.Equal(t, []string{"counter"}, references.StorageKeys)
+	assert.Equal(t, []StoreKey{
+		{Store: "", Key: "runs"},
+		{Store: "garden", Key: "skipped"},
+		{Store: "garden", Key: "watered"},
+	}, references.StoreKeys)
+	assert.True(t, references.Dynamic)
+
+	// Functions which are not imported from a builtin module are ignored, even if they shadow a builtin.
+	code = `import { set_power } from device;
+
+fn main() {
+    let set_power = fn(id: str) {};
+    set_power("lamp");
+}
+`
+	doc = analyzeTestDocument(t, "example", code, nil)
+	references = ScanReferences(doc.modules, "example")
+	assert.Empty(t, references.Devices)
+	assert.False(t, references.Dynamic)
+
+	// Stores whose name is not known statically make the references dynamic.
+	code = `import { open_store } from storage;
+
+fn main() {
+    let name = "garden";
+    open_store(name).set("watered", true);
+}
+`
+	doc = analyzeTestDocument(t, "example", code, nil)
+	references = ScanReferences(doc.modules, "example")
+	assert.Empty(t, references.StoreKeys)
+	assert.True(t, references.Dynamic)
+
+	// Code which cannot be analyzed cannot be resolved.
+	assert.True(t, ScanReferences(nil, "example").Dynamic)
+}
@@ -0,0 +1,732 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/smarthome-go/homescript/v3/homescript"
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	pAst "github.com/smarthome-go/homescript/v3/homescript/parser/ast"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/analyzer"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+const serverName = "smarthome-homescript"
+
+var keywords = []string{
+	"fn", "pub", "let", "type", "import", "from",
+	"if", "else", "match", "for", "in", "while", "loop",
+	"break", "continue", "return", "try", "catch",
+	"true", "false", "null", "none",
+}
+
+// A language server session of a single user.
+// Documents are identified by their URI, the base name of the URI (without extension) is the ID of the Homescript.
+type Server struct {
+	username  string
+	manager   types.Manager
+	send      func(message any) error
+	documents map[string]document
+}
+
+// An open document: the lexical index is used for completion, which mostly happens on incomplete code.
+// All other requests use the symbols of the analyzed document.
+type document struct {
+	index   documentIndex
+	symbols symbolIndex
+	// All modules of the last analysis, including the imported ones.
+	modules map[string]ast.AnalyzedProgram
+	// Is `false` if the document could not be analyzed, for instance due to syntax errors.
+	analyzed bool
+}
+
+func NewServer(username string, manager types.Manager, send func(message any) error) *Server {
+	return &Server{
+		username:  username,
+		manager:   manager,
+		send:      send,
+		documents: make(map[string]document),
+	}
+}
+
+// Handles a single JSON-RPC message of the client.
+// Returns `true` once the client has requested the server to exit.
+// An error is only returned if a message could not be sent to the client.
+func (s *Server) Handle(raw []byte) (exit bool, err error) {
+	var message rpcMessage
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return false, s.send(rpcErrorResponse{
+			JSONRPC: jsonRPCVersion,
+			ID:      json.RawMessage("null"),
+			Error:   rpcError{Code: rpcParseError, Message: err.Error()},
+		})
+	}
+
+	// Notifications do not expect a response.
+	if message.ID == nil {
+		switch message.Method {
+		case "exit":
+			return true, nil
+		case "textDocument/didOpen":
+			var params DidOpenTextDocumentParams
+			if err := json.Unmarshal(message.Params, &params); err != nil {
+				return false, nil
+			}
+			return false, s.updateDocument(params.TextDocument.URI, params.TextDocument.Text)
+		case "textDocument/didChange":
+			var params DidChangeTextDocumentParams
+			if err := json.Unmarshal(message.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+				return false, nil
+			}
+			return false, s.updateDocument(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		case "textDocument/didClose":
+			var params DidCloseTextDocumentParams
+			if err := json.Unmarshal(message.Params, &params); err != nil {
+				return false, nil
+			}
+			delete(s.documents, params.TextDocument.URI)
+			return false, s.send(rpcNotification{
+				JSONRPC: jsonRPCVersion,
+				Method:  "textDocument/publishDiagnostics",
+				Params:  PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}},
+			})
+		}
+		return false, nil
+	}
+
+	result, rpcErr := s.handleRequest(message)
+	if rpcErr != nil {
+		return false, s.send(rpcErrorResponse{
+			JSONRPC: jsonRPCVersion,
+			ID:      *message.ID,
+			Error:   *rpcErr,
+		})
+	}
+
+	return false, s.send(rpcResult{
+		JSONRPC: jsonRPCVersion,
+		ID:      *message.ID,
+		Result:  result,
+	})
+}
+
+func (s *Server) handleRequest(message rpcMessage) (any, *rpcError) {
+	switch message.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync: textDocumentSyncKindFull,
+				CompletionProvider: CompletionOptions{
+					TriggerCharacters: []string{"{", ","},
+				},
+				HoverProvider:          true,
+				DefinitionProvider:     true,
+				DocumentSymbolProvider: true,
+				RenameProvider:         true,
+			},
+			ServerInfo: ServerInfo{Name: serverName},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		doc, err := s.decodeDocumentParams(message.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.completion(doc.index, params.Position)
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		doc, err := s.decodeDocumentParams(message.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.hover(params.TextDocument.URI, doc, params.Position)
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		doc, err := s.decodeDocumentParams(message.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.definition(params.TextDocument.URI, doc, params.Position)
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		doc, err := s.decodeDocumentParams(message.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return documentSymbols(doc.symbols), nil
+	case "textDocument/rename":
+		var params RenameParams
+		doc, err := s.decodeDocumentParams(message.Params, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return rename(params.TextDocument.URI, doc, params.Position, params.NewName)
+	default:
+		return nil, &rpcError{
+			Code:    rpcMethodNotFound,
+			Message: fmt.Sprintf("Method `%s` is not supported", message.Method),
+		}
+	}
+}
+
+// Decodes the parameters of a request and returns the referenced document.
+func (s *Server) decodeDocumentParams(raw json.RawMessage, params any, identifier *TextDocumentIdentifier) (document, *rpcError) {
+	if err := json.Unmarshal(raw, params); err != nil {
+		return document{}, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+
+	doc, found := s.documents[identifier.URI]
+	if !found {
+		return document{}, &rpcError{
+			Code:    rpcInvalidParams,
+			Message: fmt.Sprintf("Document `%s` is not open", identifier.URI),
+		}
+	}
+
+	return doc, nil
+}
+
+//
+// Module resolution.
+//
+
+// Returns the Homescript ID of a document URI.
+func moduleOf(uri string) string {
+	base := path.Base(uri)
+	if unescaped, err := url.PathUnescape(base); err == nil {
+		base = unescaped
+	}
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// Returns the URI of another module, assuming that it is located next to the given document.
+func uriOfModule(documentURI string, module string) string {
+	dir := documentURI[:strings.LastIndex(documentURI, "/")+1]
+	return dir + url.PathEscape(module) + path.Ext(path.Base(documentURI))
+}
+
+func (s *Server) context(module string) types.ExecutionContextUser {
+	return types.NewExecutionContextUser(module, s.username, make(map[string]string))
+}
+
+func isBuiltinModule(module string) bool {
+	_, found := analyzer.BuiltinModules()[module]
+	return found
+}
+
+// Returns the symbols of a user module which is imported by the given document.
+// Modules which are open in the editor are preferred over the version the analyzer resolved while analyzing the document.
+func (s *Server) moduleSymbols(documentURI string, doc document, module string) (symbolIndex, bool) {
+	if open, found := s.documents[uriOfModule(documentURI, module)]; found && open.analyzed {
+		return open.symbols, true
+	}
+
+	return newSymbolIndex(doc.modules, module)
+}
+
+func importKind(keyword string) pAst.IMPORT_KIND {
+	switch keyword {
+	case importKeywordType:
+		return pAst.IMPORT_KIND_TYPE
+	case importKeywordTemplate:
+		return pAst.IMPORT_KIND_TEMPLATE
+	case importKeywordTrigger:
+		return pAst.IMPORT_KIND_TRIGGER
+	default:
+		return pAst.IMPORT_KIND_NORMAL
+	}
+}
+
+// Returns a human-readable description of a builtin import, `false` if it does not exist.
+func (s *Server) describeBuiltin(module string, name string, keyword string) (string, bool) {
+	res, _, valueFound := analyzer.GetImport(
+		s.context(module),
+		module,
+		name,
+		errors.Span{},
+		importKind(keyword),
+	)
+	if !valueFound {
+		return "", false
+	}
+
+	switch {
+	case res.Trigger != nil:
+		return fmt.Sprintf(
+			"trigger %s: %s\n// Callback: %s",
+			name,
+			fmt.Sprint(res.Trigger.TriggerFnType),
+			fmt.Sprint(res.Trigger.CallbackFnType),
+		), true
+	case res.Type != nil && keyword == importKeywordType:
+		return fmt.Sprintf("type %s = %s", name, fmt.Sprint(res.Type)), true
+	case res.Type != nil:
+		return fmt.Sprintf("%s: %s", name, fmt.Sprint(res.Type)), true
+	default:
+		return fmt.Sprintf("templ %s", name), true
+	}
+}
+
+//
+// Diagnostics.
+//
+
+func (s *Server) updateDocument(uri string, text string) error {
+	doc, diagnostics := s.analyze(uri, text)
+	s.documents[uri] = doc
+
+	return s.send(rpcNotification{
+		JSONRPC: jsonRPCVersion,
+		Method:  "textDocument/publishDiagnostics",
+		Params: PublishDiagnosticsParams{
+			URI:         uri,
+			Diagnostics: diagnostics,
+		},
+	})
+}
+
+func rangeOfSpan(span errors.Span) Range {
+	// Homescript locations are one-based.
+	toPosition := func(line, column int) Position {
+		if line > 0 {
+			line--
+		}
+		if column > 0 {
+			column--
+		}
+		return Position{Line: line, Character: column}
+	}
+
+	return Range{
+		Start: toPosition(int(span.Start.Line), int(span.Start.Column)),
+		// The end column is inclusive in Homescript but exclusive in LSP.
+		End: Position{
+			Line:      toPosition(int(span.End.Line), 0).Line,
+			Character: int(span.End.Column),
+		},
+	}
+}
+
+// Analyzes the document, returns its indexes and the diagnostics of the analyzer.
+func (s *Server) analyze(uri string, text string) (document, []Diagnostic) {
+	module := moduleOf(uri)
+	doc := document{index: newDocumentIndex(text)}
+	diagnostics := make([]Diagnostic, 0)
+
+	modules, res, err := s.manager.Analyze(
+		homescript.InputProgram{
+			ProgramText: text,
+			Filename:    module,
+		},
+		s.context(module),
+	)
+	if err != nil {
+		return doc, append(diagnostics, Diagnostic{
+			Severity: diagnosticSeverityError,
+			Source:   serverName,
+			Message:  fmt.Sprintf("Analysis failed: %s", err.Error()),
+		})
+	}
+
+	doc.modules = modules
+	doc.symbols, doc.analyzed = newSymbolIndex(modules, module)
+
+	for _, hmsErr := range res.Diagnostics {
+		message := ""
+		switch {
+		case hmsErr.SyntaxError != nil:
+			message = hmsErr.SyntaxError.Message
+		case hmsErr.DiagnosticError != nil:
+			message = strings.Join(append([]string{hmsErr.DiagnosticError.Message}, hmsErr.DiagnosticError.Notes...), "\n")
+		case hmsErr.RuntimeInterrupt != nil:
+			message = hmsErr.RuntimeInterrupt.Message
+		}
+
+		rng := rangeOfSpan(hmsErr.Span)
+
+		// Errors inside of imported modules are displayed at the beginning of the document.
+		if hmsErr.Span.Filename != module {
+			message = fmt.Sprintf("In module `%s`: %s", hmsErr.Span.Filename, message)
+			rng = Range{}
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    rng,
+			Severity: diagnosticSeverityError,
+			Source:   serverName,
+			Message:  message,
+		})
+	}
+
+	return doc, diagnostics
+}
+
+//
+// Completion.
+//
+
+func completionKindOf(kind pAst.IMPORT_KIND) (CompletionItemKind, string) {
+	switch kind {
+	case pAst.IMPORT_KIND_TYPE:
+		return completionKindStruct, importKeywordType
+	case pAst.IMPORT_KIND_TEMPLATE:
+		return completionKindStruct, importKeywordTemplate
+	case pAst.IMPORT_KIND_TRIGGER:
+		return completionKindEvent, importKeywordTrigger
+	default:
+		return completionKindFunction, ""
+	}
+}
+
+func (s *Server) completion(doc documentIndex, pos Position) ([]CompletionItem, *rpcError) {
+	offset := offsetOf(doc.source, pos)
+	prev := doc.tokenBefore(offset)
+
+	// The identifier which is currently being typed is replaced by the completion.
+	if prev >= 0 && doc.tokens[prev].kind == tokenIdent && doc.tokens[prev].end == offset {
+		prev--
+	}
+
+	switch {
+	case doc.isIdentValue(prev, "from"):
+		return s.moduleCompletions()
+	case doc.isPunct(prev, "."):
+		// Completing fields requires type information which is not available while the code is being edited.
+		return []CompletionItem{}, nil
+	}
+
+	if module, inside := importModuleAt(doc, prev); inside {
+		return s.memberCompletions(module)
+	}
+
+	items := make([]CompletionItem, 0)
+	seen := make(map[string]bool)
+
+	for _, decl := range doc.declarations {
+		if seen[decl.name] {
+			continue
+		}
+		seen[decl.name] = true
+
+		kind := completionKindVariable
+		if decl.kind == SymbolKindFunction {
+			kind = completionKindFunction
+		}
+		items = append(items, CompletionItem{Label: decl.name, Kind: kind, Detail: decl.detail})
+	}
+
+	for _, imported := range doc.imports {
+		if seen[imported.name] {
+			continue
+		}
+		seen[imported.name] = true
+		items = append(items, CompletionItem{
+			Label:  imported.name,
+			Kind:   completionKindFunction,
+			Detail: fmt.Sprintf("imported from `%s`", imported.module),
+		})
+	}
+
+	for _, keyword := range keywords {
+		items = append(items, CompletionItem{Label: keyword, Kind: completionKindKeyword})
+	}
+
+	return items, nil
+}
+
+// Reports whether the token is located inside the braces of an import statement.
+// If so, the name of the imported module is returned (which is empty if the statement is still incomplete).
+func importModuleAt(doc documentIndex, tokenIdx int) (string, bool) {
+	open := -1
+	for idx := tokenIdx; idx >= 0; idx-- {
+		if doc.isPunct(idx, "}") || doc.isPunct(idx, ";") {
+			return "", false
+		}
+		if doc.isPunct(idx, "{") {
+			open = idx
+			break
+		}
+	}
+	if open < 0 || !doc.isIdentValue(open-1, "import") {
+		return "", false
+	}
+
+	for idx := open + 1; idx < len(doc.tokens); idx++ {
+		if doc.isPunct(idx, ";") || doc.isPunct(idx, "{") {
+			break
+		}
+		if doc.isPunct(idx, "}") {
+			if doc.isIdentValue(idx+1, "from") && doc.isIdent(idx+2) {
+				return doc.tokens[idx+2].value, true
+			}
+			break
+		}
+	}
+
+	return "", true
+}
+
+func (s *Server) moduleCompletions() ([]CompletionItem, *rpcError) {
+	items := make([]CompletionItem, 0)
+
+	builtins := make([]string, 0)
+	for module := range analyzer.BuiltinModules() {
+		builtins = append(builtins, module)
+	}
+	sort.Strings(builtins)
+
+	for _, module := range builtins {
+		items = append(items, CompletionItem{Label: module, Kind: completionKindModule, Detail: "builtin module"})
+	}
+
+	scripts, err := database.ListHomescriptOfUser(s.username)
+	if err != nil {
+		return nil, &rpcError{Code: rpcRequestFailed, Message: "Could not list Homescripts: database failure"}
+	}
+	for _, script := range scripts {
+		items = append(items, CompletionItem{Label: script.Data.Id, Kind: completionKindModule, Detail: script.Data.Name})
+	}
+
+	libraries, err := database.ListHomescriptLibraries()
+	if err != nil {
+		return nil, &rpcError{Code: rpcRequestFailed, Message: "Could not list libraries: database failure"}
+	}
+	for _, library := range libraries {
+		if library.LatestVersion == 0 {
+			continue
+		}
+		canImport, err := database.UserCanImportHomescriptLibrary(library, s.username)
+		if err != nil {
+			return nil, &rpcError{Code: rpcRequestFailed, Message: "Could not list libraries: database failure"}
+		}
+		if canImport {
+			items = append(items, CompletionItem{Label: library.Name, Kind: completionKindModule, Detail: "library by " + library.Owner})
+		}
+	}
+
+	return items, nil
+}
+
+func (s *Server) memberCompletions(module string) ([]CompletionItem, *rpcError) {
+	items := make([]CompletionItem, 0)
+	if module == "" {
+		return items, nil
+	}
+
+	if members, found := analyzer.BuiltinModules()[module]; found {
+		for _, member := range members {
+			kind, keyword := completionKindOf(member.Kind)
+			detail, _ := s.describeBuiltin(module, member.Name, keyword)
+			items = append(items, CompletionItem{Label: member.Name, Kind: kind, Detail: detail})
+		}
+		return items, nil
+	}
+
+	script, found, err := s.manager.GetPersonalScriptById(module, s.username)
+	if err != nil {
+		return nil, &rpcError{Code: rpcRequestFailed, Message: "Could not load module: database failure"}
+	}
+	code := script.Data.Code
+	if !found {
+		code, found, err = database.ResolveHomescriptLibraryCode(module, s.username)
+		if err != nil {
+			return nil, &rpcError{Code: rpcRequestFailed, Message: "Could not load module: database failure"}
+		}
+		if !found {
+			return items, nil
+		}
+	}
+
+	for _, decl := range newDocumentIndex(code).declarations {
+		if !decl.public || !decl.topLevel {
+			continue
+		}
+
+		kind := completionKindVariable
+		switch decl.kind {
+		case SymbolKindFunction:
+			kind = completionKindFunction
+		case SymbolKindStruct:
+			kind = completionKindStruct
+		}
+		items = append(items, CompletionItem{Label: decl.name, Kind: kind, Detail: decl.detail})
+	}
+
+	return items, nil
+}
+
+//
+// Hover and go-to-definition.
+//
+
+func hmsMarkdown(code string) MarkupContent {
+	return MarkupContent{
+		Kind:  "markdown",
+		Value: fmt.Sprintf("```hms\n%s\n```", code),
+	}
+}
+
+// Resolves an imported name to its declaration inside of a user module.
+func (s *Server) resolveImport(uri string, doc document, sym symbol) (symbol, bool) {
+	module, found := s.moduleSymbols(uri, doc, sym.importedFrom)
+	if !found {
+		return symbol{}, false
+	}
+	return module.lookupTopLevel(sym.name)
+}
+
+func (s *Server) hover(uri string, doc document, pos Position) (*Hover, *rpcError) {
+	// The module of an import statement.
+	if module, found := doc.symbols.moduleAt(pos); found {
+		description := fmt.Sprintf("Homescript module `%s`", module.module)
+		if isBuiltinModule(module.module) {
+			description = fmt.Sprintf("Builtin module `%s`", module.module)
+		}
+		return &Hover{Contents: MarkupContent{Kind: "markdown", Value: description}, Range: &module.rng}, nil
+	}
+
+	sym, usages, found := doc.symbols.symbolAt(pos)
+	if !found {
+		return nil, nil
+	}
+	rng := usageAt(usages, pos)
+
+	if sym.importedFrom == "" {
+		return &Hover{Contents: hmsMarkdown(sym.detail), Range: &rng}, nil
+	}
+
+	if isBuiltinModule(sym.importedFrom) {
+		_, keyword := completionKindOf(sym.importKind)
+		description, found := s.describeBuiltin(sym.importedFrom, sym.name, keyword)
+		if !found {
+			return nil, nil
+		}
+		return &Hover{Contents: hmsMarkdown(description), Range: &rng}, nil
+	}
+
+	decl, found := s.resolveImport(uri, doc, sym)
+	if !found {
+		return nil, nil
+	}
+
+	return &Hover{Contents: hmsMarkdown(decl.detail), Range: &rng}, nil
+}
+
+// Returns the range of the usage at the given position.
+func usageAt(usages []symbolReference, pos Position) Range {
+	for _, usage := range usages {
+		if usage.rng.contains(pos) {
+			return usage.rng
+		}
+	}
+	return Range{}
+}
+
+func (s *Server) definition(uri string, doc document, pos Position) (*Location, *rpcError) {
+	// Jump from the module of an import statement to the module itself.
+	if module, found := doc.symbols.moduleAt(pos); found {
+		if isBuiltinModule(module.module) {
+			return nil, nil
+		}
+		return &Location{URI: uriOfModule(uri, module.module), Range: Range{}}, nil
+	}
+
+	sym, _, found := doc.symbols.symbolAt(pos)
+	if !found {
+		return nil, nil
+	}
+
+	if sym.importedFrom == "" {
+		return &Location{URI: uri, Range: sym.ident}, nil
+	}
+
+	// Builtin modules are not backed by any source code.
+	if isBuiltinModule(sym.importedFrom) {
+		return nil, nil
+	}
+
+	decl, found := s.resolveImport(uri, doc, sym)
+	if !found {
+		return nil, nil
+	}
+
+	return &Location{URI: uriOfModule(uri, sym.importedFrom), Range: decl.ident}, nil
+}
+
+//
+// Document symbols and rename.
+//
+
+func documentSymbols(index symbolIndex) []DocumentSymbol {
+	symbols := make([]DocumentSymbol, 0)
+
+	for _, sym := range index.symbols {
+		if !sym.topLevel || sym.importedFrom != "" {
+			continue
+		}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           sym.name,
+			Detail:         sym.detail,
+			Kind:           sym.kind,
+			Range:          sym.rng,
+			SelectionRange: sym.ident,
+		})
+	}
+
+	return symbols
+}
+
+func isValidIdent(name string) bool {
+	index := newDocumentIndex(name)
+	if len(index.tokens) != 1 || index.tokens[0].kind != tokenIdent || index.tokens[0].value != name {
+		return false
+	}
+	for _, keyword := range keywords {
+		if keyword == name {
+			return false
+		}
+	}
+	return true
+}
+
+// Renames a name which is declared in the document, other declarations of the same name (for instance shadowed variables) are not changed.
+// Only the current document is changed, usages in modules which import the name are not updated.
+func rename(uri string, doc document, pos Position, newName string) (*WorkspaceEdit, *rpcError) {
+	if !doc.analyzed {
+		return nil, &rpcError{Code: rpcRequestFailed, Message: "The document contains syntax errors"}
+	}
+
+	sym, usages, found := doc.symbols.symbolAt(pos)
+	if !found {
+		return nil, &rpcError{Code: rpcRequestFailed, Message: "There is no symbol at this position"}
+	}
+
+	if !isValidIdent(newName) {
+		return nil, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("`%s` is not a valid identifier", newName)}
+	}
+
+	// Imported names have to match the name of the declaration inside of their module.
+	if sym.importedFrom != "" {
+		return nil, &rpcError{Code: rpcRequestFailed, Message: fmt.Sprintf("`%s` is imported from module `%s` and can only be renamed there", sym.name, sym.importedFrom)}
+	}
+
+	// The analyzer resolves type names, so their usages are not part of the AST.
+	if sym.kind == SymbolKindStruct {
+		return nil, &rpcError{Code: rpcRequestFailed, Message: fmt.Sprintf("`%s` is a type, renaming types is not supported", sym.name)}
+	}
+
+	edits := make([]TextEdit, 0, len(usages))
+	for _, usage := range usages {
+		edits = append(edits, TextEdit{Range: usage.rng, NewText: newName})
+	}
+
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{uri: edits}}, nil
+}
@@ -0,0 +1,490 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	pAst "github.com/smarthome-go/homescript/v3/homescript/parser/ast"
+)
+
+// Hover, go-to-definition, document symbols and rename work on the AST of the analyzer.
+// Names are resolved using the same scoping rules as the analyzer, so shadowed variables are distinct symbols.
+// If the document contains syntax errors, there is no AST and these requests do not yield any results.
+
+// A function, variable, parameter, type or imported name declared in a module.
+type symbol struct {
+	name     string
+	kind     SymbolKind
+	public   bool
+	topLevel bool
+	// The human-readable declaration including its type, for instance the signature of a function.
+	detail string
+	// The range of the identifier which declares the symbol.
+	ident Range
+	// The range of the entire declaration.
+	rng Range
+	// The module which declares the name if the symbol is imported, empty otherwise.
+	importedFrom string
+	importKind   pAst.IMPORT_KIND
+}
+
+// A usage of a symbol (including the identifier of its declaration).
+type symbolReference struct {
+	rng    Range
+	symbol int
+}
+
+// An import statement, the range is the one of the module name.
+type moduleReference struct {
+	module string
+	rng    Range
+}
+
+// A call of a function or of a method, see `ScanReferences`.
+type callSite struct {
+	// The symbol of the called function, -1 for method calls.
+	function int
+	// The store which the method is called on, `nil` if the receiver is not a store.
+	store  *storeReference
+	method string
+	args   []ast.AnalyzedExpression
+}
+
+// A store of the typed storage, see `storage.store` and `storage.open_store`.
+type storeReference struct {
+	// The name passed to `open_store`, empty for the store of the script itself.
+	name string
+	// Set if the store is opened using a name which is not a string literal.
+	dynamic bool
+}
+
+type symbolIndex struct {
+	symbols    []symbol
+	references []symbolReference
+	modules    []moduleReference
+	calls      []callSite
+}
+
+// Builds the symbol index of a module, the module has to be part of the analyzed modules.
+// Returns `false` if the module has not been analyzed, for instance due to syntax errors.
+func newSymbolIndex(modules map[string]ast.AnalyzedProgram, module string) (symbolIndex, bool) {
+	program, found := modules[module]
+	if !found {
+		return symbolIndex{}, false
+	}
+
+	builder := symbolIndexBuilder{
+		index: symbolIndex{
+			symbols:    make([]symbol, 0),
+			references: make([]symbolReference, 0),
+			modules:    make([]moduleReference, 0),
+			calls:      make([]callSite, 0),
+		},
+		scopes: []map[string]int{make(map[string]int)},
+		stores: make(map[int]*storeReference),
+	}
+	builder.program(program)
+
+	return builder.index, true
+}
+
+// Returns the symbol which is referenced at the given position.
+func (i symbolIndex) symbolAt(pos Position) (symbol, []symbolReference, bool) {
+	for _, ref := range i.references {
+		if !ref.rng.contains(pos) {
+			continue
+		}
+
+		usages := make([]symbolReference, 0)
+		for _, other := range i.references {
+			if other.symbol == ref.symbol {
+				usages = append(usages, other)
+			}
+		}
+
+		return i.symbols[ref.symbol], usages, true
+	}
+
+	return symbol{}, nil, false
+}
+
+// Returns the module name of the import statement at the given position.
+func (i symbolIndex) moduleAt(pos Position) (moduleReference, bool) {
+	for _, module := range i.modules {
+		if module.rng.contains(pos) {
+			return module, true
+		}
+	}
+	return moduleReference{}, false
+}
+
+// Returns the top-level symbol of the given name which is not imported.
+func (i symbolIndex) lookupTopLevel(name string) (symbol, bool) {
+	for _, sym := range i.symbols {
+		if sym.topLevel && sym.importedFrom == "" && sym.name == name {
+			return sym, true
+		}
+	}
+	return symbol{}, false
+}
+
+//
+// Index construction.
+//
+
+type symbolIndexBuilder struct {
+	index symbolIndex
+	// The innermost scope is the last one, it maps names to the index of their symbol.
+	scopes []map[string]int
+	// The stores which variables are initialized with.
+	stores map[int]*storeReference
+}
+
+func (b *symbolIndexBuilder) pushScope() {
+	b.scopes = append(b.scopes, make(map[string]int))
+}
+
+func (b *symbolIndexBuilder) popScope() {
+	b.scopes = b.scopes[:len(b.scopes)-1]
+}
+
+// Declares a symbol in the current scope, the identifier of the declaration is recorded as a reference.
+// Returns the index of the new symbol.
+func (b *symbolIndexBuilder) declare(sym symbol) int {
+	sym.topLevel = len(b.scopes) == 1
+
+	b.index.symbols = append(b.index.symbols, sym)
+	id := len(b.index.symbols) - 1
+
+	b.scopes[len(b.scopes)-1][sym.name] = id
+	b.index.references = append(b.index.references, symbolReference{rng: sym.ident, symbol: id})
+
+	return id
+}
+
+// Resolves a name using the innermost scope which declares it.
+// Builtin values like `println` are not declared anywhere, `false` is returned for them.
+func (b *symbolIndexBuilder) resolve(ident pAst.SpannedIdent) (int, bool) {
+	for scope := len(b.scopes) - 1; scope >= 0; scope-- {
+		if id, found := b.scopes[scope][ident.Ident()]; found {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (b *symbolIndexBuilder) use(ident pAst.SpannedIdent) {
+	if id, found := b.resolve(ident); found {
+		b.index.references = append(b.index.references, symbolReference{
+			rng:    rangeOfSpan(ident.Span()),
+			symbol: id,
+		})
+	}
+}
+
+// Reports whether the symbol is the given function of a builtin module.
+func (b *symbolIndexBuilder) isBuiltinImport(id int, module string, name string) bool {
+	sym := b.index.symbols[id]
+	return sym.importedFrom == module && sym.name == name && sym.importKind == pAst.IMPORT_KIND_NORMAL
+}
+
+// Returns the store an expression evaluates to, `nil` if it is not a store.
+// Stores are recognized if they are used directly or if they are assigned to a variable when it is declared.
+func (b *symbolIndexBuilder) storeOf(expression ast.AnalyzedExpression) *storeReference {
+	switch node := expression.(type) {
+	case ast.AnalyzedGroupedExpression:
+		return b.storeOf(node.Inner)
+	case ast.AnalyzedIdentExpression:
+		id, found := b.resolve(node.Ident)
+		if !found {
+			return nil
+		}
+		if b.isBuiltinImport(id, "storage", "store") {
+			return &storeReference{}
+		}
+		return b.stores[id]
+	case ast.AnalyzedCallExpression:
+		base, isIdent := node.Base.(ast.AnalyzedIdentExpression)
+		if !isIdent {
+			return nil
+		}
+		id, found := b.resolve(base.Ident)
+		if !found || !b.isBuiltinImport(id, "storage", "open_store") {
+			return nil
+		}
+		if len(node.Arguments.List) == 0 {
+			return &storeReference{dynamic: true}
+		}
+		name, isLiteral := node.Arguments.List[0].Expression.(ast.AnalyzedStringLiteralExpression)
+		if !isLiteral {
+			return &storeReference{dynamic: true}
+		}
+		return &storeReference{name: name.Value}
+	default:
+		return nil
+	}
+}
+
+func (b *symbolIndexBuilder) call(node ast.AnalyzedCallExpression) {
+	args := make([]ast.AnalyzedExpression, 0, len(node.Arguments.List))
+	for _, arg := range node.Arguments.List {
+		args = append(args, arg.Expression)
+	}
+
+	switch base := node.Base.(type) {
+	case ast.AnalyzedIdentExpression:
+		if id, found := b.resolve(base.Ident); found {
+			b.index.calls = append(b.index.calls, callSite{function: id, args: args})
+		}
+	case ast.AnalyzedMemberExpression:
+		b.index.calls = append(b.index.calls, callSite{
+			function: -1,
+			store:    b.storeOf(base.Base),
+			method:   base.Member.Ident(),
+			args:     args,
+		})
+	}
+}
+
+func (b *symbolIndexBuilder) program(program ast.AnalyzedProgram) {
+	// All top-level names are visible inside of every function, regardless of the order of their declaration.
+	for _, imported := range program.Imports {
+		b.index.modules = append(b.index.modules, moduleReference{
+			module: imported.FromModule.Ident(),
+			rng:    rangeOfSpan(imported.FromModule.Span()),
+		})
+
+		for _, value := range imported.ToImport {
+			kind := SymbolKindFunction
+			if value.Kind == pAst.IMPORT_KIND_TYPE || value.Kind == pAst.IMPORT_KIND_TEMPLATE {
+				kind = SymbolKindStruct
+			}
+
+			b.declare(symbol{
+				name:         value.Ident.Ident(),
+				kind:         kind,
+				ident:        rangeOfSpan(value.Ident.Span()),
+				rng:          rangeOfSpan(value.Ident.Span()),
+				importedFrom: imported.FromModule.Ident(),
+				importKind:   value.Kind,
+			})
+		}
+	}
+
+	for _, typeDef := range program.Types {
+		b.typeDefinition(typeDef)
+	}
+
+	for _, global := range program.Globals {
+		b.declare(letSymbol(global))
+	}
+
+	for _, fn := range program.Functions {
+		b.declare(symbol{
+			name:   fn.Ident.Ident(),
+			kind:   SymbolKindFunction,
+			public: fn.Modifier == pAst.FN_MODIFIER_PUB,
+			detail: functionSignature(fn),
+			ident:  rangeOfSpan(fn.Ident.Span()),
+			rng:    rangeOfSpan(fn.Range),
+		})
+	}
+
+	for _, global := range program.Globals {
+		b.expression(global.Expression)
+	}
+
+	for _, fn := range program.Functions {
+		b.function(fn.Parameters.List, fn.Body)
+	}
+
+	for _, impl := range program.ImplBlocks {
+		for _, method := range impl.Methods {
+			b.function(method.Parameters.List, method.Body)
+		}
+	}
+}
+
+func (b *symbolIndexBuilder) typeDefinition(typeDef ast.AnalyzedTypeDefinition) {
+	b.declare(symbol{
+		name:   typeDef.LhsIdent.Ident(),
+		kind:   SymbolKindStruct,
+		public: typeDef.IsPub,
+		detail: pubPrefix(typeDef.IsPub) + fmt.Sprintf("type %s = %s", typeDef.LhsIdent.Ident(), fmt.Sprint(typeDef.RhsType)),
+		ident:  rangeOfSpan(typeDef.LhsIdent.Span()),
+		rng:    rangeOfSpan(typeDef.Range),
+	})
+}
+
+func (b *symbolIndexBuilder) function(params []ast.AnalyzedFnParam, body ast.AnalyzedBlock) {
+	b.pushScope()
+	defer b.popScope()
+
+	for _, param := range params {
+		b.declare(symbol{
+			name:   param.Ident.Ident(),
+			kind:   SymbolKindVariable,
+			detail: fmt.Sprintf("%s: %s", param.Ident.Ident(), fmt.Sprint(param.Type)),
+			ident:  rangeOfSpan(param.Ident.Span()),
+			rng:    rangeOfSpan(param.Span),
+		})
+	}
+
+	b.block(body)
+}
+
+func (b *symbolIndexBuilder) block(block ast.AnalyzedBlock) {
+	b.pushScope()
+	defer b.popScope()
+
+	for _, statement := range block.Statements {
+		b.statement(statement)
+	}
+
+	if block.Expression != nil {
+		b.expression(block.Expression)
+	}
+}
+
+func (b *symbolIndexBuilder) statement(statement ast.AnalyzedStatement) {
+	switch node := statement.(type) {
+	case ast.AnalyzedTypeDefinition:
+		b.typeDefinition(node)
+	case ast.AnalyzedLetStatement:
+		// The variable is not visible inside of its own initializer.
+		b.expression(node.Expression)
+		store := b.storeOf(node.Expression)
+		id := b.declare(letSymbol(node))
+		if store != nil {
+			b.stores[id] = store
+		}
+	case ast.AnalyzedReturnStatement:
+		if node.ReturnValue != nil {
+			b.expression(node.ReturnValue)
+		}
+	case ast.AnalyzedLoopStatement:
+		b.block(node.Body)
+	case ast.AnalyzedWhileStatement:
+		b.expression(node.Condition)
+		b.block(node.Body)
+	case ast.AnalyzedForStatement:
+		b.expression(node.IterExpression)
+
+		b.pushScope()
+		b.declare(symbol{
+			name:   node.Identifier.Ident(),
+			kind:   SymbolKindVariable,
+			detail: fmt.Sprintf("let %s: %s", node.Identifier.Ident(), fmt.Sprint(node.IterVarType)),
+			ident:  rangeOfSpan(node.Identifier.Span()),
+			rng:    rangeOfSpan(node.Identifier.Span()),
+		})
+		b.block(node.Body)
+		b.popScope()
+	case ast.AnalyzedExpressionStatement:
+		b.expression(node.Expression)
+	}
+}
+
+func (b *symbolIndexBuilder) expression(expression ast.AnalyzedExpression) {
+	switch node := expression.(type) {
+	case ast.AnalyzedIdentExpression:
+		b.use(node.Ident)
+	case ast.AnalyzedRangeLiteralExpression:
+		b.expression(node.Start)
+		b.expression(node.End)
+	case ast.AnalyzedListLiteralExpression:
+		for _, value := range node.Values {
+			b.expression(value)
+		}
+	case ast.AnalyzedObjectLiteralExpression:
+		for _, field := range node.Fields {
+			b.expression(field.Expression)
+		}
+	case ast.AnalyzedFunctionLiteralExpression:
+		b.function(node.Parameters, node.Body)
+	case ast.AnalyzedGroupedExpression:
+		b.expression(node.Inner)
+	case ast.AnalyzedPrefixExpression:
+		b.expression(node.Base)
+	case ast.AnalyzedInfixExpression:
+		b.expression(node.Lhs)
+		b.expression(node.Rhs)
+	case ast.AnalyzedAssignExpression:
+		b.expression(node.Lhs)
+		b.expression(node.Rhs)
+	case ast.AnalyzedCallExpression:
+		b.call(node)
+		b.expression(node.Base)
+		for _, arg := range node.Arguments.List {
+			b.expression(arg.Expression)
+		}
+	case ast.AnalyzedIndexExpression:
+		b.expression(node.Base)
+		b.expression(node.Index)
+	case ast.AnalyzedMemberExpression:
+		// The member is a field of the base, not a name of any scope.
+		b.expression(node.Base)
+	case ast.AnalyzedCastExpression:
+		b.expression(node.Base)
+	case ast.AnalyzedBlockExpression:
+		b.block(node.Block)
+	case ast.AnalyzedIfExpression:
+		b.expression(node.Condition)
+		b.block(node.ThenBlock)
+		if node.ElseBlock != nil {
+			b.block(*node.ElseBlock)
+		}
+	case ast.AnalyzedMatchExpression:
+		b.expression(node.ControlExpression)
+		for _, arm := range node.Arms {
+			b.expression(arm.Literal)
+			b.expression(arm.Action)
+		}
+		if node.DefaultArmAction != nil {
+			b.expression(*node.DefaultArmAction)
+		}
+	case ast.AnalyzedTryExpression:
+		b.block(node.TryBlock)
+
+		b.pushScope()
+		b.declare(symbol{
+			name:   node.CatchIdent.Ident(),
+			kind:   SymbolKindVariable,
+			detail: fmt.Sprintf("catch %s", node.CatchIdent.Ident()),
+			ident:  rangeOfSpan(node.CatchIdent.Span()),
+			rng:    rangeOfSpan(node.CatchIdent.Span()),
+		})
+		b.block(node.CatchBlock)
+		b.popScope()
+	}
+	// Literals do not contain any names.
+}
+
+func letSymbol(node ast.AnalyzedLetStatement) symbol {
+	return symbol{
+		name:   node.Ident.Ident(),
+		kind:   SymbolKindVariable,
+		public: node.IsPub,
+		detail: pubPrefix(node.IsPub) + fmt.Sprintf("let %s: %s", node.Ident.Ident(), fmt.Sprint(node.VarType)),
+		ident:  rangeOfSpan(node.Ident.Span()),
+		rng:    rangeOfSpan(node.Range),
+	}
+}
+
+func functionSignature(fn ast.AnalyzedFunctionDefinition) string {
+	params := make([]string, 0, len(fn.Parameters.List))
+	for _, param := range fn.Parameters.List {
+		params = append(params, fmt.Sprintf("%s: %s", param.Ident.Ident(), fmt.Sprint(param.Type)))
+	}
+
+	return pubPrefix(fn.Modifier == pAst.FN_MODIFIER_PUB) +
+		fmt.Sprintf("fn %s(%s) -> %s", fn.Ident.Ident(), strings.Join(params, ", "), fmt.Sprint(fn.ReturnType))
+}
+
+func pubPrefix(public bool) string {
+	if public {
+		return "pub "
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smarthome-go/homescript/v3/homescript"
+	hmsAnalyzer "github.com/smarthome-go/homescript/v3/homescript/analyzer"
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	"github.com/smarthome-go/homescript/v3/homescript/diagnostic"
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	pAst "github.com/smarthome-go/homescript/v3/homescript/parser/ast"
+	"github.com/smarthome-go/smarthome/core/homescript/analyzer"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// Resolves builtin modules like the manager does, user modules are taken from the map.
+type testAnalyzerHost struct {
+	modules map[string]string
+}
+
+func (testAnalyzerHost) GetKnownObjectTypeFieldAnnotations() []string {
+	return []string{}
+}
+
+func (testAnalyzerHost) PostValidationHook(
+	_ map[string]ast.AnalyzedProgram,
+	_ string,
+	_ *hmsAnalyzer.Analyzer,
+	_ bool,
+) []diagnostic.Diagnostic {
+	return nil
+}
+
+func (testAnalyzerHost) GetBuiltinImport(
+	moduleName string,
+	valueName string,
+	span errors.Span,
+	kind pAst.IMPORT_KIND,
+) (hmsAnalyzer.BuiltinImport, bool, bool) {
+	return analyzer.GetImport(
+		types.NewExecutionContextUser(moduleName, "admin", make(map[string]string)),
+		moduleName,
+		valueName,
+		span,
+		kind,
+	)
+}
+
+func (h testAnalyzerHost) ResolveCodeModule(moduleName string) (string, bool, error) {
+	code, found := h.modules[moduleName]
+	return code, found, nil
+}
+
+func analyzeTestDocument(t *testing.T, module string, code string, modules map[string]string) document {
+	analyzed, _, syntaxErrors := homescript.Analyze(
+		homescript.InputProgram{ProgramText: code, Filename: module},
+		analyzer.AnalyzerScopeAdditions(),
+		testAnalyzerHost{modules: modules},
+		true,
+	)
+	assert.Empty(t, syntaxErrors)
+
+	symbols, found := newSymbolIndex(analyzed, module)
+	assert.True(t, found)
+
+	return document{
+		index:    newDocumentIndex(code),
+		symbols:  symbols,
+		modules:  analyzed,
+		analyzed: found,
+	}
+}
+
+const symbolsTestCode = `import { set_power } from device;
+import { helper } from utils;
+
+type Room = { name: str };
+
+pub fn toggle(id: str, on: bool) -> bool {
+    set_power(id, on);
+    helper(id)
+}
+
+fn main() {
+    let count = 1;
+    if toggle("lamp", true) {
+        let count = "shadowed";
+        println(count);
+    }
+    println(count + 1);
+}
+`
+
+const symbolsTestUtils = `pub fn helper(id: str) -> bool { id == "lamp" }
+`
+
+func TestSymbolIndex(t *testing.T) {
+	doc := analyzeTestDocument(t, "example", symbolsTestCode, map[string]string{"utils": symbolsTestUtils})
+
+	symbols := documentSymbols(doc.symbols)
+	names := make([]string, 0)
+	for _, sym := range symbols {
+		names = append(names, sym.Name)
+	}
+	assert.Equal(t, []string{"Room", "toggle", "main"}, names)
+	assert.Equal(t, "pub fn toggle(id: str, on: bool) -> bool", symbols[1].Detail)
+	assert.Equal(t, Range{Start: Position{Line: 5, Character: 7}, End: Position{Line: 5, Character: 13}}, symbols[1].SelectionRange)
+
+	// The usage of the outer variable resolves to its declaration, not to the shadowing one.
+	sym, usages, found := doc.symbols.symbolAt(Position{Line: 16, Character: 13})
+	assert.True(t, found)
+	assert.Equal(t, "let count: int", sym.detail)
+	assert.Equal(t, []symbolReference{
+		{rng: Range{Start: Position{Line: 11, Character: 8}, End: Position{Line: 11, Character: 13}}, symbol: usages[0].symbol},
+		{rng: Range{Start: Position{Line: 16, Character: 12}, End: Position{Line: 16, Character: 17}}, symbol: usages[0].symbol},
+	}, usages)
+
+	inner, _, found := doc.symbols.symbolAt(Position{Line: 14, Character: 17})
+	assert.True(t, found)
+	assert.Equal(t, "let count: str", inner.detail)
+
+	helper, _, found := doc.symbols.symbolAt(Position{Line: 7, Character: 5})
+	assert.True(t, found)
+	assert.Equal(t, "utils", helper.importedFrom)
+
+	module, found := doc.symbols.moduleAt(Position{Line: 1, Character: 25})
+	assert.True(t, found)
+	assert.Equal(t, "utils", module.module)
+
+	// Fields and builtin values are not symbols of the document.
+	_, _, found = doc.symbols.symbolAt(Position{Line: 14, Character: 10})
+	assert.False(t, found)
+}
+
+func TestRename(t *testing.T) {
+	uri := "hms:///scripts/example.hms"
+	doc := analyzeTestDocument(t, "example", symbolsTestCode, map[string]string{"utils": symbolsTestUtils})
+
+	// `toggle` is declared at line 5 and used in `main`.
+	edit, err := rename(uri, doc, Position{Line: 5, Character: 9}, "switch_lamp")
+	assert.Nil(t, err)
+	assert.Len(t, edit.Changes[uri], 2)
+
+	// Renaming the outer variable must not touch the shadowing one.
+	edit, err = rename(uri, doc, Position{Line: 11, Character: 9}, "total")
+	assert.Nil(t, err)
+	assert.Equal(t, []TextEdit{
+		{Range: Range{Start: Position{Line: 11, Character: 8}, End: Position{Line: 11, Character: 13}}, NewText: "total"},
+		{Range: Range{Start: Position{Line: 16, Character: 12}, End: Position{Line: 16, Character: 17}}, NewText: "total"},
+	}, edit.Changes[uri])
+
+	// Parameters are local to their function.
+	edit, err = rename(uri, doc, Position{Line: 5, Character: 15}, "device_id")
+	assert.Nil(t, err)
+	assert.Len(t, edit.Changes[uri], 3)
+
+	// Imported names can only be renamed inside of their module.
+	_, err = rename(uri, doc, Position{Line: 6, Character: 6}, "power")
+	assert.NotNil(t, err)
+
+	_, err = rename(uri, doc, Position{Line: 3, Character: 6}, "Place")
+	assert.NotNil(t, err)
+
+	_, err = rename(uri, doc, Position{Line: 5, Character: 9}, "let")
+	assert.NotNil(t, err)
+
+	_, err = rename(uri, document{index: newDocumentIndex("fn main( {")}, Position{}, "main")
+	assert.NotNil(t, err)
+}
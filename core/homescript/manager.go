@@ -104,6 +104,8 @@ func (m *Manager) AllocJobId() uint64 {
 			m.Lock.Unlock()
 			return potential
 		}
+
+		m.Lock.Unlock()
 	}
 }
 
@@ -329,7 +331,19 @@ func (m *Manager) RunGeneric(
 	outputWriter io.Writer,
 	shouldProcessAnnotations bool,
 	stdin *types.StdinBuffer,
-) (types.HmsRes, error) {
+) (res types.HmsRes, err error) {
+	// Once the job has finished or failed to start, it is recorded in the execution history (test runs are not recorded).
+	startTime := time.Now()
+	exitCode := int64(0)
+	if invocation.Mocks == nil {
+		history := newHistoryWriter(outputWriter)
+		outputWriter = history
+
+		defer func() {
+			m.recordRun(invocation.Identifier.Filename, context, startTime, history, exitCode, res, err)
+		}()
+	}
+
 	modules, analyzerRes, err := m.Analyze(
 		invocation.Identifier,
 		context,
@@ -349,9 +363,41 @@ func (m *Manager) RunGeneric(
 		}, nil
 	}
 
-	logger.Tracef("Homescript `%s` is being compiled...", invocation.Identifier.Filename)
+	if invocation.Debugger != nil && !runtime.VM_DEBUGGER {
+		return types.HmsRes{}, fmt.Errorf("Debugging is not supported by the Homescript runtime of this build")
+	}
+
+	//
+	// Enforce the resource quota of this context.
+	//
+
+	quota, err := ResolveQuota(context)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+
+	jobID, reserved := m.reserveQuotaJob(context, quota.MaxConcurrentJobs)
+	if !reserved {
+		message := fmt.Sprintf("Maximum number of %d concurrent jobs reached", quota.MaxConcurrentJobs)
+		logQuotaViolation(invocation.Identifier.Filename, context, message)
+
+		return types.HmsRes{
+			Errors: types.HmsDiagnosticsContainer{
+				ContainsError: true,
+				Diagnostics:   []types.HmsError{quotaExceededError(message)},
+				FileContents:  analyzerRes.FileContents,
+			},
+		}, nil
+	}
+
+	// Releases the reserved slot once the job has finished or failed to start.
+	defer m.removeJob(jobID)
 
-	jobID := m.AllocJobId()
+	guard, cancelation := newQuotaGuard(quota, cancelation)
+	defer cancelation.CancelFunc()
+	outputWriter = guard.writer(outputWriter, quota.MaxOutputBytes)
+
+	logger.Tracef("Homescript `%s` is being compiled...", invocation.Identifier.Filename)
 
 	compOut, err := m.Compile(
 		modules,
@@ -372,6 +418,7 @@ func (m *Manager) RunGeneric(
 		context,
 		stdin,
 		m,
+		invocation.Mocks,
 	)
 
 	//
@@ -403,7 +450,7 @@ func (m *Manager) RunGeneric(
 		&cancelation.Context,
 		&cancelation.CancelFunc,
 		executor.InterpreterScopeAdditions(),
-		VM_LIMITS,
+		quotaLimits(quota),
 	)
 
 	m.setJob(
@@ -414,10 +461,7 @@ func (m *Manager) RunGeneric(
 		context,
 	)
 
-	defer func() {
-		ex.Free()
-		m.removeJob(jobID)
-	}()
+	defer ex.Free()
 
 	// Send the id to the id channel (only if it exists).
 	if idChan != nil {
@@ -441,9 +485,23 @@ func (m *Manager) RunGeneric(
 	debuggerOut := make(chan runtime.DebugOutput)
 	debuggerIn := make(chan struct{})
 
-	coreMain := vm.SpawnAsync(functionInvocation, &debuggerOut, &debuggerIn, nil)
+	// The instruction limit is enforced by counting the debug output of the VM.
+	vmOut, vmIn := &debuggerOut, &debuggerIn
+	if quota.MaxInstructions != 0 {
+		if runtime.VM_DEBUGGER {
+			stopMeter := make(chan struct{})
+			defer close(stopMeter)
+			vmOut, vmIn = guard.meterInstructions(quota.MaxInstructions, &debuggerOut, &debuggerIn, stopMeter)
+		} else {
+			logger.Warnf("Instruction limit of Homescript `%s` is not enforced: the Homescript runtime of this build does not emit debug output", invocation.Identifier.Filename)
+		}
+	}
 
-	if runtime.VM_DEBUGGER {
+	coreMain := vm.SpawnAsync(functionInvocation, vmOut, vmIn, nil)
+
+	if invocation.Debugger != nil {
+		go invocation.Debugger.Mainloop(&vm, &debuggerOut, &debuggerIn)
+	} else if runtime.VM_DEBUGGER {
 		dbg := homescript.NewDebugger(
 			&debuggerOut,
 			&debuggerIn,
@@ -476,6 +534,7 @@ func (m *Manager) RunGeneric(
 		switch i.Kind() {
 		case value.Vm_ExitInterruptKind: // ignore this
 			exitI := i.(value.Vm_ExitInterrupt)
+			exitCode = int64(exitI.Code)
 			if exitI.Code != 0 {
 				errors = append(errors, types.HmsError{
 					RuntimeInterrupt: &types.HmsRuntimeInterrupt{
@@ -498,6 +557,11 @@ func (m *Manager) RunGeneric(
 		case value.Vm_FatalExceptionInterruptKind:
 			runtimeI := i.(value.VmFatalException)
 			span = runtimeI.Span
+
+			// Limits of the VM which were lowered by the quota are reported as quota violations.
+			if violation := coreLimitViolation(quota, runtimeI.Message()); violation != nil {
+				guard.interrupt(*violation)
+			}
 		default:
 			panic(fmt.Sprintf("Another fatal interrupt was added without updating this code: %s", i.Kind()))
 		}
@@ -514,6 +578,19 @@ func (m *Manager) RunGeneric(
 			})
 		}
 
+		// If the job was interrupted due to its quota, report the violation instead of the cancelation.
+		if violation := guard.Violation(); violation != nil {
+			logQuotaViolation(invocation.Identifier.Filename, context, *violation)
+
+			quotaErr := quotaExceededError(*violation)
+			quotaErr.Span = span
+			errors = []types.HmsError{quotaErr}
+			isErr = true
+		}
+
+		// Thrown messages might contain secrets, these must neither be returned nor logged or recorded.
+		ex.RedactErrors(errors)
+
 		if isErr {
 			fileContentsTemp, err := m.resolveFileContentsOfErrors(
 				invocation.Identifier,
@@ -556,6 +633,7 @@ func (m *Manager) RunGeneric(
 			Singletons:  nil,
 			ReturnValue: nil,
 			// CalledFunctionSpan: span,
+			Redactor: ex.RedactSecrets,
 		}, nil
 	}
 
@@ -608,6 +686,7 @@ func (m *Manager) RunGeneric(
 		Singletons:         singletons,
 		ReturnValue:        spawnResult.ReturnValue,
 		CalledFunctionSpan: calledFunctionSpan,
+		Redactor:           ex.RedactSecrets,
 	}, nil
 }
 
@@ -825,7 +904,8 @@ func (m *Manager) GetJobById(jobID uint64) (types.Job, bool) {
 // The returned boolean indicates whether a job was killed or not
 func (m *Manager) Kill(jobID uint64) bool {
 	job, found := m.GetJobById(jobID)
-	if !found {
+	// Reserved jobs which are still compiling cannot be killed yet.
+	if !found || job.VM == nil {
 		return false
 	}
 
@@ -839,7 +919,7 @@ func (m *Manager) KillAllId(hmsId string) (count uint64, success bool) {
 	m.Lock.Lock()
 	defer m.Lock.Unlock()
 	for _, job := range m.Jobs {
-		if job.HmsID != hmsId {
+		if job.HmsID != hmsId || job.VM == nil {
 			continue
 		}
 
@@ -957,6 +1037,11 @@ func (m *Manager) GetUserDirectJobs(username string) []ApiJob {
 			continue
 		}
 
+		// Skip jobs which are reserved but not yet running
+		if job.VM == nil {
+			continue
+		}
+
 		// Skip any indirect jobs | TODO: do this
 		// if len(job.Executor.CallStack) > 1 {
 		// 	continue
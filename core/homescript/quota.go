@@ -0,0 +1,388 @@
+package homescript
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smarthome-go/homescript/v3/homescript/runtime"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/event"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+func quotaContextOf(context types.ExecutionContext) database.HomescriptQuotaContext {
+	switch context.Kind() {
+	case types.HMS_PROGRAM_KIND_AUTOMATION:
+		return database.HomescriptQuotaContextAutomation
+	case types.HMS_PROGRAM_KIND_DEVICE_DRIVER:
+		return database.HomescriptQuotaContextDriver
+	case types.HMS_PROGRAM_KIND_WEBHOOK:
+		return database.HomescriptQuotaContextWebhook
+	default:
+		return database.HomescriptQuotaContextUser
+	}
+}
+
+type quotaCacheKey struct {
+	// Is the default username for contexts without a user.
+	username string
+	context  database.HomescriptQuotaContext
+}
+
+// Resolved quotas are cached as they are needed for every job.
+// The generation prevents lookups which raced with an invalidation from populating the cache.
+var (
+	quotaCache           = make(map[quotaCacheKey]database.HomescriptQuotaData)
+	quotaCacheGeneration uint64
+	quotaCacheLock       sync.RWMutex
+)
+
+// Drops all cached quotas, must be called after quotas were modified or deleted.
+func InvalidateQuotaCache() {
+	quotaCacheLock.Lock()
+	defer quotaCacheLock.Unlock()
+
+	quotaCache = make(map[quotaCacheKey]database.HomescriptQuotaData)
+	quotaCacheGeneration++
+}
+
+// Returns the quota which applies to the given execution context.
+// Individual user quotas take precedence over the default quota of the context.
+// If no quota is configured, the returned quota does not impose any limits.
+func ResolveQuota(context types.ExecutionContext) (database.HomescriptQuotaData, error) {
+	key := quotaCacheKey{
+		username: database.HomescriptQuotaDefaultUsername,
+		context:  quotaContextOf(context),
+	}
+	if context.Username() != nil {
+		key.username = *context.Username()
+	}
+
+	quotaCacheLock.RLock()
+	quota, cached := quotaCache[key]
+	generation := quotaCacheGeneration
+	quotaCacheLock.RUnlock()
+
+	if cached {
+		return quota, nil
+	}
+
+	quota, err := resolveQuotaUncached(key)
+	if err != nil {
+		return database.HomescriptQuotaData{}, err
+	}
+
+	quotaCacheLock.Lock()
+	if generation == quotaCacheGeneration {
+		quotaCache[key] = quota
+	}
+	quotaCacheLock.Unlock()
+
+	return quota, nil
+}
+
+func resolveQuotaUncached(key quotaCacheKey) (database.HomescriptQuotaData, error) {
+	if key.username != database.HomescriptQuotaDefaultUsername {
+		quota, found, err := database.GetHomescriptQuota(key.username, key.context)
+		if err != nil {
+			return database.HomescriptQuotaData{}, err
+		}
+		if found {
+			return quota.Data, nil
+		}
+	}
+
+	quota, found, err := database.GetHomescriptQuota(database.HomescriptQuotaDefaultUsername, key.context)
+	if err != nil {
+		return database.HomescriptQuotaData{}, err
+	}
+	if !found {
+		return database.HomescriptQuotaData{}, nil
+	}
+
+	return quota.Data, nil
+}
+
+// Allocates a job ID and reserves a slot of the quota of the given context at once.
+// Returns `false` if the maximum number of concurrent jobs (`0` means unlimited) is reached.
+// The reserved placeholder job carries the context so that it is counted by concurrent reservations,
+// it must be released using `removeJob` on every path.
+func (m *Manager) reserveQuotaJob(context types.ExecutionContext, maxJobs uint) (uint64, bool) {
+	for {
+		potential := m.generatePotentialJobId()
+
+		m.Lock.Lock()
+
+		if maxJobs != 0 && m.countQuotaJobs(context) >= maxJobs {
+			m.Lock.Unlock()
+			return 0, false
+		}
+
+		if _, taken := m.Jobs[potential]; !taken {
+			m.Jobs[potential] = types.Job{
+				Context: context,
+				JobID:   potential,
+			}
+			m.Lock.Unlock()
+			return potential, true
+		}
+
+		m.Lock.Unlock()
+	}
+}
+
+// Counts the running and reserved jobs which share the quota of the given context.
+// The caller must hold the lock of the manager.
+func (m *Manager) countQuotaJobs(context types.ExecutionContext) uint {
+	count := uint(0)
+	for _, job := range m.Jobs {
+		if job.Context == nil || job.Context.Kind() != context.Kind() {
+			continue
+		}
+
+		if context.Username() != nil &&
+			(job.Context.Username() == nil || *job.Context.Username() != *context.Username()) {
+			continue
+		}
+
+		count++
+	}
+
+	return count
+}
+
+func quotaLimits(quota database.HomescriptQuotaData) runtime.CoreLimits {
+	limits := VM_LIMITS
+
+	if quota.MaxCallStackSize != 0 && quota.MaxCallStackSize < limits.CallStackMaxSize {
+		limits.CallStackMaxSize = quota.MaxCallStackSize
+	}
+
+	if quota.MaxStackSize != 0 && quota.MaxStackSize < limits.StackMaxSize {
+		limits.StackMaxSize = quota.MaxStackSize
+	}
+
+	return limits
+}
+
+// The VM reports a violation of its core limits as a fatal exception.
+// Returns a message if the violated limit was lowered by the quota, violations of the default limits are regular exceptions.
+func coreLimitViolation(quota database.HomescriptQuotaData, exceptionMessage string) *string {
+	exceptionMessage = strings.ToLower(exceptionMessage)
+	if !strings.Contains(exceptionMessage, "stack") {
+		return nil
+	}
+
+	var message string
+	if strings.Contains(exceptionMessage, "call stack") || strings.Contains(exceptionMessage, "callstack") {
+		if quota.MaxCallStackSize == 0 || quota.MaxCallStackSize >= VM_LIMITS.CallStackMaxSize {
+			return nil
+		}
+		message = fmt.Sprintf("Maximum call stack size of %d exceeded", quota.MaxCallStackSize)
+	} else {
+		if quota.MaxStackSize == 0 || quota.MaxStackSize >= VM_LIMITS.StackMaxSize {
+			return nil
+		}
+		message = fmt.Sprintf("Maximum stack size of %d exceeded", quota.MaxStackSize)
+	}
+
+	return &message
+}
+
+func quotaExceededError(message string) types.HmsError {
+	return types.HmsError{
+		RuntimeInterrupt: &types.HmsRuntimeInterrupt{
+			Kind:    types.QuotaExceededInterruptKind,
+			Message: message,
+		},
+	}
+}
+
+func logQuotaViolation(programID string, context types.ExecutionContext, message string) {
+	owner := "<system>"
+	if context.Username() != nil {
+		owner = *context.Username()
+	}
+
+	logger.Debugf("Homescript `%s` (owner: %s) exceeded its quota: %s", programID, owner, message)
+	event.Warn(
+		"Homescript Quota Exceeded",
+		fmt.Sprintf("Homescript `%s` of user `%s` was interrupted: %s", programID, owner, message),
+	)
+}
+
+// Enforces the runtime and output limits of a single job.
+type quotaGuard struct {
+	lock      sync.Mutex
+	violation *string
+	// The context of the caller: if it is canceled, the job was killed and did not exceed its quota.
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	// The maximum runtime is only reported if it was set.
+	maxRuntime time.Duration
+}
+
+// Creates a quota guard which derives a new cancelation from the given one.
+// The derived cancelation must be used for the job so that the guard can interrupt it.
+func newQuotaGuard(
+	quota database.HomescriptQuotaData,
+	cancelation types.Cancelation,
+) (*quotaGuard, types.Cancelation) {
+	ctx, cancel := context.WithCancel(cancelation.Context)
+	maxRuntime := time.Duration(quota.MaxRuntimeSeconds) * time.Second
+
+	if maxRuntime != 0 {
+		ctx, cancel = context.WithTimeout(cancelation.Context, maxRuntime)
+	}
+
+	guard := &quotaGuard{
+		lock:       sync.Mutex{},
+		violation:  nil,
+		parent:     cancelation.Context,
+		ctx:        ctx,
+		cancel:     cancel,
+		maxRuntime: maxRuntime,
+	}
+
+	return guard, types.Cancelation{
+		Context:    ctx,
+		CancelFunc: cancel,
+	}
+}
+
+// Interrupts the job due to a quota violation, only the first violation is recorded.
+func (g *quotaGuard) interrupt(message string) {
+	g.lock.Lock()
+	if g.violation == nil {
+		g.violation = &message
+	}
+	g.lock.Unlock()
+
+	g.cancel()
+}
+
+// Returns a message if the job has exceeded its quota.
+func (g *quotaGuard) Violation() *string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.violation != nil {
+		return g.violation
+	}
+
+	if g.maxRuntime != 0 && g.ctx.Err() == context.DeadlineExceeded && g.parent.Err() == nil {
+		message := fmt.Sprintf("Maximum runtime of %s exceeded", g.maxRuntime)
+		g.violation = &message
+	}
+
+	return g.violation
+}
+
+// Relays the debug output of the VM to its consumer and interrupts the job once it has executed more than `maxInstructions` instructions.
+// The VM emits one debug output per instruction, the returned channels must be passed to the VM instead of the ones of the consumer.
+// Closing `stop` once the VM has terminated releases the relay.
+func (g *quotaGuard) meterInstructions(
+	maxInstructions uint,
+	consumerOut *chan runtime.DebugOutput,
+	consumerIn *chan struct{},
+	stop <-chan struct{},
+) (*chan runtime.DebugOutput, *chan struct{}) {
+	vmOut := make(chan runtime.DebugOutput)
+	vmIn := make(chan struct{})
+
+	go func() {
+		executed := uint(0)
+
+		for {
+			var output runtime.DebugOutput
+			select {
+			case output = <-vmOut:
+			case <-stop:
+				return
+			}
+
+			if !output.Done {
+				executed++
+				if executed == maxInstructions+1 {
+					g.interrupt(fmt.Sprintf("Maximum instruction count of %d exceeded", maxInstructions))
+				}
+			}
+
+			select {
+			case *consumerOut <- output:
+			case <-stop:
+				return
+			}
+
+			// The final output is not acknowledged.
+			if output.Done {
+				return
+			}
+
+			select {
+			case <-*consumerIn:
+			case <-stop:
+				return
+			}
+
+			select {
+			case vmIn <- struct{}{}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return &vmOut, &vmIn
+}
+
+// Wraps an output writer: once the maximum output size is reached, further output is discarded and the job is interrupted.
+type quotaWriter struct {
+	inner    io.Writer
+	guard    *quotaGuard
+	lock     sync.Mutex
+	written  uint
+	maxBytes uint
+}
+
+func (g *quotaGuard) writer(inner io.Writer, maxBytes uint) io.Writer {
+	if maxBytes == 0 {
+		return inner
+	}
+
+	return &quotaWriter{
+		inner:    inner,
+		guard:    g,
+		lock:     sync.Mutex{},
+		written:  0,
+		maxBytes: maxBytes,
+	}
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	remaining := w.maxBytes - w.written
+	if uint(len(p)) <= remaining {
+		w.written += uint(len(p))
+		return w.inner.Write(p)
+	}
+
+	if remaining > 0 {
+		w.written = w.maxBytes
+		if _, err := w.inner.Write(p[:remaining]); err != nil {
+			return 0, err
+		}
+	}
+
+	w.guard.interrupt(fmt.Sprintf("Maximum output size of %d bytes exceeded", w.maxBytes))
+
+	// Pretend that everything was written so that the VM is terminated via the cancelation, not via an I/O error.
+	return len(p), nil
+}
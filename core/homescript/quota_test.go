@@ -0,0 +1,104 @@
+package homescript
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/smarthome-go/homescript/v3/homescript/runtime"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+func TestReserveQuotaJob(t *testing.T) {
+	m := Manager{Jobs: make(map[uint64]types.Job)}
+	context := types.NewExecutionContextUser("test", "alice", make(map[string]string))
+
+	// Concurrent reservations must not exceed the limit
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	reserved := make([]uint64, 0)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			jobID, ok := m.reserveQuotaJob(context, 3)
+			if !ok {
+				return
+			}
+
+			lock.Lock()
+			reserved = append(reserved, jobID)
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, reserved, 3)
+
+	// Other users do not share the quota
+	_, ok := m.reserveQuotaJob(types.NewExecutionContextUser("test", "bob", make(map[string]string)), 3)
+	assert.True(t, ok)
+
+	// Releasing a job frees its slot
+	assert.True(t, m.removeJob(reserved[0]))
+	_, ok = m.reserveQuotaJob(context, 3)
+	assert.True(t, ok)
+	_, ok = m.reserveQuotaJob(context, 3)
+	assert.False(t, ok)
+
+	// Without a limit, every reservation succeeds
+	_, ok = m.reserveQuotaJob(context, 0)
+	assert.True(t, ok)
+}
+
+func TestMeterInstructions(t *testing.T) {
+	guard, cancelation := newQuotaGuard(database.HomescriptQuotaData{}, types.Cancelation{
+		Context:    context.Background(),
+		CancelFunc: func() {},
+	})
+	defer cancelation.CancelFunc()
+
+	consumerOut := make(chan runtime.DebugOutput)
+	consumerIn := make(chan struct{})
+	stop := make(chan struct{})
+	defer close(stop)
+
+	vmOut, vmIn := guard.meterInstructions(3, &consumerOut, &consumerIn, stop)
+
+	// Every instruction is relayed to the consumer and its acknowledgement is relayed back to the VM
+	for i := 0; i < 3; i++ {
+		*vmOut <- runtime.DebugOutput{}
+		<-consumerOut
+		consumerIn <- struct{}{}
+		<-*vmIn
+		assert.Nil(t, guard.Violation())
+	}
+
+	// Exceeding the limit interrupts the job
+	*vmOut <- runtime.DebugOutput{}
+	<-consumerOut
+	assert.Equal(t, "Maximum instruction count of 3 exceeded", *guard.Violation())
+	assert.Error(t, cancelation.Context.Err())
+}
+
+func TestCoreLimitViolation(t *testing.T) {
+	quota := database.HomescriptQuotaData{
+		MaxCallStackSize: 16,
+		MaxStackSize:     VM_LIMITS.StackMaxSize,
+	}
+
+	violation := coreLimitViolation(quota, "Call stack overflow")
+	assert.NotNil(t, violation)
+	assert.Equal(t, "Maximum call stack size of 16 exceeded", *violation)
+
+	// The stack limit was not lowered by the quota
+	assert.Nil(t, coreLimitViolation(quota, "Stack overflow"))
+
+	// Other exceptions are not related to the quota
+	assert.Nil(t, coreLimitViolation(quota, "Index out of bounds"))
+}
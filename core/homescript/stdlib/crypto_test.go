@@ -0,0 +1,50 @@
+package stdlib
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashes(t *testing.T) {
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", SHA256Hex("hello"))
+	// Test case 2 of RFC 4231.
+	assert.Equal(t, "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843", HMACSHA256Hex("Jefe", "what do ya want for nothing?"))
+}
+
+func TestNewUUID(t *testing.T) {
+	uuid, err := NewUUID()
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), uuid)
+
+	other, err := NewUUID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, uuid, other)
+}
+
+func TestRegex(t *testing.T) {
+	groups, found, err := RegexMatch(`(\w+)=(\d+)`, "temp=21 humidity=40")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []string{"temp=21", "temp", "21"}, groups)
+
+	_, found, err = RegexMatch(`\d+`, "none")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	all, err := RegexFindAll(`(\w+)=(\d+)`, "temp=21 humidity=40")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"temp=21", "temp", "21"}, {"humidity=40", "humidity", "40"}}, all)
+
+	all, err = RegexFindAll(`\d+`, "none")
+	assert.NoError(t, err)
+	assert.Empty(t, all)
+
+	replaced, err := RegexReplace(`(?P<key>\w+)=(\d+)`, "temp=21", "$2 (${key})")
+	assert.NoError(t, err)
+	assert.Equal(t, "21 (temp)", replaced)
+
+	_, _, err = RegexMatch(`(`, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,328 @@
+// Package stdlib contains the host-independent parts of the Homescript standard library modules.
+// The executor converts the results of these functions into Homescript values.
+package stdlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The maximum nesting depth of JSON documents and shapes.
+const maxJSONDepth = 64
+
+// Decodes a JSON document.
+// Numbers without fraction or exponent are decoded as `int64`, all other numbers as `float64`.
+func DecodeJSON(text string) (any, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+
+	var data any
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+
+	return normalizeNumbers(data, 0)
+}
+
+func normalizeNumbers(data any, depth int) (any, error) {
+	if depth > maxJSONDepth {
+		return nil, fmt.Errorf("the document is nested deeper than %d levels", maxJSONDepth)
+	}
+
+	switch inner := data.(type) {
+	case json.Number:
+		if asInt, err := inner.Int64(); err == nil {
+			return asInt, nil
+		}
+		asFloat, err := inner.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("number `%s` is out of range", inner)
+		}
+		return asFloat, nil
+	case []any:
+		for idx, item := range inner {
+			normalized, err := normalizeNumbers(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			inner[idx] = normalized
+		}
+		return inner, nil
+	case map[string]any:
+		for key, item := range inner {
+			normalized, err := normalizeNumbers(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			inner[key] = normalized
+		}
+		return inner, nil
+	default:
+		return data, nil
+	}
+}
+
+// Encodes data as JSON, object keys are sorted so that the output is deterministic.
+// HTML characters are not escaped as the output is usually sent to devices and web services.
+func EncodeJSON(data any, indent bool) (string, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if indent {
+		encoder.SetIndent("", "    ")
+	}
+
+	if err := encoder.Encode(data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buffer.String(), "\n"), nil
+}
+
+//
+// Shapes
+//
+
+type ShapeKind string
+
+const (
+	ShapeInt    ShapeKind = "int"
+	ShapeFloat  ShapeKind = "float"
+	ShapeBool   ShapeKind = "bool"
+	ShapeString ShapeKind = "str"
+	ShapeNull   ShapeKind = "null"
+	ShapeAny    ShapeKind = "any"
+	ShapeList   ShapeKind = "list"
+	ShapeObject ShapeKind = "object"
+	ShapeOption ShapeKind = "option"
+)
+
+// Describes the expected structure of a JSON document.
+// Shapes are written as JSON themselves:
+//   - `"int"`, `"float"`, `"bool"`, `"str"`, `"null"` and `"any"` describe single values
+//   - a leading `?` makes a value optional: `"?str"`
+//   - a list with exactly one element describes a list: `["int"]`
+//   - an object describes an object with exactly these fields: `{"temp": "float", "tags": ["str"]}`
+type Shape struct {
+	Kind ShapeKind
+	// Set for lists and options.
+	Inner *Shape
+	// Set for objects.
+	Fields map[string]Shape
+}
+
+// An object which was validated against an object shape, it only contains the fields of the shape.
+// Objects without a shape are represented as `map[string]any`.
+type Object map[string]any
+
+// An optional value, `Inner` is only valid if `IsSome` is true.
+type Option struct {
+	Inner  any
+	IsSome bool
+}
+
+func ParseShape(descriptor string) (Shape, error) {
+	var raw any
+	if err := json.Unmarshal([]byte(descriptor), &raw); err != nil {
+		return Shape{}, fmt.Errorf("invalid shape: %s", err.Error())
+	}
+	return parseShape(raw, 0)
+}
+
+func parseShape(raw any, depth int) (Shape, error) {
+	if depth > maxJSONDepth {
+		return Shape{}, fmt.Errorf("invalid shape: nested deeper than %d levels", maxJSONDepth)
+	}
+
+	switch inner := raw.(type) {
+	case string:
+		if strings.HasPrefix(inner, "?") {
+			optionInner, err := parseShape(strings.TrimPrefix(inner, "?"), depth+1)
+			if err != nil {
+				return Shape{}, err
+			}
+			return Shape{Kind: ShapeOption, Inner: &optionInner}, nil
+		}
+
+		switch kind := ShapeKind(inner); kind {
+		case ShapeInt, ShapeFloat, ShapeBool, ShapeString, ShapeNull, ShapeAny:
+			return Shape{Kind: kind}, nil
+		default:
+			return Shape{}, fmt.Errorf("invalid shape: unknown type `%s`", inner)
+		}
+	case []any:
+		if len(inner) != 1 {
+			return Shape{}, fmt.Errorf("invalid shape: list shapes must contain exactly one element shape")
+		}
+		element, err := parseShape(inner[0], depth+1)
+		if err != nil {
+			return Shape{}, err
+		}
+		return Shape{Kind: ShapeList, Inner: &element}, nil
+	case map[string]any:
+		fields := make(map[string]Shape)
+		for key, field := range inner {
+			fieldShape, err := parseShape(field, depth+1)
+			if err != nil {
+				return Shape{}, err
+			}
+			fields[key] = fieldShape
+		}
+		return Shape{Kind: ShapeObject, Fields: fields}, nil
+	default:
+		return Shape{}, fmt.Errorf("invalid shape: expected a string, list or object")
+	}
+}
+
+// Validates decoded JSON data (see `DecodeJSON`) against a shape.
+// Integers are accepted where floats are expected, options are represented as `Option` and objects as `Object`.
+// Errors contain the path to the offending value, for instance `$.tags[1]: expected str, found int`.
+func (self Shape) Validate(data any) (any, error) {
+	return self.validate(data, "$")
+}
+
+func (self Shape) validate(data any, path string) (any, error) {
+	mismatch := func() error {
+		return fmt.Errorf("%s: expected %s, found %s", path, self, describeJSON(data))
+	}
+
+	switch self.Kind {
+	case ShapeAny:
+		return data, nil
+	case ShapeNull:
+		if data != nil {
+			return nil, mismatch()
+		}
+		return nil, nil
+	case ShapeInt:
+		if asInt, ok := data.(int64); ok {
+			return asInt, nil
+		}
+		// Large integers may have been decoded as floats.
+		if asFloat, ok := data.(float64); ok && asFloat == math.Trunc(asFloat) && math.Abs(asFloat) < math.MaxInt64 {
+			return int64(asFloat), nil
+		}
+		return nil, mismatch()
+	case ShapeFloat:
+		switch inner := data.(type) {
+		case float64:
+			return inner, nil
+		case int64:
+			return float64(inner), nil
+		}
+		return nil, mismatch()
+	case ShapeBool:
+		if _, ok := data.(bool); !ok {
+			return nil, mismatch()
+		}
+		return data, nil
+	case ShapeString:
+		if _, ok := data.(string); !ok {
+			return nil, mismatch()
+		}
+		return data, nil
+	case ShapeOption:
+		if data == nil {
+			return Option{IsSome: false}, nil
+		}
+		inner, err := self.Inner.validate(data, path)
+		if err != nil {
+			return nil, err
+		}
+		return Option{Inner: inner, IsSome: true}, nil
+	case ShapeList:
+		list, ok := data.([]any)
+		if !ok {
+			return nil, mismatch()
+		}
+		output := make([]any, len(list))
+		for idx, item := range list {
+			validated, err := self.Inner.validate(item, fmt.Sprintf("%s[%d]", path, idx))
+			if err != nil {
+				return nil, err
+			}
+			output[idx] = validated
+		}
+		return output, nil
+	case ShapeObject:
+		object, ok := data.(map[string]any)
+		if !ok {
+			return nil, mismatch()
+		}
+		output := make(Object)
+		for _, key := range sortedShapeFields(self.Fields) {
+			field := self.Fields[key]
+			fieldPath := fmt.Sprintf("%s.%s", path, key)
+
+			item, found := object[key]
+			if !found && field.Kind != ShapeOption && field.Kind != ShapeAny {
+				return nil, fmt.Errorf("%s: missing field of type %s", fieldPath, field)
+			}
+
+			validated, err := field.validate(item, fieldPath)
+			if err != nil {
+				return nil, err
+			}
+			output[key] = validated
+		}
+		return output, nil
+	default:
+		panic(fmt.Sprintf("Unknown shape kind `%s`", self.Kind))
+	}
+}
+
+// Returns the shape in the notation of Homescript types.
+func (self Shape) String() string {
+	switch self.Kind {
+	case ShapeOption:
+		return fmt.Sprintf("?%s", self.Inner)
+	case ShapeList:
+		return fmt.Sprintf("[%s]", self.Inner)
+	case ShapeObject:
+		fields := make([]string, 0, len(self.Fields))
+		for _, key := range sortedShapeFields(self.Fields) {
+			fields = append(fields, fmt.Sprintf("%s: %s", key, self.Fields[key]))
+		}
+		return fmt.Sprintf("{ %s }", strings.Join(fields, ", "))
+	default:
+		return string(self.Kind)
+	}
+}
+
+func sortedShapeFields(fields map[string]Shape) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func describeJSON(data any) string {
+	switch data.(type) {
+	case nil:
+		return "null"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case string:
+		return "str"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", data)
+	}
+}
@@ -0,0 +1,77 @@
+package stdlib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	data, err := DecodeJSON(`{"count": 3, "ratio": 0.5, "big": 1e3, "tags": ["a", null], "ok": true}`)
+	assert.NoError(t, err)
+
+	object := data.(map[string]any)
+	assert.Equal(t, int64(3), object["count"])
+	assert.Equal(t, 0.5, object["ratio"])
+	assert.Equal(t, 1000.0, object["big"])
+	assert.Equal(t, []any{"a", nil}, object["tags"])
+	assert.Equal(t, true, object["ok"])
+
+	_, err = DecodeJSON(`{"a": 1} {"b": 2}`)
+	assert.Error(t, err)
+
+	_, err = DecodeJSON(`{"a": `)
+	assert.Error(t, err)
+}
+
+func TestEncodeJSON(t *testing.T) {
+	encoded, err := EncodeJSON(map[string]any{"b": 1, "a": "<tag>"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"<tag>","b":1}`, encoded)
+
+	encoded, err = EncodeJSON([]any{1}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "[\n    1\n]", encoded)
+}
+
+func TestShapeValidation(t *testing.T) {
+	shape, err := ParseShape(`{"temp": "float", "humidity": "int", "tags": ["str"], "room": "?str", "extra": "any"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "{ extra: any, humidity: int, room: ?str, tags: [str], temp: float }", shape.String())
+
+	data, err := DecodeJSON(`{"temp": 21, "humidity": 40, "tags": ["a", "b"], "ignored": true}`)
+	assert.NoError(t, err)
+
+	validated, err := shape.Validate(data)
+	assert.NoError(t, err)
+	assert.Equal(t, Object{
+		"temp":     21.0,
+		"humidity": int64(40),
+		"tags":     []any{"a", "b"},
+		"room":     Option{IsSome: false},
+		"extra":    nil,
+	}, validated)
+
+	table := []struct {
+		Input string
+		Error string
+	}{
+		{Input: `{"temp": "hot", "humidity": 1, "tags": []}`, Error: "$.temp: expected float, found str"},
+		{Input: `{"temp": 1, "humidity": 1.5, "tags": []}`, Error: "$.humidity: expected int, found float"},
+		{Input: `{"temp": 1, "humidity": 1, "tags": ["a", 2]}`, Error: "$.tags[1]: expected str, found int"},
+		{Input: `{"temp": 1, "tags": []}`, Error: "$.humidity: missing field of type int"},
+		{Input: `[]`, Error: "$: expected { extra: any, humidity: int, room: ?str, tags: [str], temp: float }, found list"},
+	}
+
+	for _, test := range table {
+		data, err := DecodeJSON(test.Input)
+		assert.NoError(t, err)
+		_, err = shape.Validate(data)
+		assert.EqualError(t, err, test.Error, test.Input)
+	}
+
+	for _, invalid := range []string{`"integer"`, `["int", "str"]`, `42`, `{"a": "?"}`, `not json`} {
+		_, err := ParseShape(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,26 @@
+package stdlib
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Returns a random integer in `lower..upper`, the lower bound is inclusive, the upper bound is exclusive.
+func RandomInt(lower, upper int64) (int64, error) {
+	if upper <= lower {
+		return 0, fmt.Errorf("Invalid range: %d..%d is empty", lower, upper)
+	}
+
+	// The width is computed in uint64 as `upper - lower` overflows int64 for ranges wider than `math.MaxInt64`.
+	width := uint64(upper) - uint64(lower)
+
+	// Values beyond the largest multiple of the width are rejected so that every result is equally likely.
+	limit := math.MaxUint64 - math.MaxUint64%width
+	for {
+		random := rand.Uint64()
+		if random < limit {
+			return int64(uint64(lower) + random%width), nil
+		}
+	}
+}
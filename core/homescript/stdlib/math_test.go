@@ -0,0 +1,40 @@
+package stdlib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomInt(t *testing.T) {
+	table := []struct {
+		Lower int64
+		Upper int64
+	}{
+		{Lower: 0, Upper: 1},
+		{Lower: -10, Upper: 10},
+		{Lower: -2, Upper: math.MaxInt64},
+		{Lower: math.MinInt64, Upper: 0},
+		{Lower: math.MinInt64, Upper: math.MaxInt64},
+		{Lower: math.MaxInt64 - 1, Upper: math.MaxInt64},
+	}
+
+	for _, test := range table {
+		for i := 0; i < 1000; i++ {
+			random, err := RandomInt(test.Lower, test.Upper)
+			assert.NoError(t, err)
+			assert.GreaterOrEqual(t, random, test.Lower)
+			assert.Less(t, random, test.Upper)
+		}
+	}
+
+	random, err := RandomInt(math.MaxInt64-1, math.MaxInt64)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64-1), random)
+
+	_, err = RandomInt(5, 5)
+	assert.Error(t, err)
+	_, err = RandomInt(math.MaxInt64, math.MinInt64)
+	assert.Error(t, err)
+}
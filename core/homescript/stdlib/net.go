@@ -0,0 +1,112 @@
+package stdlib
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// The maximum length of a host pattern.
+const HostPatternMaxLen = 255
+
+// Builds a Wake-on-LAN magic packet: 6 bytes of `0xFF` followed by 16 repetitions of the MAC address.
+func MagicPacket(mac string) ([]byte, error) {
+	hardwareAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+	if len(hardwareAddr) != 6 {
+		return nil, fmt.Errorf("invalid MAC address `%s`: expected 6 bytes, found %d", mac, len(hardwareAddr))
+	}
+
+	packet := make([]byte, 0, 102)
+	for i := 0; i < 6; i++ {
+		packet = append(packet, 0xFF)
+	}
+	for i := 0; i < 16; i++ {
+		packet = append(packet, hardwareAddr...)
+	}
+
+	return packet, nil
+}
+
+// Validates and normalizes an entry of a network host allowlist.
+// Valid patterns are IP addresses (`192.168.1.10`), CIDR ranges (`192.168.1.0/24`),
+// host names (`receiver.lan`) and wildcard domains (`*.lan`) which match all subdomains.
+func NormalizeHostPattern(pattern string) (string, error) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" || len(pattern) > HostPatternMaxLen {
+		return "", fmt.Errorf("host pattern must be between 1 and %d characters long", HostPatternMaxLen)
+	}
+
+	if ip := net.ParseIP(pattern); ip != nil {
+		return ip.String(), nil
+	}
+
+	if strings.Contains(pattern, "/") {
+		_, ipNet, err := net.ParseCIDR(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid CIDR range `%s`", pattern)
+		}
+		return ipNet.String(), nil
+	}
+
+	if !isValidHostname(strings.TrimPrefix(pattern, "*.")) {
+		return "", fmt.Errorf("invalid host name `%s`", pattern)
+	}
+
+	return pattern, nil
+}
+
+func isValidHostname(host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, char := range label {
+			if !(char >= 'a' && char <= 'z' || char >= '0' && char <= '9' || char == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Decides which of the resolved addresses of a host may be contacted according to an allowlist.
+// If the host name itself is allowed, the first resolved address is returned.
+// Otherwise, the first address which is matched by an IP or CIDR pattern is returned.
+// Connections should always use the returned address so that the host is not resolved a second time.
+func AllowedAddress(patterns []string, host string, resolved []net.IP) (net.IP, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if len(resolved) == 0 {
+		return nil, false
+	}
+
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return resolved[0], true
+			}
+			continue
+		}
+		if pattern == host && net.ParseIP(pattern) == nil {
+			return resolved[0], true
+		}
+	}
+
+	for _, ip := range resolved {
+		for _, pattern := range patterns {
+			if allowed := net.ParseIP(pattern); allowed != nil && allowed.Equal(ip) {
+				return ip, true
+			}
+			if _, ipNet, err := net.ParseCIDR(pattern); err == nil && ipNet.Contains(ip) {
+				return ip, true
+			}
+		}
+	}
+
+	return nil, false
+}
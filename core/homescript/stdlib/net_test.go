@@ -0,0 +1,76 @@
+package stdlib
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMagicPacket(t *testing.T) {
+	packet, err := MagicPacket("01:23:45:67:89:ab")
+	assert.NoError(t, err)
+	assert.Len(t, packet, 102)
+	assert.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, packet[:6])
+	assert.Equal(t, []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab}, packet[96:])
+
+	_, err = MagicPacket("01:23:45")
+	assert.Error(t, err)
+
+	// EUI-64 addresses cannot be woken.
+	_, err = MagicPacket("01:23:45:67:89:ab:cd:ef")
+	assert.Error(t, err)
+}
+
+func TestNormalizeHostPattern(t *testing.T) {
+	valid := map[string]string{
+		"192.168.1.10":    "192.168.1.10",
+		" 192.168.1.7/24": "192.168.1.0/24",
+		"Receiver.LAN":    "receiver.lan",
+		"*.lan":           "*.lan",
+		"::1":             "::1",
+	}
+	for pattern, expected := range valid {
+		normalized, err := NormalizeHostPattern(pattern)
+		assert.NoError(t, err, pattern)
+		assert.Equal(t, expected, normalized)
+	}
+
+	for _, pattern := range []string{"", "*", "192.168.1.0/33", "foo..lan", "-foo.lan", "foo_bar.lan", "*.*.lan"} {
+		_, err := NormalizeHostPattern(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestAllowedAddress(t *testing.T) {
+	patterns := []string{"receiver.lan", "*.iot.lan", "10.0.0.5", "192.168.1.0/24"}
+	resolved := []net.IP{net.ParseIP("172.16.0.1"), net.ParseIP("192.168.1.20")}
+
+	// Allowed by name: the first resolved address is used.
+	ip, allowed := AllowedAddress(patterns, "Receiver.lan.", resolved)
+	assert.True(t, allowed)
+	assert.Equal(t, "172.16.0.1", ip.String())
+
+	ip, allowed = AllowedAddress(patterns, "plug.iot.lan", resolved)
+	assert.True(t, allowed)
+	assert.Equal(t, "172.16.0.1", ip.String())
+
+	// Allowed by address: only matching addresses are used.
+	ip, allowed = AllowedAddress(patterns, "projector.lan", resolved)
+	assert.True(t, allowed)
+	assert.Equal(t, "192.168.1.20", ip.String())
+
+	ip, allowed = AllowedAddress(patterns, "10.0.0.5", []net.IP{net.ParseIP("10.0.0.5")})
+	assert.True(t, allowed)
+	assert.Equal(t, "10.0.0.5", ip.String())
+
+	_, allowed = AllowedAddress(patterns, "example.com", []net.IP{net.ParseIP("93.184.216.34")})
+	assert.False(t, allowed)
+
+	// `*.iot.lan` does not match `iot.lan` itself.
+	_, allowed = AllowedAddress(patterns, "iot.lan", []net.IP{net.ParseIP("172.16.0.2")})
+	assert.False(t, allowed)
+
+	_, allowed = AllowedAddress(nil, "receiver.lan", resolved)
+	assert.False(t, allowed)
+}
@@ -0,0 +1,81 @@
+package stdlib
+
+import (
+	"regexp"
+	"sync"
+)
+
+// Compiled patterns are cached as scripts usually call the regex functions in loops.
+// Once the cache is full, it is cleared to keep its memory usage bounded.
+const regexCacheSize = 256
+
+var regexCache = struct {
+	lock     sync.Mutex
+	patterns map[string]*regexp.Regexp
+}{
+	lock:     sync.Mutex{},
+	patterns: make(map[string]*regexp.Regexp),
+}
+
+func CompileRegex(pattern string) (*regexp.Regexp, error) {
+	regexCache.lock.Lock()
+	defer regexCache.lock.Unlock()
+
+	if compiled, found := regexCache.patterns[pattern]; found {
+		return compiled, nil
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(regexCache.patterns) >= regexCacheSize {
+		regexCache.patterns = make(map[string]*regexp.Regexp)
+	}
+	regexCache.patterns[pattern] = compiled
+
+	return compiled, nil
+}
+
+// Returns the first match of the pattern followed by its capture groups.
+// Groups which did not participate in the match are empty.
+func RegexMatch(pattern string, text string) (groups []string, found bool, err error) {
+	compiled, err := CompileRegex(pattern)
+	if err != nil {
+		return nil, false, err
+	}
+
+	match := compiled.FindStringSubmatch(text)
+	if match == nil {
+		return nil, false, nil
+	}
+
+	return match, true, nil
+}
+
+// Returns all non-overlapping matches, each followed by its capture groups.
+func RegexFindAll(pattern string, text string) ([][]string, error) {
+	compiled, err := CompileRegex(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := compiled.FindAllStringSubmatch(text, -1)
+	if matches == nil {
+		return make([][]string, 0), nil
+	}
+
+	return matches, nil
+}
+
+// Replaces all matches of the pattern.
+// Inside the replacement, `$1` or `${name}` refer to capture groups.
+func RegexReplace(pattern string, text string, replacement string) (string, error) {
+	compiled, err := CompileRegex(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	return compiled.ReplaceAllString(text, replacement), nil
+}
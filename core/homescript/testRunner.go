@@ -0,0 +1,214 @@
+package homescript
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/smarthome-go/homescript/v3/homescript"
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// Maximum runtime of a single test function.
+const testMaxRuntime = 10 * time.Second
+
+// Returns every function of the main module which is annotated with `@test`.
+func DiscoverTests(modules map[string]ast.AnalyzedProgram, mainModule string) []types.TestFunction {
+	tests := make([]types.TestFunction, 0)
+
+	for _, fn := range modules[mainModule].Functions {
+		if fn.Annotation == nil {
+			continue
+		}
+
+		for _, item := range fn.Annotation.Items {
+			ident, ok := item.(ast.AnalyzedAnnotationItemIdent)
+			if !ok || ident.Ident.Ident() != types.TestAnnotationIdent {
+				continue
+			}
+
+			tests = append(tests, types.TestFunction{
+				Name: fn.Ident.Ident(),
+				Span: fn.Ident.Span(),
+			})
+			break
+		}
+	}
+
+	return tests
+}
+
+// Runs every test of a user program in isolation, side-effect modules are mocked.
+func (m *Manager) RunUserTests(
+	code, filename, username string,
+) ([]types.HmsTestResult, types.HmsDiagnosticsContainer, error) {
+	input := homescript.InputProgram{
+		ProgramText: code,
+		Filename:    filename,
+	}
+
+	context := types.NewExecutionContextUser(filename, username, make(map[string]string))
+
+	modules, diagnostics, err := m.Analyze(input, context)
+	if err != nil || diagnostics.ContainsError {
+		return nil, diagnostics, err
+	}
+
+	results, err := m.runTests(
+		input,
+		context,
+		modules,
+		func() map[string]value.Value { return make(map[string]value.Value) },
+	)
+
+	return results, diagnostics, err
+}
+
+// Runs every test of a driver against fake driver and device singletons.
+// As the code is passed explicitly, drivers can be tested before they are saved.
+// If `driverData` or `deviceData` is <nil>, the zero value of the respective singleton type is used.
+func (m *Manager) RunDriverTests(
+	vendorID, modelID, code string,
+	driverData any,
+	deviceData any,
+) ([]types.HmsTestResult, types.HmsDiagnosticsContainer, error) {
+	filename := types.CreateDriverHmsId(database.DriverTuple{
+		VendorID: vendorID,
+		ModelID:  modelID,
+	})
+
+	input := homescript.InputProgram{
+		ProgramText: code,
+		Filename:    filename,
+	}
+
+	fakeDeviceID := fmt.Sprintf("@test:%s", filename)
+	context := types.NewExecutionContextDriver(vendorID, modelID, &fakeDeviceID)
+
+	modules, diagnostics, err := m.Analyze(input, context)
+	if err != nil || diagnostics.ContainsError {
+		return nil, diagnostics, err
+	}
+
+	// Tests must not run against the zero value of the driver information.
+	info, infoDiagnostics := driver.ExtractDriverInfo(modules, filename, false)
+	if len(infoDiagnostics) != 0 {
+		return nil, types.HmsDiagnosticsContainer{
+			ContainsError: true,
+			Diagnostics:   types.HmsErrorsFromDiagnostics(infoDiagnostics),
+			FileContents:  diagnostics.FileContents,
+		}, nil
+	}
+
+	makeSingleton := func(data any, hmsType ast.ObjectType) value.Value {
+		if data == nil {
+			return value.ObjectZeroValue(hmsType)
+		}
+		return *value.TypeAwareUnmarshalValue(data, hmsType)
+	}
+
+	results, err := m.runTests(
+		input,
+		context,
+		modules,
+		func() map[string]value.Value {
+			return map[string]value.Value{
+				driver.DriverSingletonIdent:       makeSingleton(driverData, info.DriverConfig.Info.HmsType),
+				driver.DriverDeviceSingletonIdent: makeSingleton(deviceData, info.DeviceConfig.Info.HmsType),
+			}
+		},
+	)
+
+	return results, diagnostics, err
+}
+
+func (m *Manager) runTests(
+	input homescript.InputProgram,
+	context types.ExecutionContext,
+	modules map[string]ast.AnalyzedProgram,
+	// Each test receives freshly created singletons so that tests cannot influence each other.
+	singletons func() map[string]value.Value,
+) ([]types.HmsTestResult, error) {
+	tests := DiscoverTests(modules, input.Filename)
+	results := make([]types.HmsTestResult, len(tests))
+
+	logger.Debugf("Running %d test(s) of `%s`...", len(tests), input.Filename)
+
+	for idx, test := range tests {
+		result, err := m.runTest(input, context, test, singletons())
+		if err != nil {
+			return nil, err
+		}
+		results[idx] = result
+	}
+
+	return results, nil
+}
+
+func (m *Manager) runTest(
+	input homescript.InputProgram,
+	executionContext types.ExecutionContext,
+	test types.TestFunction,
+	singletons map[string]value.Value,
+) (types.HmsTestResult, error) {
+	var outputBuffer bytes.Buffer
+	mocks := types.NewTestMocks()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testMaxRuntime)
+	defer cancel()
+
+	res, err := m.RunGeneric(
+		types.ProgramInvocation{
+			Identifier: input,
+			FunctionInvocation: &runtime.FunctionInvocation{
+				Function: test.Name,
+				Args:     []value.Value{},
+				FunctionSignature: runtime.FunctionInvocationSignature{
+					Params:     []runtime.FunctionInvocationSignatureParam{},
+					ReturnType: ast.NewNullType(errors.Span{}),
+				},
+			},
+			LoadedSingletons: singletons,
+			Mocks:            mocks,
+		},
+		executionContext.Clone(),
+		types.Cancelation{
+			Context:    ctx,
+			CancelFunc: cancel,
+		},
+		nil,
+		&outputBuffer,
+		false,
+		nil,
+	)
+	if err != nil {
+		return types.HmsTestResult{}, err
+	}
+
+	result := types.HmsTestResult{
+		Name:        test.Name,
+		Span:        test.Span,
+		Passed:      !res.Errors.ContainsError,
+		FailureSpan: nil,
+		Output:      outputBuffer.String(),
+		Errors:      make([]types.HmsError, 0),
+		MockedCalls: mocks.Calls(),
+	}
+
+	if res.Errors.ContainsError {
+		result.Errors = res.Errors.Diagnostics
+		if len(res.Errors.Diagnostics) > 0 {
+			span := res.Errors.Diagnostics[0].Span
+			result.FailureSpan = &span
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package homescript
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+func TestRunUserTests(t *testing.T) {
+	code := `import { set_power, power_state, list_devices } from device;
+import { notify } from notification;
+import { set_storage, get_storage } from storage;
+import { assert_eq } from testing;
+
+fn helper() {}
+
+@test
+fn switches_lamp() {
+    assert_eq(power_state("test_lamp"), false);
+    set_power("test_lamp", true);
+    assert_eq(power_state("test_lamp"), true);
+    assert_eq(list_devices().len(), 0);
+}
+
+@test
+fn counts_notifications() {
+    set_storage("test_key", "value");
+    assert_eq(notify("a", "b", 1), 1);
+    assert_eq(notify("a", "b", 1), 2);
+}
+
+@test
+fn fails() {
+    println("before");
+    assert_eq(1, 2);
+}
+
+@test
+fn isolated() {
+    assert_eq(power_state("test_lamp"), false);
+    assert_eq(get_storage("test_key").is_some(), false);
+}
+`
+
+	results, diagnostics, err := HmsManager.RunUserTests(code, "test_runner", "admin")
+	assert.NoError(t, err)
+	assert.False(t, diagnostics.ContainsError)
+
+	// Only annotated functions are tests, they run in the order of their declaration.
+	names := make([]string, len(results))
+	for idx, result := range results {
+		names[idx] = result.Name
+	}
+	assert.Equal(t, []string{"switches_lamp", "counts_notifications", "fails", "isolated"}, names)
+
+	assert.True(t, results[0].Passed, results[0].Errors)
+	assert.Equal(t, []types.MockedCall{
+		{Module: "device", Function: "power_state", Args: []string{"test_lamp"}},
+		{Module: "device", Function: "set_power", Args: []string{"test_lamp", "true"}},
+		{Module: "device", Function: "power_state", Args: []string{"test_lamp"}},
+		{Module: "device", Function: "list_devices", Args: []string{}},
+	}, results[0].MockedCalls)
+
+	// Notification IDs only count notifications, not the other mocked calls.
+	assert.True(t, results[1].Passed, results[1].Errors)
+	assert.Len(t, results[1].MockedCalls, 3)
+
+	assert.False(t, results[2].Passed)
+	assert.Equal(t, "before\n", results[2].Output)
+	assert.NotEmpty(t, results[2].Errors)
+	assert.NotNil(t, results[2].FailureSpan)
+
+	// Mocked state does not leak between tests.
+	assert.True(t, results[3].Passed, results[3].Errors)
+
+	// Programs which do not compile are not executed.
+	results, diagnostics, err = HmsManager.RunUserTests("@test\nfn broken() { let x: int = true; }", "test_runner", "admin")
+	assert.NoError(t, err)
+	assert.True(t, diagnostics.ContainsError)
+	assert.Nil(t, results)
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -14,6 +15,7 @@ const (
 	HMS_PROGRAM_KIND_USER HMS_CONTEXT_KIND = iota
 	HMS_PROGRAM_KIND_DEVICE_DRIVER
 	HMS_PROGRAM_KIND_AUTOMATION
+	HMS_PROGRAM_KIND_WEBHOOK
 )
 
 type ExecutionContext interface {
@@ -28,6 +30,8 @@ type ExecutionContextUser struct {
 	UsernameData string
 	// Arguments entered by the user. (for instance via the web UI)
 	UserArguments map[string]string
+	// Identifies the schedule which caused this execution (used by the execution history).
+	ScheduleID *uint
 }
 
 func (u ExecutionContextUser) Kind() HMS_CONTEXT_KIND      { return HMS_PROGRAM_KIND_USER }
@@ -40,10 +44,17 @@ func (u ExecutionContextUser) Clone() ExecutionContext {
 		newMap[k] = v
 	}
 
+	var scheduleID *uint
+	if u.ScheduleID != nil {
+		id := *u.ScheduleID
+		scheduleID = &id
+	}
+
 	return ExecutionContextUser{
 		Filename:      u.Filename,
 		UsernameData:  u.UsernameData,
 		UserArguments: newMap,
+		ScheduleID:    scheduleID,
 	}
 }
 
@@ -70,6 +81,12 @@ func NewExecutionContextUserNoFilename(
 	}
 }
 
+// Returns the filename which the code of a schedule is executed with.
+// This is also the namespace of its `storage.store`.
+func ScheduleFilename(scheduleID uint) string {
+	return fmt.Sprintf("@schedule-%d", scheduleID)
+}
+
 //
 // Driver context.
 //
@@ -131,6 +148,9 @@ type ExecutionContextAutomationInner struct {
 
 	// TODO: make this general???
 	MaximumHMSRuntime *time.Duration
+
+	// Identifies the automation which caused this execution (used by the execution history).
+	AutomationID *uint
 }
 
 func (i ExecutionContextAutomationInner) Clone() ExecutionContextAutomationInner {
@@ -147,9 +167,16 @@ func (i ExecutionContextAutomationInner) Clone() ExecutionContextAutomationInner
 		mrt = &mrtT
 	}
 
+	var automationID *uint
+	if i.AutomationID != nil {
+		id := *i.AutomationID
+		automationID = &id
+	}
+
 	return ExecutionContextAutomationInner{
 		NotificationContext: n,
 		MaximumHMSRuntime:   mrt,
+		AutomationID:        automationID,
 	}
 }
 
@@ -178,3 +205,67 @@ func (a ExecutionContextAutomation) Clone() ExecutionContext {
 		Inner:       a.Inner.Clone(),
 	}
 }
+
+//
+// Webhook context.
+//
+
+// If the main module of a webhook target declares a function with this name, it is invoked
+// instead of `main` and its return value is mapped to the HTTP response (see `homescript.MapWebhookResponse`).
+const WebhookHandlerIdent = "webhook"
+
+type ExecutionContextWebhook struct {
+	UserContext ExecutionContextUser
+	WebhookID   string
+	Request     ExecutionContextWebhookRequest
+}
+
+type ExecutionContextWebhookRequest struct {
+	Method string
+	// Multiple values of the same header or query parameter are joined using `,`.
+	Headers map[string]string
+	Query   map[string]string
+	Body    string
+}
+
+func (r ExecutionContextWebhookRequest) Clone() ExecutionContextWebhookRequest {
+	headers := make(map[string]string)
+	for k, v := range r.Headers {
+		headers[k] = v
+	}
+
+	query := make(map[string]string)
+	for k, v := range r.Query {
+		query[k] = v
+	}
+
+	return ExecutionContextWebhookRequest{
+		Method:  r.Method,
+		Headers: headers,
+		Query:   query,
+		Body:    r.Body,
+	}
+}
+
+func NewExecutionContextWebhook(
+	user ExecutionContextUser,
+	webhookID string,
+	request ExecutionContextWebhookRequest,
+) ExecutionContextWebhook {
+	return ExecutionContextWebhook{
+		UserContext: user,
+		WebhookID:   webhookID,
+		Request:     request,
+	}
+}
+
+func (w ExecutionContextWebhook) Kind() HMS_CONTEXT_KIND      { return HMS_PROGRAM_KIND_WEBHOOK }
+func (w ExecutionContextWebhook) Username() *string           { return &w.UserContext.UsernameData }
+func (w ExecutionContextWebhook) UserArgs() map[string]string { return w.UserContext.UserArguments }
+func (w ExecutionContextWebhook) Clone() ExecutionContext {
+	return ExecutionContextWebhook{
+		UserContext: w.UserContext.Clone().(ExecutionContextUser),
+		WebhookID:   w.WebhookID,
+		Request:     w.Request.Clone(),
+	}
+}
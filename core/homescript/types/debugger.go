@@ -0,0 +1,340 @@
+package types
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+)
+
+//
+// Interactive debugger
+//
+
+type DebugCommandKind string
+
+const (
+	DebugCommandContinue DebugCommandKind = "continue"
+	DebugCommandPause    DebugCommandKind = "pause"
+	DebugCommandStepOver DebugCommandKind = "step_over"
+	DebugCommandStepInto DebugCommandKind = "step_into"
+	DebugCommandStepOut  DebugCommandKind = "step_out"
+)
+
+type debugMode uint8
+
+const (
+	debugModeRunning debugMode = iota
+	debugModePauseRequested
+	debugModeStepOver
+	debugModeStepInto
+	debugModeStepOut
+)
+
+type DebugStackFrame struct {
+	Function string      `json:"function"`
+	Span     errors.Span `json:"span"`
+}
+
+type DebugVariable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  string `json:"type"`
+}
+
+// Describes the state of the VM while it is paused.
+type DebugState struct {
+	Span      errors.Span       `json:"span"`
+	CallStack []DebugStackFrame `json:"callStack"`
+	Locals    []DebugVariable   `json:"locals"`
+	// Whether the VM was paused because it hit a breakpoint.
+	Breakpoint bool `json:"breakpoint"`
+}
+
+// A debug session is attached to a single program invocation.
+// The VM emits one debug output per instruction, the session decides whether it should pause there.
+type DebugSession struct {
+	lock sync.Mutex
+	// Maps a filename to its breakpoints (line numbers).
+	breakpoints map[string]map[uint]struct{}
+	mode        debugMode
+	// The call stack depth at which the last step command was issued.
+	stepDepth int
+	// The last instruction, only accessed by the goroutine of the main loop.
+	last debugPosition
+
+	// Set while the VM waits for a command, only one command is accepted per pause.
+	paused   bool
+	commands chan DebugCommandKind
+	// Closed when the client detaches, the program then runs without interruption.
+	detached     chan struct{}
+	detachedOnce sync.Once
+	// Emits a state every time the VM is paused, closed when the program terminates.
+	Paused chan DebugState
+	// Closed once the invocation has returned, even if the VM was never started.
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// Identifies an instruction of the VM.
+type debugPosition struct {
+	span  errors.Span
+	depth int
+	// The instruction pointer inside of the current function.
+	ip uint
+}
+
+// Reports whether `next` enters a new line instead of continuing the current one.
+// Jumping back within a line (like in a single-line loop) or (recursively) calling a function enters its line again.
+func (p debugPosition) enters(next debugPosition) bool {
+	return next.span.Filename != p.span.Filename ||
+		next.span.Start.Line != p.span.Start.Line ||
+		next.depth != p.depth ||
+		next.ip <= p.ip
+}
+
+func NewDebugSession() *DebugSession {
+	return &DebugSession{
+		lock:        sync.Mutex{},
+		breakpoints: make(map[string]map[uint]struct{}),
+		// The program is paused before its first line so that the client can inspect it.
+		mode:      debugModeStepInto,
+		stepDepth: 0,
+		paused:    false,
+		commands:  make(chan DebugCommandKind, 1),
+		detached:  make(chan struct{}),
+		Paused:    make(chan DebugState),
+		done:      make(chan struct{}),
+	}
+}
+
+// Replaces all breakpoints of the given file.
+func (s *DebugSession) SetBreakpoints(filename string, lines []uint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	set := make(map[uint]struct{})
+	for _, line := range lines {
+		set[line] = struct{}{}
+	}
+
+	s.breakpoints[filename] = set
+}
+
+// Sends a command to the session. `pause` is handled asynchronously, every other command resumes a paused VM.
+func (s *DebugSession) Command(command DebugCommandKind) {
+	if command == DebugCommandPause {
+		s.lock.Lock()
+		if s.mode == debugModeRunning {
+			s.mode = debugModePauseRequested
+		}
+		s.lock.Unlock()
+		return
+	}
+
+	// Commands are dropped if the VM is not paused at the moment.
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.paused {
+		return
+	}
+	s.paused = false
+
+	// The buffer holds exactly one command, so this never blocks.
+	s.commands <- command
+}
+
+// Detaches the client from the session, the program continues without any breakpoints.
+func (s *DebugSession) Detach() {
+	s.detachedOnce.Do(func() {
+		close(s.detached)
+	})
+}
+
+// Marks the invocation as returned, is safe to call multiple times.
+func (s *DebugSession) Finish() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// Is closed once the invocation has returned, `Paused` is not closed if the VM never started.
+func (s *DebugSession) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *DebugSession) hasBreakpoint(span errors.Span) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	lines, found := s.breakpoints[span.Filename]
+	if !found {
+		return false
+	}
+
+	_, found = lines[span.Start.Line]
+	return found
+}
+
+func (s *DebugSession) shouldPause(depth int) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch s.mode {
+	case debugModePauseRequested, debugModeStepInto:
+		return true
+	case debugModeStepOver:
+		return depth <= s.stepDepth
+	case debugModeStepOut:
+		return depth < s.stepDepth
+	default:
+		return false
+	}
+}
+
+func (s *DebugSession) resume(command DebugCommandKind, depth int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stepDepth = depth
+
+	switch command {
+	case DebugCommandStepOver:
+		s.mode = debugModeStepOver
+	case DebugCommandStepInto:
+		s.mode = debugModeStepInto
+	case DebugCommandStepOut:
+		s.mode = debugModeStepOut
+	default:
+		s.mode = debugModeRunning
+	}
+}
+
+// Consumes the debug output of the VM until it terminates.
+// This function blocks and should be run in a separate goroutine.
+func (s *DebugSession) Mainloop(
+	vm *runtime.VM,
+	debuggerOut *chan runtime.DebugOutput,
+	debuggerIn *chan struct{},
+) {
+	defer close(s.Paused)
+
+	for output := range *debuggerOut {
+		if output.Done {
+			return
+		}
+
+		span := vm.SourceMap(output.CurrentCallFrame)
+		position := debugPosition{
+			span:  span,
+			depth: len(output.CallStack),
+			ip:    uint(output.CurrentCallFrame.InstructionPointer),
+		}
+
+		s.step(position, func(breakpoint bool) DebugState {
+			return s.snapshot(vm, output, span, breakpoint)
+		})
+
+		*debuggerIn <- struct{}{}
+	}
+}
+
+// Is called for every instruction of the VM, blocks while the VM is paused at this instruction.
+// The state is only created if the VM pauses.
+func (s *DebugSession) step(position debugPosition, state func(breakpoint bool) DebugState) {
+	select {
+	case <-s.detached:
+		return
+	default:
+	}
+
+	// Only consider pausing when a line is entered, otherwise every instruction of a line would pause.
+	entered := s.last.enters(position)
+	s.last = position
+	if !entered {
+		return
+	}
+
+	breakpoint := s.hasBreakpoint(position.span)
+	if breakpoint || s.shouldPause(position.depth) {
+		s.pause(state(breakpoint), position.depth)
+	}
+}
+
+// Blocks until the client resumes the VM or detaches from the session.
+func (s *DebugSession) pause(state DebugState, depth int) {
+	// Commands are accepted as soon as the client may have received the state.
+	s.lock.Lock()
+	s.paused = true
+	s.lock.Unlock()
+
+	select {
+	case s.Paused <- state:
+	case <-s.detached:
+		return
+	}
+
+	select {
+	case command := <-s.commands:
+		s.resume(command, depth)
+	case <-s.detached:
+	}
+}
+
+func (s *DebugSession) snapshot(
+	vm *runtime.VM,
+	output runtime.DebugOutput,
+	span errors.Span,
+	breakpoint bool,
+) DebugState {
+	callStack := make([]DebugStackFrame, len(output.CallStack))
+
+	// The innermost frame is listed first.
+	for idx, frame := range output.CallStack {
+		callStack[len(output.CallStack)-1-idx] = DebugStackFrame{
+			Function: frame.Function,
+			Span:     vm.SourceMap(frame),
+		}
+	}
+
+	locals := make([]DebugVariable, 0)
+	for name, val := range output.Locals {
+		locals = append(locals, debugVariable(name, val))
+	}
+
+	// Locals are stored in a map, sorting them keeps the view of the client stable.
+	sort.Slice(locals, func(a, b int) bool {
+		return locals[a].Name < locals[b].Name
+	})
+
+	return DebugState{
+		Span:       span,
+		CallStack:  callStack,
+		Locals:     locals,
+		Breakpoint: breakpoint,
+	}
+}
+
+func debugVariable(name string, val *value.Value) DebugVariable {
+	if val == nil {
+		return DebugVariable{
+			Name:  name,
+			Value: "<uninitialized>",
+			Type:  "unknown",
+		}
+	}
+
+	disp, i := (*val).Display()
+	if i != nil {
+		disp = "<unavailable>"
+	}
+
+	return DebugVariable{
+		Name:  name,
+		Value: disp,
+		Type:  (*val).Kind().TypeKind().String(),
+	}
+}
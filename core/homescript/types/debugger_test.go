@@ -0,0 +1,223 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// An instruction of a simulated VM.
+type debugInstruction struct {
+	line  uint
+	depth int
+	ip    uint
+}
+
+func debugSpan(line uint) errors.Span {
+	return errors.Span{
+		Start:    errors.Location{Line: line},
+		End:      errors.Location{Line: line},
+		Filename: "main",
+	}
+}
+
+// Feeds the instructions to the session like the main loop does for a real VM.
+func runDebugSession(session *DebugSession, instructions []debugInstruction) {
+	go func() {
+		defer close(session.Paused)
+
+		for _, instruction := range instructions {
+			span := debugSpan(instruction.line)
+			position := debugPosition{span: span, depth: instruction.depth, ip: instruction.ip}
+			session.step(position, func(breakpoint bool) DebugState {
+				return DebugState{Span: span, Breakpoint: breakpoint}
+			})
+		}
+	}()
+}
+
+func expectPause(t *testing.T, session *DebugSession, line uint, breakpoint bool) {
+	select {
+	case state, open := <-session.Paused:
+		assert.True(t, open, "expected a pause at line %d, but the program terminated", line)
+		assert.Equal(t, line, state.Span.Start.Line)
+		assert.Equal(t, breakpoint, state.Breakpoint)
+	case <-time.After(time.Second):
+		t.Fatalf("expected a pause at line %d", line)
+	}
+}
+
+func expectTermination(t *testing.T, session *DebugSession) {
+	select {
+	case state, open := <-session.Paused:
+		assert.False(t, open, "expected the program to terminate, but it paused at line %d", state.Span.Start.Line)
+	case <-time.After(time.Second):
+		t.Fatal("expected the program to terminate")
+	}
+}
+
+// `main` (depth 1) calls a function (depth 2) on line 2 which spans the lines 10 and 11.
+var debugTestProgram = []debugInstruction{
+	{line: 1, depth: 1, ip: 0},
+	{line: 1, depth: 1, ip: 1},
+	{line: 2, depth: 1, ip: 2},
+	{line: 10, depth: 2, ip: 0},
+	{line: 11, depth: 2, ip: 1},
+	{line: 2, depth: 1, ip: 3},
+	{line: 3, depth: 1, ip: 4},
+}
+
+func TestDebugSessionSteps(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Commands []DebugCommandKind
+		// The lines at which the VM pauses, the first pause happens before any command is issued.
+		Pauses []uint
+	}{
+		{
+			Name:     "step into",
+			Commands: []DebugCommandKind{DebugCommandStepInto, DebugCommandStepInto, DebugCommandStepInto, DebugCommandStepInto, DebugCommandStepInto, DebugCommandStepInto},
+			// Every line is paused at once, returning to line 2 counts as a new line.
+			Pauses: []uint{1, 2, 10, 11, 2, 3},
+		},
+		{
+			Name:     "step over",
+			Commands: []DebugCommandKind{DebugCommandStepOver, DebugCommandStepOver, DebugCommandStepOver, DebugCommandStepOver},
+			Pauses:   []uint{1, 2, 2, 3},
+		},
+		{
+			Name:     "step out",
+			Commands: []DebugCommandKind{DebugCommandStepInto, DebugCommandStepInto, DebugCommandStepOut, DebugCommandContinue},
+			Pauses:   []uint{1, 2, 10, 2},
+		},
+		{
+			Name:     "continue",
+			Commands: []DebugCommandKind{DebugCommandContinue},
+			Pauses:   []uint{1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			session := NewDebugSession()
+			runDebugSession(session, debugTestProgram)
+
+			for idx, line := range test.Pauses {
+				expectPause(t, session, line, false)
+				session.Command(test.Commands[idx])
+			}
+
+			expectTermination(t, session)
+		})
+	}
+}
+
+func TestDebugSessionBreakpoints(t *testing.T) {
+	session := NewDebugSession()
+	session.SetBreakpoints("main", []uint{11, 3})
+	session.SetBreakpoints("other", []uint{2})
+	runDebugSession(session, debugTestProgram)
+
+	// Continuing stops at every breakpoint.
+	expectPause(t, session, 1, false)
+	session.Command(DebugCommandContinue)
+	expectPause(t, session, 11, true)
+	session.Command(DebugCommandContinue)
+	expectPause(t, session, 3, true)
+	session.Command(DebugCommandContinue)
+	expectTermination(t, session)
+
+	// Replacing the breakpoints of a file removes the old ones.
+	session = NewDebugSession()
+	session.SetBreakpoints("main", []uint{11})
+	session.SetBreakpoints("main", []uint{10})
+	runDebugSession(session, debugTestProgram)
+
+	expectPause(t, session, 1, false)
+	session.Command(DebugCommandContinue)
+	expectPause(t, session, 10, true)
+	session.Command(DebugCommandContinue)
+	expectTermination(t, session)
+}
+
+func TestDebugSessionLoops(t *testing.T) {
+	// A loop on line 1 jumps back to its condition twice before line 2 is reached.
+	program := []debugInstruction{
+		{line: 1, depth: 1, ip: 0},
+		{line: 1, depth: 1, ip: 1},
+		{line: 1, depth: 1, ip: 2},
+		{line: 1, depth: 1, ip: 0},
+		{line: 1, depth: 1, ip: 1},
+		{line: 1, depth: 1, ip: 2},
+		{line: 1, depth: 1, ip: 0},
+		{line: 2, depth: 1, ip: 3},
+	}
+
+	session := NewDebugSession()
+	session.SetBreakpoints("main", []uint{1})
+	runDebugSession(session, program)
+
+	// Every iteration enters the line again and hits the breakpoint.
+	for i := 0; i < 3; i++ {
+		expectPause(t, session, 1, true)
+		session.Command(DebugCommandContinue)
+	}
+	expectTermination(t, session)
+
+	// Recursive calls of a single-line function enter its line again.
+	session = NewDebugSession()
+	session.SetBreakpoints("main", []uint{10})
+	runDebugSession(session, []debugInstruction{
+		{line: 10, depth: 1, ip: 0},
+		{line: 10, depth: 2, ip: 0},
+		{line: 10, depth: 2, ip: 1},
+		{line: 10, depth: 1, ip: 1},
+	})
+
+	expectPause(t, session, 10, true)
+	session.Command(DebugCommandContinue)
+	expectPause(t, session, 10, true)
+	session.Command(DebugCommandContinue)
+	expectPause(t, session, 10, true)
+	session.Command(DebugCommandContinue)
+	expectTermination(t, session)
+}
+
+func TestDebugSessionCommands(t *testing.T) {
+	session := NewDebugSession()
+
+	// Commands are dropped while the VM is running.
+	session.Command(DebugCommandStepInto)
+	assert.Len(t, session.commands, 0)
+
+	// Only the first command of a pause is accepted.
+	runDebugSession(session, debugTestProgram)
+	expectPause(t, session, 1, false)
+	session.Command(DebugCommandContinue)
+	session.Command(DebugCommandStepInto)
+	expectTermination(t, session)
+
+	// A pause request stops the VM at the next line.
+	session = NewDebugSession()
+	session.resume(DebugCommandContinue, 0)
+	session.Command(DebugCommandPause)
+	runDebugSession(session, debugTestProgram)
+	expectPause(t, session, 1, false)
+
+	// Detaching resumes the VM and ignores all breakpoints.
+	session.SetBreakpoints("main", []uint{3})
+	session.Detach()
+	expectTermination(t, session)
+
+	// Sessions whose VM never started are finished without closing `Paused`.
+	session = NewDebugSession()
+	session.Finish()
+	session.Finish()
+	select {
+	case <-session.Done():
+	default:
+		t.Fatal("expected the session to be done")
+	}
+}
@@ -27,6 +27,17 @@ type HmsRes struct {
 	// This is non zero-valued if an additional function is called.
 	// Required so that errors caused by user-implementations can be correctly displayed.
 	CalledFunctionSpan errors.Span
+	// Removes the secrets which the program has read from a string, see `Redact`.
+	// Error messages are already redacted, strings derived from `ReturnValue` are not.
+	Redactor func(input string) string
+}
+
+// Removes the secrets which the program has read from a string.
+func (r HmsRes) Redact(input string) string {
+	if r.Redactor == nil {
+		return input
+	}
+	return r.Redactor(input)
 }
 
 type HmsError struct {
@@ -83,6 +94,9 @@ type HmsDiagnosticError struct {
 	Notes   []string                   `json:"notes"`
 }
 
+// Used if a job was interrupted because it exceeded its resource quota.
+const QuotaExceededInterruptKind = "QuotaExceeded"
+
 type HmsRuntimeInterrupt struct {
 	Kind    string `json:"kind"`
 	Message string `json:"message"`
@@ -25,6 +25,10 @@ type ProgramInvocation struct {
 	Identifier         homescript.InputProgram
 	FunctionInvocation *runtime.FunctionInvocation
 	LoadedSingletons   map[string]value.Value
+	// If this is not <nil>, side-effect modules are replaced by mocks (used by the test runner).
+	Mocks *TestMocks
+	// If this is not <nil>, the program is executed in debug mode and controlled by this session.
+	Debugger *DebugSession
 }
 
 type Cancelation struct {
@@ -0,0 +1,182 @@
+package types
+
+import (
+	"strings"
+	"sync"
+)
+
+// The maximum amount of MQTT messages which are queued for delivery during a simulation.
+// Prevents drivers which reply to their own messages from looping forever.
+const SimulationMaxPendingMqttMessages = 256
+
+// A scripted response to an HTTP request made via `net.http` during a driver simulation.
+type FakeHttpResponse struct {
+	// If empty, any request method is matched.
+	Method string `json:"method"`
+	// A trailing `*` matches any URL with the given prefix.
+	Url        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+	Body       string `json:"body"`
+}
+
+func (self FakeHttpResponse) matches(method, url string) bool {
+	if self.Method != "" && !strings.EqualFold(self.Method, method) {
+		return false
+	}
+
+	if prefix, isPrefix := strings.CutSuffix(self.Url, "*"); isPrefix {
+		return strings.HasPrefix(url, prefix)
+	}
+
+	return self.Url == url
+}
+
+type FakeMqttMessage struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+}
+
+// Scripted replies which are delivered to the subscriptions of a driver once it publishes to `Topic`.
+type FakeMqttResponse struct {
+	// May contain the MQTT wildcards `+` and `#`.
+	Topic   string            `json:"topic"`
+	Replies []FakeMqttMessage `json:"replies"`
+}
+
+// A subscription made via `mqtt.subscribe` during a simulation.
+type MockedSubscription struct {
+	Topics []string `json:"topics"`
+	// The (literal) name of the callback function.
+	Function string `json:"function"`
+}
+
+func (self MockedSubscription) Matches(topic string) bool {
+	for _, filter := range self.Topics {
+		if MqttTopicMatches(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether an MQTT topic filter (which may contain the wildcards `+` and `#`) matches a topic.
+func MqttTopicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for idx, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if idx >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[idx] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
+
+// Scripted network state of a simulation, is part of the test mocks.
+type simulation struct {
+	lock          sync.Mutex
+	httpResponses []FakeHttpResponse
+	mqttResponses []FakeMqttResponse
+	subscriptions []MockedSubscription
+	pending       []FakeMqttMessage
+}
+
+// Creates test mocks which also serve `net.http` and `mqtt` using scripted responses.
+func NewSimulationMocks(httpResponses []FakeHttpResponse, mqttResponses []FakeMqttResponse) *TestMocks {
+	mocks := NewTestMocks()
+	mocks.simulation = &simulation{
+		lock:          sync.Mutex{},
+		httpResponses: httpResponses,
+		mqttResponses: mqttResponses,
+		subscriptions: make([]MockedSubscription, 0),
+		pending:       make([]FakeMqttMessage, 0),
+	}
+	return mocks
+}
+
+// Whether the network modules should be served by scripted responses.
+func (m *TestMocks) IsSimulation() bool {
+	return m.simulation != nil
+}
+
+// Returns the first scripted response which matches the request.
+func (m *TestMocks) MatchHttpResponse(method, url string) (FakeHttpResponse, bool) {
+	m.simulation.lock.Lock()
+	defer m.simulation.lock.Unlock()
+
+	for _, response := range m.simulation.httpResponses {
+		if response.matches(method, url) {
+			return response, true
+		}
+	}
+
+	return FakeHttpResponse{}, false
+}
+
+// Saves a subscription, subscribing the same function to the same topics again is a no-op.
+func (m *TestMocks) AddSubscription(subscription MockedSubscription) {
+	m.simulation.lock.Lock()
+	defer m.simulation.lock.Unlock()
+
+	for _, existing := range m.simulation.subscriptions {
+		if existing.Function == subscription.Function && strings.Join(existing.Topics, "\x00") == strings.Join(subscription.Topics, "\x00") {
+			return
+		}
+	}
+
+	m.simulation.subscriptions = append(m.simulation.subscriptions, subscription)
+}
+
+// Returns the subscriptions which match a topic.
+func (m *TestMocks) SubscriptionsFor(topic string) []MockedSubscription {
+	m.simulation.lock.Lock()
+	defer m.simulation.lock.Unlock()
+
+	matching := make([]MockedSubscription, 0)
+	for _, subscription := range m.simulation.subscriptions {
+		if subscription.Matches(topic) {
+			matching = append(matching, subscription)
+		}
+	}
+
+	return matching
+}
+
+// Queues the scripted replies to a published message.
+// Returns `false` if the queue is full and replies were dropped.
+func (m *TestMocks) PublishMqtt(topic string) bool {
+	m.simulation.lock.Lock()
+	defer m.simulation.lock.Unlock()
+
+	for _, response := range m.simulation.mqttResponses {
+		if !MqttTopicMatches(response.Topic, topic) {
+			continue
+		}
+
+		for _, reply := range response.Replies {
+			if len(m.simulation.pending) >= SimulationMaxPendingMqttMessages {
+				return false
+			}
+			m.simulation.pending = append(m.simulation.pending, reply)
+		}
+	}
+
+	return true
+}
+
+// Returns and clears all queued MQTT messages.
+func (m *TestMocks) TakePendingMqttMessages() []FakeMqttMessage {
+	m.simulation.lock.Lock()
+	defer m.simulation.lock.Unlock()
+
+	pending := m.simulation.pending
+	m.simulation.pending = make([]FakeMqttMessage, 0)
+	return pending
+}
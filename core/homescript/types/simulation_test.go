@@ -0,0 +1,68 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMqttTopicMatches(t *testing.T) {
+	tests := []struct {
+		Filter  string
+		Topic   string
+		Matches bool
+	}{
+		{Filter: "a/b", Topic: "a/b", Matches: true},
+		{Filter: "a/b", Topic: "a/c", Matches: false},
+		{Filter: "a/b", Topic: "a/b/c", Matches: false},
+		{Filter: "a/+/c", Topic: "a/b/c", Matches: true},
+		{Filter: "a/+", Topic: "a/b/c", Matches: false},
+		{Filter: "a/#", Topic: "a/b/c", Matches: true},
+		{Filter: "#", Topic: "a", Matches: true},
+		{Filter: "a/b/c", Topic: "a/b", Matches: false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.Matches, MqttTopicMatches(test.Filter, test.Topic), "%s on %s", test.Filter, test.Topic)
+	}
+}
+
+func TestSimulationMocks(t *testing.T) {
+	mocks := NewSimulationMocks(
+		[]FakeHttpResponse{
+			{Method: "POST", Url: "http://device/rpc", StatusCode: 201, Body: "created"},
+			{Method: "", Url: "http://device/*", StatusCode: 200, Body: "ok"},
+		},
+		[]FakeMqttResponse{
+			{Topic: "cmnd/+/POWER", Replies: []FakeMqttMessage{{Topic: "stat/plug/POWER", Payload: "ON"}}},
+		},
+	)
+	assert.True(t, mocks.IsSimulation())
+	assert.False(t, NewTestMocks().IsSimulation())
+
+	response, found := mocks.MatchHttpResponse("post", "http://device/rpc")
+	assert.True(t, found)
+	assert.Equal(t, 201, response.StatusCode)
+
+	response, found = mocks.MatchHttpResponse("GET", "http://device/rpc")
+	assert.True(t, found)
+	assert.Equal(t, "ok", response.Body)
+
+	_, found = mocks.MatchHttpResponse("GET", "http://other/")
+	assert.False(t, found)
+
+	mocks.AddSubscription(MockedSubscription{Topics: []string{"stat/plug/#"}, Function: "on_message"})
+	mocks.AddSubscription(MockedSubscription{Topics: []string{"stat/plug/#"}, Function: "on_message"})
+	assert.Len(t, mocks.SubscriptionsFor("stat/plug/POWER"), 1)
+	assert.Empty(t, mocks.SubscriptionsFor("tele/plug/STATE"))
+
+	assert.True(t, mocks.PublishMqtt("cmnd/plug/POWER"))
+	assert.True(t, mocks.PublishMqtt("cmnd/plug/STATUS"))
+	assert.Equal(t, []FakeMqttMessage{{Topic: "stat/plug/POWER", Payload: "ON"}}, mocks.TakePendingMqttMessages())
+	assert.Empty(t, mocks.TakePendingMqttMessages())
+
+	for idx := 0; idx < SimulationMaxPendingMqttMessages; idx++ {
+		assert.True(t, mocks.PublishMqtt("cmnd/plug/POWER"))
+	}
+	assert.False(t, mocks.PublishMqtt("cmnd/plug/POWER"))
+}
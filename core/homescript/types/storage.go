@@ -0,0 +1,228 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+)
+
+//
+// Typed Homescript storage
+// Values are persisted as tagged JSON so that they can be restored with their original type.
+//
+
+type StoredValueKind string
+
+const (
+	StoredValueNull      StoredValueKind = "null"
+	StoredValueInt       StoredValueKind = "int"
+	StoredValueFloat     StoredValueKind = "float"
+	StoredValueBool      StoredValueKind = "bool"
+	StoredValueString    StoredValueKind = "string"
+	StoredValueList      StoredValueKind = "list"
+	StoredValueObject    StoredValueKind = "object"
+	StoredValueAnyObject StoredValueKind = "anyobj"
+	StoredValueOption    StoredValueKind = "option"
+)
+
+// Nested values are stored as `StoredValue`s themselves.
+type StoredValue struct {
+	Kind  StoredValueKind `json:"k"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+// Converts a runtime value into its tagged JSON representation.
+// Values which cannot be persisted, for instance functions, result in an error.
+func EncodeStoredValue(val value.Value) (string, error) {
+	stored, err := toStoredValue(val)
+	if err != nil {
+		return "", err
+	}
+
+	marshaled, err := json.Marshal(stored)
+	if err != nil {
+		return "", err
+	}
+
+	return string(marshaled), nil
+}
+
+func toStoredValue(val value.Value) (StoredValue, error) {
+	if val.Kind() == value.NullValueKind {
+		return StoredValue{Kind: StoredValueNull}, nil
+	}
+
+	var kind StoredValueKind
+	var inner any
+
+	switch v := val.(type) {
+	case value.ValueInt:
+		kind, inner = StoredValueInt, v.Inner
+	case value.ValueFloat:
+		kind, inner = StoredValueFloat, v.Inner
+	case value.ValueBool:
+		kind, inner = StoredValueBool, v.Inner
+	case value.ValueString:
+		kind, inner = StoredValueString, v.Inner
+	case value.ValueList:
+		list := make([]StoredValue, len(*v.Values))
+		for idx, item := range *v.Values {
+			stored, err := toStoredValue(*item)
+			if err != nil {
+				return StoredValue{}, err
+			}
+			list[idx] = stored
+		}
+		kind, inner = StoredValueList, list
+	case value.ValueObject:
+		fields, err := toStoredFields(v.FieldsInternal)
+		if err != nil {
+			return StoredValue{}, err
+		}
+		kind, inner = StoredValueObject, fields
+	case value.ValueAnyObject:
+		fields, err := toStoredFields(v.FieldsInternal)
+		if err != nil {
+			return StoredValue{}, err
+		}
+		kind, inner = StoredValueAnyObject, fields
+	case value.ValueOption:
+		if v.Inner == nil {
+			return StoredValue{Kind: StoredValueOption}, nil
+		}
+		stored, err := toStoredValue(*v.Inner)
+		if err != nil {
+			return StoredValue{}, err
+		}
+		kind, inner = StoredValueOption, stored
+	default:
+		return StoredValue{}, fmt.Errorf("values of kind `%v` cannot be stored", val.Kind())
+	}
+
+	marshaled, err := json.Marshal(inner)
+	if err != nil {
+		return StoredValue{}, err
+	}
+
+	return StoredValue{Kind: kind, Value: marshaled}, nil
+}
+
+func toStoredFields(fields map[string]*value.Value) (map[string]StoredValue, error) {
+	output := make(map[string]StoredValue)
+	for key, field := range fields {
+		stored, err := toStoredValue(*field)
+		if err != nil {
+			return nil, err
+		}
+		output[key] = stored
+	}
+	return output, nil
+}
+
+// Restores a runtime value from its tagged JSON representation.
+func DecodeStoredValue(data string) (*value.Value, error) {
+	var stored StoredValue
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, err
+	}
+	return fromStoredValue(stored)
+}
+
+func fromStoredValue(stored StoredValue) (*value.Value, error) {
+	switch stored.Kind {
+	case StoredValueNull:
+		return value.NewValueNull(), nil
+	case StoredValueInt:
+		var inner int64
+		if err := json.Unmarshal(stored.Value, &inner); err != nil {
+			return nil, fmt.Errorf("invalid int: %s", err.Error())
+		}
+		return value.NewValueInt(inner), nil
+	case StoredValueFloat:
+		var inner float64
+		if err := json.Unmarshal(stored.Value, &inner); err != nil {
+			return nil, fmt.Errorf("invalid float: %s", err.Error())
+		}
+		return value.NewValueFloat(inner), nil
+	case StoredValueBool:
+		var inner bool
+		if err := json.Unmarshal(stored.Value, &inner); err != nil {
+			return nil, fmt.Errorf("invalid bool: %s", err.Error())
+		}
+		return value.NewValueBool(inner), nil
+	case StoredValueString:
+		var inner string
+		if err := json.Unmarshal(stored.Value, &inner); err != nil {
+			return nil, fmt.Errorf("invalid string: %s", err.Error())
+		}
+		return value.NewValueString(inner), nil
+	case StoredValueList:
+		var inner []StoredValue
+		if err := json.Unmarshal(stored.Value, &inner); err != nil {
+			return nil, fmt.Errorf("invalid list: %s", err.Error())
+		}
+		list := make([]*value.Value, len(inner))
+		for idx, item := range inner {
+			val, err := fromStoredValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list[idx] = val
+		}
+		return value.NewValueList(list), nil
+	case StoredValueObject, StoredValueAnyObject:
+		var inner map[string]StoredValue
+		if err := json.Unmarshal(stored.Value, &inner); err != nil {
+			return nil, fmt.Errorf("invalid object: %s", err.Error())
+		}
+		fields := make(map[string]*value.Value)
+		for key, field := range inner {
+			val, err := fromStoredValue(field)
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = val
+		}
+		if stored.Kind == StoredValueAnyObject {
+			return value.NewValueAnyObject(fields), nil
+		}
+		return value.NewValueObject(fields), nil
+	case StoredValueOption:
+		if len(stored.Value) == 0 || string(stored.Value) == "null" {
+			return value.NewNoneOption(), nil
+		}
+		var inner StoredValue
+		if err := json.Unmarshal(stored.Value, &inner); err != nil {
+			return nil, fmt.Errorf("invalid option: %s", err.Error())
+		}
+		val, err := fromStoredValue(inner)
+		if err != nil {
+			return nil, err
+		}
+		return value.NewValueOption(val), nil
+	default:
+		return nil, fmt.Errorf("unknown value kind `%s`", stored.Kind)
+	}
+}
+
+// Decodes and re-encodes a tagged JSON value.
+// This is used to validate values which were edited by users and to make them comparable by `compare_and_swap`.
+func NormalizeStoredValue(data string) (string, StoredValueKind, error) {
+	val, err := DecodeStoredValue(data)
+	if err != nil {
+		return "", "", err
+	}
+
+	normalized, err := EncodeStoredValue(*val)
+	if err != nil {
+		return "", "", err
+	}
+
+	var stored StoredValue
+	if err := json.Unmarshal([]byte(normalized), &stored); err != nil {
+		return "", "", err
+	}
+
+	return normalized, stored.Kind, nil
+}
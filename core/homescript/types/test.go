@@ -0,0 +1,170 @@
+package types
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+)
+
+// Functions annotated with this identifier (`@test`) are discovered by the test runner.
+const TestAnnotationIdent = "test"
+
+// Records a call to a mocked builtin function during test execution.
+type MockedCall struct {
+	Module   string   `json:"module"`
+	Function string   `json:"function"`
+	Args     []string `json:"args"`
+}
+
+// Holds the state of all mocked modules of a single test execution.
+// Every test receives its own instance so that tests cannot influence each other.
+type TestMocks struct {
+	lock    sync.Mutex
+	storage map[string]string
+	// The power states of devices which were switched by the test.
+	power map[string]bool
+	// Entries of the typed storage, indexed by namespace and key.
+	store map[string]map[string]string
+	calls []MockedCall
+	// Is only set for driver simulations, see `NewSimulationMocks`.
+	simulation *simulation
+}
+
+func NewTestMocks() *TestMocks {
+	return &TestMocks{
+		lock:    sync.Mutex{},
+		storage: make(map[string]string),
+		power:   make(map[string]bool),
+		store:   make(map[string]map[string]string),
+		calls:   make([]MockedCall, 0),
+	}
+}
+
+func (m *TestMocks) RecordCall(module, function string, args []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.calls = append(m.calls, MockedCall{
+		Module:   module,
+		Function: function,
+		Args:     args,
+	})
+}
+
+func (m *TestMocks) Calls() []MockedCall {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	calls := make([]MockedCall, len(m.calls))
+	copy(calls, m.calls)
+	return calls
+}
+
+// Returns how often the given function was called.
+func (m *TestMocks) CallCount(module, function string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	count := 0
+	for _, call := range m.calls {
+		if call.Module == module && call.Function == function {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *TestMocks) SetPowerState(deviceID string, on bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.power[deviceID] = on
+}
+
+// Devices which were not switched by the test are turned off.
+func (m *TestMocks) PowerState(deviceID string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.power[deviceID]
+}
+
+func (m *TestMocks) SetStorage(key, value string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.storage[key] = value
+}
+
+func (m *TestMocks) GetStorage(key string) (string, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	value, found := m.storage[key]
+	return value, found
+}
+
+// Atomically replaces an entry of the mocked typed storage, see `database.UpdateHomescriptStorageEntry`.
+func (m *TestMocks) UpdateStoreEntry(namespace, key string, update func(current *string) (*string, error)) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var current *string
+	if value, found := m.store[namespace][key]; found {
+		current = &value
+	}
+
+	newValue, err := update(current)
+	if err != nil || newValue == nil {
+		return err
+	}
+
+	if m.store[namespace] == nil {
+		m.store[namespace] = make(map[string]string)
+	}
+	m.store[namespace][key] = *newValue
+
+	return nil
+}
+
+func (m *TestMocks) DeleteStoreEntry(namespace, key string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	_, found := m.store[namespace][key]
+	delete(m.store[namespace], key)
+	return found
+}
+
+func (m *TestMocks) StoreKeys(namespace, prefix string) []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := make([]string, 0)
+	for key := range m.store[namespace] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// A function which was discovered as a test.
+type TestFunction struct {
+	Name string      `json:"name"`
+	Span errors.Span `json:"span"`
+}
+
+type HmsTestResult struct {
+	Name   string      `json:"name"`
+	Span   errors.Span `json:"span"`
+	Passed bool        `json:"passed"`
+	// If the test failed, this points to the failing assertion (or any other runtime error).
+	FailureSpan *errors.Span `json:"failureSpan"`
+	Output      string       `json:"output"`
+	Errors      []HmsError   `json:"errors"`
+	MockedCalls []MockedCall `json:"mockedCalls"`
+}
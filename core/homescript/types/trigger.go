@@ -6,13 +6,22 @@ import (
 )
 
 const TriggerMqttMessageIdent = "message"
+const TriggerMqttBrokerMessageIdent = "message_from"
 const TriggerMinuteIdent = "minute"
 const TriggerKillIdent = "kill"
 const TriggerDeviceEvent = "device_event"
 const TriggerDeviceClassEvent = "device_class_event"
+const TriggerCronIdent = "cron"
+const TriggerSunriseIdent = "sunrise"
+const TriggerSunsetIdent = "sunset"
+const TriggerAtIdent = "at"
 
 // When a Homescript is executed in user mode, the user cannot use these triggers.
-var ForbiddenUserTriggers = []string{TriggerMqttMessageIdent, TriggerMinuteIdent}
+var ForbiddenUserTriggers = []string{
+	TriggerMqttMessageIdent,
+	TriggerMqttBrokerMessageIdent,
+	TriggerMinuteIdent,
+}
 
 type TriggerAnnotation struct {
 	// Callback function name (mangled)
@@ -0,0 +1,465 @@
+package homescript
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smarthome-go/homescript/v3/homescript"
+	"github.com/smarthome-go/homescript/v3/homescript/analyzer/ast"
+	"github.com/smarthome-go/homescript/v3/homescript/errors"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// The header which contains the HMAC-SHA256 signature of the request body.
+// Its value is expected to be in the format `sha256=<hex digest>`.
+const WebhookSignatureHeader = "X-Smarthome-Signature"
+
+const webhookSignaturePrefix = "sha256="
+
+// Every webhook may be invoked `webhookRateBurst` times at once, afterwards, one request per `webhookRateInterval` is allowed.
+// Requests are counted before their signature is checked so that the limit also slows down guessing attacks.
+const (
+	webhookRateBurst    = 10
+	webhookRateInterval = 2 * time.Second
+)
+
+// Headers which are controlled by the server and cannot be set by a webhook.
+// Cookies are forbidden as webhooks share the origin of the web interface.
+var webhookReservedHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Content-Security-Policy",
+	"Set-Cookie",
+	"Transfer-Encoding",
+	"X-Content-Type-Options",
+}
+
+// Headers which are sent with every webhook response.
+// As webhooks are served from the origin of the web interface, browsers must never execute their responses.
+var webhookSecurityHeaders = map[string]string{
+	"Content-Security-Policy": "sandbox",
+	"X-Content-Type-Options":  "nosniff",
+}
+
+// Content types which browsers render as documents or execute as scripts.
+var webhookForbiddenContentTypes = []string{
+	"text/html",
+	"text/xml",
+	"application/xml",
+	"application/xhtml+xml",
+	"image/svg+xml",
+	"text/javascript",
+	"application/javascript",
+	"application/x-javascript",
+	"text/ecmascript",
+	"application/ecmascript",
+}
+
+var webhookHeaderNameRegex = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+type webhookRateLimiter struct {
+	lock    sync.Mutex
+	buckets map[string]webhookBucket
+	now     func() time.Time
+}
+
+type webhookBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+var webhookLimiter = newWebhookRateLimiter(time.Now)
+
+func newWebhookRateLimiter(now func() time.Time) *webhookRateLimiter {
+	return &webhookRateLimiter{
+		buckets: make(map[string]webhookBucket),
+		now:     now,
+	}
+}
+
+// Consumes a token of the webhook's bucket.
+// If the bucket is empty, the duration until the next token is available is returned.
+func (l *webhookRateLimiter) allow(webhookID string) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+
+	bucket, found := l.buckets[webhookID]
+	if !found {
+		bucket = webhookBucket{tokens: webhookRateBurst, updated: now}
+	}
+
+	bucket.tokens += float64(now.Sub(bucket.updated)) / float64(webhookRateInterval)
+	if bucket.tokens > webhookRateBurst {
+		bucket.tokens = webhookRateBurst
+	}
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		l.buckets[webhookID] = bucket
+		return false, time.Duration((1 - bucket.tokens) * float64(webhookRateInterval))
+	}
+
+	bucket.tokens--
+	l.buckets[webhookID] = bucket
+
+	return true, 0
+}
+
+func (l *webhookRateLimiter) forget(webhookID string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	delete(l.buckets, webhookID)
+}
+
+// Reports whether another request to the webhook is allowed by its rate limit.
+// Otherwise, the duration after which the caller may retry is returned.
+func AllowWebhookRequest(webhookID string) (bool, time.Duration) {
+	return webhookLimiter.allow(webhookID)
+}
+
+// Resets the rate limit of a webhook, is called once the webhook is deleted.
+func ForgetWebhookRateLimit(webhookID string) {
+	webhookLimiter.forget(webhookID)
+}
+
+// The HTTP response of a webhook which is derived from the return value of its `webhook` function.
+type WebhookResponse struct {
+	Status  int
+	Headers map[string]string
+	// Is `nil` if the response has no body.
+	Body []byte
+}
+
+// Maps the marshaled (and redacted) return value of a webhook to its HTTP response:
+//   - `null` results in an empty response with status 204.
+//   - An object with an integer `status` field and no fields other than `status`, `headers` and `body` describes the response.
+//     `headers` must be an object of strings, `body` is encoded like a plain return value.
+//   - Any other value is the body of a response with status 200: strings are sent as text, everything else is encoded as JSON.
+func MapWebhookResponse(marshaled any) (WebhookResponse, error) {
+	response := WebhookResponse{
+		Status:  http.StatusOK,
+		Headers: make(map[string]string),
+	}
+
+	body := marshaled
+
+	if fields, isObject := marshaled.(map[string]any); isObject && isWebhookResponseObject(fields) {
+		status, _ := webhookStatusCode(fields["status"])
+		if status < 100 || status > 599 {
+			return WebhookResponse{}, fmt.Errorf("Status code %d is invalid", status)
+		}
+		response.Status = status
+
+		if rawHeaders, found := fields["headers"]; found && rawHeaders != nil {
+			headers, isObject := rawHeaders.(map[string]any)
+			if !isObject {
+				return WebhookResponse{}, fmt.Errorf("Field `headers` must be an object")
+			}
+
+			for name, rawValue := range headers {
+				value, isString := rawValue.(string)
+				if !isString {
+					return WebhookResponse{}, fmt.Errorf("Value of header `%s` must be a string", name)
+				}
+				if err := validateWebhookHeader(name, value); err != nil {
+					return WebhookResponse{}, err
+				}
+				response.Headers[http.CanonicalHeaderKey(name)] = value
+			}
+		}
+
+		body = fields["body"]
+	}
+
+	if body == nil {
+		if marshaled == nil {
+			response.Status = http.StatusNoContent
+		}
+		return withWebhookSecurityHeaders(response), nil
+	}
+
+	contentType := "application/json"
+	if text, isString := body.(string); isString {
+		contentType = "text/plain; charset=utf-8"
+		response.Body = []byte(text)
+	} else {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return WebhookResponse{}, fmt.Errorf("Body could not be encoded: %s", err.Error())
+		}
+		response.Body = encoded
+	}
+
+	if _, found := response.Headers["Content-Type"]; !found {
+		response.Headers["Content-Type"] = contentType
+	}
+
+	return withWebhookSecurityHeaders(response), nil
+}
+
+// Adds the security headers to a response, they must be sent even if the body is empty.
+func withWebhookSecurityHeaders(response WebhookResponse) WebhookResponse {
+	for name, value := range webhookSecurityHeaders {
+		response.Headers[name] = value
+	}
+	return response
+}
+
+func isWebhookResponseObject(fields map[string]any) bool {
+	if _, isInt := webhookStatusCode(fields["status"]); !isInt {
+		return false
+	}
+
+	for key := range fields {
+		switch key {
+		case "status", "headers", "body":
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func webhookStatusCode(raw any) (int, bool) {
+	switch status := raw.(type) {
+	case int64:
+		return int(status), true
+	case int:
+		return status, true
+	default:
+		return 0, false
+	}
+}
+
+func validateWebhookHeader(name string, value string) error {
+	if !webhookHeaderNameRegex.MatchString(name) {
+		return fmt.Errorf("Header name `%s` is invalid", name)
+	}
+
+	for _, reserved := range webhookReservedHeaders {
+		if strings.EqualFold(name, reserved) {
+			return fmt.Errorf("Header `%s` cannot be set by a webhook", reserved)
+		}
+	}
+
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return fmt.Errorf("Value of header `%s` contains invalid characters", name)
+	}
+
+	if strings.EqualFold(name, "Content-Type") {
+		return validateWebhookContentType(value)
+	}
+
+	return nil
+}
+
+func validateWebhookContentType(value string) error {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return fmt.Errorf("Content type `%s` is invalid", value)
+	}
+
+	if slices.Contains(webhookForbiddenContentTypes, mediaType) ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		strings.HasSuffix(mediaType, "/xml") ||
+		strings.Contains(mediaType, "javascript") ||
+		strings.Contains(mediaType, "ecmascript") {
+		return fmt.Errorf("Content type `%s` cannot be sent by a webhook", mediaType)
+	}
+
+	return nil
+}
+
+// Creates a new webhook with a random (secret) id which runs the given Homescript.
+func CreateWebhook(
+	owner, homescriptID, name string,
+	methods []string,
+	hmacSecret *string,
+) (database.HomescriptWebhook, error) {
+	var id string
+
+	// Generate a new random id as long as it is taken.
+	for {
+		seed := make([]byte, database.HomescriptWebhookIdLen/2)
+		if _, err := rand.Read(seed); err != nil {
+			return database.HomescriptWebhook{}, err
+		}
+		id = hex.EncodeToString(seed)
+
+		_, found, err := database.GetHomescriptWebhookById(id)
+		if err != nil {
+			return database.HomescriptWebhook{}, err
+		}
+		if !found {
+			break
+		}
+		logger.Warn("Random webhook id already exists, generating new one...")
+	}
+
+	normalizedMethods := make([]string, len(methods))
+	for idx, method := range methods {
+		normalizedMethods[idx] = strings.ToUpper(method)
+	}
+
+	webhook := database.HomescriptWebhook{
+		Id:           id,
+		Owner:        owner,
+		HomescriptId: homescriptID,
+		Name:         name,
+		Methods:      normalizedMethods,
+		HmacSecret:   hmacSecret,
+	}
+
+	if err := database.CreateHomescriptWebhook(webhook); err != nil {
+		return database.HomescriptWebhook{}, err
+	}
+
+	logger.Infof("User `%s` added a new webhook named `%s` for Homescript `%s`", owner, name, homescriptID)
+	return webhook, nil
+}
+
+// Reports whether the webhook accepts requests using the given HTTP method.
+func WebhookAllowsMethod(webhook database.HomescriptWebhook, method string) bool {
+	if len(webhook.Methods) == 0 {
+		return true
+	}
+
+	for _, allowed := range webhook.Methods {
+		if allowed == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validates the HMAC signature of a request body.
+// Webhooks without a secret accept every request.
+func VerifyWebhookSignature(webhook database.HomescriptWebhook, body []byte, signature string) bool {
+	if webhook.HmacSecret == nil {
+		return true
+	}
+
+	if !strings.HasPrefix(signature, webhookSignaturePrefix) {
+		return false
+	}
+
+	received, err := hex.DecodeString(strings.TrimPrefix(signature, webhookSignaturePrefix))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(*webhook.HmacSecret))
+	mac.Write(body)
+
+	return hmac.Equal(received, mac.Sum(nil))
+}
+
+// Removes secrets from all strings of a marshaled return value, see `types.HmsRes.Redact`.
+func RedactMarshaledValue(marshaled any, redact func(input string) string) any {
+	switch inner := marshaled.(type) {
+	case string:
+		return redact(inner)
+	case []any:
+		redacted := make([]any, len(inner))
+		for idx, item := range inner {
+			redacted[idx] = RedactMarshaledValue(item, redact)
+		}
+		return redacted
+	case map[string]any:
+		redacted := make(map[string]any, len(inner))
+		for key, item := range inner {
+			redacted[redact(key)] = RedactMarshaledValue(item, redact)
+		}
+		return redacted
+	default:
+		return marshaled
+	}
+}
+
+// Runs the target Homescript of a webhook in the webhook execution context.
+// If the script declares a `webhook` function, it is invoked instead of `main` so that its return value can be used as the response.
+func (m *Manager) RunWebhook(
+	webhook database.HomescriptWebhook,
+	request types.ExecutionContextWebhookRequest,
+	cancelation types.Cancelation,
+	outputWriter io.Writer,
+) (types.HmsRes, error) {
+	script, found, err := m.GetPersonalScriptById(webhook.HomescriptId, webhook.Owner)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+	if !found {
+		return types.HmsRes{}, fmt.Errorf("Homescript with ID `%s` owned by user `%s` was not found", webhook.HomescriptId, webhook.Owner)
+	}
+
+	input := homescript.InputProgram{
+		ProgramText: script.Data.Code,
+		Filename:    script.Data.Id,
+	}
+
+	context := types.NewExecutionContextWebhook(
+		types.NewExecutionContextUser(script.Data.Id, webhook.Owner, make(map[string]string)),
+		webhook.Id,
+		request,
+	)
+
+	modules, diagnostics, err := m.Analyze(input, context)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+
+	// Scripts containing errors are still passed on so that the diagnostics are recorded in the history.
+	var function *runtime.FunctionInvocation
+	if !diagnostics.ContainsError {
+		for _, fn := range modules[input.Filename].Functions {
+			if fn.Ident.Ident() != types.WebhookHandlerIdent {
+				continue
+			}
+
+			function = &runtime.FunctionInvocation{
+				Function:    types.WebhookHandlerIdent,
+				LiteralName: true,
+				Args:        []value.Value{},
+				FunctionSignature: runtime.FunctionInvocationSignature{
+					Params:     []runtime.FunctionInvocationSignatureParam{},
+					ReturnType: ast.NewAnyType(errors.Span{}),
+				},
+			}
+			break
+		}
+	}
+
+	return m.RunGeneric(
+		types.ProgramInvocation{
+			Identifier:         input,
+			FunctionInvocation: function,
+			LoadedSingletons:   map[string]value.Value{},
+		},
+		context,
+		cancelation,
+		nil,
+		outputWriter,
+		false,
+		nil,
+	)
+}
@@ -0,0 +1,209 @@
+package homescript
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactMarshaledValue(t *testing.T) {
+	redact := func(input string) string {
+		return strings.ReplaceAll(input, "hunter2", "********")
+	}
+
+	marshaled := map[string]any{
+		"token":   "Bearer hunter2",
+		"hunter2": int64(42),
+		"nested": []any{
+			"hunter2",
+			map[string]any{"ok": true},
+			nil,
+		},
+	}
+
+	assert.Equal(t, map[string]any{
+		"token":    "Bearer ********",
+		"********": int64(42),
+		"nested": []any{
+			"********",
+			map[string]any{"ok": true},
+			nil,
+		},
+	}, RedactMarshaledValue(marshaled, redact))
+
+	// The original value is not modified
+	assert.Equal(t, "Bearer hunter2", marshaled["token"])
+}
+
+// Adds the headers which are sent with every webhook response.
+func securityHeaders(headers map[string]string) map[string]string {
+	headers["Content-Security-Policy"] = "sandbox"
+	headers["X-Content-Type-Options"] = "nosniff"
+	return headers
+}
+
+func TestMapWebhookResponse(t *testing.T) {
+	table := []struct {
+		Name     string
+		Input    any
+		Expected WebhookResponse
+		Valid    bool
+	}{
+		{
+			Name:     "no return value",
+			Input:    nil,
+			Expected: WebhookResponse{Status: http.StatusNoContent, Headers: securityHeaders(map[string]string{})},
+			Valid:    true,
+		},
+		{
+			Name:  "text",
+			Input: "ok",
+			Expected: WebhookResponse{
+				Status:  http.StatusOK,
+				Headers: securityHeaders(map[string]string{"Content-Type": "text/plain; charset=utf-8"}),
+				Body:    []byte("ok"),
+			},
+			Valid: true,
+		},
+		{
+			Name:  "plain object",
+			Input: map[string]any{"status": "ok", "count": int64(2)},
+			Expected: WebhookResponse{
+				Status:  http.StatusOK,
+				Headers: securityHeaders(map[string]string{"Content-Type": "application/json"}),
+				Body:    []byte(`{"count":2,"status":"ok"}`),
+			},
+			Valid: true,
+		},
+		{
+			Name: "mapped response",
+			Input: map[string]any{
+				"status":  int64(201),
+				"headers": map[string]any{"x-request-id": "42"},
+				"body":    []any{int64(1), int64(2)},
+			},
+			Expected: WebhookResponse{
+				Status:  http.StatusCreated,
+				Headers: securityHeaders(map[string]string{"X-Request-Id": "42", "Content-Type": "application/json"}),
+				Body:    []byte(`[1,2]`),
+			},
+			Valid: true,
+		},
+		{
+			Name: "mapped response without body",
+			Input: map[string]any{
+				"status":  int64(302),
+				"headers": map[string]any{"Location": "/dash"},
+			},
+			Expected: WebhookResponse{
+				Status:  http.StatusFound,
+				Headers: securityHeaders(map[string]string{"Location": "/dash"}),
+			},
+			Valid: true,
+		},
+		{
+			Name: "custom content type",
+			Input: map[string]any{
+				"status":  int64(200),
+				"headers": map[string]any{"Content-Type": "text/csv; charset=utf-8"},
+				"body":    "a,b",
+			},
+			Expected: WebhookResponse{
+				Status:  http.StatusOK,
+				Headers: securityHeaders(map[string]string{"Content-Type": "text/csv; charset=utf-8"}),
+				Body:    []byte("a,b"),
+			},
+			Valid: true,
+		},
+		{
+			Name:  "html is forbidden",
+			Input: map[string]any{"status": int64(200), "headers": map[string]any{"content-type": "Text/HTML; charset=utf-8"}, "body": "<b>ok</b>"},
+			Valid: false,
+		},
+		{
+			Name:  "svg is forbidden",
+			Input: map[string]any{"status": int64(200), "headers": map[string]any{"Content-Type": "image/svg+xml"}},
+			Valid: false,
+		},
+		{
+			Name:  "javascript is forbidden",
+			Input: map[string]any{"status": int64(200), "headers": map[string]any{"Content-Type": "application/javascript"}},
+			Valid: false,
+		},
+		{
+			Name:  "invalid content type",
+			Input: map[string]any{"status": int64(200), "headers": map[string]any{"Content-Type": "text/html;;"}},
+			Valid: false,
+		},
+		{
+			Name:  "security headers cannot be overridden",
+			Input: map[string]any{"status": int64(200), "headers": map[string]any{"content-security-policy": "default-src *"}},
+			Valid: false,
+		},
+		{
+			Name:  "invalid status code",
+			Input: map[string]any{"status": int64(42)},
+			Valid: false,
+		},
+		{
+			Name:  "cookies are forbidden",
+			Input: map[string]any{"status": int64(200), "headers": map[string]any{"set-cookie": "session=x"}},
+			Valid: false,
+		},
+		{
+			Name:  "header injection",
+			Input: map[string]any{"status": int64(200), "headers": map[string]any{"X-Foo": "a\r\nSet-Cookie: session=x"}},
+			Valid: false,
+		},
+		{
+			Name:  "non-string header value",
+			Input: map[string]any{"status": int64(200), "headers": map[string]any{"X-Foo": int64(1)}},
+			Valid: false,
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.Name, func(t *testing.T) {
+			response, err := MapWebhookResponse(test.Input)
+			if !test.Valid {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.Expected, response)
+		})
+	}
+}
+
+func TestWebhookRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newWebhookRateLimiter(func() time.Time { return now })
+
+	for i := 0; i < webhookRateBurst; i++ {
+		allowed, _ := limiter.allow("a")
+		assert.True(t, allowed)
+	}
+
+	allowed, retryAfter := limiter.allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, webhookRateInterval, retryAfter)
+
+	// Other webhooks are not affected
+	allowed, _ = limiter.allow("b")
+	assert.True(t, allowed)
+
+	// A token is refilled after the interval
+	now = now.Add(webhookRateInterval)
+	allowed, _ = limiter.allow("a")
+	assert.True(t, allowed)
+	allowed, _ = limiter.allow("a")
+	assert.False(t, allowed)
+
+	limiter.forget("a")
+	allowed, _ = limiter.allow("a")
+	assert.True(t, allowed)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/smarthome-go/smarthome/core/database"
 	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/mqttbroker"
 	"github.com/smarthome-go/smarthome/core/user"
 )
 
@@ -361,6 +362,45 @@ func createUsersInDatabase(users []SetupUser) error {
 			}
 		}
 
+		for _, entry := range usr.HomescriptStore {
+			// Only the remaining lifetime of expiring entries is restored
+			var ttlSeconds *int64
+			if entry.ExpiresAt != nil {
+				remaining := int64(time.Until(*entry.ExpiresAt).Seconds())
+				if remaining <= 0 {
+					continue
+				}
+				ttlSeconds = &remaining
+			}
+			if err := database.SetHomescriptStorageEntry(
+				usr.Data.Username,
+				entry.Namespace,
+				entry.Key,
+				string(entry.Value),
+				ttlSeconds,
+			); err != nil {
+				return err
+			}
+		}
+
+		// Setup Homescript secrets, these are imported in their encrypted form
+		for _, secretItem := range usr.HomescriptSecrets {
+			ciphertext, err := base64.StdEncoding.DecodeString(secretItem.Ciphertext)
+			if err != nil {
+				return fmt.Errorf("invalid ciphertext of secret `%s`: %s", secretItem.Name, err.Error())
+			}
+			if err := database.InsertHomescriptSecret(database.HomescriptSecret{
+				Owner:       usr.Data.Username,
+				Name:        secretItem.Name,
+				Description: secretItem.Description,
+				Shared:      secretItem.Shared,
+				CreatedAt:   time.Now(),
+				Ciphertext:  ciphertext,
+			}); err != nil {
+				return err
+			}
+		}
+
 		// Setup the user's reminders
 		for _, rem := range usr.Reminders {
 			if _, err := database.CreateNewReminder(
@@ -457,6 +497,13 @@ func createSystemConfigInDatabase(systemConfig database.ServerConfig) error {
 	if systemConfig.Longitude < -180 || systemConfig.Longitude > 180 {
 		return fmt.Errorf("invalid longitude: must be (> -180 and < 180)")
 	}
+	// Setup files of older versions do not contain the embedded MQTT broker
+	if systemConfig.Mqtt.Broker.Port == 0 {
+		systemConfig.Mqtt.Broker.Port = 1883
+	}
+	if systemConfig.Mqtt.Broker.Address == "" {
+		systemConfig.Mqtt.Broker.Address = mqttbroker.DefaultAddress
+	}
 	if err := database.SetServerConfiguration(systemConfig); err != nil {
 		log.Error("Could not create system configuration from setup file: ", err.Error())
 		return err
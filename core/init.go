@@ -13,6 +13,8 @@ import (
 	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
 	"github.com/smarthome-go/smarthome/core/scheduler"
 	"github.com/smarthome-go/smarthome/core/user/notify"
+	"github.com/smarthome-go/smarthome/services/homeassistant"
+	"github.com/smarthome-go/smarthome/services/mqttbridge"
 	"github.com/smarthome-go/smarthome/services/reminder"
 )
 
@@ -77,6 +79,11 @@ func Init(config database.ServerConfig) error {
 
 	dispatcher.InitModule()
 
+	// The embedded MQTT broker must be started before the MQTT manager connects to it
+	if err := applyEmbeddedBrokerConfig(config.Mqtt); err != nil {
+		log.Errorf("Embedded MQTT broker initialization failed: %s", err.Error())
+	}
+
 	// Mqtt manager initialization
 	mqttManager, err := dispatcher.NewMqttManager(config.Mqtt, OnMqttRetryHook)
 	if err != nil {
@@ -89,6 +96,11 @@ func Init(config database.ServerConfig) error {
 		log.Errorf("Failed to initialize HMS dispatcher: %s", err.Error())
 	}
 
+	// Named brokers connect in the background, therefore, an unreachable broker does not delay startup
+	if err := disp.ApplyMqttBrokers(config.Mqtt); err != nil {
+		log.Errorf("Failed to initialize named MQTT brokers: %s", err.Error())
+	}
+
 	dispatcherInitialized.lock.Lock()
 	dispatcherInitialized.value = true
 	dispatcherInitialized.lock.Unlock()
@@ -120,6 +132,10 @@ func Init(config database.ServerConfig) error {
 		return fmt.Errorf("Failed to start periodic power usage snapshot scheduler: %s", err.Error())
 	}
 
+	if err := homescript.StartRunHistoryPruner(); err != nil {
+		return fmt.Errorf("Failed to start Homescript execution history pruner: %s", err.Error())
+	}
+
 	//
 	// Devices.
 	//
@@ -136,6 +152,22 @@ func Init(config database.ServerConfig) error {
 		log.Errorf("Failed to initialize all user programs, using best effort attempt: %s", err.Error())
 	}
 
+	//
+	// Home Assistant exporter
+	//
+
+	if err := homeassistant.Init(); err != nil {
+		log.Errorf("Failed to start Home Assistant exporter: %s", err.Error())
+	}
+
+	//
+	// MQTT state bridge
+	//
+
+	if err := mqttbridge.Init(); err != nil {
+		log.Errorf("Failed to start MQTT bridge: %s", err.Error())
+	}
+
 	//
 	// END Devices.
 	//
@@ -158,6 +190,11 @@ func Reload() error {
 		return errors.New(msg)
 	}
 
+	if err := applyEmbeddedBrokerConfig(config.Mqtt); err != nil {
+		log.Warnf("Could not fully reload core: embedded MQTT broker error: %s", err.Error())
+		hasErr = err
+	}
+
 	// Reload dispatcher (and MQTT subsystem)
 	if err := dispatcher.Instance.Reload(config.Mqtt); err != nil {
 		log.Warnf("Could not fully reload core: dispatcher reload error: %s", err.Error())
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/mqttbroker"
+	"github.com/smarthome-go/smarthome/core/user"
+	"github.com/smarthome-go/smarthome/services/homeassistant"
+	"github.com/smarthome-go/smarthome/services/mqttbridge"
+	"github.com/smarthome-go/smarthome/services/mqttdevices"
+)
+
+// Every message is authorized individually, therefore, permission checks are cached for a short time
+const brokerPermissionCacheTTL = 10 * time.Second
+
+var embeddedBroker = struct {
+	lock   sync.Mutex
+	broker *mqttbroker.Broker
+	// The config the running broker was started with
+	config database.MqttBrokerConfig
+}{
+	lock:   sync.Mutex{},
+	broker: nil,
+	config: database.MqttBrokerConfig{},
+}
+
+type brokerPermissionKey struct {
+	username string
+	deviceID string
+}
+
+type brokerPermission struct {
+	allowed bool
+	expires time.Time
+}
+
+// Implements `mqttbroker.Authenticator` for the users of the server
+type brokerAccessControl struct {
+	lock        sync.Mutex
+	permissions map[brokerPermissionKey]brokerPermission
+}
+
+func newBrokerAccessControl() *brokerAccessControl {
+	return &brokerAccessControl{
+		lock:        sync.Mutex{},
+		permissions: make(map[brokerPermissionKey]brokerPermission),
+	}
+}
+
+// Users may connect to the embedded broker using either their password or one of their API tokens
+// In both cases, the user requires the `mqttBroker` permission
+func (a *brokerAccessControl) Authenticate(username string, password string) (bool, error) {
+	hasPermission, err := database.UserHasPermission(username, database.PermissionMqttBroker)
+	if err != nil {
+		return false, err
+	}
+	if !hasPermission {
+		log.Debugf("Embedded MQTT broker denied user `%s`: missing permission", username)
+		return false, nil
+	}
+
+	validCredentials, err := user.ValidateCredentials(username, password)
+	if err != nil {
+		return false, err
+	}
+	if validCredentials {
+		return true, nil
+	}
+
+	token, found, err := database.GetUserTokenByToken(password)
+	if err != nil {
+		return false, err
+	}
+	return found && token.User == username, nil
+}
+
+// The topics of the MQTT bridge and of the Home Assistant exporter are reserved for the server:
+// topics which refer to a device may only be used by users who may control this device,
+// the remaining reserved topics (for instance, the availability of the exporter) may only be read
+// All other topics may be used freely as the broker also serves devices which communicate via MQTT
+func (a *brokerAccessControl) Authorize(username string, access mqttbroker.Access, topic string) (bool, error) {
+	deviceID, reserved := mqttbridge.DeviceOfTopic(topic)
+	if !reserved {
+		deviceID, reserved = homeassistant.DeviceOfTopic(topic)
+	}
+
+	if !reserved {
+		return true, nil
+	}
+
+	if deviceID == "" {
+		return access == mqttbroker.AccessRead, nil
+	}
+
+	return a.mayControl(username, deviceID)
+}
+
+func (a *brokerAccessControl) mayControl(username string, deviceID string) (bool, error) {
+	key := brokerPermissionKey{username: username, deviceID: deviceID}
+
+	a.lock.Lock()
+	cached, found := a.permissions[key]
+	a.lock.Unlock()
+
+	if found && time.Now().Before(cached.expires) {
+		return cached.allowed, nil
+	}
+
+	allowed, err := mqttdevices.MayControl(username, deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	a.lock.Lock()
+	a.permissions[key] = brokerPermission{allowed: allowed, expires: time.Now().Add(brokerPermissionCacheTTL)}
+	a.lock.Unlock()
+
+	return allowed, nil
+}
+
+// Starts, restarts or stops the embedded broker so that it matches the given config
+// The broker is only restarted if its listener settings changed so that connected clients are kept otherwise
+func applyEmbeddedBrokerConfig(config database.MqttConfig) error {
+	embeddedBroker.lock.Lock()
+	defer embeddedBroker.lock.Unlock()
+
+	enabled := config.Enabled && config.Broker.Enabled
+	running := embeddedBroker.broker != nil
+
+	if running && enabled && embeddedBroker.config == config.Broker {
+		return nil
+	}
+
+	if running {
+		embeddedBroker.broker.Stop()
+		embeddedBroker.broker = nil
+	}
+
+	if !enabled {
+		return nil
+	}
+
+	brokerConfig := mqttbroker.Config{
+		Address: config.Broker.Address,
+		Port:    config.Broker.Port,
+		TLS:     nil,
+	}
+
+	if config.Broker.TLSCertificate != "" {
+		tlsConfig, err := mqttbroker.ServerTLSConfig(config.Broker.TLSCertificate, config.Broker.TLSKey)
+		if err != nil {
+			log.Errorf("Could not start embedded MQTT broker: %s", err.Error())
+			return err
+		}
+		brokerConfig.TLS = tlsConfig
+	}
+
+	broker, err := mqttbroker.Start(brokerConfig, newBrokerAccessControl())
+	if err != nil {
+		log.Errorf("Could not start embedded MQTT broker: %s", err.Error())
+		return err
+	}
+
+	embeddedBroker.broker = broker
+	embeddedBroker.config = config.Broker
+	return nil
+}
+
+// Returns the clients which are connected to the embedded broker
+// If the embedded broker is not running, `running` is false
+func EmbeddedBrokerClients() (clients []mqttbroker.ClientInfo, running bool) {
+	embeddedBroker.lock.Lock()
+	defer embeddedBroker.lock.Unlock()
+
+	if embeddedBroker.broker == nil {
+		return nil, false
+	}
+
+	return embeddedBroker.broker.Clients(), true
+}
+
+func shutdownEmbeddedBroker() {
+	embeddedBroker.lock.Lock()
+	defer embeddedBroker.lock.Unlock()
+
+	if embeddedBroker.broker != nil {
+		embeddedBroker.broker.Stop()
+		embeddedBroker.broker = nil
+	}
+}
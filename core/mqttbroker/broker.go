@@ -0,0 +1,435 @@
+package mqttbroker
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//
+// Embedded MQTT broker.
+// Implements MQTT 3.1.1 for small installations which do not want to operate an external broker.
+// Sessions are never persisted: every connection starts with a clean session and subscriptions are granted with at most QoS 1.
+// Retained messages are kept in memory and are lost when the broker is stopped.
+// Every publish and every delivery to a client other than the internal one is checked by `Authenticator.Authorize`.
+//
+
+var log *logrus.Logger
+
+func InitLogger(logger *logrus.Logger) {
+	log = logger
+}
+
+// The username which is used by the server itself, see `InternalPassword`.
+const InternalUsername = "smarthome-internal"
+
+// The time a client has to send its CONNECT packet after the connection was opened.
+const connectTimeout = 10 * time.Second
+
+var (
+	internalPassword     string
+	internalPasswordOnce sync.Once
+)
+
+// Returns the password of the internal user, it is generated randomly on every start of the server.
+func InternalPassword() string {
+	internalPasswordOnce.Do(func() {
+		internalPassword = randomHex(32)
+	})
+	return internalPassword
+}
+
+func randomHex(bytes int) string {
+	seed := make([]byte, bytes)
+	if _, err := rand.Read(seed); err != nil {
+		panic(fmt.Sprintf("Could not generate random bytes: %s", err.Error()))
+	}
+	return hex.EncodeToString(seed)
+}
+
+// The address the broker listens on if none is configured, the broker is then only reachable locally.
+const DefaultAddress = "127.0.0.1"
+
+type Access uint8
+
+const (
+	// The client publishes a message to the topic.
+	AccessPublish Access = iota
+	// A message of the topic is delivered to the client.
+	AccessRead
+)
+
+// Decides which clients may connect and which topics they may use.
+// The internal user is handled by the broker itself and bypasses both checks.
+type Authenticator interface {
+	// Validates the credentials of a connecting client.
+	Authenticate(username string, password string) (valid bool, err error)
+	// Is called for every message a client publishes and for every message which would be delivered to a client.
+	Authorize(username string, access Access, topic string) (allowed bool, err error)
+}
+
+type Config struct {
+	// Defaults to `DefaultAddress` if empty.
+	Address string
+	// If 0, a random port is chosen, see `Port`.
+	Port uint16
+	// If set, clients have to connect using TLS.
+	TLS *tls.Config
+}
+
+type ClientInfo struct {
+	ClientID      string    `json:"clientId"`
+	Username      string    `json:"username"`
+	RemoteAddress string    `json:"remoteAddress"`
+	ConnectedAt   time.Time `json:"connectedAt"`
+	Subscriptions []string  `json:"subscriptions"`
+	// Is true for the connection of the server itself.
+	Internal bool `json:"internal"`
+}
+
+type Broker struct {
+	authenticator Authenticator
+	listener      net.Listener
+
+	// Protects `conns`, `clients`, `retained` and the subscriptions of every client.
+	lock sync.RWMutex
+	// Also contains connections which have not sent their CONNECT packet yet.
+	conns    map[net.Conn]struct{}
+	clients  map[string]*client
+	retained map[string]message
+	stopped  bool
+
+	connections sync.WaitGroup
+}
+
+// Starts a broker which listens on the configured address and port.
+func Start(config Config, authenticator Authenticator) (*Broker, error) {
+	address := config.Address
+	if address == "" {
+		address = DefaultAddress
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(int(config.Port))))
+	if err != nil {
+		return nil, err
+	}
+
+	if config.TLS != nil {
+		listener = tls.NewListener(listener, config.TLS)
+	}
+
+	broker := &Broker{
+		authenticator: authenticator,
+		listener:      listener,
+		lock:          sync.RWMutex{},
+		conns:         make(map[net.Conn]struct{}),
+		clients:       make(map[string]*client),
+		retained:      make(map[string]message),
+		stopped:       false,
+		connections:   sync.WaitGroup{},
+	}
+
+	go broker.accept()
+
+	log.Infof("Embedded MQTT broker listening on %s (TLS: %t)", listener.Addr(), config.TLS != nil)
+	return broker, nil
+}
+
+// Builds the TLS config of the broker from a PEM encoded certificate and its key.
+func ServerTLSConfig(certificate string, key string) (*tls.Config, error) {
+	pair, err := tls.X509KeyPair([]byte(certificate), []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate or key: %s", err.Error())
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{pair},
+	}, nil
+}
+
+// Returns the port the broker is listening on.
+func (b *Broker) Port() uint16 {
+	return uint16(b.listener.Addr().(*net.TCPAddr).Port)
+}
+
+// Disconnects all clients and stops listening.
+func (b *Broker) Stop() {
+	if err := b.listener.Close(); err != nil {
+		log.Debugf("Could not close listener of embedded MQTT broker: %s", err.Error())
+	}
+
+	b.lock.Lock()
+	b.stopped = true
+	for conn := range b.conns {
+		_ = conn.Close()
+	}
+	b.lock.Unlock()
+
+	b.connections.Wait()
+	log.Info("Stopped embedded MQTT broker")
+}
+
+// Lists all connected clients, sorted by their client ID.
+func (b *Broker) Clients() []ClientInfo {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	clients := make([]ClientInfo, 0, len(b.clients))
+	for _, c := range b.clients {
+		subscriptions := make([]string, 0, len(c.subscriptions))
+		for filter := range c.subscriptions {
+			subscriptions = append(subscriptions, filter)
+		}
+		sort.Strings(subscriptions)
+
+		clients = append(clients, ClientInfo{
+			ClientID:      c.id,
+			Username:      c.username,
+			RemoteAddress: c.conn.RemoteAddr().String(),
+			ConnectedAt:   c.connectedAt,
+			Subscriptions: subscriptions,
+			Internal:      c.internal,
+		})
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ClientID < clients[j].ClientID
+	})
+
+	return clients
+}
+
+func (b *Broker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Warnf("Embedded MQTT broker could not accept connection: %s", err.Error())
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		b.lock.Lock()
+		if b.stopped {
+			b.lock.Unlock()
+			_ = conn.Close()
+			return
+		}
+		b.conns[conn] = struct{}{}
+		b.connections.Add(1)
+		b.lock.Unlock()
+
+		go func() {
+			defer b.connections.Done()
+			defer b.forget(conn)
+			b.serve(conn)
+		}()
+	}
+}
+
+func (b *Broker) forget(conn net.Conn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.conns, conn)
+}
+
+// Validates the credentials of a client, the internal user is handled by the broker itself.
+func (b *Broker) authenticateClient(connect connectPacket) (user string, internal bool, returnCode byte) {
+	if !connect.hasPassword {
+		return "", false, connackBadCredentials
+	}
+
+	if connect.username == InternalUsername {
+		if connect.password != InternalPassword() {
+			return "", false, connackBadCredentials
+		}
+		return InternalUsername, true, connackAccepted
+	}
+
+	valid, err := b.authenticator.Authenticate(connect.username, connect.password)
+	if err != nil {
+		log.Errorf("Embedded MQTT broker could not authenticate client `%s`: %s", connect.clientID, err.Error())
+		return "", false, connackServerUnavailable
+	}
+
+	if !valid {
+		return "", false, connackNotAuthorized
+	}
+
+	return connect.username, false, connackAccepted
+}
+
+// Registers a client, an existing client with the same client ID is disconnected.
+func (b *Broker) register(c *client) bool {
+	b.lock.Lock()
+	if b.stopped {
+		b.lock.Unlock()
+		return false
+	}
+
+	previous := b.clients[c.id]
+	b.clients[c.id] = c
+	b.lock.Unlock()
+
+	if previous != nil {
+		log.Debugf("Embedded MQTT broker disconnected client `%s`: client ID was taken over", c.id)
+		previous.close()
+	}
+
+	return true
+}
+
+func (b *Broker) unregister(c *client) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// The client might have been replaced by a new connection using the same client ID.
+	if b.clients[c.id] == c {
+		delete(b.clients, c.id)
+	}
+}
+
+// Reports whether a client may publish to or receive messages of a topic, failures are treated as a denial.
+func (b *Broker) authorize(c *client, access Access, topic string) bool {
+	if c.internal {
+		return true
+	}
+
+	allowed, err := b.authenticator.Authorize(c.username, access, topic)
+	if err != nil {
+		log.Errorf("Embedded MQTT broker could not authorize client `%s` for topic `%s`: %s", c.id, topic, err.Error())
+		return false
+	}
+
+	return allowed
+}
+
+// Forwards a message which was published by a client unless the client may not publish to its topic.
+// Denied messages are dropped silently as MQTT 3.1.1 cannot report them to the publisher.
+func (b *Broker) publishFrom(c *client, msg message) {
+	if !b.authorize(c, AccessPublish, msg.topic) {
+		log.Debugf("Embedded MQTT broker dropped message of client `%s` to `%s`: access denied", c.id, msg.topic)
+		return
+	}
+
+	b.publish(msg)
+}
+
+// Forwards a message to every client with a matching subscription and stores retained messages.
+func (b *Broker) publish(msg message) {
+	b.lock.Lock()
+	if msg.retain {
+		// An empty retained message deletes the retained message of the topic.
+		if len(msg.payload) == 0 {
+			delete(b.retained, msg.topic)
+		} else {
+			b.retained[msg.topic] = msg
+		}
+	}
+
+	type delivery struct {
+		client *client
+		qos    byte
+	}
+
+	deliveries := make([]delivery, 0)
+	for _, c := range b.clients {
+		// Overlapping subscriptions result in a single delivery using the highest granted QoS.
+		granted, matched := byte(0), false
+		for filter, qos := range c.subscriptions {
+			if matchTopic(filter, msg.topic) {
+				matched = true
+				granted = max(granted, qos)
+			}
+		}
+
+		if matched {
+			deliveries = append(deliveries, delivery{client: c, qos: min(granted, msg.qos)})
+		}
+	}
+	b.lock.Unlock()
+
+	// Authorization might query the database, therefore, it is done outside of the lock.
+	for _, item := range deliveries {
+		if !b.authorize(item.client, AccessRead, msg.topic) {
+			continue
+		}
+
+		item.client.deliver(message{
+			topic:   msg.topic,
+			payload: msg.payload,
+			qos:     item.qos,
+			retain:  false,
+		})
+	}
+}
+
+// Adds subscriptions to a client and returns the retained messages which match any of the new filters.
+// Filters without wildcards are rejected if the client may not read their topic.
+// Wildcard filters are accepted, messages of topics which the client may not read are never delivered though.
+func (b *Broker) subscribe(c *client, subscriptions []subscription) (returnCodes []byte, retained []message) {
+	accepted := make([]bool, len(subscriptions))
+	for idx, sub := range subscriptions {
+		accepted[idx] = validTopicFilter(sub.filter) && sub.qos <= 2 &&
+			(hasWildcard(sub.filter) || b.authorize(c, AccessRead, sub.filter))
+	}
+
+	b.lock.Lock()
+
+	returnCodes = make([]byte, 0, len(subscriptions))
+	candidates := make([]message, 0)
+
+	for idx, sub := range subscriptions {
+		if !accepted[idx] {
+			returnCodes = append(returnCodes, subackFailure)
+			continue
+		}
+
+		granted := min(sub.qos, 1)
+		c.subscriptions[sub.filter] = granted
+		returnCodes = append(returnCodes, granted)
+
+		for topic, msg := range b.retained {
+			if matchTopic(sub.filter, topic) {
+				candidates = append(candidates, message{
+					topic:   msg.topic,
+					payload: msg.payload,
+					qos:     min(granted, msg.qos),
+					retain:  true,
+				})
+			}
+		}
+	}
+
+	b.lock.Unlock()
+
+	retained = make([]message, 0, len(candidates))
+	for _, msg := range candidates {
+		if b.authorize(c, AccessRead, msg.topic) {
+			retained = append(retained, msg)
+		}
+	}
+
+	return returnCodes, retained
+}
+
+func (b *Broker) unsubscribe(c *client, filters []string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, filter := range filters {
+		delete(c.subscriptions, filter)
+	}
+}
@@ -0,0 +1,332 @@
+package mqttbroker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTimeout = 5 * time.Second
+
+func TestMain(m *testing.M) {
+	log = logrus.New()
+	log.Level = logrus.DebugLevel
+	os.Exit(m.Run())
+}
+
+type testAuthenticator struct{}
+
+// Accepts the user `alice` with the password `secret` and the user `bob` with the token `token`.
+func (testAuthenticator) Authenticate(username string, password string) (bool, error) {
+	return (username == "alice" && password == "secret") || (username == "bob" && password == "token"), nil
+}
+
+// Topics below `private/` may only be used by the user they are named after, all other topics are public.
+func (testAuthenticator) Authorize(username string, _ Access, topic string) (bool, error) {
+	owner, private := strings.CutPrefix(topic, "private/")
+	return !private || owner == username, nil
+}
+
+func startTestBroker(t *testing.T) *Broker {
+	broker, err := Start(Config{Address: "", Port: 0, TLS: nil}, testAuthenticator{})
+	assert.NoError(t, err)
+	t.Cleanup(broker.Stop)
+	return broker
+}
+
+func testClientOptions(broker *Broker, clientID string, username string, password string) *mqtt.ClientOptions {
+	return testClientOptionsURI(fmt.Sprintf("tcp://127.0.0.1:%d", broker.Port()), clientID, username, password)
+}
+
+func testClientOptionsURI(uri string, clientID string, username string, password string) *mqtt.ClientOptions {
+	return mqtt.NewClientOptions().
+		AddBroker(uri).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(false).
+		SetConnectTimeout(testTimeout)
+}
+
+func connectTestClient(t *testing.T, opts *mqtt.ClientOptions) mqtt.Client {
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	assert.True(t, token.WaitTimeout(testTimeout))
+	assert.NoError(t, token.Error())
+	t.Cleanup(func() { client.Disconnect(0) })
+	return client
+}
+
+func subscribeTestClient(t *testing.T, client mqtt.Client, filter string) chan mqtt.Message {
+	messages := make(chan mqtt.Message, 16)
+	token := client.Subscribe(filter, 2, func(_ mqtt.Client, msg mqtt.Message) {
+		messages <- msg
+	})
+	assert.True(t, token.WaitTimeout(testTimeout))
+	assert.NoError(t, token.Error())
+	return messages
+}
+
+func publishTestClient(t *testing.T, client mqtt.Client, topic string, qos byte, retained bool, payload string) {
+	token := client.Publish(topic, qos, retained, payload)
+	assert.True(t, token.WaitTimeout(testTimeout))
+	assert.NoError(t, token.Error())
+}
+
+func receive(t *testing.T, messages chan mqtt.Message) mqtt.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for message")
+		return nil
+	}
+}
+
+func assertNoMessage(t *testing.T, messages chan mqtt.Message) {
+	select {
+	case msg := <-messages:
+		t.Errorf("Unexpected message on `%s`: %s", msg.Topic(), msg.Payload())
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	broker := startTestBroker(t)
+
+	table := []struct {
+		Username string
+		Password string
+		Valid    bool
+	}{
+		{Username: "alice", Password: "secret", Valid: true},
+		{Username: "bob", Password: "token", Valid: true},
+		{Username: InternalUsername, Password: InternalPassword(), Valid: true},
+		{Username: "alice", Password: "wrong", Valid: false},
+		{Username: InternalUsername, Password: "secret", Valid: false},
+		{Username: "alice", Password: "", Valid: false},
+	}
+
+	for idx, test := range table {
+		client := mqtt.NewClient(testClientOptions(broker, fmt.Sprintf("auth-%d", idx), test.Username, test.Password))
+		token := client.Connect()
+		assert.True(t, token.WaitTimeout(testTimeout))
+
+		if test.Valid {
+			assert.NoError(t, token.Error(), test.Username)
+			client.Disconnect(0)
+		} else {
+			assert.Error(t, token.Error(), test.Username)
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	broker := startTestBroker(t)
+
+	subscriber := connectTestClient(t, testClientOptions(broker, "subscriber", "alice", "secret"))
+	publisher := connectTestClient(t, testClientOptions(broker, "publisher", "bob", "token"))
+
+	messages := subscribeTestClient(t, subscriber, "smarthome/device/+/set")
+
+	for qos := byte(0); qos <= 2; qos++ {
+		publishTestClient(t, publisher, "smarthome/device/lamp/set", qos, false, fmt.Sprintf("qos %d", qos))
+
+		msg := receive(t, messages)
+		assert.Equal(t, "smarthome/device/lamp/set", msg.Topic())
+		assert.Equal(t, fmt.Sprintf("qos %d", qos), string(msg.Payload()))
+		assert.Equal(t, min(qos, 1), msg.Qos())
+		assert.False(t, msg.Retained())
+	}
+
+	publishTestClient(t, publisher, "smarthome/device/lamp/state", 0, false, "ignored")
+	assertNoMessage(t, messages)
+
+	token := subscriber.Unsubscribe("smarthome/device/+/set")
+	assert.True(t, token.WaitTimeout(testTimeout))
+	publishTestClient(t, publisher, "smarthome/device/lamp/set", 0, false, "ignored")
+	assertNoMessage(t, messages)
+}
+
+func TestRetainedMessages(t *testing.T) {
+	broker := startTestBroker(t)
+
+	publisher := connectTestClient(t, testClientOptions(broker, "publisher", "alice", "secret"))
+	publishTestClient(t, publisher, "smarthome/device/lamp/state", 1, true, `{"power":true}`)
+	publishTestClient(t, publisher, "smarthome/device/fan/state", 1, true, `{"power":false}`)
+
+	subscriber := connectTestClient(t, testClientOptions(broker, "subscriber", "alice", "secret"))
+	messages := subscribeTestClient(t, subscriber, "smarthome/device/lamp/#")
+
+	msg := receive(t, messages)
+	assert.Equal(t, "smarthome/device/lamp/state", msg.Topic())
+	assert.Equal(t, `{"power":true}`, string(msg.Payload()))
+	assert.True(t, msg.Retained())
+	assertNoMessage(t, messages)
+
+	// An empty retained message deletes the retained message.
+	publishTestClient(t, publisher, "smarthome/device/lamp/state", 1, true, "")
+	assert.Empty(t, receive(t, messages).Payload())
+
+	late := connectTestClient(t, testClientOptions(broker, "late", "alice", "secret"))
+	assertNoMessage(t, subscribeTestClient(t, late, "smarthome/device/lamp/#"))
+}
+
+func TestWillMessage(t *testing.T) {
+	broker := startTestBroker(t)
+
+	subscriber := connectTestClient(t, testClientOptions(broker, "subscriber", "alice", "secret"))
+	messages := subscribeTestClient(t, subscriber, "clients/+/status")
+
+	// A graceful disconnect does not publish the will.
+	graceful := connectTestClient(t, testClientOptions(broker, "graceful", "alice", "secret").
+		SetWill("clients/graceful/status", "offline", 0, false))
+	graceful.Disconnect(250)
+	assertNoMessage(t, messages)
+
+	connectTestClient(t, testClientOptions(broker, "crashing", "alice", "secret").
+		SetWill("clients/crashing/status", "offline", 0, false))
+
+	// Simulate a crash by closing the connection on the broker side.
+	broker.lock.RLock()
+	crashing := broker.clients["crashing"]
+	broker.lock.RUnlock()
+	_ = crashing.conn.Close()
+
+	msg := receive(t, messages)
+	assert.Equal(t, "clients/crashing/status", msg.Topic())
+	assert.Equal(t, "offline", string(msg.Payload()))
+}
+
+func TestClients(t *testing.T) {
+	broker := startTestBroker(t)
+
+	internal := connectTestClient(t, testClientOptions(broker, "homescript-smarthome", InternalUsername, InternalPassword()))
+	subscribeTestClient(t, internal, "smarthome/#")
+	connectTestClient(t, testClientOptions(broker, "dashboard", "bob", "token"))
+
+	clients := broker.Clients()
+	assert.Len(t, clients, 2)
+
+	assert.Equal(t, "dashboard", clients[0].ClientID)
+	assert.Equal(t, "bob", clients[0].Username)
+	assert.False(t, clients[0].Internal)
+	assert.Empty(t, clients[0].Subscriptions)
+
+	assert.Equal(t, "homescript-smarthome", clients[1].ClientID)
+	assert.True(t, clients[1].Internal)
+	assert.Equal(t, []string{"smarthome/#"}, clients[1].Subscriptions)
+
+	// A new connection using the same client ID replaces the existing one.
+	connectTestClient(t, testClientOptions(broker, "dashboard", "alice", "secret"))
+
+	assert.Eventually(t, func() bool {
+		clients := broker.Clients()
+		return len(clients) == 2 && clients[0].Username == "alice"
+	}, testTimeout, 10*time.Millisecond)
+}
+
+func TestAuthorization(t *testing.T) {
+	broker := startTestBroker(t)
+
+	alice := connectTestClient(t, testClientOptions(broker, "alice", "alice", "secret"))
+	bob := connectTestClient(t, testClientOptions(broker, "bob", "bob", "token"))
+	internal := connectTestClient(t, testClientOptions(broker, "internal", InternalUsername, InternalPassword()))
+
+	aliceMessages := subscribeTestClient(t, alice, "#")
+	internalMessages := subscribeTestClient(t, internal, "private/#")
+
+	// Alice may not read the private topic of Bob although her wildcard filter matches it.
+	publishTestClient(t, bob, "private/bob", 1, true, "bob only")
+	msg := receive(t, internalMessages)
+	assert.Equal(t, "private/bob", msg.Topic())
+
+	// The message of Bob to the private topic of Alice is dropped.
+	publishTestClient(t, bob, "private/alice", 1, false, "denied")
+	assertNoMessage(t, internalMessages)
+
+	publishTestClient(t, bob, "public", 1, false, "everyone")
+	msg = receive(t, aliceMessages)
+	assert.Equal(t, "public", msg.Topic())
+	assertNoMessage(t, aliceMessages)
+
+	// Subscribing to a topic which may not be read fails, retained messages of denied topics are never delivered.
+	token := alice.Subscribe("private/bob", 1, nil)
+	assert.True(t, token.WaitTimeout(testTimeout))
+	assert.Equal(t, byte(subackFailure), token.(*mqtt.SubscribeToken).Result()["private/bob"])
+
+	late := connectTestClient(t, testClientOptions(broker, "late", "alice", "secret"))
+	assertNoMessage(t, subscribeTestClient(t, late, "private/+"))
+
+	// The internal client bypasses the authorization.
+	publishTestClient(t, internal, "private/alice", 1, false, "internal")
+	assert.Equal(t, "internal", string(receive(t, aliceMessages).Payload()))
+}
+
+// Returns a PEM encoded, self-signed certificate and its key.
+func selfSignedCertificate(t *testing.T) (certificate string, key string) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	assert.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+}
+
+func TestTLS(t *testing.T) {
+	certificate, key := selfSignedCertificate(t)
+	_, otherKey := selfSignedCertificate(t)
+
+	_, err := ServerTLSConfig(certificate, otherKey)
+	assert.Error(t, err)
+
+	tlsConfig, err := ServerTLSConfig(certificate, key)
+	assert.NoError(t, err)
+
+	broker, err := Start(Config{Address: "127.0.0.1", Port: 0, TLS: tlsConfig}, testAuthenticator{})
+	assert.NoError(t, err)
+	t.Cleanup(broker.Stop)
+
+	// Plaintext clients cannot connect.
+	plaintext := mqtt.NewClient(testClientOptions(broker, "plaintext", "alice", "secret").SetConnectTimeout(time.Second))
+	token := plaintext.Connect()
+	assert.True(t, token.WaitTimeout(testTimeout))
+	assert.Error(t, token.Error())
+
+	pool := x509.NewCertPool()
+	assert.True(t, pool.AppendCertsFromPEM([]byte(certificate)))
+
+	client := connectTestClient(t, testClientOptionsURI(fmt.Sprintf("ssl://localhost:%d", broker.Port()), "secure", "alice", "secret").
+		SetTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}))
+
+	messages := subscribeTestClient(t, client, "secure")
+	publishTestClient(t, client, "secure", 1, false, "encrypted")
+	assert.Equal(t, "encrypted", string(receive(t, messages).Payload()))
+}
@@ -0,0 +1,236 @@
+package mqttbroker
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// If a client does not read fast enough, further messages to it are dropped.
+const outgoingQueueSize = 256
+
+type client struct {
+	broker *Broker
+	conn   net.Conn
+
+	id          string
+	username    string
+	internal    bool
+	connectedAt time.Time
+
+	// Maps every subscribed filter to its granted QoS, is protected by the lock of the broker.
+	subscriptions map[string]byte
+
+	outgoing  chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	packetIDLock sync.Mutex
+	nextPacketID uint16
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		_ = c.conn.Close()
+	})
+}
+
+// Queues an encoded packet, it is dropped if the client is too slow or disconnected.
+func (c *client) send(data []byte) {
+	select {
+	case c.outgoing <- data:
+	case <-c.closed:
+	default:
+		log.Debugf("Embedded MQTT broker dropped packet to slow client `%s`", c.id)
+	}
+}
+
+func (c *client) deliver(msg message) {
+	packetID := uint16(0)
+
+	if msg.qos > 0 {
+		c.packetIDLock.Lock()
+		c.nextPacketID++
+		// Packet ID 0 is not allowed.
+		if c.nextPacketID == 0 {
+			c.nextPacketID = 1
+		}
+		packetID = c.nextPacketID
+		c.packetIDLock.Unlock()
+	}
+
+	c.send(encodePublish(msg, packetID))
+}
+
+func (c *client) writeLoop() {
+	for {
+		select {
+		case data := <-c.outgoing:
+			if _, err := c.conn.Write(data); err != nil {
+				c.close()
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// Handles a connection from the CONNECT packet until it is closed.
+func (b *Broker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	_ = conn.SetReadDeadline(time.Now().Add(connectTimeout))
+	first, err := readPacket(reader)
+	if err != nil || first.kind != packetConnect {
+		return
+	}
+
+	connect, err := parseConnect(first.body)
+	if err != nil {
+		return
+	}
+
+	if connect.protocolName != "MQTT" || connect.protocolLevel != protocolLevel311 {
+		_, _ = conn.Write(encodeConnack(connackBadProtocolVersion))
+		return
+	}
+
+	if connect.clientID == "" {
+		// Clients without an ID cannot resume sessions, an ID is therefore only assigned to clean sessions.
+		if !connect.cleanSession {
+			_, _ = conn.Write(encodeConnack(connackIdentifierRejected))
+			return
+		}
+		connect.clientID = fmt.Sprintf("auto-%s", randomHex(8))
+	}
+
+	user, internal, returnCode := b.authenticateClient(connect)
+	if returnCode != connackAccepted {
+		log.Debugf("Embedded MQTT broker rejected client `%s` from %s (code %d)", connect.clientID, conn.RemoteAddr(), returnCode)
+		_, _ = conn.Write(encodeConnack(returnCode))
+		return
+	}
+
+	c := &client{
+		broker:        b,
+		conn:          conn,
+		id:            connect.clientID,
+		username:      user,
+		internal:      internal,
+		connectedAt:   time.Now(),
+		subscriptions: make(map[string]byte),
+		outgoing:      make(chan []byte, outgoingQueueSize),
+		closed:        make(chan struct{}),
+		closeOnce:     sync.Once{},
+		packetIDLock:  sync.Mutex{},
+		nextPacketID:  0,
+	}
+
+	if !b.register(c) {
+		return
+	}
+	defer b.unregister(c)
+	defer c.close()
+
+	c.send(encodeConnack(connackAccepted))
+	go c.writeLoop()
+
+	log.Debugf("Embedded MQTT broker accepted client `%s` of user `%s` from %s", c.id, c.username, conn.RemoteAddr())
+
+	graceful := c.readLoop(reader, connect.keepAlive)
+
+	// The will is published if the client disconnected without sending a DISCONNECT packet.
+	if !graceful && connect.will != nil {
+		b.publishFrom(c, *connect.will)
+	}
+
+	log.Debugf("Embedded MQTT broker client `%s` disconnected", c.id)
+}
+
+// Processes incoming packets until the connection fails or the client disconnects.
+// Returns whether the client disconnected gracefully.
+func (c *client) readLoop(reader *bufio.Reader, keepAlive uint16) (graceful bool) {
+	// QoS 2 messages are forwarded immediately, their packet IDs are kept until they are released by the client.
+	inflight := make(map[uint16]bool)
+
+	for {
+		if keepAlive > 0 {
+			// The client is disconnected after one and a half keep alive periods without any packet.
+			_ = c.conn.SetReadDeadline(time.Now().Add(time.Duration(keepAlive) * time.Second * 3 / 2))
+		} else {
+			_ = c.conn.SetReadDeadline(time.Time{})
+		}
+
+		received, err := readPacket(reader)
+		if err != nil {
+			return false
+		}
+
+		switch received.kind {
+		case packetPublish:
+			publish, err := parsePublish(received.flags, received.body)
+			if err != nil {
+				log.Debugf("Embedded MQTT broker disconnected client `%s`: %s", c.id, err.Error())
+				return false
+			}
+
+			switch publish.qos {
+			case 0:
+				c.broker.publishFrom(c, publish.message)
+			case 1:
+				c.broker.publishFrom(c, publish.message)
+				c.send(encodeAck(packetPuback, publish.packetID))
+			case 2:
+				// A retransmitted message is only acknowledged again.
+				if !inflight[publish.packetID] {
+					inflight[publish.packetID] = true
+					c.broker.publishFrom(c, publish.message)
+				}
+				c.send(encodeAck(packetPubrec, publish.packetID))
+			}
+		case packetPubrel:
+			packetID, err := parsePacketID(received.body)
+			if err != nil {
+				return false
+			}
+			delete(inflight, packetID)
+			c.send(encodeAck(packetPubcomp, packetID))
+		case packetPuback:
+			// Outgoing messages are not retransmitted, their acknowledgements therefore require no action.
+		case packetSubscribe:
+			packetID, subscriptions, err := parseSubscribe(received.body)
+			if err != nil {
+				return false
+			}
+
+			returnCodes, retained := c.broker.subscribe(c, subscriptions)
+			c.send(encodeSuback(packetID, returnCodes))
+
+			for _, msg := range retained {
+				c.deliver(msg)
+			}
+		case packetUnsubscribe:
+			packetID, filters, err := parseUnsubscribe(received.body)
+			if err != nil {
+				return false
+			}
+
+			c.broker.unsubscribe(c, filters)
+			c.send(encodeAck(packetUnsuback, packetID))
+		case packetPingreq:
+			c.send(encodePacket(packetPingresp, 0, nil))
+		case packetDisconnect:
+			return true
+		default:
+			// A second CONNECT or any packet which is only sent by servers is a protocol violation.
+			log.Debugf("Embedded MQTT broker disconnected client `%s`: unexpected packet type %d", c.id, received.kind)
+			return false
+		}
+	}
+}
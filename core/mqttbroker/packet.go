@@ -0,0 +1,392 @@
+package mqttbroker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+//
+// MQTT 3.1.1 wire format.
+// Only the subset which is required by the broker is implemented.
+//
+
+const (
+	packetConnect     byte = 1
+	packetConnack     byte = 2
+	packetPublish     byte = 3
+	packetPuback      byte = 4
+	packetPubrec      byte = 5
+	packetPubrel      byte = 6
+	packetPubcomp     byte = 7
+	packetSubscribe   byte = 8
+	packetSuback      byte = 9
+	packetUnsubscribe byte = 10
+	packetUnsuback    byte = 11
+	packetPingreq     byte = 12
+	packetPingresp    byte = 13
+	packetDisconnect  byte = 14
+)
+
+// Return codes of the CONNACK packet.
+const (
+	connackAccepted           byte = 0
+	connackBadProtocolVersion byte = 1
+	connackIdentifierRejected byte = 2
+	connackServerUnavailable  byte = 3
+	connackBadCredentials     byte = 4
+	connackNotAuthorized      byte = 5
+)
+
+const subackFailure byte = 0x80
+
+const protocolLevel311 byte = 4
+
+// Larger packets are rejected and the client is disconnected.
+const maxPacketSize = 4 * 1024 * 1024
+
+var errMalformedPacket = errors.New("Malformed packet")
+
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	length, err := readRemainingLength(r)
+	if err != nil {
+		return packet{}, err
+	}
+
+	if length > maxPacketSize {
+		return packet{}, fmt.Errorf("Packet exceeds the maximum size of %d bytes", maxPacketSize)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+
+	return packet{kind: header >> 4, flags: header & 0x0F, body: body}, nil
+}
+
+func readRemainingLength(r io.ByteReader) (int, error) {
+	multiplier := 1
+	value := 0
+
+	// The remaining length is encoded using at most four bytes.
+	for i := 0; i < 4; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		value += int(digit&0x7F) * multiplier
+		if digit&0x80 == 0 {
+			return value, nil
+		}
+
+		multiplier *= 128
+	}
+
+	return 0, errMalformedPacket
+}
+
+func encodePacket(kind byte, flags byte, body []byte) []byte {
+	out := make([]byte, 0, len(body)+5)
+	out = append(out, kind<<4|flags)
+
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		out = append(out, digit)
+		if length == 0 {
+			break
+		}
+	}
+
+	return append(out, body...)
+}
+
+func appendUint16(b []byte, value uint16) []byte {
+	return binary.BigEndian.AppendUint16(b, value)
+}
+
+func appendString(b []byte, value string) []byte {
+	b = appendUint16(b, uint16(len(value)))
+	return append(b, value...)
+}
+
+// Decodes the fields of a packet body, the first error is kept and all subsequent reads return zero values.
+type fieldReader struct {
+	data []byte
+	err  error
+}
+
+func (r *fieldReader) byte() byte {
+	if r.err != nil || len(r.data) < 1 {
+		r.err = errMalformedPacket
+		return 0
+	}
+
+	value := r.data[0]
+	r.data = r.data[1:]
+	return value
+}
+
+func (r *fieldReader) uint16() uint16 {
+	if r.err != nil || len(r.data) < 2 {
+		r.err = errMalformedPacket
+		return 0
+	}
+
+	value := binary.BigEndian.Uint16(r.data)
+	r.data = r.data[2:]
+	return value
+}
+
+func (r *fieldReader) binary() []byte {
+	length := int(r.uint16())
+	if r.err != nil || len(r.data) < length {
+		r.err = errMalformedPacket
+		return nil
+	}
+
+	value := r.data[:length]
+	r.data = r.data[length:]
+	return value
+}
+
+func (r *fieldReader) string() string {
+	value := r.binary()
+	if r.err == nil && !utf8.Valid(value) {
+		r.err = errMalformedPacket
+	}
+	return string(value)
+}
+
+func (r *fieldReader) rest() []byte {
+	value := r.data
+	r.data = nil
+	return value
+}
+
+func (r *fieldReader) empty() bool {
+	return len(r.data) == 0
+}
+
+//
+// CONNECT.
+//
+
+type connectPacket struct {
+	protocolName  string
+	protocolLevel byte
+	clientID      string
+	cleanSession  bool
+	keepAlive     uint16
+	will          *message
+	username      string
+	password      string
+	hasPassword   bool
+}
+
+func parseConnect(body []byte) (connectPacket, error) {
+	r := fieldReader{data: body}
+
+	connect := connectPacket{
+		protocolName:  r.string(),
+		protocolLevel: r.byte(),
+	}
+
+	flags := r.byte()
+	connect.keepAlive = r.uint16()
+	connect.clientID = r.string()
+
+	if r.err != nil {
+		return connectPacket{}, r.err
+	}
+
+	// The reserved flag must not be set.
+	if flags&0x01 != 0 {
+		return connectPacket{}, errMalformedPacket
+	}
+
+	connect.cleanSession = flags&0x02 != 0
+
+	if flags&0x04 != 0 {
+		will := message{
+			topic:  r.string(),
+			qos:    (flags >> 3) & 0x03,
+			retain: flags&0x20 != 0,
+		}
+		will.payload = append([]byte(nil), r.binary()...)
+
+		if will.qos > 2 || !validTopicName(will.topic) {
+			return connectPacket{}, errMalformedPacket
+		}
+
+		connect.will = &will
+	}
+
+	if flags&0x80 != 0 {
+		connect.username = r.string()
+	}
+
+	if flags&0x40 != 0 {
+		connect.password = string(r.binary())
+		connect.hasPassword = true
+	}
+
+	if r.err != nil {
+		return connectPacket{}, r.err
+	}
+
+	return connect, nil
+}
+
+func encodeConnack(returnCode byte) []byte {
+	// Sessions are never persisted, the session present flag is therefore never set.
+	return encodePacket(packetConnack, 0, []byte{0, returnCode})
+}
+
+//
+// PUBLISH.
+//
+
+type message struct {
+	topic   string
+	payload []byte
+	qos     byte
+	retain  bool
+}
+
+type publishPacket struct {
+	message
+	packetID uint16
+}
+
+func parsePublish(flags byte, body []byte) (publishPacket, error) {
+	r := fieldReader{data: body}
+
+	publish := publishPacket{
+		message: message{
+			topic:  r.string(),
+			qos:    (flags >> 1) & 0x03,
+			retain: flags&0x01 != 0,
+		},
+	}
+
+	if publish.qos > 2 {
+		return publishPacket{}, errMalformedPacket
+	}
+
+	if publish.qos > 0 {
+		publish.packetID = r.uint16()
+	}
+
+	publish.payload = append([]byte(nil), r.rest()...)
+
+	if r.err != nil {
+		return publishPacket{}, r.err
+	}
+
+	if !validTopicName(publish.topic) {
+		return publishPacket{}, fmt.Errorf("Invalid topic name `%s`", publish.topic)
+	}
+
+	return publish, nil
+}
+
+func encodePublish(msg message, packetID uint16) []byte {
+	flags := msg.qos << 1
+	if msg.retain {
+		flags |= 0x01
+	}
+
+	body := make([]byte, 0, len(msg.topic)+len(msg.payload)+4)
+	body = appendString(body, msg.topic)
+	if msg.qos > 0 {
+		body = appendUint16(body, packetID)
+	}
+	body = append(body, msg.payload...)
+
+	return encodePacket(packetPublish, flags, body)
+}
+
+//
+// Acknowledgements.
+//
+
+func parsePacketID(body []byte) (uint16, error) {
+	r := fieldReader{data: body}
+	packetID := r.uint16()
+	if r.err != nil || !r.empty() {
+		return 0, errMalformedPacket
+	}
+	return packetID, nil
+}
+
+func encodeAck(kind byte, packetID uint16) []byte {
+	return encodePacket(kind, 0, appendUint16(nil, packetID))
+}
+
+//
+// SUBSCRIBE and UNSUBSCRIBE.
+//
+
+type subscription struct {
+	filter string
+	qos    byte
+}
+
+func parseSubscribe(body []byte) (packetID uint16, subscriptions []subscription, err error) {
+	r := fieldReader{data: body}
+	packetID = r.uint16()
+
+	for r.err == nil && !r.empty() {
+		subscriptions = append(subscriptions, subscription{
+			filter: r.string(),
+			qos:    r.byte(),
+		})
+	}
+
+	if r.err != nil || len(subscriptions) == 0 {
+		return 0, nil, errMalformedPacket
+	}
+
+	return packetID, subscriptions, nil
+}
+
+func encodeSuback(packetID uint16, returnCodes []byte) []byte {
+	body := appendUint16(nil, packetID)
+	return encodePacket(packetSuback, 0, append(body, returnCodes...))
+}
+
+func parseUnsubscribe(body []byte) (packetID uint16, filters []string, err error) {
+	r := fieldReader{data: body}
+	packetID = r.uint16()
+
+	for r.err == nil && !r.empty() {
+		filters = append(filters, r.string())
+	}
+
+	if r.err != nil || len(filters) == 0 {
+		return 0, nil, errMalformedPacket
+	}
+
+	return packetID, filters, nil
+}
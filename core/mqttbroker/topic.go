@@ -0,0 +1,62 @@
+package mqttbroker
+
+import "strings"
+
+const maxTopicLength = 65535
+
+// Reports whether the topic can be published to, it must not contain wildcards.
+func validTopicName(topic string) bool {
+	return topic != "" &&
+		len(topic) <= maxTopicLength &&
+		!strings.ContainsAny(topic, "+#\x00")
+}
+
+// Reports whether the filter can be subscribed to.
+// Wildcards must occupy an entire level, the multi-level wildcard must be the last level.
+func validTopicFilter(filter string) bool {
+	if filter == "" || len(filter) > maxTopicLength || strings.ContainsRune(filter, '\x00') {
+		return false
+	}
+
+	levels := strings.Split(filter, "/")
+	for idx, level := range levels {
+		if strings.ContainsAny(level, "+#") && len(level) > 1 {
+			return false
+		}
+		if level == "#" && idx != len(levels)-1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasWildcard(filter string) bool {
+	return strings.ContainsAny(filter, "+#")
+}
+
+// Reports whether a topic name matches a (valid) topic filter.
+func matchTopic(filter string, topic string) bool {
+	// Topics starting with `$` are reserved and not matched by leading wildcards.
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for idx, level := range filterLevels {
+		if level == "#" {
+			// Also matches the parent level, `a/#` matches `a`.
+			return true
+		}
+		if idx >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[idx] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,57 @@
+package mqttbroker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidTopicFilter(t *testing.T) {
+	table := []struct {
+		Filter string
+		Valid  bool
+	}{
+		{Filter: "smarthome/device/+/set", Valid: true},
+		{Filter: "smarthome/#", Valid: true},
+		{Filter: "#", Valid: true},
+		{Filter: "+", Valid: true},
+		{Filter: "/", Valid: true},
+		{Filter: "", Valid: false},
+		{Filter: "smarthome/#/set", Valid: false},
+		{Filter: "smarthome/dev+", Valid: false},
+		{Filter: "smarthome/dev#", Valid: false},
+	}
+
+	for _, test := range table {
+		assert.Equal(t, test.Valid, validTopicFilter(test.Filter), test.Filter)
+	}
+
+	assert.True(t, validTopicName("smarthome/device/lamp/set"))
+	assert.False(t, validTopicName("smarthome/+/set"))
+	assert.False(t, validTopicName(""))
+}
+
+func TestMatchTopic(t *testing.T) {
+	table := []struct {
+		Filter  string
+		Topic   string
+		Matches bool
+	}{
+		{Filter: "a/b", Topic: "a/b", Matches: true},
+		{Filter: "a/b", Topic: "a/b/c", Matches: false},
+		{Filter: "a/+", Topic: "a/b", Matches: true},
+		{Filter: "a/+", Topic: "a/b/c", Matches: false},
+		{Filter: "a/+/c", Topic: "a/b/c", Matches: true},
+		{Filter: "a/#", Topic: "a/b/c", Matches: true},
+		{Filter: "a/#", Topic: "a", Matches: true},
+		{Filter: "#", Topic: "a/b", Matches: true},
+		{Filter: "+/+", Topic: "/b", Matches: true},
+		{Filter: "#", Topic: "$SYS/uptime", Matches: false},
+		{Filter: "+/uptime", Topic: "$SYS/uptime", Matches: false},
+		{Filter: "$SYS/#", Topic: "$SYS/uptime", Matches: true},
+	}
+
+	for _, test := range table {
+		assert.Equal(t, test.Matches, matchTopic(test.Filter, test.Topic), "%s %s", test.Filter, test.Topic)
+	}
+}
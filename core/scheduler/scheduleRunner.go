@@ -75,11 +75,19 @@ func scheduleRunnerFunc(id uint, m *SchedulerManager) {
 		return
 	}
 	log.Debug(fmt.Sprintf("Schedule '%s' (%d) is executing...", job.Data.Name, id))
+
+	// Schedules run in the context of their owner, the schedule ID links the resulting run in the execution history
+	userContext := types.NewExecutionContextUserNoFilename(
+		job.Owner,
+		nil,
+	)
+	userContext.ScheduleID = &id
+
 	switch job.Data.TargetMode {
 	case database.ScheduleTargetModeCode:
 		ctx, cancel := context.WithTimeout(context.Background(), SCHEDULE_MAXIMUM_HOMESCRIPT_RUNTIME)
 
-		filename := fmt.Sprintf("@schedule-%d", id)
+		filename := types.ScheduleFilename(id)
 
 		res, err := m.hms.RunGeneric(
 			types.ProgramInvocation{
@@ -90,10 +98,7 @@ func scheduleRunnerFunc(id uint, m *SchedulerManager) {
 				FunctionInvocation: nil,
 				LoadedSingletons:   map[string]value.Value{},
 			},
-			types.NewExecutionContextUserNoFilename(
-				job.Owner,
-				nil,
-			),
+			userContext,
 			types.Cancelation{
 				Context:    ctx,
 				CancelFunc: cancel,
@@ -144,18 +149,13 @@ func scheduleRunnerFunc(id uint, m *SchedulerManager) {
 	case database.ScheduleTargetModeHMS:
 		ctx, cancel := context.WithTimeout(context.Background(), SCHEDULE_MAXIMUM_HOMESCRIPT_RUNTIME)
 
-		res, err := m.hms.RunUserScript(
+		res, err := m.runScheduleTarget(
 			job.Data.HomescriptTargetId,
-			owner.Username,
-			nil,
+			userContext,
 			types.Cancelation{
 				Context:    ctx,
 				CancelFunc: cancel,
 			},
-			&bytes.Buffer{},
-			nil,
-			nil,
-			make(map[string]string),
 		)
 
 		if err != nil {
@@ -277,3 +277,38 @@ func scheduleRunnerFunc(id uint, m *SchedulerManager) {
 		fmt.Sprintf("Schedule '%s' of user '%s' has been executed successfully", job.Data.Name, job.Owner),
 	)
 }
+
+// Runs the target Homescript of a schedule, unlike `RunUserScript`, this preserves the schedule ID of the context
+func (m *SchedulerManager) runScheduleTarget(
+	homescriptID string,
+	userContext types.ExecutionContextUser,
+	cancelation types.Cancelation,
+) (types.HmsRes, error) {
+	script, found, err := m.hms.GetPersonalScriptById(homescriptID, userContext.UsernameData)
+	if err != nil {
+		return types.HmsRes{}, err
+	}
+	if !found {
+		return types.HmsRes{}, fmt.Errorf("Homescript with ID `%s` owned by user `%s` was not found", homescriptID, userContext.UsernameData)
+	}
+
+	userContext.Filename = script.Data.Id
+	userContext.UserArguments = make(map[string]string)
+
+	return m.hms.RunGeneric(
+		types.ProgramInvocation{
+			Identifier: homescript.InputProgram{
+				ProgramText: script.Data.Code,
+				Filename:    script.Data.Id,
+			},
+			FunctionInvocation: nil,
+			LoadedSingletons:   map[string]value.Value{},
+		},
+		userContext,
+		cancelation,
+		nil,
+		&bytes.Buffer{},
+		true,
+		nil,
+	)
+}
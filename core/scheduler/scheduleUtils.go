@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/smarthome-go/smarthome/core/database"
 	"github.com/smarthome-go/smarthome/core/event"
@@ -37,6 +38,66 @@ func (m SchedulerManager) CreateNewScheduleInternal(
 	return nil
 }
 
+// Creates a job which runs once at the given point in time
+// In contrast to `CreateNewScheduleInternal`, the date is respected: the job does not run earlier if its time of day is reached before
+func (m SchedulerManager) CreateScheduleAtInternal(
+	at time.Time,
+	scheduleTag string,
+	callBack interface{},
+	callbackArgs ...interface{},
+) error {
+	// The interval is irrelevant as the job only runs once at `at`
+	schedulerJob := m.scheduler.Every(1).Day().StartAt(at)
+	schedulerJob.Tag(scheduleTag)
+	schedulerJob.LimitRunsTo(1)
+
+	if _, err := schedulerJob.Do(callBack, callbackArgs...); err != nil {
+		log.Error("Failed to create new schedule: could not register cron job: ", err.Error())
+		return err
+	}
+
+	log.Trace(fmt.Sprintf("Successfully added and setup schedule '%s' at %s", scheduleTag, at.Format(time.RFC3339)))
+	return nil
+}
+
+// Creates a job which runs every day at the given time until it is removed using its tag
+func (m SchedulerManager) CreateRepeatingScheduleInternal(
+	hour, minute uint8,
+	scheduleTag string,
+	callBack interface{},
+	callbackArgs ...interface{},
+) error {
+	schedulerJob := m.scheduler.Every(1).Day().At(fmt.Sprintf("%02d:%02d", hour, minute))
+	schedulerJob.Tag(scheduleTag)
+
+	if _, err := schedulerJob.Do(callBack, callbackArgs...); err != nil {
+		log.Error("Failed to create new repeating schedule: could not register cron job: ", err.Error())
+		return err
+	}
+
+	log.Trace(fmt.Sprintf("Successfully added and setup repeating schedule '%s'", scheduleTag))
+	return nil
+}
+
+// Creates a job which runs according to the given cron expression until it is removed using its tag
+func (m SchedulerManager) CreateCronScheduleInternal(
+	cronExpression string,
+	scheduleTag string,
+	callBack interface{},
+	callbackArgs ...interface{},
+) error {
+	schedulerJob := m.scheduler.Cron(cronExpression)
+	schedulerJob.Tag(scheduleTag)
+
+	if _, err := schedulerJob.Do(callBack, callbackArgs...); err != nil {
+		log.Error("Failed to create new cron schedule: could not register cron job: ", err.Error())
+		return err
+	}
+
+	log.Trace(fmt.Sprintf("Successfully added and setup cron schedule '%s'", scheduleTag))
+	return nil
+}
+
 // Creates and starts a schedule based on the provided input data
 func (m SchedulerManager) CreateNewSchedule(data database.ScheduleData, owner string) (uint, error) {
 	newScheduleID, err := database.CreateNewSchedule(owner, data)
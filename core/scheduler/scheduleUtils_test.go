@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateScheduleAtInternal(t *testing.T) {
+	InitLogger(logrus.New())
+
+	manager := SchedulerManager{scheduler: gocron.NewScheduler(time.Local)}
+	manager.scheduler.TagsUnique()
+	manager.scheduler.StartAsync()
+	defer manager.scheduler.Stop()
+
+	// The job is due tomorrow at a time of day which is still ahead today, it must not run today.
+	at := time.Now().AddDate(0, 0, 1).Add(time.Hour).Truncate(time.Minute)
+	assert.NoError(t, manager.CreateScheduleAtInternal(at, "tomorrow", func() {}))
+
+	jobs, err := manager.scheduler.FindJobsByTag("tomorrow")
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Eventually(t, func() bool {
+		return jobs[0].NextRun().Equal(at)
+	}, time.Second, 10*time.Millisecond)
+
+	// Jobs which are due soon run at their exact time.
+	runs := make(chan struct{}, 2)
+	assert.NoError(t, manager.CreateScheduleAtInternal(time.Now().Add(time.Second), "soon", func() {
+		runs <- struct{}{}
+	}))
+
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The job did not run")
+	}
+
+	assert.NoError(t, manager.RemoveScheduleInternal("tomorrow"))
+}
@@ -14,6 +14,8 @@ import (
 	"github.com/smarthome-go/smarthome/core/homescript"
 	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
 	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/smarthome-go/smarthome/services/homeassistant"
+	"github.com/smarthome-go/smarthome/services/mqttbridge"
 )
 
 type shutdownJobName string
@@ -230,6 +232,8 @@ outer:
 		}
 	}
 
+	dispatcher.Instance.ShutdownMqttBrokers()
+
 	log.Debug("MQTT shutdown complete")
 }
 
@@ -241,9 +245,14 @@ func ShutdownWithConfig(config database.ServerConfig, terminateProcess bool) err
 		return err
 	}
 
+	// Mark all exported entities as unavailable while MQTT is still connected.
+	homeassistant.Shutdown()
+	mqttbridge.Shutdown()
+
 	// Shutdown MQTT keepalive.
 	// BUG: this destroys everything.
 	shutdownMQTT()
+	shutdownEmbeddedBroker()
 
 	// Shutdown automations (it is not safe to do this concurrently with the background HMS jobs)
 	if err := automation.Manager.DeactivateAutomationSystem(config); err != nil {
@@ -21,6 +21,8 @@ type Notification struct {
 	Name        string            `json:"name"`
 	Description string            `json:"description"`
 	Date        uint              `json:"date"` // Unix-Millis are used in this layer.
+	// The camera snapshot attached to this notification, if any.
+	SnapshotID *uint `json:"snapshotId"`
 }
 
 var log *logrus.Logger
@@ -88,14 +90,23 @@ func GetNotifications(username string) ([]Notification, error) {
 	if err != nil {
 		return nil, err
 	}
+	snapshots, err := database.ListNotificationSnapshotIds(username)
+	if err != nil {
+		return nil, err
+	}
 	output := make([]Notification, 0)
 	for _, notification := range fromDB {
+		var snapshotID *uint
+		if id, found := snapshots[notification.Id]; found {
+			snapshotID = &id
+		}
 		output = append(output, Notification{
 			ID:          notification.Id,
 			Priority:    NotificationLevel(notification.Priority),
 			Name:        notification.Name,
 			Description: notification.Description,
 			Date:        uint(notification.Date.UnixMilli()),
+			SnapshotID:  snapshotID,
 		})
 	}
 
@@ -0,0 +1,231 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smarthome-go/smarthome/core/database"
+)
+
+// The length of the AES-256 key in bytes
+const KeyLen = 32
+
+// Is used if no key was specified in the config file or environment
+const DefaultKeyFile = "./data/config/secrets.key"
+
+var log *logrus.Logger
+
+func InitLogger(logger *logrus.Logger) {
+	log = logger
+}
+
+var ErrNotInitialized = errors.New("secret store is not initialized")
+
+var aead = struct {
+	lock  sync.RWMutex
+	value cipher.AEAD
+}{
+	lock:  sync.RWMutex{},
+	value: nil,
+}
+
+// Initializes the secret store with a base64-encoded key
+// If the key is empty, it is read from `keyFile`, which is generated on the first start
+// Losing the key makes every stored secret unreadable
+func Init(encodedKey string, keyFile string) error {
+	if encodedKey == "" {
+		key, err := readOrCreateKeyFile(keyFile)
+		if err != nil {
+			return err
+		}
+		encodedKey = key
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return fmt.Errorf("invalid secrets key: %s", err.Error())
+	}
+	if len(key) != KeyLen {
+		return fmt.Errorf("invalid secrets key: expected %d bytes, got %d", KeyLen, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	aead.lock.Lock()
+	aead.value = gcm
+	aead.lock.Unlock()
+
+	return nil
+}
+
+func readOrCreateKeyFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		return string(content), nil
+	}
+	if !os.IsNotExist(err) {
+		log.Error("Failed to read secrets key file: ", err.Error())
+		return "", err
+	}
+
+	key := make([]byte, KeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Error("Failed to create secrets key file: creating directory failed: ", err.Error())
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(encoded), 0600); err != nil {
+		log.Error("Failed to create secrets key file: ", err.Error())
+		return "", err
+	}
+
+	log.Info(fmt.Sprintf("Generated a new secrets key at `%s`, keep a backup of this file", path))
+	return encoded, nil
+}
+
+// Encrypts a value using AES-GCM, the random nonce is prepended to the ciphertext
+func Encrypt(plaintext string) ([]byte, error) {
+	aead.lock.RLock()
+	defer aead.lock.RUnlock()
+
+	if aead.value == nil {
+		return nil, ErrNotInitialized
+	}
+
+	nonce := make([]byte, aead.value.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.value.Seal(nonce, nonce, []byte(plaintext), nil), nil
+}
+
+// Decrypts a value which was encrypted using `Encrypt`
+func Decrypt(ciphertext []byte) (string, error) {
+	aead.lock.RLock()
+	defer aead.lock.RUnlock()
+
+	if aead.value == nil {
+		return "", ErrNotInitialized
+	}
+
+	nonceSize := aead.value.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return "", errors.New("ciphertext is too short")
+	}
+
+	plaintext, err := aead.value.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt secret: %s", err.Error())
+	}
+
+	return string(plaintext), nil
+}
+
+// Encrypts and stores a secret, an existing secret of the same name is replaced
+func Set(owner string, name string, description string, shared bool, value string) error {
+	ciphertext, err := Encrypt(value)
+	if err != nil {
+		return err
+	}
+
+	return database.InsertHomescriptSecret(database.HomescriptSecret{
+		Owner:       owner,
+		Name:        name,
+		Description: description,
+		Shared:      shared,
+		CreatedAt:   time.Now(),
+		Ciphertext:  ciphertext,
+	})
+}
+
+// Returns the plaintext value of a secret which is visible to the user
+// A plain name refers to the user's own secret or, if the user has no secret of this name, to the only shared secret of this name
+// Shared secrets of other users can always be referred to as `owner/name`, plain names which match multiple shared secrets are rejected
+func Resolve(username string, name string) (value string, found bool, err error) {
+	owner, secretName, qualified := strings.Cut(name, "/")
+	if !qualified {
+		owner, secretName = username, name
+	}
+
+	secret, found, err := database.GetHomescriptSecret(owner, secretName)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Secrets of other users must be shared in order to be visible
+	found = found && (owner == username || secret.Shared)
+
+	if !found && !qualified {
+		shared, err := database.ListSharedHomescriptSecrets()
+		if err != nil {
+			return "", false, err
+		}
+
+		secret, found, err = selectShared(username, name, shared)
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	if !found {
+		return "", false, nil
+	}
+
+	value, err = Decrypt(secret.Ciphertext)
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// Selects the shared secret of another user which is referred to by a plain name
+func selectShared(username string, name string, shared []database.HomescriptSecret) (database.HomescriptSecret, bool, error) {
+	candidates := make([]database.HomescriptSecret, 0)
+	for _, candidate := range shared {
+		if candidate.Name == name && candidate.Owner != username {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return database.HomescriptSecret{}, false, nil
+	case 1:
+		return candidates[0], true, nil
+	}
+
+	owners := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		owners = append(owners, candidate.Owner)
+	}
+
+	return database.HomescriptSecret{}, false, fmt.Errorf(
+		"the secret name `%s` is shared by multiple users (%s), use `<owner>/%s` instead",
+		name,
+		strings.Join(owners, ", "),
+		name,
+	)
+}
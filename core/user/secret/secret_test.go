@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smarthome-go/smarthome/core/database"
+)
+
+func TestMain(m *testing.M) {
+	InitLogger(logrus.New())
+	os.Exit(m.Run())
+}
+
+func TestEncryption(t *testing.T) {
+	key := make([]byte, KeyLen)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	assert.NoError(t, Init(base64.StdEncoding.EncodeToString(key), ""))
+
+	ciphertext, err := Encrypt("api-key-1234")
+	assert.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "api-key-1234")
+
+	plaintext, err := Decrypt(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, "api-key-1234", plaintext)
+
+	// Every encryption uses a new nonce
+	other, err := Encrypt("api-key-1234")
+	assert.NoError(t, err)
+	assert.NotEqual(t, ciphertext, other)
+
+	// Modified ciphertexts are rejected
+	ciphertext[len(ciphertext)-1] ^= 0xFF
+	_, err = Decrypt(ciphertext)
+	assert.Error(t, err)
+
+	assert.Error(t, Init(base64.StdEncoding.EncodeToString(key[:16]), ""))
+	assert.Error(t, Init("not base64", ""))
+}
+
+func TestKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "secrets.key")
+
+	assert.NoError(t, Init("", path))
+	ciphertext, err := Encrypt("value")
+	assert.NoError(t, err)
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The generated key is reused on the next start
+	assert.NoError(t, Init("", path))
+	plaintext, err := Decrypt(ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", plaintext)
+}
+
+func TestSelectShared(t *testing.T) {
+	shared := []database.HomescriptSecret{
+		{Owner: "alice", Name: "weather-key", Shared: true},
+		{Owner: "bob", Name: "mqtt-password", Shared: true},
+		{Owner: "carol", Name: "mqtt-password", Shared: true},
+		{Owner: "dave", Name: "own-key", Shared: true},
+	}
+
+	secret, found, err := selectShared("dave", "weather-key", shared)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "alice", secret.Owner)
+
+	// Shared secrets of the user itself are resolved before, they are never selected here
+	_, found, err = selectShared("dave", "own-key", shared)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, found, err = selectShared("dave", "unknown", shared)
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// Ambiguous names must be qualified with the owner
+	_, found, err = selectShared("dave", "mqtt-password", shared)
+	assert.ErrorContains(t, err, "bob, carol")
+	assert.False(t, found)
+
+	// Unless the only other candidate is the user's own secret
+	secret, found, err = selectShared("carol", "mqtt-password", shared)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "bob", secret.Owner)
+}
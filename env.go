@@ -12,6 +12,7 @@ import (
 // `SMARTHOME_ADMIN_PASSWORD`: (String) If specified, the admin user that is created on first launch will receive this password instead of `admin`
 // `SMARTHOME_ENV_PRODUCTION`: (Bool  ) Whether the server should use production presets
 // `SMARTHOME_SESSION_KEY`   : (String) (Only during production) Specifies a manual key for session encryption (used for larger instances): random key generation is skipped
+// `SMARTHOME_SECRETS_KEY`   : (String) Specifies the base64-encoded key which is used to encrypt Homescript secrets
 // `SMARTHOME_DB_DATABASE`   : (String) Sets the database name
 // `SMARTHOME_DB_HOSTNAME`   : (String) Sets the database hostname
 // `SMARTHOME_DB_PORT`       : (Int   ) Sets the database port
@@ -50,6 +51,11 @@ func scanEnv(configStruct *core.Config) string {
 			configStruct.Server.SessionKey = sessionKey
 		}
 	}
+	// Homescript secrets key
+	if secretsKey, secretsKeyOk := os.LookupEnv("SMARTHOME_SECRETS_KEY"); secretsKeyOk {
+		log.Debug("Selected SMARTHOME_SECRETS_KEY over value from config file")
+		configStruct.Server.SecretsKey = secretsKey
+	}
 	// DB variables
 	if dbUsername, dbUsernameOk := os.LookupEnv("SMARTHOME_DB_USER"); dbUsernameOk {
 		log.Debug("Selected SMARTHOME_DB_USER over value from config file")
@@ -7,6 +7,7 @@ toolchain go1.22.0
 require (
 	github.com/briandowns/openweathermap v0.19.0
 	github.com/davecgh/go-spew v1.1.1
+	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/go-co-op/gocron v1.28.3
 	github.com/go-ping/ping v1.1.0
 	github.com/go-sql-driver/mysql v1.7.1
@@ -17,6 +18,7 @@ require (
 	github.com/h2non/filetype v1.1.3
 	github.com/lnquy/cron v1.1.1
 	github.com/nathan-osman/go-sunrise v1.1.0
+	github.com/pkg/errors v0.9.1
 	github.com/rifflock/lfshook v0.0.0-20180920164130-b9218ef580f5
 	github.com/sirupsen/logrus v1.9.3
 	github.com/smarthome-go/homescript/v3 v3.0.0-00010101000000-000000000000
@@ -27,9 +29,7 @@ require (
 
 require (
 	github.com/agnivade/levenshtein v1.1.1 // indirect
-	github.com/eclipse/paho.mqtt.golang v1.4.3 // indirect
 	github.com/google/uuid v1.2.0 // indirect
-	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/robfig/cron/v3 v3.0.1 // indirect
 	go.uber.org/atomic v1.11.0 // indirect
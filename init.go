@@ -24,6 +24,9 @@ import (
 	"github.com/smarthome-go/smarthome/server/routes"
 	"github.com/smarthome-go/smarthome/server/templates"
 	"github.com/smarthome-go/smarthome/services/camera"
+	"github.com/smarthome-go/smarthome/services/homeassistant"
+	"github.com/smarthome-go/smarthome/services/mqttbridge"
+	"github.com/smarthome-go/smarthome/services/mqttdevices"
 	"github.com/smarthome-go/smarthome/services/reminder"
 )
 
@@ -64,6 +67,9 @@ func initLoggers() {
 	templates.InitLogger(log)
 	reminder.InitLogger(log)
 	driver.InitLogger(log)
+	homeassistant.InitLogger(log)
+	mqttbridge.InitLogger(log)
+	mqttdevices.InitLogger(log)
 }
 
 const httpRootPath = "/"
@@ -13,6 +13,7 @@ import (
 
 	"github.com/smarthome-go/smarthome/core"
 	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/user/secret"
 	"github.com/smarthome-go/smarthome/core/utils"
 )
 
@@ -68,6 +69,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Homescript secret store
+	if err := secret.Init(configStruct.Server.SecretsKey, secret.DefaultKeyFile); err != nil {
+		log.Error("Could not initialize the secret store: ", err.Error())
+		os.Exit(1)
+	}
+
 	// Setup file
 	if err := core.RunSetup(); err != nil {
 		log.Error("Could not process setup.json file: ", err.Error())
@@ -211,6 +211,7 @@ func DeleteCamera(w http.ResponseWriter, r *http.Request) {
 		Res(w, Response{Success: false, Message: "failed to delete camera", Error: "database failure"})
 		return
 	}
+	camera.ForgetPreviousFrames(request.Id)
 	Res(w, Response{Success: true, Message: "successfully deleted camera"})
 }
 
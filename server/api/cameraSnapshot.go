@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+type DeleteCameraSnapshotRequest struct {
+	Id uint `json:"id"`
+}
+
+// Returns the snapshots which the current user's Homescripts have saved, without their image data
+// The optional `camera` query parameter only includes snapshots of a specific camera
+func ListCameraSnapshots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	snapshots, err := database.ListCameraSnapshots(username, r.URL.Query().Get("camera"))
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list camera snapshots", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(snapshots); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list camera snapshots", Error: "could not encode response"})
+	}
+}
+
+// Returns the image data of a snapshot of the current user
+func GetCameraSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to get camera snapshot", Error: "invalid snapshot id"})
+		return
+	}
+	snapshot, found, err := database.GetCameraSnapshot(username, uint(id))
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to get camera snapshot", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		Res(w, Response{Success: false, Message: "failed to get camera snapshot", Error: "no such snapshot exists"})
+		return
+	}
+	w.Header().Set("Content-Type", snapshot.ContentType)
+	if _, err := w.Write(snapshot.Data); err != nil {
+		log.Debug("Camera snapshot: client disconnected before awaiting response")
+	}
+}
+
+// Deletes a snapshot of the current user
+func DeleteCameraSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request DeleteCameraSnapshotRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	deleted, err := database.DeleteCameraSnapshot(username, request.Id)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to delete camera snapshot", Error: "database failure"})
+		return
+	}
+	if !deleted {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to delete camera snapshot", Error: "no such snapshot exists"})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully deleted camera snapshot"})
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+type HomescriptDependencyResponse struct {
+	homescript.HomescriptDependencies
+	Dependents []homescript.Dependent `json:"dependents"`
+}
+
+// Is returned by delete endpoints if the resource still has dependents
+// Appending `?force=true` to the request deletes the resource anyways
+type DependentsConflictResponse struct {
+	Success    bool                   `json:"success"`
+	Message    string                 `json:"message"`
+	Error      string                 `json:"error"`
+	Dependents []homescript.Dependent `json:"dependents"`
+}
+
+func isForcedRequest(r *http.Request) bool {
+	return r.URL.Query().Get("force") == "true"
+}
+
+func writeDependentsConflict(w http.ResponseWriter, message string, dependents []homescript.Dependent) {
+	w.WriteHeader(http.StatusConflict)
+	if err := json.NewEncoder(w).Encode(DependentsConflictResponse{
+		Success:    false,
+		Message:    message,
+		Error:      "resource has dependents, use `?force=true` to delete it anyways",
+		Dependents: dependents,
+	}); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: message, Error: "could not encode response"})
+	}
+}
+
+func encodeDependents(w http.ResponseWriter, dependents []homescript.Dependent) {
+	if err := json.NewEncoder(w).Encode(dependents); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list dependents", Error: "could not encode response"})
+	}
+}
+
+// Returns the dependencies and dependents of every Homescript of the current user
+func ListHomescriptDependencies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	index, err := homescript.GetDependencyIndex()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list dependencies", Error: "database failure"})
+		return
+	}
+	response := make([]HomescriptDependencyResponse, 0)
+	for _, script := range index.HomescriptsOfUser(username) {
+		response = append(response, HomescriptDependencyResponse{
+			HomescriptDependencies: script,
+			Dependents:             index.DependentsOfHomescript(username, script.HomescriptId),
+		})
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list dependencies", Error: "could not encode response"})
+	}
+}
+
+// Returns the Homescripts and schedules of the current user which use a storage key
+// If the `namespace` query parameter is set, the key is looked up in this namespace of the typed storage
+func ListStorageKeyDependents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	index, err := homescript.GetDependencyIndex()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list dependents", Error: "database failure"})
+		return
+	}
+	key := mux.Vars(r)["key"]
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		encodeDependents(w, index.DependentsOfStoreKey(username, namespace, key))
+		return
+	}
+	encodeDependents(w, index.DependentsOfStorageKey(username, key))
+}
+
+// Returns everything which would break if the device was deleted
+func ListDeviceDependents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	index, err := homescript.GetDependencyIndex()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list dependents", Error: "database failure"})
+		return
+	}
+	encodeDependents(w, index.DependentsOfDevice(mux.Vars(r)["id"]))
+}
+
+// Returns the devices of a room and everything which would break if they were deleted
+func ListRoomDependents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	index, err := homescript.GetDependencyIndex()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list dependents", Error: "database failure"})
+		return
+	}
+	dependents, err := index.DependentsOfRoom(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list dependents", Error: "database failure"})
+		return
+	}
+	encodeDependents(w, dependents)
+}
+
+// Returns the devices of a driver and everything which depends on them
+func ListDeviceDriverDependents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	_, exists, err := database.GetDeviceDriver(vars["vendorId"], vars["modelId"])
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list dependents", Error: "database failure"})
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		Res(w, Response{Success: false, Message: "failed to list dependents", Error: "not found: no data is associated to this vendor + model ID"})
+		return
+	}
+	index, err := homescript.GetDependencyIndex()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list dependents", Error: "database failure"})
+		return
+	}
+	dependents, err := index.DependentsOfDriver(vars["vendorId"], vars["modelId"])
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list dependents", Error: "database failure"})
+		return
+	}
+	encodeDependents(w, dependents)
+}
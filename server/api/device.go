@@ -12,6 +12,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/smarthome-go/smarthome/core/database"
 	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript"
 	"github.com/smarthome-go/smarthome/server/middleware"
 )
 
@@ -379,10 +380,24 @@ func DeleteDevice(w http.ResponseWriter, r *http.Request) {
 		Res(w, Response{Success: false, Message: "failed to delete device", Error: "no device with id exists"})
 		return
 	}
+	if !isForcedRequest(r) {
+		index, err := homescript.GetDependencyIndex()
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to delete device: could not validate deletion safety", Error: "database failure"})
+			return
+		}
+		if dependents := index.DependentsOfDevice(request.Id); len(dependents) > 0 {
+			writeDependentsConflict(w, "cannot delete device: safety violation", dependents)
+			return
+		}
+	}
 	if err := database.DeleteDevice(request.Id); err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		Res(w, Response{Success: false, Message: "failed to delete device", Error: "database failure"})
 		return
 	}
+	driver.ResetDeviceBreaker(request.Id)
+	driver.InvalidateInvocationPolicyCache()
 	Res(w, Response{Success: true, Message: "successfully deleted device"})
 }
@@ -289,6 +289,7 @@ func DeleteDeviceDriver(w http.ResponseWriter, r *http.Request) {
 		Res(w, Response{Success: false, Message: "failed to delete driver", Error: "database failure"})
 		return
 	}
+	driver.InvalidateInvocationPolicyCache()
 
 	Res(w, Response{Success: true, Message: "successfully deleted driver"})
 }
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/utils"
+)
+
+type InstallBundledDriverRequest struct {
+	VendorID string `json:"vendorId"`
+	ModelID  string `json:"modelId"`
+}
+
+// Lists the drivers which are shipped with Smarthome along with their installed versions
+func ListBundledDrivers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	drivers, err := driver.ListBundledDrivers()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list bundled drivers", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(drivers); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list bundled drivers", Error: "could not encode response"})
+	}
+}
+
+// Installs a bundled driver or upgrades its installed version
+func InstallBundledDriver(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request InstallBundledDriverRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	result, found, validationErr, dbErr := driver.Manager.InstallBundledDriver(request.VendorID, request.ModelID, utils.Version)
+	if dbErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to install bundled driver", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		Res(w, Response{Success: false, Message: "failed to install bundled driver", Error: fmt.Sprintf("there is no bundled driver `%s:%s`", request.VendorID, request.ModelID)})
+		return
+	}
+	if validationErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to install bundled driver", Error: validationErr.Error()})
+		return
+	}
+	if result.Action != driver.DriverPackageInstalled {
+		if ok := reloadDriverAfterChange(w, request.VendorID, request.ModelID); !ok {
+			return
+		}
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to install bundled driver", Error: "could not encode response"})
+	}
+}
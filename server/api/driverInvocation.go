@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+type SetDeviceTimeoutRequest struct {
+	Id string `json:"id"`
+	// If this is `nil`, the device uses the timeout of its driver again
+	TimeoutMillis *uint `json:"timeoutMillis"`
+}
+
+type ResetDeviceBreakerRequest struct {
+	Id string `json:"id"`
+}
+
+// Returns the timeout, retry and circuit breaker settings of a driver
+func GetDriverInvocationPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	policy, err := database.GetDeviceDriverInvocationPolicy(vars["vendorId"], vars["modelId"])
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to get driver invocation policy", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to get driver invocation policy", Error: "could not encode response"})
+	}
+}
+
+func SetDriverInvocationPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request database.DeviceDriverInvocationPolicy
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	_, found, err := database.GetDeviceDriver(request.VendorID, request.ModelID)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set driver invocation policy", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to set driver invocation policy", Error: "no driver with this vendor and model ID exists"})
+		return
+	}
+	validationErr, dbErr := driver.Manager.SetInvocationPolicy(request)
+	if dbErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set driver invocation policy", Error: "database failure"})
+		return
+	}
+	if validationErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to set driver invocation policy", Error: validationErr.Error()})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully set driver invocation policy"})
+}
+
+// Overrides the invocation timeout of the driver for a single device
+func SetDeviceTimeout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request SetDeviceTimeoutRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	_, found, err := database.GetDeviceById(request.Id)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set device timeout", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to set device timeout", Error: "no device with id exists"})
+		return
+	}
+	validationErr, dbErr := driver.Manager.SetDeviceTimeout(request.Id, request.TimeoutMillis)
+	if dbErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set device timeout", Error: "database failure"})
+		return
+	}
+	if validationErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to set device timeout", Error: validationErr.Error()})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully set device timeout"})
+}
+
+// Lists the circuit breaker state (open / half-open / closed) of every device the current user has access to
+func ListDeviceBreakers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	breakers, err := driver.ListDeviceBreakers(username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list circuit breakers", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(breakers); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list circuit breakers", Error: "could not encode response"})
+	}
+}
+
+// Closes the circuit breaker of a device so that it is invoked again immediately
+func ResetDeviceBreaker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request ResetDeviceBreakerRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	driver.ResetDeviceBreaker(request.Id)
+	Res(w, Response{Success: true, Message: "successfully reset circuit breaker"})
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
+)
+
+type UpgradeDeviceDriverRequest struct {
+	VendorID       string `json:"vendorId"`
+	ModelID        string `json:"modelId"`
+	Version        string `json:"version"`
+	HomescriptCode string `json:"homescriptCode"`
+	// If set, the migrations are only computed and reported
+	DryRun bool `json:"dryRun"`
+}
+
+type RollbackDeviceDriverRequest struct {
+	SnapshotId uint `json:"snapshotId"`
+}
+
+// Replaces the code and version of a driver while migrating the configuration of the driver and its devices
+// Responds with a report which contains the before / after JSON of every migrated singleton
+func UpgradeDeviceDriver(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request UpgradeDeviceDriverRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	if utf8.RuneCountInString(request.Version) > database.DEVICE_DRIVER_VERSION_LEN {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{
+			Success: false,
+			Message: "failed to upgrade device driver", Error: fmt.Sprintf("the version: '%s' must not exceed %d characters", request.Version, database.DEVICE_DRIVER_VERSION_LEN),
+		})
+		return
+	}
+	report, found, codeErr, dbErr := driver.Manager.MigrateDriver(
+		request.VendorID,
+		request.ModelID,
+		request.HomescriptCode,
+		request.Version,
+		request.DryRun,
+	)
+	if dbErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to upgrade device driver", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{
+			Success: false,
+			Message: "failed to upgrade device driver",
+			Error:   fmt.Sprintf("the device driver `%s:%s` does not exist", request.VendorID, request.ModelID),
+		})
+		return
+	}
+	if codeErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to upgrade device driver", Error: codeErr.Error()})
+		return
+	}
+	if report.Applied {
+		if ok := reloadDriverAfterChange(w, request.VendorID, request.ModelID); !ok {
+			return
+		}
+	}
+	// Failed migrations are reported with the full report so that every affected device can be displayed
+	if !report.Success {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to upgrade device driver", Error: "could not encode response"})
+	}
+}
+
+// Lists the snapshots which were taken before the migrations of a driver
+func ListDeviceDriverSnapshots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	snapshots, err := database.ListDeviceDriverSnapshots(vars["vendorId"], vars["modelId"])
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list driver snapshots", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(snapshots); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list driver snapshots", Error: "could not encode response"})
+	}
+}
+
+// Restores the code and configuration of a driver and its devices from a snapshot
+func RollbackDeviceDriver(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request RollbackDeviceDriverRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	restored, found, codeErr, dbErr := driver.Manager.RollbackDriverMigration(request.SnapshotId)
+	if dbErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to roll back device driver", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to roll back device driver", Error: "no such snapshot or driver exists"})
+		return
+	}
+	if codeErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to roll back device driver", Error: codeErr.Error()})
+		return
+	}
+	if ok := reloadDriverAfterChange(w, restored.VendorID, restored.ModelID); !ok {
+		return
+	}
+	Res(w, Response{Success: true, Message: fmt.Sprintf("successfully rolled back device driver to version %s", restored.Version)})
+}
+
+// Running instances of a driver still execute its old code, therefore, the driver is reloaded after its code changed
+// If reloading fails, an error response is written and `false` is returned
+func reloadDriverAfterChange(w http.ResponseWriter, vendorID string, modelID string) bool {
+	updated, found, err := database.GetDeviceDriver(vendorID, modelID)
+	if err != nil || !found {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to reload device driver", Error: "database failure"})
+		return false
+	}
+	if err := dispatcher.Instance.ReloadDriver(updated); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to reload device driver", Error: err.Error()})
+		return false
+	}
+	return true
+}
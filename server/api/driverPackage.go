@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/utils"
+)
+
+type ImportDriverPackageRequest struct {
+	Package        driver.DriverPackage `json:"package"`
+	AllowDowngrade bool                 `json:"allowDowngrade"`
+}
+
+// Returns a portable package of an installed driver
+// The driver is selected using the `vendorId` and `modelId` query parameters
+// If the `includeConfig` query parameter is `true`, the current driver settings are included as the default config
+func ExportDriverPackage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vendorID := r.URL.Query().Get("vendorId")
+	modelID := r.URL.Query().Get("modelId")
+	if vendorID == "" || modelID == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "the query parameters `vendorId` and `modelId` are required"})
+		return
+	}
+	pkg, found, err := driver.Manager.ExportDriverPackage(vendorID, modelID, r.URL.Query().Get("includeConfig") == "true")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to export driver package", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		Res(w, Response{Success: false, Message: "failed to export driver package", Error: fmt.Sprintf("the device driver `%s:%s` does not exist", vendorID, modelID)})
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s_%s_%s.json", vendorID, modelID, pkg.Manifest.Version)))
+	if err := json.NewEncoder(w).Encode(pkg); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to export driver package", Error: "could not encode response"})
+	}
+}
+
+// Installs a driver package or upgrades the installed driver of the same vendor and model
+func ImportDriverPackage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request ImportDriverPackageRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	result, validationErr, dbErr := driver.Manager.ImportDriverPackage(request.Package, utils.Version, request.AllowDowngrade)
+	if dbErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to import driver package", Error: "database failure"})
+		return
+	}
+	if validationErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "driver package validation failed", Error: validationErr.Error()})
+		return
+	}
+	if result.Action != driver.DriverPackageInstalled {
+		if ok := reloadDriverAfterChange(w, request.Package.Manifest.VendorID, request.Package.Manifest.ModelID); !ok {
+			return
+		}
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to import driver package", Error: "could not encode response"})
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/smarthome-go/smarthome/core/device/driver"
+)
+
+// Runs every device function of a driver on virtual devices whose network traffic is served by scripted responses
+// Responds with the results and Homescript errors of each function
+func SimulateDeviceDriver(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request driver.DriverSimulation
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	if len(request.Devices) == 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to simulate device driver", Error: "at least one virtual device is required"})
+		return
+	}
+	report, found, codeErr, dbErr := driver.Manager.SimulateDriver(request)
+	if dbErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to simulate device driver", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{
+			Success: false,
+			Message: "failed to simulate device driver",
+			Error:   fmt.Sprintf("the device driver `%s:%s` does not exist", request.VendorID, request.ModelID),
+		})
+		return
+	}
+	if codeErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to simulate device driver", Error: codeErr.Error()})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to simulate device driver", Error: "could not encode response"})
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/services/homeassistant"
+)
+
+// Returns the configuration of the Home Assistant exporter
+func GetHomeAssistantConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	config, err := database.GetHomeAssistantConfig()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to get Home Assistant config", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(config); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to get Home Assistant config", Error: "could not encode response"})
+	}
+}
+
+// Updates the configuration of the Home Assistant exporter and restarts it
+func SetHomeAssistantConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request database.HomeAssistantConfig
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	validationErr, dbErr := homeassistant.SetConfig(request)
+	if dbErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set Home Assistant config", Error: "database failure"})
+		return
+	}
+	if validationErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to set Home Assistant config", Error: validationErr.Error()})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully set Home Assistant config"})
+}
+
+// Publishes the discovery configuration and state of every exported device again
+func RepublishHomeAssistantDevices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	homeassistant.Republish()
+	Res(w, Response{Success: true, Message: "successfully requested republishing of Home Assistant devices"})
+}
@@ -488,6 +488,18 @@ func DeleteHomescriptById(w http.ResponseWriter, r *http.Request) {
 		Res(w, Response{Success: false, Message: "can not delete Homescript: safety violation", Error: "script is used in one or more automations"})
 		return
 	}
+	if !isForcedRequest(r) {
+		index, err := homescript.GetDependencyIndex()
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to delete Homescript: could not validate deletion safety", Error: "database failure"})
+			return
+		}
+		if dependents := index.DependentsOfHomescript(username, request.Id); len(dependents) > 0 {
+			writeDependentsConflict(w, "can not delete Homescript: safety violation", dependents)
+			return
+		}
+	}
 	if err := database.DeleteHomescriptById(request.Id, username); err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		Res(w, Response{Success: false, Message: "failed to delete Homescript", Error: "database failure"})
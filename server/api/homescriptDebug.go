@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/smarthome-go/smarthome/core/homescript"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+// Messages sent by the server (in addition to `err`, `out` and `res`)
+type HMSDebugMessageTXPaused struct {
+	Kind  HMSMessageKindTX `json:"kind"`
+	State types.DebugState `json:"state"`
+}
+
+const MessageKindPaused HMSMessageKindTX = "paused"
+
+type HmsDebugBreakpoints struct {
+	Filename string `json:"filename"`
+	Lines    []uint `json:"lines"`
+}
+
+// Messages sent by the client
+type HmsDebugMessageRX struct {
+	Kind HMSDebugMessageKindRX `json:"kind"`
+
+	// For init.
+	HMSID string          `json:"hmsID"`
+	Args  []HomescriptArg `json:"args"`
+
+	// For init and breakpoint updates.
+	Breakpoints []HmsDebugBreakpoints `json:"breakpoints"`
+
+	// Used for STDIN messages.
+	Payload string `json:"payload"`
+}
+
+type HMSDebugMessageKindRX string
+
+const (
+	// Sent by the client
+	DebugMessageKindInit        HMSDebugMessageKindRX = "init"
+	DebugMessageKindKill        HMSDebugMessageKindRX = "kill"
+	DebugMessageKindStdin       HMSDebugMessageKindRX = "stdin"
+	DebugMessageKindBreakpoints HMSDebugMessageKindRX = "breakpoints"
+	DebugMessageKindContinue    HMSDebugMessageKindRX = HMSDebugMessageKindRX(types.DebugCommandContinue)
+	DebugMessageKindPause       HMSDebugMessageKindRX = HMSDebugMessageKindRX(types.DebugCommandPause)
+	DebugMessageKindStepOver    HMSDebugMessageKindRX = HMSDebugMessageKindRX(types.DebugCommandStepOver)
+	DebugMessageKindStepInto    HMSDebugMessageKindRX = HMSDebugMessageKindRX(types.DebugCommandStepInto)
+	DebugMessageKindStepOut     HMSDebugMessageKindRX = HMSDebugMessageKindRX(types.DebugCommandStepOut)
+)
+
+// Forwards the output of a Homescript to the WS client.
+type wsOutputWriter struct {
+	ws    *websocket.Conn
+	mutex *sync.Mutex
+}
+
+func (w wsOutputWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.ws.SetWriteDeadline(time.Now().Add(wsTimeout)); err != nil {
+		return 0, err
+	}
+
+	if err := w.ws.WriteJSON(HMSMessageTXOut{
+		Kind:    MessageKindStdOut,
+		Payload: string(p),
+	}); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func writeWsJSON(ws *websocket.Conn, wsMutex *sync.Mutex, message any) error {
+	wsMutex.Lock()
+	defer wsMutex.Unlock()
+
+	if err := ws.SetWriteDeadline(time.Now().Add(wsTimeout)); err != nil {
+		return err
+	}
+
+	return ws.WriteJSON(message)
+}
+
+// Runs a Homescript by its ID in debug mode
+// The client controls the execution using breakpoints and step commands
+// If the Homescript runtime of this build does not support debugging, the connection is not upgraded
+func DebugHomescriptByIDAsync(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+
+	if !homescript.DebuggingSupported() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotImplemented)
+		Res(w, Response{Success: false, Message: "failed to debug Homescript", Error: "debugging is not supported by the Homescript runtime of this build"})
+		return
+	}
+
+	// Upgrade the connection
+	upgrader := websocket.Upgrader{}
+	wsMutex := sync.Mutex{}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("Could not upgrade connection to WS: ", err.Error())
+		return
+	}
+	defer ws.Close()
+
+	// Receive the ID, args and initial breakpoints
+	ws.SetReadLimit(100 * megabyte)
+	if err := ws.SetReadDeadline(time.Time{}); err != nil {
+		return
+	}
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Time{})
+	})
+	var request HmsDebugMessageRX
+	if err := ws.ReadJSON(&request); err != nil {
+		writeWsJSON(ws, &wsMutex, HMSMessageTXErr{
+			Kind:    MessageKindErr,
+			Message: fmt.Sprintf("invalid init request: %s", err.Error()),
+		})
+		return
+	}
+
+	if request.Kind != DebugMessageKindInit {
+		writeWsJSON(ws, &wsMutex, HMSMessageTXErr{
+			Kind:    MessageKindErr,
+			Message: fmt.Sprintf("invalid init request kind: %s", request.Kind),
+		})
+		return
+	}
+
+	args := make(map[string]string)
+	for _, arg := range request.Args {
+		args[arg.Key] = arg.Value
+	}
+
+	session := types.NewDebugSession()
+	defer session.Detach()
+	for _, breakpoints := range request.Breakpoints {
+		session.SetBreakpoints(breakpoints.Filename, breakpoints.Lines)
+	}
+
+	// Start debugging the script.
+	results := make(chan types.HmsRes, 1)
+	idChan := make(chan uint64, 1)
+	stdin := types.NewStdinBuffer()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		res, err := homescript.HmsManager.DebugUserScript(
+			request.HMSID,
+			username,
+			session,
+			types.Cancelation{
+				Context:    ctx,
+				CancelFunc: cancel,
+			},
+			wsOutputWriter{ws: ws, mutex: &wsMutex},
+			&idChan,
+			stdin,
+			args,
+		)
+
+		log.Tracef("WS homescript debugger (%s) finished.", request.HMSID)
+
+		if err != nil {
+			writeWsJSON(ws, &wsMutex, HMSMessageTXErr{
+				Kind:    MessageKindErr,
+				Message: fmt.Sprintf("Could not debug Homescript: %s", err.Error()),
+			})
+			close(results)
+			return
+		}
+
+		results <- res
+	}()
+
+	// Forward every pause of the VM to the client.
+	// If the script could not be started, `Paused` is never closed, therefore, this also stops once the invocation returned.
+	go func() {
+		for {
+			select {
+			case state, open := <-session.Paused:
+				if !open {
+					return
+				}
+
+				if err := writeWsJSON(ws, &wsMutex, HMSDebugMessageTXPaused{
+					Kind:  MessageKindPaused,
+					State: state,
+				}); err != nil {
+					session.Detach()
+					return
+				}
+			case <-session.Done():
+				return
+			}
+		}
+	}()
+
+	// Handle commands of the client.
+	go func() {
+		// The job ID is only available once the script is running.
+		var jobID *uint64
+
+		for {
+			var request HmsDebugMessageRX
+			if err := ws.ReadJSON(&request); err != nil {
+				// The client is gone: let the program finish without breakpoints.
+				session.Detach()
+				return
+			}
+
+			if jobID == nil {
+				select {
+				case id := <-idChan:
+					jobID = &id
+				default:
+				}
+			}
+
+			switch request.Kind {
+			case DebugMessageKindKill:
+				log.Trace("Killing debugged script from Websocket...")
+				session.Detach()
+				if jobID != nil {
+					homescript.HmsManager.Kill(*jobID)
+				} else {
+					cancel()
+				}
+				return
+			case DebugMessageKindStdin:
+				stdin.Send(request.Payload)
+			case DebugMessageKindBreakpoints:
+				for _, breakpoints := range request.Breakpoints {
+					session.SetBreakpoints(breakpoints.Filename, breakpoints.Lines)
+				}
+			case DebugMessageKindContinue, DebugMessageKindPause, DebugMessageKindStepOver,
+				DebugMessageKindStepInto, DebugMessageKindStepOut:
+				session.Command(types.DebugCommandKind(request.Kind))
+			default:
+				writeWsJSON(ws, &wsMutex, HMSMessageTXErr{
+					Kind:    MessageKindErr,
+					Message: fmt.Sprintf("invalid WS HMS debug request kind: `%s`\n", request.Kind),
+				})
+			}
+		}
+	}()
+
+	res, ok := <-results
+	if ok {
+		if err := writeWsJSON(ws, &wsMutex, HMSMessageTXRes{
+			Kind:         MessageKindResults,
+			Errors:       res.Errors.Diagnostics,
+			FileContents: res.Errors.FileContents,
+			Success:      !res.Errors.ContainsError,
+		}); err != nil {
+			return
+		}
+	}
+
+	wsMutex.Lock()
+	defer wsMutex.Unlock()
+
+	if err := ws.SetWriteDeadline(time.Now().Add(wsTimeout)); err != nil {
+		return
+	}
+	if err := ws.WriteMessage(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+	); err != nil {
+		return
+	}
+
+	// Give the client a grace period to close the connection.
+	time.Sleep(time.Second)
+}
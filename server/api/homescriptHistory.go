@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+// The maximum number of runs returned by the per-script, per-automation and per-schedule endpoints
+const homescriptRunsDefaultLimit = 100
+
+// Parses the numeric `id` path variable, writes an error response if this fails
+func numericIdFromVars(w http.ResponseWriter, r *http.Request, message string) (uint, bool) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: message, Error: "no id provided"})
+		return 0, false
+	}
+	idInt, err := strconv.Atoi(id)
+	if err != nil || idInt < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: message, Error: "id must be numeric"})
+		return 0, false
+	}
+	return uint(idInt), true
+}
+
+func writeHomescriptRuns(w http.ResponseWriter, username string, filter database.HomescriptRunFilter) {
+	runs, err := database.ListHomescriptRuns(username, filter)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list Homescript runs", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(runs); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list Homescript runs", Error: "could not encode response"})
+	}
+}
+
+// Returns the runs of the current user which match the provided filter
+func ListHomescriptRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request database.HomescriptRunFilter
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	writeHomescriptRuns(w, username, request)
+}
+
+// Returns the most recent runs of a Homescript given its id
+func ListHomescriptRunsOfScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to list Homescript runs", Error: "no id provided"})
+		return
+	}
+	_, exists, err := homescript.HmsManager.GetPersonalScriptById(id, username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list Homescript runs", Error: "database failure"})
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to list Homescript runs", Error: "invalid id: no such Homescript exists"})
+		return
+	}
+	writeHomescriptRuns(w, username, database.HomescriptRunFilter{
+		ProgramId: &id,
+		Limit:     homescriptRunsDefaultLimit,
+	})
+}
+
+// Returns a single run, including its output and errors
+func GetHomescriptRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	id, ok := numericIdFromVars(w, r, "failed to get Homescript run")
+	if !ok {
+		return
+	}
+	run, found, err := database.GetHomescriptRunById(id, username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to get Homescript run", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to get Homescript run", Error: "invalid id: no such run exists"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(run); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to get Homescript run", Error: "could not encode response"})
+	}
+}
+
+// Returns the runs which were caused by an automation
+// Runs remain accessible after the automation has been deleted
+func ListAutomationRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	id, ok := numericIdFromVars(w, r, "failed to list runs of automation")
+	if !ok {
+		return
+	}
+	writeHomescriptRuns(w, username, database.HomescriptRunFilter{
+		AutomationId: &id,
+		Limit:        homescriptRunsDefaultLimit,
+	})
+}
+
+// Returns the runs which were caused by a schedule
+// As schedules are deleted once they have been executed, this does not validate the existence of the schedule
+func ListScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	id, ok := numericIdFromVars(w, r, "failed to list runs of schedule")
+	if !ok {
+		return
+	}
+	writeHomescriptRuns(w, username, database.HomescriptRunFilter{
+		ScheduleId: &id,
+		Limit:      homescriptRunsDefaultLimit,
+	})
+}
+
+// Returns the retention policy of the execution history
+func GetHomescriptRunRetention(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	retention, err := database.GetHomescriptRunRetention()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to get Homescript history retention", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(retention); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to get Homescript history retention", Error: "could not encode response"})
+	}
+}
+
+// Updates the retention policy of the execution history
+func SetHomescriptRunRetention(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request database.HomescriptRunRetention
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	if err := homescript.SetRunRetention(request); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set Homescript history retention", Error: "database failure"})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully set Homescript history retention"})
+}
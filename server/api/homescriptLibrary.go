@@ -0,0 +1,323 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+type CreateHomescriptLibraryRequest struct {
+	Name         string `json:"name"`
+	HomescriptId string `json:"homescriptId"`
+	Description  string `json:"description"`
+}
+
+type HomescriptLibraryNameRequest struct {
+	Name string `json:"name"`
+}
+
+type SetHomescriptLibraryAccessRequest struct {
+	Name        string                    `json:"name"`
+	Users       []string                  `json:"users"`
+	Permissions []database.PermissionType `json:"permissions"`
+}
+
+type HomescriptLibraryResponse struct {
+	database.HomescriptLibrary
+	// Only included for libraries owned by the current user
+	Access *database.HomescriptLibraryAccess `json:"access"`
+}
+
+type PublishHomescriptLibraryResponse struct {
+	Success bool                             `json:"success"`
+	Report  *homescript.LibraryPublishReport `json:"report"`
+	// Contains the errors of the library if it could not be published
+	Errors []types.HmsError `json:"errors"`
+}
+
+// Returns all libraries which are owned by the current user or shared with them
+func ListHomescriptLibraries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	libraries, err := database.ListHomescriptLibraries()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list libraries", Error: "database failure"})
+		return
+	}
+	response := make([]HomescriptLibraryResponse, 0)
+	for _, library := range libraries {
+		if library.Owner == username {
+			access, err := database.GetHomescriptLibraryAccess(library.Name)
+			if err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				Res(w, Response{Success: false, Message: "failed to list libraries", Error: "database failure"})
+				return
+			}
+			response = append(response, HomescriptLibraryResponse{HomescriptLibrary: library, Access: &access})
+			continue
+		}
+		canImport, err := database.UserCanImportHomescriptLibrary(library, username)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to list libraries", Error: "database failure"})
+			return
+		}
+		if canImport {
+			response = append(response, HomescriptLibraryResponse{HomescriptLibrary: library, Access: nil})
+		}
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list libraries", Error: "could not encode response"})
+	}
+}
+
+// Marks a Homescript of the current user as a library and publishes its first version
+func CreateHomescriptLibrary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request CreateHomescriptLibraryRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	reason, valid, err := homescript.ValidateLibraryName(request.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to create library", Error: "database failure"})
+		return
+	}
+	if !valid {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to create library", Error: fmt.Sprintf("invalid name: %s", reason)})
+		return
+	}
+	_, exists, err := homescript.HmsManager.GetPersonalScriptById(request.HomescriptId, username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to create library", Error: "database failure"})
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to create library", Error: "invalid Homescript id: no such Homescript exists"})
+		return
+	}
+	report, diagnostics, err := homescript.HmsManager.CreateLibrary(database.HomescriptLibrary{
+		Name:          request.Name,
+		Owner:         username,
+		HomescriptId:  request.HomescriptId,
+		Description:   request.Description,
+		LatestVersion: 0,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to create library", Error: "database failure"})
+		return
+	}
+	writeLibraryPublishResponse(w, report, diagnostics)
+}
+
+// Publishes the current code of a library as a new version
+// The response contains a report of all dependents which no longer pass the analyzer
+func PublishHomescriptLibrary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request HomescriptLibraryNameRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	if _, ok := getOwnedLibrary(w, request.Name, username, "failed to publish library"); !ok {
+		return
+	}
+	report, diagnostics, err := homescript.HmsManager.PublishLibrary(request.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to publish library", Error: "database failure"})
+		return
+	}
+	writeLibraryPublishResponse(w, report, diagnostics)
+}
+
+// Replaces the users and permissions which are allowed to import a library
+func SetHomescriptLibraryAccess(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request SetHomescriptLibraryAccessRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	if _, ok := getOwnedLibrary(w, request.Name, username, "failed to set library access"); !ok {
+		return
+	}
+	for _, user := range request.Users {
+		_, found, err := database.GetUserByUsername(user)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to set library access", Error: "database failure"})
+			return
+		}
+		if !found {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			Res(w, Response{Success: false, Message: "failed to set library access", Error: fmt.Sprintf("invalid user: `%s` does not exist", user)})
+			return
+		}
+	}
+	for _, permission := range request.Permissions {
+		if !database.DoesPermissionExist(string(permission)) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			Res(w, Response{Success: false, Message: "failed to set library access", Error: fmt.Sprintf("invalid permission: `%s` does not exist", permission)})
+			return
+		}
+	}
+	if request.Users == nil {
+		request.Users = make([]string, 0)
+	}
+	if request.Permissions == nil {
+		request.Permissions = make([]database.PermissionType, 0)
+	}
+	if err := database.SetHomescriptLibraryAccess(request.Name, database.HomescriptLibraryAccess{
+		Users:       request.Users,
+		Permissions: request.Permissions,
+	}); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set library access", Error: "database failure"})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully set library access"})
+}
+
+// Deletes a library of the current user, the backing Homescript is kept
+func DeleteHomescriptLibrary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request HomescriptLibraryNameRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	if _, ok := getOwnedLibrary(w, request.Name, username, "failed to delete library"); !ok {
+		return
+	}
+	if err := database.DeleteHomescriptLibrary(request.Name); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to delete library", Error: "database failure"})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully deleted library"})
+}
+
+// Returns all published versions of a library, including their exports and dependent reports
+func ListHomescriptLibraryVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	library, found, err := database.GetHomescriptLibrary(name)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list library versions", Error: "database failure"})
+		return
+	}
+	canImport := false
+	if found {
+		if canImport, err = database.UserCanImportHomescriptLibrary(library, username); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to list library versions", Error: "database failure"})
+			return
+		}
+	}
+	if !canImport {
+		w.WriteHeader(http.StatusNotFound)
+		Res(w, Response{Success: false, Message: "failed to list library versions", Error: "invalid name: no such library exists"})
+		return
+	}
+	versions, err := database.ListHomescriptLibraryVersions(name)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list library versions", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list library versions", Error: "could not encode response"})
+	}
+}
+
+// Writes an error response and returns false if the library does not exist or is not owned by the user
+func getOwnedLibrary(w http.ResponseWriter, name string, username string, message string) (database.HomescriptLibrary, bool) {
+	library, found, err := database.GetHomescriptLibrary(name)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: message, Error: "database failure"})
+		return database.HomescriptLibrary{}, false
+	}
+	if !found || library.Owner != username {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: message, Error: "invalid name: no such library exists"})
+		return database.HomescriptLibrary{}, false
+	}
+	return library, true
+}
+
+func writeLibraryPublishResponse(
+	w http.ResponseWriter,
+	report homescript.LibraryPublishReport,
+	diagnostics types.HmsDiagnosticsContainer,
+) {
+	response := PublishHomescriptLibraryResponse{
+		Success: !diagnostics.ContainsError,
+		Report:  nil,
+		Errors:  diagnostics.Diagnostics,
+	}
+	if diagnostics.ContainsError {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	} else {
+		response.Report = &report
+	}
+	if response.Errors == nil {
+		response.Errors = make([]types.HmsError, 0)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to publish library", Error: "could not encode response"})
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/smarthome-go/smarthome/core/homescript"
+	"github.com/smarthome-go/smarthome/core/homescript/lsp"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+// Serves the Homescript language server over a WebSocket
+// Each WS message contains exactly one JSON-RPC message of the Language Server Protocol
+func HomescriptLanguageServer(w http.ResponseWriter, r *http.Request) {
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+
+	// Upgrade the connection
+	upgrader := websocket.Upgrader{}
+	wsMutex := sync.Mutex{}
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("Could not upgrade connection to WS: ", err.Error())
+		return
+	}
+	defer ws.Close()
+
+	ws.SetReadLimit(100 * megabyte)
+	if err := ws.SetReadDeadline(time.Time{}); err != nil {
+		return
+	}
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Time{})
+	})
+
+	server := lsp.NewServer(username, &homescript.HmsManager, func(message any) error {
+		return writeWsJSON(ws, &wsMutex, message)
+	})
+
+	log.Tracef("Homescript language server for user `%s` started", username)
+
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			log.Tracef("Homescript language server for user `%s` disconnected: %s", username, err.Error())
+			return
+		}
+
+		exit, err := server.Handle(message)
+		if err != nil {
+			log.Debug("Could not send language server message: ", err.Error())
+			return
+		}
+		if exit {
+			log.Tracef("Homescript language server for user `%s` exited", username)
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript"
+)
+
+type HomescriptQuotaDeleteRequest struct {
+	Username string                          `json:"username"`
+	Context  database.HomescriptQuotaContext `json:"context"`
+}
+
+func isValidQuotaContext(context database.HomescriptQuotaContext) bool {
+	switch context {
+	case database.HomescriptQuotaContextUser,
+		database.HomescriptQuotaContextAutomation,
+		database.HomescriptQuotaContextDriver,
+		database.HomescriptQuotaContextWebhook:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns a list of all Homescript quotas, including the defaults of each context
+func ListHomescriptQuotas(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	quotas, err := database.ListHomescriptQuotas()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list Homescript quotas", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(quotas); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list Homescript quotas", Error: "could not encode response"})
+	}
+}
+
+// Creates or updates a Homescript quota
+// An empty username modifies the default quota of the specified context
+func SetHomescriptQuota(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request database.HomescriptQuota
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+
+	if !isValidQuotaContext(request.Context) {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to set Homescript quota", Error: fmt.Sprintf("invalid context `%s`", request.Context)})
+		return
+	}
+
+	// Instructions are counted using the debug output of the VM
+	if request.Data.MaxInstructions != 0 && !homescript.DebuggingSupported() {
+		w.WriteHeader(http.StatusNotImplemented)
+		Res(w, Response{Success: false, Message: "failed to set Homescript quota", Error: "instruction limits are not supported by the Homescript runtime of this build"})
+		return
+	}
+
+	if request.Username != database.HomescriptQuotaDefaultUsername {
+		_, exists, err := database.GetUserByUsername(request.Username)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to set Homescript quota", Error: "database failure"})
+			return
+		}
+		if !exists {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			Res(w, Response{Success: false, Message: "failed to set Homescript quota", Error: "invalid user"})
+			return
+		}
+	}
+
+	if err := database.SetHomescriptQuota(request); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set Homescript quota", Error: "database failure"})
+		return
+	}
+	homescript.InvalidateQuotaCache()
+
+	Res(w, Response{Success: true, Message: "successfully set Homescript quota"})
+}
+
+// Deletes a Homescript quota: affected users fall back to the default quota of the context
+func DeleteHomescriptQuota(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request HomescriptQuotaDeleteRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+
+	_, found, err := database.GetHomescriptQuota(request.Username, request.Context)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to delete Homescript quota", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to delete Homescript quota", Error: "no such quota exists"})
+		return
+	}
+
+	if err := database.DeleteHomescriptQuota(request.Username, request.Context); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to delete Homescript quota", Error: "database failure"})
+		return
+	}
+	homescript.InvalidateQuotaCache()
+
+	Res(w, Response{Success: true, Message: "successfully deleted Homescript quota"})
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/user/secret"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+// The maximum size of a secret value in bytes
+const homescriptSecretMaxValueLen = 8192
+
+var homescriptSecretNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-.]{1,50}$`)
+
+type AddHomescriptSecretRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Value       string `json:"value"`
+	// Shared secrets can be read by every user and require the `modifyServerConfig` permission
+	Shared bool `json:"shared"`
+}
+
+type ModifyHomescriptSecretRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// If this is `nil`, the value is left unchanged
+	Value *string `json:"value"`
+}
+
+type DeleteHomescriptSecretRequest struct {
+	Name string `json:"name"`
+}
+
+type ListHomescriptSecretsResponse struct {
+	Personal []database.HomescriptSecret `json:"personal"`
+	// Secrets of other users which are shared with everyone
+	Shared []database.HomescriptSecret `json:"shared"`
+}
+
+// Returns the metadata of the current user's secrets and all shared secrets, values are never included
+func ListHomescriptSecrets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	personal, err := database.ListHomescriptSecretsOfUser(username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list secrets", Error: "database failure"})
+		return
+	}
+	sharedAll, err := database.ListSharedHomescriptSecrets()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list secrets", Error: "database failure"})
+		return
+	}
+	shared := make([]database.HomescriptSecret, 0)
+	for _, item := range sharedAll {
+		if item.Owner != username {
+			shared = append(shared, item)
+		}
+	}
+	if err := json.NewEncoder(w).Encode(ListHomescriptSecretsResponse{
+		Personal: personal,
+		Shared:   shared,
+	}); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list secrets", Error: "could not encode response"})
+	}
+}
+
+// Creates a new secret, the value is encrypted and can only be read by Homescripts
+func AddHomescriptSecret(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request AddHomescriptSecretRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	if !homescriptSecretNameRegex.MatchString(request.Name) {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to add secret", Error: "name must consist of 1 to 50 letters, digits, `_`, `-` or `.`"})
+		return
+	}
+	if request.Value == "" || len(request.Value) > homescriptSecretMaxValueLen {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to add secret", Error: "value must not be empty or larger than 8 KiB"})
+		return
+	}
+	if request.Shared {
+		hasPermission, err := database.UserHasPermission(username, database.PermissionSystemConfig)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to add secret", Error: "database failure"})
+			return
+		}
+		if !hasPermission {
+			w.WriteHeader(http.StatusForbidden)
+			Res(w, Response{Success: false, Message: "failed to add secret", Error: "shared secrets require the `modifyServerConfig` permission"})
+			return
+		}
+		shared, err := database.ListSharedHomescriptSecrets()
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to add secret", Error: "database failure"})
+			return
+		}
+		for _, item := range shared {
+			if item.Name == request.Name {
+				w.WriteHeader(http.StatusConflict)
+				Res(w, Response{Success: false, Message: "failed to add secret", Error: "a shared secret with this name already exists"})
+				return
+			}
+		}
+	}
+	_, exists, err := database.GetHomescriptSecret(username, request.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to add secret", Error: "database failure"})
+		return
+	}
+	if exists {
+		w.WriteHeader(http.StatusConflict)
+		Res(w, Response{Success: false, Message: "failed to add secret", Error: "a secret with this name already exists"})
+		return
+	}
+	if err := secret.Set(username, request.Name, request.Description, request.Shared, request.Value); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to add secret", Error: "could not store secret"})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully added secret"})
+}
+
+// Changes the description or replaces the value of a secret of the current user
+func ModifyHomescriptSecret(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request ModifyHomescriptSecretRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	_, exists, err := database.GetHomescriptSecret(username, request.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to modify secret", Error: "database failure"})
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to modify secret", Error: "invalid name: no such secret exists"})
+		return
+	}
+	var ciphertext []byte
+	if request.Value != nil {
+		if *request.Value == "" || len(*request.Value) > homescriptSecretMaxValueLen {
+			w.WriteHeader(http.StatusBadRequest)
+			Res(w, Response{Success: false, Message: "failed to modify secret", Error: "value must not be empty or larger than 8 KiB"})
+			return
+		}
+		if ciphertext, err = secret.Encrypt(*request.Value); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to modify secret", Error: "could not encrypt secret"})
+			return
+		}
+	}
+	if err := database.ModifyHomescriptSecret(username, request.Name, request.Description, ciphertext); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to modify secret", Error: "database failure"})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully modified secret"})
+}
+
+// Deletes a secret of the current user
+func DeleteHomescriptSecret(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request DeleteHomescriptSecretRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	_, exists, err := database.GetHomescriptSecret(username, request.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to delete secret", Error: "database failure"})
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to delete secret", Error: "invalid name: no such secret exists"})
+		return
+	}
+	if err := database.DeleteHomescriptSecret(username, request.Name); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to delete secret", Error: "database failure"})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully deleted secret"})
+}
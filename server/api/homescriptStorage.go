@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+// The maximum size of an encoded storage value in bytes
+const homescriptStorageMaxValueLen = 1 << 20
+
+type HomescriptStorageEntryResponse struct {
+	Namespace string                `json:"namespace"`
+	Key       string                `json:"key"`
+	Kind      types.StoredValueKind `json:"kind"`
+	// The value as tagged JSON, for instance `{"k": "int", "v": 42}`
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt *time.Time      `json:"expiresAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+type SetHomescriptStorageEntryRequest struct {
+	Namespace string          `json:"namespace"`
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	// If this is `nil`, the entry never expires
+	TTLSeconds *int64 `json:"ttlSeconds"`
+}
+
+type DeleteHomescriptStorageEntryRequest struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+}
+
+// Returns all namespaces of the current user's typed Homescript storage which contain entries
+func ListHomescriptStorageNamespaces(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	namespaces, err := database.ListHomescriptStorageNamespaces(username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list storage namespaces", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(namespaces); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list storage namespaces", Error: "could not encode response"})
+	}
+}
+
+// Returns the entries of a namespace, the optional `prefix` query parameter only includes matching keys
+// If the `namespace` query parameter is omitted, the entries of all namespaces are returned
+func ListHomescriptStorageEntries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	entries, err := database.ListHomescriptStorageEntries(
+		username,
+		r.URL.Query().Get("namespace"),
+		r.URL.Query().Get("prefix"),
+	)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list storage entries", Error: "database failure"})
+		return
+	}
+	response := make([]HomescriptStorageEntryResponse, 0)
+	for _, entry := range entries {
+		var stored types.StoredValue
+		if err := json.Unmarshal([]byte(entry.Value), &stored); err != nil {
+			log.Warn(fmt.Sprintf("Skipping malformed Homescript storage entry `%s` in namespace `%s`: %s", entry.Key, entry.Namespace, err.Error()))
+			continue
+		}
+		response = append(response, HomescriptStorageEntryResponse{
+			Namespace: entry.Namespace,
+			Key:       entry.Key,
+			Kind:      stored.Kind,
+			Value:     json.RawMessage(entry.Value),
+			ExpiresAt: entry.ExpiresAt,
+			UpdatedAt: entry.UpdatedAt,
+		})
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list storage entries", Error: "could not encode response"})
+	}
+}
+
+// Creates or replaces an entry of the typed Homescript storage
+func SetHomescriptStorageEntry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request SetHomescriptStorageEntryRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	if request.Namespace == "" || len(request.Namespace) > database.HomescriptStorageNamespaceMaxLen {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to set storage entry", Error: fmt.Sprintf("namespace must be between 1 and %d characters long", database.HomescriptStorageNamespaceMaxLen)})
+		return
+	}
+	if request.Key == "" || len(request.Key) > database.HomescriptStorageKeyMaxLen {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to set storage entry", Error: fmt.Sprintf("key must be between 1 and %d characters long", database.HomescriptStorageKeyMaxLen)})
+		return
+	}
+	if len(request.Value) > homescriptStorageMaxValueLen {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to set storage entry", Error: "value must not be larger than 1 MiB"})
+		return
+	}
+	if request.TTLSeconds != nil && *request.TTLSeconds <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to set storage entry", Error: "ttl must be a positive amount of seconds"})
+		return
+	}
+	// Normalizing the value validates it and keeps it comparable by `compare_and_swap`
+	normalized, _, err := types.NormalizeStoredValue(string(request.Value))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to set storage entry", Error: fmt.Sprintf("invalid value: %s", err.Error())})
+		return
+	}
+	if err := database.SetHomescriptStorageEntry(username, request.Namespace, request.Key, normalized, request.TTLSeconds); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set storage entry", Error: "database failure"})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully set storage entry"})
+}
+
+// Deletes an entry of the typed Homescript storage
+func DeleteHomescriptStorageEntry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request DeleteHomescriptStorageEntryRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	deleted, err := database.DeleteHomescriptStorageEntry(username, request.Namespace, request.Key)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to delete storage entry", Error: "database failure"})
+		return
+	}
+	if !deleted {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to delete storage entry", Error: "invalid key: no such entry exists"})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully deleted storage entry"})
+}
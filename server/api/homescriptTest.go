@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+type HomescriptTestRequest struct {
+	// If `Code` is omitted, the saved code of the Homescript / driver is tested.
+	Code *string `json:"code"`
+	// The ID of the user Homescript, ignored if `Driver` is set.
+	Id string `json:"id"`
+	// If this is set, the code is tested as a driver.
+	Driver *DeviceDriverRequest `json:"driver"`
+	// Fake singleton data for driver tests, zero values are used if omitted.
+	DriverData interface{} `json:"driverData"`
+	DeviceData interface{} `json:"deviceData"`
+}
+
+type HomescriptTestResponse struct {
+	Success      bool                  `json:"success"`
+	Tests        []types.HmsTestResult `json:"tests"`
+	FileContents map[string]string     `json:"fileContents"`
+	Errors       []types.HmsError      `json:"errors"`
+}
+
+func TestHomescript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request HomescriptTestRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+
+	var results []types.HmsTestResult
+	var diagnostics types.HmsDiagnosticsContainer
+
+	if request.Driver != nil {
+		// Testing drivers requires the same permission as modifying them.
+		hasPermission, err := database.UserHasPermission(username, database.PermissionSystemConfig)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			Res(w, Response{Success: false, Message: "failed to test driver", Error: "database failure"})
+			return
+		}
+		if !hasPermission {
+			w.WriteHeader(http.StatusForbidden)
+			Res(w, Response{Success: false, Message: "failed to test driver", Error: fmt.Sprintf("permission denied: testing drivers requires the `%s` permission", database.PermissionSystemConfig)})
+			return
+		}
+
+		code := request.Code
+		if code == nil {
+			driverData, found, err := database.GetDeviceDriver(request.Driver.VendorID, request.Driver.ModelID)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				Res(w, Response{Success: false, Message: "failed to test driver", Error: "database failure"})
+				return
+			}
+			if !found {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				Res(w, Response{Success: false, Message: "failed to test driver", Error: "invalid driver: not found"})
+				return
+			}
+			code = &driverData.HomescriptCode
+		}
+
+		results, diagnostics, err = homescript.HmsManager.RunDriverTests(
+			request.Driver.VendorID,
+			request.Driver.ModelID,
+			*code,
+			request.DriverData,
+			request.DeviceData,
+		)
+	} else {
+		code := request.Code
+		if code == nil {
+			script, found, err := homescript.HmsManager.GetPersonalScriptById(request.Id, username)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				Res(w, Response{Success: false, Message: "failed to test Homescript", Error: "database failure"})
+				return
+			}
+			if !found {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				Res(w, Response{Success: false, Message: "failed to test Homescript", Error: "invalid id: not found"})
+				return
+			}
+			code = &script.Data.Code
+		}
+
+		results, diagnostics, err = homescript.HmsManager.RunUserTests(*code, request.Id, username)
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		Res(w, Response{Success: false, Message: "failed to run tests", Error: "internal server error"})
+		return
+	}
+
+	success := !diagnostics.ContainsError
+	for _, result := range results {
+		if !result.Passed {
+			success = false
+			break
+		}
+	}
+
+	if results == nil {
+		results = make([]types.HmsTestResult, 0)
+	}
+
+	if err := json.NewEncoder(w).Encode(
+		HomescriptTestResponse{
+			Success:      success,
+			Tests:        results,
+			FileContents: diagnostics.FileContents,
+			Errors:       diagnostics.Diagnostics,
+		}); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "could not encode response", Error: "could not encode response"})
+	}
+}
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/smarthome-go/homescript/v3/homescript/runtime/value"
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+// The maximum size of a request body which is passed to a webhook
+const webhookMaxBodyBytes = 1 << 20
+
+// The maximum runtime of a webhook, quotas can impose stricter limits
+const webhookMaxRuntime = 30 * time.Second
+
+type CreateHomescriptWebhookRequest struct {
+	HomescriptId string   `json:"homescriptId"`
+	Name         string   `json:"name"`
+	Methods      []string `json:"methods"`
+	HmacSecret   *string  `json:"hmacSecret"`
+}
+
+type DeleteHomescriptWebhookRequest struct {
+	Id string `json:"id"`
+}
+
+type HomescriptWebhookResponse struct {
+	database.HomescriptWebhook
+	HmacEnabled bool `json:"hmacEnabled"`
+}
+
+func isValidWebhookMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet,
+		http.MethodHead,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Returns a list of all webhooks of the current user
+func ListHomescriptWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	webhooks, err := database.ListHomescriptWebhooksOfUser(username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to list webhooks", Error: "database failure"})
+		return
+	}
+	response := make([]HomescriptWebhookResponse, len(webhooks))
+	for idx, webhook := range webhooks {
+		response[idx] = HomescriptWebhookResponse{
+			HomescriptWebhook: webhook,
+			HmacEnabled:       webhook.HmacSecret != nil,
+		}
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list webhooks", Error: "could not encode response"})
+	}
+}
+
+// Creates a new webhook for a Homescript of the current user
+// The response contains the generated id which is part of the webhook URL
+func CreateHomescriptWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request CreateHomescriptWebhookRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	if request.Name == "" || len(request.Name) > 30 {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to create webhook", Error: "name must be between 1 and 30 characters long"})
+		return
+	}
+	for _, method := range request.Methods {
+		if !isValidWebhookMethod(method) {
+			w.WriteHeader(http.StatusBadRequest)
+			Res(w, Response{Success: false, Message: "failed to create webhook", Error: fmt.Sprintf("invalid HTTP method: `%s`", method)})
+			return
+		}
+	}
+	if request.HmacSecret != nil && *request.HmacSecret == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "failed to create webhook", Error: "HMAC secret must not be empty"})
+		return
+	}
+	_, exists, err := homescript.HmsManager.GetPersonalScriptById(request.HomescriptId, username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to create webhook", Error: "database failure"})
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to create webhook", Error: "invalid Homescript id: no such Homescript exists"})
+		return
+	}
+	webhook, err := homescript.CreateWebhook(
+		username,
+		request.HomescriptId,
+		request.Name,
+		request.Methods,
+		request.HmacSecret,
+	)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to create webhook", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(HomescriptWebhookResponse{
+		HomescriptWebhook: webhook,
+		HmacEnabled:       webhook.HmacSecret != nil,
+	}); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to create webhook", Error: "could not encode response"})
+	}
+}
+
+// Deletes a webhook of the current user
+func DeleteHomescriptWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request DeleteHomescriptWebhookRequest
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	webhook, found, err := database.GetHomescriptWebhookById(request.Id)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to delete webhook", Error: "database failure"})
+		return
+	}
+	if !found || webhook.Owner != username {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to delete webhook", Error: "invalid id: no such webhook exists"})
+		return
+	}
+	if err := database.DeleteHomescriptWebhook(request.Id, username); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to delete webhook", Error: "database failure"})
+		return
+	}
+	homescript.ForgetWebhookRateLimit(request.Id)
+	Res(w, Response{Success: true, Message: "successfully deleted webhook"})
+}
+
+// Runs the Homescript of a webhook, this endpoint does not require authentication as the id acts as a secret
+// The response is derived from the return value of the script, see `homescript.MapWebhookResponse`
+// Callers are anonymous: output and errors of the script are only recorded in its execution history
+func RunHomescriptWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	webhook, found, err := database.GetHomescriptWebhookById(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: "database failure"})
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: "no such webhook exists"})
+		return
+	}
+	if allowed, retryAfter := homescript.AllowWebhookRequest(webhook.Id); !allowed {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: "rate limit exceeded"})
+		return
+	}
+	if !homescript.WebhookAllowsMethod(webhook, r.Method) {
+		w.Header().Set("Allow", strings.Join(webhook.Methods, ", "))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: fmt.Sprintf("method `%s` is not allowed", r.Method)})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBodyBytes))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: "request body is too large"})
+		return
+	}
+	if !homescript.VerifyWebhookSignature(webhook, body, r.Header.Get(homescript.WebhookSignatureHeader)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: "invalid signature"})
+		return
+	}
+	// The owner could have lost the permission to use Homescript after the webhook was created
+	hasPermission, err := database.UserHasPermission(webhook.Owner, database.PermissionHomescript)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: "database failure"})
+		return
+	}
+	if !hasPermission {
+		w.WriteHeader(http.StatusForbidden)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: "the owner of this webhook lacks permission to use Homescript"})
+		return
+	}
+
+	headers := make(map[string]string)
+	for key, values := range r.Header {
+		headers[key] = strings.Join(values, ",")
+	}
+	query := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		query[key] = strings.Join(values, ",")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookMaxRuntime)
+	defer cancel()
+
+	res, err := homescript.HmsManager.RunWebhook(
+		webhook,
+		types.ExecutionContextWebhookRequest{
+			Method:  r.Method,
+			Headers: headers,
+			Query:   query,
+			Body:    string(body),
+		},
+		types.Cancelation{
+			Context:    ctx,
+			CancelFunc: cancel,
+		},
+		// The output is only recorded in the execution history
+		io.Discard,
+	)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "an error occured during Homescript execution", Error: "backend failure"})
+		return
+	}
+
+	if res.Errors.ContainsError {
+		w.WriteHeader(http.StatusInternalServerError)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: "Homescript terminated with errors, details are recorded in its execution history"})
+		return
+	}
+
+	var marshaled any
+	if res.ReturnValue != nil {
+		encoded, i := value.MarshalValue(res.ReturnValue, false)
+		if i != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			Res(w, Response{Success: false, Message: "failed to run webhook", Error: "return value could not be encoded"})
+			return
+		}
+		marshaled = homescript.RedactMarshaledValue(encoded, res.Redact)
+	}
+
+	response, err := homescript.MapWebhookResponse(marshaled)
+	if err != nil {
+		log.Warnf("Webhook `%s` of user `%s` returned an invalid response: %s", webhook.Name, webhook.Owner, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		Res(w, Response{Success: false, Message: "failed to run webhook", Error: "return value is not a valid response"})
+		return
+	}
+
+	w.Header().Del("Content-Type")
+	for name, content := range response.Headers {
+		w.Header().Set(name, content)
+	}
+	w.WriteHeader(response.Status)
+	if _, err := w.Write(response.Body); err != nil {
+		log.Error(err.Error())
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/services/mqttbridge"
+)
+
+// Returns the configuration of the MQTT state bridge
+func GetMqttBridgeConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	config, err := database.GetMqttBridgeConfig()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to get MQTT bridge config", Error: "database failure"})
+		return
+	}
+	if err := json.NewEncoder(w).Encode(config); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to get MQTT bridge config", Error: "could not encode response"})
+	}
+}
+
+// Updates the configuration of the MQTT state bridge and restarts it
+func SetMqttBridgeConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	var request database.MqttBridgeConfig
+	if err := decoder.Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+		return
+	}
+	validationErr, dbErr := mqttbridge.SetConfig(request)
+	if dbErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "failed to set MQTT bridge config", Error: "database failure"})
+		return
+	}
+	if validationErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to set MQTT bridge config", Error: validationErr.Error()})
+		return
+	}
+	Res(w, Response{Success: true, Message: "successfully set MQTT bridge config"})
+}
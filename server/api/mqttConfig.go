@@ -21,6 +21,18 @@ func UpdateMQTTConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if request.Broker.Enabled && request.Broker.Port == 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to update MQTT config", Error: "the embedded broker requires a port"})
+		return
+	}
+
+	if err := dispatcher.ValidateMqttConfig(request); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to update MQTT config", Error: err.Error()})
+		return
+	}
+
 	reloadErr, dbErr := core.UpdateMqttConfig(request)
 	if dbErr != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -37,9 +49,26 @@ func UpdateMQTTConfig(w http.ResponseWriter, r *http.Request) {
 	Res(w, Response{Success: true, Message: "successfully updated MQTT config"})
 }
 
+type MqttBrokerStatus struct {
+	Name    string  `json:"name"`
+	Working bool    `json:"working"`
+	Error   *string `json:"error"`
+}
+
+// `Working` and `Error` describe the default broker
 type MqttStatus struct {
 	Working bool    `json:"working"`
 	Error   *string `json:"error"`
+	// Status of the additional, named brokers
+	Brokers []MqttBrokerStatus `json:"brokers"`
+}
+
+func mqttErrorMessage(err error) *string {
+	if err == nil {
+		return nil
+	}
+	errS := err.Error()
+	return &errS
 }
 
 func GetMQTTStatus(w http.ResponseWriter, r *http.Request) {
@@ -47,17 +76,38 @@ func GetMQTTStatus(w http.ResponseWriter, r *http.Request) {
 
 	err := dispatcher.Instance.MQTTStatus()
 
-	var errMsg *string
-	if err != nil {
-		errS := err.Error()
-		errMsg = &errS
+	brokers := make([]MqttBrokerStatus, 0)
+	for _, broker := range dispatcher.Instance.MqttBrokersStatus() {
+		brokers = append(brokers, MqttBrokerStatus{
+			Name:    broker.Name,
+			Working: broker.Err == nil,
+			Error:   mqttErrorMessage(broker.Err),
+		})
 	}
 
 	if err := json.NewEncoder(w).Encode(MqttStatus{
 		Working: err == nil,
-		Error:   errMsg,
+		Error:   mqttErrorMessage(err),
+		Brokers: brokers,
 	}); err != nil {
 		log.Error(err.Error())
 		Res(w, Response{Success: false, Message: "failed to get MQTT status", Error: "could not encode response"})
 	}
 }
+
+// Lists the clients which are connected to the embedded MQTT broker
+func GetMQTTBrokerClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	clients, running := core.EmbeddedBrokerClients()
+	if !running {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		Res(w, Response{Success: false, Message: "failed to list MQTT clients", Error: "the embedded broker is not running"})
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(clients); err != nil {
+		log.Error(err.Error())
+		Res(w, Response{Success: false, Message: "failed to list MQTT clients", Error: "could not encode response"})
+	}
+}
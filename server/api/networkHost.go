@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript/stdlib"
+	"github.com/smarthome-go/smarthome/server/middleware"
+)
+
+// Host patterns can be IP addresses, CIDR ranges, host names or wildcard domains (`*.lan`)
+type UserNetworkHostRequest struct {
+	Username string `json:"username"`
+	Host     string `json:"host"`
+}
+
+type DriverNetworkHostRequest struct {
+	VendorId string `json:"vendorId"`
+	ModelId  string `json:"modelId"`
+	Host     string `json:"host"`
+}
+
+func encodeNetworkHosts(w http.ResponseWriter, hosts []string) {
+	if err := json.NewEncoder(w).Encode(hosts); err != nil {
+		log.Error("Failed to encode response: ", err.Error())
+		Res(w, Response{Success: false, Message: "could not list network hosts", Error: "failed to encode response"})
+	}
+}
+
+// Returns the hosts which the Homescripts of the current user may connect to
+func GetPersonalNetworkHosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username, err := middleware.GetUserFromCurrentSession(w, r)
+	if err != nil {
+		return
+	}
+	hosts, err := database.ListUserNetworkHosts(username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "could not list network hosts", Error: "database failure"})
+		return
+	}
+	encodeNetworkHosts(w, hosts)
+}
+
+// Returns the network host allowlist of an arbitrary user, admin authentication required
+func GetForeignUserNetworkHosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	username := mux.Vars(r)["username"]
+	_, exists, err := database.GetUserByUsername(username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "could not list network hosts", Error: "database failure"})
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		Res(w, Response{Success: false, Message: "could not list network hosts", Error: "invalid user"})
+		return
+	}
+	hosts, err := database.ListUserNetworkHosts(username)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "could not list network hosts", Error: "database failure"})
+		return
+	}
+	encodeNetworkHosts(w, hosts)
+}
+
+// Adds or removes a host pattern of an arbitrary user's allowlist, admin authentication required
+// Request: `{"username": "x", "host": "receiver.lan"}` | Response: Response
+func ModifyUserNetworkHostFactory(add bool) http.HandlerFunc {
+	action := "remove"
+	if add {
+		action = "add"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		var request UserNetworkHostRequest
+		if err := decoder.Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+			return
+		}
+		host, err := stdlib.NormalizeHostPattern(request.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: err.Error()})
+			return
+		}
+		_, userExists, err := database.GetUserByUsername(request.Username)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: "database failure"})
+			return
+		}
+		if !userExists {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: "invalid user"})
+			return
+		}
+		var modified bool
+		if add {
+			modified, err = database.AddUserNetworkHost(request.Username, host)
+		} else {
+			modified, err = database.RemoveUserNetworkHost(request.Username, host)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: "database failure"})
+			return
+		}
+		if !modified {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: "allowlist was not modified"})
+			return
+		}
+		Res(w, Response{Success: true, Message: fmt.Sprintf("successfully %sd network host", action)})
+	}
+}
+
+// Returns the network host allowlist of a device driver
+func GetDriverNetworkHosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	vars := mux.Vars(r)
+	_, exists, err := database.GetDeviceDriver(vars["vendorId"], vars["modelId"])
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "could not list network hosts", Error: "database failure"})
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		Res(w, Response{Success: false, Message: "could not list network hosts", Error: "not found: no data is associated to this vendor + model ID"})
+		return
+	}
+	hosts, err := database.ListDriverNetworkHosts(vars["vendorId"], vars["modelId"])
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		Res(w, Response{Success: false, Message: "could not list network hosts", Error: "database failure"})
+		return
+	}
+	encodeNetworkHosts(w, hosts)
+}
+
+// Adds or removes a host pattern of a device driver's allowlist
+// Request: `{"vendorId": "x", "modelId": "y", "host": "*.iot.lan"}` | Response: Response
+func ModifyDriverNetworkHostFactory(add bool) http.HandlerFunc {
+	action := "remove"
+	if add {
+		action = "add"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		var request DriverNetworkHostRequest
+		if err := decoder.Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			Res(w, Response{Success: false, Message: "bad request", Error: "invalid request body"})
+			return
+		}
+		host, err := stdlib.NormalizeHostPattern(request.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: err.Error()})
+			return
+		}
+		_, exists, err := database.GetDeviceDriver(request.VendorId, request.ModelId)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: "database failure"})
+			return
+		}
+		if !exists {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: "not found: no data is associated to this vendor + model ID"})
+			return
+		}
+		var modified bool
+		if add {
+			modified, err = database.AddDriverNetworkHost(request.VendorId, request.ModelId, host)
+		} else {
+			modified, err = database.RemoveDriverNetworkHost(request.VendorId, request.ModelId, host)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: "database failure"})
+			return
+		}
+		if !modified {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			Res(w, Response{Success: false, Message: fmt.Sprintf("could not %s network host", action), Error: "allowlist was not modified"})
+			return
+		}
+		Res(w, Response{Success: true, Message: fmt.Sprintf("successfully %sd network host", action)})
+	}
+}
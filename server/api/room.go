@@ -9,6 +9,7 @@ import (
 
 	"github.com/smarthome-go/smarthome/core"
 	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript"
 	"github.com/smarthome-go/smarthome/server/middleware"
 )
 
@@ -165,6 +166,27 @@ func DeleteRoom(w http.ResponseWriter, r *http.Request) {
 		Res(w, Response{Success: false, Message: "failed to delete room", Error: "invalid room-id"})
 		return
 	}
+	if !isForcedRequest(r) {
+		index, err := homescript.GetDependencyIndex()
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to delete room: could not validate deletion safety", Error: "database failure"})
+			return
+		}
+		dependents, err := index.DependentsOfRoom(request.Id)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			Res(w, Response{Success: false, Message: "failed to delete room: could not validate deletion safety", Error: "database failure"})
+			return
+		}
+		// The devices of the room alone do not block deletion, only things which use them do.
+		for _, dependent := range dependents {
+			if dependent.Kind != homescript.DependentKindDevice {
+				writeDependentsConflict(w, "cannot delete room: safety violation", dependents)
+				return
+			}
+		}
+	}
 	if err := database.DeleteRoom(request.Id); err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		Res(w, Response{Success: false, Message: "failed to delete room", Error: "database failure"})
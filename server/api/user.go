@@ -8,6 +8,7 @@ import (
 	"golang.org/x/exp/utf8string"
 
 	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/homescript"
 	"github.com/smarthome-go/smarthome/core/user"
 	"github.com/smarthome-go/smarthome/server/middleware"
 )
@@ -140,6 +141,8 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		Res(w, Response{Success: false, Message: "failed to delete user", Error: "backend failure"})
 		return
 	}
+	// The quotas of the user were deleted as well
+	homescript.InvalidateQuotaCache()
 	w.WriteHeader(http.StatusCreated)
 	Res(w, Response{Success: true, Message: "successfully deleted user"})
 }
@@ -167,6 +170,8 @@ func DeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
 		Res(w, Response{Success: false, Message: "failed to delete user", Error: "backend failure"})
 		return
 	}
+	// The quotas of the user were deleted as well
+	homescript.InvalidateQuotaCache()
 	w.WriteHeader(http.StatusCreated)
 	Res(w, Response{Success: true, Message: "successfully deleted user"})
 }
@@ -83,6 +83,7 @@ func NewRouter() *mux.Router {
 	r.HandleFunc("/api/room/add", mdl.ApiAuth(mdl.Perm(api.AddRoom, database.PermissionModifyRooms))).Methods("POST")
 	r.HandleFunc("/api/room/modify", mdl.ApiAuth(mdl.Perm(api.ModifyRoomData, database.PermissionModifyRooms))).Methods("PUT")
 	r.HandleFunc("/api/room/delete", mdl.ApiAuth(mdl.Perm(api.DeleteRoom, database.PermissionModifyRooms))).Methods("DELETE")
+	r.HandleFunc("/api/room/dependents/{id}", mdl.ApiAuth(mdl.Perm(api.ListRoomDependents, database.PermissionModifyRooms))).Methods("GET")
 
 	// Devices
 	r.HandleFunc("/api/devices/list/all", api.GetAllDevices).Methods("GET")
@@ -97,7 +98,11 @@ func NewRouter() *mux.Router {
 	r.HandleFunc("/api/devices/add", mdl.ApiAuth(mdl.Perm(api.CreateDevice, database.PermissionModifyRooms))).Methods("POST")
 	r.HandleFunc("/api/devices/modify", mdl.ApiAuth(mdl.Perm(api.ModifyDevice, database.PermissionModifyRooms))).Methods("PUT")
 	r.HandleFunc("/api/devices/delete", mdl.ApiAuth(mdl.Perm(api.DeleteDevice, database.PermissionModifyRooms))).Methods("DELETE")
+	r.HandleFunc("/api/devices/dependents/{id}", mdl.ApiAuth(mdl.Perm(api.ListDeviceDependents, database.PermissionModifyRooms))).Methods("GET")
 	r.HandleFunc("/api/devices/configure", mdl.ApiAuth(mdl.Perm(api.ConfigureDevice, database.PermissionModifyRooms))).Methods("PUT")
+	r.HandleFunc("/api/devices/timeout", mdl.ApiAuth(mdl.Perm(api.SetDeviceTimeout, database.PermissionModifyRooms))).Methods("PUT")
+	r.HandleFunc("/api/devices/breaker/list", mdl.ApiAuth(api.ListDeviceBreakers)).Methods("GET")
+	r.HandleFunc("/api/devices/breaker/reset", mdl.ApiAuth(mdl.Perm(api.ResetDeviceBreaker, database.PermissionModifyRooms))).Methods("POST")
 
 	// TODO: Device actions???
 	r.HandleFunc("/api/devices/action/power", mdl.ApiAuth(mdl.Perm(api.DeviceActionHandlerFactory(driver.DriverActionKindSetPower), database.PermissionPower))).Methods("POST")
@@ -111,6 +116,9 @@ func NewRouter() *mux.Router {
 	r.HandleFunc("/api/camera/list/redacted", mdl.ApiAuth(api.GetAllRedactedCameras)).Methods("GET")
 	r.HandleFunc("/api/camera/list/personal", mdl.ApiAuth(mdl.Perm(api.GetCurrentUserCameras, database.PermissionViewCameras))).Methods("GET")
 	r.HandleFunc("/api/camera/feed/{id}", mdl.ApiAuth(mdl.Perm(api.GetCameraFeed, database.PermissionViewCameras))).Methods("GET")
+	r.HandleFunc("/api/camera/snapshot/list", mdl.ApiAuth(mdl.Perm(api.ListCameraSnapshots, database.PermissionViewCameras))).Methods("GET")
+	r.HandleFunc("/api/camera/snapshot/delete", mdl.ApiAuth(mdl.Perm(api.DeleteCameraSnapshot, database.PermissionViewCameras))).Methods("DELETE")
+	r.HandleFunc("/api/camera/snapshot/{id}", mdl.ApiAuth(mdl.Perm(api.GetCameraSnapshot, database.PermissionViewCameras))).Methods("GET")
 
 	// Normal Permissions
 	r.HandleFunc("/api/user/permissions/add", mdl.ApiAuth(mdl.Perm(api.AddUserPermission, database.PermissionManageUsers))).Methods("POST")
@@ -129,6 +137,12 @@ func NewRouter() *mux.Router {
 	r.HandleFunc("/api/user/permissions/camera/delete", mdl.ApiAuth(mdl.Perm(api.RemoveCameraPermission, database.PermissionManageUsers))).Methods("DELETE")
 	r.HandleFunc("/api/user/permissions/camera/list/user/{username}", mdl.ApiAuth(mdl.Perm(api.GetForeignUserCameraPermission, database.PermissionManageUsers))).Methods("GET")
 
+	// Network host allowlists for Homescript sockets
+	r.HandleFunc("/api/user/permissions/network/add", mdl.ApiAuth(mdl.Perm(api.ModifyUserNetworkHostFactory(true), database.PermissionManageUsers))).Methods("POST")
+	r.HandleFunc("/api/user/permissions/network/delete", mdl.ApiAuth(mdl.Perm(api.ModifyUserNetworkHostFactory(false), database.PermissionManageUsers))).Methods("DELETE")
+	r.HandleFunc("/api/user/permissions/network/list/personal", mdl.ApiAuth(mdl.Perm(api.GetPersonalNetworkHosts, database.PermissionHomescriptNetwork))).Methods("GET")
+	r.HandleFunc("/api/user/permissions/network/list/user/{username}", mdl.ApiAuth(mdl.Perm(api.GetForeignUserNetworkHosts, database.PermissionManageUsers))).Methods("GET")
+
 	// Creating and removing users
 	r.HandleFunc("/api/user/manage/list", mdl.ApiAuth(mdl.Perm(api.ListUsers, database.PermissionManageUsers))).Methods("GET")
 	r.HandleFunc("/api/user/manage/add", mdl.ApiAuth(mdl.Perm(api.AddUser, database.PermissionManageUsers))).Methods("POST")
@@ -182,10 +196,43 @@ func NewRouter() *mux.Router {
 	r.HandleFunc("/api/homescript/lint/live", mdl.ApiAuth(mdl.Perm(api.LintHomescriptString, database.PermissionHomescript))).Methods("POST")
 	r.HandleFunc("/api/homescript/run", mdl.ApiAuth(mdl.Perm(api.RunHomescriptId, database.PermissionHomescript))).Methods("POST")
 	r.HandleFunc("/api/homescript/run/ws", mdl.ApiAuth(mdl.Perm(api.RunHomescriptByIDAsync, database.PermissionHomescript)))
+	r.HandleFunc("/api/homescript/debug/ws", mdl.ApiAuth(mdl.Perm(api.DebugHomescriptByIDAsync, database.PermissionHomescript)))
+	r.HandleFunc("/api/homescript/lsp/ws", mdl.ApiAuth(mdl.Perm(api.HomescriptLanguageServer, database.PermissionHomescript)))
 	r.HandleFunc("/api/homescript/run/live", mdl.ApiAuth(mdl.Perm(api.RunHomescriptString, database.PermissionHomescript))).Methods("POST")
+	r.HandleFunc("/api/homescript/test", mdl.ApiAuth(mdl.Perm(api.TestHomescript, database.PermissionHomescript))).Methods("POST")
 	r.HandleFunc("/api/homescript/jobs", mdl.ApiAuth(mdl.Perm(api.GetHMSJobs, database.PermissionHomescript))).Methods("GET")
 	r.HandleFunc("/api/homescript/kill/job/{id}", mdl.ApiAuth(mdl.Perm(api.KillJobById, database.PermissionHomescript))).Methods("POST")
 	r.HandleFunc("/api/homescript/kill/script/{id}", mdl.ApiAuth(mdl.Perm(api.KillAllHMSIdJobs, database.PermissionHomescript))).Methods("POST")
+	r.HandleFunc("/api/homescript/history/list", mdl.ApiAuth(mdl.Perm(api.ListHomescriptRuns, database.PermissionHomescript))).Methods("POST")
+	r.HandleFunc("/api/homescript/history/of/{id}", mdl.ApiAuth(mdl.Perm(api.ListHomescriptRunsOfScript, database.PermissionHomescript))).Methods("GET")
+	r.HandleFunc("/api/homescript/history/get/{id}", mdl.ApiAuth(mdl.Perm(api.GetHomescriptRun, database.PermissionHomescript))).Methods("GET")
+
+	// Homescript secrets
+	r.HandleFunc("/api/homescript/secret/list", mdl.ApiAuth(mdl.Perm(api.ListHomescriptSecrets, database.PermissionHomescript))).Methods("GET")
+	r.HandleFunc("/api/homescript/secret/add", mdl.ApiAuth(mdl.Perm(api.AddHomescriptSecret, database.PermissionHomescript))).Methods("POST")
+	r.HandleFunc("/api/homescript/secret/modify", mdl.ApiAuth(mdl.Perm(api.ModifyHomescriptSecret, database.PermissionHomescript))).Methods("PUT")
+	r.HandleFunc("/api/homescript/secret/delete", mdl.ApiAuth(mdl.Perm(api.DeleteHomescriptSecret, database.PermissionHomescript))).Methods("DELETE")
+	// Typed Homescript storage
+	r.HandleFunc("/api/homescript/storage/namespaces", mdl.ApiAuth(mdl.Perm(api.ListHomescriptStorageNamespaces, database.PermissionHomescript))).Methods("GET")
+	r.HandleFunc("/api/homescript/storage/entries", mdl.ApiAuth(mdl.Perm(api.ListHomescriptStorageEntries, database.PermissionHomescript))).Methods("GET")
+	r.HandleFunc("/api/homescript/storage/set", mdl.ApiAuth(mdl.Perm(api.SetHomescriptStorageEntry, database.PermissionHomescript))).Methods("PUT")
+	r.HandleFunc("/api/homescript/storage/delete", mdl.ApiAuth(mdl.Perm(api.DeleteHomescriptStorageEntry, database.PermissionHomescript))).Methods("DELETE")
+	// Homescript dependency index
+	r.HandleFunc("/api/homescript/dependencies/list", mdl.ApiAuth(mdl.Perm(api.ListHomescriptDependencies, database.PermissionHomescript))).Methods("GET")
+	r.HandleFunc("/api/homescript/dependencies/storage/{key}", mdl.ApiAuth(mdl.Perm(api.ListStorageKeyDependents, database.PermissionHomescript))).Methods("GET")
+	// Homescript libraries
+	r.HandleFunc("/api/homescript/library/list", mdl.ApiAuth(mdl.Perm(api.ListHomescriptLibraries, database.PermissionHomescript))).Methods("GET")
+	r.HandleFunc("/api/homescript/library/add", mdl.ApiAuth(mdl.Perm(api.CreateHomescriptLibrary, database.PermissionHomescript))).Methods("POST")
+	r.HandleFunc("/api/homescript/library/publish", mdl.ApiAuth(mdl.Perm(api.PublishHomescriptLibrary, database.PermissionHomescript))).Methods("POST")
+	r.HandleFunc("/api/homescript/library/access", mdl.ApiAuth(mdl.Perm(api.SetHomescriptLibraryAccess, database.PermissionHomescript))).Methods("PUT")
+	r.HandleFunc("/api/homescript/library/delete", mdl.ApiAuth(mdl.Perm(api.DeleteHomescriptLibrary, database.PermissionHomescript))).Methods("DELETE")
+	r.HandleFunc("/api/homescript/library/versions/{name}", mdl.ApiAuth(mdl.Perm(api.ListHomescriptLibraryVersions, database.PermissionHomescript))).Methods("GET")
+	// Homescript webhooks
+	r.HandleFunc("/api/homescript/webhook/list", mdl.ApiAuth(mdl.Perm(api.ListHomescriptWebhooks, database.PermissionHomescript))).Methods("GET")
+	r.HandleFunc("/api/homescript/webhook/add", mdl.ApiAuth(mdl.Perm(api.CreateHomescriptWebhook, database.PermissionHomescript))).Methods("POST")
+	r.HandleFunc("/api/homescript/webhook/delete", mdl.ApiAuth(mdl.Perm(api.DeleteHomescriptWebhook, database.PermissionHomescript))).Methods("DELETE")
+	// Does not require authentication as the id of the webhook acts as a secret, the method filter is applied by the handler
+	r.HandleFunc("/api/webhook/{id}", api.RunHomescriptWebhook)
 
 	// Homescript Arguments
 	r.HandleFunc("/api/homescript/arg/add", mdl.ApiAuth(mdl.Perm(api.CreateNewHomescriptArg, database.PermissionHomescript))).Methods("POST")
@@ -199,12 +246,14 @@ func NewRouter() *mux.Router {
 	r.HandleFunc("/api/automation/add", mdl.ApiAuth(mdl.Perm(api.CreateNewAutomation, database.PermissionAutomation))).Methods("POST")
 	r.HandleFunc("/api/automation/delete", mdl.ApiAuth(mdl.Perm(api.RemoveAutomation, database.PermissionAutomation))).Methods("DELETE")
 	r.HandleFunc("/api/automation/modify", mdl.ApiAuth(mdl.Perm(api.ModifyAutomation, database.PermissionAutomation))).Methods("PUT")
+	r.HandleFunc("/api/automation/runs/{id}", mdl.ApiAuth(mdl.Perm(api.ListAutomationRuns, database.PermissionAutomation))).Methods("GET")
 
 	// Scheduler
 	r.HandleFunc("/api/scheduler/list/personal", mdl.ApiAuth(mdl.Perm(api.GetUserSchedules, database.PermissionScheduler))).Methods("GET")
 	r.HandleFunc("/api/scheduler/add", mdl.ApiAuth(mdl.Perm(api.CreateNewSchedule, database.PermissionScheduler))).Methods("POST")
 	r.HandleFunc("/api/scheduler/delete", mdl.ApiAuth(mdl.Perm(api.RemoveSchedule, database.PermissionScheduler))).Methods("DELETE")
 	r.HandleFunc("/api/scheduler/modify", mdl.ApiAuth(mdl.Perm(api.ModifySchedule, database.PermissionScheduler))).Methods("PUT")
+	r.HandleFunc("/api/scheduler/runs/{id}", mdl.ApiAuth(mdl.Perm(api.ListScheduleRuns, database.PermissionScheduler))).Methods("GET")
 
 	r.HandleFunc("/api/scheduler/state/personal", mdl.ApiAuth(mdl.Perm(api.SetCurrentUserSchedulerEnabled, database.PermissionScheduler))).Methods("PUT")
 	r.HandleFunc("/api/scheduler/state/user", mdl.ApiAuth(mdl.Perm(api.SetUserSchedulerEnabled, database.PermissionManageUsers))).Methods("PUT")
@@ -242,6 +291,23 @@ func NewRouter() *mux.Router {
 
 	r.HandleFunc("/api/system/mqtt/config", mdl.ApiAuth(mdl.Perm(api.UpdateMQTTConfig, database.PermissionSystemConfig))).Methods("PUT")
 	r.HandleFunc("/api/system/mqtt/status", mdl.ApiAuth(mdl.Perm(api.GetMQTTStatus, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/mqtt/clients", mdl.ApiAuth(mdl.Perm(api.GetMQTTBrokerClients, database.PermissionSystemConfig))).Methods("GET")
+
+	// Home Assistant exporter
+	r.HandleFunc("/api/system/homeassistant/config", mdl.ApiAuth(mdl.Perm(api.GetHomeAssistantConfig, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/homeassistant/config", mdl.ApiAuth(mdl.Perm(api.SetHomeAssistantConfig, database.PermissionSystemConfig))).Methods("PUT")
+	r.HandleFunc("/api/system/homeassistant/republish", mdl.ApiAuth(mdl.Perm(api.RepublishHomeAssistantDevices, database.PermissionSystemConfig))).Methods("POST")
+	r.HandleFunc("/api/system/mqtt/bridge/config", mdl.ApiAuth(mdl.Perm(api.GetMqttBridgeConfig, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/mqtt/bridge/config", mdl.ApiAuth(mdl.Perm(api.SetMqttBridgeConfig, database.PermissionSystemConfig))).Methods("PUT")
+
+	// Homescript quotas
+	r.HandleFunc("/api/system/homescript/quota/list", mdl.ApiAuth(mdl.Perm(api.ListHomescriptQuotas, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/homescript/quota/set", mdl.ApiAuth(mdl.Perm(api.SetHomescriptQuota, database.PermissionSystemConfig))).Methods("PUT")
+	r.HandleFunc("/api/system/homescript/quota/delete", mdl.ApiAuth(mdl.Perm(api.DeleteHomescriptQuota, database.PermissionSystemConfig))).Methods("DELETE")
+
+	// Homescript execution history
+	r.HandleFunc("/api/system/homescript/history/retention", mdl.ApiAuth(mdl.Perm(api.GetHomescriptRunRetention, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/homescript/history/retention", mdl.ApiAuth(mdl.Perm(api.SetHomescriptRunRetention, database.PermissionSystemConfig))).Methods("PUT")
 
 	// Hardware node management
 	// r.HandleFunc("/api/system/hardware/node/list", mdl.ApiAuth(mdl.Perm(api.ListHardwareNodes, database.PermissionSystemConfig))).Methods("GET")
@@ -258,7 +324,21 @@ func NewRouter() *mux.Router {
 	r.HandleFunc("/api/system/hardware/driver/modify", mdl.ApiAuth(mdl.Perm(api.ModifyDeviceDriver, database.PermissionSystemConfig))).Methods("PUT")
 	r.HandleFunc("/api/system/hardware/driver/configure", mdl.ApiAuth(mdl.Perm(api.ConfigureDeviceDriver, database.PermissionSystemConfig))).Methods("PUT")
 	r.HandleFunc("/api/system/hardware/driver/delete", mdl.ApiAuth(mdl.Perm(api.DeleteDeviceDriver, database.PermissionSystemConfig))).Methods("DELETE")
+	r.HandleFunc("/api/system/hardware/driver/dependents/{vendorId}/{modelId}", mdl.ApiAuth(mdl.Perm(api.ListDeviceDriverDependents, database.PermissionSystemConfig))).Methods("GET")
 	r.HandleFunc("/api/system/hardware/driver/reload", mdl.ApiAuth(mdl.Perm(api.ReloadDeviceDriver, database.PermissionSystemConfig))).Methods("POST")
+	r.HandleFunc("/api/system/hardware/driver/network/list/{vendorId}/{modelId}", mdl.ApiAuth(mdl.Perm(api.GetDriverNetworkHosts, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/hardware/driver/network/add", mdl.ApiAuth(mdl.Perm(api.ModifyDriverNetworkHostFactory(true), database.PermissionSystemConfig))).Methods("POST")
+	r.HandleFunc("/api/system/hardware/driver/network/delete", mdl.ApiAuth(mdl.Perm(api.ModifyDriverNetworkHostFactory(false), database.PermissionSystemConfig))).Methods("DELETE")
+	r.HandleFunc("/api/system/hardware/driver/package/export", mdl.ApiAuth(mdl.Perm(api.ExportDriverPackage, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/hardware/driver/package/import", mdl.ApiAuth(mdl.Perm(api.ImportDriverPackage, database.PermissionSystemConfig))).Methods("POST")
+	r.HandleFunc("/api/system/hardware/driver/bundled/list", mdl.ApiAuth(mdl.Perm(api.ListBundledDrivers, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/hardware/driver/bundled/install", mdl.ApiAuth(mdl.Perm(api.InstallBundledDriver, database.PermissionSystemConfig))).Methods("POST")
+	r.HandleFunc("/api/system/hardware/driver/upgrade", mdl.ApiAuth(mdl.Perm(api.UpgradeDeviceDriver, database.PermissionSystemConfig))).Methods("POST")
+	r.HandleFunc("/api/system/hardware/driver/snapshot/list/{vendorId}/{modelId}", mdl.ApiAuth(mdl.Perm(api.ListDeviceDriverSnapshots, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/hardware/driver/snapshot/rollback", mdl.ApiAuth(mdl.Perm(api.RollbackDeviceDriver, database.PermissionSystemConfig))).Methods("POST")
+	r.HandleFunc("/api/system/hardware/driver/policy/{vendorId}/{modelId}", mdl.ApiAuth(mdl.Perm(api.GetDriverInvocationPolicy, database.PermissionSystemConfig))).Methods("GET")
+	r.HandleFunc("/api/system/hardware/driver/policy", mdl.ApiAuth(mdl.Perm(api.SetDriverInvocationPolicy, database.PermissionSystemConfig))).Methods("PUT")
+	r.HandleFunc("/api/system/hardware/driver/simulate", mdl.ApiAuth(mdl.Perm(api.SimulateDeviceDriver, database.PermissionSystemConfig))).Methods("POST")
 	// TODO: add driver support
 
 	// Logging
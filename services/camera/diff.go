@@ -0,0 +1,121 @@
+package camera
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"sync"
+)
+
+// Frames are compared after being scaled down to a grayscale thumbnail of this size
+// This makes the comparison cheap and insensitive to sensor noise and compression artifacts
+const thumbnailSize = 32
+
+// A downscaled grayscale version of a frame, each value is the average luminance of a region
+type thumbnail [thumbnailSize * thumbnailSize]float64
+
+// Identifies the previous frame of a camera as seen by an observer (usually a user)
+type frameKey struct {
+	observer string
+	cameraId string
+}
+
+// The last thumbnail of every observer and camera, used by `CompareWithPreviousFrame`
+var previousFrames = struct {
+	sync.Mutex
+	thumbnails map[frameKey]thumbnail
+}{thumbnails: make(map[frameKey]thumbnail)}
+
+func createThumbnail(data []byte) (thumbnail, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return thumbnail{}, fmt.Errorf("could not decode frame (only PNG and JPEG frames can be compared): %s", err.Error())
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() < thumbnailSize || bounds.Dy() < thumbnailSize {
+		return thumbnail{}, fmt.Errorf("frame is too small: expected at least %dx%d pixels", thumbnailSize, thumbnailSize)
+	}
+
+	var sums thumbnail
+	var counts [thumbnailSize * thumbnailSize]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := (y - bounds.Min.Y) * thumbnailSize / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			col := (x - bounds.Min.X) * thumbnailSize / bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			// ITU-R BT.601 luma, the channels are 16-bit
+			luma := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xFFFF
+			sums[row*thumbnailSize+col] += luma
+			counts[row*thumbnailSize+col]++
+		}
+	}
+
+	for idx := range sums {
+		sums[idx] /= float64(counts[idx])
+	}
+
+	return sums, nil
+}
+
+// Returns the mean absolute luminance difference of two thumbnails between 0 (identical) and 1 (inverted)
+func (self thumbnail) difference(other thumbnail) float64 {
+	var sum float64
+	for idx := range self {
+		sum += math.Abs(self[idx] - other[idx])
+	}
+	return sum / float64(len(self))
+}
+
+// Computes how much two frames differ, the result is between 0 (identical) and 1 (inverted)
+// Both frames have to be PNG or JPEG images, they may have different resolutions
+func FrameDifference(a []byte, b []byte) (float64, error) {
+	thumbA, err := createThumbnail(a)
+	if err != nil {
+		return 0, err
+	}
+	thumbB, err := createThumbnail(b)
+	if err != nil {
+		return 0, err
+	}
+	return thumbA.difference(thumbB), nil
+}
+
+// Compares a frame with the previous frame of the same observer and camera and remembers the new frame
+// Observers are tracked separately so that scripts of different users do not influence each other
+// If there is no previous frame, `hasPrevious` is false
+func CompareWithPreviousFrame(observer string, cameraId string, data []byte) (score float64, hasPrevious bool, err error) {
+	key := frameKey{observer: observer, cameraId: cameraId}
+
+	current, err := createThumbnail(data)
+	if err != nil {
+		return 0, false, err
+	}
+
+	previousFrames.Lock()
+	defer previousFrames.Unlock()
+
+	previous, hasPrevious := previousFrames.thumbnails[key]
+	previousFrames.thumbnails[key] = current
+
+	if !hasPrevious {
+		return 0, false, nil
+	}
+
+	return current.difference(previous), true, nil
+}
+
+// Forgets the previous frames of a camera, used when deleting a camera
+func ForgetPreviousFrames(cameraId string) {
+	previousFrames.Lock()
+	defer previousFrames.Unlock()
+
+	for key := range previousFrames.thumbnails {
+		if key.cameraId == cameraId {
+			delete(previousFrames.thumbnails, key)
+		}
+	}
+}
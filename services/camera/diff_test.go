@@ -0,0 +1,83 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeFrame(t *testing.T, width int, height int, fill func(x, y int) uint8) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: fill(x, y)})
+		}
+	}
+	var buffer bytes.Buffer
+	assert.NoError(t, png.Encode(&buffer, img))
+	return buffer.Bytes()
+}
+
+func TestFrameDifference(t *testing.T) {
+	black := encodeFrame(t, 64, 48, func(_, _ int) uint8 { return 0 })
+	white := encodeFrame(t, 128, 96, func(_, _ int) uint8 { return 255 })
+	// The left half is white, the right half is black
+	half := encodeFrame(t, 64, 48, func(x, _ int) uint8 {
+		if x < 32 {
+			return 255
+		}
+		return 0
+	})
+
+	score, err := FrameDifference(black, black)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, score)
+
+	// Different resolutions can be compared
+	score, err = FrameDifference(black, white)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1.0, score, 0.0001)
+
+	score, err = FrameDifference(black, half)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.5, score, 0.0001)
+
+	_, err = FrameDifference(black, []byte("not an image"))
+	assert.Error(t, err)
+
+	_, err = FrameDifference(black, encodeFrame(t, 16, 16, func(_, _ int) uint8 { return 0 }))
+	assert.Error(t, err)
+}
+
+func TestCompareWithPreviousFrame(t *testing.T) {
+	black := encodeFrame(t, 64, 48, func(_, _ int) uint8 { return 0 })
+	white := encodeFrame(t, 64, 48, func(_, _ int) uint8 { return 255 })
+
+	_, hasPrevious, err := CompareWithPreviousFrame("admin", "door", black)
+	assert.NoError(t, err)
+	assert.False(t, hasPrevious)
+
+	// Other observers have their own previous frame
+	_, hasPrevious, err = CompareWithPreviousFrame("other", "door", white)
+	assert.NoError(t, err)
+	assert.False(t, hasPrevious)
+
+	score, hasPrevious, err := CompareWithPreviousFrame("admin", "door", white)
+	assert.NoError(t, err)
+	assert.True(t, hasPrevious)
+	assert.InDelta(t, 1.0, score, 0.0001)
+
+	score, hasPrevious, err = CompareWithPreviousFrame("admin", "door", white)
+	assert.NoError(t, err)
+	assert.True(t, hasPrevious)
+	assert.Equal(t, 0.0, score)
+
+	ForgetPreviousFrames("door")
+	_, hasPrevious, err = CompareWithPreviousFrame("admin", "door", white)
+	assert.NoError(t, err)
+	assert.False(t, hasPrevious)
+}
@@ -0,0 +1,344 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+)
+
+//
+// Discovery messages.
+// Every capability of a device is mapped onto one or more Home Assistant entities:
+// power becomes a switch and a power draw sensor, every dimmable becomes a number and every sensor reading a sensor.
+// The topics of a device are located below `<base>/<device-id>/`.
+//
+
+const (
+	payloadOn  = "ON"
+	payloadOff = "OFF"
+
+	availabilityOnline  = "online"
+	availabilityOffline = "offline"
+)
+
+type discoveryDevice struct {
+	Identifiers   []string `json:"identifiers"`
+	Name          string   `json:"name"`
+	Manufacturer  string   `json:"manufacturer"`
+	Model         string   `json:"model"`
+	SuggestedArea string   `json:"suggested_area,omitempty"`
+}
+
+type discoveryAvailability struct {
+	Topic string `json:"topic"`
+}
+
+// The configuration of a single entity, see https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery.
+type discoveryConfig struct {
+	Name              string                  `json:"name"`
+	UniqueID          string                  `json:"unique_id"`
+	ObjectID          string                  `json:"object_id"`
+	StateTopic        string                  `json:"state_topic"`
+	CommandTopic      string                  `json:"command_topic,omitempty"`
+	Availability      []discoveryAvailability `json:"availability"`
+	AvailabilityMode  string                  `json:"availability_mode"`
+	Device            discoveryDevice         `json:"device"`
+	PayloadOn         string                  `json:"payload_on,omitempty"`
+	PayloadOff        string                  `json:"payload_off,omitempty"`
+	Min               *int64                  `json:"min,omitempty"`
+	Max               *int64                  `json:"max,omitempty"`
+	Mode              string                  `json:"mode,omitempty"`
+	UnitOfMeasurement string                  `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string                  `json:"device_class,omitempty"`
+	StateClass        string                  `json:"state_class,omitempty"`
+}
+
+type entity struct {
+	component string
+	objectID  string
+	config    discoveryConfig
+	// Is empty if the current state is unknown.
+	state string
+}
+
+var slugReplacer = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Converts a label into a string which can be used in topics and entity IDs.
+func slug(label string) string {
+	result := strings.Trim(slugReplacer.ReplaceAllString(strings.ToLower(label), "_"), "_")
+	if result == "" {
+		return "unnamed"
+	}
+	return result
+}
+
+// Assigns a unique slug to every label, labels which map onto the same slug receive a numeric suffix.
+func uniqueSlugs(labels []string) []string {
+	slugs := make([]string, len(labels))
+	seen := make(map[string]uint)
+
+	for idx, label := range labels {
+		base := slug(label)
+		seen[base]++
+
+		if seen[base] > 1 {
+			slugs[idx] = fmt.Sprintf("%s_%d", base, seen[base])
+			continue
+		}
+
+		slugs[idx] = base
+	}
+
+	return slugs
+}
+
+func deviceTopic(config database.HomeAssistantConfig, deviceID string) string {
+	return fmt.Sprintf("%s/%s", config.BaseTopic, deviceID)
+}
+
+// Whether the exporter is running, Home Assistant marks every entity as unavailable otherwise.
+func statusTopic(config database.HomeAssistantConfig) string {
+	return fmt.Sprintf("%s/status", config.BaseTopic)
+}
+
+// Whether the driver of a device currently works.
+func availabilityTopic(config database.HomeAssistantConfig, deviceID string) string {
+	return fmt.Sprintf("%s/availability", deviceTopic(config, deviceID))
+}
+
+// Home Assistant publishes `online` to this topic after it has started.
+func birthTopic(config database.HomeAssistantConfig) string {
+	return fmt.Sprintf("%s/status", config.DiscoveryPrefix)
+}
+
+func discoveryTopic(config database.HomeAssistantConfig, deviceID string, item entity) string {
+	return fmt.Sprintf("%s/%s/smarthome_%s/%s/config", config.DiscoveryPrefix, item.component, deviceID, item.objectID)
+}
+
+// Returns the device a topic of the exporter refers to, see `DeviceOfTopic`.
+// All topics below the base topic are reserved, discovery topics only if they belong to an exported device.
+func deviceOfTopic(config database.HomeAssistantConfig, topic string) (deviceID string, reserved bool) {
+	if topic == config.BaseTopic || topic == statusTopic(config) {
+		return "", true
+	}
+
+	if rest, found := strings.CutPrefix(topic, config.BaseTopic+"/"); found {
+		deviceID, _, _ = strings.Cut(rest, "/")
+		return deviceID, true
+	}
+
+	rest, found := strings.CutPrefix(topic, config.DiscoveryPrefix+"/")
+	if !found {
+		return "", false
+	}
+
+	// Discovery topics have the form `<prefix>/<component>/smarthome_<id>/<object>/config`.
+	levels := strings.Split(rest, "/")
+	if len(levels) < 2 {
+		return "", false
+	}
+
+	if id, found := strings.CutPrefix(levels[1], "smarthome_"); found {
+		return id, true
+	}
+
+	return "", false
+}
+
+func formatSensorValue(value any) string {
+	switch value := value.(type) {
+	case bool:
+		if value {
+			return payloadOn
+		}
+		return payloadOff
+	case string:
+		return value
+	default:
+		marshaled, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(marshaled)
+	}
+}
+
+// Returns the entities of a device along with their current state.
+// If `labels` is not nil, it receives the label of every dimmable slug so that commands can be mapped back.
+func deviceEntities(
+	config database.HomeAssistantConfig,
+	device driver.RichDevice,
+	roomName string,
+	labels map[string]string,
+) []entity {
+	deviceID := device.Shallow.ID
+	capabilities := device.Extractions.Config.Capabilities
+	base := deviceTopic(config, deviceID)
+
+	// If the driver failed, the reported state is not meaningful.
+	knownState := len(device.Extractions.HmsErrors) == 0
+
+	newConfig := func(name string, objectID string, stateTopic string) discoveryConfig {
+		return discoveryConfig{
+			Name:       name,
+			UniqueID:   fmt.Sprintf("smarthome_%s_%s", deviceID, objectID),
+			ObjectID:   fmt.Sprintf("%s_%s", deviceID, objectID),
+			StateTopic: stateTopic,
+			Availability: []discoveryAvailability{
+				{Topic: statusTopic(config)},
+				{Topic: availabilityTopic(config, deviceID)},
+			},
+			AvailabilityMode: "all",
+			Device: discoveryDevice{
+				Identifiers:   []string{fmt.Sprintf("smarthome_%s", deviceID)},
+				Name:          device.Shallow.Name,
+				Manufacturer:  device.Shallow.DriverVendorID,
+				Model:         device.Shallow.DriverModelID,
+				SuggestedArea: roomName,
+			},
+		}
+	}
+
+	stateIfKnown := func(state string) string {
+		if !knownState {
+			return ""
+		}
+		return state
+	}
+
+	entities := make([]entity, 0)
+
+	if capabilities.Has(driver.DeviceCapabilityPower) {
+		power := newConfig("Power", "power", fmt.Sprintf("%s/power/state", base))
+		power.CommandTopic = fmt.Sprintf("%s/power/set", base)
+		power.PayloadOn = payloadOn
+		power.PayloadOff = payloadOff
+
+		state := payloadOff
+		if device.Extractions.PowerInformation.State {
+			state = payloadOn
+		}
+
+		entities = append(entities, entity{
+			component: "switch",
+			objectID:  "power",
+			config:    power,
+			state:     stateIfKnown(state),
+		})
+
+		powerDraw := newConfig("Power Draw", "power_draw", fmt.Sprintf("%s/power_draw/state", base))
+		powerDraw.UnitOfMeasurement = "W"
+		powerDraw.DeviceClass = "power"
+		powerDraw.StateClass = "measurement"
+
+		entities = append(entities, entity{
+			component: "sensor",
+			objectID:  "power_draw",
+			config:    powerDraw,
+			state:     stateIfKnown(fmt.Sprint(device.Extractions.PowerInformation.PowerDrawWatts)),
+		})
+	}
+
+	if capabilities.Has(driver.DeviceCapabilityDimmable) {
+		dimmables := device.Extractions.DimmableInformation
+
+		dimLabels := make([]string, len(dimmables))
+		for idx, dimmable := range dimmables {
+			dimLabels[idx] = dimmable.Label
+		}
+
+		for idx, dimSlug := range uniqueSlugs(dimLabels) {
+			dimmable := dimmables[idx]
+			objectID := fmt.Sprintf("dim_%s", dimSlug)
+
+			number := newConfig(dimmable.Label, objectID, fmt.Sprintf("%s/dim/%s/state", base, dimSlug))
+			number.CommandTopic = fmt.Sprintf("%s/dim/%s/set", base, dimSlug)
+			lower, upper := dimmable.Range.Lower, dimmable.Range.Upper
+			number.Min = &lower
+			number.Max = &upper
+			number.Mode = "slider"
+
+			entities = append(entities, entity{
+				component: "number",
+				objectID:  objectID,
+				config:    number,
+				state:     stateIfKnown(fmt.Sprint(dimmable.Value)),
+			})
+
+			if labels != nil {
+				labels[dimSlug] = dimmable.Label
+			}
+		}
+	}
+
+	if capabilities.Has(driver.DeviceCapabilitySensor) {
+		readings := device.Extractions.SensorReadings
+
+		sensorLabels := make([]string, len(readings))
+		for idx, reading := range readings {
+			sensorLabels[idx] = reading.Label
+		}
+
+		for idx, sensorSlug := range uniqueSlugs(sensorLabels) {
+			reading := readings[idx]
+			objectID := fmt.Sprintf("sensor_%s", sensorSlug)
+
+			sensor := newConfig(reading.Label, objectID, fmt.Sprintf("%s/sensor/%s/state", base, sensorSlug))
+			component := "sensor"
+
+			if _, isBool := reading.Value.(bool); isBool {
+				component = "binary_sensor"
+				sensor.PayloadOn = payloadOn
+				sensor.PayloadOff = payloadOff
+			} else {
+				sensor.UnitOfMeasurement = reading.Unit
+			}
+
+			entities = append(entities, entity{
+				component: component,
+				objectID:  objectID,
+				config:    sensor,
+				state:     stateIfKnown(formatSensorValue(reading.Value)),
+			})
+		}
+	}
+
+	return entities
+}
+
+type commandKind uint8
+
+const (
+	commandPower commandKind = iota
+	commandDim
+)
+
+type command struct {
+	kind     commandKind
+	deviceID string
+	// The slug of the dimmable, only used by dim commands.
+	dimSlug string
+}
+
+// Parses a command topic which is either `<base>/<device>/power/set` or `<base>/<device>/dim/<slug>/set`.
+func parseCommandTopic(config database.HomeAssistantConfig, topic string) (command, bool) {
+	rest, found := strings.CutPrefix(topic, config.BaseTopic+"/")
+	if !found {
+		return command{}, false
+	}
+
+	segments := strings.Split(rest, "/")
+
+	switch {
+	case len(segments) == 3 && segments[1] == "power" && segments[2] == "set":
+		return command{kind: commandPower, deviceID: segments[0]}, true
+	case len(segments) == 4 && segments[1] == "dim" && segments[3] == "set":
+		return command{kind: commandDim, deviceID: segments[0], dimSlug: segments[2]}, true
+	default:
+		return command{}, false
+	}
+}
@@ -0,0 +1,188 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+var testConfig = database.HomeAssistantConfig{
+	Enabled:             true,
+	DiscoveryPrefix:     "homeassistant",
+	BaseTopic:           "smarthome",
+	ServiceUsername:     nil,
+	PollIntervalSeconds: 10,
+}
+
+func TestSlug(t *testing.T) {
+	table := []struct {
+		Label    string
+		Expected string
+	}{
+		{Label: "Brightness", Expected: "brightness"},
+		{Label: "Color Temperature", Expected: "color_temperature"},
+		{Label: " CO2 (ppm) ", Expected: "co2_ppm"},
+		{Label: "°C", Expected: "c"},
+		{Label: "!!!", Expected: "unnamed"},
+	}
+
+	for _, test := range table {
+		assert.Equal(t, test.Expected, slug(test.Label))
+	}
+
+	assert.Equal(t, []string{"power", "power_2", "voltage", "power_3"}, uniqueSlugs([]string{"Power", "power", "Voltage", "POWER"}))
+}
+
+func TestParseCommandTopic(t *testing.T) {
+	table := []struct {
+		Topic    string
+		Expected command
+		Valid    bool
+	}{
+		{Topic: "smarthome/lamp/power/set", Expected: command{kind: commandPower, deviceID: "lamp"}, Valid: true},
+		{Topic: "smarthome/lamp/dim/brightness/set", Expected: command{kind: commandDim, deviceID: "lamp", dimSlug: "brightness"}, Valid: true},
+		{Topic: "smarthome/lamp/power/state", Valid: false},
+		{Topic: "smarthome/lamp/dim/set", Valid: false},
+		{Topic: "other/lamp/power/set", Valid: false},
+		{Topic: "smarthomex/lamp/power/set", Valid: false},
+	}
+
+	for _, test := range table {
+		cmd, valid := parseCommandTopic(testConfig, test.Topic)
+		assert.Equal(t, test.Valid, valid, test.Topic)
+		if test.Valid {
+			assert.Equal(t, test.Expected, cmd, test.Topic)
+		}
+	}
+}
+
+func TestDeviceOfTopic(t *testing.T) {
+	table := []struct {
+		Topic    string
+		DeviceID string
+		Reserved bool
+	}{
+		{Topic: "smarthome/lamp/power/set", DeviceID: "lamp", Reserved: true},
+		{Topic: "smarthome/lamp/availability", DeviceID: "lamp", Reserved: true},
+		{Topic: "smarthome/status", DeviceID: "", Reserved: true},
+		{Topic: "homeassistant/switch/smarthome_lamp/power/config", DeviceID: "lamp", Reserved: true},
+		{Topic: "homeassistant/switch/tasmota_lamp/power/config", Reserved: false},
+		{Topic: "homeassistant/status", Reserved: false},
+		{Topic: "smarthomex/lamp/power/set", Reserved: false},
+	}
+
+	for _, test := range table {
+		deviceID, reserved := deviceOfTopic(testConfig, test.Topic)
+		assert.Equal(t, test.Reserved, reserved, test.Topic)
+		assert.Equal(t, test.DeviceID, deviceID, test.Topic)
+	}
+}
+
+func testDevice() driver.RichDevice {
+	return driver.RichDevice{
+		Shallow: driver.ShallowDevice{
+			DeviceType:     database.DEVICE_TYPE_OUTPUT,
+			ID:             "lamp",
+			Name:           "Desk Lamp",
+			RoomID:         "office",
+			DriverVendorID: "tasmota",
+			DriverModelID:  "light",
+		},
+		Extractions: driver.DeviceExtractions{
+			HmsErrors: make([]types.HmsError, 0),
+			Config: driver.ConfigInfoWrapperDevice{
+				Capabilities: driver.CapabilitySet[driver.DeviceCapability]{
+					driver.DeviceCapabilityPower,
+					driver.DeviceCapabilityDimmable,
+					driver.DeviceCapabilitySensor,
+				},
+			},
+			PowerInformation: driver.DevicePowerInformation{State: true, PowerDrawWatts: 12},
+			DimmableInformation: []driver.DriverActionReportDimOutput{
+				{Value: 80, Label: "Brightness", Range: driver.DriverActionReportRange{Lower: 0, Upper: 100}},
+			},
+			SensorReadings: []driver.DriverActionReportSensorReadingsOutput{
+				{Label: "Temperature", Value: 21.5, Unit: "°C"},
+				{Label: "Overheated", Value: false, Unit: ""},
+			},
+		},
+	}
+}
+
+func TestDeviceEntities(t *testing.T) {
+	labels := make(map[string]string)
+	entities := deviceEntities(testConfig, testDevice(), "Office", labels)
+
+	byObjectID := make(map[string]entity)
+	for _, item := range entities {
+		byObjectID[item.objectID] = item
+	}
+	assert.Len(t, byObjectID, 5)
+
+	power := byObjectID["power"]
+	assert.Equal(t, "switch", power.component)
+	assert.Equal(t, "ON", power.state)
+	assert.Equal(t, "smarthome/lamp/power/set", power.config.CommandTopic)
+	assert.Equal(t, "homeassistant/switch/smarthome_lamp/power/config", discoveryTopic(testConfig, "lamp", power))
+
+	assert.Equal(t, "12", byObjectID["power_draw"].state)
+	assert.Equal(t, "W", byObjectID["power_draw"].config.UnitOfMeasurement)
+
+	brightness := byObjectID["dim_brightness"]
+	assert.Equal(t, "number", brightness.component)
+	assert.Equal(t, "80", brightness.state)
+	assert.Equal(t, int64(0), *brightness.config.Min)
+	assert.Equal(t, int64(100), *brightness.config.Max)
+	assert.Equal(t, "smarthome/lamp/dim/brightness/set", brightness.config.CommandTopic)
+	assert.Equal(t, map[string]string{"brightness": "Brightness"}, labels)
+
+	temperature := byObjectID["sensor_temperature"]
+	assert.Equal(t, "sensor", temperature.component)
+	assert.Equal(t, "21.5", temperature.state)
+	assert.Equal(t, "°C", temperature.config.UnitOfMeasurement)
+	assert.Empty(t, temperature.config.CommandTopic)
+
+	overheated := byObjectID["sensor_overheated"]
+	assert.Equal(t, "binary_sensor", overheated.component)
+	assert.Equal(t, "OFF", overheated.state)
+
+	// Every entity belongs to the same Home Assistant device.
+	var marshaled map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(marshalConfig(power.config)), &marshaled))
+	assert.Equal(t, "smarthome_lamp_power", marshaled["unique_id"])
+	assert.Equal(t, map[string]any{
+		"identifiers":    []any{"smarthome_lamp"},
+		"name":           "Desk Lamp",
+		"manufacturer":   "tasmota",
+		"model":          "light",
+		"suggested_area": "Office",
+	}, marshaled["device"])
+	assert.NotContains(t, marshaled, "min")
+}
+
+func TestDeviceEntitiesWithoutState(t *testing.T) {
+	device := testDevice()
+	device.Extractions.HmsErrors = []types.HmsError{{}}
+
+	for _, item := range deviceEntities(testConfig, device, "", nil) {
+		assert.Empty(t, item.state, item.objectID)
+	}
+
+	device = testDevice()
+	device.Extractions.Config.Capabilities = driver.CapabilitySet[driver.DeviceCapability]{driver.DeviceCapabilitySensor}
+	assert.Len(t, deviceEntities(testConfig, device, "", nil), 2)
+}
+
+func TestValidateTopicPrefix(t *testing.T) {
+	assert.NoError(t, validateTopicPrefix("base topic", "home/smarthome"))
+	assert.Error(t, validateTopicPrefix("base topic", ""))
+	assert.Error(t, validateTopicPrefix("base topic", "smarthome/#"))
+	assert.Error(t, validateTopicPrefix("base topic", "smarthome/+/devices"))
+	assert.Error(t, validateTopicPrefix("base topic", "/smarthome"))
+	assert.Error(t, validateTopicPrefix("base topic", "smarthome/"))
+}
@@ -0,0 +1,331 @@
+package homeassistant
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
+	"github.com/smarthome-go/smarthome/services/mqttdevices"
+)
+
+//
+// Exporter.
+// The exporter polls all devices of its service user and publishes discovery configurations and states which changed.
+// Devices whose reports are invalidated (after actions or MQTT messages) are published immediately.
+// Only the goroutine of the exporter publishes, commands from Home Assistant are executed in their own goroutines.
+//
+
+type exporter struct {
+	*mqttdevices.Loop
+	config database.HomeAssistantConfig
+
+	// The last payload of every topic, only changes are published.
+	published map[string]string
+	// The topics of every exported device.
+	deviceTopics map[string][]string
+	subscribed   []string
+
+	// Maps the dimmable slugs of every device to their labels, is also used by command handlers.
+	labels     map[string]map[string]string
+	labelsLock sync.RWMutex
+}
+
+func newExporter(config database.HomeAssistantConfig) *exporter {
+	return &exporter{
+		Loop:         mqttdevices.NewLoop(),
+		config:       config,
+		published:    make(map[string]string),
+		deviceTopics: make(map[string][]string),
+		subscribed:   make([]string, 0),
+		labels:       make(map[string]map[string]string),
+		labelsLock:   sync.RWMutex{},
+	}
+}
+
+func (e *exporter) run() {
+	e.Run(time.Duration(e.config.PollIntervalSeconds)*time.Second, e)
+}
+
+func (e *exporter) Shutdown(removeDiscovery bool) {
+	e.unsubscribe()
+
+	if removeDiscovery {
+		for deviceID := range e.deviceTopics {
+			e.removeDevice(deviceID)
+		}
+	}
+
+	e.publish(statusTopic(e.config), availabilityOffline)
+
+	log.Debug("Stopped Home Assistant exporter")
+}
+
+func (e *exporter) Republish() {
+	e.published = make(map[string]string)
+	e.SyncAll()
+}
+
+// Publishes a retained message unless the topic already carries this payload.
+// Failed messages are not recorded so that they are published again later.
+func (e *exporter) publish(topic string, payload string) {
+	if previous, found := e.published[topic]; found && previous == payload {
+		return
+	}
+
+	if err := dispatcher.Instance.Mqtt.PublishRetained(topic, payload); err != nil {
+		log.Debugf("Home Assistant exporter could not publish to `%s`: %s", topic, err.Error())
+		return
+	}
+
+	e.published[topic] = payload
+}
+
+// Subscribes to the command topics and to the birth message of Home Assistant.
+// This is retried on every poll until it succeeds as the broker might not be reachable yet.
+func (e *exporter) subscribe() {
+	if len(e.subscribed) > 0 {
+		return
+	}
+
+	commandTopics := []string{
+		deviceTopic(e.config, "+") + "/power/set",
+		deviceTopic(e.config, "+") + "/dim/+/set",
+	}
+
+	if err := dispatcher.Instance.Mqtt.Subscribe(commandTopics, mqttdevices.AsyncHandler(e.handleCommand)); err != nil {
+		log.Debugf("Home Assistant exporter could not subscribe to command topics: %s", err.Error())
+		return
+	}
+
+	if err := dispatcher.Instance.Mqtt.Subscribe([]string{birthTopic(e.config)}, e.handleBirthMessage); err != nil {
+		log.Debugf("Home Assistant exporter could not subscribe to birth topic: %s", err.Error())
+		for _, topic := range commandTopics {
+			_ = dispatcher.Instance.Mqtt.Unsubscribe(topic)
+		}
+		return
+	}
+
+	e.subscribed = append(commandTopics, birthTopic(e.config))
+}
+
+func (e *exporter) unsubscribe() {
+	for _, topic := range e.subscribed {
+		if err := dispatcher.Instance.Mqtt.Unsubscribe(topic); err != nil {
+			log.Debugf("Home Assistant exporter could not unsubscribe from `%s`: %s", topic, err.Error())
+		}
+	}
+	e.subscribed = make([]string, 0)
+}
+
+func (e *exporter) SyncAll() {
+	e.subscribe()
+	e.publish(statusTopic(e.config), availabilityOnline)
+
+	devices, err := driver.Manager.ListPersonalDevicesRich(*e.config.ServiceUsername)
+	if err != nil {
+		log.Errorf("Home Assistant exporter could not list devices: %s", err.Error())
+		return
+	}
+
+	rooms, err := database.ListRooms()
+	if err != nil {
+		log.Errorf("Home Assistant exporter could not list rooms: %s", err.Error())
+		return
+	}
+
+	roomNames := make(map[string]string)
+	for _, room := range rooms {
+		roomNames[room.ID] = room.Name
+	}
+
+	exported := make(map[string]bool)
+	for _, device := range devices {
+		e.exportDevice(device, roomNames[device.Shallow.RoomID])
+		exported[device.Shallow.ID] = true
+	}
+
+	// Devices which were deleted or which the service user may no longer access.
+	for deviceID := range e.deviceTopics {
+		if !exported[deviceID] {
+			e.removeDevice(deviceID)
+		}
+	}
+}
+
+func (e *exporter) SyncDevice(deviceID string) {
+	hasPermission, err := mqttdevices.MayAccess(*e.config.ServiceUsername, deviceID)
+	if err != nil {
+		return
+	}
+
+	if !hasPermission {
+		e.removeDevice(deviceID)
+		return
+	}
+
+	device, found, err := driver.Manager.EnrichDeviceAll(deviceID)
+	if err != nil {
+		log.Errorf("Home Assistant exporter could not report device `%s`: %s", deviceID, err.Error())
+		return
+	}
+
+	if !found {
+		e.removeDevice(deviceID)
+		return
+	}
+
+	room, _, err := database.GetRoomDataById(device.Shallow.RoomID)
+	if err != nil {
+		log.Errorf("Home Assistant exporter could not get room of device `%s`: %s", deviceID, err.Error())
+		return
+	}
+
+	e.exportDevice(device, room.Name)
+}
+
+func (e *exporter) exportDevice(device driver.RichDevice, roomName string) {
+	deviceID := device.Shallow.ID
+
+	// A failing driver reports neither dimmables nor sensors, its entities are kept until it works again.
+	if _, exported := e.deviceTopics[deviceID]; exported && len(device.Extractions.HmsErrors) > 0 {
+		e.publish(availabilityTopic(e.config, deviceID), availabilityOffline)
+		return
+	}
+
+	labels := make(map[string]string)
+	entities := deviceEntities(e.config, device, roomName, labels)
+
+	e.labelsLock.Lock()
+	e.labels[deviceID] = labels
+	e.labelsLock.Unlock()
+
+	availability := availabilityOnline
+	if len(device.Extractions.HmsErrors) > 0 {
+		availability = availabilityOffline
+	}
+
+	topics := []string{availabilityTopic(e.config, deviceID)}
+	e.publish(availabilityTopic(e.config, deviceID), availability)
+
+	for _, item := range entities {
+		topic := discoveryTopic(e.config, deviceID, item)
+		topics = append(topics, topic, item.config.StateTopic)
+
+		e.publish(topic, marshalConfig(item.config))
+
+		if item.state != "" {
+			e.publish(item.config.StateTopic, item.state)
+		}
+	}
+
+	// Entities which no longer exist, for instance after a sensor disappeared.
+	kept := make(map[string]bool)
+	for _, topic := range topics {
+		kept[topic] = true
+	}
+
+	for _, topic := range e.deviceTopics[deviceID] {
+		if !kept[topic] {
+			e.publish(topic, "")
+			delete(e.published, topic)
+		}
+	}
+
+	e.deviceTopics[deviceID] = topics
+}
+
+// Removes all entities of a device from Home Assistant.
+func (e *exporter) removeDevice(deviceID string) {
+	topics, found := e.deviceTopics[deviceID]
+	if !found {
+		return
+	}
+
+	// An empty retained payload deletes both the entity and the retained message.
+	for _, topic := range topics {
+		e.publish(topic, "")
+		delete(e.published, topic)
+	}
+
+	delete(e.deviceTopics, deviceID)
+
+	e.labelsLock.Lock()
+	delete(e.labels, deviceID)
+	e.labelsLock.Unlock()
+}
+
+func (e *exporter) handleBirthMessage(_ mqtt.Client, message mqtt.Message) {
+	if string(message.Payload()) == availabilityOnline {
+		log.Debug("Home Assistant came online, republishing all devices")
+		e.RequestRepublish()
+	}
+}
+
+func (e *exporter) handleCommand(topic string, rawPayload []byte) {
+	payload := string(rawPayload)
+
+	cmd, ok := parseCommandTopic(e.config, topic)
+	if !ok {
+		log.Debugf("Home Assistant exporter ignored message on unknown topic `%s`", topic)
+		return
+	}
+
+	if err := mqttdevices.Authorize(serviceName, *e.config.ServiceUsername, cmd.deviceID); err != nil {
+		return
+	}
+
+	var res driver.ActionResponse
+	var err error
+
+	switch cmd.kind {
+	case commandPower:
+		if payload != payloadOn && payload != payloadOff {
+			log.Warnf("Home Assistant command for device `%s` has an invalid power payload `%s`", cmd.deviceID, payload)
+			return
+		}
+
+		res, err = mqttdevices.DeviceAction(
+			serviceName,
+			driver.DriverActionKindSetPower,
+			cmd.deviceID,
+			&driver.DriverSetPowerInput{State: payload == payloadOn},
+			nil,
+		)
+	case commandDim:
+		e.labelsLock.RLock()
+		label, labelFound := e.labels[cmd.deviceID][cmd.dimSlug]
+		e.labelsLock.RUnlock()
+
+		if !labelFound {
+			log.Warnf("Home Assistant command for device `%s` refers to unknown dimmable `%s`", cmd.deviceID, cmd.dimSlug)
+			return
+		}
+
+		value, parseErr := strconv.ParseFloat(payload, 64)
+		if parseErr != nil {
+			log.Warnf("Home Assistant command for device `%s` has an invalid dim payload `%s`", cmd.deviceID, payload)
+			return
+		}
+
+		res, err = mqttdevices.DeviceAction(
+			serviceName,
+			driver.DriverActionKindDim,
+			cmd.deviceID,
+			nil,
+			&driver.DriverDimInput{Value: int64(math.Round(value)), Label: label},
+		)
+	}
+
+	switch {
+	case err != nil:
+		log.Warnf("Home Assistant command for device `%s` failed: %s", cmd.deviceID, err.Error())
+	case !res.Success && len(res.HmsErrors) > 0:
+		log.Warnf("Home Assistant command for device `%s` failed: %s", cmd.deviceID, res.HmsErrors[0].String())
+	}
+}
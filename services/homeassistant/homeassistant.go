@@ -0,0 +1,212 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
+)
+
+var log *logrus.Logger
+
+// Prefixes the log messages of the shared device commands.
+const serviceName = "Home Assistant"
+
+func InitLogger(logger *logrus.Logger) {
+	log = logger
+}
+
+// The bounds of the poll interval.
+const (
+	PollIntervalMinSeconds = 1
+	PollIntervalMaxSeconds = 60 * 60
+)
+
+var (
+	current      *exporter
+	currentLock  sync.Mutex
+	listenerOnce sync.Once
+)
+
+func validateTopicPrefix(kind string, prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("The %s must not be empty", kind)
+	}
+	if strings.ContainsAny(prefix, "+#") {
+		return fmt.Errorf("The %s must not contain wildcards", kind)
+	}
+	if strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") {
+		return fmt.Errorf("The %s must not start or end with a `/`", kind)
+	}
+	return nil
+}
+
+func validateConfig(config database.HomeAssistantConfig) (validationErr error, dbErr error) {
+	if err := validateTopicPrefix("discovery prefix", config.DiscoveryPrefix); err != nil {
+		return err, nil
+	}
+
+	if err := validateTopicPrefix("base topic", config.BaseTopic); err != nil {
+		return err, nil
+	}
+
+	if config.DiscoveryPrefix == config.BaseTopic {
+		return errors.New("The base topic must differ from the discovery prefix"), nil
+	}
+
+	if config.PollIntervalSeconds < PollIntervalMinSeconds || config.PollIntervalSeconds > PollIntervalMaxSeconds {
+		return fmt.Errorf(
+			"The poll interval must be between %d and %d seconds",
+			PollIntervalMinSeconds,
+			PollIntervalMaxSeconds,
+		), nil
+	}
+
+	if config.ServiceUsername == nil {
+		if config.Enabled {
+			return errors.New("A service user is required in order to enable the exporter"), nil
+		}
+		return nil, nil
+	}
+
+	_, found, err := database.GetUserByUsername(*config.ServiceUsername)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return fmt.Errorf("The service user `%s` does not exist", *config.ServiceUsername), nil
+	}
+
+	return nil, nil
+}
+
+// Forwards invalidated devices to the running exporter so that their new state is published immediately.
+func onDeviceReportsInvalidated(deviceID string) {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+
+	if current != nil {
+		current.NotifyChanged(deviceID)
+	}
+}
+
+// Returns the device a topic of the running exporter refers to, is used by the embedded broker in order to authorize clients.
+// `reserved` reports whether the topic belongs to the exporter, `deviceID` is empty if it refers to no device.
+// Without a running exporter, no topic is reserved.
+func DeviceOfTopic(topic string) (deviceID string, reserved bool) {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+
+	if current == nil {
+		return "", false
+	}
+
+	return deviceOfTopic(current.config, topic)
+}
+
+// Starts the exporter if it is enabled in the stored configuration.
+func Init() error {
+	listenerOnce.Do(func() {
+		driver.OnDeviceReportsInvalidated(onDeviceReportsInvalidated)
+		// The broker might have lost the retained discovery configurations.
+		dispatcher.Instance.Mqtt.OnReconnect(Republish)
+	})
+
+	config, err := database.GetHomeAssistantConfig()
+	if err != nil {
+		return err
+	}
+
+	restart(config, false)
+	return nil
+}
+
+// Stops the running exporter (if any) and starts a new one using the given config.
+func restart(config database.HomeAssistantConfig, removeDiscovery bool) {
+	currentLock.Lock()
+	old := current
+	current = nil
+	currentLock.Unlock()
+
+	if old != nil {
+		old.Stop(removeDiscovery)
+	}
+
+	if !config.Enabled {
+		log.Debug("Home Assistant exporter is disabled")
+		return
+	}
+
+	started := newExporter(config)
+
+	currentLock.Lock()
+	current = started
+	currentLock.Unlock()
+
+	go started.run()
+
+	log.Infof("Started Home Assistant exporter (discovery prefix: `%s`, base topic: `%s`)", config.DiscoveryPrefix, config.BaseTopic)
+}
+
+// Validates and stores a new configuration, the exporter is restarted afterwards.
+// If the discovery prefix or base topic changed or if the exporter is disabled, the previously exported entities are removed.
+func SetConfig(config database.HomeAssistantConfig) (validationErr error, dbErr error) {
+	validationErr, dbErr = validateConfig(config)
+	if validationErr != nil || dbErr != nil {
+		return validationErr, dbErr
+	}
+
+	old, err := database.GetHomeAssistantConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.SetHomeAssistantConfig(config); err != nil {
+		return nil, err
+	}
+
+	removeDiscovery := !config.Enabled ||
+		old.DiscoveryPrefix != config.DiscoveryPrefix ||
+		old.BaseTopic != config.BaseTopic
+
+	restart(config, removeDiscovery)
+	return nil, nil
+}
+
+// Stops the exporter, Home Assistant marks all entities as unavailable.
+func Shutdown() {
+	currentLock.Lock()
+	old := current
+	current = nil
+	currentLock.Unlock()
+
+	if old != nil {
+		old.Stop(false)
+	}
+}
+
+// Publishes the discovery configuration and state of all devices immediately.
+// The next update of each topic is always published, even if it did not change.
+func Republish() {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+
+	if current != nil {
+		current.RequestRepublish()
+	}
+}
+
+func marshalConfig(config discoveryConfig) string {
+	marshaled, err := json.Marshal(config)
+	if err != nil {
+		panic(fmt.Sprintf("Home Assistant discovery config cannot be marshaled: %s", err.Error()))
+	}
+	return string(marshaled)
+}
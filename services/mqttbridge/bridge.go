@@ -0,0 +1,185 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
+	"github.com/smarthome-go/smarthome/services/mqttdevices"
+)
+
+//
+// MQTT state bridge.
+// Allows local services to integrate with Smarthome without HTTP tokens using the following topic scheme:
+//
+// - `smarthome/device/{id}/state`:  retained JSON state of the device (see `DeviceState`),
+//                                   republished after every action, on reconnect and on every poll if it changed.
+//                                   An empty retained payload means that the device was removed.
+// - `smarthome/device/{id}/set`:    accepts JSON commands (see `Command`), for instance `{"power":{"state":true}}`
+//                                   or `{"dim":{"label":"Brightness","percent":50}}`.
+// - `smarthome/device/{id}/result`: non-retained JSON outcome of every command (see `CommandResult`).
+//
+// Access is mapped to the configured user: only devices this user may access are bridged and
+// commands additionally require the power permission of this user.
+//
+
+const TopicPrefix = "smarthome/device"
+
+// Prefixes the log messages of the shared device commands.
+const serviceName = "MQTT bridge"
+
+var log *logrus.Logger
+
+func InitLogger(logger *logrus.Logger) {
+	log = logger
+}
+
+// The bounds of the poll interval.
+const (
+	PollIntervalMinSeconds = 1
+	PollIntervalMaxSeconds = 60 * 60
+)
+
+var (
+	current      *bridge
+	currentLock  sync.Mutex
+	listenerOnce sync.Once
+)
+
+func validateConfig(config database.MqttBridgeConfig) (validationErr error, dbErr error) {
+	if config.PollIntervalSeconds < PollIntervalMinSeconds || config.PollIntervalSeconds > PollIntervalMaxSeconds {
+		return fmt.Errorf(
+			"The poll interval must be between %d and %d seconds",
+			PollIntervalMinSeconds,
+			PollIntervalMaxSeconds,
+		), nil
+	}
+
+	if config.Username == nil {
+		if config.Enabled {
+			return errors.New("A user is required in order to enable the bridge"), nil
+		}
+		return nil, nil
+	}
+
+	_, found, err := database.GetUserByUsername(*config.Username)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return fmt.Errorf("The user `%s` does not exist", *config.Username), nil
+	}
+
+	return nil, nil
+}
+
+// Forwards invalidated devices to the running bridge so that their new state is published immediately.
+func onDeviceReportsInvalidated(deviceID string) {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+
+	if current != nil {
+		current.NotifyChanged(deviceID)
+	}
+}
+
+// Publishes the state of all devices again as the broker might have lost the retained messages.
+func onReconnect() {
+	currentLock.Lock()
+	defer currentLock.Unlock()
+
+	if current != nil {
+		current.RequestRepublish()
+	}
+}
+
+// Starts the bridge if it is enabled in the stored configuration.
+func Init() error {
+	listenerOnce.Do(func() {
+		driver.OnDeviceReportsInvalidated(onDeviceReportsInvalidated)
+		dispatcher.Instance.Mqtt.OnReconnect(onReconnect)
+	})
+
+	config, err := database.GetMqttBridgeConfig()
+	if err != nil {
+		return err
+	}
+
+	restart(config, false)
+	return nil
+}
+
+// Stops the running bridge (if any) and starts a new one using the given config.
+func restart(config database.MqttBridgeConfig, clearStates bool) {
+	currentLock.Lock()
+	old := current
+	current = nil
+	currentLock.Unlock()
+
+	if old != nil {
+		old.Stop(clearStates)
+	}
+
+	if !config.Enabled {
+		log.Debug("MQTT bridge is disabled")
+		return
+	}
+
+	started := newBridge(config)
+
+	currentLock.Lock()
+	current = started
+	currentLock.Unlock()
+
+	go started.run()
+
+	log.Infof("Started MQTT bridge for user `%s`", *config.Username)
+}
+
+// Validates and stores a new configuration, the bridge is restarted afterwards.
+// If the bridge is disabled or the user changed, the previously published states are cleared.
+func SetConfig(config database.MqttBridgeConfig) (validationErr error, dbErr error) {
+	validationErr, dbErr = validateConfig(config)
+	if validationErr != nil || dbErr != nil {
+		return validationErr, dbErr
+	}
+
+	old, err := database.GetMqttBridgeConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.SetMqttBridgeConfig(config); err != nil {
+		return nil, err
+	}
+
+	userChanged := old.Username == nil || config.Username == nil || *old.Username != *config.Username
+	restart(config, !config.Enabled || userChanged)
+	return nil, nil
+}
+
+// Stops the bridge, the retained states are kept.
+func Shutdown() {
+	currentLock.Lock()
+	old := current
+	current = nil
+	currentLock.Unlock()
+
+	if old != nil {
+		old.Stop(false)
+	}
+}
+
+func marshal(value any) string {
+	marshaled, err := json.Marshal(value)
+	if err != nil {
+		panic(fmt.Sprintf("MQTT bridge payload cannot be marshaled: %s", err.Error()))
+	}
+	return string(marshaled)
+}
@@ -0,0 +1,153 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+// The state of a device as it is published to `smarthome/device/{id}/state`.
+type DeviceState struct {
+	ID           string                                        `json:"id"`
+	Name         string                                        `json:"name"`
+	RoomID       string                                        `json:"roomId"`
+	VendorID     string                                        `json:"vendorId"`
+	ModelID      string                                        `json:"modelId"`
+	Capabilities driver.CapabilitySet[driver.DeviceCapability] `json:"capabilities"`
+	// Is false if the driver currently fails, the remaining fields then contain the last known state.
+	Online bool `json:"online"`
+	// The following fields are `null` if the device lacks the respective capability.
+	Power     *driver.DevicePowerInformation                  `json:"power"`
+	Dimmables []driver.DriverActionReportDimOutput            `json:"dimmables"`
+	Sensors   []driver.DriverActionReportSensorReadingsOutput `json:"sensors"`
+}
+
+// A command as it is received on `smarthome/device/{id}/set`.
+// It has the same shape as the body of the HTTP device action endpoints, without the device ID.
+// If both actions are present, the power action is executed first.
+type Command struct {
+	Power *driver.DriverSetPowerInput `json:"power"`
+	Dim   *driver.DriverDimInput      `json:"dim"`
+}
+
+// The outcome of a command as it is published to `smarthome/device/{id}/result`.
+type CommandResult struct {
+	Success   bool             `json:"success"`
+	Error     *string          `json:"error"`
+	HmsErrors []types.HmsError `json:"hmsErrors"`
+}
+
+func stateTopic(deviceID string) string {
+	return fmt.Sprintf("%s/%s/state", TopicPrefix, deviceID)
+}
+
+func setTopic(deviceID string) string {
+	return fmt.Sprintf("%s/%s/set", TopicPrefix, deviceID)
+}
+
+func resultTopic(deviceID string) string {
+	return fmt.Sprintf("%s/%s/result", TopicPrefix, deviceID)
+}
+
+// Returns the device a topic of the bridge refers to, is used by the embedded broker in order to authorize clients.
+// `reserved` reports whether the topic is located below `TopicPrefix`, `deviceID` is empty if it refers to no device.
+func DeviceOfTopic(topic string) (deviceID string, reserved bool) {
+	if topic == TopicPrefix {
+		return "", true
+	}
+
+	rest, found := strings.CutPrefix(topic, TopicPrefix+"/")
+	if !found {
+		return "", false
+	}
+
+	deviceID, _, _ = strings.Cut(rest, "/")
+	return deviceID, true
+}
+
+// Extracts the device ID from a command topic.
+func parseSetTopic(topic string) (deviceID string, ok bool) {
+	rest, found := strings.CutPrefix(topic, TopicPrefix+"/")
+	if !found {
+		return "", false
+	}
+
+	deviceID, found = strings.CutSuffix(rest, "/set")
+	if !found || deviceID == "" || strings.Contains(deviceID, "/") {
+		return "", false
+	}
+
+	return deviceID, true
+}
+
+func parseCommand(payload []byte) (Command, error) {
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.DisallowUnknownFields()
+
+	var cmd Command
+	if err := decoder.Decode(&cmd); err != nil {
+		return Command{}, fmt.Errorf("Invalid command: %s", err.Error())
+	}
+
+	if cmd.Power == nil && cmd.Dim == nil {
+		return Command{}, errors.New("Invalid command: either `power` or `dim` is required")
+	}
+
+	return cmd, nil
+}
+
+// Converts a device into its published state.
+// If the driver of the device fails, the last known state is used if available.
+func deviceState(device driver.RichDevice, last *DeviceState) DeviceState {
+	online := len(device.Extractions.HmsErrors) == 0
+
+	if !online && last != nil {
+		state := *last
+		state.Online = false
+		return state
+	}
+
+	capabilities := device.Extractions.Config.Capabilities
+
+	state := DeviceState{
+		ID:           device.Shallow.ID,
+		Name:         device.Shallow.Name,
+		RoomID:       device.Shallow.RoomID,
+		VendorID:     device.Shallow.DriverVendorID,
+		ModelID:      device.Shallow.DriverModelID,
+		Capabilities: capabilities,
+		Online:       online,
+		Power:        nil,
+		Dimmables:    nil,
+		Sensors:      nil,
+	}
+
+	if state.Capabilities == nil {
+		state.Capabilities = make(driver.CapabilitySet[driver.DeviceCapability], 0)
+	}
+
+	if capabilities.Has(driver.DeviceCapabilityPower) {
+		power := device.Extractions.PowerInformation
+		state.Power = &power
+	}
+
+	if capabilities.Has(driver.DeviceCapabilityDimmable) {
+		state.Dimmables = device.Extractions.DimmableInformation
+		if state.Dimmables == nil {
+			state.Dimmables = make([]driver.DriverActionReportDimOutput, 0)
+		}
+	}
+
+	if capabilities.Has(driver.DeviceCapabilitySensor) {
+		state.Sensors = device.Extractions.SensorReadings
+		if state.Sensors == nil {
+			state.Sensors = make([]driver.DriverActionReportSensorReadingsOutput, 0)
+		}
+	}
+
+	return state
+}
@@ -0,0 +1,128 @@
+package mqttbridge
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+)
+
+func TestParseSetTopic(t *testing.T) {
+	table := []struct {
+		Topic    string
+		DeviceID string
+		Valid    bool
+	}{
+		{Topic: "smarthome/device/lamp/set", DeviceID: "lamp", Valid: true},
+		{Topic: "smarthome/device/lamp/state", Valid: false},
+		{Topic: "smarthome/device//set", Valid: false},
+		{Topic: "smarthome/device/a/b/set", Valid: false},
+		{Topic: "other/device/lamp/set", Valid: false},
+	}
+
+	for _, test := range table {
+		deviceID, valid := parseSetTopic(test.Topic)
+		assert.Equal(t, test.Valid, valid, test.Topic)
+		assert.Equal(t, test.DeviceID, deviceID, test.Topic)
+	}
+}
+
+func TestDeviceOfTopic(t *testing.T) {
+	table := []struct {
+		Topic    string
+		DeviceID string
+		Reserved bool
+	}{
+		{Topic: "smarthome/device/lamp/state", DeviceID: "lamp", Reserved: true},
+		{Topic: "smarthome/device/lamp", DeviceID: "lamp", Reserved: true},
+		{Topic: "smarthome/device", DeviceID: "", Reserved: true},
+		{Topic: "smarthome/devices/lamp/state", Reserved: false},
+		{Topic: "tele/lamp/STATE", Reserved: false},
+	}
+
+	for _, test := range table {
+		deviceID, reserved := DeviceOfTopic(test.Topic)
+		assert.Equal(t, test.Reserved, reserved, test.Topic)
+		assert.Equal(t, test.DeviceID, deviceID, test.Topic)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	cmd, err := parseCommand([]byte(`{"power":{"state":true}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &driver.DriverSetPowerInput{State: true}, cmd.Power)
+	assert.Nil(t, cmd.Dim)
+
+	cmd, err = parseCommand([]byte(`{"dim":{"label":"Brightness","percent":50}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &driver.DriverDimInput{Label: "Brightness", Value: 50}, cmd.Dim)
+
+	for _, invalid := range []string{``, `{}`, `{"power":true}`, `{"brightness":50}`} {
+		_, err := parseCommand([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func testDevice() driver.RichDevice {
+	return driver.RichDevice{
+		Shallow: driver.ShallowDevice{
+			DeviceType:     database.DEVICE_TYPE_OUTPUT,
+			ID:             "lamp",
+			Name:           "Desk Lamp",
+			RoomID:         "office",
+			DriverVendorID: "tasmota",
+			DriverModelID:  "light",
+		},
+		Extractions: driver.DeviceExtractions{
+			HmsErrors: make([]types.HmsError, 0),
+			Config: driver.ConfigInfoWrapperDevice{
+				Capabilities: driver.CapabilitySet[driver.DeviceCapability]{
+					driver.DeviceCapabilityPower,
+					driver.DeviceCapabilityDimmable,
+				},
+			},
+			PowerInformation: driver.DevicePowerInformation{State: true, PowerDrawWatts: 12},
+			DimmableInformation: []driver.DriverActionReportDimOutput{
+				{Value: 80, Label: "Brightness", Range: driver.DriverActionReportRange{Lower: 0, Upper: 100}},
+			},
+		},
+	}
+}
+
+func TestDeviceState(t *testing.T) {
+	state := deviceState(testDevice(), nil)
+
+	var marshaled map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(marshal(state)), &marshaled))
+
+	assert.Equal(t, "lamp", marshaled["id"])
+	assert.Equal(t, "office", marshaled["roomId"])
+	assert.Equal(t, true, marshaled["online"])
+	assert.Equal(t, []any{"power", "dimmable"}, marshaled["capabilities"])
+	assert.Equal(t, true, marshaled["power"].(map[string]any)["state"])
+	assert.Len(t, marshaled["dimmables"], 1)
+	// The device lacks the sensor capability.
+	assert.Nil(t, marshaled["sensors"])
+}
+
+func TestDeviceStateWhileFailing(t *testing.T) {
+	failing := testDevice()
+	failing.Extractions.HmsErrors = []types.HmsError{{}}
+	failing.Extractions.DimmableInformation = nil
+
+	// Without a previous state, the device is published as offline with default values.
+	state := deviceState(failing, nil)
+	assert.False(t, state.Online)
+	assert.Empty(t, state.Dimmables)
+
+	// Otherwise, the last known state is kept.
+	last := deviceState(testDevice(), nil)
+	state = deviceState(failing, &last)
+	assert.False(t, state.Online)
+	assert.Len(t, state.Dimmables, 1)
+	assert.True(t, last.Online)
+}
@@ -0,0 +1,236 @@
+package mqttbridge
+
+import (
+	"time"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+	"github.com/smarthome-go/smarthome/core/homescript/dispatcher"
+	"github.com/smarthome-go/smarthome/core/homescript/types"
+	"github.com/smarthome-go/smarthome/services/mqttdevices"
+)
+
+//
+// Worker.
+// The bridge polls all devices of its user and publishes states which changed.
+// Devices whose reports are invalidated (after actions or MQTT messages) are published immediately.
+// Only the goroutine of the bridge publishes states, commands are executed in their own goroutines.
+//
+
+type bridge struct {
+	*mqttdevices.Loop
+	config database.MqttBridgeConfig
+
+	// The last published state payload of every device, only changes are published.
+	published map[string]string
+	// The last known state of every device, is used while its driver fails.
+	states     map[string]DeviceState
+	subscribed bool
+}
+
+func newBridge(config database.MqttBridgeConfig) *bridge {
+	return &bridge{
+		Loop:       mqttdevices.NewLoop(),
+		config:     config,
+		published:  make(map[string]string),
+		states:     make(map[string]DeviceState),
+		subscribed: false,
+	}
+}
+
+func (b *bridge) run() {
+	b.Run(time.Duration(b.config.PollIntervalSeconds)*time.Second, b)
+}
+
+func (b *bridge) Shutdown(clearStates bool) {
+	if b.subscribed {
+		if err := dispatcher.Instance.Mqtt.Unsubscribe(setTopic("+")); err != nil {
+			log.Debugf("MQTT bridge could not unsubscribe from command topic: %s", err.Error())
+		}
+	}
+
+	if clearStates {
+		for deviceID := range b.published {
+			b.removeDevice(deviceID)
+		}
+	}
+
+	log.Debug("Stopped MQTT bridge")
+}
+
+func (b *bridge) Republish() {
+	b.published = make(map[string]string)
+	b.SyncAll()
+}
+
+// Subscribes to the command topic.
+// This is retried on every poll until it succeeds as the broker might not be reachable yet.
+func (b *bridge) subscribe() {
+	if b.subscribed {
+		return
+	}
+
+	if err := dispatcher.Instance.Mqtt.Subscribe([]string{setTopic("+")}, mqttdevices.AsyncHandler(b.handleCommand)); err != nil {
+		log.Debugf("MQTT bridge could not subscribe to command topic: %s", err.Error())
+		return
+	}
+
+	b.subscribed = true
+}
+
+func (b *bridge) SyncAll() {
+	b.subscribe()
+
+	devices, err := driver.Manager.ListPersonalDevicesRich(*b.config.Username)
+	if err != nil {
+		log.Errorf("MQTT bridge could not list devices: %s", err.Error())
+		return
+	}
+
+	published := make(map[string]bool)
+	for _, device := range devices {
+		b.publishDevice(device)
+		published[device.Shallow.ID] = true
+	}
+
+	// Devices which were deleted or which the user may no longer access.
+	for deviceID := range b.states {
+		if !published[deviceID] {
+			b.removeDevice(deviceID)
+		}
+	}
+}
+
+func (b *bridge) SyncDevice(deviceID string) {
+	hasPermission, err := mqttdevices.MayAccess(*b.config.Username, deviceID)
+	if err != nil {
+		return
+	}
+
+	if !hasPermission {
+		b.removeDevice(deviceID)
+		return
+	}
+
+	device, found, err := driver.Manager.EnrichDeviceAll(deviceID)
+	if err != nil {
+		log.Errorf("MQTT bridge could not report device `%s`: %s", deviceID, err.Error())
+		return
+	}
+
+	if !found {
+		b.removeDevice(deviceID)
+		return
+	}
+
+	b.publishDevice(device)
+}
+
+// Publishes the retained state of a device unless it did not change.
+// Failed messages are not recorded so that they are published again later.
+func (b *bridge) publishDevice(device driver.RichDevice) {
+	deviceID := device.Shallow.ID
+
+	var last *DeviceState
+	if state, found := b.states[deviceID]; found {
+		last = &state
+	}
+
+	state := deviceState(device, last)
+	b.states[deviceID] = state
+
+	payload := marshal(state)
+	if previous, found := b.published[deviceID]; found && previous == payload {
+		return
+	}
+
+	if err := dispatcher.Instance.Mqtt.PublishRetained(stateTopic(deviceID), payload); err != nil {
+		log.Debugf("MQTT bridge could not publish state of device `%s`: %s", deviceID, err.Error())
+		return
+	}
+
+	b.published[deviceID] = payload
+}
+
+// Clears the retained state of a device.
+func (b *bridge) removeDevice(deviceID string) {
+	_, known := b.states[deviceID]
+	_, published := b.published[deviceID]
+	if !known && !published {
+		return
+	}
+
+	// An empty retained payload deletes the retained message.
+	if err := dispatcher.Instance.Mqtt.PublishRetained(stateTopic(deviceID), ""); err != nil {
+		log.Debugf("MQTT bridge could not clear state of device `%s`: %s", deviceID, err.Error())
+		return
+	}
+
+	delete(b.states, deviceID)
+	delete(b.published, deviceID)
+}
+
+func (b *bridge) handleCommand(topic string, payload []byte) {
+	deviceID, ok := parseSetTopic(topic)
+	if !ok {
+		log.Debugf("MQTT bridge ignored message on unknown topic `%s`", topic)
+		return
+	}
+
+	result := b.executeCommand(deviceID, payload)
+
+	if err := dispatcher.Instance.Mqtt.Publish(resultTopic(deviceID), marshal(result)); err != nil {
+		log.Debugf("MQTT bridge could not publish command result of device `%s`: %s", deviceID, err.Error())
+	}
+
+	// The state is also republished after failed actions as the driver might have changed it partially.
+	b.NotifyChanged(deviceID)
+}
+
+func (b *bridge) executeCommand(deviceID string, payload []byte) CommandResult {
+	cmd, err := parseCommand(payload)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	if err := mqttdevices.Authorize(serviceName, *b.config.Username, deviceID); err != nil {
+		return failedResult(err)
+	}
+
+	if cmd.Power != nil {
+		result := deviceAction(driver.DriverActionKindSetPower, deviceID, cmd.Power, nil)
+		if !result.Success {
+			return result
+		}
+	}
+
+	if cmd.Dim != nil {
+		return deviceAction(driver.DriverActionKindDim, deviceID, nil, cmd.Dim)
+	}
+
+	return CommandResult{Success: true, Error: nil, HmsErrors: make([]types.HmsError, 0)}
+}
+
+func deviceAction(
+	kind driver.DriverActionKind,
+	deviceID string,
+	power *driver.DriverSetPowerInput,
+	dim *driver.DriverDimInput,
+) CommandResult {
+	res, err := mqttdevices.DeviceAction(serviceName, kind, deviceID, power, dim)
+	if err != nil {
+		return failedResult(err)
+	}
+
+	hmsErrors := res.HmsErrors
+	if hmsErrors == nil {
+		hmsErrors = make([]types.HmsError, 0)
+	}
+
+	return CommandResult{Success: res.Success, Error: nil, HmsErrors: hmsErrors}
+}
+
+func failedResult(err error) CommandResult {
+	message := err.Error()
+	return CommandResult{Success: false, Error: &message, HmsErrors: make([]types.HmsError, 0)}
+}
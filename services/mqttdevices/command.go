@@ -0,0 +1,91 @@
+package mqttdevices
+
+import (
+	"errors"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/smarthome-go/smarthome/core/database"
+	"github.com/smarthome-go/smarthome/core/device/driver"
+)
+
+var (
+	ErrDatabase         = errors.New("Database failure")
+	ErrPermissionDenied = errors.New("Permission denied")
+	ErrDeviceNotFound   = errors.New("Device not found")
+	ErrInternal         = errors.New("Internal error")
+)
+
+// Returns a message handler which runs the given handler in its own goroutine.
+// Driver invocations may take a while, the MQTT client must not be blocked meanwhile.
+func AsyncHandler(handler func(topic string, payload []byte)) mqtt.MessageHandler {
+	return func(_ mqtt.Client, message mqtt.Message) {
+		go handler(message.Topic(), message.Payload())
+	}
+}
+
+// Reports whether a user may access a device, database errors are logged.
+func MayAccess(username string, deviceID string) (bool, error) {
+	hasPermission, err := database.UserHasDevicePermission(username, deviceID)
+	if err != nil {
+		log.Errorf("Could not check access of user `%s` to device `%s`: %s", username, deviceID, err.Error())
+		return false, err
+	}
+	return hasPermission, nil
+}
+
+// Reports whether a user may control a device: this requires the power permission and access to the device.
+// Database errors are logged.
+func MayControl(username string, deviceID string) (bool, error) {
+	hasPermission, err := database.UserHasPermission(username, database.PermissionPower)
+	if err != nil {
+		log.Errorf("Could not check power permission of user `%s`: %s", username, err.Error())
+		return false, err
+	}
+
+	if !hasPermission {
+		return false, nil
+	}
+
+	return MayAccess(username, deviceID)
+}
+
+// Checks whether a user may control a device before a command of the given service is executed.
+// Returns `ErrDatabase` or `ErrPermissionDenied` if the command must not be executed.
+func Authorize(service string, username string, deviceID string) error {
+	allowed, err := MayControl(username, deviceID)
+	if err != nil {
+		return ErrDatabase
+	}
+
+	if !allowed {
+		log.Warnf("%s command for device `%s` denied: user `%s` lacks permission", service, deviceID, username)
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// Executes a device action on behalf of a service, the caller must have used `Authorize` before.
+// Missing devices and invalid actions are returned as errors, failures of the driver are contained in the response.
+func DeviceAction(
+	service string,
+	kind driver.DriverActionKind,
+	deviceID string,
+	power *driver.DriverSetPowerInput,
+	dim *driver.DriverDimInput,
+) (driver.ActionResponse, error) {
+	res, found, validationErr, err := driver.Manager.DeviceAction(kind, deviceID, power, dim)
+
+	switch {
+	case err != nil:
+		log.Errorf("%s command for device `%s` failed: %s", service, deviceID, err.Error())
+		return driver.ActionResponse{}, ErrInternal
+	case !found:
+		return driver.ActionResponse{}, ErrDeviceNotFound
+	case validationErr != nil:
+		return driver.ActionResponse{}, validationErr
+	}
+
+	return res, nil
+}
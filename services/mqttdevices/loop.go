@@ -0,0 +1,82 @@
+package mqttdevices
+
+import (
+	"time"
+)
+
+// If more devices change at once, the remaining ones are published during the next poll.
+const changedQueueSize = 64
+
+// Is implemented by the services, its methods are only ever called from the goroutine of the loop.
+type Syncer interface {
+	// Publishes all devices, is called on start and on every poll.
+	SyncAll()
+	// Publishes a single device whose reports were invalidated.
+	SyncDevice(deviceID string)
+	// Publishes all devices even if they did not change, for instance after the broker lost its retained messages.
+	Republish()
+	// Is called once when the loop stops, receives the flag which was passed to `Stop`.
+	Shutdown(flag bool)
+}
+
+// Drives a `Syncer`: polls in the configured interval and forwards invalidated devices and republish requests.
+// Only the goroutine of the loop publishes, so the syncer does not need to lock its state.
+type Loop struct {
+	changed   chan string
+	republish chan struct{}
+	shutdown  chan bool
+	done      chan struct{}
+}
+
+func NewLoop() *Loop {
+	return &Loop{
+		changed:   make(chan string, changedQueueSize),
+		republish: make(chan struct{}, 1),
+		shutdown:  make(chan bool),
+		done:      make(chan struct{}),
+	}
+}
+
+// Requests the device to be published, is dropped if the queue is full.
+func (l *Loop) NotifyChanged(deviceID string) {
+	select {
+	case l.changed <- deviceID:
+	default:
+	}
+}
+
+func (l *Loop) RequestRepublish() {
+	select {
+	case l.republish <- struct{}{}:
+	default:
+	}
+}
+
+// Stops the loop and blocks until the syncer has shut down.
+func (l *Loop) Stop(flag bool) {
+	l.shutdown <- flag
+	<-l.done
+}
+
+// Runs the loop until `Stop` is called, is meant to be started in its own goroutine.
+func (l *Loop) Run(interval time.Duration, syncer Syncer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	syncer.SyncAll()
+
+	for {
+		select {
+		case flag := <-l.shutdown:
+			syncer.Shutdown(flag)
+			close(l.done)
+			return
+		case <-l.republish:
+			syncer.Republish()
+		case <-ticker.C:
+			syncer.SyncAll()
+		case deviceID := <-l.changed:
+			syncer.SyncDevice(deviceID)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package mqttdevices
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+//
+// Shared building blocks of the services which mirror devices to MQTT (the MQTT bridge and the Home Assistant exporter).
+// Both poll the devices of a configured user, publish states which changed and execute commands on behalf of this user.
+// Keeping the loop and the access checks in one place makes sure that the services cannot drift apart.
+//
+
+var log *logrus.Logger
+
+func InitLogger(logger *logrus.Logger) {
+	log = logger
+}